@@ -274,27 +274,25 @@ func (s *service) pidsInternal(ctx context.Context, req *task.PidsRequest) (*tas
 }
 
 func (s *service) pauseInternal(ctx context.Context, req *task.PauseRequest) (*emptypb.Empty, error) {
-	/*
-		s.events <- cdevent{
-			topic: runtime.TaskPausedEventTopic,
-			event: &eventstypes.TaskPaused{
-				req.ID,
-			},
-		}
-	*/
-	return nil, errdefs.ErrNotImplemented
+	t, err := s.getTask(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Pause(ctx); err != nil {
+		return nil, err
+	}
+	return empty, nil
 }
 
 func (s *service) resumeInternal(ctx context.Context, req *task.ResumeRequest) (*emptypb.Empty, error) {
-	/*
-		s.events <- cdevent{
-			topic: runtime.TaskResumedEventTopic,
-			event: &eventstypes.TaskResumed{
-				req.ID,
-			},
-		}
-	*/
-	return nil, errdefs.ErrNotImplemented
+	t, err := s.getTask(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Resume(ctx); err != nil {
+		return nil, err
+	}
+	return empty, nil
 }
 
 func (s *service) checkpointInternal(ctx context.Context, req *task.CheckpointTaskRequest) (*emptypb.Empty, error) {
@@ -400,7 +400,7 @@ func Test_PodShim_pidsInternal_2ndTaskID_Success(t *testing.T) {
 	}
 }
 
-func Test_PodShim_pauseInternal_Error(t *testing.T) {
+func Test_PodShim_pauseInternal_NoTask_Error(t *testing.T) {
 	s := service{
 		tid:       t.Name(),
 		isSandbox: true,
@@ -408,10 +408,10 @@ func Test_PodShim_pauseInternal_Error(t *testing.T) {
 
 	resp, err := s.pauseInternal(context.TODO(), &task.PauseRequest{ID: t.Name()})
 
-	verifyExpectedError(t, resp, err, errdefs.ErrNotImplemented)
+	verifyExpectedError(t, resp, err, errdefs.ErrNotFound)
 }
 
-func Test_PodShim_resumeInternal_Error(t *testing.T) {
+func Test_PodShim_resumeInternal_NoTask_Error(t *testing.T) {
 	s := service{
 		tid:       t.Name(),
 		isSandbox: true,
@@ -419,7 +419,7 @@ func Test_PodShim_resumeInternal_Error(t *testing.T) {
 
 	resp, err := s.resumeInternal(context.TODO(), &task.ResumeRequest{ID: t.Name()})
 
-	verifyExpectedError(t, resp, err, errdefs.ErrNotImplemented)
+	verifyExpectedError(t, resp, err, errdefs.ErrNotFound)
 }
 
 func Test_PodShim_checkpointInternal_Error(t *testing.T) {
@@ -325,7 +325,7 @@ func Test_TaskShim_pidsInternal_InitTaskID_Success(t *testing.T) {
 	}
 }
 
-func Test_TaskShim_pauseInternal_Error(t *testing.T) {
+func Test_TaskShim_pauseInternal_NoTask_Error(t *testing.T) {
 	s := service{
 		tid:       t.Name(),
 		isSandbox: true,
@@ -333,10 +333,10 @@ func Test_TaskShim_pauseInternal_Error(t *testing.T) {
 
 	resp, err := s.pauseInternal(context.TODO(), &task.PauseRequest{ID: t.Name()})
 
-	verifyExpectedError(t, resp, err, errdefs.ErrNotImplemented)
+	verifyExpectedError(t, resp, err, errdefs.ErrNotFound)
 }
 
-func Test_TaskShim_resumeInternal_Error(t *testing.T) {
+func Test_TaskShim_resumeInternal_NoTask_Error(t *testing.T) {
 	s := service{
 		tid:       t.Name(),
 		isSandbox: true,
@@ -344,7 +344,38 @@ func Test_TaskShim_resumeInternal_Error(t *testing.T) {
 
 	resp, err := s.resumeInternal(context.TODO(), &task.ResumeRequest{ID: t.Name()})
 
-	verifyExpectedError(t, resp, err, errdefs.ErrNotImplemented)
+	verifyExpectedError(t, resp, err, errdefs.ErrNotFound)
+}
+
+func Test_TaskShim_pauseInternal_InitTaskID_Success(t *testing.T) {
+	s, t1, _ := setupTaskServiceWithFakes(t)
+	t1.exec.state = shimExecStateRunning
+
+	resp, err := s.pauseInternal(context.TODO(), &task.PauseRequest{ID: t1.ID()})
+	if err != nil {
+		t.Fatalf("should not have failed with error got: %v", err)
+	}
+	if resp != empty {
+		t.Fatal("should have returned an empty response")
+	}
+	if !t1.paused {
+		t.Fatal("should have paused the task")
+	}
+
+	if _, err := s.resumeInternal(context.TODO(), &task.ResumeRequest{ID: t1.ID()}); err != nil {
+		t.Fatalf("should not have failed with error got: %v", err)
+	}
+	if t1.paused {
+		t.Fatal("should have resumed the task")
+	}
+}
+
+func Test_TaskShim_pauseInternal_InitTaskID_NotRunning_Error(t *testing.T) {
+	s, t1, _ := setupTaskServiceWithFakes(t)
+
+	resp, err := s.pauseInternal(context.TODO(), &task.PauseRequest{ID: t1.ID()})
+
+	verifyExpectedError(t, resp, err, errdefs.ErrFailedPrecondition)
 }
 
 func Test_TaskShim_checkpointInternal_Error(t *testing.T) {
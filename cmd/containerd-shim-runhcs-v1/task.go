@@ -99,6 +99,18 @@ type shimTask interface {
 	ProcessorInfo(ctx context.Context) (*processorInfo, error)
 	// Update updates a task's container
 	Update(ctx context.Context, req *task.UpdateTaskRequest) error
+	// Pause freezes all of the processes of the task's container.
+	//
+	// If the task's host does not support pausing containers this task MUST
+	// return `errdefs.ErrNotImplemented`. If the init exec is not in the
+	// `shimExecStateRunning` state this task MUST return
+	// `errdefs.ErrFailedPrecondition`.
+	Pause(ctx context.Context) error
+	// Resume thaws the processes of the task's paused container.
+	//
+	// If the task's host does not support pausing containers this task MUST
+	// return `errdefs.ErrNotImplemented`.
+	Resume(ctx context.Context) error
 }
 
 type processorInfo struct {
@@ -110,6 +122,9 @@ func verifyTaskUpdateResourcesType(data interface{}) error {
 	case *specs.WindowsResources:
 	case *specs.LinuxResources:
 	case *ctrdtaskapi.PolicyFragment:
+	case *ctrdtaskapi.PolicyFragmentRevocation:
+	case *ctrdtaskapi.PolicyFragmentMinimumSVN:
+	case *ctrdtaskapi.SignedSecurityPolicy:
 	case *ctrdtaskapi.ContainerMount:
 	default:
 		return errNotSupportedResourcesRequest
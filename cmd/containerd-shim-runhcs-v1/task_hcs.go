@@ -849,6 +849,61 @@ func (ht *hcsTask) Stats(ctx context.Context) (*stats.Statistics, error) {
 	return s, nil
 }
 
+// pausableContainer is a container which can be paused, which only the
+// containers of LCOW guests are.
+type pausableContainer interface {
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+}
+
+// pausable returns the container of the task if its guest supports pausing
+// and resuming it.
+func (ht *hcsTask) pausable() (pausableContainer, error) {
+	if ht.isWCOW || ht.host == nil || !ht.host.PauseResumeSupported() {
+		return nil, errors.Wrapf(errdefs.ErrNotImplemented, "pausing task %s is not supported by its host", ht.id)
+	}
+	c, ok := ht.c.(pausableContainer)
+	if !ok {
+		return nil, errors.Wrapf(errdefs.ErrNotImplemented, "pausing task %s is not supported by its container", ht.id)
+	}
+	return c, nil
+}
+
+func (ht *hcsTask) Pause(ctx context.Context) error {
+	c, err := ht.pausable()
+	if err != nil {
+		return err
+	}
+	if state := ht.init.State(); state != shimExecStateRunning {
+		return newExecInvalidStateError(ht.id, ht.id, state, "pause")
+	}
+	if err := c.Pause(ctx); err != nil {
+		return err
+	}
+	return ht.events.publishEvent(
+		ctx,
+		runtime.TaskPausedEventTopic,
+		&eventstypes.TaskPaused{
+			ContainerID: ht.id,
+		})
+}
+
+func (ht *hcsTask) Resume(ctx context.Context) error {
+	c, err := ht.pausable()
+	if err != nil {
+		return err
+	}
+	if err := c.Resume(ctx); err != nil {
+		return err
+	}
+	return ht.events.publishEvent(
+		ctx,
+		runtime.TaskResumedEventTopic,
+		&eventstypes.TaskResumed{
+			ContainerID: ht.id,
+		})
+}
+
 func (ht *hcsTask) Update(ctx context.Context, req *task.UpdateTaskRequest) error {
 	resources, err := typeurl.UnmarshalAny(req.Resources)
 	if err != nil {
@@ -318,3 +318,19 @@ func Test_hcsTask_DeleteExec_2ndExecID_ExitedState_Success(t *testing.T) {
 	}
 	verifyDeleteSuccessValues(t, pid, status, at, second)
 }
+
+func Test_hcsTask_Pause_Process_Isolated_Error(t *testing.T) {
+	lt, _, _ := setupTestHcsTask(t)
+
+	err := lt.Pause(context.TODO())
+
+	verifyExpectedError(t, nil, err, errdefs.ErrNotImplemented)
+}
+
+func Test_hcsTask_Resume_Process_Isolated_Error(t *testing.T) {
+	lt, _, _ := setupTestHcsTask(t)
+
+	err := lt.Resume(context.TODO())
+
+	verifyExpectedError(t, nil, err, errdefs.ErrNotImplemented)
+}
@@ -26,6 +26,7 @@ type testShimTask struct {
 	isWCOW bool
 	exec   *testShimExec
 	execs  map[string]*testShimExec
+	paused bool
 }
 
 func (tst *testShimTask) ID() string {
@@ -128,6 +129,25 @@ func (tst *testShimTask) Update(ctx context.Context, req *task.UpdateTaskRequest
 	return nil
 }
 
+func (tst *testShimTask) Pause(ctx context.Context) error {
+	if tst.isWCOW {
+		return errdefs.ErrNotImplemented
+	}
+	if tst.exec.State() != shimExecStateRunning {
+		return errdefs.ErrFailedPrecondition
+	}
+	tst.paused = true
+	return nil
+}
+
+func (tst *testShimTask) Resume(ctx context.Context) error {
+	if tst.isWCOW {
+		return errdefs.ErrNotImplemented
+	}
+	tst.paused = false
+	return nil
+}
+
 func (tst *testShimTask) Share(ctx context.Context, req *shimdiag.ShareRequest) error {
 	return errors.New("not implemented")
 }
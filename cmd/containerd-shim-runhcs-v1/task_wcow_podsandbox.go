@@ -285,6 +285,14 @@ func (wpst *wcowPodSandboxTask) Update(ctx context.Context, req *task.UpdateTask
 	return wpst.host.Update(ctx, resources, req.Annotations)
 }
 
+func (wpst *wcowPodSandboxTask) Pause(ctx context.Context) error {
+	return errors.Wrap(errdefs.ErrNotImplemented, "pausing a WCOW pod sandbox task is not supported")
+}
+
+func (wpst *wcowPodSandboxTask) Resume(ctx context.Context) error {
+	return errors.Wrap(errdefs.ErrNotImplemented, "resuming a WCOW pod sandbox task is not supported")
+}
+
 func (wpst *wcowPodSandboxTask) Share(ctx context.Context, req *shimdiag.ShareRequest) error {
 	if wpst.host == nil {
 		return errTaskNotIsolated
@@ -15,7 +15,6 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
-	cgroups "github.com/containerd/cgroups/v3/cgroup1"
 	cgroupstats "github.com/containerd/cgroups/v3/cgroup1/stats"
 	oci "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
@@ -23,6 +22,8 @@ import (
 	"go.opencensus.io/trace"
 
 	"github.com/Microsoft/hcsshim/internal/guest/bridge"
+	"github.com/Microsoft/hcsshim/internal/guest/cgroup"
+	"github.com/Microsoft/hcsshim/internal/guest/keyrelease"
 	"github.com/Microsoft/hcsshim/internal/guest/kmsg"
 	"github.com/Microsoft/hcsshim/internal/guest/runtime/hcsv2"
 	"github.com/Microsoft/hcsshim/internal/guest/runtime/runc"
@@ -48,22 +49,28 @@ func memoryLogFormat(metrics *cgroupstats.Metrics) logrus.Fields {
 	}
 }
 
-func readMemoryEvents(startTime time.Time, efdFile *os.File, cgName string, threshold int64, cg cgroups.Cgroup) {
-	// Buffer must be >= 8 bytes for eventfd reads
-	// http://man7.org/linux/man-pages/man2/eventfd.2.html
+func pressureLogFormat(pressure *cgroup.Pressure) logrus.Fields {
+	fields := logrus.Fields{}
+	if pressure.Some != nil {
+		fields["memoryPressureSomeAvg10"] = pressure.Some.Avg10
+		fields["memoryPressureSomeTotal"] = pressure.Some.Total
+	}
+	if pressure.Full != nil {
+		fields["memoryPressureFullAvg10"] = pressure.Full.Avg10
+		fields["memoryPressureFullTotal"] = pressure.Full.Total
+	}
+	return fields
+}
+
+func readMemoryEvents(startTime time.Time, notifier cgroup.Notifier, cgName string, threshold int64, cg cgroup.Cgroup) {
 	count := 0
-	buf := make([]byte, 8)
 	for {
-		if _, err := efdFile.Read(buf); err != nil {
-			logrus.WithError(err).WithField("cgroup", cgName).Error("failed to read from eventfd")
-			return
-		}
-
-		// Sometimes an event is sent during cgroup teardown, but does not indicate that the
-		// threshold was actually crossed. In the teardown case the cgroup.event_control file
-		// won't exist anymore, so check that to determine if we should ignore this event.
-		_, err := os.Lstat(fmt.Sprintf("/sys/fs/cgroup/memory%s/cgroup.event_control", cgName))
-		if os.IsNotExist(err) {
+		if err := notifier.Wait(); err != nil {
+			// Sometimes an event is sent during cgroup teardown, but does not indicate that the
+			// threshold was actually crossed, so stop monitoring the cgroup.
+			if !errors.Is(err, cgroup.ErrDeleted) {
+				logrus.WithError(err).WithField("cgroup", cgName).Error("failed to wait for memory event")
+			}
 			return
 		}
 
@@ -84,7 +91,11 @@ func readMemoryEvents(startTime time.Time, efdFile *os.File, cgName string, thre
 		// Sleep for one second in case there is a series of allocations slightly after
 		// reaching threshold.
 		time.Sleep(time.Second)
-		metrics, err := cg.Stat(cgroups.IgnoreNotExist)
+		// Pressure stall information is only available on the unified hierarchy.
+		if pressure, err := cg.Pressure(); err == nil && pressure.Memory != nil {
+			entry = entry.WithFields(pressureLogFormat(pressure.Memory))
+		}
+		metrics, err := cg.Stat()
 		if err != nil {
 			// Don't return on Stat err as it will return an error if
 			// any of the cgroup subsystems Stat calls failed for any reason.
@@ -205,6 +216,21 @@ func main() {
 	initialPolicyStance := flag.String("initial-policy-stance",
 		"allow",
 		"Stance: allow, deny.")
+	externalEnforcerAddress := flag.String("external-enforcer-address",
+		securitypolicy.ExternalEnforcerAddress,
+		"unix socket of the policy enforcer service used by the external enforcer")
+	keyBrokerEndpoint := flag.String("key-broker-endpoint",
+		"",
+		"URL of the key broker which releases the keys of persistent encrypted disks")
+	keyBrokerKeyPath := flag.String("key-broker-key",
+		"",
+		"PEM public key with which the key broker signs its responses, which must be part of the measured UVM image")
+	ociRuntime := flag.String("runtime",
+		"runc",
+		"OCI runtime of the containers, such as runc or crun, which must implement the command line of runc")
+	ociRuntimes := flag.String("runtimes",
+		"",
+		"comma separated list of additional OCI runtimes which containers can select by annotation")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "\nUsage of %s:\n", os.Args[0])
@@ -239,6 +265,8 @@ func main() {
 		logWriter = os.Stderr
 	}
 
+	securitypolicy.ExternalEnforcerAddress = *externalEnforcerAddress
+
 	// set up our initial stance policy enforcer
 	var initialEnforcer securitypolicy.SecurityPolicyEnforcer
 	switch *initialPolicyStance {
@@ -305,11 +333,13 @@ func main() {
 	// containers, and virtual-pods for multi-pod support.
 	//
 
-	// Write 1 to memory.use_hierarchy on the root cgroup to enable hierarchy
-	// support. This needs to be set before we create any cgroups as the write
-	// will fail otherwise.
-	if err := os.WriteFile("/sys/fs/cgroup/memory/memory.use_hierarchy", []byte("1"), 0644); err != nil {
-		logrus.WithError(err).Fatal("failed to enable hierarchy support for root cgroup")
+	// The cgroups are created on the hierarchy mounted by init, which is
+	// either the legacy (v1) or the unified (v2) one. The root cgroup needs to
+	// be prepared before we create any cgroups.
+	hierarchy := cgroup.Detect()
+	logrus.WithField("hierarchy", hierarchy).Info("detected cgroup hierarchy")
+	if err := cgroup.Init(); err != nil {
+		logrus.WithError(err).Fatal("failed to initialize root cgroup")
 	}
 
 	// The containers cgroup is limited only by {Totalram - 75 MB
@@ -322,7 +352,7 @@ func main() {
 		logrus.WithError(err).Fatal("failed to get sys info")
 	}
 	containersLimit := int64(sinfo.Totalram - *rootMemReserveBytes)
-	containersControl, err := cgroups.New(cgroups.StaticPath("/containers"), &oci.LinuxResources{
+	containersControl, err := cgroup.New("/containers", &oci.LinuxResources{
 		Memory: &oci.LinuxMemory{
 			Limit: &containersLimit,
 		},
@@ -334,7 +364,7 @@ func main() {
 
 	// Create virtual-pods cgroup hierarchy for multi-pod support
 	// This will be the parent for all virtual pod cgroups: /containers/virtual-pods/{virtualSandboxID}
-	virtualPodsControl, err := cgroups.New(cgroups.StaticPath("/containers/virtual-pods"), &oci.LinuxResources{
+	virtualPodsControl, err := cgroup.New("/containers/virtual-pods", &oci.LinuxResources{
 		Memory: &oci.LinuxMemory{
 			Limit: &containersLimit, // Share the same limit as containers
 		},
@@ -344,19 +374,19 @@ func main() {
 	}
 	defer virtualPodsControl.Delete() //nolint:errcheck
 
-	gcsControl, err := cgroups.New(cgroups.StaticPath("/gcs"), &oci.LinuxResources{})
+	gcsControl, err := cgroup.New("/gcs", &oci.LinuxResources{})
 	if err != nil {
 		logrus.WithError(err).Fatal("failed to create gcs cgroup")
 	}
 	defer gcsControl.Delete() //nolint:errcheck
-	if err := gcsControl.Add(cgroups.Process{Pid: os.Getpid()}); err != nil {
+	if err := gcsControl.Add(os.Getpid()); err != nil {
 		logrus.WithError(err).Fatal("failed add gcs pid to gcs cgroup")
 	}
 
 	tport := &transport.VsockTransport{}
-	rtime, err := runc.NewRuntime(baseLogPath)
+	rtime, err := runc.NewOCIRuntime(*ociRuntime, baseLogPath)
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to initialize new runc runtime")
+		logrus.WithError(err).Fatalf("failed to initialize new %s runtime", *ociRuntime)
 	}
 	mux := bridge.NewBridgeMux()
 	b := bridge.Bridge{
@@ -364,6 +394,33 @@ func main() {
 		EnableV4: *v4,
 	}
 	h := hcsv2.NewHost(rtime, tport, initialEnforcer, logWriter)
+	if *keyBrokerEndpoint != "" {
+		if *keyBrokerKeyPath == "" {
+			logrus.Fatal("the key of the key broker must be set along with its endpoint")
+		}
+		keyPEM, err := os.ReadFile(*keyBrokerKeyPath)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to read key of the key broker")
+		}
+		brokerKey, err := keyrelease.ParseBrokerKey(keyPEM)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to parse key of the key broker")
+		}
+		h.SetKeyBroker(*keyBrokerEndpoint, brokerKey)
+	}
+	h.AddRuntime(*ociRuntime, rtime)
+	for _, name := range strings.Split(*ociRuntimes, ",") {
+		if name == "" || name == *ociRuntime {
+			continue
+		}
+		r, err := runc.NewOCIRuntime(name, baseLogPath)
+		if err != nil {
+			// containers which select the runtime fail to be created instead
+			logrus.WithError(err).Warnf("failed to initialize %s runtime", name)
+			continue
+		}
+		h.AddRuntime(name, r)
+	}
 	// Initialize virtual pod support in the host
 	h.InitializeVirtualPodSupport(virtualPodsControl)
 	b.AssignHandlers(mux, h)
@@ -386,28 +443,24 @@ func main() {
 		bridgeOut = bridgeCon
 	}
 
-	event := cgroups.MemoryThresholdEvent(*gcsMemLimitBytes, false)
-	gefd, err := gcsControl.RegisterMemoryEvent(event)
+	gcsThreshold, err := gcsControl.RegisterMemoryThreshold(*gcsMemLimitBytes)
 	if err != nil {
 		logrus.WithError(err).Fatal("failed to register memory threshold for gcs cgroup")
 	}
-	gefdFile := os.NewFile(gefd, "gefd")
-	defer gefdFile.Close()
+	defer gcsThreshold.Close()
 
-	oom, err := containersControl.OOMEventFD()
+	oom, err := containersControl.RegisterOOM()
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to retrieve the container cgroups oom eventfd")
+		logrus.WithError(err).Fatal("failed to register oom notifications for the containers cgroup")
 	}
-	oomFile := os.NewFile(oom, "cefd")
-	defer oomFile.Close()
+	defer oom.Close()
 
 	// Setup OOM monitoring for virtual-pods cgroup
-	virtualPodsOom, err := virtualPodsControl.OOMEventFD()
+	virtualPodsOom, err := virtualPodsControl.RegisterOOM()
 	if err != nil {
-		logrus.WithError(err).Fatal("failed to retrieve the virtual-pods cgroups oom eventfd")
+		logrus.WithError(err).Fatal("failed to register oom notifications for the virtual-pods cgroup")
 	}
-	virtualPodsOomFile := os.NewFile(virtualPodsOom, "vp-oomfd")
-	defer virtualPodsOomFile.Close()
+	defer virtualPodsOom.Close()
 
 	// time synchronization service
 	if !(*disableTimeSync) {
@@ -416,9 +469,9 @@ func main() {
 		}
 	}
 
-	go readMemoryEvents(startTime, gefdFile, "/gcs", int64(*gcsMemLimitBytes), gcsControl)
-	go readMemoryEvents(startTime, oomFile, "/containers", containersLimit, containersControl)
-	go readMemoryEvents(startTime, virtualPodsOomFile, "/containers/virtual-pods", containersLimit, virtualPodsControl)
+	go readMemoryEvents(startTime, gcsThreshold, "/gcs", int64(*gcsMemLimitBytes), gcsControl)
+	go readMemoryEvents(startTime, oom, "/containers", containersLimit, containersControl)
+	go readMemoryEvents(startTime, virtualPodsOom, "/containers/virtual-pods", containersLimit, virtualPodsControl)
 	err = b.ListenAndServe(bridgeIn, bridgeOut)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
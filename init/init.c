@@ -136,7 +136,6 @@ const struct InitOp ops[] = {
 
     // mount /sys (which should already exist)
     {OpMount, .mount = {"sysfs", "/sys", "sysfs", MS_NODEV | MS_NOSUID | MS_NOEXEC}},
-    {OpMount, .mount = {"cgroup_root", "/sys/fs/cgroup", "tmpfs", MS_NODEV | MS_NOSUID | MS_NOEXEC, "mode=0755"}},
 };
 
 /*
@@ -304,7 +303,69 @@ void init_fs(const struct InitOp* ops, size_t count) {
     }
 }
 
+// filesystem_supported returns whether the kernel lists the filesystem type
+// in /proc/filesystems.
+bool filesystem_supported(const char* type) {
+    const char* fpath = "/proc/filesystems";
+    FILE* f = fopen(fpath, "r");
+    if (f == NULL) {
+        die2("fopen", fpath);
+    }
+    bool supported = false;
+    char line[256];
+    while (fgets(line, sizeof(line), f) != NULL) {
+        // Each line is an optional "nodev" flag, a tab and the type.
+        char* name = strchr(line, '\t');
+        name = name != NULL ? name + 1 : line;
+        name[strcspn(name, "\n")] = '\0';
+        if (strcmp(name, type) == 0) {
+            supported = true;
+            break;
+        }
+    }
+    fclose(f);
+    return supported;
+}
+
+// unified_cgroups returns whether only the unified (v2) cgroup hierarchy can
+// be mounted, either because the kernel command line disables the v1
+// hierarchies or because the kernel was built without them.
+bool unified_cgroups() {
+    if (!filesystem_supported("cgroup")) {
+        return true;
+    }
+
+    const char* fpath = "/proc/cmdline";
+    FILE* f = fopen(fpath, "r");
+    if (f == NULL) {
+        die2("fopen", fpath);
+    }
+    bool unified = false;
+    char param[256];
+    while (fscanf(f, "%255s", param) == 1) {
+        if (strcmp(param, "cgroup_no_v1=all") == 0 || strcmp(param, "systemd.unified_cgroup_hierarchy=1") == 0) {
+            unified = true;
+        }
+    }
+    fclose(f);
+    return unified;
+}
+
+void init_unified_cgroups() {
+    if (mount("cgroup2", "/sys/fs/cgroup", "cgroup2", MS_NODEV | MS_NOSUID | MS_NOEXEC, "nsdelegate") < 0) {
+        die2("mount", "/sys/fs/cgroup");
+    }
+}
+
 void init_cgroups() {
+    if (unified_cgroups()) {
+        init_unified_cgroups();
+        return;
+    }
+
+    if (mount("cgroup_root", "/sys/fs/cgroup", "tmpfs", MS_NODEV | MS_NOSUID | MS_NOEXEC, "mode=0755") < 0) {
+        die2("mount", "/sys/fs/cgroup");
+    }
     const char* fpath = "/proc/cgroups";
     FILE* f = fopen(fpath, "r");
     if (f == NULL) {
@@ -317,6 +378,7 @@ void init_cgroups() {
             break;
         }
     }
+    bool mounted = false;
     for (;;) {
         static const char base_path[] = "/sys/fs/cgroup/";
         char path[sizeof(base_path) - 1 + 64];
@@ -336,8 +398,24 @@ void init_cgroups() {
                 die2("mkdir", path);
             }
             if (mount(name, path, "cgroup", MS_NODEV | MS_NOSUID | MS_NOEXEC, name) < 0) {
+                // The kernel may not support the v1 hierarchies even though it
+                // lists the filesystem, in which case the unified hierarchy is
+                // mounted instead.
+                if (!mounted && (errno == ENODEV || errno == EINVAL)) {
+                    warn2("mount", path);
+                    fclose(f);
+                    if (rmdir(path) < 0) {
+                        die2("rmdir", path);
+                    }
+                    if (umount("/sys/fs/cgroup") < 0) {
+                        die2("umount", "/sys/fs/cgroup");
+                    }
+                    init_unified_cgroups();
+                    return;
+                }
                 die2("mount", path);
             }
+            mounted = true;
         }
     }
     fclose(f);
@@ -580,6 +580,75 @@ func (b *Bridge) modifySettings(req *request) (err error) {
 				return errors.New("the request settings are not of type SecurityPolicyFragment")
 			}
 			return b.hostState.securityOptions.InjectFragment(ctx, r)
+		case guestresource.ResourceTypePolicyFragmentReplace:
+			r, ok := modifyGuestSettingsRequest.Settings.(*guestresource.SecurityPolicyFragment)
+			if !ok {
+				return errors.New("the request settings are not of type SecurityPolicyFragment")
+			}
+			if err := b.hostState.securityOptions.ReplaceFragment(ctx, r); err != nil {
+				return errors.Wrap(err, "failed to replace security policy fragment")
+			}
+			// Send response back to shim
+			resp := &prot.ResponseBase{
+				Result:     0, // 0 means success
+				ActivityID: req.activityID,
+			}
+			if err := b.sendResponseToShim(req.ctx, prot.RPCModifySettings, req.header.ID, resp); err != nil {
+				return fmt.Errorf("error sending response to hcsshim: %w", err)
+			}
+			return nil
+		case guestresource.ResourceTypePolicyFragmentRevoke:
+			r, ok := modifyGuestSettingsRequest.Settings.(*guestresource.SecurityPolicyFragmentRevocation)
+			if !ok {
+				return errors.New("the request settings are not of type SecurityPolicyFragmentRevocation")
+			}
+			if err := b.hostState.securityOptions.RevokeFragment(ctx, r); err != nil {
+				return errors.Wrap(err, "failed to revoke security policy fragment")
+			}
+			// Send response back to shim
+			resp := &prot.ResponseBase{
+				Result:     0, // 0 means success
+				ActivityID: req.activityID,
+			}
+			if err := b.sendResponseToShim(req.ctx, prot.RPCModifySettings, req.header.ID, resp); err != nil {
+				return fmt.Errorf("error sending response to hcsshim: %w", err)
+			}
+			return nil
+		case guestresource.ResourceTypePolicyFragmentMinimumSVN:
+			r, ok := modifyGuestSettingsRequest.Settings.(*guestresource.SecurityPolicyFragmentMinimumSVN)
+			if !ok {
+				return errors.New("the request settings are not of type SecurityPolicyFragmentMinimumSVN")
+			}
+			if err := b.hostState.securityOptions.SetFragmentMinimumSVN(ctx, r); err != nil {
+				return errors.Wrap(err, "failed to set security policy fragment minimum SVN")
+			}
+			// Send response back to shim
+			resp := &prot.ResponseBase{
+				Result:     0, // 0 means success
+				ActivityID: req.activityID,
+			}
+			if err := b.sendResponseToShim(req.ctx, prot.RPCModifySettings, req.header.ID, resp); err != nil {
+				return fmt.Errorf("error sending response to hcsshim: %w", err)
+			}
+			return nil
+
+		case guestresource.ResourceTypeSecurityPolicyReplace:
+			r, ok := modifyGuestSettingsRequest.Settings.(*guestresource.SignedSecurityPolicy)
+			if !ok {
+				return errors.New("the request settings are not of type SignedSecurityPolicy")
+			}
+			if err := b.hostState.securityOptions.ReplaceSignedPolicy(ctx, r); err != nil {
+				return errors.Wrap(err, "failed to replace security policy")
+			}
+			// Send response back to shim
+			resp := &prot.ResponseBase{
+				Result:     0, // 0 means success
+				ActivityID: req.activityID,
+			}
+			if err := b.sendResponseToShim(req.ctx, prot.RPCModifySettings, req.header.ID, resp); err != nil {
+				return fmt.Errorf("error sending response to hcsshim: %w", err)
+			}
+			return nil
 
 		case guestresource.ResourceTypeWCOWBlockCims:
 			// This is request to mount the merged cim at given volumeGUID
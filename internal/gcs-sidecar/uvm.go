@@ -98,6 +98,34 @@ func unmarshalContainerModifySettings(req *request) (_ *prot.ContainerModifySett
 			}
 			modifyGuestSettingsRequest.Settings = securityPolicyRequest
 
+		case guestresource.ResourceTypePolicyFragmentReplace:
+			fragment := &guestresource.SecurityPolicyFragment{}
+			if err := commonutils.UnmarshalJSONWithHresult(rawGuestRequest, fragment); err != nil {
+				return nil, fmt.Errorf("invalid ResourceTypePolicyFragmentReplace request: %w", err)
+			}
+			modifyGuestSettingsRequest.Settings = fragment
+
+		case guestresource.ResourceTypePolicyFragmentRevoke:
+			revocation := &guestresource.SecurityPolicyFragmentRevocation{}
+			if err := commonutils.UnmarshalJSONWithHresult(rawGuestRequest, revocation); err != nil {
+				return nil, fmt.Errorf("invalid ResourceTypePolicyFragmentRevoke request: %w", err)
+			}
+			modifyGuestSettingsRequest.Settings = revocation
+
+		case guestresource.ResourceTypePolicyFragmentMinimumSVN:
+			minimumSVN := &guestresource.SecurityPolicyFragmentMinimumSVN{}
+			if err := commonutils.UnmarshalJSONWithHresult(rawGuestRequest, minimumSVN); err != nil {
+				return nil, fmt.Errorf("invalid ResourceTypePolicyFragmentMinimumSVN request: %w", err)
+			}
+			modifyGuestSettingsRequest.Settings = minimumSVN
+
+		case guestresource.ResourceTypeSecurityPolicyReplace:
+			policy := &guestresource.SignedSecurityPolicy{}
+			if err := commonutils.UnmarshalJSONWithHresult(rawGuestRequest, policy); err != nil {
+				return nil, fmt.Errorf("invalid ResourceTypeSecurityPolicyReplace request: %w", err)
+			}
+			modifyGuestSettingsRequest.Settings = policy
+
 		case guestresource.ResourceTypeMappedVirtualDiskForContainerScratch:
 			wcowMappedVirtualDisk := &guestresource.WCOWMappedVirtualDisk{}
 			if err := commonutils.UnmarshalJSONWithHresult(rawGuestRequest, wcowMappedVirtualDisk); err != nil {
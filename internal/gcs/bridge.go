@@ -58,6 +58,11 @@ type bridge struct {
 	log     *logrus.Entry
 	brdgErr error
 	waitCh  chan struct{}
+
+	// notifyEvent is called for container event notifications, which the
+	// guest only sends once the host subscribes to them. It must be set
+	// before Start.
+	notifyEvent eventFunc
 }
 
 var errBridgeClosed = fmt.Errorf("bridge closed: %w", net.ErrClosed)
@@ -69,6 +74,8 @@ const (
 
 type notifyFunc func(*prot.ContainerNotification) error
 
+type eventFunc func(*prot.ContainerEvent)
+
 // newBridge returns a bridge on `conn`. It calls `notify` when a
 // notification message arrives from the guest. It logs transport errors and
 // traces using `log`.
@@ -332,19 +339,30 @@ func (brdg *bridge) recvLoop() error {
 			}
 
 		case prot.MsgTypeNotify:
-			if typ != prot.NotifyContainer|prot.ComputeSystem|prot.MsgTypeNotify {
+			switch typ {
+			case prot.NotifyContainer | prot.ComputeSystem | prot.MsgTypeNotify:
+				var ntf prot.ContainerNotification
+				ntf.ResultInfo.Value = &json.RawMessage{}
+				err := json.Unmarshal(b, &ntf)
+				if err != nil {
+					return fmt.Errorf("bridge response unmarshal failed: %w", err)
+				}
+				err = brdg.notify(&ntf)
+				if err != nil {
+					return fmt.Errorf("bridge notification failed: %w", err)
+				}
+			case prot.NotifyContainerEvent | prot.ComputeSystem | prot.MsgTypeNotify:
+				var e prot.ContainerEvent
+				err := json.Unmarshal(b, &e)
+				if err != nil {
+					return fmt.Errorf("bridge event unmarshal failed: %w", err)
+				}
+				if brdg.notifyEvent != nil {
+					brdg.notifyEvent(&e)
+				}
+			default:
 				return fmt.Errorf("bridge received unknown unknown notification message %s", typ)
 			}
-			var ntf prot.ContainerNotification
-			ntf.ResultInfo.Value = &json.RawMessage{}
-			err := json.Unmarshal(b, &ntf)
-			if err != nil {
-				return fmt.Errorf("bridge response unmarshal failed: %w", err)
-			}
-			err = brdg.notify(&ntf)
-			if err != nil {
-				return fmt.Errorf("bridge notification failed: %w", err)
-			}
 		default:
 			return fmt.Errorf("bridge received unknown unknown message type %s", typ)
 		}
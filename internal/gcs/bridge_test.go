@@ -204,3 +204,46 @@ func TestBridgeNotifyFailure(t *testing.T) {
 		t.Error("unexpected result: ", err)
 	}
 }
+
+func TestBridgeNotifyEvent(t *testing.T) {
+	e := &prot.ContainerEvent{
+		Type:      "Metrics",
+		Timestamp: time.Now().UTC(),
+		Pressure: &prot.PressureStats{
+			Memory: &prot.Pressure{Some: &prot.PressureData{Avg10: 1.5, TotalInUs: 1234}},
+		},
+		MemoryEvents: &prot.MemoryEventStats{High: 20, OOMKill: 1},
+	}
+	s, c := pipeConn()
+	b := newBridge(s, func(*prot.ContainerNotification) error {
+		t.Error("unexpected container notification")
+		return nil
+	}, logrus.NewEntry(logrus.StandardLogger()))
+	recvd := make(chan *prot.ContainerEvent, 1)
+	b.notifyEvent = func(ne *prot.ContainerEvent) { recvd <- ne }
+	b.Start()
+	defer b.Close()
+	if err := sendJSON(t, c, prot.MsgTypeNotify|prot.ComputeSystem|prot.NotifyContainerEvent, 0, e); err != nil {
+		t.Fatal("notify failed: ", err)
+	}
+	select {
+	case ne := <-recvd:
+		if !reflect.DeepEqual(e, ne) {
+			t.Errorf("%+v != %+v", e, ne)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not receive event")
+	}
+}
+
+func TestBridgeNotifyEventWithoutSubscriber(t *testing.T) {
+	// events which are not subscribed to must not kill the bridge
+	e := &prot.ContainerEvent{Type: "Metrics"}
+	err := notifyThroughBridge(t, prot.MsgTypeNotify|prot.ComputeSystem|prot.NotifyContainerEvent, e, func(*prot.ContainerNotification) error {
+		t.Error("unexpected container notification")
+		return nil
+	})
+	if err != nil {
+		t.Error("notify failed: ", err)
+	}
+}
@@ -5,6 +5,7 @@ package gcs
 import (
 	"context"
 	"errors"
+	"io"
 	"sync"
 	"time"
 
@@ -188,6 +189,179 @@ func (c *Container) Start(ctx context.Context) (err error) {
 	return c.gc.brdg.RPC(ctx, prot.RPCStart, &req, &resp, false)
 }
 
+// Pause freezes all of the processes of the container. It requires a guest
+// with the PauseResumeSupported capability.
+func (c *Container) Pause(ctx context.Context) (err error) {
+	ctx, span := oc.StartSpan(ctx, "gcs::Container::Pause", oc.WithClientSpanKind)
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", c.id))
+
+	req := makeRequest(ctx, c.id)
+	var resp prot.ResponseBase
+	return c.gc.brdg.RPC(ctx, prot.RPCPauseContainer, &req, &resp, false)
+}
+
+// Resume thaws the processes of a paused container. It requires a guest with
+// the PauseResumeSupported capability.
+func (c *Container) Resume(ctx context.Context) (err error) {
+	ctx, span := oc.StartSpan(ctx, "gcs::Container::Resume", oc.WithClientSpanKind)
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", c.id))
+
+	req := makeRequest(ctx, c.id)
+	var resp prot.ResponseBase
+	return c.gc.brdg.RPC(ctx, prot.RPCResumeContainer, &req, &resp, false)
+}
+
+// Checkpoint writes a CRIU checkpoint image of the container to imagePath, a
+// directory in the guest on a SCSI disk or a directory mapped into the guest.
+// The container exits once it is checkpointed, unless leaveRunning is set. It
+// requires a guest with the CheckpointRestoreSupported capability.
+func (c *Container) Checkpoint(ctx context.Context, imagePath string, leaveRunning bool) (err error) {
+	ctx, span := oc.StartSpan(ctx, "gcs::Container::Checkpoint", oc.WithClientSpanKind)
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(
+		trace.StringAttribute("cid", c.id),
+		trace.StringAttribute("imagePath", imagePath),
+		trace.BoolAttribute("leaveRunning", leaveRunning))
+
+	req := prot.ContainerCheckpoint{
+		RequestBase:  makeRequest(ctx, c.id),
+		ImagePath:    imagePath,
+		LeaveRunning: leaveRunning,
+	}
+	var resp prot.ResponseBase
+	return c.gc.brdg.RPC(ctx, prot.RPCCheckpointContainer, &req, &resp, false)
+}
+
+// CopyTo extracts the tar archive read from r into the directory path of the
+// container, which is created if missing. The extracted files are owned by the
+// user of the container, unless preserveOwnership keeps the owners recorded in
+// the archive. It requires a guest with the CopyFilesSupported capability.
+func (c *Container) CopyTo(ctx context.Context, path string, r io.Reader, preserveOwnership bool) (err error) {
+	ctx, span := oc.StartSpan(ctx, "gcs::Container::CopyTo", oc.WithClientSpanKind)
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(
+		trace.StringAttribute("cid", c.id),
+		trace.StringAttribute("path", path),
+		trace.BoolAttribute("preserveOwnership", preserveOwnership))
+
+	ch, port, err := c.gc.newIoChannel()
+	if err != nil {
+		return err
+	}
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(ch, r)
+		if err == nil {
+			err = ch.CloseWrite()
+		}
+		copyErr <- err
+	}()
+	defer ch.Close()
+
+	req := prot.ContainerCopy{
+		RequestBase:       makeRequest(ctx, c.id),
+		Path:              path,
+		Port:              port,
+		PreserveOwnership: preserveOwnership,
+	}
+	var resp prot.ResponseBase
+	if err := c.gc.brdg.RPC(ctx, prot.RPCCopyToContainer, &req, &resp, false); err != nil {
+		return err
+	}
+	// the guest has read the whole archive once it responds
+	return <-copyErr
+}
+
+// CopyFrom writes a tar archive of the file or directory path of the container
+// to w. It requires a guest with the CopyFilesSupported capability.
+func (c *Container) CopyFrom(ctx context.Context, path string, w io.Writer) (err error) {
+	ctx, span := oc.StartSpan(ctx, "gcs::Container::CopyFrom", oc.WithClientSpanKind)
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(
+		trace.StringAttribute("cid", c.id),
+		trace.StringAttribute("path", path))
+
+	ch, port, err := c.gc.newIoChannel()
+	if err != nil {
+		return err
+	}
+	copyErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, ch)
+		copyErr <- err
+	}()
+
+	req := prot.ContainerCopy{
+		RequestBase: makeRequest(ctx, c.id),
+		Path:        path,
+		Port:        port,
+	}
+	var resp prot.ResponseBase
+	if err := c.gc.brdg.RPC(ctx, prot.RPCCopyFromContainer, &req, &resp, false); err != nil {
+		ch.Close()
+		<-copyErr
+		return err
+	}
+	// the guest has written the whole archive once it responds, which is
+	// read until the guest closes the connection
+	err = <-copyErr
+	ch.Close()
+	return err
+}
+
+// SubscribeEvents subscribes to the events of the container in sub, and
+// returns the channel of its events, replacing any previous subscription and
+// closing its channel. The channel is closed once the container exits. Events
+// are dropped if they are not received in time. It requires a guest with the
+// EventNotificationsSupported capability.
+func (c *Container) SubscribeEvents(ctx context.Context, sub *prot.ContainerSubscribeEvents) (_ <-chan *prot.ContainerEvent, err error) {
+	ctx, span := oc.StartSpan(ctx, "gcs::Container::SubscribeEvents", oc.WithClientSpanKind)
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(
+		trace.StringAttribute("cid", c.id),
+		trace.BoolAttribute("memoryEvents", sub.MemoryEvents),
+		trace.Int64Attribute("pressureTriggers", int64(len(sub.PressureTriggers))),
+		trace.Int64Attribute("metricsIntervalInMs", int64(sub.MetricsIntervalInMs)))
+
+	// subscribe before the request, so that the first events are not dropped
+	ch, err := c.gc.subscribeEvents(c.id)
+	if err != nil {
+		return nil, err
+	}
+	req := *sub
+	req.RequestBase = makeRequest(ctx, c.id)
+	var resp prot.ResponseBase
+	if err := c.gc.brdg.RPC(ctx, prot.RPCSubscribeContainerEvents, &req, &resp, false); err != nil {
+		c.gc.unsubscribeEvents(c.id)
+		return nil, err
+	}
+	return ch, nil
+}
+
+// AttachProcess attaches new stdio to the running process pid of the
+// container, such as after reconnecting to the guest, and returns the process.
+// The output of the process which the guest kept while nothing was attached to
+// it is replayed to the new stdio. It requires a guest with the
+// AttachProcessSupported capability.
+func (c *Container) AttachProcess(ctx context.Context, pid uint32, stdin, stdout, stderr bool) (_ cow.Process, err error) {
+	ctx, span := oc.StartSpan(ctx, "gcs::Container::AttachProcess", oc.WithClientSpanKind)
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(
+		trace.StringAttribute("cid", c.id),
+		trace.Int64Attribute("pid", int64(pid)))
+
+	return c.gc.attach(ctx, c.id, pid, stdin, stdout, stderr)
+}
+
 func (c *Container) shutdown(ctx context.Context, proc prot.RPCProc) error {
 	req := makeRequest(ctx, c.id)
 	var resp prot.ResponseBase
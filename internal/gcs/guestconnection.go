@@ -31,6 +31,10 @@ const (
 
 	firstIoChannelVsockPort = prot.LinuxGcsVsockPort + 1
 	nullContainerID         = "00000000-0000-0000-0000-000000000000"
+
+	// eventChannelSize is the number of events of a container which are
+	// buffered for its subscriber.
+	eventChannelSize = 64
 )
 
 // IoListenFunc is a type for a function that creates a listener for a VM for
@@ -75,9 +79,11 @@ func (gcc *GuestConnectionConfig) Connect(ctx context.Context, isColdStart bool)
 	gc := &GuestConnection{
 		nextPort:   firstIoChannelVsockPort,
 		notifyChs:  make(map[string]chan struct{}),
+		eventChs:   make(map[string]chan *prot.ContainerEvent),
 		ioListenFn: gcc.IoListen,
 	}
 	gc.brdg = newBridge(gcc.Conn, gc.notify, gcc.Log)
+	gc.brdg.notifyEvent = gc.notifyEvent
 	gc.brdg.Start()
 	go func() {
 		_ = gc.brdg.Wait()
@@ -100,6 +106,9 @@ type GuestConnection struct {
 	notifyChs  map[string]chan struct{}
 	caps       GuestDefinedCapabilities
 	os         string
+
+	// eventChs are the channels of the event subscriptions of containers.
+	eventChs map[string]chan *prot.ContainerEvent
 }
 
 var _ cow.ProcessHost = &GuestConnection{}
@@ -288,6 +297,7 @@ func (gc *GuestConnection) notify(ntf *prot.ContainerNotification) error {
 		return fmt.Errorf("container %s not found", cid)
 	}
 	logrus.WithField(logfields.ContainerID, cid).Info("container terminated in guest")
+	gc.unsubscribeEvents(cid)
 	close(ch)
 	return nil
 }
@@ -296,10 +306,64 @@ func (gc *GuestConnection) clearNotifies() {
 	gc.mu.Lock()
 	chs := gc.notifyChs
 	gc.notifyChs = nil
+	eventChs := gc.eventChs
+	gc.eventChs = nil
 	gc.mu.Unlock()
 	for _, ch := range chs {
 		close(ch)
 	}
+	for _, ch := range eventChs {
+		close(ch)
+	}
+}
+
+// subscribeEvents returns the channel of the events of the container cid,
+// closing that of its previous subscription, if any.
+func (gc *GuestConnection) subscribeEvents(cid string) (<-chan *prot.ContainerEvent, error) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if gc.eventChs == nil {
+		return nil, errors.New("guest connection closed")
+	}
+	if ch, ok := gc.eventChs[cid]; ok {
+		close(ch)
+	}
+	ch := make(chan *prot.ContainerEvent, eventChannelSize)
+	gc.eventChs[cid] = ch
+	return ch, nil
+}
+
+// unsubscribeEvents closes the channel of the events of the container cid, if
+// any.
+func (gc *GuestConnection) unsubscribeEvents(cid string) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if ch, ok := gc.eventChs[cid]; ok {
+		close(ch)
+		delete(gc.eventChs, cid)
+	}
+}
+
+// notifyEvent passes an event to the subscription of its container. Events
+// are dropped, rather than blocking the bridge, if the subscriber falls
+// behind, and may arrive after the subscription was cancelled.
+func (gc *GuestConnection) notifyEvent(e *prot.ContainerEvent) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	entry := logrus.WithFields(logrus.Fields{
+		logfields.ContainerID: e.ContainerID,
+		"type":                e.Type,
+	})
+	ch, ok := gc.eventChs[e.ContainerID]
+	if !ok {
+		entry.Debug("dropping container event without subscription")
+		return
+	}
+	select {
+	case ch <- e:
+	default:
+		entry.Warn("dropping container event, as the subscriber is behind")
+	}
 }
 
 func makeRequest(ctx context.Context, cid string) prot.RequestBase {
@@ -120,6 +120,51 @@ func simpleGcsLoop(t *testing.T, rw io.ReadWriter) error {
 			}
 		case prot.RPCWaitForProcess:
 			// nothing
+		case prot.RPCAttachProcess:
+			var req prot.ContainerAttachProcess
+			err = json.Unmarshal(b, &req)
+			if err != nil {
+				return err
+			}
+			if req.CreateStdOutPipe {
+				stdout, err := dialPort(req.VsockStdioRelaySettings.StdOut)
+				if err != nil {
+					return err
+				}
+				// replay the output of the process
+				go func() {
+					_, err := stdout.Write([]byte("replayed"))
+					if err != nil {
+						t.Error(err)
+					}
+					stdout.Close()
+				}()
+			}
+			err = sendJSON(t, rw, prot.MsgTypeResponse|prot.MsgType(proc), id, &prot.ResponseBase{})
+			if err != nil {
+				return err
+			}
+		case prot.RPCSubscribeContainerEvents:
+			var req prot.ContainerSubscribeEvents
+			err = json.Unmarshal(b, &req)
+			if err != nil {
+				return err
+			}
+			err = sendJSON(t, rw, prot.MsgTypeResponse|prot.MsgType(proc), id, &prot.ResponseBase{})
+			if err != nil {
+				return err
+			}
+			if req.MemoryEvents {
+				err = sendJSON(t, rw, prot.MsgType(prot.MsgTypeNotify|prot.ComputeSystem|prot.NotifyContainerEvent), 0, &prot.ContainerEvent{
+					RequestBase: prot.RequestBase{
+						ContainerID: req.ContainerID,
+					},
+					Type: "OOMKill",
+				})
+				if err != nil {
+					return err
+				}
+			}
 		case prot.RPCShutdownForced:
 			var req prot.RequestBase
 			err = json.Unmarshal(b, &req)
@@ -217,6 +262,40 @@ func TestGcsWaitContainerBridgeTerminated(t *testing.T) {
 	}
 }
 
+func TestGcsSubscribeContainerEvents(t *testing.T) {
+	gc := connectGcs(context.Background(), t)
+	defer gc.Close()
+	c, err := gc.CreateContainer(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ch, err := c.SubscribeEvents(context.Background(), &prot.ContainerSubscribeEvents{MemoryEvents: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-ch:
+		if e.ContainerID != "foo" || e.Type != "OOMKill" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not receive event")
+	}
+	err = c.Terminate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the channel is closed once the container exits
+	if _, ok := <-ch; ok {
+		t.Fatal("expected closed event channel")
+	}
+}
+
 func TestGcsCreateProcess(t *testing.T) {
 	gc := connectGcs(context.Background(), t)
 	defer gc.Close()
@@ -246,6 +325,32 @@ func TestGcsCreateProcess(t *testing.T) {
 	}
 }
 
+func TestGcsAttachProcess(t *testing.T) {
+	gc := connectGcs(context.Background(), t)
+	defer gc.Close()
+	c, err := gc.CreateContainer(context.Background(), "foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	p, err := c.AttachProcess(context.Background(), 42, false, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.Pid() != 42 {
+		t.Errorf("unexpected pid: %d", p.Pid())
+	}
+	_, stdout, _ := p.Stdio()
+	b, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "replayed" {
+		t.Errorf("unexpected: %q", string(b))
+	}
+}
+
 func TestGcsWaitProcessBridgeTerminated(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -108,18 +108,77 @@ func (gc *GuestConnection) exec(ctx context.Context, cid string, params interfac
 	}
 	p.id = resp.ProcessID
 	log.G(ctx).WithField("pid", p.id).Debug("created process pid")
-	// Start a wait message.
+	if err := p.startWait(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// attach attaches new stdio channels to the running process pid of the
+// container cid, and returns the process. The output of the process which the
+// guest could not relay while no channel was attached is replayed to them.
+func (gc *GuestConnection) attach(ctx context.Context, cid string, pid uint32, stdin, stdout, stderr bool) (_ cow.Process, err error) {
+	if gc.os == "windows" {
+		return nil, errors.New("attaching to processes is not supported for Windows guests")
+	}
+	req := prot.ContainerAttachProcess{
+		RequestBase:      makeRequest(ctx, cid),
+		ProcessID:        pid,
+		CreateStdInPipe:  stdin,
+		CreateStdOutPipe: stdout,
+		CreateStdErrPipe: stderr,
+	}
+
+	p := &Process{gc: gc, cid: cid, id: pid}
+	defer func() {
+		if err != nil {
+			p.Close()
+		}
+	}()
+
+	if stdin {
+		p.stdin, req.VsockStdioRelaySettings.StdIn, err = gc.newIoChannel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if stdout {
+		p.stdout, req.VsockStdioRelaySettings.StdOut, err = gc.newIoChannel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if stderr {
+		p.stderr, req.VsockStdioRelaySettings.StdErr, err = gc.newIoChannel()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var resp prot.ResponseBase
+	if err := gc.brdg.RPC(ctx, prot.RPCAttachProcess, &req, &resp, false); err != nil {
+		return nil, err
+	}
+	if err := p.startWait(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// startWait starts a wait message for the process, which completes once it
+// exits.
+func (p *Process) startWait(ctx context.Context) (err error) {
 	waitReq := prot.ContainerWaitForProcess{
-		RequestBase: makeRequest(ctx, cid),
+		RequestBase: makeRequest(ctx, p.cid),
 		ProcessID:   p.id,
 		TimeoutInMs: 0xffffffff,
 	}
-	p.waitCall, err = gc.brdg.AsyncRPC(ctx, prot.RPCWaitForProcess, &waitReq, &p.waitResp)
+	p.waitCall, err = p.gc.brdg.AsyncRPC(ctx, prot.RPCWaitForProcess, &waitReq, &p.waitResp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to wait on process, leaking process: %w", err)
+		return fmt.Errorf("failed to wait on process, leaking process: %w", err)
 	}
 	go p.waitBackground()
-	return p, nil
+	return nil
 }
 
 // Close releases resources associated with the process and closes the
@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/Microsoft/go-winio/pkg/guid"
+	v1 "github.com/containerd/cgroups/v3/cgroup1/stats"
+
 	"github.com/Microsoft/hcsshim/internal/bridgeutils/commonutils"
 	"github.com/Microsoft/hcsshim/internal/hcs/schema1"
 	hcsschema "github.com/Microsoft/hcsshim/internal/hcs/schema2"
@@ -117,6 +120,13 @@ const (
 	RPCDeleteContainerState
 	RPCUpdateContainer
 	RPCLifecycleNotification
+	RPCPauseContainer
+	RPCResumeContainer
+	RPCCheckpointContainer
+	RPCCopyToContainer
+	RPCCopyFromContainer
+	RPCSubscribeContainerEvents
+	RPCAttachProcess
 )
 
 const (
@@ -162,6 +172,20 @@ func (rpc RPCProc) String() string {
 		return "UpdateContainer"
 	case RPCLifecycleNotification:
 		return "LifecycleNotification"
+	case RPCPauseContainer:
+		return "PauseContainer"
+	case RPCResumeContainer:
+		return "ResumeContainer"
+	case RPCCheckpointContainer:
+		return "CheckpointContainer"
+	case RPCCopyToContainer:
+		return "CopyToContainer"
+	case RPCCopyFromContainer:
+		return "CopyFromContainer"
+	case RPCSubscribeContainerEvents:
+		return "SubscribeContainerEvents"
+	case RPCAttachProcess:
+		return "AttachProcess"
 	case RPCModifyServiceSettings:
 		return "ModifyServiceSettings"
 	default:
@@ -177,7 +201,8 @@ const (
 	MsgTypeNotify   MsgType = 0x30000000
 	MsgTypeMask     MsgType = 0xf0000000
 
-	NotifyContainer = 1<<8 | 1
+	NotifyContainer      = 1<<8 | 1
+	NotifyContainerEvent = 2<<8 | 1
 )
 
 func (typ MsgType) String() string {
@@ -192,6 +217,8 @@ func (typ MsgType) String() string {
 		switch typ - (ComputeSystem | MsgTypeNotify) {
 		case NotifyContainer:
 			s += "Container"
+		case NotifyContainerEvent:
+			s += "ContainerEvent"
 		default:
 			s += fmt.Sprintf("%#x", uint32(typ))
 		}
@@ -325,6 +352,15 @@ type ExecuteProcessVsockStdioRelaySettings struct {
 	StdErr uint32 `json:",omitempty"`
 }
 
+type ContainerAttachProcess struct {
+	RequestBase
+	ProcessID               uint32 `json:"ProcessId"`
+	CreateStdInPipe         bool   `json:",omitempty"`
+	CreateStdOutPipe        bool   `json:",omitempty"`
+	CreateStdErrPipe        bool   `json:",omitempty"`
+	VsockStdioRelaySettings ExecuteProcessVsockStdioRelaySettings
+}
+
 type ContainerResizeConsole struct {
 	RequestBase
 	ProcessID uint32 `json:"ProcessId"`
@@ -344,6 +380,72 @@ type ContainerSignalProcess struct {
 	Options   interface{} `json:",omitempty"`
 }
 
+type ContainerCheckpoint struct {
+	RequestBase
+	ImagePath      string
+	LeaveRunning   bool `json:",omitempty"`
+	TCPEstablished bool `json:",omitempty"`
+}
+
+type ContainerCopy struct {
+	RequestBase
+	Path              string
+	Port              uint32
+	PreserveOwnership bool `json:",omitempty"`
+}
+
+type PressureTrigger struct {
+	Resource   string
+	Full       bool `json:",omitempty"`
+	StallInUs  uint64
+	WindowInUs uint64
+}
+
+type ContainerSubscribeEvents struct {
+	RequestBase
+	MemoryEvents        bool              `json:",omitempty"`
+	PressureTriggers    []PressureTrigger `json:",omitempty"`
+	MetricsIntervalInMs uint32            `json:",omitempty"`
+}
+
+type ContainerEvent struct {
+	RequestBase
+	Type      string // OOMKill, MemoryHigh, MemoryMax, Pressure or Metrics
+	Timestamp time.Time
+	Trigger   *PressureTrigger `json:",omitempty"`
+	Metrics   *v1.Metrics      `json:",omitempty"`
+	// Pressure and MemoryEvents are only sent with the metrics of guests on the
+	// unified cgroup hierarchy.
+	Pressure     *PressureStats    `json:",omitempty"`
+	MemoryEvents *MemoryEventStats `json:",omitempty"`
+}
+
+type PressureStats struct {
+	CPU    *Pressure `json:",omitempty"`
+	Memory *Pressure `json:",omitempty"`
+	IO     *Pressure `json:",omitempty"`
+}
+
+type Pressure struct {
+	Some *PressureData `json:",omitempty"`
+	Full *PressureData `json:",omitempty"`
+}
+
+type PressureData struct {
+	Avg10     float64
+	Avg60     float64
+	Avg300    float64
+	TotalInUs uint64
+}
+
+type MemoryEventStats struct {
+	Low     uint64
+	High    uint64
+	Max     uint64
+	OOM     uint64
+	OOMKill uint64
+}
+
 type ContainerPropertiesQuery schema1.PropertyQuery
 
 func (q *ContainerPropertiesQuery) MarshalText() ([]byte, error) {
@@ -0,0 +1,185 @@
+//go:build linux
+// +build linux
+
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Archive writes a tar archive of `src` beneath `root` to `w`. The entry of
+// `src` is named after its base name, and is followed by those of its
+// descendants if it is a directory. A symlink is archived as a link, rather
+// than its target, even if it is `src` itself.
+//
+// The owners of files are recorded by ID only, as their names are those of
+// the container. Sockets are skipped, and the contents of procfs and sysfs
+// mounts are not archived.
+func Archive(ctx context.Context, root *os.File, src string, w io.Writer) error {
+	if !path.IsAbs(src) {
+		return fmt.Errorf("source %q is not an absolute path", src)
+	}
+	src = path.Clean(src)
+
+	a := &archiver{
+		ctx:   ctx,
+		tw:    tar.NewWriter(w),
+		links: make(map[fileID]string),
+	}
+	if src == "/" {
+		if err := a.add(root, ".", "."); err != nil {
+			return err
+		}
+	} else {
+		dir, err := openInRoot(root, path.Dir(src), unix.O_DIRECTORY|unix.O_RDONLY)
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		if err := a.add(dir, path.Base(src), path.Base(src)); err != nil {
+			return err
+		}
+	}
+	return a.tw.Close()
+}
+
+// fileID identifies a file with several hard links.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+type archiver struct {
+	ctx context.Context
+	tw  *tar.Writer
+	// links are the names of the first entries of files with several hard
+	// links, which later entries link to.
+	links map[fileID]string
+}
+
+// add writes the entry `name` of the file `base` in `dir`, followed by those
+// of its descendants.
+func (a *archiver) add(dir *os.File, base, name string) error {
+	if err := a.ctx.Err(); err != nil {
+		return err
+	}
+
+	var st unix.Stat_t
+	if err := unix.Fstatat(int(dir.Fd()), base, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "fstatat", Path: path.Join(dir.Name(), base), Err: err}
+	}
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(st.Mode & 07777),
+		Uid:     int(st.Uid),
+		Gid:     int(st.Gid),
+		ModTime: time.Unix(st.Mtim.Unix()),
+		Format:  tar.FormatPAX,
+	}
+
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		return a.addDir(dir, base, hdr)
+	case unix.S_IFREG:
+		if st.Nlink > 1 {
+			id := fileID{dev: st.Dev, ino: st.Ino}
+			if first, ok := a.links[id]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				return a.tw.WriteHeader(hdr)
+			}
+			a.links[id] = name
+		}
+		f, err := openAt(dir, base, unix.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = st.Size
+		if err := a.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(a.tw, f, st.Size); err != nil {
+			return fmt.Errorf("failed to archive %q: %w", name, err)
+		}
+		return nil
+	case unix.S_IFLNK:
+		target, err := readlinkAt(dir, base)
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+	case unix.S_IFIFO:
+		hdr.Typeflag = tar.TypeFifo
+	case unix.S_IFCHR, unix.S_IFBLK:
+		hdr.Typeflag = tar.TypeChar
+		if st.Mode&unix.S_IFMT == unix.S_IFBLK {
+			hdr.Typeflag = tar.TypeBlock
+		}
+		hdr.Devmajor = int64(unix.Major(st.Rdev))
+		hdr.Devminor = int64(unix.Minor(st.Rdev))
+	default:
+		// sockets cannot be archived
+		return nil
+	}
+	return a.tw.WriteHeader(hdr)
+}
+
+func (a *archiver) addDir(dir *os.File, base string, hdr *tar.Header) error {
+	hdr.Typeflag = tar.TypeDir
+	name := hdr.Name
+	hdr.Name += "/"
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	d, err := openAt(dir, base, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	var fs unix.Statfs_t
+	if err := unix.Fstatfs(int(d.Fd()), &fs); err != nil {
+		return &os.PathError{Op: "fstatfs", Path: d.Name(), Err: err}
+	}
+	if fs.Type == unix.PROC_SUPER_MAGIC || fs.Type == unix.SYSFS_MAGIC {
+		return nil
+	}
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := a.add(d, n, path.Join(name, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readlinkAt(dir *os.File, name string) (string, error) {
+	for size := 256; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(int(dir.Fd()), name, buf)
+		if err != nil {
+			return "", &os.PathError{Op: "readlinkat", Path: path.Join(dir.Name(), name), Err: err}
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
@@ -0,0 +1,261 @@
+//go:build linux
+// +build linux
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func openTestRoot(t *testing.T) (*os.File, string) {
+	t.Helper()
+	dir := t.TempDir()
+	root, err := os.Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open root: %s", err)
+	}
+	t.Cleanup(func() { root.Close() })
+	return root, dir
+}
+
+func writeTestArchive(t *testing.T, entries ...*tar.Header) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, hdr := range entries {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(hdr.Name))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write header: %s", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(hdr.Name)); err != nil {
+				t.Fatalf("failed to write file: %s", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close archive: %s", err)
+	}
+	return buf
+}
+
+func Test_Extract(t *testing.T) {
+	root, dir := openTestRoot(t)
+	uid, gid := os.Getuid(), os.Getgid()
+
+	buf := writeTestArchive(t,
+		&tar.Header{Typeflag: tar.TypeDir, Name: "d/", Mode: 0750},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "d/f", Mode: 0640},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "d/s", Linkname: "f"},
+		&tar.Header{Typeflag: tar.TypeLink, Name: "d/l", Linkname: "d/f"},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "missing/parent", Mode: 0600},
+	)
+	err := Extract(context.Background(), root, "/dest", buf, ExtractOptions{UID: uid, GID: gid})
+	if err != nil {
+		t.Fatalf("failed to extract archive: %s", err)
+	}
+
+	dest := filepath.Join(dir, "dest")
+	b, err := os.ReadFile(filepath.Join(dest, "d", "s"))
+	if err != nil || string(b) != "d/f" {
+		t.Fatalf("expected symlink to file with %q, got %q: %v", "d/f", b, err)
+	}
+	fi, err := os.Stat(filepath.Join(dest, "d", "f"))
+	if err != nil {
+		t.Fatalf("failed to stat file: %s", err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Fatalf("expected mode 0640, got %v", fi.Mode().Perm())
+	}
+	if st := fi.Sys().(*syscall.Stat_t); int(st.Uid) != uid || int(st.Gid) != gid || st.Nlink != 2 {
+		t.Fatalf("expected file owned by %d:%d with 2 links, got %d:%d with %d", uid, gid, st.Uid, st.Gid, st.Nlink)
+	}
+	if fi, err := os.Stat(filepath.Join(dest, "d")); err != nil || fi.Mode().Perm() != 0750 {
+		t.Fatalf("expected directory with mode 0750: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "missing", "parent")); err != nil {
+		t.Fatalf("expected file in created parent: %s", err)
+	}
+}
+
+func Test_Extract_Preserve_Ownership(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of files requires root")
+	}
+	root, dir := openTestRoot(t)
+
+	buf := writeTestArchive(t, &tar.Header{Typeflag: tar.TypeReg, Name: "f", Mode: 0644, Uid: 1234, Gid: 5678})
+	for _, preserve := range []bool{false, true} {
+		err := Extract(context.Background(), root, "/", buf, ExtractOptions{UID: 1000, GID: 1000, PreserveOwnership: preserve})
+		if err != nil {
+			t.Fatalf("failed to extract archive: %s", err)
+		}
+		fi, err := os.Stat(filepath.Join(dir, "f"))
+		if err != nil {
+			t.Fatalf("failed to stat file: %s", err)
+		}
+		st := fi.Sys().(*syscall.Stat_t)
+		want := []uint32{1000, 1000}
+		if preserve {
+			want = []uint32{1234, 5678}
+		}
+		if st.Uid != want[0] || st.Gid != want[1] {
+			t.Fatalf("expected file owned by %d:%d, got %d:%d", want[0], want[1], st.Uid, st.Gid)
+		}
+		buf = writeTestArchive(t, &tar.Header{Typeflag: tar.TypeReg, Name: "f", Mode: 0644, Uid: 1234, Gid: 5678})
+	}
+}
+
+func Test_Extract_Confined(t *testing.T) {
+	root, dir := openTestRoot(t)
+	outside := t.TempDir()
+	// an absolute symlink is resolved beneath the root, as in the container
+	if err := os.MkdirAll(filepath.Join(dir, outside), 0755); err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatalf("failed to create symlink: %s", err)
+	}
+
+	buf := writeTestArchive(t, &tar.Header{Typeflag: tar.TypeReg, Name: "../../dotdot", Mode: 0644})
+	opts := ExtractOptions{UID: os.Getuid(), GID: os.Getgid()}
+	if err := Extract(context.Background(), root, "/escape/dest", buf, opts); err != nil {
+		t.Fatalf("failed to extract archive: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, outside, "dest", "dotdot")); err != nil {
+		t.Fatalf("expected file beneath the destination in the root: %s", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Fatalf("expected nothing outside of the root, got %v", entries)
+	}
+
+	buf = writeTestArchive(t, &tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "../../../etc/passwd"})
+	if err := Extract(context.Background(), root, "/escape/dest", buf, opts); err == nil {
+		t.Fatal("expected hard link to a file outside of the destination to fail")
+	}
+}
+
+func Test_Extract_Layer(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("creating whiteouts requires root")
+	}
+	root, dir := openTestRoot(t)
+
+	buf := writeTestArchive(t,
+		&tar.Header{Typeflag: tar.TypeDir, Name: "opaque/", Mode: 0755},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "opaque/.wh..wh..opq", Mode: 0644},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "d/.wh.hidden", Mode: 0644},
+		&tar.Header{Typeflag: tar.TypeChar, Name: "d/null", Mode: 0666, Devmajor: 1, Devminor: 3},
+	)
+	opts := ExtractOptions{PreserveOwnership: true, Layer: true}
+	if err := Extract(context.Background(), root, "/", buf, opts); err != nil {
+		t.Fatalf("failed to extract layer: %s", err)
+	}
+
+	v := make([]byte, 1)
+	if n, err := unix.Getxattr(filepath.Join(dir, "opaque"), "trusted.overlay.opaque", v); err != nil || string(v[:n]) != "y" {
+		t.Fatalf("expected opaque directory: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "opaque", ".wh..wh..opq")); !os.IsNotExist(err) {
+		t.Fatalf("expected no opaque whiteout file, got %v", err)
+	}
+	for name, dev := range map[string]uint64{"hidden": 0, "null": unix.Mkdev(1, 3)} {
+		fi, err := os.Lstat(filepath.Join(dir, "d", name))
+		if err != nil {
+			t.Fatalf("failed to stat %s: %s", name, err)
+		}
+		if st := fi.Sys().(*syscall.Stat_t); st.Mode&unix.S_IFMT != unix.S_IFCHR || st.Rdev != dev {
+			t.Fatalf("expected %s to be a character device %d, got mode %o device %d", name, dev, st.Mode, st.Rdev)
+		}
+	}
+
+	// device nodes are only extracted from layers
+	buf = writeTestArchive(t, &tar.Header{Typeflag: tar.TypeChar, Name: "null", Mode: 0666, Devmajor: 1, Devminor: 3})
+	if err := Extract(context.Background(), root, "/", buf, ExtractOptions{}); err == nil {
+		t.Fatal("expected device node to fail to extract")
+	}
+}
+
+func Test_Archive_Round_Trip(t *testing.T) {
+	root, dir := openTestRoot(t)
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "f"), []byte("contents"), 0600); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	if err := os.Link(filepath.Join(src, "sub", "f"), filepath.Join(src, "hard")); err != nil {
+		t.Fatalf("failed to create hard link: %s", err)
+	}
+	if err := os.Symlink("/sub/f", filepath.Join(src, "sym")); err != nil {
+		t.Fatalf("failed to create symlink: %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Archive(context.Background(), root, "/src", buf); err != nil {
+		t.Fatalf("failed to archive: %s", err)
+	}
+	names := []string{}
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	expected := []string{"src/", "src/hard", "src/sub/", "src/sub/f", "src/sym"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected entries %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected entries %v, got %v", expected, names)
+		}
+	}
+
+	if err := Extract(context.Background(), root, "/copy", buf, ExtractOptions{UID: os.Getuid(), GID: os.Getgid()}); err != nil {
+		t.Fatalf("failed to extract archive: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "copy", "src", "sub", "f"))
+	if err != nil || string(b) != "contents" {
+		t.Fatalf("expected file with %q, got %q: %v", "contents", b, err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "copy", "src", "hard"))
+	if err != nil || fi.Sys().(*syscall.Stat_t).Nlink != 2 {
+		t.Fatalf("expected hard link to be kept: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "copy", "src", "sym")); err != nil || target != "/sub/f" {
+		t.Fatalf("expected symlink to %q, got %q: %v", "/sub/f", target, err)
+	}
+}
+
+func Test_Archive_Symlink_Source(t *testing.T) {
+	root, dir := openTestRoot(t)
+	if err := os.Symlink("/etc/passwd", filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("failed to create symlink: %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Archive(context.Background(), root, "/link", buf); err != nil {
+		t.Fatalf("failed to archive: %s", err)
+	}
+	hdr, err := tar.NewReader(buf).Next()
+	if err != nil {
+		t.Fatalf("failed to read archive: %s", err)
+	}
+	if hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "/etc/passwd" {
+		t.Fatalf("expected symlink to %q, got %+v", "/etc/passwd", hdr)
+	}
+}
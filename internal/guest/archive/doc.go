@@ -0,0 +1,5 @@
+// Package archive copies files into and out of the root filesystem of a
+// container as tar archives. Paths are resolved beneath the root directory of
+// the mount namespace of the container, as the processes of the container see
+// them, and cannot escape it through symlinks or "..".
+package archive
@@ -0,0 +1,272 @@
+//go:build linux
+// +build linux
+
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+	xattrPrefix    = "SCHILY.xattr."
+)
+
+// ExtractOptions are the options of Extract.
+type ExtractOptions struct {
+	// UID and GID own the extracted files and any directories created for
+	// them, unless PreserveOwnership is set.
+	UID int
+	GID int
+	// PreserveOwnership keeps the owners recorded in the archive for its
+	// entries, rather than UID and GID.
+	PreserveOwnership bool
+	// Layer extracts the archive as an OCI image layer for overlayfs: OCI
+	// whiteouts are converted to those of overlayfs, and device nodes and
+	// extended attributes are extracted.
+	Layer bool
+}
+
+// Extract extracts the tar archive read from `r` into the directory `dest`
+// beneath `root`, which is created if missing. Existing files are replaced by
+// the entries of the archive, but existing directories are kept.
+//
+// The names of entries, and the targets of hard links, are confined to
+// `dest`, but as in the container, symlinks within it may point elsewhere
+// beneath `root`. Device nodes are not extracted, unless `opts.Layer` is set.
+func Extract(ctx context.Context, root *os.File, dest string, r io.Reader, opts ExtractOptions) error {
+	if !path.IsAbs(dest) {
+		return fmt.Errorf("destination %q is not an absolute path", dest)
+	}
+	d, err := mkdirAll(root, path.Clean(dest), opts.UID, opts.GID)
+	if err != nil {
+		return err
+	}
+	d.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if err := extractEntry(root, dest, hdr, tr, opts); err != nil {
+			return fmt.Errorf("failed to extract %q: %w", hdr.Name, err)
+		}
+	}
+}
+
+// confine joins the name of an entry to `dest`, without leaving it.
+func confine(dest, name string) string {
+	return path.Join(dest, path.Clean("/"+name))
+}
+
+func extractEntry(root *os.File, dest string, hdr *tar.Header, r io.Reader, opts ExtractOptions) error {
+	uid, gid := opts.UID, opts.GID
+	if opts.PreserveOwnership {
+		uid, gid = hdr.Uid, hdr.Gid
+	}
+	mode := uint32(hdr.Mode) & 07777
+
+	name := confine(dest, hdr.Name)
+	if name == path.Clean(dest) {
+		// the entry of the destination itself, which already exists
+		return nil
+	}
+	dir, err := mkdirAll(root, path.Dir(name), opts.UID, opts.GID)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	dfd, base := int(dir.Fd()), path.Base(name)
+
+	if opts.Layer && strings.HasPrefix(base, whiteoutPrefix) {
+		return extractWhiteout(dir, base, uid, gid)
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := unix.Mkdirat(dfd, base, mode); err != nil && !errors.Is(err, unix.EEXIST) {
+			return &os.PathError{Op: "mkdirat", Path: name, Err: err}
+		}
+		f, err := openAt(dir, base, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := setOwnerAndMode(f, uid, gid, mode); err != nil {
+			return err
+		}
+		return setXattrs(f, hdr, opts)
+	case tar.TypeReg:
+		if err := unlinkAt(dir, base); err != nil {
+			return err
+		}
+		f, err := openAt(dir, base, unix.O_CREAT|unix.O_EXCL|unix.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, r); err != nil {
+			return err
+		}
+		if err := setOwnerAndMode(f, uid, gid, mode); err != nil {
+			return err
+		}
+		if err := setXattrs(f, hdr, opts); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := unlinkAt(dir, base); err != nil {
+			return err
+		}
+		if err := unix.Symlinkat(hdr.Linkname, dfd, base); err != nil {
+			return &os.PathError{Op: "symlinkat", Path: name, Err: err}
+		}
+		if err := unix.Fchownat(dfd, base, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return &os.PathError{Op: "fchownat", Path: name, Err: err}
+		}
+	case tar.TypeLink:
+		target := confine(dest, hdr.Linkname)
+		tdir, err := openInRoot(root, path.Dir(target), unix.O_DIRECTORY|unix.O_RDONLY)
+		if err != nil {
+			return err
+		}
+		defer tdir.Close()
+		if err := unlinkAt(dir, base); err != nil {
+			return err
+		}
+		// the target itself is not followed if it is a symlink
+		if err := unix.Linkat(int(tdir.Fd()), path.Base(target), dfd, base, 0); err != nil {
+			return &os.PathError{Op: "linkat", Path: name, Err: err}
+		}
+		// a hard link shares the owner and times of its target
+		return nil
+	case tar.TypeFifo:
+		if err := unlinkAt(dir, base); err != nil {
+			return err
+		}
+		if err := unix.Mkfifoat(dfd, base, mode); err != nil {
+			return &os.PathError{Op: "mkfifoat", Path: name, Err: err}
+		}
+		if err := unix.Fchownat(dfd, base, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return &os.PathError{Op: "fchownat", Path: name, Err: err}
+		}
+	case tar.TypeChar, tar.TypeBlock:
+		if !opts.Layer {
+			return fmt.Errorf("unsupported entry type %q", hdr.Typeflag)
+		}
+		if err := unlinkAt(dir, base); err != nil {
+			return err
+		}
+		typ := uint32(unix.S_IFCHR)
+		if hdr.Typeflag == tar.TypeBlock {
+			typ = unix.S_IFBLK
+		}
+		dev := int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor)))
+		if err := unix.Mknodat(dfd, base, typ|mode, dev); err != nil {
+			return &os.PathError{Op: "mknodat", Path: name, Err: err}
+		}
+		if err := unix.Fchownat(dfd, base, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return &os.PathError{Op: "fchownat", Path: name, Err: err}
+		}
+	case tar.TypeXGlobalHeader:
+		return nil
+	default:
+		return fmt.Errorf("unsupported entry type %q", hdr.Typeflag)
+	}
+
+	// The times of directories are not kept, as they change with the entries
+	// extracted into them.
+	ts := []unix.Timespec{
+		unix.NsecToTimespec(hdr.AccessTime.UnixNano()),
+		unix.NsecToTimespec(hdr.ModTime.UnixNano()),
+	}
+	if hdr.AccessTime.IsZero() {
+		ts[0] = ts[1]
+	}
+	if err := unix.UtimesNanoAt(dfd, base, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "utimensat", Path: name, Err: err}
+	}
+	return nil
+}
+
+// setOwnerAndMode sets the owner and then the mode of `f`, as changing the
+// owner clears the setuid and setgid bits.
+func setOwnerAndMode(f *os.File, uid, gid int, mode uint32) error {
+	if err := unix.Fchown(int(f.Fd()), uid, gid); err != nil {
+		return &os.PathError{Op: "fchown", Path: f.Name(), Err: err}
+	}
+	if err := unix.Fchmod(int(f.Fd()), mode); err != nil {
+		return &os.PathError{Op: "fchmod", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+// extractWhiteout converts the OCI whiteout `name` in `dir` to that of
+// overlayfs: an opaque whiteout marks `dir` itself as opaque, and any other
+// whiteout is replaced by a character device 0:0 with the name it hides.
+func extractWhiteout(dir *os.File, name string, uid, gid int) error {
+	if name == opaqueWhiteout {
+		if err := unix.Fsetxattr(int(dir.Fd()), "trusted.overlay.opaque", []byte("y"), 0); err != nil {
+			return &os.PathError{Op: "fsetxattr", Path: dir.Name(), Err: err}
+		}
+		return nil
+	}
+	hidden := strings.TrimPrefix(name, whiteoutPrefix)
+	if hidden == "" || hidden == "." || hidden == ".." {
+		return fmt.Errorf("invalid whiteout %q", name)
+	}
+	if err := unlinkAt(dir, hidden); err != nil {
+		return err
+	}
+	if err := unix.Mknodat(int(dir.Fd()), hidden, unix.S_IFCHR, 0); err != nil {
+		return &os.PathError{Op: "mknodat", Path: path.Join(dir.Name(), hidden), Err: err}
+	}
+	if err := unix.Fchownat(int(dir.Fd()), hidden, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "fchownat", Path: path.Join(dir.Name(), hidden), Err: err}
+	}
+	return nil
+}
+
+// setXattrs sets the extended attributes of the entry `hdr` on `f`, when
+// extracting a layer. They are set once its owner is, which clears file
+// capabilities.
+func setXattrs(f *os.File, hdr *tar.Header, opts ExtractOptions) error {
+	if !opts.Layer {
+		return nil
+	}
+	for k, v := range hdr.PAXRecords {
+		if !strings.HasPrefix(k, xattrPrefix) {
+			continue
+		}
+		if err := unix.Fsetxattr(int(f.Fd()), k[len(xattrPrefix):], []byte(v), 0); err != nil {
+			return &os.PathError{Op: "fsetxattr", Path: f.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// unlinkAt removes `name` from `dir`, if it exists and is not a directory.
+func unlinkAt(dir *os.File, name string) error {
+	if err := unix.Unlinkat(int(dir.Fd()), name, 0); err != nil && !errors.Is(err, unix.ENOENT) {
+		return &os.PathError{Op: "unlinkat", Path: path.Join(dir.Name(), name), Err: err}
+	}
+	return nil
+}
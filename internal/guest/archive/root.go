@@ -0,0 +1,85 @@
+//go:build linux
+// +build linux
+
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxOpenRetries bounds the retries of openat2, which fails with EAGAIN if
+// the tree is renamed under it while a path is resolved beneath a root.
+const maxOpenRetries = 128
+
+// OpenRoot opens the root directory of the mount namespace of the process
+// `pid`. Paths resolved beneath it cross the mounts of that namespace, rather
+// than those of the GCS.
+func OpenRoot(pid int) (*os.File, error) {
+	p := fmt.Sprintf("/proc/%d/root", pid)
+	fd, err := unix.Open(p, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: p, Err: err}
+	}
+	return os.NewFile(uintptr(fd), p), nil
+}
+
+// openInRoot opens `name` beneath `root` as if `root` were the root directory
+// of the process: absolute symlinks and ".." are resolved within it.
+func openInRoot(root *os.File, name string, flags int) (*os.File, error) {
+	how := &unix.OpenHow{
+		Flags:   uint64(flags | unix.O_CLOEXEC),
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	}
+	var err error
+	for i := 0; i < maxOpenRetries; i++ {
+		var fd int
+		fd, err = unix.Openat2(int(root.Fd()), name, how)
+		if err == nil {
+			return os.NewFile(uintptr(fd), path.Join(root.Name(), name)), nil
+		}
+		if !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.EINTR) {
+			break
+		}
+	}
+	return nil, &os.PathError{Op: "openat2", Path: name, Err: err}
+}
+
+// openAt opens the single path component `name` in `dir`, without following
+// a symlink.
+func openAt(dir *os.File, name string, flags int, mode uint32) (*os.File, error) {
+	fd, err := unix.Openat(int(dir.Fd()), name, flags|unix.O_NOFOLLOW|unix.O_CLOEXEC, mode)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: path.Join(dir.Name(), name), Err: err}
+	}
+	return os.NewFile(uintptr(fd), path.Join(dir.Name(), name)), nil
+}
+
+// mkdirAll opens the directory `name` beneath `root`, first creating it and
+// any missing parents, owned by `uid` and `gid`.
+func mkdirAll(root *os.File, name string, uid, gid int) (*os.File, error) {
+	d, err := openInRoot(root, name, unix.O_DIRECTORY|unix.O_RDONLY)
+	if err == nil || !errors.Is(err, unix.ENOENT) || name == "/" {
+		return d, err
+	}
+
+	parent, err := mkdirAll(root, path.Dir(name), uid, gid)
+	if err != nil {
+		return nil, err
+	}
+	defer parent.Close()
+
+	base := path.Base(name)
+	if err := unix.Mkdirat(int(parent.Fd()), base, 0755); err == nil {
+		if err := unix.Fchownat(int(parent.Fd()), base, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return nil, &os.PathError{Op: "fchownat", Path: name, Err: err}
+		}
+	} else if !errors.Is(err, unix.EEXIST) {
+		return nil, &os.PathError{Op: "mkdirat", Path: name, Err: err}
+	}
+	return openAt(parent, base, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+}
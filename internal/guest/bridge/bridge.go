@@ -217,6 +217,13 @@ func (b *Bridge) AssignHandlers(mux *Mux, host *hcsv2.Host) {
 		mux.HandleFunc(prot.ComputeSystemModifySettingsV1, prot.PvV4, b.modifySettingsV2)
 		mux.HandleFunc(prot.ComputeSystemDumpStacksV1, prot.PvV4, b.dumpStacksV2)
 		mux.HandleFunc(prot.ComputeSystemDeleteContainerStateV1, prot.PvV4, b.deleteContainerStateV2)
+		mux.HandleFunc(prot.ComputeSystemPauseV1, prot.PvV4, b.pauseContainerV2)
+		mux.HandleFunc(prot.ComputeSystemResumeV1, prot.PvV4, b.resumeContainerV2)
+		mux.HandleFunc(prot.ComputeSystemCheckpointV1, prot.PvV4, b.checkpointContainerV2)
+		mux.HandleFunc(prot.ComputeSystemCopyToContainerV1, prot.PvV4, b.copyToContainerV2)
+		mux.HandleFunc(prot.ComputeSystemCopyFromContainerV1, prot.PvV4, b.copyFromContainerV2)
+		mux.HandleFunc(prot.ComputeSystemSubscribeEventsV1, prot.PvV4, b.subscribeContainerEventsV2)
+		mux.HandleFunc(prot.ComputeSystemAttachProcessV1, prot.PvV4, b.attachProcessV2)
 	}
 }
 
@@ -225,17 +232,17 @@ func (b *Bridge) AssignHandlers(mux *Mux, host *hcsv2.Host) {
 // event in an asynchronous manner.
 func (b *Bridge) ListenAndServe(bridgeIn io.ReadCloser, bridgeOut io.WriteCloser) error {
 	requestChan := make(chan *Request)
-	requestErrChan := make(chan error)
+	// The error channels are buffered, and left open, so that the loop which
+	// did not fail can still exit once the other one has returned its error.
+	requestErrChan := make(chan error, 1)
 	b.responseChan = make(chan bridgeResponse)
-	responseErrChan := make(chan error)
+	responseErrChan := make(chan error, 1)
 	b.quitChan = make(chan bool)
 
 	defer close(b.quitChan)
 	defer bridgeOut.Close()
-	defer close(responseErrChan)
 	defer close(b.responseChan)
 	defer close(requestChan)
-	defer close(requestErrChan)
 	defer bridgeIn.Close()
 
 	// Receive bridge requests and schedule them to be processed.
@@ -443,6 +450,28 @@ func (b *Bridge) PublishNotification(n *prot.ContainerNotification) {
 	b.responseChan <- resp
 }
 
+// PublishEvent writes an event of a container, which the host subscribed to,
+// to the bridge.
+func (b *Bridge) PublishEvent(e *prot.ContainerEvent) {
+	ctx, span := oc.StartSpan(context.Background(),
+		"opengcs::bridge::PublishEvent",
+		oc.WithClientSpanKind)
+	span.AddAttributes(
+		trace.StringAttribute("cid", e.ContainerID),
+		trace.StringAttribute("type", string(e.Type)))
+	// DONT defer span.End() here, as in PublishNotification.
+
+	resp := bridgeResponse{
+		ctx: ctx,
+		header: &prot.MessageHeader{
+			Type: prot.ComputeSystemEventNotificationV1,
+			ID:   0,
+		},
+		response: e,
+	}
+	b.responseChan <- resp
+}
+
 // setErrorForResponseBase modifies the passed-in MessageResponseBase to
 // contain information pertaining to the given error.
 func setErrorForResponseBase(response *prot.MessageResponseBase, errForResponse error, moduleName string) {
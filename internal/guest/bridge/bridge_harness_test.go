@@ -0,0 +1,306 @@
+//go:build linux
+// +build linux
+
+package bridge
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+
+	"github.com/Microsoft/hcsshim/internal/bridgeutils/gcserr"
+	"github.com/Microsoft/hcsshim/internal/guest/prot"
+)
+
+func Test_Bridge_Harness_Container_Stdio(t *testing.T) {
+	h := newTestHarness(t)
+
+	id := h.createContainer("cat")
+	s := h.stdio(true, true, false)
+	pid := h.startContainer(id, s)
+
+	s.writeIn("hello world", true)
+	if out := s.readOut(); out != "hello world" {
+		t.Fatalf("expected stdout %q, got %q", "hello world", out)
+	}
+	code, err := h.wait(id, pid, harnessTimeout)
+	if err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if n := h.waitNotification(id); n.Type != prot.NtUnexpectedExit {
+		t.Fatalf("expected %s notification, got %s", prot.NtUnexpectedExit, n.Type)
+	}
+	h.deleteContainer(id)
+}
+
+func Test_Bridge_Harness_Exec(t *testing.T) {
+	h := newTestHarness(t)
+
+	id := h.createContainer("sleep", "1000")
+	initPid := h.startContainer(id, nil)
+
+	s := h.stdio(false, true, true)
+	pid, err := h.exec(id, &oci.Process{
+		Args: []string{"sh", "-c", "echo out; echo err >&2; exit 3"},
+		Cwd:  "/",
+	}, s)
+	if err != nil {
+		t.Fatalf("failed to exec process: %v", err)
+	}
+	if pid == initPid {
+		t.Fatalf("expected exec pid to differ from init pid %d", initPid)
+	}
+	if out := s.readOut(); out != "out\n" {
+		t.Fatalf("expected stdout %q, got %q", "out\n", out)
+	}
+	if e := s.readErr(); e != "err\n" {
+		t.Fatalf("expected stderr %q, got %q", "err\n", e)
+	}
+	code, err := h.wait(id, pid, harnessTimeout)
+	if err != nil {
+		t.Fatalf("failed to wait for process: %v", err)
+	}
+	if code != 3 {
+		t.Fatalf("expected exit code 3, got %d", code)
+	}
+
+	if err := h.shutdown(id, false); err != nil {
+		t.Fatalf("failed to kill container: %v", err)
+	}
+	code, err = h.wait(id, initPid, harnessTimeout)
+	if err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	if code != 128+uint32(unix.SIGKILL) {
+		t.Fatalf("expected exit code %d, got %d", 128+unix.SIGKILL, code)
+	}
+	// the container is only reported to have exited once its exit code is
+	// acknowledged by a wait
+	if n := h.waitNotification(id); n.Type != prot.NtForcedExit {
+		t.Fatalf("expected %s notification, got %s", prot.NtForcedExit, n.Type)
+	}
+	h.deleteContainer(id)
+}
+
+func Test_Bridge_Harness_Signal_Process(t *testing.T) {
+	h := newTestHarness(t)
+
+	id := h.createContainer("sleep", "1000")
+	initPid := h.startContainer(id, nil)
+
+	pid, err := h.exec(id, &oci.Process{Args: []string{"sleep", "1000"}, Cwd: "/"}, nil)
+	if err != nil {
+		t.Fatalf("failed to exec process: %v", err)
+	}
+	if err := h.signal(id, pid, int32(unix.SIGTERM)); err != nil {
+		t.Fatalf("failed to signal process: %v", err)
+	}
+	code, err := h.wait(id, pid, harnessTimeout)
+	if err != nil {
+		t.Fatalf("failed to wait for process: %v", err)
+	}
+	if code != 128+uint32(unix.SIGTERM) {
+		t.Fatalf("expected exit code %d, got %d", 128+unix.SIGTERM, code)
+	}
+
+	if err := h.shutdown(id, true); err != nil {
+		t.Fatalf("failed to shut down container: %v", err)
+	}
+	if _, err := h.wait(id, initPid, harnessTimeout); err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	if n := h.waitNotification(id); n.Type != prot.NtGracefulExit {
+		t.Fatalf("expected %s notification, got %s", prot.NtGracefulExit, n.Type)
+	}
+	h.deleteContainer(id)
+}
+
+func Test_Bridge_Harness_Wait_Timeout(t *testing.T) {
+	h := newTestHarness(t)
+
+	id := h.createContainer("sleep", "1000")
+	pid := h.startContainer(id, nil)
+
+	_, err := h.wait(id, pid, 10*time.Millisecond)
+	var rerr *responseError
+	if !errors.As(err, &rerr) || gcserr.Hresult(rerr.result) != gcserr.HvVmcomputeTimeout {
+		t.Fatalf("expected wait to time out, got: %v", err)
+	}
+
+	if err := h.signal(id, pid, int32(unix.SIGKILL)); err != nil {
+		t.Fatalf("failed to signal container: %v", err)
+	}
+	code, err := h.wait(id, pid, harnessTimeout)
+	if err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	if code != 128+uint32(unix.SIGKILL) {
+		t.Fatalf("expected exit code %d, got %d", 128+unix.SIGKILL, code)
+	}
+	if n := h.waitNotification(id); n.Type != prot.NtForcedExit {
+		t.Fatalf("expected %s notification, got %s", prot.NtForcedExit, n.Type)
+	}
+	h.deleteContainer(id)
+}
+
+func Test_Bridge_Harness_Attach_Process(t *testing.T) {
+	h := newTestHarness(t)
+
+	id := h.createContainer("sh", "-c", "echo one; read x; echo two")
+	s := h.stdio(true, true, false)
+	pid := h.startContainer(id, s)
+
+	conn := s.out.get(t)
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(conn, b); err != nil || string(b) != "one\n" {
+		t.Fatalf("expected stdout %q, got %q: %v", "one\n", b, err)
+	}
+	// the host loses stdout, so the output is kept until it attaches again
+	conn.Close()
+	s.writeIn("go\n", true)
+
+	var rerr *responseError
+	if err := h.attach(id, pid+1000, h.stdio(false, true, false)); !errors.As(err, &rerr) {
+		t.Fatalf("expected attach to missing process to fail, got: %v", err)
+	}
+	if err := h.attach(id, pid, h.stdio(false, false, true)); !errors.As(err, &rerr) {
+		t.Fatalf("expected attach to missing stderr to fail, got: %v", err)
+	}
+	reattached := h.stdio(false, true, false)
+	if err := h.attach(id, pid, reattached); err != nil {
+		t.Fatalf("failed to attach to container: %v", err)
+	}
+	if out := reattached.readOut(); out != "two\n" {
+		t.Fatalf("expected stdout %q after attach, got %q", "two\n", out)
+	}
+
+	code, err := h.wait(id, pid, harnessTimeout)
+	if err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	h.waitNotification(id)
+	h.deleteContainer(id)
+}
+
+func Test_Bridge_Harness_Exec_Missing_Container(t *testing.T) {
+	h := newTestHarness(t)
+
+	_, err := h.exec("missing", &oci.Process{Args: []string{"true"}, Cwd: "/"}, nil)
+	var rerr *responseError
+	if !errors.As(err, &rerr) || gcserr.Hresult(rerr.result) != gcserr.HrVmcomputeSystemNotFound {
+		t.Fatalf("expected exec in missing container to fail, got: %v", err)
+	}
+}
+
+func Test_Bridge_Harness_Copy(t *testing.T) {
+	h := newTestHarness(t)
+
+	id := h.createContainer("sleep", "1000")
+	pid := h.startContainer(id, nil)
+
+	// the fake runtime runs containers in the mount namespace of the test
+	dest := filepath.Join(t.TempDir(), "dest")
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "dir/f", Mode: 0644, Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.copyTo(id, dest, buf.Bytes(), false); err != nil {
+		t.Fatalf("failed to copy into container: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dest, "dir", "f")); err != nil || string(b) != "hello" {
+		t.Fatalf("expected copied file with %q, got %q: %v", "hello", b, err)
+	}
+
+	b, err := h.copyFrom(id, filepath.Join(dest, "dir"))
+	if err != nil {
+		t.Fatalf("failed to copy out of container: %v", err)
+	}
+	tr := tar.NewReader(bytes.NewReader(b))
+	for _, name := range []string{"dir/", "dir/f"} {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("failed to read archive: %v", err)
+		}
+		if hdr.Name != name {
+			t.Fatalf("expected entry %q, got %q", name, hdr.Name)
+		}
+	}
+	if contents, err := io.ReadAll(tr); err != nil || string(contents) != "hello" {
+		t.Fatalf("expected archived file with %q, got %q: %v", "hello", contents, err)
+	}
+
+	_, err = h.copyFrom(id, "relative/path")
+	var rerr *responseError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected copy of relative path to fail, got: %v", err)
+	}
+
+	if err := h.signal(id, pid, int32(unix.SIGKILL)); err != nil {
+		t.Fatalf("failed to signal container: %v", err)
+	}
+	if _, err := h.wait(id, pid, harnessTimeout); err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	h.waitNotification(id)
+	h.deleteContainer(id)
+}
+
+func Test_Bridge_Harness_Subscribe_Events(t *testing.T) {
+	h := newTestHarness(t)
+
+	var rerr *responseError
+	err := h.request(prot.ComputeSystemSubscribeEventsV1, &prot.ContainerSubscribeEvents{
+		MessageBase:  prot.MessageBase{ContainerID: "missing"},
+		MemoryEvents: true,
+	}, &prot.MessageResponseBase{})
+	if !errors.As(err, &rerr) || gcserr.Hresult(rerr.result) != gcserr.HrVmcomputeSystemNotFound {
+		t.Fatalf("expected subscription to missing container to fail, got: %v", err)
+	}
+
+	id := h.createContainer("sleep", "1000")
+	pid := h.startContainer(id, nil)
+
+	err = h.request(prot.ComputeSystemSubscribeEventsV1, &prot.ContainerSubscribeEvents{
+		MessageBase:         prot.MessageBase{ContainerID: id},
+		MetricsIntervalInMs: 10,
+	}, &prot.MessageResponseBase{})
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected subscription with too short metrics interval to fail, got: %v", err)
+	}
+	// a subscription without events cancels the previous one
+	if err := h.request(prot.ComputeSystemSubscribeEventsV1, &prot.ContainerSubscribeEvents{
+		MessageBase: prot.MessageBase{ContainerID: id},
+	}, &prot.MessageResponseBase{}); err != nil {
+		t.Fatalf("failed to cancel subscription: %v", err)
+	}
+
+	if err := h.signal(id, pid, int32(unix.SIGKILL)); err != nil {
+		t.Fatalf("failed to signal container: %v", err)
+	}
+	if _, err := h.wait(id, pid, harnessTimeout); err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	h.waitNotification(id)
+	h.deleteContainer(id)
+}
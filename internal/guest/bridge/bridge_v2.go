@@ -40,6 +40,11 @@ var capabilities = prot.GcsCapabilities{
 		SignalProcessSupported:        true,
 		DumpStacksSupported:           true,
 		DeleteContainerStateSupported: true,
+		PauseResumeSupported:          true,
+		CheckpointRestoreSupported:    true,
+		CopyFilesSupported:            true,
+		EventNotificationsSupported:   true,
+		AttachProcessSupported:        true,
 	},
 }
 
@@ -262,6 +267,163 @@ func (b *Bridge) signalContainerShutdownV2(ctx context.Context, span *trace.Span
 	return &prot.MessageResponseBase{}, nil
 }
 
+func (b *Bridge) pauseContainerV2(r *Request) (_ RequestResponse, err error) {
+	ctx, span := oc.StartSpan(r.Context, "opengcs::bridge::pauseContainerV2")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", r.ContainerID))
+
+	var request prot.MessageBase
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", r.Message)
+	}
+
+	if err := b.hostState.PauseContainer(ctx, request.ContainerID); err != nil {
+		return nil, err
+	}
+
+	return &prot.MessageResponseBase{}, nil
+}
+
+func (b *Bridge) resumeContainerV2(r *Request) (_ RequestResponse, err error) {
+	ctx, span := oc.StartSpan(r.Context, "opengcs::bridge::resumeContainerV2")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", r.ContainerID))
+
+	var request prot.MessageBase
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", r.Message)
+	}
+
+	if err := b.hostState.ResumeContainer(ctx, request.ContainerID); err != nil {
+		return nil, err
+	}
+
+	return &prot.MessageResponseBase{}, nil
+}
+
+func (b *Bridge) checkpointContainerV2(r *Request) (_ RequestResponse, err error) {
+	ctx, span := oc.StartSpan(r.Context, "opengcs::bridge::checkpointContainerV2")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", r.ContainerID))
+
+	var request prot.ContainerCheckpoint
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", r.Message)
+	}
+	span.AddAttributes(
+		trace.StringAttribute("imagePath", request.ImagePath),
+		trace.BoolAttribute("leaveRunning", request.LeaveRunning))
+
+	if err := b.hostState.CheckpointContainer(ctx, request.ContainerID, &request); err != nil {
+		return nil, err
+	}
+
+	return &prot.MessageResponseBase{}, nil
+}
+
+func (b *Bridge) copyToContainerV2(r *Request) (_ RequestResponse, err error) {
+	ctx, span := oc.StartSpan(r.Context, "opengcs::bridge::copyToContainerV2")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", r.ContainerID))
+
+	var request prot.ContainerCopy
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", r.Message)
+	}
+	span.AddAttributes(
+		trace.StringAttribute("path", request.Path),
+		trace.Int64Attribute("port", int64(request.Port)),
+		trace.BoolAttribute("preserveOwnership", request.PreserveOwnership))
+
+	if err := b.hostState.CopyToContainer(ctx, request.ContainerID, &request); err != nil {
+		return nil, err
+	}
+
+	return &prot.MessageResponseBase{}, nil
+}
+
+func (b *Bridge) copyFromContainerV2(r *Request) (_ RequestResponse, err error) {
+	ctx, span := oc.StartSpan(r.Context, "opengcs::bridge::copyFromContainerV2")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", r.ContainerID))
+
+	var request prot.ContainerCopy
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", r.Message)
+	}
+	span.AddAttributes(
+		trace.StringAttribute("path", request.Path),
+		trace.Int64Attribute("port", int64(request.Port)))
+
+	if err := b.hostState.CopyFromContainer(ctx, request.ContainerID, &request); err != nil {
+		return nil, err
+	}
+
+	return &prot.MessageResponseBase{}, nil
+}
+
+func (b *Bridge) subscribeContainerEventsV2(r *Request) (_ RequestResponse, err error) {
+	ctx, span := oc.StartSpan(r.Context, "opengcs::bridge::subscribeContainerEventsV2")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", r.ContainerID))
+
+	var request prot.ContainerSubscribeEvents
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", r.Message)
+	}
+	span.AddAttributes(
+		trace.BoolAttribute("memoryEvents", request.MemoryEvents),
+		trace.Int64Attribute("pressureTriggers", int64(len(request.PressureTriggers))),
+		trace.Int64Attribute("metricsIntervalInMs", int64(request.MetricsIntervalInMs)))
+
+	if err := b.hostState.SubscribeContainerEvents(ctx, request.ContainerID, &request, b.PublishEvent); err != nil {
+		return nil, err
+	}
+
+	return &prot.MessageResponseBase{}, nil
+}
+
+// attachProcessV2 attaches new stdio connections to a running process of a
+// container, which is how a host which reconnected after losing them recovers
+// the stdio of the process.
+//
+// This is allowed only for protocol version 4+, schema version 2.1+
+func (b *Bridge) attachProcessV2(r *Request) (_ RequestResponse, err error) {
+	ctx, span := oc.StartSpan(r.Context, "opengcs::bridge::attachProcessV2")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+	span.AddAttributes(trace.StringAttribute("cid", r.ContainerID))
+
+	var request prot.ContainerAttachProcess
+	if err := commonutils.UnmarshalJSONWithHresult(r.Message, &request); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal JSON in message \"%s\"", r.Message)
+	}
+	span.AddAttributes(trace.Int64Attribute("pid", int64(request.ProcessID)))
+
+	var conSettings stdio.ConnectionSettings
+	if request.CreateStdInPipe {
+		conSettings.StdIn = &request.VsockStdioRelaySettings.StdIn
+	}
+	if request.CreateStdOutPipe {
+		conSettings.StdOut = &request.VsockStdioRelaySettings.StdOut
+	}
+	if request.CreateStdErrPipe {
+		conSettings.StdErr = &request.VsockStdioRelaySettings.StdErr
+	}
+
+	if err := b.hostState.AttachProcess(ctx, request.ContainerID, request.ProcessID, conSettings); err != nil {
+		return nil, err
+	}
+
+	return &prot.MessageResponseBase{}, nil
+}
+
 func (b *Bridge) signalProcessV2(r *Request) (_ RequestResponse, err error) {
 	ctx, span := oc.StartSpan(r.Context, "opengcs::bridge::signalProcessV2")
 	defer span.End()
@@ -310,10 +472,6 @@ func (b *Bridge) getPropertiesV2(r *Request) (_ RequestResponse, err error) {
 		}
 	}
 
-	if request.ContainerID == hcsv2.UVMContainerID {
-		return nil, errors.New("getPropertiesV2 is not supported against the UVM")
-	}
-
 	properties, err := b.hostState.GetProperties(ctx, request.ContainerID, query)
 	if err != nil {
 		return nil, err
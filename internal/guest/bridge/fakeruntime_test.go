@@ -0,0 +1,400 @@
+//go:build linux
+// +build linux
+
+package bridge
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+
+	"github.com/Microsoft/hcsshim/internal/guest/runtime"
+	"github.com/Microsoft/hcsshim/internal/guest/stdio"
+)
+
+// fakeRuntime is a runtime.Runtime which runs the processes of containers on
+// the host, without any isolation, so that the bridge can be driven outside of
+// a UVM. As with `runc create`, the init process of a container is created by
+// CreateContainer, and then held until the container is started.
+type fakeRuntime struct {
+	mu         sync.Mutex
+	containers map[string]*fakeContainer
+}
+
+var _ runtime.Runtime = &fakeRuntime{}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{containers: make(map[string]*fakeContainer)}
+}
+
+func (r *fakeRuntime) CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (_ runtime.Container, err error) {
+	b, err := os.ReadFile(filepath.Join(bundlePath, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	var spec oci.Spec
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal config.json")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.containers[id]; ok {
+		return nil, runtime.ErrContainerAlreadyExists
+	}
+
+	// The init process waits to read from the gate before running the command
+	// of the container, in place of the exec fifo of runc.
+	gateR, gateW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer gateR.Close()
+
+	c := &fakeContainer{
+		r:          r,
+		id:         id,
+		bundlePath: bundlePath,
+		rootfsPath: spec.Root.Path,
+		gate:       gateW,
+		started:    make(chan struct{}),
+	}
+	c.init, err = c.startProcess(spec.Process, stdioSet, gateR)
+	if err != nil {
+		gateW.Close()
+		return nil, err
+	}
+	r.containers[id] = c
+	return c, nil
+}
+
+func (*fakeRuntime) RestoreContainer(string, string, *runtime.CheckpointOptions, *stdio.ConnectionSet) (runtime.Container, error) {
+	return nil, errors.New("fake runtime does not support checkpoints")
+}
+
+func (r *fakeRuntime) ListContainerStates() ([]runtime.ContainerState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := []runtime.ContainerState{}
+	for _, c := range r.containers {
+		s, err := c.GetState()
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, *s)
+	}
+	return states, nil
+}
+
+type fakeContainer struct {
+	r          *fakeRuntime
+	id         string
+	bundlePath string
+	rootfsPath string
+	init       *fakeProcess
+
+	mu   sync.Mutex
+	gate *os.File
+	// started is closed once the init process is let go, after the stdio of
+	// the container is connected.
+	started   chan struct{}
+	paused    bool
+	processes []*fakeProcess
+}
+
+var _ runtime.Container = &fakeContainer{}
+
+// startProcess starts `process` with its stdio relayed to `stdioSet`, or to
+// pipes connected by the caller if `stdioSet` is nil. If `gate` is set, the
+// process waits to read from it before running the command.
+func (c *fakeContainer) startProcess(process *oci.Process, stdioSet *stdio.ConnectionSet, gate *os.File) (*fakeProcess, error) {
+	if process.Terminal {
+		return nil, errors.New("fake runtime does not support terminals")
+	}
+	if len(process.Args) == 0 {
+		return nil, errors.New("process has no arguments")
+	}
+
+	var cmd *exec.Cmd
+	if gate != nil {
+		cmd = exec.Command("/bin/sh", append([]string{"-c", `read _ <&3 && exec "$0" "$@"`}, process.Args...)...)
+		cmd.ExtraFiles = []*os.File{gate}
+	} else {
+		cmd = exec.Command(process.Args[0], process.Args[1:]...)
+	}
+	cmd.Env = process.Env
+
+	relay, err := stdio.NewPipeRelay(stdioSet)
+	if err != nil {
+		return nil, err
+	}
+	fileSet, err := relay.Files()
+	if err != nil {
+		return nil, err
+	}
+	// The child has its own copies of the pipes once started.
+	defer fileSet.Close()
+	if fileSet.In != nil {
+		cmd.Stdin = fileSet.In
+	}
+	if fileSet.Out != nil {
+		cmd.Stdout = fileSet.Out
+	}
+	if fileSet.Err != nil {
+		cmd.Stderr = fileSet.Err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "failed to start process in container %s", c.id)
+	}
+	if stdioSet != nil {
+		relay.Start()
+	}
+
+	p := &fakeProcess{
+		c:     c,
+		init:  gate != nil,
+		cmd:   cmd,
+		args:  process.Args,
+		relay: relay,
+		done:  make(chan struct{}),
+	}
+	go p.wait()
+	return p, nil
+}
+
+func (c *fakeContainer) ID() string {
+	return c.id
+}
+
+func (c *fakeContainer) Exists() (bool, error) {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	_, ok := c.r.containers[c.id]
+	return ok, nil
+}
+
+func (c *fakeContainer) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gate == nil {
+		return errors.Errorf("container %s is already started", c.id)
+	}
+	_, err := c.gate.Write([]byte("\n"))
+	c.gate.Close()
+	c.gate = nil
+	close(c.started)
+	return err
+}
+
+func (c *fakeContainer) ExecProcess(process *oci.Process, stdioSet *stdio.ConnectionSet) (runtime.Process, error) {
+	if c.init.exited() {
+		return nil, runtime.ErrContainerNotRunning
+	}
+	p, err := c.startProcess(process, stdioSet, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.processes = append(c.processes, p)
+	c.mu.Unlock()
+	return p, nil
+}
+
+func (c *fakeContainer) Kill(signal syscall.Signal) error {
+	if err := c.init.cmd.Process.Signal(signal); err != nil {
+		return runtime.ErrContainerNotRunning
+	}
+	return nil
+}
+
+// signalAll sends `signal` to each process of the container which is still
+// running.
+func (c *fakeContainer) signalAll(signal syscall.Signal) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range append([]*fakeProcess{c.init}, c.processes...) {
+		if !p.exited() {
+			_ = p.cmd.Process.Signal(signal)
+		}
+	}
+}
+
+func (c *fakeContainer) Pause() error {
+	c.signalAll(syscall.SIGSTOP)
+	c.mu.Lock()
+	c.paused = true
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeContainer) Resume() error {
+	c.signalAll(syscall.SIGCONT)
+	c.mu.Lock()
+	c.paused = false
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeContainer) GetState() (*runtime.ContainerState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := "running"
+	switch {
+	case c.init.exited():
+		status = "stopped"
+	case c.gate != nil:
+		status = "created"
+	case c.paused:
+		status = "paused"
+	}
+	return &runtime.ContainerState{
+		ID:         c.id,
+		Pid:        c.init.Pid(),
+		BundlePath: c.bundlePath,
+		RootfsPath: c.rootfsPath,
+		Status:     status,
+	}, nil
+}
+
+func (c *fakeContainer) GetRunningProcesses() ([]runtime.ContainerProcessState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	states := []runtime.ContainerProcessState{}
+	for _, p := range append([]*fakeProcess{c.init}, c.processes...) {
+		if !p.exited() {
+			states = append(states, runtime.ContainerProcessState{
+				Pid:              p.Pid(),
+				Command:          p.args,
+				CreatedByRuntime: true,
+			})
+		}
+	}
+	return states, nil
+}
+
+func (c *fakeContainer) GetAllProcesses() ([]runtime.ContainerProcessState, error) {
+	return c.GetRunningProcesses()
+}
+
+func (c *fakeContainer) GetInitProcess() (runtime.Process, error) {
+	return c.init, nil
+}
+
+func (*fakeContainer) Update(interface{}) error {
+	return nil
+}
+
+func (*fakeContainer) Checkpoint(*runtime.CheckpointOptions) error {
+	return errors.New("fake runtime does not support checkpoints")
+}
+
+func (c *fakeContainer) Wait() (int, error) {
+	return c.init.Wait()
+}
+
+func (c *fakeContainer) Pid() int {
+	return c.init.Pid()
+}
+
+func (c *fakeContainer) Delete() error {
+	c.mu.Lock()
+	if c.gate != nil {
+		// the init process exits without running the command
+		c.gate.Close()
+		c.gate = nil
+		close(c.started)
+	}
+	c.mu.Unlock()
+
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	delete(c.r.containers, c.id)
+	return nil
+}
+
+func (*fakeContainer) Tty() *stdio.TtyRelay {
+	return nil
+}
+
+func (c *fakeContainer) PipeRelay() *stdio.PipeRelay {
+	return c.init.relay
+}
+
+type fakeProcess struct {
+	c     *fakeContainer
+	init  bool
+	cmd   *exec.Cmd
+	args  []string
+	relay *stdio.PipeRelay
+
+	// done is closed once the process has exited, with exitCode set.
+	done     chan struct{}
+	exitCode int
+
+	relayOnce sync.Once
+}
+
+var _ runtime.Process = &fakeProcess{}
+
+func (p *fakeProcess) wait() {
+	p.exitCode = -1
+	if err := p.cmd.Wait(); err == nil {
+		p.exitCode = 0
+	} else if ws, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+		// report signals as a shell would, as runc does
+		if ws.Signaled() {
+			p.exitCode = 128 + int(ws.Signal())
+		} else {
+			p.exitCode = ws.ExitStatus()
+		}
+	}
+	close(p.done)
+
+	// The other processes of a container are killed with its init process,
+	// as the kernel does for the init process of a pid namespace.
+	if p.init {
+		<-p.c.started
+		p.c.signalAll(syscall.SIGKILL)
+	}
+}
+
+func (p *fakeProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits for the process to exit, and then for its stdio to be relayed.
+func (p *fakeProcess) Wait() (int, error) {
+	<-p.done
+	if p.init {
+		<-p.c.started
+	}
+	p.relayOnce.Do(p.relay.Wait)
+	return p.exitCode, nil
+}
+
+func (p *fakeProcess) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+func (*fakeProcess) Delete() error {
+	return nil
+}
+
+func (*fakeProcess) Tty() *stdio.TtyRelay {
+	return nil
+}
+
+func (p *fakeProcess) PipeRelay() *stdio.PipeRelay {
+	return p.relay
+}
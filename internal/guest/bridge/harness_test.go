@@ -0,0 +1,528 @@
+//go:build linux
+// +build linux
+
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/go-winio/pkg/guid"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Microsoft/hcsshim/internal/guest/prot"
+	"github.com/Microsoft/hcsshim/internal/guest/runtime/hcsv2"
+	"github.com/Microsoft/hcsshim/internal/guest/transport"
+	"github.com/Microsoft/hcsshim/internal/guestpath"
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+const (
+	// harnessCommandPort is the port of the bridge, as dialed by the GCS.
+	harnessCommandPort uint32 = 0x40000000
+	// harnessTimeout bounds each wait of the harness, so that a hung GCS fails
+	// the test rather than the whole test binary.
+	harnessTimeout = 10 * time.Second
+)
+
+// testHarness runs the bridge and host of the GCS with a fakeRuntime, and
+// plays the part of the host side of the bridge over a UnixTransport. It
+// drives the GCS with the same protocol messages as the HCS.
+type testHarness struct {
+	t     *testing.T
+	tport *transport.UnixTransport
+	conn  *net.UnixConn
+
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	nextID   prot.SequenceID
+	nextPort uint32
+	pending  map[prot.SequenceID]chan []byte
+
+	notifications chan *prot.ContainerNotification
+}
+
+// responseError is the error of a request which the GCS failed.
+type responseError struct {
+	result  int32
+	message string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%s (hresult %#x)", e.message, uint32(e.result))
+}
+
+func newTestHarness(t *testing.T) *testHarness {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		// the host writes the files of containers under /run/gcs
+		t.Skip("the bridge harness must be run as root")
+	}
+	// Turn off logging so as not to spam output.
+	logrus.SetOutput(io.Discard)
+
+	tport := &transport.UnixTransport{Dir: t.TempDir()}
+	l, err := tport.Listen(harnessCommandPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	mux := NewBridgeMux()
+	b := &Bridge{
+		Handler:  mux,
+		EnableV4: true,
+	}
+	host := hcsv2.NewHost(newFakeRuntime(), tport, &securitypolicy.OpenDoorSecurityPolicyEnforcer{}, io.Discard)
+	b.AssignHandlers(mux, host)
+
+	bridgeErr := make(chan error, 1)
+	go func() {
+		bridgeCon, err := tport.Dial(harnessCommandPort)
+		if err != nil {
+			bridgeErr <- err
+			return
+		}
+		bridgeErr <- b.ListenAndServe(bridgeCon, bridgeCon)
+	}()
+
+	if err := l.SetDeadline(time.Now().Add(harnessTimeout)); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := l.AcceptUnix()
+	if err != nil {
+		t.Fatalf("failed to accept the bridge connection: %v", err)
+	}
+
+	h := &testHarness{
+		t:             t,
+		tport:         tport,
+		conn:          conn,
+		nextPort:      harnessCommandPort,
+		pending:       make(map[prot.SequenceID]chan []byte),
+		notifications: make(chan *prot.ContainerNotification, 16),
+	}
+	go h.readResponses()
+	t.Cleanup(func() {
+		conn.Close()
+		select {
+		case <-bridgeErr:
+		case <-time.After(harnessTimeout):
+			t.Error("timed out waiting for the bridge to stop")
+		}
+	})
+
+	if err := h.request(prot.ComputeSystemNegotiateProtocolV1, &prot.NegotiateProtocol{
+		MinimumVersion: uint32(prot.PvV4),
+		MaximumVersion: uint32(prot.PvMax),
+	}, &prot.NegotiateProtocolResponse{}); err != nil {
+		t.Fatalf("failed to negotiate the protocol: %v", err)
+	}
+	return h
+}
+
+// readResponses reads the messages written by the GCS, until the bridge is
+// closed, and hands them to the pending request or the notifications.
+func (h *testHarness) readResponses() {
+	for {
+		header, body, err := serverRead(h.conn)
+		if err != nil {
+			return
+		}
+		if header.Type == prot.ComputeSystemNotificationV1 {
+			n := &prot.ContainerNotification{}
+			if err := json.Unmarshal(body, n); err != nil {
+				h.t.Errorf("failed to unmarshal notification %q: %v", body, err)
+				continue
+			}
+			h.notifications <- n
+			continue
+		}
+		h.mu.Lock()
+		ch, ok := h.pending[header.ID]
+		delete(h.pending, header.ID)
+		h.mu.Unlock()
+		if !ok {
+			h.t.Errorf("unexpected response %v for request %d", header.Type, header.ID)
+			continue
+		}
+		ch <- body
+	}
+}
+
+// request sends the request `req` of type `typ`, and unmarshals the response
+// into `resp`. Requests which the GCS failed return a *responseError.
+func (h *testHarness) request(typ prot.MessageIdentifier, req interface{}, resp RequestResponse) error {
+	ch := make(chan []byte, 1)
+	h.mu.Lock()
+	h.nextID++
+	id := h.nextID
+	h.pending[id] = ch
+	h.mu.Unlock()
+
+	h.writeMu.Lock()
+	err := serverSend(h.conn, typ, id, req)
+	h.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case body := <-ch:
+		if err := json.Unmarshal(body, resp); err != nil {
+			return errors.Wrapf(err, "failed to unmarshal response %q", body)
+		}
+	case <-time.After(harnessTimeout):
+		return errors.Errorf("timed out waiting for the response to %v", typ)
+	}
+	if base := resp.Base(); base.Result != 0 {
+		return &responseError{result: base.Result, message: base.ErrorMessage}
+	}
+	return nil
+}
+
+// createContainer creates a standalone container whose init process runs
+// `args` once started.
+func (h *testHarness) createContainer(args ...string) string {
+	h.t.Helper()
+	g, err := guid.NewV4()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	id := g.String()
+	scratchDir := filepath.Join(guestpath.LCOWRootPrefixInUVM, id)
+	h.t.Cleanup(func() { _ = os.RemoveAll(scratchDir) })
+
+	bundlePath := filepath.Join(h.t.TempDir(), id)
+	settings, err := json.Marshal(&prot.VMHostedContainerSettingsV2{
+		SchemaVersion: prot.SchemaVersion{Major: 2, Minor: 1},
+		OCIBundlePath: bundlePath,
+		OCISpecification: &oci.Spec{
+			Version: oci.Version,
+			Process: &oci.Process{
+				Args: args,
+				Env:  []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+				Cwd:  "/",
+			},
+			Root: &oci.Root{Path: filepath.Join(bundlePath, "rootfs")},
+			// Containers without a resolv.conf are added to the default network
+			// namespace, which only holds one container.
+			Mounts: []oci.Mount{{
+				Destination: "/etc/resolv.conf",
+				Type:        "bind",
+				Source:      "/etc/resolv.conf",
+				Options:     []string{"bind", "ro"},
+			}},
+			Linux: &oci.Linux{},
+		},
+		ScratchDirPath: scratchDir,
+	})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if err := h.request(prot.ComputeSystemCreateV1, &prot.ContainerCreate{
+		MessageBase:     prot.MessageBase{ContainerID: id},
+		ContainerConfig: string(settings),
+	}, &prot.ContainerCreateResponse{}); err != nil {
+		h.t.Fatalf("failed to create container: %v", err)
+	}
+	return id
+}
+
+// deleteContainer deletes the state of the stopped container `id`.
+func (h *testHarness) deleteContainer(id string) {
+	h.t.Helper()
+	if err := h.request(prot.ComputeSystemDeleteContainerStateV1, &prot.MessageBase{
+		ContainerID: id,
+	}, &prot.MessageResponseBase{}); err != nil {
+		h.t.Fatalf("failed to delete container: %v", err)
+	}
+}
+
+// startContainer starts the init process of the container `id`, with the
+// stdio of `s`, and returns its pid.
+func (h *testHarness) startContainer(id string, s *harnessStdio) uint32 {
+	h.t.Helper()
+	pid, err := h.exec(id, nil, s)
+	if err != nil {
+		h.t.Fatalf("failed to start container: %v", err)
+	}
+	return pid
+}
+
+// exec runs `process` in the container `id`, or starts the container if
+// `process` is nil, with the stdio of `s`.
+func (h *testHarness) exec(id string, process *oci.Process, s *harnessStdio) (uint32, error) {
+	params := prot.ProcessParameters{OCIProcess: process}
+	var relay prot.ExecuteProcessVsockStdioRelaySettings
+	if s != nil {
+		params.CreateStdInPipe = s.in != nil
+		params.CreateStdOutPipe = s.out != nil
+		params.CreateStdErrPipe = s.err != nil
+		relay = s.settings
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return 0, err
+	}
+	resp := &prot.ContainerExecuteProcessResponse{}
+	if err := h.request(prot.ComputeSystemExecuteProcessV1, &prot.ContainerExecuteProcess{
+		MessageBase: prot.MessageBase{ContainerID: id},
+		Settings: prot.ExecuteProcessSettings{
+			ProcessParameters:       string(b),
+			VsockStdioRelaySettings: relay,
+		},
+	}, resp); err != nil {
+		return 0, err
+	}
+	return resp.ProcessID, nil
+}
+
+// attach attaches the stdio of `s` to the process `pid` of the container `id`.
+func (h *testHarness) attach(id string, pid uint32, s *harnessStdio) error {
+	return h.request(prot.ComputeSystemAttachProcessV1, &prot.ContainerAttachProcess{
+		MessageBase:             prot.MessageBase{ContainerID: id},
+		ProcessID:               pid,
+		CreateStdInPipe:         s.in != nil,
+		CreateStdOutPipe:        s.out != nil,
+		CreateStdErrPipe:        s.err != nil,
+		VsockStdioRelaySettings: s.settings,
+	}, &prot.MessageResponseBase{})
+}
+
+// wait waits up to `timeout` for the process `pid` of the container `id` to
+// exit, and returns its exit code.
+func (h *testHarness) wait(id string, pid uint32, timeout time.Duration) (uint32, error) {
+	resp := &prot.ContainerWaitForProcessResponse{}
+	if err := h.request(prot.ComputeSystemWaitForProcessV1, &prot.ContainerWaitForProcess{
+		MessageBase: prot.MessageBase{ContainerID: id},
+		ProcessID:   pid,
+		TimeoutInMs: uint32(timeout.Milliseconds()),
+	}, resp); err != nil {
+		return 0, err
+	}
+	return resp.ExitCode, nil
+}
+
+// signal sends `signal` to the process `pid` of the container `id`.
+func (h *testHarness) signal(id string, pid uint32, signal int32) error {
+	return h.request(prot.ComputeSystemSignalProcessV1, &prot.ContainerSignalProcess{
+		MessageBase: prot.MessageBase{ContainerID: id},
+		ProcessID:   pid,
+		Options:     prot.SignalProcessOptions{Signal: signal},
+	}, &prot.MessageResponseBase{})
+}
+
+// shutdown sends SIGTERM to the container `id` if `graceful`, or else SIGKILL.
+func (h *testHarness) shutdown(id string, graceful bool) error {
+	var typ prot.MessageIdentifier = prot.ComputeSystemShutdownForcedV1
+	if graceful {
+		typ = prot.ComputeSystemShutdownGracefulV1
+	}
+	return h.request(typ, &prot.MessageBase{ContainerID: id}, &prot.MessageResponseBase{})
+}
+
+// waitNotification waits for the exit notification of the container `id`.
+func (h *testHarness) waitNotification(id string) *prot.ContainerNotification {
+	h.t.Helper()
+	select {
+	case n := <-h.notifications:
+		if n.ContainerID != id {
+			h.t.Fatalf("expected notification for container %s, got %+v", id, n)
+		}
+		return n
+	case <-time.After(harnessTimeout):
+		h.t.Fatalf("timed out waiting for notification of container %s", id)
+	}
+	return nil
+}
+
+// harnessStdio is the host side of the stdio connections of a process, whose
+// ports are listened on before the process is created.
+type harnessStdio struct {
+	t        *testing.T
+	settings prot.ExecuteProcessVsockStdioRelaySettings
+	in       *harnessConn
+	out      *harnessConn
+	err      *harnessConn
+}
+
+type harnessConn struct {
+	ch   chan *net.UnixConn
+	conn *net.UnixConn
+}
+
+// listen listens on a new port for a connection from the GCS.
+func (h *testHarness) listen() (uint32, *harnessConn) {
+	h.t.Helper()
+	h.mu.Lock()
+	h.nextPort++
+	port := h.nextPort
+	h.mu.Unlock()
+
+	l, err := h.tport.Listen(port)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	c := &harnessConn{ch: make(chan *net.UnixConn, 1)}
+	go func() {
+		defer l.Close()
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			close(c.ch)
+			return
+		}
+		c.ch <- conn
+	}()
+	h.t.Cleanup(func() {
+		l.Close()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	})
+	return port, c
+}
+
+// stdio listens for the stdin, stdout and stderr connections of a process, as
+// selected.
+func (h *testHarness) stdio(stdin, stdout, stderr bool) *harnessStdio {
+	h.t.Helper()
+	s := &harnessStdio{t: h.t}
+	if stdin {
+		s.settings.StdIn, s.in = h.listen()
+	}
+	if stdout {
+		s.settings.StdOut, s.out = h.listen()
+	}
+	if stderr {
+		s.settings.StdErr, s.err = h.listen()
+	}
+	return s
+}
+
+// copyTo streams the tar archive `b` to the GCS, to be extracted into `path`
+// of the container `id`.
+func (h *testHarness) copyTo(id, path string, b []byte, preserveOwnership bool) error {
+	port, c := h.listen()
+	writeErr := make(chan error, 1)
+	go func() {
+		conn, ok := <-c.ch
+		if !ok {
+			writeErr <- errors.New("failed to accept copy connection")
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.Write(b); err != nil {
+			writeErr <- err
+			return
+		}
+		writeErr <- conn.CloseWrite()
+	}()
+	if err := h.request(prot.ComputeSystemCopyToContainerV1, &prot.ContainerCopy{
+		MessageBase:       prot.MessageBase{ContainerID: id},
+		Path:              path,
+		Port:              port,
+		PreserveOwnership: preserveOwnership,
+	}, &prot.MessageResponseBase{}); err != nil {
+		return err
+	}
+	return <-writeErr
+}
+
+// copyFrom returns the tar archive of `path` of the container `id`, as
+// streamed by the GCS.
+func (h *testHarness) copyFrom(id, path string) ([]byte, error) {
+	port, c := h.listen()
+	type result struct {
+		b   []byte
+		err error
+	}
+	read := make(chan result, 1)
+	go func() {
+		conn, ok := <-c.ch
+		if !ok {
+			read <- result{err: errors.New("failed to accept copy connection")}
+			return
+		}
+		defer conn.Close()
+		b, err := io.ReadAll(conn)
+		read <- result{b, err}
+	}()
+	if err := h.request(prot.ComputeSystemCopyFromContainerV1, &prot.ContainerCopy{
+		MessageBase: prot.MessageBase{ContainerID: id},
+		Path:        path,
+		Port:        port,
+	}, &prot.MessageResponseBase{}); err != nil {
+		return nil, err
+	}
+	r := <-read
+	return r.b, r.err
+}
+
+// get waits for the GCS to dial the connection.
+func (c *harnessConn) get(t *testing.T) *net.UnixConn {
+	t.Helper()
+	if c.conn != nil {
+		return c.conn
+	}
+	select {
+	case conn, ok := <-c.ch:
+		if !ok {
+			t.Fatal("failed to accept stdio connection")
+		}
+		c.conn = conn
+	case <-time.After(harnessTimeout):
+		t.Fatal("timed out waiting for stdio connection")
+	}
+	return c.conn
+}
+
+// writeIn writes `str` to stdin, which is closed if `close`.
+func (s *harnessStdio) writeIn(str string, close bool) {
+	s.t.Helper()
+	conn := s.in.get(s.t)
+	if _, err := conn.Write([]byte(str)); err != nil {
+		s.t.Fatalf("failed to write to stdin: %v", err)
+	}
+	if close {
+		if err := conn.CloseWrite(); err != nil {
+			s.t.Fatalf("failed to close stdin: %v", err)
+		}
+	}
+}
+
+func (s *harnessStdio) readAll(c *harnessConn, name string) string {
+	s.t.Helper()
+	conn := c.get(s.t)
+	if err := conn.SetReadDeadline(time.Now().Add(harnessTimeout)); err != nil {
+		s.t.Fatal(err)
+	}
+	b, err := io.ReadAll(conn)
+	if err != nil {
+		s.t.Fatalf("failed to read %s: %v", name, err)
+	}
+	// the GCS waits for the connection to be closed once relayed
+	conn.Close()
+	return string(b)
+}
+
+// readOut reads stdout until it is closed by the GCS.
+func (s *harnessStdio) readOut() string {
+	s.t.Helper()
+	return s.readAll(s.out, "stdout")
+}
+
+// readErr reads stderr until it is closed by the GCS.
+func (s *harnessStdio) readErr() string {
+	s.t.Helper()
+	return s.readAll(s.err, "stderr")
+}
@@ -0,0 +1,225 @@
+//go:build linux
+// +build linux
+
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	cgroups "github.com/containerd/cgroups/v3"
+	v1 "github.com/containerd/cgroups/v3/cgroup1/stats"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// mountpoint is where the cgroup hierarchy of the guest is mounted.
+const mountpoint = "/sys/fs/cgroup"
+
+var (
+	// ErrDeleted is returned by Notifier.Wait once the cgroup which is being
+	// monitored has been deleted.
+	ErrDeleted = errors.New("cgroup has been deleted")
+	// ErrNotSupported is returned when a cgroup feature is not available on
+	// the hierarchy of the guest.
+	ErrNotSupported = errors.New("not supported on this cgroup hierarchy")
+)
+
+// Hierarchy is the cgroup hierarchy of the guest.
+type Hierarchy int
+
+const (
+	// Legacy is the cgroup v1 hierarchy, with a hierarchy for each controller.
+	// Hybrid hierarchies are managed as legacy ones, since their controllers
+	// are all on the v1 hierarchies.
+	Legacy Hierarchy = iota
+	// Unified is the cgroup v2 hierarchy.
+	Unified
+)
+
+func (h Hierarchy) String() string {
+	switch h {
+	case Legacy:
+		return "legacy"
+	case Unified:
+		return "unified"
+	default:
+		return fmt.Sprintf("Hierarchy(%d)", int(h))
+	}
+}
+
+// Detect returns the cgroup hierarchy mounted by init. The hierarchy is
+// detected once, and is the same for the lifetime of the guest.
+func Detect() Hierarchy {
+	if cgroups.Mode() == cgroups.Unified {
+		return Unified
+	}
+	return Legacy
+}
+
+// Notifier notifies of the events of a cgroup.
+type Notifier interface {
+	// Wait blocks until the next event, and returns ErrDeleted once the cgroup
+	// has been deleted.
+	Wait() error
+	// Close releases the notifier and unblocks Wait.
+	Close() error
+}
+
+// Cgroup is a cgroup of the guest.
+type Cgroup interface {
+	// Path returns the path of the cgroup, relative to the root of the
+	// hierarchy.
+	Path() string
+	// Add moves the process into the cgroup.
+	Add(pid int) error
+	// Update sets the resource limits of the cgroup.
+	Update(resources *specs.LinuxResources) error
+	// Stat returns the statistics of the cgroup, in the v1 format on both
+	// hierarchies. Statistics of missing controllers are left empty.
+	Stat() (*v1.Metrics, error)
+	// Pressure returns the pressure stall information of the cgroup, or
+	// ErrNotSupported on the legacy hierarchy.
+	Pressure() (*PressureStats, error)
+	// MemoryEvents returns the counts of the memory events of the cgroup, or
+	// ErrNotSupported on the legacy hierarchy.
+	MemoryEvents() (*MemoryEventStats, error)
+	// Delete removes the cgroup, which must have no processes left.
+	Delete() error
+	// RegisterMemoryThreshold returns a Notifier of the memory usage of the
+	// cgroup exceeding threshold bytes.
+	RegisterMemoryThreshold(threshold uint64) (Notifier, error)
+	// RegisterOOM returns a Notifier of the OOM events of the cgroup.
+	RegisterOOM() (Notifier, error)
+	// RegisterMemoryEvent returns a Notifier of the memory events of the
+	// cgroup of kind event. Only OOMKill is supported on the legacy hierarchy.
+	RegisterMemoryEvent(event MemoryEvent) (Notifier, error)
+	// RegisterPressure returns a Notifier of the pressure stall of a resource
+	// of the cgroup exceeding trigger, or ErrNotSupported on the legacy
+	// hierarchy.
+	RegisterPressure(trigger PressureTrigger) (Notifier, error)
+}
+
+// MemoryEvent is a kind of memory event of a cgroup, as counted in the
+// memory.events of the unified hierarchy.
+type MemoryEvent string
+
+const (
+	// MemoryHigh is the memory usage of the cgroup exceeding its high limit,
+	// upon which it is throttled and reclaimed.
+	MemoryHigh MemoryEvent = "high"
+	// MemoryMax is the memory usage of the cgroup reaching its max limit,
+	// upon which it is reclaimed or OOM killed.
+	MemoryMax MemoryEvent = "max"
+	// OOMKill is a process of the cgroup being killed by the OOM killer.
+	OOMKill MemoryEvent = "oom_kill"
+)
+
+// MemoryEventStats are the counts of the memory events of a cgroup and its
+// descendants, from its memory.events.
+type MemoryEventStats struct {
+	// Low is the number of times the cgroup was reclaimed while under its low
+	// boundary.
+	Low uint64
+	// High is the number of times the cgroup was throttled for exceeding its
+	// high limit.
+	High uint64
+	// Max is the number of times the cgroup was about to exceed its max limit.
+	Max uint64
+	// OOM is the number of times the cgroup reached its max limit and
+	// reclaiming failed.
+	OOM uint64
+	// OOMKill is the number of processes of the cgroup which were killed by
+	// the OOM killer.
+	OOMKill uint64
+}
+
+// PressureTrigger is a threshold of the pressure stall of a resource of a
+// cgroup: the time in which some, or all if Full, of the tasks were stalled
+// on the resource within a window of time.
+type PressureTrigger struct {
+	// Resource is the stalled resource, which is "cpu", "memory" or "io".
+	Resource string
+	Full     bool
+	Stall    time.Duration
+	// Window must be between 500ms and 10s, as limited by the kernel.
+	Window time.Duration
+}
+
+// String returns the trigger in the format of the pressure files.
+func (t PressureTrigger) String() string {
+	kind := "some"
+	if t.Full {
+		kind = "full"
+	}
+	return fmt.Sprintf("%s %d %d", kind, t.Stall.Microseconds(), t.Window.Microseconds())
+}
+
+func (t PressureTrigger) validate() error {
+	switch t.Resource {
+	case "cpu", "memory", "io":
+	default:
+		return fmt.Errorf("invalid pressure resource %q", t.Resource)
+	}
+	if t.Window < 500*time.Millisecond || t.Window > 10*time.Second {
+		return fmt.Errorf("pressure window %v is not between 500ms and 10s", t.Window)
+	}
+	if t.Stall <= 0 || t.Stall > t.Window {
+		return fmt.Errorf("pressure stall %v is not within the window %v", t.Stall, t.Window)
+	}
+	return nil
+}
+
+// PressureStats is the pressure stall information of a cgroup for each
+// resource.
+type PressureStats struct {
+	CPU    *Pressure `json:",omitempty"`
+	Memory *Pressure `json:",omitempty"`
+	IO     *Pressure `json:",omitempty"`
+}
+
+// Pressure is the pressure stall information of a resource: the share of time
+// in which some or all of the tasks were stalled on the resource.
+type Pressure struct {
+	Some *PressureData `json:",omitempty"`
+	Full *PressureData `json:",omitempty"`
+}
+
+// PressureData are the averages of the share of stalled time, in percent, over
+// the last 10, 60 and 300 seconds, and the total stalled time in microseconds.
+type PressureData struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64
+}
+
+// Init prepares the root of the hierarchy for the cgroups of the guest, and
+// must be called before any of them is created.
+//
+// On the legacy hierarchy, hierarchical memory accounting is enabled. On the
+// unified hierarchy, the controllers of the root cgroup are enabled for its
+// children.
+func Init() error {
+	if Detect() == Unified {
+		return enableControllers(mountpoint, "/")
+	}
+	return initLegacy()
+}
+
+// New creates the cgroup at path with the resource limits, or updates them
+// if the cgroup already exists.
+func New(path string, resources *specs.LinuxResources) (Cgroup, error) {
+	if Detect() == Unified {
+		return newUnified(mountpoint, path, resources)
+	}
+	return newLegacy(path, resources)
+}
+
+// Load returns the existing cgroup at path.
+func Load(path string) (Cgroup, error) {
+	if Detect() == Unified {
+		return loadUnified(mountpoint, path)
+	}
+	return loadLegacy(path)
+}
@@ -0,0 +1,7 @@
+// Package cgroup manages the cgroups of the guest on either the legacy (v1) or
+// the unified (v2) hierarchy, which is detected once at boot.
+//
+// Both hierarchies are exposed through the Cgroup interface. Statistics are
+// returned in the v1 format of the bridge protocol on both hierarchies, so
+// that the host does not depend on the hierarchy of the guest.
+package cgroup
@@ -0,0 +1,137 @@
+//go:build linux
+// +build linux
+
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	cgroup1 "github.com/containerd/cgroups/v3/cgroup1"
+	v1 "github.com/containerd/cgroups/v3/cgroup1/stats"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// legacy is a cgroup on the v1 hierarchy, which is managed by cgroup1.
+type legacy struct {
+	path string
+	cg   cgroup1.Cgroup
+}
+
+var _ Cgroup = &legacy{}
+
+// initLegacy enables hierarchical memory accounting, which must be done before
+// any cgroup is created for the write to succeed.
+func initLegacy() error {
+	if err := os.WriteFile(filepath.Join(mountpoint, "memory", "memory.use_hierarchy"), []byte("1"), 0644); err != nil {
+		return fmt.Errorf("failed to enable hierarchy support for root cgroup: %w", err)
+	}
+	return nil
+}
+
+func newLegacy(path string, resources *specs.LinuxResources) (*legacy, error) {
+	cg, err := cgroup1.New(cgroup1.StaticPath(path), resources)
+	if err != nil {
+		return nil, err
+	}
+	return &legacy{path: path, cg: cg}, nil
+}
+
+func loadLegacy(path string) (*legacy, error) {
+	cg, err := cgroup1.Load(cgroup1.StaticPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return &legacy{path: path, cg: cg}, nil
+}
+
+func (l *legacy) Path() string {
+	return l.path
+}
+
+func (l *legacy) Add(pid int) error {
+	return l.cg.Add(cgroup1.Process{Pid: pid})
+}
+
+func (l *legacy) Update(resources *specs.LinuxResources) error {
+	return l.cg.Update(resources)
+}
+
+func (l *legacy) Stat() (*v1.Metrics, error) {
+	return l.cg.Stat(cgroup1.IgnoreNotExist)
+}
+
+func (l *legacy) Pressure() (*PressureStats, error) {
+	return nil, ErrNotSupported
+}
+
+func (l *legacy) MemoryEvents() (*MemoryEventStats, error) {
+	return nil, ErrNotSupported
+}
+
+func (l *legacy) Delete() error {
+	return l.cg.Delete()
+}
+
+func (l *legacy) RegisterMemoryThreshold(threshold uint64) (Notifier, error) {
+	fd, err := l.cg.RegisterMemoryEvent(cgroup1.MemoryThresholdEvent(threshold, false))
+	if err != nil {
+		return nil, err
+	}
+	return l.newNotifier(fd), nil
+}
+
+func (l *legacy) RegisterOOM() (Notifier, error) {
+	fd, err := l.cg.OOMEventFD()
+	if err != nil {
+		return nil, err
+	}
+	return l.newNotifier(fd), nil
+}
+
+func (l *legacy) RegisterMemoryEvent(event MemoryEvent) (Notifier, error) {
+	if event != OOMKill {
+		return nil, ErrNotSupported
+	}
+	return l.RegisterOOM()
+}
+
+func (l *legacy) RegisterPressure(PressureTrigger) (Notifier, error) {
+	return nil, ErrNotSupported
+}
+
+func (l *legacy) newNotifier(fd uintptr) *eventfdNotifier {
+	return &eventfdNotifier{
+		f:            os.NewFile(fd, "eventfd"),
+		eventControl: filepath.Join(mountpoint, "memory", l.path, "cgroup.event_control"),
+	}
+}
+
+// eventfdNotifier notifies of the memory events of the v1 hierarchy, which are
+// signaled through an eventfd.
+type eventfdNotifier struct {
+	f            *os.File
+	eventControl string
+}
+
+func (n *eventfdNotifier) Wait() error {
+	// Buffer must be >= 8 bytes for eventfd reads
+	// http://man7.org/linux/man-pages/man2/eventfd.2.html
+	buf := make([]byte, 8)
+	if _, err := n.f.Read(buf); err != nil {
+		return fmt.Errorf("failed to read from eventfd: %w", err)
+	}
+
+	// Sometimes an event is sent during cgroup teardown, but does not indicate that the
+	// threshold was actually crossed. In the teardown case the cgroup.event_control file
+	// won't exist anymore, so check that to determine if we should ignore this event.
+	if _, err := os.Lstat(n.eventControl); os.IsNotExist(err) {
+		return ErrDeleted
+	}
+	return nil
+}
+
+func (n *eventfdNotifier) Close() error {
+	return n.f.Close()
+}
@@ -0,0 +1,780 @@
+//go:build linux
+// +build linux
+
+package cgroup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/containerd/cgroups/v3/cgroup1/stats"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// pollInterval is the interval at which the memory usage of unified cgroups
+// is compared to their thresholds, which the unified hierarchy does not
+// notify of.
+var pollInterval = time.Second
+
+// unified is a cgroup on the v2 hierarchy, which is managed through its
+// interface files directly.
+type unified struct {
+	root string
+	path string
+}
+
+var _ Cgroup = &unified{}
+
+func newUnified(root, path string, resources *specs.LinuxResources) (*unified, error) {
+	u := &unified{root: root, path: filepath.Clean("/" + path)}
+	if u.path == "/" {
+		return nil, errors.New("cannot create the root cgroup")
+	}
+	if err := os.MkdirAll(u.dir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup %s: %w", u.path, err)
+	}
+	// a controller is only available in a cgroup once it is enabled in all of
+	// its ancestors
+	for _, p := range ancestors(u.path) {
+		if err := enableControllers(root, p); err != nil {
+			return nil, err
+		}
+	}
+	if resources != nil {
+		if err := u.Update(resources); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+func loadUnified(root, path string) (*unified, error) {
+	u := &unified{root: root, path: filepath.Clean("/" + path)}
+	if _, err := os.Stat(u.dir()); err != nil {
+		return nil, fmt.Errorf("failed to load cgroup %s: %w", u.path, err)
+	}
+	return u, nil
+}
+
+// ancestors returns the ancestors of the cgroup at path, starting from the
+// root cgroup.
+func ancestors(path string) []string {
+	var paths []string
+	for p := filepath.Dir(path); ; p = filepath.Dir(p) {
+		paths = append([]string{p}, paths...)
+		if p == "/" {
+			return paths
+		}
+	}
+}
+
+// enableControllers enables all of the controllers available in the cgroup at
+// path for its children.
+func enableControllers(root, path string) error {
+	dir := filepath.Join(root, path)
+	b, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("failed to read controllers of cgroup %s: %w", path, err)
+	}
+	controllers := strings.Fields(string(b))
+	if len(controllers) == 0 {
+		return nil
+	}
+	for i, c := range controllers {
+		controllers[i] = "+" + c
+	}
+	if err := writeFile(dir, "cgroup.subtree_control", strings.Join(controllers, " ")); err != nil {
+		return fmt.Errorf("failed to enable controllers of cgroup %s: %w", path, err)
+	}
+	return nil
+}
+
+func (u *unified) dir() string {
+	return filepath.Join(u.root, u.path)
+}
+
+func (u *unified) Path() string {
+	return u.path
+}
+
+func (u *unified) Add(pid int) error {
+	return writeFile(u.dir(), "cgroup.procs", strconv.Itoa(pid))
+}
+
+func (u *unified) Update(resources *specs.LinuxResources) error {
+	values, err := unifiedResources(resources)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeFile(u.dir(), name, values[name]); err != nil {
+			return fmt.Errorf("failed to update cgroup %s: %w", u.path, err)
+		}
+	}
+	return nil
+}
+
+func (u *unified) Delete() error {
+	if err := unix.Rmdir(u.dir()); err != nil && !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to delete cgroup %s: %w", u.path, err)
+	}
+	return nil
+}
+
+func (u *unified) RegisterMemoryThreshold(threshold uint64) (Notifier, error) {
+	current := filepath.Join(u.dir(), "memory.current")
+	if _, err := os.Stat(current); err != nil {
+		return nil, err
+	}
+	return &thresholdNotifier{
+		current:   current,
+		threshold: threshold,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+func (u *unified) RegisterOOM() (Notifier, error) {
+	return u.RegisterMemoryEvent(OOMKill)
+}
+
+func (u *unified) RegisterMemoryEvent(event MemoryEvent) (Notifier, error) {
+	return newMemoryEventNotifier(filepath.Join(u.dir(), "memory.events"), event)
+}
+
+func (u *unified) RegisterPressure(trigger PressureTrigger) (Notifier, error) {
+	if err := trigger.validate(); err != nil {
+		return nil, err
+	}
+	return newPressureNotifier(filepath.Join(u.dir(), trigger.Resource+".pressure"), trigger)
+}
+
+// unifiedResources converts the resources of the runtime spec to the values of
+// the interface files of the unified hierarchy, as runc does.
+func unifiedResources(r *specs.LinuxResources) (map[string]string, error) {
+	values := map[string]string{}
+	if r == nil {
+		return values, nil
+	}
+
+	if m := r.Memory; m != nil {
+		if m.Limit != nil && *m.Limit != 0 {
+			values["memory.max"] = maxValue(*m.Limit)
+		}
+		if m.Reservation != nil && *m.Reservation != 0 {
+			values["memory.low"] = strconv.FormatInt(*m.Reservation, 10)
+		}
+		if m.Swap != nil && *m.Swap != 0 {
+			// the swap limit of the runtime spec includes the memory limit,
+			// which memory.swap.max does not
+			var limit int64
+			if m.Limit != nil {
+				limit = *m.Limit
+			}
+			switch {
+			case *m.Swap == -1 || limit == -1:
+				values["memory.swap.max"] = maxValue(*m.Swap)
+			case limit == 0:
+				return nil, errors.New("cannot set a swap limit without a memory limit")
+			case *m.Swap < limit:
+				return nil, fmt.Errorf("swap limit %d is lower than memory limit %d", *m.Swap, limit)
+			default:
+				values["memory.swap.max"] = strconv.FormatInt(*m.Swap-limit, 10)
+			}
+		}
+	}
+
+	if c := r.CPU; c != nil {
+		if c.Shares != nil && *c.Shares != 0 {
+			values["cpu.weight"] = strconv.FormatUint(sharesToWeight(*c.Shares), 10)
+		}
+		if (c.Quota != nil && *c.Quota != 0) || (c.Period != nil && *c.Period != 0) {
+			quota := "max"
+			if c.Quota != nil && *c.Quota > 0 {
+				quota = strconv.FormatInt(*c.Quota, 10)
+			}
+			period := uint64(100000)
+			if c.Period != nil && *c.Period != 0 {
+				period = *c.Period
+			}
+			values["cpu.max"] = fmt.Sprintf("%s %d", quota, period)
+		}
+		if c.Cpus != "" {
+			values["cpuset.cpus"] = c.Cpus
+		}
+		if c.Mems != "" {
+			values["cpuset.mems"] = c.Mems
+		}
+	}
+
+	if r.Pids != nil && r.Pids.Limit != 0 {
+		values["pids.max"] = maxValue(r.Pids.Limit)
+	}
+
+	if r.BlockIO != nil && r.BlockIO.Weight != nil && *r.BlockIO.Weight != 0 {
+		// io.weight ranges over [1, 10000] rather than [10, 1000]
+		weight := 1 + (uint64(*r.BlockIO.Weight)-10)*9999/990
+		values["io.weight"] = fmt.Sprintf("default %d", weight)
+	}
+
+	for _, h := range r.HugepageLimits {
+		values["hugetlb."+h.Pagesize+".max"] = strconv.FormatUint(h.Limit, 10)
+	}
+
+	for name, value := range r.Unified {
+		if strings.ContainsRune(name, '/') {
+			return nil, fmt.Errorf("invalid cgroup interface file %q", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// maxValue formats a limit of the runtime spec, where a negative limit is
+// unlimited.
+func maxValue(v int64) string {
+	if v < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// sharesToWeight converts cpu shares, which range over [2, 262144], to a cpu
+// weight, which ranges over [1, 10000].
+func sharesToWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+func (u *unified) Stat() (*v1.Metrics, error) {
+	dir := u.dir()
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to stat cgroup %s: %w", u.path, err)
+	}
+
+	metrics := &v1.Metrics{}
+	for _, stat := range []func(string, *v1.Metrics) error{statPids, statCPU, statMemory, statIO} {
+		if err := stat(dir, metrics); err != nil {
+			return nil, fmt.Errorf("failed to stat cgroup %s: %w", u.path, err)
+		}
+	}
+	return metrics, nil
+}
+
+func statPids(dir string, metrics *v1.Metrics) error {
+	current, err := readUint(dir, "pids.current")
+	if err != nil {
+		return ignoreNotExist(err)
+	}
+	limit, err := readUint(dir, "pids.max")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if limit == math.MaxUint64 {
+		limit = 0
+	}
+	metrics.Pids = &v1.PidsStat{Current: current, Limit: limit}
+	return nil
+}
+
+func statCPU(dir string, metrics *v1.Metrics) error {
+	stat, err := readKeyValues(dir, "cpu.stat")
+	if err != nil {
+		return ignoreNotExist(err)
+	}
+	// cpu.stat is in microseconds, and the v1 statistics in nanoseconds
+	metrics.CPU = &v1.CPUStat{
+		Usage: &v1.CPUUsage{
+			Total:  stat["usage_usec"] * 1000,
+			User:   stat["user_usec"] * 1000,
+			Kernel: stat["system_usec"] * 1000,
+		},
+		Throttling: &v1.Throttle{
+			Periods:          stat["nr_periods"],
+			ThrottledPeriods: stat["nr_throttled"],
+			ThrottledTime:    stat["throttled_usec"] * 1000,
+		},
+	}
+	return nil
+}
+
+func statMemory(dir string, metrics *v1.Metrics) error {
+	stat, err := readKeyValues(dir, "memory.stat")
+	if err != nil {
+		return ignoreNotExist(err)
+	}
+	// statistics of the unified hierarchy are all hierarchical
+	memory := &v1.MemoryStat{
+		Cache:             stat["file"],
+		RSS:               stat["anon"],
+		RSSHuge:           stat["anon_thp"],
+		MappedFile:        stat["file_mapped"],
+		Dirty:             stat["file_dirty"],
+		Writeback:         stat["file_writeback"],
+		PgFault:           stat["pgfault"],
+		PgMajFault:        stat["pgmajfault"],
+		InactiveAnon:      stat["inactive_anon"],
+		ActiveAnon:        stat["active_anon"],
+		InactiveFile:      stat["inactive_file"],
+		ActiveFile:        stat["active_file"],
+		Unevictable:       stat["unevictable"],
+		TotalCache:        stat["file"],
+		TotalRSS:          stat["anon"],
+		TotalRSSHuge:      stat["anon_thp"],
+		TotalMappedFile:   stat["file_mapped"],
+		TotalDirty:        stat["file_dirty"],
+		TotalWriteback:    stat["file_writeback"],
+		TotalPgFault:      stat["pgfault"],
+		TotalPgMajFault:   stat["pgmajfault"],
+		TotalInactiveAnon: stat["inactive_anon"],
+		TotalActiveAnon:   stat["active_anon"],
+		TotalInactiveFile: stat["inactive_file"],
+		TotalActiveFile:   stat["active_file"],
+		TotalUnevictable:  stat["unevictable"],
+		Usage:             &v1.MemoryEntry{},
+		Swap:              &v1.MemoryEntry{},
+		Kernel:            &v1.MemoryEntry{Usage: stat["kernel"]},
+	}
+
+	for _, f := range []struct {
+		name  string
+		value *uint64
+	}{
+		{"memory.current", &memory.Usage.Usage},
+		{"memory.max", &memory.Usage.Limit},
+		{"memory.peak", &memory.Usage.Max},
+		{"memory.swap.current", &memory.Swap.Usage},
+		{"memory.swap.max", &memory.Swap.Limit},
+		{"memory.swap.peak", &memory.Swap.Max},
+	} {
+		v, err := readUint(dir, f.name)
+		if err != nil {
+			if err := ignoreNotExist(err); err != nil {
+				return err
+			}
+			continue
+		}
+		*f.value = v
+	}
+	memory.HierarchicalMemoryLimit = memory.Usage.Limit
+	memory.HierarchicalSwapLimit = memory.Swap.Limit
+
+	events, err := readKeyValues(dir, "memory.events")
+	if err != nil {
+		if err := ignoreNotExist(err); err != nil {
+			return err
+		}
+	} else {
+		memory.Usage.Failcnt = events["max"]
+		metrics.MemoryOomControl = &v1.MemoryOomControl{OomKill: events["oom_kill"]}
+	}
+
+	metrics.Memory = memory
+	return nil
+}
+
+func statIO(dir string, metrics *v1.Metrics) error {
+	f, err := os.Open(filepath.Join(dir, "io.stat"))
+	if err != nil {
+		return ignoreNotExist(err)
+	}
+	defer f.Close()
+
+	blkio := &v1.BlkIOStat{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// each line is the statistics of a device: "MAJ:MIN rbytes=N wbytes=N ..."
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		var major, minor uint64
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+			return fmt.Errorf("invalid io.stat device %q", fields[0])
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid io.stat value %q", field)
+			}
+			entry := &v1.BlkIOEntry{Major: major, Minor: minor, Value: v}
+			switch key {
+			case "rbytes":
+				entry.Op = "Read"
+				blkio.IoServiceBytesRecursive = append(blkio.IoServiceBytesRecursive, entry)
+			case "wbytes":
+				entry.Op = "Write"
+				blkio.IoServiceBytesRecursive = append(blkio.IoServiceBytesRecursive, entry)
+			case "rios":
+				entry.Op = "Read"
+				blkio.IoServicedRecursive = append(blkio.IoServicedRecursive, entry)
+			case "wios":
+				entry.Op = "Write"
+				blkio.IoServicedRecursive = append(blkio.IoServicedRecursive, entry)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	metrics.Blkio = blkio
+	return nil
+}
+
+func (u *unified) Pressure() (*PressureStats, error) {
+	stats := &PressureStats{}
+	for _, r := range []struct {
+		name     string
+		pressure **Pressure
+	}{
+		{"cpu.pressure", &stats.CPU},
+		{"memory.pressure", &stats.Memory},
+		{"io.pressure", &stats.IO},
+	} {
+		p, err := readPressure(filepath.Join(u.dir(), r.name))
+		if err != nil {
+			if err := ignoreNotExist(err); err != nil {
+				return nil, fmt.Errorf("failed to read pressure of cgroup %s: %w", u.path, err)
+			}
+			continue
+		}
+		*r.pressure = p
+	}
+	return stats, nil
+}
+
+func (u *unified) MemoryEvents() (*MemoryEventStats, error) {
+	events, err := readKeyValues(u.dir(), "memory.events")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory events of cgroup %s: %w", u.path, err)
+	}
+	return &MemoryEventStats{
+		Low:     events["low"],
+		High:    events["high"],
+		Max:     events["max"],
+		OOM:     events["oom"],
+		OOMKill: events["oom_kill"],
+	}, nil
+}
+
+// readPressure parses a pressure file, whose lines are in the format
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0".
+func readPressure(path string) (*Pressure, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pressure{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		data := &PressureData{}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid pressure %q", field)
+			}
+			if key == "total" {
+				data.Total, err = strconv.ParseUint(value, 10, 64)
+			} else {
+				var avg float64
+				avg, err = strconv.ParseFloat(value, 64)
+				switch key {
+				case "avg10":
+					data.Avg10 = avg
+				case "avg60":
+					data.Avg60 = avg
+				case "avg300":
+					data.Avg300 = avg
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid pressure %q: %w", field, err)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			p.Some = data
+		case "full":
+			p.Full = data
+		}
+	}
+	return p, nil
+}
+
+// writeFile writes value to an interface file of the cgroup at dir, which is
+// never created.
+func writeFile(dir, name, value string) error {
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %q to %s: %w", value, f.Name(), err)
+	}
+	return f.Close()
+}
+
+// readUint reads a single value interface file, where "max" is unlimited.
+func readUint(dir, name string) (uint64, error) {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "max" {
+		return math.MaxUint64, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value of %s: %w", name, err)
+	}
+	return v, nil
+}
+
+// readKeyValues reads a flat keyed interface file, whose lines are in the
+// format "key value".
+func readKeyValues(dir, name string) (map[string]uint64, error) {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]uint64{}
+	for _, line := range strings.Split(string(b), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %q", name, line)
+		}
+		values[key] = v
+	}
+	return values, nil
+}
+
+func ignoreNotExist(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// thresholdNotifier notifies of the memory usage of a cgroup exceeding a
+// threshold, by polling its memory.current.
+type thresholdNotifier struct {
+	current   string
+	threshold uint64
+	exceeded  bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (n *thresholdNotifier) Wait() error {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-n.done:
+			return os.ErrClosed
+		case <-t.C:
+		}
+		usage, err := readUint(filepath.Dir(n.current), filepath.Base(n.current))
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrDeleted
+		}
+		if err != nil {
+			return err
+		}
+		// only notify once each time the threshold is crossed
+		exceeded := usage > n.threshold
+		crossed := exceeded && !n.exceeded
+		n.exceeded = exceeded
+		if crossed {
+			return nil
+		}
+	}
+}
+
+func (n *thresholdNotifier) Close() error {
+	n.closeOnce.Do(func() { close(n.done) })
+	return nil
+}
+
+// memoryEventNotifier notifies of a kind of memory event of a cgroup, such as
+// OOM kills, which are counted in its memory.events, through inotify.
+type memoryEventNotifier struct {
+	f      *os.File
+	events string
+	event  MemoryEvent
+	count  uint64
+}
+
+func newMemoryEventNotifier(events string, event MemoryEvent) (_ *memoryEventNotifier, err error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	n := &memoryEventNotifier{
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		events: events,
+		event:  event,
+	}
+	defer func() {
+		if err != nil {
+			n.f.Close()
+		}
+	}()
+	if _, err := unix.InotifyAddWatch(fd, events, unix.IN_MODIFY); err != nil {
+		return nil, fmt.Errorf("failed to watch %s: %w", events, err)
+	}
+	if n.count, err = n.read(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *memoryEventNotifier) read() (uint64, error) {
+	events, err := readKeyValues(filepath.Dir(n.events), filepath.Base(n.events))
+	if err != nil {
+		return 0, err
+	}
+	return events[string(n.event)], nil
+}
+
+func (n *memoryEventNotifier) Wait() error {
+	buf := make([]byte, 4096)
+	for {
+		count, err := n.f.Read(buf)
+		if err != nil {
+			return fmt.Errorf("failed to read inotify events: %w", err)
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= count; {
+			// the watch is removed once the cgroup has been deleted
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			if mask&unix.IN_IGNORED != 0 {
+				return ErrDeleted
+			}
+			offset += unix.SizeofInotifyEvent + int(binary.NativeEndian.Uint32(buf[offset+12:]))
+		}
+
+		total, err := n.read()
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrDeleted
+		}
+		if err != nil {
+			return err
+		}
+		if total > n.count {
+			n.count = total
+			return nil
+		}
+	}
+}
+
+func (n *memoryEventNotifier) Close() error {
+	return n.f.Close()
+}
+
+// pressureNotifier notifies of the pressure stall of a resource of a cgroup
+// exceeding a trigger, which is written to its pressure file and signaled by
+// POLLPRI on it.
+type pressureNotifier struct {
+	// mu is held by Wait while it polls f, so that Close does not close it
+	// from under the poll.
+	mu     sync.Mutex
+	f      *os.File
+	r, w   *os.File
+	closed bool
+	once   sync.Once
+}
+
+func newPressureNotifier(pressure string, trigger PressureTrigger) (_ *pressureNotifier, err error) {
+	f, err := os.OpenFile(pressure, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+	// the trigger lasts as long as the file is open
+	if _, err := f.WriteString(trigger.String()); err != nil {
+		return nil, fmt.Errorf("failed to write pressure trigger %q to %s: %w", trigger, pressure, err)
+	}
+	// Close writes to the pipe to interrupt Wait
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	return &pressureNotifier{f: f, r: r, w: w}, nil
+}
+
+func (n *pressureNotifier) Wait() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return os.ErrClosed
+	}
+	fds := []unix.PollFd{
+		{Fd: int32(n.f.Fd()), Events: unix.POLLPRI},
+		{Fd: int32(n.r.Fd()), Events: unix.POLLIN},
+	}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return fmt.Errorf("failed to poll %s: %w", n.f.Name(), err)
+		}
+		switch {
+		case fds[1].Revents != 0:
+			return os.ErrClosed
+		case fds[0].Revents&unix.POLLERR != 0:
+			// the pressure file is gone once the cgroup has been deleted
+			return ErrDeleted
+		case fds[0].Revents&unix.POLLPRI != 0:
+			return nil
+		}
+	}
+}
+
+func (n *pressureNotifier) Close() error {
+	n.once.Do(func() {
+		_, _ = n.w.Write([]byte{0})
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.closed = true
+		n.f.Close()
+		n.r.Close()
+		n.w.Close()
+	})
+	return nil
+}
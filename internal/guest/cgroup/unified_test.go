@@ -0,0 +1,407 @@
+//go:build linux
+// +build linux
+
+package cgroup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func Test_Unified_Resources(t *testing.T) {
+	limit := int64(1 << 30)
+	swap := int64(3 << 29)
+	shares := uint64(1024)
+	quota := int64(50000)
+	weight := uint16(500)
+	values, err := unifiedResources(&specs.LinuxResources{
+		Memory:         &specs.LinuxMemory{Limit: &limit, Swap: &swap},
+		CPU:            &specs.LinuxCPU{Shares: &shares, Quota: &quota, Cpus: "0-1"},
+		Pids:           &specs.LinuxPids{Limit: -1},
+		BlockIO:        &specs.LinuxBlockIO{Weight: &weight},
+		HugepageLimits: []specs.LinuxHugepageLimit{{Pagesize: "2MB", Limit: 1 << 21}},
+		Unified:        map[string]string{"memory.high": "1000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"memory.max":      "1073741824",
+		"memory.swap.max": "536870912",
+		"cpu.weight":      "39",
+		"cpu.max":         "50000 100000",
+		"cpuset.cpus":     "0-1",
+		"pids.max":        "max",
+		"io.weight":       "default 4950",
+		"hugetlb.2MB.max": "2097152",
+		"memory.high":     "1000",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected %v, got %v", expected, values)
+	}
+}
+
+func Test_Unified_Resources_Invalid_Swap(t *testing.T) {
+	limit := int64(1 << 30)
+	swap := int64(1 << 29)
+	if _, err := unifiedResources(&specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit, Swap: &swap},
+	}); err == nil {
+		t.Fatal("expected swap limit lower than memory limit to be rejected")
+	}
+	if _, err := unifiedResources(&specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Swap: &swap},
+	}); err == nil {
+		t.Fatal("expected swap limit without memory limit to be rejected")
+	}
+}
+
+func Test_Unified_New(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"cgroup.controllers":     "cpu memory pids\n",
+		"cgroup.subtree_control": "",
+	})
+	writeTestFiles(t, filepath.Join(root, "containers"), map[string]string{
+		"cgroup.controllers":     "cpu memory pids\n",
+		"cgroup.subtree_control": "",
+	})
+	writeTestFiles(t, filepath.Join(root, "containers", "pod"), map[string]string{
+		"memory.max": "max\n",
+	})
+
+	limit := int64(1 << 20)
+	cg, err := newUnified(root, "/containers/pod", &specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cg.Path() != "/containers/pod" {
+		t.Fatalf("unexpected cgroup path %s", cg.Path())
+	}
+	for _, dir := range []string{root, filepath.Join(root, "containers")} {
+		if c := readTestFile(t, filepath.Join(dir, "cgroup.subtree_control")); c != "+cpu +memory +pids" {
+			t.Fatalf("expected controllers to be enabled in %s, got %q", dir, c)
+		}
+	}
+	if c := readTestFile(t, filepath.Join(root, "containers", "pod", "memory.max")); c != "1048576" {
+		t.Fatalf("expected memory limit to be set, got %q", c)
+	}
+}
+
+func Test_Unified_Update_Missing_Controller(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, filepath.Join(root, "gcs"), nil)
+
+	limit := int64(1 << 20)
+	cg := &unified{root: root, path: "/gcs"}
+	if err := cg.Update(&specs.LinuxResources{
+		Memory: &specs.LinuxMemory{Limit: &limit},
+	}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected missing memory controller error, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "gcs", "memory.max")); err == nil {
+		t.Fatal("expected interface file not to be created")
+	}
+}
+
+func Test_Unified_Stat(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, filepath.Join(root, "c"), map[string]string{
+		"pids.current":   "3\n",
+		"pids.max":       "max\n",
+		"cpu.stat":       "usage_usec 100\nuser_usec 60\nsystem_usec 40\nnr_periods 5\nnr_throttled 2\nthrottled_usec 7\n",
+		"memory.stat":    "anon 4096\nfile 8192\nkernel 1024\npgfault 9\n",
+		"memory.current": "12288\n",
+		"memory.max":     "1048576\n",
+		"memory.events":  "low 0\nhigh 0\nmax 4\noom 1\noom_kill 1\n",
+		"io.stat":        "8:0 rbytes=10 wbytes=20 rios=1 wios=2 dbytes=0 dios=0\n",
+	})
+
+	cg, err := loadUnified(root, "/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := cg.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics.Pids.Current != 3 || metrics.Pids.Limit != 0 {
+		t.Fatalf("unexpected pids stats %v", metrics.Pids)
+	}
+	if u := metrics.CPU.Usage; u.Total != 100000 || u.User != 60000 || u.Kernel != 40000 {
+		t.Fatalf("unexpected cpu usage %v", u)
+	}
+	if th := metrics.CPU.Throttling; th.Periods != 5 || th.ThrottledPeriods != 2 || th.ThrottledTime != 7000 {
+		t.Fatalf("unexpected cpu throttling %v", th)
+	}
+	m := metrics.Memory
+	if m.RSS != 4096 || m.Cache != 8192 || m.TotalRSS != 4096 || m.PgFault != 9 || m.Kernel.Usage != 1024 {
+		t.Fatalf("unexpected memory stats %v", m)
+	}
+	if m.Usage.Usage != 12288 || m.Usage.Limit != 1048576 || m.Usage.Failcnt != 4 {
+		t.Fatalf("unexpected memory usage %v", m.Usage)
+	}
+	if metrics.MemoryOomControl.OomKill != 1 {
+		t.Fatalf("unexpected oom kills %d", metrics.MemoryOomControl.OomKill)
+	}
+	if n := len(metrics.Blkio.IoServiceBytesRecursive); n != 2 {
+		t.Fatalf("expected 2 io service bytes entries, got %d", n)
+	}
+	if e := metrics.Blkio.IoServicedRecursive[1]; e.Op != "Write" || e.Major != 8 || e.Minor != 0 || e.Value != 2 {
+		t.Fatalf("unexpected io serviced entry %v", e)
+	}
+}
+
+func Test_Unified_Stat_Missing_Controllers(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, filepath.Join(root, "c"), map[string]string{
+		"memory.current": "4096\n",
+		"memory.stat":    "anon 4096\n",
+	})
+
+	cg, err := loadUnified(root, "/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := cg.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.CPU != nil || metrics.Pids != nil || metrics.Blkio != nil {
+		t.Fatalf("expected statistics of missing controllers to be empty, got %v", metrics)
+	}
+	if metrics.Memory.Usage.Usage != 4096 {
+		t.Fatalf("unexpected memory usage %v", metrics.Memory.Usage)
+	}
+}
+
+func Test_Unified_Load_Missing(t *testing.T) {
+	if _, err := loadUnified(t.TempDir(), "/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected missing cgroup error, got: %v", err)
+	}
+}
+
+func Test_Unified_Pressure(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, filepath.Join(root, "c"), map[string]string{
+		"memory.pressure": "some avg10=1.50 avg60=0.25 avg300=0.00 total=1234\nfull avg10=0.50 avg60=0.00 avg300=0.00 total=56\n",
+	})
+
+	cg := &unified{root: root, path: "/c"}
+	p, err := cg.Pressure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CPU != nil || p.IO != nil {
+		t.Fatal("expected pressure of missing files to be empty")
+	}
+	expected := &Pressure{
+		Some: &PressureData{Avg10: 1.5, Avg60: 0.25, Total: 1234},
+		Full: &PressureData{Avg10: 0.5, Total: 56},
+	}
+	if !reflect.DeepEqual(p.Memory, expected) {
+		t.Fatalf("expected memory pressure %+v, got %+v", expected, p.Memory)
+	}
+}
+
+func Test_Unified_Memory_Events(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, filepath.Join(root, "c"), map[string]string{
+		"memory.events": "low 1\nhigh 20\nmax 3\noom 2\noom_kill 1\n",
+	})
+
+	cg := &unified{root: root, path: "/c"}
+	events, err := cg.MemoryEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &MemoryEventStats{Low: 1, High: 20, Max: 3, OOM: 2, OOMKill: 1}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected memory events %+v, got %+v", expected, events)
+	}
+}
+
+func waitForEvent(t *testing.T, n Notifier) <-chan error {
+	t.Helper()
+	ch := make(chan error, 1)
+	go func() { ch <- n.Wait() }()
+	return ch
+}
+
+func Test_Unified_OOM_Notifier(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "c")
+	writeTestFiles(t, dir, map[string]string{
+		"memory.events": "max 0\noom 0\noom_kill 0\n",
+	})
+
+	cg := &unified{root: root, path: "/c"}
+	n, err := cg.RegisterOOM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	ch := waitForEvent(t, n)
+	writeTestFiles(t, dir, map[string]string{"memory.events": "max 1\noom 0\noom_kill 0\n"})
+	select {
+	case err := <-ch:
+		t.Fatalf("expected no event without an OOM kill, got: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	writeTestFiles(t, dir, map[string]string{"memory.events": "max 1\noom 1\noom_kill 1\n"})
+	if err := <-ch; err != nil {
+		t.Fatalf("expected OOM event, got: %v", err)
+	}
+
+	ch = waitForEvent(t, n)
+	if err := os.Remove(filepath.Join(dir, "memory.events")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ch; !errors.Is(err, ErrDeleted) {
+		t.Fatalf("expected cgroup deletion, got: %v", err)
+	}
+}
+
+func Test_Unified_Threshold_Notifier(t *testing.T) {
+	pollInterval = time.Millisecond
+	defer func() { pollInterval = time.Second }()
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "c")
+	writeTestFiles(t, dir, map[string]string{"memory.current": "100\n"})
+
+	cg := &unified{root: root, path: "/c"}
+	n, err := cg.RegisterMemoryThreshold(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	ch := waitForEvent(t, n)
+	select {
+	case err := <-ch:
+		t.Fatalf("expected no event below the threshold, got: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// replace memory.current at once, as it is never partially written
+	writeTestFiles(t, root, map[string]string{"memory.current": "2000\n"})
+	if err := os.Rename(filepath.Join(root, "memory.current"), filepath.Join(dir, "memory.current")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ch; err != nil {
+		t.Fatalf("expected threshold event, got: %v", err)
+	}
+
+	ch = waitForEvent(t, n)
+	if err := os.Remove(filepath.Join(dir, "memory.current")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ch; !errors.Is(err, ErrDeleted) {
+		t.Fatalf("expected cgroup deletion, got: %v", err)
+	}
+}
+
+func Test_Unified_Memory_Event_Notifier(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "c")
+	writeTestFiles(t, dir, map[string]string{
+		"memory.events": "high 2\nmax 0\noom 0\noom_kill 0\n",
+	})
+
+	cg := &unified{root: root, path: "/c"}
+	n, err := cg.RegisterMemoryEvent(MemoryHigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	ch := waitForEvent(t, n)
+	writeTestFiles(t, dir, map[string]string{"memory.events": "high 2\nmax 1\noom 0\noom_kill 0\n"})
+	select {
+	case err := <-ch:
+		t.Fatalf("expected no event without exceeding memory.high, got: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	writeTestFiles(t, dir, map[string]string{"memory.events": "high 3\nmax 1\noom 0\noom_kill 0\n"})
+	if err := <-ch; err != nil {
+		t.Fatalf("expected memory.high event, got: %v", err)
+	}
+}
+
+func Test_Unified_Pressure_Notifier(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "c")
+	writeTestFiles(t, dir, map[string]string{"memory.pressure": ""})
+
+	cg := &unified{root: root, path: "/c"}
+	n, err := cg.RegisterPressure(PressureTrigger{
+		Resource: "memory",
+		Full:     true,
+		Stall:    150 * time.Millisecond,
+		Window:   time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trigger := readTestFile(t, filepath.Join(dir, "memory.pressure")); trigger != "full 150000 1000000" {
+		t.Fatalf("expected trigger %q, got %q", "full 150000 1000000", trigger)
+	}
+
+	// a regular file never signals pressure, so Wait blocks until Close
+	ch := waitForEvent(t, n)
+	select {
+	case err := <-ch:
+		t.Fatalf("expected no pressure event, got: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ch; !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected closed notifier, got: %v", err)
+	}
+}
+
+func Test_Unified_Pressure_Notifier_Invalid_Trigger(t *testing.T) {
+	cg := &unified{root: t.TempDir(), path: "/c"}
+	for _, trigger := range []PressureTrigger{
+		{Resource: "pids", Stall: time.Millisecond, Window: time.Second},
+		{Resource: "cpu", Stall: time.Millisecond, Window: time.Millisecond},
+		{Resource: "io", Stall: 2 * time.Second, Window: time.Second},
+	} {
+		if _, err := cg.RegisterPressure(trigger); err == nil {
+			t.Fatalf("expected trigger %+v to be invalid", trigger)
+		}
+	}
+}
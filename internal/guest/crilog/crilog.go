@@ -0,0 +1,217 @@
+//go:build linux
+// +build linux
+
+package crilog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// Stdout and Stderr are the streams of a log.
+	Stdout = "stdout"
+	Stderr = "stderr"
+
+	// maxLineSize bounds the lines of a log, as longer lines are split into
+	// partial lines, like containerd does.
+	maxLineSize = 16 * 1024
+
+	tagPartial = 'P'
+	tagFull    = 'F'
+)
+
+// Options are the options of a Logger.
+type Options struct {
+	// MaxSize is the size in bytes at which the log file is rotated. The log
+	// is not rotated if it is zero.
+	MaxSize int64
+	// MaxFiles is the number of files of a rotated log which are kept,
+	// including the current one. It must be at least 2 if MaxSize is set.
+	MaxFiles int
+}
+
+// Logger writes the streams of a container to a file in the CRI log format.
+//
+// Once the file reaches its maximum size, it is rotated: the file `path` is
+// renamed `path.1`, and older files `path.N` are renamed `path.N+1`, dropping
+// the oldest.
+type Logger struct {
+	path string
+	opts Options
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	// now is the clock of the timestamps, which is replaced in tests.
+	now func() time.Time
+}
+
+// New returns a Logger writing to the file `path`, which is appended to if it
+// exists.
+func New(path string, opts Options) (*Logger, error) {
+	if opts.MaxSize < 0 || (opts.MaxSize > 0 && opts.MaxFiles < 2) {
+		return nil, fmt.Errorf("invalid log rotation of %d bytes and %d files", opts.MaxSize, opts.MaxFiles)
+	}
+	l := &Logger{
+		path: path,
+		opts: opts,
+		now:  time.Now,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	// don't use [os.Create] since that truncates an existing file
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	l.f = f
+	l.size = fi.Size()
+	return nil
+}
+
+// Close closes the log file. The streams of the Logger should be closed first,
+// so that their partial lines are written.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Stream returns a writer of the stream `stream` of the log, such as Stdout.
+// Its output is written as a line at each newline, or as partial lines if it
+// exceeds the maximum line size. Closing it writes the last line, if it did
+// not end with a newline.
+//
+// A stream must not be written to concurrently, but the streams of a Logger
+// can be.
+func (l *Logger) Stream(stream string) io.WriteCloser {
+	return &streamWriter{l: l, stream: stream}
+}
+
+// writeLine writes the line `b` of the stream, tagged as partial or full.
+func (l *Logger) writeLine(stream string, tag byte, b []byte) error {
+	var buf bytes.Buffer
+	buf.Grow(len(time.RFC3339Nano) + len(stream) + len(b) + 5)
+	buf.WriteString(l.now().UTC().Format(time.RFC3339Nano))
+	buf.WriteByte(' ')
+	buf.WriteString(stream)
+	buf.WriteByte(' ')
+	buf.WriteByte(tag)
+	buf.WriteByte(' ')
+	buf.Write(b)
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return os.ErrClosed
+	}
+	if l.opts.MaxSize > 0 && l.size > 0 && l.size+int64(buf.Len()) > l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(buf.Bytes())
+	l.size += int64(n)
+	return err
+}
+
+// rotate renames the log files and opens a new one. It must be called with
+// the mutex held.
+func (l *Logger) rotate() error {
+	err := l.f.Close()
+	l.f = nil
+	if err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	for i := l.opts.MaxFiles - 1; i > 0; i-- {
+		src := l.path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", l.path, i-1)
+		}
+		// renaming replaces the oldest file
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", l.path, i)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	return l.open()
+}
+
+type streamWriter struct {
+	l      *Logger
+	stream string
+	// buf is the output since the last line was written.
+	buf []byte
+}
+
+var _ io.WriteCloser = &streamWriter{}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			break
+		}
+		line := p[:i]
+		if len(w.buf) > 0 {
+			line = append(w.buf, line...)
+			w.buf = w.buf[:0]
+		}
+		if err := w.writeFull(line); err != nil {
+			return 0, err
+		}
+		p = p[i+1:]
+	}
+	for len(w.buf) >= maxLineSize {
+		if err := w.l.writeLine(w.stream, tagPartial, w.buf[:maxLineSize]); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[maxLineSize:]...)
+	}
+	return n, nil
+}
+
+// writeFull writes the full line `line`, which is split into partial lines
+// followed by a full line if it exceeds the maximum line size.
+func (w *streamWriter) writeFull(line []byte) error {
+	for len(line) > maxLineSize {
+		if err := w.l.writeLine(w.stream, tagPartial, line[:maxLineSize]); err != nil {
+			return err
+		}
+		line = line[maxLineSize:]
+	}
+	return w.l.writeLine(w.stream, tagFull, line)
+}
+
+// Close writes the last line of the stream, if it did not end with a newline.
+func (w *streamWriter) Close() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := w.buf
+	w.buf = nil
+	return w.writeFull(line)
+}
@@ -0,0 +1,119 @@
+//go:build linux
+// +build linux
+
+package crilog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(t *testing.T, opts Options) (*Logger, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "container.log")
+	l, err := New(path, opts)
+	if err != nil {
+		t.Fatalf("failed to create logger: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	l.now = func() time.Time { return ts }
+	return l, path
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read log: %s", err)
+	}
+	return string(b)
+}
+
+func Test_Logger_Lines(t *testing.T) {
+	l, path := newTestLogger(t, Options{})
+	stdout, stderr := l.Stream(Stdout), l.Stream(Stderr)
+
+	for _, s := range []string{"hello ", "world\nsecond", " line\n\n", "unterminated"} {
+		if _, err := stdout.Write([]byte(s)); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+	if _, err := stderr.Write([]byte("error\n")); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := stdout.Close(); err != nil {
+		t.Fatalf("failed to close stream: %s", err)
+	}
+
+	expected := "2024-01-02T03:04:05.000000006Z stdout F hello world\n" +
+		"2024-01-02T03:04:05.000000006Z stdout F second line\n" +
+		"2024-01-02T03:04:05.000000006Z stdout F \n" +
+		"2024-01-02T03:04:05.000000006Z stderr F error\n" +
+		"2024-01-02T03:04:05.000000006Z stdout F unterminated\n"
+	if got := readLog(t, path); got != expected {
+		t.Fatalf("expected log:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func Test_Logger_Partial_Lines(t *testing.T) {
+	l, path := newTestLogger(t, Options{})
+	stdout := l.Stream(Stdout)
+
+	long := strings.Repeat("a", maxLineSize) + strings.Repeat("b", 10)
+	if _, err := stdout.Write([]byte(long + "\n")); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	// a long line without a newline is written once it exceeds the maximum
+	if _, err := stdout.Write([]byte(strings.Repeat("c", maxLineSize+1))); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(readLog(t, path), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	for i, prefix := range []string{"stdout P aaa", "stdout F bbbbbbbbbb", "stdout P ccc"} {
+		if fields := strings.SplitN(lines[i], " ", 2); !strings.HasPrefix(fields[1], prefix) {
+			t.Fatalf("expected line %d to start with %q, got %q", i, prefix, fields[1])
+		}
+	}
+}
+
+func Test_Logger_Rotation(t *testing.T) {
+	line := "2024-01-02T03:04:05.000000006Z stdout F 0123456789\n"
+	// two lines fit in a file
+	l, path := newTestLogger(t, Options{MaxSize: int64(2 * len(line)), MaxFiles: 3})
+	stdout := l.Stream(Stdout)
+
+	for i := 0; i < 7; i++ {
+		if _, err := stdout.Write([]byte("0123456789\n")); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+
+	for _, f := range []struct {
+		name  string
+		lines int
+	}{
+		{"container.log", 1},
+		{"container.log.1", 2},
+		{"container.log.2", 2},
+	} {
+		if got := readLog(t, filepath.Join(filepath.Dir(path), f.name)); got != strings.Repeat(line, f.lines) {
+			t.Fatalf("expected %d lines in %s, got %q", f.lines, f.name, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected oldest file to be dropped: %v", err)
+	}
+}
+
+func Test_Logger_Invalid_Rotation(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "container.log"), Options{MaxSize: 1024, MaxFiles: 1}); err == nil {
+		t.Fatal("expected rotation without a rotated file to fail")
+	}
+}
@@ -0,0 +1,5 @@
+// Package crilog writes the stdio of containers to files in the CRI log
+// format, which the kubelet and crictl read: each line of output is written
+// as a line prefixed by its timestamp, its stream and whether it is a partial
+// line, and the files are rotated by size.
+package crilog
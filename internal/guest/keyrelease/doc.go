@@ -0,0 +1,5 @@
+// Package keyrelease implements the guest side of attested key release: the
+// guest proves to a key broker, with an attestation report, that it runs the
+// expected UVM, and in return the broker releases a key wrapped to a key pair
+// which only the guest holds.
+package keyrelease
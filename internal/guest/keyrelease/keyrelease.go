@@ -0,0 +1,200 @@
+package keyrelease
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Microsoft/hcsshim/pkg/attestation"
+)
+
+// ReleasePath is the path of the endpoint of the key broker which releases
+// keys.
+const ReleasePath = "/release"
+
+// wrappingKeyBits is the size of the RSA key pair to which released keys are
+// wrapped. It is generated for each request and never leaves the guest.
+const wrappingKeyBits = 3072
+
+// maxResponseSize bounds the response of the key broker.
+const maxResponseSize = 1 << 20
+
+// ReleaseRequest is the request which the guest sends to the key broker.
+type ReleaseRequest struct {
+	// KeyID is the ID of the requested key.
+	KeyID string `json:"key_id"`
+	// EvidenceFormat is the format of Evidence.
+	EvidenceFormat attestation.EvidenceFormat `json:"evidence_format"`
+	// Evidence is the attestation report of the guest, whose report data is
+	// the SHA-256 digest of WrappingKey.
+	Evidence []byte `json:"evidence"`
+	// WrappingKey is the DER encoded PKIX public key to which the broker wraps
+	// the key, with RSA-OAEP and SHA-256.
+	WrappingKey []byte `json:"wrapping_key"`
+}
+
+// ReleaseResponse is the response of the key broker.
+type ReleaseResponse struct {
+	// WrappedKey is the key, wrapped to the WrappingKey of the request.
+	WrappedKey []byte `json:"wrapped_key"`
+	// Signature is the ASN.1 encoded ECDSA signature of the broker over the
+	// ResponseDigest of the request and WrappedKey.
+	Signature []byte `json:"signature"`
+}
+
+// Client releases keys from a key broker.
+type Client struct {
+	endpoint   string
+	brokerKey  *ecdsa.PublicKey
+	provider   attestation.Provider
+	httpClient *http.Client
+}
+
+// NewClient returns a client of the key broker at `endpoint`, which attests
+// the guest with reports of `provider`. Responses must be signed with the
+// private key of `brokerKey`, as the connection to the broker is not trusted.
+func NewClient(endpoint string, brokerKey *ecdsa.PublicKey, provider attestation.Provider) *Client {
+	return &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		brokerKey:  brokerKey,
+		provider:   provider,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// ReleaseKey requests the key `keyID` from the key broker and unwraps it.
+func (c *Client) ReleaseKey(ctx context.Context, keyID string) ([]byte, error) {
+	if c.brokerKey == nil {
+		return nil, fmt.Errorf("cannot release key %q: the key of the broker is not known", keyID)
+	}
+
+	wrappingKey, err := rsa.GenerateKey(rand.Reader, wrappingKeyBits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate wrapping key: %w", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&wrappingKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	reportData := WrappingKeyDigest(publicKey)
+	evidence, err := c.provider.Report(reportData[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attestation report: %w", err)
+	}
+
+	body, err := json.Marshal(&ReleaseRequest{
+		KeyID:          keyID,
+		EvidenceFormat: evidence.Format,
+		Evidence:       evidence.Raw,
+		WrappingKey:    publicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+ReleasePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request key %q: %w", keyID, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of key broker: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key broker refused to release key %q: %s: %s",
+			keyID, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	var released ReleaseResponse
+	if err := json.Unmarshal(respBody, &released); err != nil {
+		return nil, fmt.Errorf("failed to parse response of key broker: %w", err)
+	}
+
+	// Otherwise, anyone on the path to the broker could have the guest use a
+	// key of their choosing, by wrapping it to the wrapping key.
+	digest := ResponseDigest(keyID, evidence.Raw, released.WrappedKey)
+	if !ecdsa.VerifyASN1(c.brokerKey, digest[:], released.Signature) {
+		return nil, fmt.Errorf("response of key broker for key %q is not signed by the broker", keyID)
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, wrappingKey, released.WrappedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key %q: %w", keyID, err)
+	}
+	return key, nil
+}
+
+// WrappingKeyDigest returns the report data which binds the wrapping key to
+// the attestation report.
+func WrappingKeyDigest(wrappingKey []byte) [sha256.Size]byte {
+	return sha256.Sum256(wrappingKey)
+}
+
+// ResponseDigest returns the digest which the key broker signs to release the
+// wrapped key `keyID`, which binds the wrapped key to the evidence of the
+// request, and so to the wrapping key.
+func ResponseDigest(keyID string, evidence, wrappedKey []byte) [sha512.Size384]byte {
+	h := sha512.New384()
+	for _, field := range [][]byte{[]byte(keyID), evidence, wrappedKey} {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(field)))
+		h.Write(length[:])
+		h.Write(field)
+	}
+	var digest [sha512.Size384]byte
+	copy(digest[:], h.Sum(nil))
+	return digest
+}
+
+// ParseBrokerKey parses the PEM encoded PKIX public key with which a key broker
+// signs its responses.
+func ParseBrokerKey(data []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("key of the key broker is not a PEM encoded public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key of the key broker: %w", err)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key of the key broker is not an ECDSA key")
+	}
+	return key, nil
+}
+
+// wrapKey wraps the key to the DER encoded PKIX public key.
+func wrapKey(key []byte, wrappingKey []byte) ([]byte, error) {
+	pub, err := x509.ParsePKIXPublicKey(wrappingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse wrapping key: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("wrapping key is not an RSA key")
+	}
+	return rsa.EncryptOAEP(crypto.SHA256.New(), rand.Reader, rsaPub, key, nil)
+}
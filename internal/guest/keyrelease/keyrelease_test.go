@@ -0,0 +1,105 @@
+package keyrelease
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Microsoft/hcsshim/pkg/attestation"
+)
+
+func newSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func Test_ReleaseKey(t *testing.T) {
+	hostData := bytes.Repeat([]byte{1}, 32)
+	key := []byte("0123456789abcdef0123456789abcdef")
+	signingKey := newSigningKey(t)
+
+	broker := httptest.NewServer(&StandInBroker{
+		Keys:       map[string][]byte{"scratch": key},
+		HostData:   hostData,
+		SigningKey: signingKey,
+	})
+	defer broker.Close()
+
+	client := NewClient(broker.URL, &signingKey.PublicKey, attestation.NewFakeProvider(hostData))
+	released, err := client.ReleaseKey(context.Background(), "scratch")
+	if err != nil {
+		t.Fatalf("failed to release key: %s", err)
+	}
+	if !bytes.Equal(released, key) {
+		t.Fatalf("expected key %q, got %q", key, released)
+	}
+
+	_, err = client.ReleaseKey(context.Background(), "unknown")
+	if err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Fatalf("expected unknown key to be refused, got: %v", err)
+	}
+}
+
+func Test_ReleaseKey_HostData(t *testing.T) {
+	signingKey := newSigningKey(t)
+	broker := httptest.NewServer(&StandInBroker{
+		Keys:       map[string][]byte{"scratch": []byte("key")},
+		HostData:   bytes.Repeat([]byte{1}, 32),
+		SigningKey: signingKey,
+	})
+	defer broker.Close()
+
+	client := NewClient(broker.URL, &signingKey.PublicKey, attestation.NewFakeProvider(bytes.Repeat([]byte{2}, 32)))
+	if _, err := client.ReleaseKey(context.Background(), "scratch"); err == nil {
+		t.Fatal("expected key not to be released to a guest with other HostData")
+	}
+}
+
+// Test_ReleaseKey_OtherBroker checks that keys are not accepted from a broker
+// other than the expected one, which can wrap any key to the wrapping key.
+func Test_ReleaseKey_OtherBroker(t *testing.T) {
+	broker := httptest.NewServer(&StandInBroker{
+		Keys:       map[string][]byte{"scratch": []byte("key")},
+		SigningKey: newSigningKey(t),
+	})
+	defer broker.Close()
+
+	client := NewClient(broker.URL, &newSigningKey(t).PublicKey, attestation.NewFakeProvider(nil))
+	_, err := client.ReleaseKey(context.Background(), "scratch")
+	if err == nil || !strings.Contains(err.Error(), "is not signed by the broker") {
+		t.Fatalf("expected response of other broker to be refused, got: %v", err)
+	}
+
+	client = NewClient(broker.URL, nil, attestation.NewFakeProvider(nil))
+	if _, err := client.ReleaseKey(context.Background(), "scratch"); err == nil {
+		t.Fatal("expected key not to be released without the key of the broker")
+	}
+}
+
+func Test_StandInBroker_WrappingKeyBinding(t *testing.T) {
+	broker := &StandInBroker{Keys: map[string][]byte{"scratch": []byte("key")}}
+
+	// evidence whose report data is not the digest of the wrapping key
+	evidence, err := attestation.NewFakeProvider(nil).Report([]byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = broker.release(&ReleaseRequest{
+		KeyID:          "scratch",
+		EvidenceFormat: evidence.Format,
+		Evidence:       evidence.Raw,
+		WrappingKey:    []byte("wrapping key"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "does not bind the wrapping key") {
+		t.Fatalf("expected evidence for another wrapping key to be refused, got: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package keyrelease
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Microsoft/hcsshim/pkg/amdsevsnp"
+	"github.com/Microsoft/hcsshim/pkg/attestation"
+)
+
+// StandInBroker is a local stand-in for a key broker, for tests and
+// development. It checks that the evidence binds the wrapping key and, when
+// set, HostData, but it does NOT verify the signature of the evidence, and so
+// must never hold keys which protect real data.
+type StandInBroker struct {
+	// Keys are the keys which the broker releases, by ID.
+	Keys map[string][]byte
+	// HostData is the HostData which the evidence must have, if set.
+	HostData []byte
+	// SigningKey is the key with which the broker signs its responses.
+	SigningKey *ecdsa.PrivateKey
+}
+
+var _ http.Handler = &StandInBroker{}
+
+func (b *StandInBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != ReleasePath {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req ReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wrapped, err := b.release(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	digest := ResponseDigest(req.KeyID, req.Evidence, wrapped)
+	signature, err := ecdsa.SignASN1(rand.Reader, b.SigningKey, digest[:])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&ReleaseResponse{WrappedKey: wrapped, Signature: signature})
+}
+
+func (b *StandInBroker) release(req *ReleaseRequest) ([]byte, error) {
+	key, ok := b.Keys[req.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", req.KeyID)
+	}
+
+	// the fake provider lays out its reports as SEV-SNP reports
+	if req.EvidenceFormat != attestation.EvidenceFormatSNP && req.EvidenceFormat != attestation.EvidenceFormatFake {
+		return nil, fmt.Errorf("unsupported evidence format %q", req.EvidenceFormat)
+	}
+	report, err := amdsevsnp.ParseReport(req.Evidence)
+	if err != nil {
+		return nil, fmt.Errorf("invalid evidence: %w", err)
+	}
+
+	reportData, err := hex.DecodeString(report.ReportData)
+	if err != nil {
+		return nil, err
+	}
+	digest := WrappingKeyDigest(req.WrappingKey)
+	if !bytes.HasPrefix(reportData, digest[:]) {
+		return nil, fmt.Errorf("evidence does not bind the wrapping key")
+	}
+	if b.HostData != nil && !bytes.Equal(b.HostData, report.HostData) {
+		return nil, fmt.Errorf("evidence has unexpected HostData %x", report.HostData)
+	}
+
+	return wrapKey(key, req.WrappingKey)
+}
@@ -6,6 +6,7 @@ package prot
 import (
 	"encoding/json"
 	"strconv"
+	"time"
 
 	v1 "github.com/containerd/cgroups/v3/cgroup1/stats"
 	oci "github.com/opencontainers/runtime-spec/specs-go"
@@ -107,6 +108,24 @@ const (
 	ComputeSystemDumpStacksV1 = 0x10100c01
 	// ComputeSystemDeleteContainerStateV1 is the delete container request.
 	ComputeSystemDeleteContainerStateV1 = 0x10100d01
+	// ComputeSystemPauseV1 is the pause container request. 0x10100e01 and
+	// 0x10100f01 are used by the host for requests which the GCS does not
+	// handle.
+	ComputeSystemPauseV1 = 0x10101001
+	// ComputeSystemResumeV1 is the resume container request.
+	ComputeSystemResumeV1 = 0x10101101
+	// ComputeSystemCheckpointV1 is the checkpoint container request.
+	ComputeSystemCheckpointV1 = 0x10101201
+	// ComputeSystemCopyToContainerV1 is the copy files into container request.
+	ComputeSystemCopyToContainerV1 = 0x10101301
+	// ComputeSystemCopyFromContainerV1 is the copy files out of container
+	// request.
+	ComputeSystemCopyFromContainerV1 = 0x10101401
+	// ComputeSystemSubscribeEventsV1 is the subscribe to container events
+	// request.
+	ComputeSystemSubscribeEventsV1 = 0x10101501
+	// ComputeSystemAttachProcessV1 is the attach to process stdio request.
+	ComputeSystemAttachProcessV1 = 0x10101601
 
 	// ComputeSystemResponseCreateV1 is the create container response.
 	ComputeSystemResponseCreateV1 = 0x20100101
@@ -137,9 +156,31 @@ const (
 	ComputeSystemResponseNegotiateProtocolV1 = 0x20100b01
 	// ComputeSystemResponseDumpStacksV1 is the dump stack response
 	ComputeSystemResponseDumpStacksV1 = 0x20100c01
+	// ComputeSystemResponsePauseV1 is the pause container response.
+	ComputeSystemResponsePauseV1 = 0x20101001
+	// ComputeSystemResponseResumeV1 is the resume container response.
+	ComputeSystemResponseResumeV1 = 0x20101101
+	// ComputeSystemResponseCheckpointV1 is the checkpoint container response.
+	ComputeSystemResponseCheckpointV1 = 0x20101201
+	// ComputeSystemResponseCopyToContainerV1 is the copy files into container
+	// response.
+	ComputeSystemResponseCopyToContainerV1 = 0x20101301
+	// ComputeSystemResponseCopyFromContainerV1 is the copy files out of
+	// container response.
+	ComputeSystemResponseCopyFromContainerV1 = 0x20101401
+	// ComputeSystemResponseSubscribeEventsV1 is the subscribe to container
+	// events response.
+	ComputeSystemResponseSubscribeEventsV1 = 0x20101501
+	// ComputeSystemResponseAttachProcessV1 is the attach to process stdio
+	// response.
+	ComputeSystemResponseAttachProcessV1 = 0x20101601
 
 	// ComputeSystemNotificationV1 is the notification identifier.
 	ComputeSystemNotificationV1 = 0x30100101
+	// ComputeSystemEventNotificationV1 is the container event notification
+	// identifier, which is only sent to a host which subscribed to the events
+	// of the container.
+	ComputeSystemEventNotificationV1 = 0x30100201
 )
 
 // String returns the string representation of the message identifier.
@@ -173,6 +214,20 @@ func (mi MessageIdentifier) String() string {
 		return "ComputeSystemDumpStacksV1"
 	case ComputeSystemDeleteContainerStateV1:
 		return "ComputeSystemDeleteContainerStateV1"
+	case ComputeSystemPauseV1:
+		return "ComputeSystemPauseV1"
+	case ComputeSystemResumeV1:
+		return "ComputeSystemResumeV1"
+	case ComputeSystemCheckpointV1:
+		return "ComputeSystemCheckpointV1"
+	case ComputeSystemCopyToContainerV1:
+		return "ComputeSystemCopyToContainerV1"
+	case ComputeSystemCopyFromContainerV1:
+		return "ComputeSystemCopyFromContainerV1"
+	case ComputeSystemSubscribeEventsV1:
+		return "ComputeSystemSubscribeEventsV1"
+	case ComputeSystemAttachProcessV1:
+		return "ComputeSystemAttachProcessV1"
 	case ComputeSystemResponseCreateV1:
 		return "ComputeSystemResponseCreateV1"
 	case ComputeSystemResponseStartV1:
@@ -197,8 +252,24 @@ func (mi MessageIdentifier) String() string {
 		return "ComputeSystemResponseNegotiateProtocolV1"
 	case ComputeSystemResponseDumpStacksV1:
 		return "ComputeSystemResponseDumpStacksV1"
+	case ComputeSystemResponsePauseV1:
+		return "ComputeSystemResponsePauseV1"
+	case ComputeSystemResponseResumeV1:
+		return "ComputeSystemResponseResumeV1"
+	case ComputeSystemResponseCheckpointV1:
+		return "ComputeSystemResponseCheckpointV1"
+	case ComputeSystemResponseCopyToContainerV1:
+		return "ComputeSystemResponseCopyToContainerV1"
+	case ComputeSystemResponseCopyFromContainerV1:
+		return "ComputeSystemResponseCopyFromContainerV1"
+	case ComputeSystemResponseSubscribeEventsV1:
+		return "ComputeSystemResponseSubscribeEventsV1"
+	case ComputeSystemResponseAttachProcessV1:
+		return "ComputeSystemResponseAttachProcessV1"
 	case ComputeSystemNotificationV1:
 		return "ComputeSystemNotificationV1"
+	case ComputeSystemEventNotificationV1:
+		return "ComputeSystemEventNotificationV1"
 	default:
 		return strconv.FormatUint(uint64(mi), 10)
 	}
@@ -274,6 +345,11 @@ type GcsGuestCapabilities struct {
 	SignalProcessSupported        bool `json:",omitempty"`
 	DumpStacksSupported           bool `json:",omitempty"`
 	DeleteContainerStateSupported bool `json:",omitempty"`
+	PauseResumeSupported          bool `json:",omitempty"`
+	CheckpointRestoreSupported    bool `json:",omitempty"`
+	CopyFilesSupported            bool `json:",omitempty"`
+	EventNotificationsSupported   bool `json:",omitempty"`
+	AttachProcessSupported        bool `json:",omitempty"`
 }
 
 // ocspancontext is the internal JSON representation of the OpenCensus
@@ -391,6 +467,113 @@ type ContainerNotification struct {
 	ResultInfo string `json:",omitempty"`
 }
 
+// EventType defines a type of container event to be sent to the HCS.
+type EventType string
+
+const (
+	// EtOOMKill indicates that a process of the container was killed by the
+	// OOM killer.
+	EtOOMKill = EventType("OOMKill")
+	// EtMemoryHigh indicates that the memory usage of the container exceeded
+	// its high limit, and was throttled.
+	EtMemoryHigh = EventType("MemoryHigh")
+	// EtMemoryMax indicates that the memory usage of the container reached its
+	// max limit.
+	EtMemoryMax = EventType("MemoryMax")
+	// EtPressure indicates that the pressure stall of a resource of the
+	// container exceeded a trigger of the subscription.
+	EtPressure = EventType("Pressure")
+	// EtMetrics carries the periodic metrics of the container.
+	EtMetrics = EventType("Metrics")
+)
+
+// PressureTrigger is a threshold of the pressure stall of a resource of a
+// container: the time in which some, or all if Full, of its tasks were stalled
+// on the resource within a window of time.
+type PressureTrigger struct {
+	// Resource is "cpu", "memory" or "io".
+	Resource string
+	Full     bool `json:",omitempty"`
+	// StallInUs is the stalled time in microseconds.
+	StallInUs uint64
+	// WindowInUs is the window in microseconds, between 500ms and 10s.
+	WindowInUs uint64
+}
+
+// ContainerSubscribeEvents is the message from the HCS subscribing to the
+// events of the container, which the GCS pushes as ContainerEvent
+// notifications until the container exits. A subscription replaces any
+// previous one of the container, and one without events cancels it.
+type ContainerSubscribeEvents struct {
+	MessageBase
+	// MemoryEvents subscribes to OOM kills, and to the memory usage of the
+	// container exceeding its high and max limits. Only OOM kills are sent by
+	// guests on the legacy cgroup hierarchy.
+	MemoryEvents bool `json:",omitempty"`
+	// PressureTriggers subscribes to the pressure stall of the resources of
+	// the container exceeding each trigger. They require the unified cgroup
+	// hierarchy.
+	PressureTriggers []PressureTrigger `json:",omitempty"`
+	// MetricsIntervalInMs subscribes to the metrics of the container at the
+	// interval, which must be at least a second, if set.
+	MetricsIntervalInMs uint32 `json:",omitempty"`
+}
+
+// ContainerEvent is a notification from the GCS to the HCS of an event of a
+// container to which the HCS subscribed.
+type ContainerEvent struct {
+	MessageBase
+	Type EventType
+	// Timestamp is the time of the event in the guest.
+	Timestamp time.Time
+	// Trigger is the trigger of an EtPressure event.
+	Trigger *PressureTrigger `json:",omitempty"`
+	// Metrics are the metrics of an EtMetrics event.
+	Metrics *v1.Metrics `json:",omitempty"`
+	// Pressure is the pressure stall information of an EtMetrics event, which
+	// is only sent by guests on the unified cgroup hierarchy.
+	Pressure *PressureStats `json:",omitempty"`
+	// MemoryEvents are the counts of the memory events of an EtMetrics event,
+	// which are only sent by guests on the unified cgroup hierarchy.
+	MemoryEvents *MemoryEventStats `json:",omitempty"`
+}
+
+// PressureStats is the pressure stall information of a container for each
+// resource.
+type PressureStats struct {
+	CPU    *Pressure `json:",omitempty"`
+	Memory *Pressure `json:",omitempty"`
+	IO     *Pressure `json:",omitempty"`
+}
+
+// Pressure is the share of time in which some or all of the tasks of a
+// container were stalled on a resource.
+type Pressure struct {
+	Some *PressureData `json:",omitempty"`
+	Full *PressureData `json:",omitempty"`
+}
+
+// PressureData are the averages of the share of stalled time, in percent, over
+// the last 10, 60 and 300 seconds, and the total stalled time.
+type PressureData struct {
+	Avg10     float64
+	Avg60     float64
+	Avg300    float64
+	TotalInUs uint64
+}
+
+// MemoryEventStats are the counts of the memory events of a container: the
+// times it was reclaimed under its low boundary, throttled over its high
+// limit, about to exceed its max limit and out of memory, and the processes
+// killed by the OOM killer.
+type MemoryEventStats struct {
+	Low     uint64
+	High    uint64
+	Max     uint64
+	OOM     uint64
+	OOMKill uint64
+}
+
 // ExecuteProcessVsockStdioRelaySettings defines the port numbers for each
 // stdio socket for a process.
 type ExecuteProcessVsockStdioRelaySettings struct {
@@ -413,6 +596,20 @@ type ContainerExecuteProcess struct {
 	Settings ExecuteProcessSettings
 }
 
+// ContainerAttachProcess is the message from the HCS specifying to attach new
+// stdio sockets to a running process of the container, such as after the HCS
+// reconnects to the GCS. The output of the process which was not relayed while
+// no socket was attached is replayed to the new ones, and the sockets of any
+// previous attach keep relaying until they fail.
+type ContainerAttachProcess struct {
+	MessageBase
+	ProcessID               uint32 `json:"ProcessId"`
+	CreateStdInPipe         bool   `json:",omitempty"`
+	CreateStdOutPipe        bool   `json:",omitempty"`
+	CreateStdErrPipe        bool   `json:",omitempty"`
+	VsockStdioRelaySettings ExecuteProcessVsockStdioRelaySettings
+}
+
 // ContainerResizeConsole is the message from the HCS specifying to change the
 // console size for the given process.
 type ContainerResizeConsole struct {
@@ -443,6 +640,39 @@ type ContainerSignalProcess struct {
 	Options   SignalProcessOptions `json:",omitempty"`
 }
 
+// ContainerCheckpoint is the message from the HCS specifying to checkpoint
+// the container with CRIU.
+type ContainerCheckpoint struct {
+	MessageBase
+	// ImagePath is the directory in the UVM to write the checkpoint image to,
+	// on a SCSI disk or a directory mapped into the UVM by the host.
+	ImagePath string
+	// LeaveRunning keeps the container running once it is checkpointed,
+	// rather than stopping it.
+	LeaveRunning bool `json:",omitempty"`
+	// TCPEstablished checkpoints the established TCP connections of the
+	// container.
+	TCPEstablished bool `json:",omitempty"`
+}
+
+// ContainerCopy is the message from the HCS specifying to copy files into or
+// out of the root filesystem of the container, as a tar archive streamed over
+// a vsock port.
+type ContainerCopy struct {
+	MessageBase
+	// Path is the absolute path in the container, as seen from its mount
+	// namespace. Files copied into the container are extracted into the
+	// directory at Path, while those copied out of it are archived from the
+	// file or directory at Path.
+	Path string
+	// Port is the vsock port on which the host listens for the connection
+	// which streams the archive.
+	Port uint32
+	// PreserveOwnership keeps the owners recorded in the archive for the files
+	// copied into the container, rather than the user of the container.
+	PreserveOwnership bool `json:",omitempty"`
+}
+
 // ContainerGetProperties is the message from the HCS requesting certain
 // properties of the container, such as a list of its processes.
 type ContainerGetProperties struct {
@@ -479,6 +709,12 @@ const (
 	PtMappedPipe = PropertyType("MappedPipe")
 	// PtMappedVirtualDisk is the property type for mapped virtual disks
 	PtMappedVirtualDisk = PropertyType("MappedVirtualDisk")
+	// PtPolicyFragments is the property type for the security policy fragments
+	// loaded in the UVM
+	PtPolicyFragments = PropertyType("PolicyFragments")
+	// PtState is the property type for the state of a container, such as
+	// whether it is paused
+	PtState = PropertyType("State")
 )
 
 // RequestType is the type of operation to perform on a given property type.
@@ -564,6 +800,12 @@ func UnmarshalContainerModifySettings(b []byte) (*containerModifySettings, error
 			return &request, errors.Wrap(err, "failed to unmarshal settings as CombinedLayersV2")
 		}
 		msr.Settings = cl
+	case guestresource.ResourceTypeGuestPulledImage:
+		gpi := &guestresource.LCOWGuestPulledImage{}
+		if err := commonutils.UnmarshalJSONWithHresult(msrRawSettings, gpi); err != nil {
+			return &request, errors.Wrap(err, "failed to unmarshal settings as GuestPulledImage")
+		}
+		msr.Settings = gpi
 	case guestresource.ResourceTypeNetwork:
 		na := &guestresource.LCOWNetworkAdapter{}
 		if err := commonutils.UnmarshalJSONWithHresult(msrRawSettings, na); err != nil {
@@ -594,6 +836,30 @@ func UnmarshalContainerModifySettings(b []byte) (*containerModifySettings, error
 			return &request, errors.Wrap(err, "failed to unmarshal settings as SecurityPolicyFragment")
 		}
 		msr.Settings = fragment
+	case guestresource.ResourceTypePolicyFragmentReplace:
+		fragment := &guestresource.SecurityPolicyFragment{}
+		if err := commonutils.UnmarshalJSONWithHresult(msrRawSettings, fragment); err != nil {
+			return &request, errors.Wrap(err, "failed to unmarshal settings as SecurityPolicyFragment")
+		}
+		msr.Settings = fragment
+	case guestresource.ResourceTypePolicyFragmentRevoke:
+		revocation := &guestresource.SecurityPolicyFragmentRevocation{}
+		if err := commonutils.UnmarshalJSONWithHresult(msrRawSettings, revocation); err != nil {
+			return &request, errors.Wrap(err, "failed to unmarshal settings as SecurityPolicyFragmentRevocation")
+		}
+		msr.Settings = revocation
+	case guestresource.ResourceTypePolicyFragmentMinimumSVN:
+		minimumSVN := &guestresource.SecurityPolicyFragmentMinimumSVN{}
+		if err := commonutils.UnmarshalJSONWithHresult(msrRawSettings, minimumSVN); err != nil {
+			return &request, errors.Wrap(err, "failed to unmarshal settings as SecurityPolicyFragmentMinimumSVN")
+		}
+		msr.Settings = minimumSVN
+	case guestresource.ResourceTypeSecurityPolicyReplace:
+		policy := &guestresource.SignedSecurityPolicy{}
+		if err := commonutils.UnmarshalJSONWithHresult(msrRawSettings, policy); err != nil {
+			return &request, errors.Wrap(err, "failed to unmarshal settings as SignedSecurityPolicy")
+		}
+		msr.Settings = policy
 	default:
 		return &request, errors.Errorf("invalid ResourceType '%s'", msr.ResourceType)
 	}
@@ -751,6 +1017,14 @@ type VMHostedContainerSettingsV2 struct {
 	// VHD is mounted inside the UVM. But in case of scratch sharing this is a
 	// directory under the UVM scratch directory.
 	ScratchDirPath string
+	// CheckpointImagePath is the directory in the UVM of a checkpoint image
+	// of the container, written by a checkpoint request. If set, the
+	// container is restored from the image rather than created, and is
+	// running already when it is started.
+	CheckpointImagePath string `json:",omitempty"`
+	// TCPEstablished restores the established TCP connections of the
+	// checkpoint image.
+	TCPEstablished bool `json:",omitempty"`
 }
 
 // ProcessParameters represents any process which may be started in the utility
@@ -812,6 +1086,30 @@ type Properties struct {
 }
 
 type PropertiesV2 struct {
-	ProcessList []ProcessDetails `json:"ProcessList,omitempty"`
-	Metrics     *v1.Metrics      `json:"LCOWMetrics,omitempty"`
+	ProcessList     []ProcessDetails `json:"ProcessList,omitempty"`
+	Metrics         *v1.Metrics      `json:"LCOWMetrics,omitempty"`
+	PolicyFragments []PolicyFragment `json:"PolicyFragments,omitempty"`
+	State           ContainerState   `json:"State,omitempty"`
+}
+
+// ContainerState is the state of a container reported in its properties.
+type ContainerState string
+
+const (
+	// StateCreated is the state of a container which has not been started.
+	StateCreated = ContainerState("Created")
+	// StateRunning is the state of a started container.
+	StateRunning = ContainerState("Running")
+	// StatePaused is the state of a container whose processes are frozen.
+	StatePaused = ContainerState("Paused")
+	// StateStopped is the state of a container whose init process exited.
+	StateStopped = ContainerState("Stopped")
+)
+
+// PolicyFragment describes a security policy fragment loaded in the UVM.
+type PolicyFragment struct {
+	Issuer    string `json:"Issuer"`
+	Feed      string `json:"Feed"`
+	SVN       string `json:"SVN"`
+	Namespace string `json:"Namespace,omitempty"`
 }
@@ -11,7 +11,6 @@ import (
 	"sync/atomic"
 	"syscall"
 
-	cgroups "github.com/containerd/cgroups/v3/cgroup1"
 	v1 "github.com/containerd/cgroups/v3/cgroup1/stats"
 	oci "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
@@ -19,6 +18,8 @@ import (
 	"go.opencensus.io/trace"
 
 	"github.com/Microsoft/hcsshim/internal/bridgeutils/gcserr"
+	"github.com/Microsoft/hcsshim/internal/guest/cgroup"
+	"github.com/Microsoft/hcsshim/internal/guest/crilog"
 	"github.com/Microsoft/hcsshim/internal/guest/prot"
 	"github.com/Microsoft/hcsshim/internal/guest/runtime"
 	specGuest "github.com/Microsoft/hcsshim/internal/guest/spec"
@@ -51,6 +52,9 @@ type Container struct {
 	vsock   transport.Transport
 	logPath string   // path to [logFile].
 	logFile *os.File // file to redirect container's stdio to.
+	// criLogOptions are the rotation options of the log at logPath, if it is
+	// written in the CRI log format rather than as is.
+	criLogOptions *crilog.Options
 
 	spec          *oci.Spec
 	ociBundlePath string
@@ -77,6 +81,10 @@ type Container struct {
 	// of this container is located. Usually, this is either `/run/gcs/c/<containerID>` or
 	// `/run/gcs/c/<UVMID>/container_<containerID>` if scratch is shared with UVM scratch.
 	scratchDirPath string
+
+	// events is the event subscription of the host, if any.
+	eventsMu sync.Mutex
+	events   *eventSubscription
 }
 
 func (c *Container) Start(ctx context.Context, conSettings stdio.ConnectionSettings) (_ int, err error) {
@@ -85,7 +93,23 @@ func (c *Container) Start(ctx context.Context, conSettings stdio.ConnectionSetti
 
 	// only use the logfile for the init process, since we don't want to tee stdio of execs
 	t := c.vsock
-	if c.logPath != "" {
+	var criLog *crilog.Logger
+	if c.logPath != "" && c.criLogOptions != nil {
+		if criLog, err = crilog.New(c.logPath, *c.criLogOptions); err != nil {
+			return -1, fmt.Errorf("failed to open log file: %s: %w", c.logPath, err)
+		}
+		go func() {
+			// the streams of the log are closed with the io Relays, as for logFile below
+			c.initProcess.writersWg.Wait()
+
+			if lfErr := criLog.Close(); lfErr != nil {
+				entity.WithFields(logrus.Fields{
+					logrus.ErrorKey: lfErr,
+					logfields.Path:  c.logPath,
+				}).Warn("failed to close log file")
+			}
+		}()
+	} else if c.logPath != "" {
 		// don't use [os.Create] since that truncates an existing file, which is not desired
 		if c.logFile, err = os.OpenFile(c.logPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666); err != nil {
 			return -1, fmt.Errorf("failed to open log file: %s: %w", c.logPath, err)
@@ -114,6 +138,14 @@ func (c *Container) Start(ctx context.Context, conSettings stdio.ConnectionSetti
 	if err != nil {
 		return -1, err
 	}
+	if criLog != nil {
+		// the output is logged even if the host did not connect to it, or has
+		// gone away
+		stdioSet.OutLog = criLog.Stream(crilog.Stdout)
+		if !c.initProcess.spec.Terminal {
+			stdioSet.ErrLog = criLog.Stream(crilog.Stderr)
+		}
+	}
 
 	if c.initProcess.spec.Terminal {
 		ttyr := c.container.Tty()
@@ -171,6 +203,46 @@ func (c *Container) ExecProcess(ctx context.Context, process *oci.Process, conSe
 	return pid, nil
 }
 
+// AttachProcess attaches the stdio sockets of conSettings to the running
+// process `pid` of the container, replaying the output which was kept while no
+// socket was attached to it.
+func (c *Container) AttachProcess(ctx context.Context, pid uint32, conSettings stdio.ConnectionSettings) error {
+	log.G(ctx).WithFields(logrus.Fields{
+		logfields.ContainerID: c.id,
+		logfields.ProcessID:   pid,
+	}).Info("opengcs::Container::AttachProcess")
+
+	var p *containerProcess
+	if c.initProcess.pid == pid {
+		p = c.initProcess
+	} else {
+		c.processesMutex.Lock()
+		p = c.processes[pid]
+		c.processesMutex.Unlock()
+	}
+	if p == nil {
+		return gcserr.NewHresultError(gcserr.HrErrNotFound)
+	}
+
+	// c.vsock relays to /dev/null if the policy denies stdio access
+	stdioSet, err := stdio.Connect(c.vsock, conSettings)
+	if err != nil {
+		return err
+	}
+	if p.spec.Terminal && p.process.Tty() != nil {
+		err = p.process.Tty().Attach(stdioSet)
+	} else if !p.spec.Terminal && p.process.PipeRelay() != nil {
+		err = p.process.PipeRelay().Attach(stdioSet)
+	} else {
+		err = errors.New("process has no stdio relay")
+	}
+	if err != nil {
+		stdioSet.Close()
+		return errors.Wrapf(err, "failed to attach to stdio of process %d", pid)
+	}
+	return nil
+}
+
 // InitProcess returns the container's init process
 func (c *Container) InitProcess() Process {
 	return c.initProcess
@@ -226,9 +298,58 @@ func (c *Container) Kill(ctx context.Context, signal syscall.Signal) error {
 	return nil
 }
 
+// Pause freezes all of the processes of the container.
+func (c *Container) Pause(ctx context.Context) error {
+	log.G(ctx).WithField(logfields.ContainerID, c.id).Info("opengcs::Container::Pause")
+	return c.container.Pause()
+}
+
+// Resume thaws the processes of a paused container.
+func (c *Container) Resume(ctx context.Context) error {
+	log.G(ctx).WithField(logfields.ContainerID, c.id).Info("opengcs::Container::Resume")
+	return c.container.Resume()
+}
+
+// Checkpoint writes a CRIU checkpoint image of the container, from which it
+// can be restored by CreateContainer.
+func (c *Container) Checkpoint(ctx context.Context, opts *runtime.CheckpointOptions) error {
+	log.G(ctx).WithFields(logrus.Fields{
+		logfields.ContainerID: c.id,
+		logfields.Path:        opts.ImagePath,
+	}).Info("opengcs::Container::Checkpoint")
+	return c.container.Checkpoint(opts)
+}
+
+// GetState returns the state of the container as reported in its properties.
+func (c *Container) GetState(ctx context.Context) (prot.ContainerState, error) {
+	_, span := oc.StartSpan(ctx, "opengcs::Container::GetState")
+	defer span.End()
+	span.AddAttributes(trace.StringAttribute("cid", c.id))
+
+	state, err := c.container.GetState()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get container state for %v", c.id)
+	}
+	// the status of the OCI runtime state, see
+	// https://github.com/opencontainers/runtime-spec/blob/main/runtime.md#state
+	switch state.Status {
+	case "creating", "created":
+		return prot.StateCreated, nil
+	case "running":
+		return prot.StateRunning, nil
+	case "paused":
+		return prot.StatePaused, nil
+	case "stopped":
+		return prot.StateStopped, nil
+	default:
+		return "", errors.Errorf("unknown status %q of container %v", state.Status, c.id)
+	}
+}
+
 func (c *Container) Delete(ctx context.Context) error {
 	entity := log.G(ctx).WithField(logfields.ContainerID, c.id)
 	entity.Info("opengcs::Container::Delete")
+	c.stopEvents()
 	if c.isSandbox {
 		// Check if this is a virtual pod
 		virtualSandboxID := ""
@@ -314,12 +435,12 @@ func (c *Container) GetStats(ctx context.Context) (*v1.Metrics, error) {
 	span.AddAttributes(trace.StringAttribute("cid", c.id))
 
 	cgroupPath := c.spec.Linux.CgroupsPath
-	cg, err := cgroups.Load(cgroups.StaticPath(cgroupPath))
+	cg, err := cgroup.Load(cgroupPath)
 	if err != nil {
 		return nil, errors.Errorf("failed to get container stats for %v: %v", c.id, err)
 	}
 
-	return cg.Stat(cgroups.IgnoreNotExist)
+	return cg.Stat()
 }
 
 func (c *Container) modifyContainerConstraints(ctx context.Context, _ guestrequest.RequestType, cc *guestresource.LCOWContainerConstraints) (err error) {
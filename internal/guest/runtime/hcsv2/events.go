@@ -0,0 +1,256 @@
+//go:build linux
+// +build linux
+
+package hcsv2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Microsoft/hcsshim/internal/guest/cgroup"
+	"github.com/Microsoft/hcsshim/internal/guest/prot"
+	"github.com/Microsoft/hcsshim/internal/log"
+	"github.com/Microsoft/hcsshim/internal/logfields"
+)
+
+// minMetricsInterval bounds the interval of the metrics of an event
+// subscription, so that they do not flood the bridge.
+const minMetricsInterval = time.Second
+
+// eventSubscription is the subscription of the host to the events of a
+// container, which lasts until it is replaced or the container is deleted.
+type eventSubscription struct {
+	cid     string
+	publish func(*prot.ContainerEvent)
+	watches []eventWatch
+	// done is closed to stop the subscription.
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// eventWatch publishes an event of type typ each time n notifies.
+type eventWatch struct {
+	typ     prot.EventType
+	trigger *prot.PressureTrigger
+	n       cgroup.Notifier
+}
+
+// SubscribeEvents subscribes the host to the events of the container, which
+// are passed to publish, replacing any previous subscription. A request
+// without any events only cancels the previous subscription.
+func (c *Container) SubscribeEvents(ctx context.Context, request *prot.ContainerSubscribeEvents, publish func(*prot.ContainerEvent)) (err error) {
+	interval := time.Duration(request.MetricsIntervalInMs) * time.Millisecond
+	if interval != 0 && interval < minMetricsInterval {
+		return errors.Errorf("metrics interval %v is less than %v", interval, minMetricsInterval)
+	}
+
+	s := &eventSubscription{
+		cid:     c.id,
+		publish: publish,
+		done:    make(chan struct{}),
+	}
+	defer func() {
+		if err != nil {
+			for _, w := range s.watches {
+				w.n.Close()
+			}
+		}
+	}()
+	if request.MemoryEvents || len(request.PressureTriggers) > 0 {
+		cg, err := cgroup.Load(c.spec.Linux.CgroupsPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load cgroup of container %s", c.id)
+		}
+		if request.MemoryEvents {
+			for _, e := range []struct {
+				typ   prot.EventType
+				event cgroup.MemoryEvent
+			}{
+				{prot.EtOOMKill, cgroup.OOMKill},
+				{prot.EtMemoryHigh, cgroup.MemoryHigh},
+				{prot.EtMemoryMax, cgroup.MemoryMax},
+			} {
+				n, err := cg.RegisterMemoryEvent(e.event)
+				if errors.Is(err, cgroup.ErrNotSupported) {
+					continue
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to register %s events of container %s", e.event, c.id)
+				}
+				s.watches = append(s.watches, eventWatch{typ: e.typ, n: n})
+			}
+		}
+		for i := range request.PressureTriggers {
+			t := &request.PressureTriggers[i]
+			n, err := cg.RegisterPressure(cgroup.PressureTrigger{
+				Resource: t.Resource,
+				Full:     t.Full,
+				Stall:    time.Duration(t.StallInUs) * time.Microsecond,
+				Window:   time.Duration(t.WindowInUs) * time.Microsecond,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to register pressure trigger %+v of container %s", *t, c.id)
+			}
+			s.watches = append(s.watches, eventWatch{typ: prot.EtPressure, trigger: t, n: n})
+		}
+	}
+
+	log.G(ctx).WithField(logfields.ContainerID, c.id).
+		WithField("subscription", log.Format(ctx, request)).
+		Info("opengcs::Container::SubscribeEvents")
+
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+	if c.events != nil {
+		c.events.stop()
+		c.events = nil
+	}
+	if len(s.watches) == 0 && interval == 0 {
+		return nil
+	}
+	for _, w := range s.watches {
+		s.wg.Add(1)
+		go s.watch(w)
+	}
+	if interval != 0 {
+		s.wg.Add(1)
+		go s.metrics(c, interval)
+	}
+	c.events = s
+	return nil
+}
+
+// stopEvents stops the event subscription of the container, if any.
+func (c *Container) stopEvents() {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+	if c.events != nil {
+		c.events.stop()
+		c.events = nil
+	}
+}
+
+func (s *eventSubscription) stop() {
+	close(s.done)
+	for _, w := range s.watches {
+		w.n.Close()
+	}
+	s.wg.Wait()
+}
+
+func (s *eventSubscription) stopped() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *eventSubscription) watch(w eventWatch) {
+	defer s.wg.Done()
+	for {
+		err := w.n.Wait()
+		if s.stopped() {
+			return
+		}
+		if err != nil {
+			// the cgroup is deleted once the container has exited
+			if !errors.Is(err, cgroup.ErrDeleted) {
+				log.G(context.Background()).WithError(err).WithField(logfields.ContainerID, s.cid).
+					Warnf("failed to wait for %s event", w.typ)
+			}
+			return
+		}
+		s.publish(&prot.ContainerEvent{
+			MessageBase: prot.MessageBase{ContainerID: s.cid},
+			Type:        w.typ,
+			Timestamp:   time.Now(),
+			Trigger:     w.trigger,
+		})
+	}
+}
+
+func (s *eventSubscription) metrics(c *Container, interval time.Duration) {
+	defer s.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		e, err := c.metricsEvent()
+		if err != nil {
+			// the cgroup is deleted once the container has exited
+			log.G(context.Background()).WithError(err).WithField(logfields.ContainerID, s.cid).
+				Debug("stopping container metrics events")
+			return
+		}
+		s.publish(e)
+	}
+}
+
+// metricsEvent returns the EtMetrics event of the container, with the
+// statistics of its cgroup and, on the unified hierarchy, its pressure stall
+// information and the counts of its memory events.
+func (c *Container) metricsEvent() (*prot.ContainerEvent, error) {
+	cg, err := cgroup.Load(c.spec.Linux.CgroupsPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load cgroup of container %s", c.id)
+	}
+	metrics, err := cg.Stat()
+	if err != nil {
+		return nil, err
+	}
+	trimStats(metrics)
+	e := &prot.ContainerEvent{
+		MessageBase: prot.MessageBase{ContainerID: c.id},
+		Type:        prot.EtMetrics,
+		Timestamp:   time.Now(),
+		Metrics:     metrics,
+	}
+
+	pressure, err := cg.Pressure()
+	if err != nil && !errors.Is(err, cgroup.ErrNotSupported) {
+		return nil, err
+	}
+	if pressure != nil {
+		e.Pressure = &prot.PressureStats{
+			CPU:    protPressure(pressure.CPU),
+			Memory: protPressure(pressure.Memory),
+			IO:     protPressure(pressure.IO),
+		}
+	}
+	events, err := cg.MemoryEvents()
+	if err != nil && !errors.Is(err, cgroup.ErrNotSupported) {
+		return nil, err
+	}
+	if events != nil {
+		e.MemoryEvents = &prot.MemoryEventStats{
+			Low:     events.Low,
+			High:    events.High,
+			Max:     events.Max,
+			OOM:     events.OOM,
+			OOMKill: events.OOMKill,
+		}
+	}
+	return e, nil
+}
+
+func protPressure(p *cgroup.Pressure) *prot.Pressure {
+	if p == nil {
+		return nil
+	}
+	data := func(d *cgroup.PressureData) *prot.PressureData {
+		if d == nil {
+			return nil
+		}
+		return &prot.PressureData{Avg10: d.Avg10, Avg60: d.Avg60, Avg300: d.Avg300, TotalInUs: d.Total}
+	}
+	return &prot.Pressure{Some: data(p.Some), Full: data(p.Full)}
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"iter"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -238,6 +239,55 @@ func (n *namespace) dnsConfig(_ context.Context) (searches []string, servers []s
 	return lo.UniqMap(searches, canon), lo.UniqMap(servers, canon)
 }
 
+// dialContext dials `addr` from the network namespace of `n`, resolving host
+// names with the DNS servers of its adapters, so that the GCS reaches the
+// network as the containers in the namespace do.
+func (n *namespace) dialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
+	n.m.Lock()
+	pid := n.pid
+	n.m.Unlock()
+	if pid == 0 {
+		return nil, errors.Errorf("network namespace %q is not assigned to a container", n.id)
+	}
+	ns, err := netns.GetFromPid(pid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get network namespace of pid %d", pid)
+	}
+	defer ns.Close()
+
+	_, servers := n.dnsConfig(ctx)
+	d := &net.Dialer{
+		// dial the addresses of a host in turn, rather than racing them from
+		// other threads, which are not in the namespace
+		FallbackDelay: -1,
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, proto, _ string) (conn net.Conn, err error) {
+				if len(servers) == 0 {
+					return nil, errors.Errorf("network namespace %q has no DNS servers", n.id)
+				}
+				var d net.Dialer
+				for _, s := range servers {
+					err = network.DoInNetNS(ns, func() (err error) {
+						conn, err = d.DialContext(ctx, proto, net.JoinHostPort(s, "53"))
+						return err
+					})
+					if err == nil {
+						return conn, nil
+					}
+				}
+				return nil, err
+			},
+		},
+	}
+	var conn net.Conn
+	err = network.DoInNetNS(ns, func() (err error) {
+		conn, err = d.DialContext(ctx, proto, addr)
+		return err
+	})
+	return conn, err
+}
+
 // allNICs iterates over NICs in the namespace.
 //
 // NOTE: the namespace's mutex, n.m, is held during iteration.
@@ -7,9 +7,11 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
@@ -19,7 +21,6 @@ import (
 	"syscall"
 	"time"
 
-	cgroups "github.com/containerd/cgroups/v3/cgroup1"
 	cgroup1stats "github.com/containerd/cgroups/v3/cgroup1/stats"
 	"github.com/mattn/go-shellwords"
 	"github.com/opencontainers/runtime-spec/specs-go"
@@ -29,11 +30,17 @@ import (
 
 	"github.com/Microsoft/hcsshim/internal/bridgeutils/gcserr"
 	"github.com/Microsoft/hcsshim/internal/debug"
+	"github.com/Microsoft/hcsshim/internal/guest/archive"
+	"github.com/Microsoft/hcsshim/internal/guest/cgroup"
+	"github.com/Microsoft/hcsshim/internal/guest/crilog"
+	"github.com/Microsoft/hcsshim/internal/guest/keyrelease"
 	"github.com/Microsoft/hcsshim/internal/guest/prot"
 	"github.com/Microsoft/hcsshim/internal/guest/runtime"
 	specGuest "github.com/Microsoft/hcsshim/internal/guest/spec"
 	"github.com/Microsoft/hcsshim/internal/guest/stdio"
 	"github.com/Microsoft/hcsshim/internal/guest/storage"
+	"github.com/Microsoft/hcsshim/internal/guest/storage/imagepull"
+	"github.com/Microsoft/hcsshim/internal/guest/storage/ocicrypt"
 	"github.com/Microsoft/hcsshim/internal/guest/storage/overlay"
 	"github.com/Microsoft/hcsshim/internal/guest/storage/pci"
 	"github.com/Microsoft/hcsshim/internal/guest/storage/plan9"
@@ -47,6 +54,7 @@ import (
 	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
 	"github.com/Microsoft/hcsshim/internal/verity"
 	"github.com/Microsoft/hcsshim/pkg/annotations"
+	"github.com/Microsoft/hcsshim/pkg/attestation"
 	"github.com/Microsoft/hcsshim/pkg/securitypolicy"
 )
 
@@ -60,7 +68,7 @@ type VirtualPod struct {
 	MasterSandboxID  string
 	NetworkNamespace string
 	CgroupPath       string
-	CgroupControl    cgroups.Cgroup
+	CgroupControl    cgroup.Cgroup
 	Containers       map[string]bool // containerID -> exists
 	CreatedAt        time.Time
 }
@@ -78,20 +86,50 @@ type Host struct {
 	virtualPodsMutex        sync.Mutex
 	virtualPods             map[string]*VirtualPod // virtualSandboxID -> VirtualPod
 	containerToVirtualPod   map[string]string      // containerID -> virtualSandboxID
-	virtualPodsCgroupParent cgroups.Cgroup         // Parent cgroup for all virtual pods
+	virtualPodsCgroupParent cgroup.Cgroup          // Parent cgroup for all virtual pods
 
 	rtime            runtime.Runtime
 	vsock            transport.Transport
 	devNullTransport transport.Transport
 
+	// runtimes are the OCI runtimes which containers can select by name,
+	// rather than the default rtime.
+	runtimes map[string]runtime.Runtime
+
 	// state required for the security policy enforcement
 	securityOptions *securitypolicy.SecurityOptions
 
 	// hostMounts keeps the state of currently mounted devices and file systems,
 	// which is used for GCS hardening.
 	hostMounts *hostMounts
+
+	// keyBrokerEndpoint is the URL of the key broker which releases the keys
+	// of persistent encrypted disks, if any, and keyBrokerKey is the key with
+	// which it signs its responses.
+	keyBrokerEndpoint string
+	keyBrokerKey      *ecdsa.PublicKey
+
+	// pulledImages are the layers of the images pulled by the guest, by the
+	// root path of the container using them.
+	pulledImagesMutex sync.Mutex
+	pulledImages      map[string][]imagepull.Layer
+
+	// encryptedLayers are the decrypted images of encrypted layers, by their
+	// mount path, and encryptedLayerCount names the next image.
+	encryptedLayersMutex sync.Mutex
+	encryptedLayers      map[string]string
+	encryptedLayerCount  uint64
 }
 
+// encryptedLayersPath is the directory of the decrypted images of encrypted
+// layers, which is owned by the guest rather than derived from paths of the
+// host.
+var encryptedLayersPath = "/run/gcs/encrypted-layers"
+
+// checkpointImagesPath is the directory of the copies of the checkpoint images
+// which containers are restored from, which is owned by the guest.
+var checkpointImagesPath = "/run/gcs/checkpoints"
+
 func NewHost(rtime runtime.Runtime, vsock transport.Transport, initialEnforcer securitypolicy.SecurityPolicyEnforcer, logWriter io.Writer) *Host {
 	securityPolicyOptions := securitypolicy.NewSecurityOptions(
 		initialEnforcer,
@@ -105,9 +143,12 @@ func NewHost(rtime runtime.Runtime, vsock transport.Transport, initialEnforcer s
 		virtualPods:           make(map[string]*VirtualPod),
 		containerToVirtualPod: make(map[string]string),
 		rtime:                 rtime,
+		runtimes:              make(map[string]runtime.Runtime),
 		vsock:                 vsock,
 		devNullTransport:      &transport.DevNullTransport{},
 		hostMounts:            newHostMounts(),
+		pulledImages:          make(map[string][]imagepull.Layer),
+		encryptedLayers:       make(map[string]string),
 		securityOptions:       securityPolicyOptions,
 	}
 }
@@ -120,6 +161,52 @@ func (h *Host) SecurityOptions() *securitypolicy.SecurityOptions {
 	return h.securityOptions
 }
 
+// SetKeyBroker sets the URL of the key broker from which the keys of
+// persistent encrypted disks are released, and the key with which it signs
+// the released keys.
+func (h *Host) SetKeyBroker(endpoint string, key *ecdsa.PublicKey) {
+	h.keyBrokerEndpoint = endpoint
+	h.keyBrokerKey = key
+}
+
+// AddRuntime makes an OCI runtime available to the containers which select it
+// by name with the [annotations.LCOWOCIRuntime] annotation. It must be called
+// before any container is created.
+func (h *Host) AddRuntime(name string, rtime runtime.Runtime) {
+	h.runtimes[name] = rtime
+}
+
+// containerRuntime returns the OCI runtime selected by the annotations of a
+// container, which defaults to the runtime of the host.
+func (h *Host) containerRuntime(spec *specs.Spec) (runtime.Runtime, error) {
+	name := spec.Annotations[annotations.LCOWOCIRuntime]
+	if name == "" {
+		return h.rtime, nil
+	}
+	rtime, ok := h.runtimes[name]
+	if !ok {
+		return nil, errors.Errorf("OCI runtime %q is not available", name)
+	}
+	return rtime, nil
+}
+
+// releaseKey releases the key `keyID` for the mount `target` from the key
+// broker, if the policy allows it, in exchange for an attestation report of
+// the UVM.
+func (h *Host) releaseKey(ctx context.Context, keyID string, target string) ([]byte, error) {
+	if h.keyBrokerEndpoint == "" {
+		return nil, errors.Errorf("cannot release key %q: no key broker is configured", keyID)
+	}
+	if err := h.securityOptions.PolicyEnforcer.EnforceReleaseKeyPolicy(ctx, keyID, target); err != nil {
+		return nil, errors.Wrapf(err, "releasing key %q denied by policy", keyID)
+	}
+	provider := h.securityOptions.AttestationProvider()
+	if provider == nil {
+		return nil, errors.Errorf("cannot release key %q: the UVM cannot be attested", keyID)
+	}
+	return keyrelease.NewClient(h.keyBrokerEndpoint, h.keyBrokerKey, provider).ReleaseKey(ctx, keyID)
+}
+
 func (h *Host) Transport() transport.Transport {
 	return h.vsock
 }
@@ -227,6 +314,26 @@ func setupSandboxHugePageMountsPath(id string) error {
 	return storage.MountRShared(mountPath)
 }
 
+// parseCRILogOptions returns the rotation options of the log file of a
+// container if the annotations select the CRI log format, or nil for raw logs.
+func parseCRILogOptions(ctx context.Context, a map[string]string) (*crilog.Options, error) {
+	switch format := a[annotations.LCOWTeeLogFormat]; format {
+	case "", "raw":
+		return nil, nil
+	case "cri":
+		opts := &crilog.Options{
+			MaxSize:  int64(oci.ParseAnnotationsUint64(ctx, a, annotations.LCOWTeeLogMaxSize, 0)),
+			MaxFiles: int(oci.ParseAnnotationsUint32(ctx, a, annotations.LCOWTeeLogMaxFiles, 5)),
+		}
+		if opts.MaxSize > 0 && opts.MaxFiles < 2 {
+			return nil, errors.Errorf("rotated log must keep at least 2 files, not %d", opts.MaxFiles)
+		}
+		return opts, nil
+	default:
+		return nil, errors.Errorf("unknown log format %q", format)
+	}
+}
+
 // setupSandboxLogDir creates the directory to house all redirected stdio logs from containers.
 //
 // Virtual pod aware.
@@ -315,6 +422,11 @@ func (h *Host) CreateContainer(ctx context.Context, id string, settings *prot.VM
 		}
 	}
 
+	rtime, err := h.containerRuntime(settings.OCISpecification)
+	if err != nil {
+		return nil, err
+	}
+
 	// Normally we would be doing policy checking here at the start of our
 	// "policy gated function". However, we can't for create container as we
 	// need a properly correct sandboxID which might be changed by the code
@@ -381,12 +493,12 @@ func (h *Host) CreateContainer(ctx context.Context, id string, settings *prot.VM
 				return nil, err
 			}
 
-			// Add SEV device when security policy is not empty, except when privileged annotation is
-			// set to "true", in which case all UVMs devices are added.
+			// Add the attestation device when security policy is not empty, except when privileged
+			// annotation is set to "true", in which case all UVMs devices are added.
 			if len(h.securityOptions.PolicyEnforcer.EncodedSecurityPolicy()) > 0 && !oci.ParseAnnotationsBool(ctx,
 				settings.OCISpecification.Annotations, annotations.LCOWPrivileged, false) {
-				if err := specGuest.AddDevSev(ctx, settings.OCISpecification); err != nil {
-					log.G(ctx).WithError(err).Debug("failed to add SEV device")
+				if err := addAttestationDevice(ctx, h.securityOptions.AttestationProvider(), settings.OCISpecification); err != nil {
+					log.G(ctx).WithError(err).Debug("failed to add attestation device")
 				}
 			}
 
@@ -439,21 +551,64 @@ func (h *Host) CreateContainer(ctx context.Context, id string, settings *prot.VM
 		return nil, err
 	}
 
-	envToKeep, capsToKeep, allowStdio, err := h.securityOptions.PolicyEnforcer.EnforceCreateContainerPolicy(
+	hostNamespaces, err := securitypolicy.HostNamespaces(settings.OCISpecification)
+	if err != nil {
+		return nil, err
+	}
+
+	privileged := isPrivilegedContainerCreationRequest(ctx, settings.OCISpecification)
+	opts := &securitypolicy.CreateContainerOptions{
+		SandboxID:            sandboxID,
+		Privileged:           &privileged,
+		NoNewPrivileges:      &settings.OCISpecification.Process.NoNewPrivileges,
+		Groups:               groups,
+		Umask:                umask,
+		Capabilities:         settings.OCISpecification.Process.Capabilities,
+		SeccompProfileSHA256: seccomp,
+		Rlimits:              settings.OCISpecification.Process.Rlimits,
+		Hostname:             settings.OCISpecification.Hostname,
+		HostNamespaces:       hostNamespaces,
+		AppArmorProfile:      settings.OCISpecification.Process.ApparmorProfile,
+		SELinuxLabel:         settings.OCISpecification.Process.SelinuxLabel,
+		OOMScoreAdj:          settings.OCISpecification.Process.OOMScoreAdj,
+	}
+	if linux := settings.OCISpecification.Linux; linux != nil {
+		opts.Sysctls = linux.Sysctl
+		opts.MaskedPaths = linux.MaskedPaths
+		opts.ReadonlyPaths = linux.ReadonlyPaths
+	}
+
+	// the image is restored from a copy of the guest, from which its digest
+	// is computed, as the host can modify the image itself
+	var restoreImagePath string
+	if settings.CheckpointImagePath != "" {
+		if err := checkCheckpointImagePath(settings.CheckpointImagePath); err != nil {
+			return nil, err
+		}
+		var digest string
+		restoreImagePath, digest, err = stageCheckpointImage(id, settings.CheckpointImagePath)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := os.RemoveAll(restoreImagePath); err != nil {
+				log.G(ctx).WithError(err).Warn("failed to remove checkpoint image copy")
+			}
+		}()
+		if err := h.securityOptions.PolicyEnforcer.EnforceRestoreContainerPolicy(ctx, id, settings.CheckpointImagePath, digest); err != nil {
+			return nil, errors.Wrapf(err, "container restore denied due to policy")
+		}
+	}
+
+	envToKeep, capsToKeep, allowStdio, err := h.securityOptions.PolicyEnforcer.EnforceCreateContainerPolicyV2(
 		ctx,
-		sandboxID,
 		id,
 		settings.OCISpecification.Process.Args,
 		settings.OCISpecification.Process.Env,
 		settings.OCISpecification.Process.Cwd,
 		settings.OCISpecification.Mounts,
-		isPrivilegedContainerCreationRequest(ctx, settings.OCISpecification),
-		settings.OCISpecification.Process.NoNewPrivileges,
 		user,
-		groups,
-		umask,
-		settings.OCISpecification.Process.Capabilities,
-		seccomp,
+		opts,
 	)
 	if err != nil {
 		return nil, errors.Wrapf(err, "container creation denied due to policy")
@@ -479,6 +634,16 @@ func (h *Host) CreateContainer(ctx context.Context, id string, settings *prot.VM
 			return nil, errors.Errorf("log path %v is not within sandbox's log dir", c.logPath)
 		}
 
+		c.criLogOptions, err = parseCRILogOptions(ctx, settings.OCISpecification.Annotations)
+		if err != nil {
+			return nil, err
+		}
+		if c.criLogOptions != nil {
+			if err := h.securityOptions.PolicyEnforcer.EnforceRuntimeLoggingPolicy(ctx); err != nil {
+				return nil, errors.Wrapf(err, "writing CRI formatted logs to log path %q denied due to policy", logPath)
+			}
+		}
+
 		dir := filepath.Dir(c.logPath)
 		log.G(ctx).WithFields(logrus.Fields{
 			logfields.Path:        dir,
@@ -512,9 +677,20 @@ func (h *Host) CreateContainer(ctx context.Context, id string, settings *prot.VM
 		return nil, err
 	}
 
-	con, err := h.rtime.CreateContainer(id, settings.OCIBundlePath, nil)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to create container")
+	var con runtime.Container
+	if restoreImagePath != "" {
+		con, err = rtime.RestoreContainer(id, settings.OCIBundlePath, &runtime.CheckpointOptions{
+			ImagePath:      restoreImagePath,
+			TCPEstablished: settings.TCPEstablished,
+		}, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to restore container")
+		}
+	} else {
+		con, err = rtime.CreateContainer(id, settings.OCIBundlePath, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create container")
+		}
 	}
 	init, err := con.GetInitProcess()
 	if err != nil {
@@ -546,6 +722,15 @@ func (h *Host) CreateContainer(ctx context.Context, id string, settings *prot.VM
 	return c, nil
 }
 
+// addAttestationDevice adds the device through which workload containers can
+// fetch the attestation reports of the provider, which defaults to SEV-SNP.
+func addAttestationDevice(ctx context.Context, provider attestation.Provider, spec *specs.Spec) error {
+	if provider != nil && provider.EvidenceFormat() == attestation.EvidenceFormatTDX {
+		return specGuest.AddDevTdxGuest(ctx, spec)
+	}
+	return specGuest.AddDevSev(ctx, spec)
+}
+
 func writeSpecToFile(ctx context.Context, configFile string, spec *specs.Spec) error {
 	f, err := os.Create(configFile)
 	if err != nil {
@@ -627,7 +812,19 @@ func (h *Host) modifyHostSettings(ctx context.Context, containerID string, req *
 				}()
 			}
 		}
-		return modifyMappedVirtualDisk(ctx, req.RequestType, mvd, h.securityOptions.PolicyEnforcer)
+		if mvd.EncryptedLayer != nil {
+			return h.modifyEncryptedLayer(ctx, req.RequestType, mvd)
+		}
+		var encryptionKey []byte
+		if mvd.EncryptionKeyID != "" && req.RequestType == guestrequest.RequestTypeAdd {
+			if !mvd.Encrypted {
+				return errors.Errorf("encryption key %q requested for unencrypted disk", mvd.EncryptionKeyID)
+			}
+			if encryptionKey, err = h.releaseKey(ctx, mvd.EncryptionKeyID, mvd.MountPath); err != nil {
+				return err
+			}
+		}
+		return modifyMappedVirtualDisk(ctx, req.RequestType, mvd, h.securityOptions.PolicyEnforcer, encryptionKey)
 	case guestresource.ResourceTypeMappedDirectory:
 		return modifyMappedDirectory(ctx, h.vsock, req.RequestType, req.Settings.(*guestresource.LCOWMappedDirectory), h.securityOptions.PolicyEnforcer)
 	case guestresource.ResourceTypeVPMemDevice:
@@ -639,6 +836,8 @@ func (h *Host) modifyHostSettings(ctx context.Context, containerID string, req *
 		// knows about the layers and the overlayfs.
 		encryptedScratch := cl.ScratchPath != "" && h.hostMounts.IsEncrypted(cl.ScratchPath)
 		return modifyCombinedLayers(ctx, req.RequestType, req.Settings.(*guestresource.LCOWCombinedLayers), encryptedScratch, h.securityOptions.PolicyEnforcer)
+	case guestresource.ResourceTypeGuestPulledImage:
+		return h.modifyGuestPulledImage(ctx, req.RequestType, req.Settings.(*guestresource.LCOWGuestPulledImage))
 	case guestresource.ResourceTypeNetwork:
 		return modifyNetwork(ctx, req.RequestType, req.Settings.(*guestresource.LCOWNetworkAdapter))
 	case guestresource.ResourceTypeVPCIDevice:
@@ -664,6 +863,30 @@ func (h *Host) modifyHostSettings(ctx context.Context, containerID string, req *
 			return errors.New("the request settings are not of type SecurityPolicyFragment")
 		}
 		return h.securityOptions.InjectFragment(ctx, r)
+	case guestresource.ResourceTypePolicyFragmentReplace:
+		r, ok := req.Settings.(*guestresource.SecurityPolicyFragment)
+		if !ok {
+			return errors.New("the request settings are not of type SecurityPolicyFragment")
+		}
+		return h.securityOptions.ReplaceFragment(ctx, r)
+	case guestresource.ResourceTypePolicyFragmentRevoke:
+		r, ok := req.Settings.(*guestresource.SecurityPolicyFragmentRevocation)
+		if !ok {
+			return errors.New("the request settings are not of type SecurityPolicyFragmentRevocation")
+		}
+		return h.securityOptions.RevokeFragment(ctx, r)
+	case guestresource.ResourceTypePolicyFragmentMinimumSVN:
+		r, ok := req.Settings.(*guestresource.SecurityPolicyFragmentMinimumSVN)
+		if !ok {
+			return errors.New("the request settings are not of type SecurityPolicyFragmentMinimumSVN")
+		}
+		return h.securityOptions.SetFragmentMinimumSVN(ctx, r)
+	case guestresource.ResourceTypeSecurityPolicyReplace:
+		r, ok := req.Settings.(*guestresource.SignedSecurityPolicy)
+		if !ok {
+			return errors.New("the request settings are not of type SignedSecurityPolicy")
+		}
+		return h.securityOptions.ReplaceSignedPolicy(ctx, r)
 	default:
 		return errors.Errorf("the ResourceType %q is not supported for UVM", req.ResourceType)
 	}
@@ -716,6 +939,236 @@ func (h *Host) ShutdownContainer(ctx context.Context, containerID string, gracef
 	return c.Kill(ctx, signal)
 }
 
+// PauseContainer freezes all of the processes of the container, which are
+// thawed by ResumeContainer.
+func (h *Host) PauseContainer(ctx context.Context, containerID string) error {
+	c, err := h.GetCreatedContainer(containerID)
+	if err != nil {
+		return err
+	}
+
+	err = h.securityOptions.PolicyEnforcer.EnforcePauseContainerPolicy(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return c.Pause(ctx)
+}
+
+// ResumeContainer thaws the processes of a container paused by PauseContainer.
+func (h *Host) ResumeContainer(ctx context.Context, containerID string) error {
+	c, err := h.GetCreatedContainer(containerID)
+	if err != nil {
+		return err
+	}
+
+	err = h.securityOptions.PolicyEnforcer.EnforceResumeContainerPolicy(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return c.Resume(ctx)
+}
+
+// CheckpointContainer writes a CRIU checkpoint image of the container to the
+// directory of the request, on a SCSI disk or a directory mapped into the UVM.
+// The container is stopped once it is checkpointed, unless the request leaves
+// it running.
+func (h *Host) CheckpointContainer(ctx context.Context, containerID string, request *prot.ContainerCheckpoint) error {
+	c, err := h.GetCreatedContainer(containerID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkCheckpointImagePath(request.ImagePath); err != nil {
+		return err
+	}
+
+	imageEncrypted := h.hostMounts.IsEncrypted(request.ImagePath)
+	err = h.securityOptions.PolicyEnforcer.EnforceCheckpointContainerPolicy(ctx, containerID, request.ImagePath, imageEncrypted)
+	if err != nil {
+		return err
+	}
+
+	// the image holds the memory of the container, so keep it private
+	if err := os.MkdirAll(request.ImagePath, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create checkpoint image directory: %s", request.ImagePath)
+	}
+	return c.Checkpoint(ctx, &runtime.CheckpointOptions{
+		ImagePath:      request.ImagePath,
+		LeaveRunning:   request.LeaveRunning,
+		TCPEstablished: request.TCPEstablished,
+	})
+}
+
+// checkCheckpointImagePath checks that the path of a checkpoint image is an
+// absolute path in the UVM.
+func checkCheckpointImagePath(imagePath string) error {
+	if !filepath.IsAbs(imagePath) || filepath.Clean(imagePath) != imagePath {
+		return errors.Errorf("checkpoint image path %q is not a clean absolute path", imagePath)
+	}
+	return nil
+}
+
+// stageCheckpointImage copies the checkpoint image at imagePath into a
+// directory of the guest for the container id, and returns the copy along with
+// its digest, see securitypolicy.CheckpointImageDigest.
+func stageCheckpointImage(id string, imagePath string) (_ string, _ string, err error) {
+	if err := os.MkdirAll(checkpointImagesPath, 0700); err != nil {
+		return "", "", errors.Wrapf(err, "failed to create checkpoint images directory: %s", checkpointImagesPath)
+	}
+	dir := filepath.Join(checkpointImagesPath, id)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return "", "", errors.Wrapf(err, "failed to create checkpoint image directory: %s", dir)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+
+	err = filepath.WalkDir(imagePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(imagePath, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		switch {
+		case d.IsDir():
+			if rel == "." {
+				return nil
+			}
+			return os.Mkdir(target, 0700)
+		case d.Type().IsRegular():
+			return copyImageFile(path, target)
+		default:
+			return errors.Errorf("checkpoint image file %s is not a regular file", path)
+		}
+	})
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to copy checkpoint image: %s", imagePath)
+	}
+	digest, err := securitypolicy.CheckpointImageDigest(dir)
+	if err != nil {
+		return "", "", err
+	}
+	return dir, digest, nil
+}
+
+func copyImageFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// CopyToContainer extracts a tar archive, which the host streams over the
+// vsock port of the request, into a directory of the container. Paths are
+// resolved in the mount namespace of the container, beneath its root. The
+// extracted files are owned by the user of the container, unless the request
+// preserves the owners recorded in the archive.
+func (h *Host) CopyToContainer(ctx context.Context, containerID string, request *prot.ContainerCopy) error {
+	c, err := h.GetCreatedContainer(containerID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkContainerCopyPath(request.Path); err != nil {
+		return err
+	}
+
+	err = h.securityOptions.PolicyEnforcer.EnforceCopyToContainerPolicy(ctx, containerID, request.Path)
+	if err != nil {
+		return err
+	}
+
+	root, err := archive.OpenRoot(c.InitProcess().Pid())
+	if err != nil {
+		return errors.Wrapf(err, "failed to open root of container %s", containerID)
+	}
+	defer root.Close()
+
+	conn, err := h.vsock.Dial(request.Port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	log.G(ctx).WithFields(logrus.Fields{
+		logfields.ContainerID: containerID,
+		logfields.Path:        request.Path,
+	}).Info("opengcs::Host::CopyToContainer")
+	user := c.spec.Process.User
+	return archive.Extract(ctx, root, request.Path, conn, archive.ExtractOptions{
+		UID:               int(user.UID),
+		GID:               int(user.GID),
+		PreserveOwnership: request.PreserveOwnership,
+	})
+}
+
+// CopyFromContainer streams a tar archive of a file or directory of the
+// container to the host, over the vsock port of the request. Paths are
+// resolved in the mount namespace of the container, beneath its root.
+func (h *Host) CopyFromContainer(ctx context.Context, containerID string, request *prot.ContainerCopy) error {
+	c, err := h.GetCreatedContainer(containerID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkContainerCopyPath(request.Path); err != nil {
+		return err
+	}
+
+	err = h.securityOptions.PolicyEnforcer.EnforceCopyFromContainerPolicy(ctx, containerID, request.Path)
+	if err != nil {
+		return err
+	}
+
+	root, err := archive.OpenRoot(c.InitProcess().Pid())
+	if err != nil {
+		return errors.Wrapf(err, "failed to open root of container %s", containerID)
+	}
+	defer root.Close()
+
+	conn, err := h.vsock.Dial(request.Port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	log.G(ctx).WithFields(logrus.Fields{
+		logfields.ContainerID: containerID,
+		logfields.Path:        request.Path,
+	}).Info("opengcs::Host::CopyFromContainer")
+	if err := archive.Archive(ctx, root, request.Path, conn); err != nil {
+		return err
+	}
+	// let the host know that the archive is complete
+	return conn.CloseWrite()
+}
+
+// checkContainerCopyPath checks that the path of a copy is an absolute path
+// in the container.
+func checkContainerCopyPath(p string) error {
+	if !path.IsAbs(p) || path.Clean(p) != p {
+		return errors.Errorf("copy path %q is not a clean absolute path", p)
+	}
+	return nil
+}
+
 func (h *Host) SignalContainerProcess(ctx context.Context, containerID string, processID uint32, signal syscall.Signal) error {
 	c, err := h.GetCreatedContainer(containerID)
 	if err != nil {
@@ -829,6 +1282,17 @@ func (h *Host) ExecProcess(ctx context.Context, containerID string, params prot.
 	return pid, err
 }
 
+// AttachProcess attaches new stdio sockets to a running process of a
+// container, such as after the host reconnects. The policy for the stdio of
+// the process was enforced when it was created.
+func (h *Host) AttachProcess(ctx context.Context, containerID string, pid uint32, conSettings stdio.ConnectionSettings) error {
+	c, err := h.GetCreatedContainer(containerID)
+	if err != nil {
+		return err
+	}
+	return c.AttachProcess(ctx, pid, conSettings)
+}
+
 func (h *Host) GetExternalProcess(pid int) (Process, error) {
 	h.externalProcessesMutex.Lock()
 	defer h.externalProcessesMutex.Unlock()
@@ -846,6 +1310,10 @@ func (h *Host) GetProperties(ctx context.Context, containerID string, query prot
 		return nil, errors.Wrapf(err, "get properties denied due to policy")
 	}
 
+	if containerID == UVMContainerID {
+		return h.getUVMProperties(ctx, query)
+	}
+
 	c, err := h.GetCreatedContainer(containerID)
 	if err != nil {
 		return nil, err
@@ -871,23 +1339,17 @@ func (h *Host) GetProperties(ctx context.Context, containerID string, query prot
 			if err != nil {
 				return nil, err
 			}
-			// zero out [Blkio] sections, since:
-			//  1. (Az)CRI (currently) only looks at the CPU and memory sections; and
-			//  2. it can get very large for containers with many layers
-			if cgroupMetrics.GetBlkio() != nil {
-				cgroupMetrics.Blkio.Reset()
-			}
-			// also preemptively zero out [Rdma] and [Network], since they could also grow untenable large
-			if cgroupMetrics.GetRdma() != nil {
-				cgroupMetrics.Rdma.Reset()
-			}
-			if len(cgroupMetrics.GetNetwork()) > 0 {
-				cgroupMetrics.Network = []*cgroup1stats.NetworkStat{}
-			}
+			trimStats(cgroupMetrics)
 			if logrus.IsLevelEnabled(logrus.TraceLevel) {
 				log.G(ctx).WithField("stats", log.Format(ctx, cgroupMetrics)).Trace("queried cgroup statistics")
 			}
 			properties.Metrics = cgroupMetrics
+		case prot.PtState:
+			state, err := c.GetState(ctx)
+			if err != nil {
+				return nil, err
+			}
+			properties.State = state
 		default:
 			log.G(ctx).WithField("propertyType", requestedProperty).Warn("unknown or empty property type")
 		}
@@ -896,6 +1358,68 @@ func (h *Host) GetProperties(ctx context.Context, containerID string, query prot
 	return properties, nil
 }
 
+// SubscribeContainerEvents subscribes the host to the memory, pressure and
+// metrics events of a container, which are passed to publish. Since the
+// metrics are those of GetProperties, so is the policy.
+func (h *Host) SubscribeContainerEvents(ctx context.Context, containerID string, request *prot.ContainerSubscribeEvents, publish func(*prot.ContainerEvent)) error {
+	err := h.securityOptions.PolicyEnforcer.EnforceGetPropertiesPolicy(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "event subscription denied due to policy")
+	}
+
+	c, err := h.GetCreatedContainer(containerID)
+	if err != nil {
+		return err
+	}
+	return c.SubscribeEvents(ctx, request, publish)
+}
+
+// trimStats zeroes out the sections of the cgroup metrics of a container which
+// the host does not use, and which can grow large.
+func trimStats(cgroupMetrics *cgroup1stats.Metrics) {
+	// zero out [Blkio] sections, since:
+	//  1. (Az)CRI (currently) only looks at the CPU and memory sections; and
+	//  2. it can get very large for containers with many layers
+	if cgroupMetrics.GetBlkio() != nil {
+		cgroupMetrics.Blkio.Reset()
+	}
+	// also preemptively zero out [Rdma] and [Network], since they could also grow untenable large
+	if cgroupMetrics.GetRdma() != nil {
+		cgroupMetrics.Rdma.Reset()
+	}
+	if len(cgroupMetrics.GetNetwork()) > 0 {
+		cgroupMetrics.Network = []*cgroup1stats.NetworkStat{}
+	}
+}
+
+// getUVMProperties returns the requested properties of the UVM itself. Only
+// the loaded policy fragments are supported.
+func (h *Host) getUVMProperties(ctx context.Context, query prot.PropertyQuery) (*prot.PropertiesV2, error) {
+	properties := &prot.PropertiesV2{}
+	for _, requestedProperty := range query.PropertyTypes {
+		switch requestedProperty {
+		case prot.PtPolicyFragments:
+			fragments, err := h.securityOptions.PolicyEnforcer.LoadedFragments(ctx)
+			if err != nil {
+				return nil, err
+			}
+			properties.PolicyFragments = make([]prot.PolicyFragment, len(fragments))
+			for i, f := range fragments {
+				properties.PolicyFragments[i] = prot.PolicyFragment{
+					Issuer:    f.Issuer,
+					Feed:      f.Feed,
+					SVN:       f.SVN,
+					Namespace: f.Namespace,
+				}
+			}
+		default:
+			return nil, errors.Errorf("property type %q is not supported against the UVM", requestedProperty)
+		}
+	}
+
+	return properties, nil
+}
+
 func (h *Host) GetStacks(ctx context.Context) (string, error) {
 	err := h.securityOptions.PolicyEnforcer.EnforceDumpStacksPolicy(ctx)
 	if err != nil {
@@ -1025,6 +1549,7 @@ func modifyMappedVirtualDisk(
 	rt guestrequest.RequestType,
 	mvd *guestresource.LCOWMappedVirtualDisk,
 	securityPolicy securitypolicy.SecurityPolicyEnforcer,
+	encryptionKey []byte,
 ) (err error) {
 	var verityInfo *guestresource.DeviceVerityInfo
 	if mvd.ReadOnly {
@@ -1060,6 +1585,7 @@ func modifyMappedVirtualDisk(
 			}
 			config := &scsi.Config{
 				Encrypted:        mvd.Encrypted,
+				EncryptionKey:    encryptionKey,
 				VerityInfo:       verityInfo,
 				EnsureFilesystem: mvd.EnsureFilesystem,
 				Filesystem:       mvd.Filesystem,
@@ -1094,6 +1620,128 @@ func modifyMappedVirtualDisk(
 	}
 }
 
+// modifyEncryptedLayer decrypts a container image layer encrypted with
+// ocicrypt, with the key released for it, into an ext4 image which is mounted
+// if its digest is allowed by the policy.
+func (h *Host) modifyEncryptedLayer(
+	ctx context.Context,
+	rt guestrequest.RequestType,
+	mvd *guestresource.LCOWMappedVirtualDisk,
+) error {
+	if !mvd.ReadOnly || mvd.MountPath == "" {
+		return errors.New("encrypted layers must be mounted read-only")
+	}
+
+	switch rt {
+	case guestrequest.RequestTypeAdd:
+		image, err := h.reserveEncryptedLayer(mvd.MountPath)
+		if err != nil {
+			return err
+		}
+		if err := h.mountEncryptedLayer(ctx, mvd, image); err != nil {
+			h.releaseEncryptedLayer(mvd.MountPath)
+			return err
+		}
+		return nil
+	case guestrequest.RequestTypeRemove:
+		h.encryptedLayersMutex.Lock()
+		image, ok := h.encryptedLayers[mvd.MountPath]
+		h.encryptedLayersMutex.Unlock()
+		if !ok {
+			return errors.Errorf("no encrypted layer is mounted at %s", mvd.MountPath)
+		}
+		if err := h.securityOptions.PolicyEnforcer.EnforceDeviceUnmountPolicy(ctx, mvd.MountPath); err != nil {
+			return fmt.Errorf("unmounting encrypted layer at %s denied by policy: %w", mvd.MountPath, err)
+		}
+		if err := ocicrypt.Unmount(ctx, image, mvd.MountPath); err != nil {
+			return err
+		}
+		h.releaseEncryptedLayer(mvd.MountPath)
+		return nil
+	default:
+		return newInvalidRequestTypeError(rt)
+	}
+}
+
+// mountEncryptedLayer decrypts the encrypted layer into `image`, and mounts it
+// if allowed by the policy. The key of the layer is released for the mount
+// path, and so only if the policy allows the target, before any of the layer
+// is decrypted.
+func (h *Host) mountEncryptedLayer(ctx context.Context, mvd *guestresource.LCOWMappedVirtualDisk, image string) error {
+	layer := mvd.EncryptedLayer
+	pub, err := ocicrypt.ParsePublicOptions(layer.PublicOptions)
+	if err != nil {
+		return err
+	}
+	wk, err := ocicrypt.ParseWrappedKey(layer.WrappedKey)
+	if err != nil {
+		return err
+	}
+	key, err := h.releaseKey(ctx, wk.KeyID, mvd.MountPath)
+	if err != nil {
+		return err
+	}
+	priv, err := wk.Unwrap(key)
+	if err != nil {
+		return err
+	}
+
+	devCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	devPath, err := scsi.GetDevicePath(devCtx, mvd.Controller, mvd.Lun, mvd.Partition)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(devPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := ocicrypt.NewDecryptReader(io.LimitReader(f, layer.Size), pub, priv)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(encryptedLayersPath, 0700); err != nil {
+		return err
+	}
+	verityInfo, err := ocicrypt.ConvertLayer(r, layer.Format, image)
+	if err != nil {
+		return errors.Wrapf(err, "failed to decrypt layer on scsi device controller %d lun %d", mvd.Controller, mvd.Lun)
+	}
+
+	if err := h.securityOptions.PolicyEnforcer.EnforceDeviceMountPolicy(ctx, mvd.MountPath, verityInfo.RootDigest); err != nil {
+		_ = os.Remove(image)
+		return errors.Wrapf(err, "mounting encrypted layer on scsi device controller %d lun %d onto %s denied by policy", mvd.Controller, mvd.Lun, mvd.MountPath)
+	}
+	if err := ocicrypt.Mount(ctx, image, mvd.MountPath, verityInfo); err != nil {
+		_ = os.Remove(image)
+		return err
+	}
+	return nil
+}
+
+// reserveEncryptedLayer reserves the mount path for an encrypted layer, and
+// returns the path of the image to which the layer is decrypted.
+func (h *Host) reserveEncryptedLayer(mountPath string) (string, error) {
+	h.encryptedLayersMutex.Lock()
+	defer h.encryptedLayersMutex.Unlock()
+
+	if _, ok := h.encryptedLayers[mountPath]; ok {
+		return "", errors.Errorf("an encrypted layer is already mounted at %s", mountPath)
+	}
+	h.encryptedLayerCount++
+	image := filepath.Join(encryptedLayersPath, fmt.Sprintf("layer%d.ext4", h.encryptedLayerCount))
+	h.encryptedLayers[mountPath] = image
+	return image, nil
+}
+
+// releaseEncryptedLayer releases the mount path of an encrypted layer.
+func (h *Host) releaseEncryptedLayer(mountPath string) {
+	h.encryptedLayersMutex.Lock()
+	defer h.encryptedLayersMutex.Unlock()
+	delete(h.encryptedLayers, mountPath)
+}
+
 func modifyMappedDirectory(
 	ctx context.Context,
 	vsock transport.Transport,
@@ -1211,6 +1859,115 @@ func modifyCombinedLayers(
 	}
 }
 
+// modifyGuestPulledImage pulls the image of a container onto its scratch, and
+// combines the layers into the root filesystem of the container as
+// modifyCombinedLayers does for the layers which the host attaches. The policy
+// enforces the digest of each layer as it is unpacked, and then the overlay.
+func (h *Host) modifyGuestPulledImage(
+	ctx context.Context,
+	rt guestrequest.RequestType,
+	gpi *guestresource.LCOWGuestPulledImage,
+) (err error) {
+	if gpi.ScratchPath == "" || gpi.ContainerRootPath == "" {
+		return errors.New("guest pulled images require a scratch path and a container root path")
+	}
+	securityPolicy := h.securityOptions.PolicyEnforcer
+	layersPath := filepath.Join(gpi.ScratchPath, "layers")
+
+	switch rt {
+	case guestrequest.RequestTypeAdd:
+		h.pulledImagesMutex.Lock()
+		if _, ok := h.pulledImages[gpi.ContainerRootPath]; ok {
+			h.pulledImagesMutex.Unlock()
+			return errors.Errorf("an image is already pulled for %s", gpi.ContainerRootPath)
+		}
+		// reserve the root path while the image is pulled
+		h.pulledImages[gpi.ContainerRootPath] = nil
+		h.pulledImagesMutex.Unlock()
+		defer func() {
+			if err != nil {
+				h.pulledImagesMutex.Lock()
+				delete(h.pulledImages, gpi.ContainerRootPath)
+				h.pulledImagesMutex.Unlock()
+			}
+		}()
+
+		if err := securityPolicy.EnforceScratchMountPolicy(ctx, gpi.ScratchPath, h.hostMounts.IsEncrypted(gpi.ScratchPath)); err != nil {
+			return fmt.Errorf("scratch mounting denied by policy: %w", err)
+		}
+
+		opts := imagepull.Options{
+			Unpack:    gpi.Unpack,
+			PlainHTTP: gpi.PlainHTTP,
+			Username:  gpi.Username,
+			Password:  gpi.Password,
+		}
+		if gpi.NamespaceID != "" {
+			ns, err := getNetworkNamespace(gpi.NamespaceID)
+			if err != nil {
+				return err
+			}
+			opts.Dial = ns.dialContext
+		}
+		var layers []imagepull.Layer
+		layers, err = imagepull.Pull(ctx, gpi.Image, layersPath, opts, securityPolicy)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_ = imagepull.Remove(ctx, layers, securityPolicy)
+				_ = os.Remove(layersPath)
+			}
+		}()
+
+		layerPaths := make([]string, len(layers))
+		for i, l := range layers {
+			layerPaths[i] = l.Path
+		}
+		if err := securityPolicy.EnforceOverlayMountPolicy(ctx, gpi.ContainerID, layerPaths, gpi.ContainerRootPath); err != nil {
+			return fmt.Errorf("overlay creation denied by policy: %w", err)
+		}
+		upperdirPath := filepath.Join(gpi.ScratchPath, "upper")
+		workdirPath := filepath.Join(gpi.ScratchPath, "work")
+		if err := overlay.MountLayer(ctx, layerPaths, upperdirPath, workdirPath, gpi.ContainerRootPath, false); err != nil {
+			return err
+		}
+
+		h.pulledImagesMutex.Lock()
+		h.pulledImages[gpi.ContainerRootPath] = layers
+		h.pulledImagesMutex.Unlock()
+		return nil
+	case guestrequest.RequestTypeRemove:
+		h.pulledImagesMutex.Lock()
+		layers := h.pulledImages[gpi.ContainerRootPath]
+		h.pulledImagesMutex.Unlock()
+		if layers == nil {
+			return errors.Errorf("no image is pulled for %s", gpi.ContainerRootPath)
+		}
+
+		if err := securityPolicy.EnforceOverlayUnmountPolicy(ctx, gpi.ContainerRootPath); err != nil {
+			return errors.Wrap(err, "overlay removal denied by policy")
+		}
+		if err := storage.UnmountPath(ctx, gpi.ContainerRootPath, true); err != nil {
+			return err
+		}
+		if err := imagepull.Remove(ctx, layers, securityPolicy); err != nil {
+			return err
+		}
+		if err := os.Remove(layersPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		h.pulledImagesMutex.Lock()
+		delete(h.pulledImages, gpi.ContainerRootPath)
+		h.pulledImagesMutex.Unlock()
+		return nil
+	default:
+		return newInvalidRequestTypeError(rt)
+	}
+}
+
 func modifyNetwork(ctx context.Context, rt guestrequest.RequestType, na *guestresource.LCOWNetworkAdapter) (err error) {
 	switch rt {
 	case guestrequest.RequestTypeAdd:
@@ -1277,7 +2034,7 @@ func isPrivilegedContainerCreationRequest(ctx context.Context, spec *specs.Spec)
 // Virtual Pod Management Methods
 
 // InitializeVirtualPodSupport sets up the parent cgroup for virtual pods
-func (h *Host) InitializeVirtualPodSupport(virtualPodsCgroup cgroups.Cgroup) {
+func (h *Host) InitializeVirtualPodSupport(virtualPodsCgroup cgroup.Cgroup) {
 	h.virtualPodsMutex.Lock()
 	defer h.virtualPodsMutex.Unlock()
 
@@ -1296,15 +2053,9 @@ func (h *Host) CreateVirtualPod(ctx context.Context, virtualSandboxID, masterSan
 	}
 
 	// Create cgroup path for this virtual pod under the parent cgroup
-	parentPath := ""
+	parentPath := "/containers/virtual-pods" // fallback for default behavior
 	if h.virtualPodsCgroupParent != nil {
-		if pather, ok := h.virtualPodsCgroupParent.(interface{ Path() string }); ok {
-			parentPath = pather.Path()
-		} else {
-			parentPath = "/containers/virtual-pods" // fallback for default behavior
-		}
-	} else {
-		parentPath = "/containers/virtual-pods" // fallback for default behavior
+		parentPath = h.virtualPodsCgroupParent.Path()
 	}
 	cgroupPath := path.Join(parentPath, virtualSandboxID)
 
@@ -1319,7 +2070,7 @@ func (h *Host) CreateVirtualPod(ctx context.Context, virtualSandboxID, masterSan
 		logrus.WithField("virtualSandboxID", virtualSandboxID).Info("Creating pod cgroup with default resources as none were specified")
 	}
 
-	cgroupControl, err := cgroups.New(cgroups.StaticPath(cgroupPath), resources)
+	cgroupControl, err := cgroup.New(cgroupPath, resources)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create cgroup for virtual pod %s", virtualSandboxID)
 	}
@@ -4,7 +4,11 @@
 package hcsv2
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy"
 )
 
 func Test_Add_Remove_RWDevice(t *testing.T) {
@@ -108,3 +112,75 @@ func Test_HostMounts_IsEncrypted(t *testing.T) {
 		})
 	}
 }
+
+func Test_ReserveEncryptedLayer(t *testing.T) {
+	h := &Host{encryptedLayers: make(map[string]string)}
+	mountPath := "/run/mounts/m1"
+
+	image, err := h.reserveEncryptedLayer(mountPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// the image must not be derived from the mount path of the host
+	if filepath.Dir(image) != encryptedLayersPath {
+		t.Fatalf("expected image in %s, got %s", encryptedLayersPath, image)
+	}
+	if _, err := h.reserveEncryptedLayer(mountPath); err == nil {
+		t.Fatalf("expected error reserving %q for the second time", mountPath)
+	}
+
+	h.releaseEncryptedLayer(mountPath)
+	other, err := h.reserveEncryptedLayer(mountPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if other == image {
+		t.Fatalf("expected a new image, got %s again", image)
+	}
+}
+
+func Test_StageCheckpointImage(t *testing.T) {
+	checkpointImagesPath = filepath.Join(t.TempDir(), "checkpoints")
+	image := t.TempDir()
+	for name, content := range map[string]string{
+		"inventory.img": "inventory",
+		"sub/pages.img": "pages",
+	} {
+		path := filepath.Join(image, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := securitypolicy.CheckpointImageDigest(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, digest, err := stageCheckpointImage("c1", image)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// the image is restored from a copy which the host cannot modify
+	if filepath.Dir(dir) != checkpointImagesPath {
+		t.Fatalf("expected copy in %s, got %s", checkpointImagesPath, dir)
+	}
+	if digest != expected {
+		t.Fatalf("expected digest %s, got %s", expected, digest)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "sub/pages.img")); err != nil || string(b) != "pages" {
+		t.Fatalf("expected copy of image file, got %q: %v", b, err)
+	}
+
+	if err := os.Symlink("/etc/shadow", filepath.Join(image, "link.img")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := stageCheckpointImage("c2", image); err == nil {
+		t.Fatal("expected image with a symbolic link to be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(checkpointImagesPath, "c2")); !os.IsNotExist(err) {
+		t.Fatalf("expected copy of rejected image to be removed: %v", err)
+	}
+}
@@ -29,6 +29,9 @@ type container struct {
 	// ownsPidNamespace indicates whether the container's init process is also
 	// the init process for its pid namespace.
 	ownsPidNamespace bool
+	// restored indicates whether the container was restored from a
+	// checkpoint, in which case it is running already.
+	restored bool
 }
 
 var _ runtime.Container = &container{}
@@ -52,9 +55,12 @@ func (c *container) PipeRelay() *stdio.PipeRelay {
 // Start unblocks the container's init process created by the call to
 // CreateContainer.
 func (c *container) Start() error {
+	if c.restored {
+		return nil
+	}
 	logPath := c.r.getLogPath(c.id)
 	args := []string{"start", c.id}
-	cmd := runcCommandLog(logPath, args...)
+	cmd := c.r.runcCommandLog(logPath, args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		runcErr := getRuncLogError(logPath)
@@ -110,7 +116,7 @@ func (c *container) kill(signal syscall.Signal, all bool) error {
 		args = append(args, "--all")
 	}
 	args = append(args, c.id, strconv.Itoa(int(signal)))
-	cmd := runcCommand(args...)
+	cmd := c.r.runcCommand(args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		runcErr := parseRuncError(string(out))
@@ -123,7 +129,7 @@ func (c *container) kill(signal syscall.Signal, all bool) error {
 // runC itself.
 func (c *container) Delete() error {
 	logrus.WithField(logfields.ContainerID, c.id).Debug("runc::container::Delete")
-	cmd := runcCommand("delete", c.id)
+	cmd := c.r.runcCommand("delete", c.id)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		runcErr := parseRuncError(string(out))
@@ -134,7 +140,7 @@ func (c *container) Delete() error {
 
 // Pause suspends all processes running in the container.
 func (c *container) Pause() error {
-	cmd := runcCommand("pause", c.id)
+	cmd := c.r.runcCommand("pause", c.id)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		runcErr := parseRuncError(string(out))
@@ -147,7 +153,7 @@ func (c *container) Pause() error {
 func (c *container) Resume() error {
 	logPath := c.r.getLogPath(c.id)
 	args := []string{"resume", c.id}
-	cmd := runcCommandLog(logPath, args...)
+	cmd := c.r.runcCommandLog(logPath, args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		if runcErr := getRuncLogError(logPath); runcErr != nil {
@@ -160,19 +166,42 @@ func (c *container) Resume() error {
 	return nil
 }
 
+// Checkpoint writes a CRIU checkpoint image of the container to
+// opts.ImagePath. The container is stopped once it is checkpointed, unless
+// opts.LeaveRunning is set.
+func (c *container) Checkpoint(opts *runtime.CheckpointOptions) error {
+	logPath := c.r.getLogPath(c.id)
+	args := append([]string{"checkpoint"}, checkpointArgs(opts)...)
+	if opts.LeaveRunning {
+		args = append(args, "--leave-running")
+	}
+	args = append(args, c.id)
+	cmd := c.r.runcCommandLog(logPath, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if runcErr := getRuncLogError(logPath); runcErr != nil {
+			return errors.Wrapf(runcErr, "runc checkpoint failed with %v: %s", err, string(out))
+		} else {
+			logrus.Warn("runc checkpoint failed without writing error to log file")
+			return errors.Wrapf(err, "runc checkpoint failed: %s", string(out))
+		}
+	}
+	return nil
+}
+
 // GetState returns information about the given container.
 func (c *container) GetState() (*runtime.ContainerState, error) {
-	cmd := runcCommand("state", c.id)
+	cmd := c.r.runcCommand("state", c.id)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		runcErr := parseRuncError(string(out))
 		return nil, errors.Wrapf(runcErr, "runc state failed with %v: %s", err, string(out))
 	}
-	var state runtime.ContainerState
-	if err := json.Unmarshal(out, &state); err != nil {
+	state, err := parseState(out)
+	if err != nil {
 		return nil, errors.Wrapf(err, "failed to unmarshal the state for container %s", c.id)
 	}
-	return &state, nil
+	return state, nil
 }
 
 // Exists returns true if the container exists, false if it doesn't
@@ -181,7 +210,7 @@ func (c *container) GetState() (*runtime.ContainerState, error) {
 // deleted are still considered to exist.
 func (c *container) Exists() (bool, error) {
 	// use global path because container may not exist
-	cmd := runcCommand("state", c.id)
+	cmd := c.r.runcCommand("state", c.id)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		runcErr := parseRuncError(string(out))
@@ -395,7 +424,7 @@ func (c *container) startProcess(
 	}
 	args = append(args, c.id)
 
-	cmd := runcCommandLog(logPath, args...)
+	cmd := c.r.runcCommandLog(logPath, args...)
 
 	var pipeRelay *stdio.PipeRelay
 	if !hasTerminal {
@@ -471,7 +500,7 @@ func (c *container) Update(resources interface{}) error {
 	if err != nil {
 		return err
 	}
-	cmd := runcCommand("update", "--resources", "-", c.id)
+	cmd := c.r.runcCommand("update", "--resources", "-", c.id)
 	cmd.Stdin = strings.NewReader(string(jsonResources))
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -1,3 +1,4 @@
 // Package runc defines an implementation of the Runtime interface which uses
-// runC as the container runtime.
+// runC as the container runtime, or any other OCI runtime implementing the
+// command line of runC, such as crun or youki.
 package runc
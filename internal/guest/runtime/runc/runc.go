@@ -6,6 +6,7 @@ package runc
 import (
 	"encoding/json"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"strconv"
@@ -32,16 +33,28 @@ func setSubreaper(i int) error {
 
 // NewRuntime instantiates a new runcRuntime struct.
 func NewRuntime(logBasePath string) (runtime.Runtime, error) {
-	rtime := &runcRuntime{runcLogBasePath: logBasePath}
+	return NewOCIRuntime("runc", logBasePath)
+}
+
+// NewOCIRuntime instantiates a runcRuntime which uses binary as the container
+// runtime, rather than runC. binary must implement the command line of runC
+// used by the runtime: the create, start, state, list, ps, kill, delete, exec,
+// pause, resume and update commands, the checkpoint and restore commands for
+// checkpointed containers, and the global --log and --log-format flags, such
+// as crun and youki do.
+func NewOCIRuntime(binary string, logBasePath string) (runtime.Runtime, error) {
+	rtime := &runcRuntime{binary: binary, runcLogBasePath: logBasePath}
 	if err := rtime.initialize(); err != nil {
 		return nil, err
 	}
 	return rtime, nil
 }
 
-// runcRuntime is an implementation of the Runtime interface which uses runC as
-// the container runtime.
+// runcRuntime is an implementation of the Runtime interface which uses runC,
+// or another runtime with the same command line, as the container runtime.
 type runcRuntime struct {
+	// binary is the name or path of the runtime binary.
+	binary          string
 	runcLogBasePath string
 }
 
@@ -49,6 +62,9 @@ var _ runtime.Runtime = &runcRuntime{}
 
 // initialize sets up any state necessary for the runcRuntime to function.
 func (r *runcRuntime) initialize() error {
+	if _, err := exec.LookPath(r.binary); err != nil {
+		return errors.Wrapf(err, "failed to find OCI runtime %s", r.binary)
+	}
 	paths := [2]string{containerFilesDir, r.runcLogBasePath}
 	for _, p := range paths {
 		_, err := os.Stat(p)
@@ -70,7 +86,19 @@ func (r *runcRuntime) initialize() error {
 // bundlePath should be a path to an OCI bundle containing a config.json file
 // and a rootfs for the container.
 func (r *runcRuntime) CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (c runtime.Container, err error) {
-	c, err = r.runCreateCommand(id, bundlePath, stdioSet)
+	c, err = r.runCreateCommand(id, bundlePath, stdioSet, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RestoreContainer restores a container with the given ID from the CRIU
+// checkpoint image at opts.ImagePath. bundlePath should be a path to the OCI
+// bundle of the checkpointed container.
+// Unlike created containers, the restored container is running already.
+func (r *runcRuntime) RestoreContainer(id string, bundlePath string, opts *runtime.CheckpointOptions, stdioSet *stdio.ConnectionSet) (c runtime.Container, err error) {
+	c, err = r.runCreateCommand(id, bundlePath, stdioSet, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -79,15 +107,15 @@ func (r *runcRuntime) CreateContainer(id string, bundlePath string, stdioSet *st
 
 // ListContainerStates returns ContainerState structs for all existing
 // containers, whether they're running or not.
-func (*runcRuntime) ListContainerStates() ([]runtime.ContainerState, error) {
-	cmd := runcCommand("list", "-f", "json")
+func (r *runcRuntime) ListContainerStates() ([]runtime.ContainerState, error) {
+	cmd := r.runcCommand("list", "-f", "json")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		runcErr := parseRuncError(string(out))
 		return nil, errors.Wrapf(runcErr, "runc list failed with %v: %s", err, string(out))
 	}
-	var states []runtime.ContainerState
-	if err := json.Unmarshal(out, &states); err != nil {
+	states, err := parseStates(out)
+	if err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal the states for the container list")
 	}
 	return states, nil
@@ -95,8 +123,8 @@ func (*runcRuntime) ListContainerStates() ([]runtime.ContainerState, error) {
 
 // getRunningPids gets the pids of all processes which runC recognizes as
 // running.
-func (*runcRuntime) getRunningPids(id string) ([]int, error) {
-	cmd := runcCommand("ps", "-f", "json", id)
+func (r *runcRuntime) getRunningPids(id string) ([]int, error) {
+	cmd := r.runcCommand("ps", "-f", "json", id)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		runcErr := parseRuncError(string(out))
@@ -153,8 +181,9 @@ func (r *runcRuntime) waitOnProcess(pid int) (int, error) {
 	return status.ExitStatus(), nil
 }
 
-// runCreateCommand sets up the arguments for calling runc create.
-func (r *runcRuntime) runCreateCommand(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (runtime.Container, error) {
+// runCreateCommand sets up the arguments for calling runc create, or runc
+// restore if restore is not nil.
+func (r *runcRuntime) runCreateCommand(id string, bundlePath string, stdioSet *stdio.ConnectionSet, restore *runtime.CheckpointOptions) (runtime.Container, error) {
 	c := &container{r: r, id: id}
 	if err := r.makeContainerDir(id); err != nil {
 		return nil, err
@@ -193,6 +222,12 @@ func (r *runcRuntime) runCreateCommand(id string, bundlePath string, stdioSet *s
 	}
 
 	args := []string{"create", "-b", bundlePath, "--no-pivot"}
+	if restore != nil {
+		// runc restore creates and starts the container at once.
+		args = []string{"restore", "-b", bundlePath, "--no-pivot", "--detach"}
+		args = append(args, checkpointArgs(restore)...)
+		c.restored = true
+	}
 	p, err := c.startProcess(tempProcessDir, spec.Process.Terminal, stdioSet, args...)
 	if err != nil {
 		return nil, err
@@ -128,6 +128,10 @@ func parseRuncError(s string) (err error) {
 	if strings.HasPrefix(s, "container") && strings.HasSuffix(s, "does not exist") {
 		// match "container %q does not exist" and [libcontainer.ErrNotExist]
 		err = runtime.ErrContainerDoesNotExist
+	} else if strings.Contains(s, "error opening file") && strings.HasSuffix(strings.TrimSpace(s), "/status`: No such file or directory") {
+		// match crun, which fails to open the status file of a container
+		// which does not exist
+		err = runtime.ErrContainerDoesNotExist
 	} else if strings.Contains(s, "container with id exists") || strings.Contains(s, libcontainer.ErrExist.Error()) {
 		err = runtime.ErrContainerAlreadyExists
 	} else if strings.Contains(s, "invalid id format") || strings.Contains(s, libcontainer.ErrInvalidID.Error()) {
@@ -165,11 +169,73 @@ func getRuncLogError(logPath string) error {
 	return lastErr
 }
 
-func runcCommandLog(logPath string, args ...string) *exec.Cmd {
+func (r *runcRuntime) runcCommandLog(logPath string, args ...string) *exec.Cmd {
 	args = append([]string{"--log", logPath, "--log-format", "json"}, args...)
-	return runcCommand(args...)
+	return r.runcCommand(args...)
+}
+
+func (r *runcRuntime) runcCommand(args ...string) *exec.Cmd {
+	return exec.Command(r.binary, args...)
+}
+
+// ociState is the state of a container output by the state and list commands.
+// Runtimes agree on the fields of the state defined by the OCI runtime
+// specification, which are decoded here, but not on the remaining fields. The
+// status is lowercased, as not all runtimes output it as specified.
+type ociState struct {
+	OCIVersion string `json:"ociVersion"`
+	ID         string `json:"id"`
+	Pid        int    `json:"pid"`
+	Status     string `json:"status"`
+	Bundle     string `json:"bundle"`
+	Rootfs     string `json:"rootfs"`
+	Created    string `json:"created"`
+}
+
+func (s *ociState) containerState() runtime.ContainerState {
+	return runtime.ContainerState{
+		OCIVersion: s.OCIVersion,
+		ID:         s.ID,
+		Pid:        s.Pid,
+		BundlePath: s.Bundle,
+		RootfsPath: s.Rootfs,
+		Status:     strings.ToLower(s.Status),
+		Created:    s.Created,
+	}
+}
+
+// parseState parses the output of the state command.
+func parseState(out []byte) (*runtime.ContainerState, error) {
+	var s ociState
+	if err := json.Unmarshal(out, &s); err != nil {
+		return nil, err
+	}
+	state := s.containerState()
+	return &state, nil
 }
 
-func runcCommand(args ...string) *exec.Cmd {
-	return exec.Command("runc", args...)
+// parseStates parses the output of the list command.
+func parseStates(out []byte) ([]runtime.ContainerState, error) {
+	var ss []ociState
+	if err := json.Unmarshal(out, &ss); err != nil {
+		return nil, err
+	}
+	states := make([]runtime.ContainerState, 0, len(ss))
+	for i := range ss {
+		states = append(states, ss[i].containerState())
+	}
+	return states, nil
+}
+
+// checkpointArgs returns the arguments of runc checkpoint and restore for the
+// CRIU options shared by both.
+func checkpointArgs(opts *runtime.CheckpointOptions) []string {
+	args := []string{"--image-path", opts.ImagePath}
+	if opts.WorkPath != "" {
+		args = append(args, "--work-path", opts.WorkPath)
+	}
+	if opts.TCPEstablished {
+		args = append(args, "--tcp-established")
+	}
+	return args
 }
@@ -0,0 +1,74 @@
+//go:build linux
+// +build linux
+
+package runc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Microsoft/hcsshim/internal/guest/runtime"
+)
+
+func Test_ParseState(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+	}{
+		{
+			name: "runc",
+			out:  `{"ociVersion":"1.0.2-dev","id":"c","pid":42,"status":"running","bundle":"/run/gcs/c/c","rootfs":"/run/gcs/c/c/rootfs","created":"2024-01-01T00:00:00Z","owner":""}`,
+		},
+		{
+			name: "youki",
+			out:  `{"ociVersion":"v1.0.2","id":"c","status":"Running","pid":42,"bundle":"/run/gcs/c/c","rootfs":"/run/gcs/c/c/rootfs","annotations":{},"created":"2024-01-01T00:00:00Z","creator":0,"use_systemd":false}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			state, err := parseState([]byte(tc.out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.ID != "c" || state.Pid != 42 || state.Status != "running" {
+				t.Fatalf("unexpected state %+v", state)
+			}
+			if state.BundlePath != "/run/gcs/c/c" || state.RootfsPath != "/run/gcs/c/c/rootfs" {
+				t.Fatalf("unexpected paths of state %+v", state)
+			}
+		})
+	}
+}
+
+func Test_ParseStates(t *testing.T) {
+	states, err := parseStates([]byte(`[{"id":"a","pid":1,"status":"created","bundle":"/a","created":"2024-01-01T00:00:00Z"},{"id":"b","pid":0,"status":"stopped","bundle":"/b","created":"2024-01-01T00:00:00Z"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []runtime.ContainerState{
+		{ID: "a", Pid: 1, Status: "created", BundlePath: "/a", Created: "2024-01-01T00:00:00Z"},
+		{ID: "b", Status: "stopped", BundlePath: "/b", Created: "2024-01-01T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, states)
+	}
+
+	states, err = parseStates([]byte("null"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states == nil || len(states) != 0 {
+		t.Fatalf("expected no states, got %+v", states)
+	}
+}
+
+func Test_ParseRuncError_Does_Not_Exist(t *testing.T) {
+	for _, s := range []string{
+		`container "c" does not exist`,
+		"error opening file `/run/crun/c/status`: No such file or directory",
+	} {
+		if err := parseRuncError(s); !errors.Is(err, runtime.ErrContainerDoesNotExist) {
+			t.Errorf("expected %q to be parsed as a missing container, got: %v", s, err)
+		}
+	}
+}
@@ -42,6 +42,22 @@ type ContainerProcessState struct {
 	IsZombie         bool
 }
 
+// CheckpointOptions are the options of checkpointing a container with CRIU,
+// and of restoring a container from its checkpoint.
+type CheckpointOptions struct {
+	// ImagePath is the directory of the checkpoint image.
+	ImagePath string
+	// WorkPath is the directory CRIU writes its logs to, which defaults to
+	// ImagePath.
+	WorkPath string
+	// LeaveRunning keeps the container running once it is checkpointed,
+	// rather than stopping it.
+	LeaveRunning bool
+	// TCPEstablished checkpoints and restores the established TCP connections
+	// of the container.
+	TCPEstablished bool
+}
+
 // StdioPipes contain the interfaces for reading from and writing to a
 // process's stdio.
 type StdioPipes struct {
@@ -74,11 +90,13 @@ type Container interface {
 	GetAllProcesses() ([]ContainerProcessState, error)
 	GetInitProcess() (Process, error)
 	Update(resources interface{}) error
+	Checkpoint(opts *CheckpointOptions) error
 }
 
 // Runtime is the interface defining commands over an OCI container runtime,
 // such as runC.
 type Runtime interface {
 	CreateContainer(id string, bundlePath string, stdioSet *stdio.ConnectionSet) (c Container, err error)
+	RestoreContainer(id string, bundlePath string, opts *CheckpointOptions, stdioSet *stdio.ConnectionSet) (c Container, err error)
 	ListContainerStates() ([]ContainerState, error)
 }
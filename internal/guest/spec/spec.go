@@ -531,6 +531,16 @@ func AddDevSev(ctx context.Context, spec *oci.Spec) error {
 	return nil
 }
 
+// AddDevTdxGuest adds the TDX guest device to container spec.
+func AddDevTdxGuest(ctx context.Context, spec *oci.Spec) error {
+	devTdx, err := devices.DeviceFromPath("/dev/tdx_guest", "rwm")
+	if err != nil {
+		return fmt.Errorf("failed to add TDX device to spec: %w", err)
+	}
+	AddLinuxDeviceToSpec(ctx, devTdx, spec, true)
+	return nil
+}
+
 // devShmMountWithSize returns a /dev/shm device mount with size set to
 // `sizeString` if it represents a valid size in KB, returns error otherwise.
 func devShmMountWithSize(sizeString string) (*oci.Mount, error) {
@@ -0,0 +1,332 @@
+//go:build linux
+// +build linux
+
+package stdio
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Microsoft/hcsshim/internal/guest/transport"
+)
+
+// replayBufferSize bounds the output of a stream which is kept while no
+// connection is attached to it.
+const replayBufferSize = 256 * 1024
+
+// errRelayClosed is returned when attaching to the stdio of a process which
+// has exited.
+var errRelayClosed = errors.New("stdio relay is closed")
+
+// ringBuffer keeps the latest output written to it, up to replayBufferSize.
+type ringBuffer struct {
+	buf   []byte
+	start int
+	n     int
+	// dropped is the number of bytes overwritten since the last take.
+	dropped int64
+}
+
+func (r *ringBuffer) write(p []byte) {
+	if r.buf == nil {
+		r.buf = make([]byte, replayBufferSize)
+	}
+	size := len(r.buf)
+	if len(p) >= size {
+		r.dropped += int64(r.n + len(p) - size)
+		copy(r.buf, p[len(p)-size:])
+		r.start, r.n = 0, size
+		return
+	}
+	end := (r.start + r.n) % size
+	c := copy(r.buf[end:], p)
+	copy(r.buf, p[c:])
+	r.n += len(p)
+	if r.n > size {
+		// the oldest output was overwritten
+		r.dropped += int64(r.n - size)
+		r.start = (r.start + r.n - size) % size
+		r.n = size
+	}
+}
+
+// take returns the buffered output, from the oldest, and empties the buffer.
+func (r *ringBuffer) take() (b []byte, dropped int64) {
+	b = make([]byte, r.n)
+	c := copy(b, r.buf[r.start:min(r.start+r.n, len(r.buf))])
+	copy(b[c:], r.buf[:r.n-c])
+	dropped = r.dropped
+	*r = ringBuffer{}
+	return b, dropped
+}
+
+// outputRelay copies an output stream of a process to the connections attached
+// to it. While none are, the latest output is kept in a ring buffer, which is
+// replayed to the next connection to attach.
+//
+// All of the output is also written to the log, if there is one, whether or not
+// a connection is attached. The log does not count as an attached connection.
+type outputRelay struct {
+	name string
+	// cleanClose waits for the host to close each connection once the stream
+	// ends, rather than closing it right away.
+	cleanClose bool
+	// log is closed once the stream ends.
+	log       io.WriteCloser
+	logFailed bool
+
+	m     sync.Mutex
+	conns []transport.Connection
+	buf   ringBuffer
+	done  bool
+}
+
+func newOutputRelay(name string, c transport.Connection, log io.WriteCloser, cleanClose bool) *outputRelay {
+	r := &outputRelay{name: name, cleanClose: cleanClose, log: log}
+	if c != nil {
+		r.conns = []transport.Connection{c}
+	}
+	return r
+}
+
+// attach replays the buffered output to c, and then writes the output of the
+// stream to it, along with the connections attached before. If the stream has
+// already ended, c is closed once the buffered output is replayed.
+func (r *outputRelay) attach(c transport.Connection) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.buf.n > 0 {
+		b, dropped := r.buf.take()
+		if dropped > 0 {
+			logrus.WithFields(logrus.Fields{
+				"file":  r.name,
+				"bytes": dropped,
+			}).Warn("opengcs::outputRelay::attach - output was dropped while detached")
+		}
+		if _, err := c.Write(b); err != nil {
+			logrus.WithFields(logrus.Fields{
+				logrus.ErrorKey: err,
+				"file":          r.name,
+			}).Error("opengcs::outputRelay::attach - error replaying output")
+			c.Close()
+			return
+		}
+	}
+	if r.done {
+		go r.close(c)
+		return
+	}
+	r.conns = append(r.conns, c)
+}
+
+// run copies the stream from src until it ends, and then closes the attached
+// connections.
+func (r *outputRelay) run(src io.Reader) {
+	var n int64
+	b := make([]byte, 32*1024)
+	for {
+		nr, err := src.Read(b)
+		if nr > 0 {
+			r.write(b[:nr])
+			n += int64(nr)
+		}
+		if err != nil {
+			if err != io.EOF { //nolint:errorlint
+				logrus.WithFields(logrus.Fields{
+					logrus.ErrorKey: err,
+					"bytes":         n,
+					"file":          r.name,
+				}).Error("opengcs::outputRelay::run - error copying from stream")
+			}
+			break
+		}
+	}
+
+	r.m.Lock()
+	conns := r.conns
+	r.conns = nil
+	r.done = true
+	r.m.Unlock()
+
+	if r.log != nil {
+		if err := r.log.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{
+				logrus.ErrorKey: err,
+				"file":          r.name,
+			}).Error("opengcs::outputRelay::run - error closing log")
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c transport.Connection) {
+			defer wg.Done()
+			r.close(c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// write writes b to the log and the attached connections, detaching those which
+// fail, or to the buffer if none are attached. Failures to write to the log are
+// logged once, and do not stop the output from being relayed.
+func (r *outputRelay) write(b []byte) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.log != nil && !r.logFailed {
+		if _, err := r.log.Write(b); err != nil {
+			r.logFailed = true
+			logrus.WithFields(logrus.Fields{
+				logrus.ErrorKey: err,
+				"file":          r.name,
+			}).Error("opengcs::outputRelay::write - error writing to log")
+		}
+	}
+	conns := r.conns[:0]
+	for _, c := range r.conns {
+		if _, err := c.Write(b); err != nil {
+			logrus.WithFields(logrus.Fields{
+				logrus.ErrorKey: err,
+				"file":          r.name,
+			}).Warn("opengcs::outputRelay::write - detaching connection after error")
+			c.Close()
+			continue
+		}
+		conns = append(conns, c)
+	}
+	r.conns = conns
+	if len(r.conns) == 0 {
+		r.buf.write(b)
+	}
+}
+
+func (r *outputRelay) close(c transport.Connection) {
+	if !r.cleanClose {
+		if err := c.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{
+				logrus.ErrorKey: err,
+				"file":          r.name,
+			}).Error("opengcs::outputRelay::close - error closing socket")
+		}
+		return
+	}
+	// Shut down the write end of the socket, then read a byte (which should
+	// yield EOF) to wait for the other endpoint to finish reading and close
+	// the connection.
+	if err := c.CloseWrite(); err == nil {
+		var b [1]byte
+		_, err = c.Read(b[:])
+		if err == nil {
+			err = errors.New("unexpected data in socket")
+		}
+		if err != io.EOF { //nolint:errorlint
+			logrus.WithFields(logrus.Fields{
+				logrus.ErrorKey: err,
+				"file":          r.name,
+			}).Error("opengcs::outputRelay::close - error reading for clean close")
+		}
+	} else {
+		logrus.WithFields(logrus.Fields{
+			logrus.ErrorKey: err,
+			"file":          r.name,
+		}).Error("opengcs::outputRelay::close - error shutting down socket")
+	}
+	if err := c.Close(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			logrus.ErrorKey: err,
+			"file":          r.name,
+		}).Error("opengcs::outputRelay::close - error closing socket")
+	}
+}
+
+// inputRelay copies the input of the connections attached to it to the stdin
+// of a process.
+type inputRelay struct {
+	name string
+	dst  io.Writer
+	// closeDst closes the stdin of the process once a connection reaches EOF,
+	// if set.
+	closeDst func()
+
+	m     sync.Mutex
+	wg    sync.WaitGroup
+	conns []transport.Connection
+	// eof is set once the input of a connection ends, closing stdin.
+	eof    bool
+	closed bool
+}
+
+func newInputRelay(name string, dst io.Writer, closeDst func()) *inputRelay {
+	return &inputRelay{name: name, dst: dst, closeDst: closeDst}
+}
+
+// attach starts copying the input of c to the process. If stdin was already
+// closed, c is closed.
+func (r *inputRelay) attach(c transport.Connection) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return errRelayClosed
+	}
+	if r.eof {
+		return c.Close()
+	}
+	r.conns = append(r.conns, c)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		_, err := io.Copy(r.dst, c)
+		if err != nil {
+			// The stdin of the process is kept open, since the connection
+			// may have failed as the host went away, and another one may be
+			// attached once it reconnects.
+			logrus.WithFields(logrus.Fields{
+				logrus.ErrorKey: err,
+				"file":          r.name,
+			}).Error("opengcs::inputRelay::attach - error copying to stdin")
+			return
+		}
+		r.m.Lock()
+		defer r.m.Unlock()
+		if !r.eof && r.closeDst != nil {
+			r.closeDst()
+		}
+		r.eof = true
+	}()
+	return nil
+}
+
+// wait unblocks the copies of the attached connections and waits for them to
+// finish. No connections can be attached afterwards.
+func (r *inputRelay) wait() {
+	r.m.Lock()
+	r.closed = true
+	for _, c := range r.conns {
+		// Close stdin so that the copying goroutine is safely unblocked; this is necessary
+		// because the host expects stdin to be closed before it will report process
+		// exit back to the client, and the client expects the process notification before
+		// it will close its side of stdin (which io.Copy is waiting on in the copying goroutine).
+		_ = c.CloseRead()
+	}
+	r.m.Unlock()
+	r.wg.Wait()
+}
+
+// closeConns closes the attached connections, once the relay has waited.
+func (r *inputRelay) closeConns() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, c := range r.conns {
+		if err := c.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{
+				logrus.ErrorKey: err,
+				"file":          r.name,
+			}).Error("opengcs::inputRelay::closeConns - error closing socket")
+		}
+	}
+	r.conns = nil
+}
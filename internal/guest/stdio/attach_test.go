@@ -0,0 +1,291 @@
+//go:build linux
+// +build linux
+
+package stdio
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// connPair returns the two ends of a connected unix socket, the first of which
+// stands in for the vsock connection of the guest, and the second for that of
+// the host.
+func connPair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = c.(*net.UnixConn)
+		t.Cleanup(func() { conns[i].Close() })
+	}
+	return conns[0], conns[1]
+}
+
+// readAll reads from the host end of a connection until the guest closes it.
+func readAll(t *testing.T, c *net.UnixConn) string {
+	t.Helper()
+	if err := c.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("failed to read connection: %v", err)
+	}
+	return string(b)
+}
+
+func Test_RingBuffer(t *testing.T) {
+	var r ringBuffer
+	r.write([]byte("hello "))
+	r.write([]byte("world"))
+	if b, dropped := r.take(); string(b) != "hello world" || dropped != 0 {
+		t.Fatalf("expected %q with none dropped, got %q with %d dropped", "hello world", b, dropped)
+	}
+	if b, _ := r.take(); len(b) != 0 {
+		t.Fatalf("expected buffer to be empty after take, got %q", b)
+	}
+
+	// wrap around the end of the buffer
+	first := bytes.Repeat([]byte("a"), replayBufferSize-10)
+	r.write(first)
+	r.write([]byte("0123456789abcdef"))
+	b, dropped := r.take()
+	if dropped != 6 {
+		t.Fatalf("expected 6 bytes dropped, got %d", dropped)
+	}
+	if len(b) != replayBufferSize || !bytes.HasSuffix(b, []byte("aaaa0123456789abcdef")) {
+		t.Fatalf("expected the latest %d bytes, got %d ending with %q", replayBufferSize, len(b), b[len(b)-20:])
+	}
+
+	// a write larger than the buffer keeps only its end
+	large := append(bytes.Repeat([]byte("b"), replayBufferSize), []byte("end")...)
+	r.write([]byte("x"))
+	r.write(large)
+	b, dropped = r.take()
+	if dropped != 4 {
+		t.Fatalf("expected 4 bytes dropped, got %d", dropped)
+	}
+	if !bytes.Equal(b, large[3:]) {
+		t.Fatalf("expected the end of the large write, got %d bytes", len(b))
+	}
+}
+
+func Test_OutputRelay_Replay(t *testing.T) {
+	r := newOutputRelay("stdout", nil, nil, false)
+	// nothing is attached, so the output is kept
+	r.write([]byte("hello"))
+
+	guest1, host1 := connPair(t)
+	r.attach(guest1)
+	r.write([]byte(" world"))
+
+	// a second reader only receives the output from when it attached
+	guest2, host2 := connPair(t)
+	r.attach(guest2)
+	r.write([]byte("!"))
+
+	r.run(strings.NewReader("?"))
+	if out := readAll(t, host1); out != "hello world!?" {
+		t.Fatalf("expected first reader to get %q, got %q", "hello world!?", out)
+	}
+	if out := readAll(t, host2); out != "!?" {
+		t.Fatalf("expected second reader to get %q, got %q", "!?", out)
+	}
+}
+
+func Test_OutputRelay_Detach_On_Error(t *testing.T) {
+	r := newOutputRelay("stdout", nil, nil, false)
+	guest1, host1 := connPair(t)
+	r.attach(guest1)
+	r.write([]byte("before"))
+	b := make([]byte, 6)
+	if _, err := io.ReadFull(host1, b); err != nil || string(b) != "before" {
+		t.Fatalf("expected %q, got %q: %v", "before", b, err)
+	}
+
+	// the host went away, so the output is kept until it attaches again
+	guest1.Close()
+	r.write([]byte("while detached"))
+	guest2, host2 := connPair(t)
+	r.attach(guest2)
+
+	r.run(strings.NewReader(""))
+	if out := readAll(t, host2); out != "while detached" {
+		t.Fatalf("expected replayed output %q, got %q", "while detached", out)
+	}
+
+	// attaching once the stream ended replays and closes the connection
+	r.write([]byte("late"))
+	guest3, host3 := connPair(t)
+	r.attach(guest3)
+	if out := readAll(t, host3); out != "late" {
+		t.Fatalf("expected replayed output %q, got %q", "late", out)
+	}
+}
+
+// syncBuffer is a bytes.Buffer which can be written concurrently.
+type syncBuffer struct {
+	m sync.Mutex
+	b bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.b.String()
+}
+
+// closeBuffer is a log which records whether it was closed.
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func Test_OutputRelay_Log(t *testing.T) {
+	var log closeBuffer
+	r := newOutputRelay("stdout", nil, &log, false)
+	// the log is not an attached connection, so the output is also kept
+	r.write([]byte("hello"))
+
+	guest, host := connPair(t)
+	r.attach(guest)
+	r.write([]byte(" world"))
+
+	r.run(strings.NewReader(""))
+	if out := readAll(t, host); out != "hello world" {
+		t.Fatalf("expected replayed output %q, got %q", "hello world", out)
+	}
+	if out := log.String(); out != "hello world" {
+		t.Fatalf("expected log %q, got %q", "hello world", out)
+	}
+	if !log.closed {
+		t.Fatal("expected log to be closed once the stream ended")
+	}
+}
+
+func Test_InputRelay_Attach(t *testing.T) {
+	dst := &syncBuffer{}
+	closed := 0
+	r := newInputRelay("stdin", dst, func() { closed++ })
+
+	guest1, host1 := connPair(t)
+	if err := r.attach(guest1); err != nil {
+		t.Fatal(err)
+	}
+	guest2, host2 := connPair(t)
+	if err := r.attach(guest2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := host1.Write([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	// the first input to end closes stdin
+	if err := host1.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := host2.Write([]byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if err := host2.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	r.wait()
+	r.closeConns()
+
+	if in := dst.String(); in != "onetwo" && in != "twoone" {
+		t.Fatalf("expected the input of both connections, got %q", in)
+	}
+	if closed != 1 {
+		t.Fatalf("expected stdin to be closed once, got %d", closed)
+	}
+
+	guest3, _ := connPair(t)
+	if err := r.attach(guest3); err != errRelayClosed { //nolint:errorlint
+		t.Fatalf("expected attach after wait to fail with %v, got %v", errRelayClosed, err)
+	}
+}
+
+func Test_PipeRelay_Attach(t *testing.T) {
+	// the process has stdout and stderr, but the host did not connect to
+	// stdout before it went away
+	pr, err := NewPipeRelay(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guestErr, hostErr := connPair(t)
+	pr.ReplaceConnectionSet(&ConnectionSet{Err: guestErr})
+	pr.pipes[0].Close()
+	pr.pipes[1].Close()
+	pr.pipes[0], pr.pipes[1] = nil, nil
+
+	guestIn, _ := connPair(t)
+	if err := pr.Attach(&ConnectionSet{In: guestIn}); err == nil {
+		t.Fatal("expected attach before start to fail")
+	}
+	pr.Start()
+
+	if _, err := pr.pipes[3].Write([]byte("out")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pr.Attach(&ConnectionSet{In: guestIn}); err == nil {
+		t.Fatal("expected attach to missing stdin to fail")
+	}
+
+	guestOut, hostOut := connPair(t)
+	guestErr2, hostErr2 := connPair(t)
+	if err := pr.Attach(&ConnectionSet{Out: guestOut, Err: guestErr2}); err != nil {
+		t.Fatalf("failed to attach: %v", err)
+	}
+	if _, err := pr.pipes[5].Write([]byte("err")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the process exits, closing the write ends of its pipes
+	pr.pipes[3].Close()
+	pr.pipes[5].Close()
+	pr.pipes[3], pr.pipes[5] = nil, nil
+	for _, c := range []struct {
+		host *net.UnixConn
+		want string
+	}{
+		{hostOut, "out"},
+		{hostErr, "err"},
+		{hostErr2, "err"},
+	} {
+		if out := readAll(t, c.host); out != c.want {
+			t.Fatalf("expected %q, got %q", c.want, out)
+		}
+		// the relay waits for the host to close the connection
+		c.host.Close()
+	}
+	pr.Wait()
+}
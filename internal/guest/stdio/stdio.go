@@ -18,13 +18,30 @@ import (
 // implementation should forward a process's stdio through.
 type ConnectionSet struct {
 	In, Out, Err transport.Connection
+	// OutLog and ErrLog, if set, are written all of the output of stdout and
+	// stderr, whether or not a connection is attached to them. They are not
+	// connections, so the output is still kept for a later Attach while none
+	// are attached.
+	OutLog, ErrLog io.WriteCloser
 }
 
-// Close closes each stdio connection.
+// Close closes each stdio connection and log.
 func (s *ConnectionSet) Close() error {
 	var err error
+	if s.OutLog != nil {
+		if cerr := s.OutLog.Close(); cerr != nil {
+			err = errors.Wrap(cerr, "failed Close on stdout log")
+		}
+		s.OutLog = nil
+	}
+	if s.ErrLog != nil {
+		if cerr := s.ErrLog.Close(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "failed Close on stderr log")
+		}
+		s.ErrLog = nil
+	}
 	if s.In != nil {
-		if cerr := s.In.Close(); cerr != nil {
+		if cerr := s.In.Close(); cerr != nil && err == nil {
 			err = errors.Wrap(cerr, "failed Close on stdin")
 		}
 		s.In = nil
@@ -44,6 +61,16 @@ func (s *ConnectionSet) Close() error {
 	return err
 }
 
+// hasOut returns whether stdout is relayed to a connection or a log.
+func (s *ConnectionSet) hasOut() bool {
+	return s.Out != nil || s.OutLog != nil
+}
+
+// hasErr returns whether stderr is relayed to a connection or a log.
+func (s *ConnectionSet) hasErr() bool {
+	return s.Err != nil || s.ErrLog != nil
+}
+
 // FileSet represents the stdio of a process. It contains os.File types for
 // in, out, err.
 type FileSet struct {
@@ -120,13 +147,13 @@ func NewPipeRelay(s *ConnectionSet) (_ *PipeRelay, err error) {
 			return nil, errors.Wrap(err, "failed to create stdin pipe relay")
 		}
 	}
-	if s == nil || s.Out != nil {
+	if s == nil || s.hasOut() {
 		pr.pipes[2], pr.pipes[3], err = os.Pipe()
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create stdout pipe relay")
 		}
 	}
-	if s == nil || s.Err != nil {
+	if s == nil || s.hasErr() {
 		pr.pipes[4], pr.pipes[5], err = os.Pipe()
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create stderr pipe relay")
@@ -142,6 +169,12 @@ type PipeRelay struct {
 	s  *ConnectionSet
 	// pipes format is stdin [0 read, 1 write], stdout [2 read, 3 write], stderr [4 read, 5 write].
 	pipes [6]*os.File
+
+	// m guards the relays of the streams, which are set by Start.
+	m        sync.Mutex
+	started  bool
+	in       *inputRelay
+	out, err *outputRelay
 }
 
 // ReplaceConnectionSet allows the caller to add a new destination set after
@@ -157,102 +190,101 @@ func (pr *PipeRelay) Files() (*FileSet, error) {
 	if pr.s == nil || pr.s.In != nil {
 		fs.In = pr.pipes[0]
 	}
-	if pr.s == nil || pr.s.Out != nil {
+	if pr.s == nil || pr.s.hasOut() {
 		fs.Out = pr.pipes[3]
 	}
-	if pr.s == nil || pr.s.Err != nil {
+	if pr.s == nil || pr.s.hasErr() {
 		fs.Err = pr.pipes[5]
 	}
 	return fs, nil
 }
 
-func copyAndCleanClose(c transport.Connection, r io.Reader, name string) {
-	if n, err := io.Copy(c, r); err != nil {
-		logrus.WithFields(logrus.Fields{
-			logrus.ErrorKey: err,
-			"bytes":         n,
-			"file":          name,
-		}).Error("opengcs::PipeRelay::copyAndCleanClose - error copying from pipe")
-	}
-	// Shut down the write end of the socket, then read a byte (which should
-	// yield EOF) to wait for the other endpoint to finish reading and close
-	// the connection.
-	if err := c.CloseWrite(); err == nil {
-		var b [1]byte
-		_, err = c.Read(b[:])
-		if err == nil {
-			err = errors.New("unexpected data in socket")
-		}
-		if err != io.EOF { //nolint:errorlint
-			logrus.WithFields(logrus.Fields{
-				logrus.ErrorKey: err,
-				"file":          name,
-			}).Error("opengcs::PipeRelay::copyAndCleanClose - error reading for clean close")
-		}
-	} else {
-		logrus.WithFields(logrus.Fields{
-			logrus.ErrorKey: err,
-			"file":          name,
-		}).Error("opengcs::PipeRelay::copyAndCleanClose - error shutting down socket")
-	}
-	if err := c.Close(); err != nil {
-		logrus.WithFields(logrus.Fields{
-			logrus.ErrorKey: err,
-			"file":          name,
-		}).Error("opengcs::PipeRelay::copyAndCleanClose - error closing socket")
-	}
-}
-
 // Start starts the relay operation. The caller must call Wait to wait
 // for the relay to finish and release the associated resources.
 func (pr *PipeRelay) Start() {
-	if pr.s.In != nil {
-		pr.wg.Add(1)
-		go func() {
-			if n, err := io.Copy(pr.pipes[1], pr.s.In); err != nil {
-				logrus.WithFields(logrus.Fields{
-					logrus.ErrorKey: err,
-					"bytes":         n,
-				}).Error("opengcs::PipeRelay::Start - error copying stdin to pipe")
-			}
+	pr.m.Lock()
+	defer pr.m.Unlock()
+	pr.started = true
+	if pr.pipes[1] != nil {
+		pr.in = newInputRelay("stdin", pr.pipes[1], func() {
 			if err := pr.pipes[1].Close(); err != nil {
 				logrus.WithFields(logrus.Fields{
 					logrus.ErrorKey: err,
 				}).Error("opengcs::PipeRelay::Start - error closing stdin write pipe")
 			}
 			pr.pipes[1] = nil
-			pr.wg.Done()
-		}()
+		})
+		if pr.s.In != nil {
+			// a new relay cannot be closed
+			_ = pr.in.attach(pr.s.In)
+		}
 	}
-	if pr.s.Out != nil {
+	if pr.pipes[2] != nil {
+		pr.out = newOutputRelay("stdout", pr.s.Out, pr.s.OutLog, true)
 		pr.wg.Add(1)
 		go func() {
-			copyAndCleanClose(pr.s.Out, pr.pipes[2], "stdout")
+			pr.out.run(pr.pipes[2])
 			pr.wg.Done()
 		}()
 	}
-	if pr.s.Err != nil {
+	if pr.pipes[4] != nil {
+		pr.err = newOutputRelay("stderr", pr.s.Err, pr.s.ErrLog, true)
 		pr.wg.Add(1)
 		go func() {
-			copyAndCleanClose(pr.s.Err, pr.pipes[4], "stderr")
+			pr.err.run(pr.pipes[4])
 			pr.wg.Done()
 		}()
 	}
+	// the relays own the connections of the set from now on
+	pr.s = &ConnectionSet{}
+}
+
+// Attach attaches the connections of s to the stdio of the running process,
+// as when the host reconnects after losing the connections it relayed to. The
+// output which was kept while no connection was attached is replayed to them.
+// Several sets of connections can be attached at once, and each receives all
+// of the output of the process.
+//
+// Streams which the process does not have cannot be attached. The caller
+// closes s if Attach fails.
+func (pr *PipeRelay) Attach(s *ConnectionSet) error {
+	pr.m.Lock()
+	defer pr.m.Unlock()
+	if !pr.started {
+		return errors.New("stdio relay is not started")
+	}
+	if (s.In != nil && pr.in == nil) || (s.Out != nil && pr.out == nil) || (s.Err != nil && pr.err == nil) {
+		return errors.New("process does not have the stdio to attach to")
+	}
+	if s.In != nil {
+		if err := pr.in.attach(s.In); err != nil {
+			return err
+		}
+	}
+	if s.Out != nil {
+		pr.out.attach(s.Out)
+	}
+	if s.Err != nil {
+		pr.err.attach(s.Err)
+	}
+	return nil
 }
 
 // Wait waits for the relaying to finish and closes the associated
 // pipes and connections.
 func (pr *PipeRelay) Wait() {
-	// Close stdin so that the copying goroutine is safely unblocked; this is necessary
-	// because the host expects stdin to be closed before it will report process
-	// exit back to the client, and the client expects the process notification before
-	// it will close its side of stdin (which io.Copy is waiting on in the copying goroutine).
-	if pr.s != nil && pr.s.In != nil {
-		_ = pr.s.In.CloseRead()
+	pr.m.Lock()
+	in := pr.in
+	pr.m.Unlock()
+	if in != nil {
+		in.wait()
 	}
 
 	pr.wg.Wait()
 	pr.closePipes()
+	if in != nil {
+		in.closeConns()
+	}
 	if pr.s != nil {
 		pr.s.Close()
 	}
@@ -266,17 +298,21 @@ func (pr *PipeRelay) CloseUnusedPipes() {
 	if pr.s == nil {
 		pr.closePipes()
 	} else {
-		if pr.s.In == nil {
+		// The closed pipes are cleared, so that Start does not relay them.
+		if pr.s.In == nil && pr.pipes[1] != nil {
 			// Write end of stdin
 			pr.pipes[1].Close()
+			pr.pipes[1] = nil
 		}
-		if pr.s.Out == nil {
+		if !pr.s.hasOut() && pr.pipes[2] != nil {
 			// Read end of stdout
 			pr.pipes[2].Close()
+			pr.pipes[2] = nil
 		}
-		if pr.s.Err == nil {
+		if !pr.s.hasErr() && pr.pipes[4] != nil {
 			// Read end of stderr
 			pr.pipes[4].Close()
+			pr.pipes[4] = nil
 		}
 	}
 }
@@ -308,6 +344,10 @@ type TtyRelay struct {
 	wg     sync.WaitGroup
 	s      *ConnectionSet
 	pty    *os.File
+
+	// in and out are the relays of the streams, which are set by Start.
+	in  *inputRelay
+	out *outputRelay
 }
 
 // ReplaceConnectionSet allows the caller to add a new destination set after
@@ -330,39 +370,65 @@ func (r *TtyRelay) ResizeConsole(height, width uint16) error {
 // Start starts the relay operation. The caller must call Wait to wait
 // for the relay to finish and release the associated resources.
 func (r *TtyRelay) Start() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.in = newInputRelay("stdin", r.pty, nil)
 	if r.s.In != nil {
-		r.wg.Add(1)
-		go func() {
-			if _, err := io.Copy(r.pty, r.s.In); err != nil {
-				logrus.WithFields(logrus.Fields{
-					logrus.ErrorKey: err,
-				}).Error("opengcs::TtyRelay::Start - error copying stdin to pty")
-			}
-			r.wg.Done()
-		}()
+		// a new relay cannot be closed
+		_ = r.in.attach(r.s.In)
 	}
-	if r.s.Out != nil {
-		r.wg.Add(1)
-		go func() {
-			if _, err := io.Copy(r.s.Out, r.pty); err != nil {
-				logrus.WithFields(logrus.Fields{
-					logrus.ErrorKey: err,
-				}).Error("opengcs::TtyRelay::Start - error copying pty to stdout")
-			}
-			r.wg.Done()
-		}()
+	// the output of the pty is relayed, or kept for a later Attach, even if
+	// there is no connection for it yet
+	r.out = newOutputRelay("stdout", r.s.Out, r.s.OutLog, false)
+	r.wg.Add(1)
+	go func() {
+		r.out.run(r.pty)
+		r.wg.Done()
+	}()
+	if r.s.Err != nil {
+		// a pty has no separate stderr
+		r.s.Err.Close()
 	}
+	if r.s.ErrLog != nil {
+		r.s.ErrLog.Close()
+	}
+	// the relays own the connections of the set from now on
+	r.s = &ConnectionSet{}
+}
+
+// Attach attaches the connections of s to the pty of the running process, as
+// PipeRelay.Attach does. A pty has no separate stderr, so s.Err is closed.
+func (r *TtyRelay) Attach(s *ConnectionSet) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return errRelayClosed
+	}
+	if r.out == nil {
+		return errors.New("stdio relay is not started")
+	}
+	if s.In != nil {
+		if err := r.in.attach(s.In); err != nil {
+			return err
+		}
+	}
+	if s.Out != nil {
+		r.out.attach(s.Out)
+	}
+	if s.Err != nil {
+		s.Err.Close()
+	}
+	return nil
 }
 
 // Wait waits for the relaying to finish and closes the associated
 // files and connections.
 func (r *TtyRelay) Wait() {
-	// Close stdin so that the copying goroutine is safely unblocked; this is necessary
-	// because the host expects stdin to be closed before it will report process
-	// exit back to the client, and the client expects the process notification before
-	// it will close its side of stdin (which io.Copy is waiting on in the copying goroutine).
-	if r.s != nil && r.s.In != nil {
-		_ = r.s.In.CloseRead()
+	r.m.Lock()
+	in := r.in
+	r.m.Unlock()
+	if in != nil {
+		in.wait()
 	}
 
 	// Wait for all users of stdioSet and master to finish before closing them.
@@ -373,6 +439,9 @@ func (r *TtyRelay) Wait() {
 
 	r.pty.Close()
 	r.closed = true
+	if in != nil {
+		in.closeConns()
+	}
 	if r.s != nil {
 		r.s.Close()
 	}
@@ -5,6 +5,9 @@ package crypt
 
 import (
 	"context"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha512"
 	"fmt"
 	"os"
 	"os/exec"
@@ -12,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Microsoft/hcsshim/internal/guest/storage/devicemapper"
 	"github.com/Microsoft/hcsshim/internal/log"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -20,13 +24,18 @@ import (
 
 // Test dependencies
 var (
-	_cryptsetupClose  = cryptsetupClose
-	_cryptsetupFormat = cryptsetupFormat
-	_cryptsetupOpen   = cryptsetupOpen
-	_generateKeyFile  = generateKeyFile
-	_osMkdirTemp      = os.MkdirTemp
-	_osRemoveAll      = os.RemoveAll
-	_zeroFirstBlock   = zeroFirstBlock
+	_createDevice        = devicemapper.CreateDeviceWithRetryErrors
+	_cryptsetupAvailable = cryptsetupAvailable
+	_cryptsetupClose     = cryptsetupClose
+	_cryptsetupFormat    = cryptsetupFormat
+	_cryptsetupOpen      = cryptsetupOpen
+	_generateKeyFile     = generateKeyFile
+	_osMkdirTemp         = os.MkdirTemp
+	_osRemoveAll         = os.RemoveAll
+	_providedDataSectors = providedDataSectors
+	_randRead            = rand.Read
+	_removeDevice        = devicemapper.RemoveDevice
+	_zeroFirstBlock      = zeroFirstBlock
 )
 
 // cryptsetupCommand runs cryptsetup with the provided arguments
@@ -142,9 +151,21 @@ func cryptsetupClose(ctx context.Context, deviceName string) error {
 //     doesn't have any format yet.
 //
 //  4. Prepare the unecrypted block device to be later formatted as xfs
-//  4.1. Zero the first block. It appears that mkfs.xfs reads this before formatting.
-
+//     4.1. Zero the first block. It appears that mkfs.xfs reads this before formatting.
+//
+// When the cryptsetup binary is not present in the guest, the same targets are
+// created natively instead, see encryptDeviceNative, so that the key is never
+// written to a file.
 func EncryptDevice(ctx context.Context, source string, dmCryptName string) (path string, err error) {
+	if !_cryptsetupAvailable() {
+		key := make([]byte, nativeKeySize)
+		if _, err := _randRead(key); err != nil {
+			return "", fmt.Errorf("failed to generate key: %w", err)
+		}
+		defer clear(key)
+		return encryptDeviceNative(ctx, source, dmCryptName, key, false)
+	}
+
 	// Create temporary directory to store the keyfile and xfs image
 	tempDir, err := _osMkdirTemp("", "dm-crypt")
 	if err != nil {
@@ -194,8 +215,31 @@ func EncryptDevice(ctx context.Context, source string, dmCryptName string) (path
 	return deviceNamePath, nil
 }
 
+// EncryptDeviceWithKey creates a dm-crypt target for a persistent device with
+// the given key, e.g. one released by a key broker, instead of a random one.
+//
+// The targets are always created natively, whether cryptsetup is present or
+// not, so that the released key never leaves memory. The key of the targets is
+// derived from the given key with HKDF. Unlike EncryptDevice, a device whose
+// dm-integrity superblock has already been initialized is only opened, so that
+// its contents survive across UVMs which are able to obtain the key.
+func EncryptDeviceWithKey(ctx context.Context, source string, dmCryptName string, key []byte) (path string, err error) {
+	if len(key) == 0 {
+		return "", errors.New("encryption key is empty")
+	}
+	nativeKey, err := hkdf.Key(sha512.New, key, nil, nativeKeyInfo, nativeKeySize)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive key: %w", err)
+	}
+	defer clear(nativeKey)
+	return encryptDeviceNative(ctx, source, dmCryptName, nativeKey, true)
+}
+
 // CleanupCryptDevice removes the dm-crypt device created by EncryptDevice
 func CleanupCryptDevice(ctx context.Context, dmCryptName string) error {
+	if !_cryptsetupAvailable() || isNativeDevice(dmCryptName) {
+		return cleanupCryptDeviceNative(dmCryptName)
+	}
 	// Close dm-crypt device
 	if err := _cryptsetupClose(ctx, dmCryptName); err != nil {
 		return fmt.Errorf("luksClose failed: %s: %w", dmCryptName, err)
@@ -5,9 +5,18 @@ package crypt
 
 import (
 	"context"
+	"crypto/hkdf"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
+
+	"github.com/Microsoft/hcsshim/internal/guest/storage/devicemapper"
 )
 
 const tempDir = "/tmp/dir/"
@@ -17,13 +26,19 @@ func osMkdirTempTest(dir string, pattern string) (string, error) {
 }
 
 func clearCryptTestDependencies() {
+	_createDevice = nil
+	_cryptsetupAvailable = func() bool { return true }
 	_cryptsetupClose = nil
 	_cryptsetupFormat = nil
 	_cryptsetupOpen = nil
 	_generateKeyFile = nil
 	_osMkdirTemp = osMkdirTempTest
 	_osRemoveAll = nil
+	_providedDataSectors = nil
+	_randRead = nil
+	_removeDevice = nil
 	_zeroFirstBlock = nil
+	nativeDevices = map[string]struct{}{}
 }
 
 func Test_Encrypt_Generate_Key_Error(t *testing.T) {
@@ -158,6 +173,14 @@ func Test_Encrypt_Success(t *testing.T) {
 	}
 }
 
+func Test_Encrypt_With_Empty_Key(t *testing.T) {
+	clearCryptTestDependencies()
+
+	if _, err := EncryptDeviceWithKey(context.Background(), "/dev/sda", "dm-crypt-name", nil); err == nil {
+		t.Fatal("expected empty key to be rejected")
+	}
+}
+
 func Test_Cleanup_Dm_Crypt_Error(t *testing.T) {
 	clearCryptTestDependencies()
 
@@ -195,3 +218,229 @@ func Test_Cleanup_Dm_Crypt_Success(t *testing.T) {
 		t.Fatalf("unexpected err: '%v'", err)
 	}
 }
+
+// setupNativeTest stubs the dependencies of the native path, and records the
+// device mapper devices which are created and removed.
+func setupNativeTest(t *testing.T, created map[string]devicemapper.Target, removed *[]string) {
+	t.Helper()
+	clearCryptTestDependencies()
+
+	_cryptsetupAvailable = func() bool { return false }
+	_randRead = func(b []byte) (int, error) {
+		for i := range b {
+			b[i] = byte(i)
+		}
+		return len(b), nil
+	}
+	_zeroFirstBlock = func(_ string, _ int) error {
+		return nil
+	}
+	_providedDataSectors = func(_ string) (int64, error) {
+		return 2048, nil
+	}
+	_createDevice = func(_ context.Context, name string, flags devicemapper.CreateFlags, targets []devicemapper.Target, _ ...error) (string, error) {
+		if len(targets) != 1 || flags != 0 {
+			t.Fatalf("unexpected targets of %s: %+v", name, targets)
+		}
+		created[name] = targets[0]
+		return "/dev/mapper/" + name, nil
+	}
+	_removeDevice = func(name string) error {
+		*removed = append(*removed, name)
+		return nil
+	}
+	_cryptsetupFormat = func(_ context.Context, _ string, _ string) error {
+		t.Fatal("cryptsetup must not be used")
+		return nil
+	}
+}
+
+func Test_Encrypt_Native_Success(t *testing.T) {
+	created := map[string]devicemapper.Target{}
+	removed := []string{}
+	setupNativeTest(t, created, &removed)
+
+	source := "/dev/sda"
+	dmCryptName := "dm-crypt-name"
+	encryptedSource, err := EncryptDevice(context.Background(), source, dmCryptName)
+	if err != nil {
+		t.Fatalf("unexpected err: '%v'", err)
+	}
+	if encryptedSource != "/dev/mapper/"+dmCryptName {
+		t.Fatalf("expected path: '%v' got: '%v'", "/dev/mapper/"+dmCryptName, encryptedSource)
+	}
+
+	// the dm-integrity device is only removed once it has been initialized
+	if len(removed) != 1 || removed[0] != dmCryptName+"_dif" {
+		t.Fatalf("unexpected removed devices: %v", removed)
+	}
+
+	integrity := created[dmCryptName+"_dif"]
+	if integrity.Type != "integrity" || integrity.LengthInBlocks != 2048 || !strings.HasPrefix(integrity.Params, source+" ") {
+		t.Fatalf("unexpected dm-integrity target: %+v", integrity)
+	}
+	crypt := created[dmCryptName]
+	key := make([]byte, nativeKeySize)
+	_, _ = _randRead(key)
+	expectedParams := nativeCipher + " " + hex.EncodeToString(key) + " 0 /dev/mapper/" + dmCryptName + "_dif 0 2 integrity:32:aead sector_size:4096"
+	if crypt.Type != "crypt" || crypt.LengthInBlocks != 2048 || crypt.Params != expectedParams {
+		t.Fatalf("unexpected dm-crypt target: %+v", crypt)
+	}
+}
+
+func Test_Encrypt_Native_Crypt_Error(t *testing.T) {
+	created := map[string]devicemapper.Target{}
+	removed := []string{}
+	setupNativeTest(t, created, &removed)
+
+	dmCryptName := "dm-crypt-name"
+	expectedErr := errors.New("expected error message")
+	createDevice := _createDevice
+	_createDevice = func(ctx context.Context, name string, flags devicemapper.CreateFlags, targets []devicemapper.Target, errs ...error) (string, error) {
+		if name == dmCryptName {
+			return "", expectedErr
+		}
+		return createDevice(ctx, name, flags, targets, errs...)
+	}
+
+	_, err := EncryptDevice(context.Background(), "/dev/sda", dmCryptName)
+	if !errors.Is(err, expectedErr) {
+		t.Fatalf("expected err: '%v' got: '%v'", expectedErr, err)
+	}
+	// the dm-integrity device is removed after its initialization, and again
+	// once creating the dm-crypt device failed
+	if len(removed) != 2 || removed[1] != dmCryptName+"_dif" {
+		t.Fatalf("unexpected removed devices: %v", removed)
+	}
+}
+
+func Test_Encrypt_With_Key_Format(t *testing.T) {
+	created := map[string]devicemapper.Target{}
+	removed := []string{}
+	setupNativeTest(t, created, &removed)
+
+	// Test that a device whose dm-integrity superblock isn't initialized yet
+	// is initialized, and that the targets are created natively with a key
+	// derived from the given one, even though cryptsetup is present.
+	_cryptsetupAvailable = func() bool { return true }
+	initialized := false
+	_providedDataSectors = func(_ string) (int64, error) {
+		if !initialized {
+			return 0, errors.New("dm-integrity superblock was not initialized")
+		}
+		return 2048, nil
+	}
+	zeroed := []string{}
+	_zeroFirstBlock = func(path string, _ int) error {
+		zeroed = append(zeroed, path)
+		if path == "/dev/sda" {
+			initialized = true
+		}
+		return nil
+	}
+
+	dmCryptName := "dm-crypt-name"
+	key := []byte("released key")
+	if _, err := EncryptDeviceWithKey(context.Background(), "/dev/sda", dmCryptName, key); err != nil {
+		t.Fatalf("unexpected err: '%v'", err)
+	}
+	if len(zeroed) != 2 || zeroed[1] != "/dev/mapper/"+dmCryptName {
+		t.Fatalf("expected device to be initialized and its first block zeroed: %v", zeroed)
+	}
+
+	derived, err := hkdf.Key(sha512.New, key, nil, nativeKeyInfo, nativeKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypt := created[dmCryptName]
+	if !strings.HasPrefix(crypt.Params, nativeCipher+" "+hex.EncodeToString(derived)+" ") {
+		t.Fatalf("unexpected dm-crypt target: %+v", crypt)
+	}
+
+	// the device is removed natively rather than with cryptsetup
+	_cryptsetupClose = func(_ context.Context, _ string) error {
+		t.Fatal("cryptsetup must not be used")
+		return nil
+	}
+	removed = removed[:0]
+	if err := CleanupCryptDevice(context.Background(), dmCryptName); err != nil {
+		t.Fatalf("unexpected err: '%v'", err)
+	}
+	if len(removed) != 2 || removed[0] != dmCryptName {
+		t.Fatalf("unexpected removed devices: %v", removed)
+	}
+}
+
+func Test_Encrypt_With_Key_Reopen(t *testing.T) {
+	created := map[string]devicemapper.Target{}
+	removed := []string{}
+	setupNativeTest(t, created, &removed)
+
+	// Test that a device whose dm-integrity superblock is already initialized
+	// is only opened, so that its contents are preserved.
+	_zeroFirstBlock = func(path string, _ int) error {
+		t.Fatalf("unexpected zeroing of %s", path)
+		return nil
+	}
+
+	dmCryptName := "dm-crypt-name"
+	encryptedSource, err := EncryptDeviceWithKey(context.Background(), "/dev/sda", dmCryptName, []byte("released key"))
+	if err != nil {
+		t.Fatalf("unexpected err: '%v'", err)
+	}
+	if encryptedSource != "/dev/mapper/"+dmCryptName {
+		t.Fatalf("expected path: '%v' got: '%v'", "/dev/mapper/"+dmCryptName, encryptedSource)
+	}
+	if len(removed) != 0 || len(created) != 2 {
+		t.Fatalf("unexpected devices, created: %v removed: %v", created, removed)
+	}
+}
+
+func Test_Cleanup_Native(t *testing.T) {
+	created := map[string]devicemapper.Target{}
+	removed := []string{}
+	setupNativeTest(t, created, &removed)
+
+	if err := CleanupCryptDevice(context.Background(), "dm-crypt-name"); err != nil {
+		t.Fatalf("unexpected err: '%v'", err)
+	}
+	if len(removed) != 2 || removed[0] != "dm-crypt-name" || removed[1] != "dm-crypt-name_dif" {
+		t.Fatalf("unexpected removed devices: %v", removed)
+	}
+}
+
+func Test_Provided_Data_Sectors(t *testing.T) {
+	dir := t.TempDir()
+
+	superblock := make([]byte, 4096)
+	copy(superblock, "integrt\x00")
+	binary.LittleEndian.PutUint64(superblock[16:], 1040256)
+
+	for _, tc := range []struct {
+		name     string
+		contents []byte
+		sectors  int64
+	}{
+		{name: "initialized", contents: superblock, sectors: 1040256},
+		{name: "zeroed", contents: make([]byte, 4096)},
+		{name: "short", contents: []byte("integrt")},
+	} {
+		path := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(path, tc.contents, 0600); err != nil {
+			t.Fatal(err)
+		}
+		sectors, err := providedDataSectors(path)
+		if tc.sectors == 0 {
+			if err == nil {
+				t.Fatalf("%s: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected err: '%v'", tc.name, err)
+		}
+		if sectors != tc.sectors {
+			t.Fatalf("%s: expected %d sectors got: %d", tc.name, tc.sectors, sectors)
+		}
+	}
+}
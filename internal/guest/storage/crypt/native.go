@@ -0,0 +1,214 @@
+//go:build linux
+// +build linux
+
+package crypt
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Microsoft/hcsshim/internal/guest/storage/devicemapper"
+	"github.com/Microsoft/hcsshim/internal/log"
+)
+
+const (
+	// nativeCipher is the authenticated encryption used when the device mapper
+	// targets are created natively, which is the same as the one which
+	// cryptsetupFormat uses: aes-xts-plain64 with hmac-sha256 integrity.
+	nativeCipher = "capi:authenc(hmac(sha256),xts(aes))-plain64"
+	// nativeKeySize is the size of the key of nativeCipher: 64 bytes for
+	// aes-xts followed by 32 bytes for hmac-sha256.
+	nativeKeySize = 64 + 32
+	// nativeKeyInfo is the HKDF info with which the key of the targets is
+	// derived from a key given to EncryptDeviceWithKey.
+	nativeKeyInfo = "hcsshim dm-crypt " + nativeCipher
+	// nativeTagSize is the size of the hmac-sha256 tag stored by dm-integrity
+	// for each sector.
+	nativeTagSize = 32
+	// nativeSectorSize is the sector size of both targets.
+	nativeSectorSize = 4096
+	// integritySuffix is appended to the name of the dm-crypt device to name
+	// the dm-integrity device beneath it, as cryptsetup does.
+	integritySuffix = "_dif"
+
+	// providedDataSectorsOffset is the offset of provided_data_sectors in the
+	// dm-integrity superblock.
+	providedDataSectorsOffset = 16
+	// integrityMagic is the magic at the start of the dm-integrity superblock.
+	integrityMagic = "integrt\x00"
+	// dmSectorSize is the unit of the lengths of device mapper targets.
+	dmSectorSize = 512
+)
+
+// dmRetryErrors are transient errors of device mapper operations, which are
+// retried.
+var dmRetryErrors = []error{
+	unix.EBUSY,
+	unix.ENOENT,
+	unix.ENXIO,
+	unix.ENODEV,
+}
+
+// nativeDevices are the names of the dm-crypt devices which were created
+// natively while cryptsetup is present, which CleanupCryptDevice must then
+// remove natively too.
+var (
+	nativeDevicesMutex sync.Mutex
+	nativeDevices      = map[string]struct{}{}
+)
+
+// isNativeDevice returns whether the dm-crypt device was created natively.
+func isNativeDevice(dmCryptName string) bool {
+	nativeDevicesMutex.Lock()
+	defer nativeDevicesMutex.Unlock()
+	_, ok := nativeDevices[dmCryptName]
+	return ok
+}
+
+// cryptsetupAvailable returns whether the cryptsetup binary is present in the
+// guest. When it is not, devices are encrypted natively.
+func cryptsetupAvailable() bool {
+	_, err := exec.LookPath("cryptsetup")
+	return err == nil
+}
+
+// encryptDeviceNative creates the same dm-integrity and dm-crypt stack as
+// cryptsetup with the given key, which only lives in memory, without a LUKS
+// header.
+//
+//  1. Zero the superblock of dm-integrity, which dm-integrity then initializes
+//     when a target is first created on the device, and read the number of
+//     sectors which the device provides once its tags are stored. When reuse
+//     is set and the superblock has already been initialized, the device is
+//     only opened.
+//
+//  2. Create the dm-integrity target, without a journal, whose tags are
+//     provided by dm-crypt.
+//
+//  3. Create the dm-crypt target on top of it, which is exposed at
+//     /dev/mapper/`dmCryptName`.
+//
+//  4. Zero the first block of a device which was not reused, see
+//     EncryptDevice.
+func encryptDeviceNative(ctx context.Context, source string, dmCryptName string, key []byte, reuse bool) (_ string, err error) {
+	integrityName := dmCryptName + integritySuffix
+
+	// 1. Initialize dm-integrity, unless the device is reused
+	var sectors int64
+	reused := false
+	if reuse {
+		if sectors, err = _providedDataSectors(source); err == nil {
+			reused = true
+		} else {
+			log.G(ctx).WithError(err).Debug("initializing dm-integrity of persistent device")
+		}
+	}
+	if !reused {
+		if sectors, err = initializeIntegrity(ctx, source, integrityName); err != nil {
+			return "", err
+		}
+	}
+
+	// 2. Create dm-integrity target
+	integrityTarget := devicemapper.IntegrityTarget(sectors, source, nativeTagSize, nativeSectorSize)
+	integrityPath, err := _createDevice(ctx, integrityName, 0, []devicemapper.Target{integrityTarget}, dmRetryErrors...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create dm-integrity target: %s: %w", source, err)
+	}
+	defer func() {
+		if err != nil {
+			if inErr := _removeDevice(integrityName); inErr != nil {
+				log.G(ctx).WithError(inErr).Debug("failed to remove dm-integrity device")
+			}
+		}
+	}()
+
+	// 3. Create dm-crypt target
+	cryptTarget := devicemapper.CryptTarget(sectors, nativeCipher, key, integrityPath,
+		fmt.Sprintf("integrity:%d:aead", nativeTagSize), fmt.Sprintf("sector_size:%d", nativeSectorSize))
+	cryptPath, err := _createDevice(ctx, dmCryptName, 0, []devicemapper.Target{cryptTarget}, dmRetryErrors...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create dm-crypt target: %s: %w", source, err)
+	}
+	defer func() {
+		if err != nil {
+			if inErr := _removeDevice(dmCryptName); inErr != nil {
+				log.G(ctx).WithError(inErr).Debug("failed to remove dm-crypt device")
+			}
+		}
+	}()
+
+	// 4. Zero the first block, unless the contents of the device were
+	// written through dm-integrity already
+	if !reused {
+		if err := _zeroFirstBlock(cryptPath, nativeSectorSize); err != nil {
+			return "", fmt.Errorf("failed to zero first block: %w", err)
+		}
+	}
+
+	nativeDevicesMutex.Lock()
+	nativeDevices[dmCryptName] = struct{}{}
+	nativeDevicesMutex.Unlock()
+	return cryptPath, nil
+}
+
+// initializeIntegrity zeroes the dm-integrity superblock of the device, has
+// dm-integrity initialize it and returns the number of sectors it provides.
+func initializeIntegrity(ctx context.Context, source string, integrityName string) (int64, error) {
+	if err := _zeroFirstBlock(source, nativeSectorSize); err != nil {
+		return 0, fmt.Errorf("failed to zero dm-integrity superblock: %w", err)
+	}
+	formatTarget := devicemapper.IntegrityTarget(nativeSectorSize/dmSectorSize, source, nativeTagSize, nativeSectorSize)
+	if _, err := _createDevice(ctx, integrityName, 0, []devicemapper.Target{formatTarget}, dmRetryErrors...); err != nil {
+		return 0, fmt.Errorf("failed to initialize dm-integrity: %s: %w", source, err)
+	}
+	if err := _removeDevice(integrityName); err != nil {
+		return 0, fmt.Errorf("failed to remove dm-integrity: %s: %w", integrityName, err)
+	}
+	return _providedDataSectors(source)
+}
+
+// cleanupCryptDeviceNative removes the dm-crypt device and the dm-integrity
+// device beneath it.
+func cleanupCryptDeviceNative(dmCryptName string) error {
+	nativeDevicesMutex.Lock()
+	delete(nativeDevices, dmCryptName)
+	nativeDevicesMutex.Unlock()
+	if err := _removeDevice(dmCryptName); err != nil {
+		return fmt.Errorf("failed to remove dm-crypt device: %s: %w", dmCryptName, err)
+	}
+	if err := _removeDevice(dmCryptName + integritySuffix); err != nil {
+		return fmt.Errorf("failed to remove dm-integrity device: %s: %w", dmCryptName+integritySuffix, err)
+	}
+	return nil
+}
+
+// providedDataSectors reads the number of sectors which the device provides
+// from its dm-integrity superblock.
+func providedDataSectors(source string) (int64, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	b := make([]byte, providedDataSectorsOffset+8)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return 0, fmt.Errorf("failed to read dm-integrity superblock: %s: %w", source, err)
+	}
+	if string(b[:len(integrityMagic)]) != integrityMagic {
+		return 0, fmt.Errorf("dm-integrity superblock of %s was not initialized", source)
+	}
+	sectors := int64(binary.LittleEndian.Uint64(b[providedDataSectorsOffset:]))
+	if sectors == 0 {
+		return 0, fmt.Errorf("dm-integrity superblock of %s provides no sectors", source)
+	}
+	return sectors, nil
+}
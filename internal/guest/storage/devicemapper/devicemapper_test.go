@@ -259,3 +259,38 @@ func TestRemoveDeviceFailsOnNonSyscallEBUSY(t *testing.T) {
 		t.Fatalf("no retries should've been attempted")
 	}
 }
+
+func TestIntegrityTarget(t *testing.T) {
+	target := IntegrityTarget(1040256, "/dev/sdb", 32, 4096)
+	if target.Type != "integrity" || target.SectorStart != 0 || target.LengthInBlocks != 1040256 {
+		t.Fatalf("unexpected target: %+v", target)
+	}
+	expected := "/dev/sdb 0 32 D 1 block_size:4096"
+	if target.Params != expected {
+		t.Fatalf("expected params %q, got %q", expected, target.Params)
+	}
+}
+
+func TestCryptTarget(t *testing.T) {
+	key := []byte{0x00, 0x01, 0xfe, 0xff}
+	for _, tc := range []struct {
+		opts     []string
+		expected string
+	}{
+		{
+			expected: "aes-xts-plain64 0001feff 0 /dev/sdb 0",
+		},
+		{
+			opts:     []string{"integrity:32:aead", "sector_size:4096"},
+			expected: "aes-xts-plain64 0001feff 0 /dev/sdb 0 2 integrity:32:aead sector_size:4096",
+		},
+	} {
+		target := CryptTarget(2048, "aes-xts-plain64", key, "/dev/sdb", tc.opts...)
+		if target.Type != "crypt" || target.SectorStart != 0 || target.LengthInBlocks != 2048 {
+			t.Fatalf("unexpected target: %+v", target)
+		}
+		if target.Params != tc.expected {
+			t.Fatalf("expected params %q, got %q", tc.expected, target.Params)
+		}
+	}
+}
@@ -5,7 +5,9 @@ package devicemapper
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"go.opencensus.io/trace"
 	"golang.org/x/sys/unix"
@@ -111,3 +113,61 @@ func CreateVerityTarget(ctx context.Context, devPath, devName string, verityInfo
 
 	return devMapperPath, nil
 }
+
+// IntegrityTarget constructs a dm-integrity target for the device at `devPath`,
+// which stores a tag of `tagSize` bytes for every block of `blockSize` bytes.
+// The target runs in direct mode, i.e. without a journal, and its tags are
+// provided by the target stacked on top of it, e.g. a dm-crypt target with
+// authenticated encryption.
+//
+// Example integrity target table:
+//
+//	0 1040256 integrity /dev/sdb 0 32 D 1 block_size:4096
+//	|    |        |         |    | |  | |        |
+//	start|     target       |    | |  | |    opt_params
+//	    size            data_dev | |  | #opt_params
+//	                        offset |  mode
+//	                           tag_size
+//
+// See [dm-integrity] for more information
+//
+// [dm-integrity]: https://docs.kernel.org/admin-guide/device-mapper/dm-integrity.html
+func IntegrityTarget(lengthBlocks int64, devPath string, tagSize, blockSize int) Target {
+	return Target{
+		Type:           "integrity",
+		SectorStart:    0,
+		LengthInBlocks: lengthBlocks,
+		Params:         fmt.Sprintf("%s 0 %d D 1 block_size:%d", devPath, tagSize, blockSize),
+	}
+}
+
+// CryptTarget constructs a dm-crypt target which encrypts the device at
+// `devPath` with `cipher` and `key`, followed by the optional parameters
+// `opts`, e.g. "sector_size:4096".
+//
+// Example crypt target table:
+//
+//	0 1040256 crypt aes-xts-plain64 <key> 0 /dev/sdb 0 1 sector_size:4096
+//	|    |      |          |          |   |     |    | |         |
+//	start|   target     cipher        |   |  device  | |    opt_params
+//	   size                          key  |       offset
+//	                                  iv_offset   #opt_params
+//
+// The key is part of the table, which is passed to the kernel directly rather
+// than through a key file.
+//
+// See [dm-crypt] for more information
+//
+// [dm-crypt]: https://docs.kernel.org/admin-guide/device-mapper/dm-crypt.html
+func CryptTarget(lengthBlocks int64, cipher string, key []byte, devPath string, opts ...string) Target {
+	params := fmt.Sprintf("%s %s 0 %s 0", cipher, hex.EncodeToString(key), devPath)
+	if len(opts) > 0 {
+		params += fmt.Sprintf(" %d %s", len(opts), strings.Join(opts, " "))
+	}
+	return Target{
+		Type:           "crypt",
+		SectorStart:    0,
+		LengthInBlocks: lengthBlocks,
+		Params:         params,
+	}
+}
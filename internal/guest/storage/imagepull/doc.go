@@ -0,0 +1,7 @@
+// Package imagepull pulls the images of containers from their registries in
+// the guest, rather than having the host attach their layers, so that the
+// contents of an image are never exposed to the host. The digests of the
+// manifest, config and layers of an image are verified as they are fetched,
+// and the dm-verity root digest of each layer is enforced by the security
+// policy before the layer is mounted or extracted.
+package imagepull
@@ -0,0 +1,322 @@
+//go:build linux
+// +build linux
+
+package imagepull
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+	"go.opencensus.io/trace"
+
+	"github.com/Microsoft/hcsshim/internal/guest/archive"
+	"github.com/Microsoft/hcsshim/internal/guest/storage/ocicrypt"
+	"github.com/Microsoft/hcsshim/internal/log"
+	"github.com/Microsoft/hcsshim/internal/oc"
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
+)
+
+// Test dependencies
+var (
+	mountLayer   = ocicrypt.Mount
+	unmountLayer = ocicrypt.Unmount
+)
+
+// Options are the options of Pull.
+type Options struct {
+	// Unpack is guestresource.GuestPullUnpackExt4, the default, or
+	// guestresource.GuestPullUnpackDir.
+	Unpack string
+	// PlainHTTP reaches the registry over HTTP rather than HTTPS.
+	PlainHTTP bool
+	// Username and Password are the credentials of the registry, if any.
+	Username string
+	Password string
+	// Dial dials the registry, and resolves its name. If nil, the registry
+	// is dialed from the network namespace of the GCS.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Enforcer allows or denies the layers of an image, as the security policy
+// enforcer does for the layers which the host attaches.
+type Enforcer interface {
+	EnforceDeviceMountPolicy(ctx context.Context, target string, deviceHash string) error
+	EnforceDeviceUnmountPolicy(ctx context.Context, unmountTarget string) error
+}
+
+// Layer is a layer of an image unpacked by Pull.
+type Layer struct {
+	// Digest is the digest of the layer blob in the manifest of the image.
+	Digest string
+	// Path is the directory of the layer, a lower directory of the overlay
+	// of the container.
+	Path string
+	// Image is the ext4 image of the layer mounted at Path through dm-verity,
+	// or empty if the layer was extracted into Path.
+	Image string
+}
+
+// Pull fetches the image `ref` for the platform of the UVM, and unpacks each
+// of its layers into a directory beneath `dir`, which is only kept once
+// `enforcer` allows the dm-verity root digest of the layer, computed as for the
+// layers which the host attaches. The layers are returned topmost first, in the
+// order of the lower directories of overlayfs.
+//
+// If an error is returned, the layers unpacked so far have been removed.
+func Pull(ctx context.Context, ref, dir string, opts Options, enforcer Enforcer) (_ []Layer, err error) {
+	ctx, span := oc.StartSpan(ctx, "imagepull::Pull")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+
+	span.AddAttributes(
+		trace.StringAttribute("ref", ref),
+		trace.StringAttribute("dir", dir),
+		trace.StringAttribute("unpack", opts.Unpack))
+
+	switch opts.Unpack {
+	case "":
+		opts.Unpack = guestresource.GuestPullUnpackExt4
+	case guestresource.GuestPullUnpackExt4, guestresource.GuestPullUnpackDir:
+	default:
+		return nil, fmt.Errorf("unsupported unpack mode %q", opts.Unpack)
+	}
+
+	img, err := fetch(ctx, ref, opts)
+	if err != nil {
+		return nil, err
+	}
+	ls, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layers of image %s: %w", ref, err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	var layers []Layer
+	defer func() {
+		if err != nil {
+			if rerr := Remove(ctx, layers, enforcer); rerr != nil {
+				log.G(ctx).WithError(rerr).Warn("failed to remove pulled layers")
+			}
+			_ = os.Remove(dir)
+		}
+	}()
+	for i, l := range ls {
+		layer, err := unpackLayer(ctx, l, filepath.Join(dir, strconv.Itoa(i)), opts.Unpack, enforcer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack layer %d of image %s: %w", i, ref, err)
+		}
+		// overlayfs takes the topmost layer first
+		layers = append([]Layer{layer}, layers...)
+	}
+	return layers, nil
+}
+
+// Remove unmounts or deletes the layers of an image returned by Pull, once
+// `enforcer` allows it.
+func Remove(ctx context.Context, layers []Layer, enforcer Enforcer) (err error) {
+	ctx, span := oc.StartSpan(ctx, "imagepull::Remove")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+
+	for _, l := range layers {
+		if err := enforcer.EnforceDeviceUnmountPolicy(ctx, l.Path); err != nil {
+			return fmt.Errorf("unmounting pulled layer at %s denied by policy: %w", l.Path, err)
+		}
+		if l.Image != "" {
+			if err := unmountLayer(ctx, l.Image, l.Path); err != nil {
+				return err
+			}
+		} else if err := os.RemoveAll(l.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch resolves the manifest of `ref` for the platform of the UVM. The
+// digests of the manifest, if `ref` has one, and of the config are verified.
+func fetch(ctx context.Context, ref string, opts Options) (v1.Image, error) {
+	var nameOpts []name.Option
+	if opts.PlainHTTP {
+		nameOpts = append(nameOpts, name.Insecure)
+	}
+	r, err := name.ParseReference(ref, nameOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %q: %w", ref, err)
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Dial != nil {
+		tr.DialContext = opts.Dial
+	}
+	var auth authn.Authenticator = authn.Anonymous
+	if opts.Username != "" || opts.Password != "" {
+		auth = &authn.Basic{Username: opts.Username, Password: opts.Password}
+	}
+	img, err := remote.Image(r,
+		remote.WithContext(ctx),
+		remote.WithTransport(tr),
+		remote.WithAuth(auth),
+		remote.WithPlatform(v1.Platform{OS: "linux", Architecture: runtime.GOARCH}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image %s: %w", ref, err)
+	}
+	return img, nil
+}
+
+// unpackLayer unpacks the blob of `l` into `target` if `enforcer` allows its
+// digest. The blob is read from the registry once, and its digest is verified
+// once it is read to the end, so that what is unpacked is what is enforced.
+func unpackLayer(ctx context.Context, l v1.Layer, target, unpack string, enforcer Enforcer) (_ Layer, err error) {
+	d, err := l.Digest()
+	if err != nil {
+		return Layer{}, err
+	}
+	mt, err := l.MediaType()
+	if err != nil {
+		return Layer{}, err
+	}
+	layer := Layer{Digest: d.String(), Path: target}
+	image := target + ".ext4"
+
+	verityInfo, err := convert(ctx, l, mt, image, target, unpack)
+	if err != nil {
+		_ = os.Remove(image)
+		_ = os.RemoveAll(target)
+		return Layer{}, err
+	}
+	if unpack != guestresource.GuestPullUnpackExt4 {
+		// the ext4 image only provided the digest of the layer
+		if err := os.Remove(image); err != nil {
+			_ = os.RemoveAll(target)
+			return Layer{}, err
+		}
+	}
+
+	if err := enforcer.EnforceDeviceMountPolicy(ctx, target, verityInfo.RootDigest); err != nil {
+		_ = os.Remove(image)
+		_ = os.RemoveAll(target)
+		return Layer{}, fmt.Errorf("mounting pulled layer %s onto %s denied by policy: %w", d, target, err)
+	}
+	if unpack != guestresource.GuestPullUnpackExt4 {
+		return layer, nil
+	}
+
+	// the image is mounted through dm-verity with the digest which was
+	// enforced, so that it cannot be changed once written to the scratch
+	if err := mountLayer(ctx, image, target, verityInfo); err != nil {
+		_ = os.Remove(image)
+		_ = enforcer.EnforceDeviceUnmountPolicy(ctx, target)
+		return Layer{}, err
+	}
+	layer.Image = image
+	return layer, nil
+}
+
+// convert converts the blob of `l` to the ext4 image `image`, and returns its
+// dm-verity information. In the GuestPullUnpackDir mode, the layer is also
+// extracted into the directory `target`.
+func convert(ctx context.Context, l v1.Layer, mt types.MediaType, image, target, unpack string) (*guestresource.DeviceVerityInfo, error) {
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	r, err := decompress(rc, mt)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var verityInfo *guestresource.DeviceVerityInfo
+	if unpack == guestresource.GuestPullUnpackExt4 {
+		verityInfo, err = ocicrypt.ConvertLayer(r, guestresource.EncryptedLayerFormatTar, image)
+	} else {
+		verityInfo, err = convertAndExtract(ctx, r, image, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the digest of the blob is only verified at its end, which the
+	// decompressor may not have read
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		return nil, err
+	}
+	return verityInfo, nil
+}
+
+// convertAndExtract extracts the tar stream of a layer, read from `r`, into the
+// directory `target` as it is converted to the ext4 image `image`, so that the
+// extracted layer is the one whose dm-verity information is returned.
+func convertAndExtract(ctx context.Context, r io.Reader, image, target string) (*guestresource.DeviceVerityInfo, error) {
+	if err := os.Mkdir(target, 0755); err != nil {
+		return nil, err
+	}
+	root, err := os.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := archive.Extract(ctx, root, "/", pr, archive.ExtractOptions{PreserveOwnership: true, Layer: true})
+		if err == nil {
+			// the layer is converted up to the end of its stream
+			_, err = io.Copy(io.Discard, pr)
+		}
+		if err != nil {
+			_ = pr.CloseWithError(err)
+		}
+		done <- err
+	}()
+	verityInfo, err := ocicrypt.ConvertLayer(io.TeeReader(r, pw), guestresource.EncryptedLayerFormatTar, image)
+	_ = pw.CloseWithError(err)
+	if xerr := <-done; err == nil && xerr != nil {
+		err = fmt.Errorf("failed to extract layer: %w", xerr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return verityInfo, nil
+}
+
+// decompress returns the tar stream of the layer blob read from `r`.
+func decompress(r io.Reader, mt types.MediaType) (io.ReadCloser, error) {
+	switch mt {
+	case types.OCIUncompressedLayer, types.DockerUncompressedLayer:
+		return io.NopCloser(r), nil
+	case types.OCILayer, types.DockerLayer:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress layer: %w", err)
+		}
+		return zr, nil
+	case types.OCILayerZStd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress layer: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported layer media type %q", mt)
+	}
+}
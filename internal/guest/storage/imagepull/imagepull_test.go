@@ -0,0 +1,385 @@
+//go:build linux
+// +build linux
+
+package imagepull
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Microsoft/hcsshim/ext4/tar2ext4"
+	"github.com/Microsoft/hcsshim/internal/guest/storage/ocicrypt"
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
+)
+
+// testRegistry is a stand-in for a registry serving a single repository.
+type testRegistry struct {
+	manifests map[string][]byte
+	types     map[string]string
+	blobs     map[string][]byte
+}
+
+func newTestRegistry(t *testing.T) (*testRegistry, string) {
+	t.Helper()
+	r := &testRegistry{
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		blobs:     make(map[string][]byte),
+	}
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+	// registries on the loopback address are reached over plain HTTP
+	return r, strings.TrimPrefix(s.URL, "http://") + "/test/image"
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p := req.URL.Path
+	switch {
+	case p == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(p, "/v2/test/image/manifests/"):
+		ref := strings.TrimPrefix(p, "/v2/test/image/manifests/")
+		b, ok := r.manifests[ref]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", r.types[ref])
+		w.Header().Set("Docker-Content-Digest", digestOf(b))
+		_, _ = w.Write(b)
+	case strings.HasPrefix(p, "/v2/test/image/blobs/"):
+		b, ok := r.blobs[strings.TrimPrefix(p, "/v2/test/image/blobs/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(b)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// addBlob adds a blob to the registry, and returns its descriptor.
+func (r *testRegistry) addBlob(mt string, b []byte) map[string]interface{} {
+	d := digestOf(b)
+	r.blobs[d] = b
+	return map[string]interface{}{"mediaType": mt, "digest": d, "size": len(b)}
+}
+
+// addManifest adds a manifest to the registry under its digest and `tag`,
+// and returns its descriptor.
+func (r *testRegistry) addManifest(t *testing.T, tag, mt string, m map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	m["schemaVersion"] = 2
+	m["mediaType"] = mt
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := digestOf(b)
+	for _, ref := range []string{d, tag} {
+		r.manifests[ref] = b
+		r.types[ref] = mt
+	}
+	return map[string]interface{}{"mediaType": mt, "digest": d, "size": len(b)}
+}
+
+// addImage adds an image with the layers `tars`, the first of which is
+// compressed, tagged `tag` through an index.
+func (r *testRegistry) addImage(t *testing.T, tag string, tars ...[]byte) {
+	t.Helper()
+	var layers []interface{}
+	var diffIDs []string
+	for i, b := range tars {
+		diffIDs = append(diffIDs, digestOf(b))
+		if i == 0 {
+			layers = append(layers, r.addBlob("application/vnd.oci.image.layer.v1.tar+gzip", gzipped(t, b)))
+		} else {
+			layers = append(layers, r.addBlob("application/vnd.oci.image.layer.v1.tar", b))
+		}
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": runtime.GOARCH,
+		"os":           "linux",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := r.addManifest(t, tag+"-manifest", "application/vnd.oci.image.manifest.v1+json", map[string]interface{}{
+		"config": r.addBlob("application/vnd.oci.image.config.v1+json", config),
+		"layers": layers,
+	})
+	manifest["platform"] = map[string]string{"os": "linux", "architecture": runtime.GOARCH}
+	other := map[string]interface{}{
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"digest":    digestOf([]byte("other")),
+		"size":      5,
+		"platform":  map[string]string{"os": "windows", "architecture": "amd64"},
+	}
+	r.addManifest(t, tag, "application/vnd.oci.image.index.v1+json", map[string]interface{}{
+		"manifests": []interface{}{other, manifest},
+	})
+}
+
+func digestOf(b []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testTar(t *testing.T, entries ...*tar.Header) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, hdr := range entries {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(hdr.Name))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(hdr.Name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testLayers(t *testing.T) [][]byte {
+	t.Helper()
+	return [][]byte{
+		testTar(t,
+			&tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0755},
+			&tar.Header{Typeflag: tar.TypeReg, Name: "etc/base", Mode: 0644},
+			&tar.Header{Typeflag: tar.TypeReg, Name: "etc/removed", Mode: 0644},
+		),
+		testTar(t,
+			&tar.Header{Typeflag: tar.TypeReg, Name: "etc/.wh.removed", Mode: 0644},
+			&tar.Header{Typeflag: tar.TypeReg, Name: "etc/top", Mode: 0600},
+		),
+	}
+}
+
+// testEnforcer records the layers which it allows.
+type testEnforcer struct {
+	deny    string
+	devices map[string]string
+}
+
+func (e *testEnforcer) EnforceDeviceMountPolicy(_ context.Context, target, deviceHash string) error {
+	if deviceHash == e.deny {
+		return errors.New("denied")
+	}
+	e.devices[target] = deviceHash
+	return nil
+}
+
+func (e *testEnforcer) EnforceDeviceUnmountPolicy(_ context.Context, target string) error {
+	if _, ok := e.devices[target]; !ok {
+		return fmt.Errorf("%s is not mounted", target)
+	}
+	delete(e.devices, target)
+	return nil
+}
+
+func layerHash(t *testing.T, b []byte) string {
+	t.Helper()
+	hash, err := tar2ext4.ConvertAndComputeRootDigest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// mountedLayer is a layer image mounted by the stub of mountLayer.
+type mountedLayer struct {
+	image      string
+	rootDigest string
+}
+
+// stubMount replaces the dm-verity mounts of ext4 layers, recording the images
+// mounted at each target.
+func stubMount(t *testing.T) map[string]mountedLayer {
+	t.Helper()
+	mounts := make(map[string]mountedLayer)
+	mountLayer = func(_ context.Context, image, target string, verityInfo *guestresource.DeviceVerityInfo) error {
+		mounts[target] = mountedLayer{image: image, rootDigest: verityInfo.RootDigest}
+		return nil
+	}
+	unmountLayer = func(_ context.Context, image, target string) error {
+		if mounts[target].image != image {
+			return fmt.Errorf("%s is not mounted at %s", image, target)
+		}
+		delete(mounts, target)
+		return os.Remove(image)
+	}
+	t.Cleanup(func() {
+		mountLayer = ocicrypt.Mount
+		unmountLayer = ocicrypt.Unmount
+	})
+	return mounts
+}
+
+func Test_Pull_Ext4(t *testing.T) {
+	mounts := stubMount(t)
+	reg, repo := newTestRegistry(t)
+	tars := testLayers(t)
+	reg.addImage(t, "latest", tars...)
+
+	dir := filepath.Join(t.TempDir(), "layers")
+	e := &testEnforcer{devices: make(map[string]string)}
+	layers, err := Pull(context.Background(), repo+":latest", dir, Options{}, e)
+	if err != nil {
+		t.Fatalf("failed to pull image: %s", err)
+	}
+	if len(layers) != 2 {
+		t.Fatalf("expected 2 layers, got %d", len(layers))
+	}
+	for i, l := range layers {
+		// the topmost layer is first
+		b := tars[len(tars)-1-i]
+		if e.devices[l.Path] != layerHash(t, b) {
+			t.Fatalf("expected layer %s to be enforced with its ext4 digest", l.Path)
+		}
+		if mounts[l.Path].image != l.Image || l.Image == "" {
+			t.Fatalf("expected image of layer %s to be mounted, got %q", l.Path, mounts[l.Path].image)
+		}
+		// the image is mounted through dm-verity with the enforced digest
+		if mounts[l.Path].rootDigest != e.devices[l.Path] {
+			t.Fatalf("expected layer %s to be mounted with root digest %s, got %s", l.Path, e.devices[l.Path], mounts[l.Path].rootDigest)
+		}
+	}
+
+	if err := Remove(context.Background(), layers, e); err != nil {
+		t.Fatalf("failed to remove layers: %s", err)
+	}
+	if len(mounts) != 0 || len(e.devices) != 0 {
+		t.Fatalf("expected layers to be unmounted, got %v", mounts)
+	}
+}
+
+func Test_Pull_Dir(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("creating whiteouts requires root")
+	}
+	mounts := stubMount(t)
+	reg, repo := newTestRegistry(t)
+	reg.addImage(t, "latest", testLayers(t)...)
+
+	dir := filepath.Join(t.TempDir(), "layers")
+	e := &testEnforcer{devices: make(map[string]string)}
+	opts := Options{Unpack: guestresource.GuestPullUnpackDir}
+	layers, err := Pull(context.Background(), repo+":latest", dir, opts, e)
+	if err != nil {
+		t.Fatalf("failed to pull image: %s", err)
+	}
+	if len(mounts) != 0 {
+		t.Fatalf("expected no layer to be mounted, got %v", mounts)
+	}
+	top, base := layers[0].Path, layers[1].Path
+	if b, err := os.ReadFile(filepath.Join(base, "etc", "base")); err != nil || string(b) != "etc/base" {
+		t.Fatalf("expected file in base layer, got %q: %v", b, err)
+	}
+	if fi, err := os.Lstat(filepath.Join(top, "etc", "removed")); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		t.Fatalf("expected whiteout in top layer: %v", err)
+	}
+	if _, err := os.Stat(layers[0].Path + ".ext4"); !os.IsNotExist(err) {
+		t.Fatalf("expected ext4 image to be removed, got %v", err)
+	}
+
+	if err := Remove(context.Background(), layers, e); err != nil {
+		t.Fatalf("failed to remove layers: %s", err)
+	}
+	if _, err := os.Stat(top); !os.IsNotExist(err) {
+		t.Fatalf("expected layer to be removed, got %v", err)
+	}
+}
+
+func Test_Pull_Digest_Mismatch(t *testing.T) {
+	mounts := stubMount(t)
+	reg, repo := newTestRegistry(t)
+	tars := testLayers(t)
+	reg.addImage(t, "latest", tars...)
+	// the registry serves another layer of the same size
+	d := digestOf(tars[1])
+	reg.blobs[d] = bytes.ReplaceAll(reg.blobs[d], []byte("etc/top"), []byte("etc/bad"))
+
+	dir := filepath.Join(t.TempDir(), "layers")
+	e := &testEnforcer{devices: make(map[string]string)}
+	if _, err := Pull(context.Background(), repo+":latest", dir, Options{}, e); err == nil {
+		t.Fatal("expected pull of tampered layer to fail")
+	}
+	if len(mounts) != 0 || len(e.devices) != 0 {
+		t.Fatalf("expected pulled layers to be removed, got %v", mounts)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected layer directory to be removed, got %v", err)
+	}
+}
+
+func Test_Pull_Denied(t *testing.T) {
+	mounts := stubMount(t)
+	reg, repo := newTestRegistry(t)
+	tars := testLayers(t)
+	reg.addImage(t, "latest", tars...)
+
+	dir := filepath.Join(t.TempDir(), "layers")
+	e := &testEnforcer{deny: layerHash(t, tars[1]), devices: make(map[string]string)}
+	if _, err := Pull(context.Background(), repo+":latest", dir, Options{}, e); err == nil {
+		t.Fatal("expected pull of denied layer to fail")
+	}
+	if len(mounts) != 0 || len(e.devices) != 0 {
+		t.Fatalf("expected pulled layers to be removed, got %v", mounts)
+	}
+}
+
+func Test_Pull_Dir_Denied(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("creating whiteouts requires root")
+	}
+	stubMount(t)
+	reg, repo := newTestRegistry(t)
+	tars := testLayers(t)
+	reg.addImage(t, "latest", tars...)
+
+	dir := filepath.Join(t.TempDir(), "layers")
+	e := &testEnforcer{deny: layerHash(t, tars[1]), devices: make(map[string]string)}
+	opts := Options{Unpack: guestresource.GuestPullUnpackDir}
+	if _, err := Pull(context.Background(), repo+":latest", dir, opts, e); err == nil {
+		t.Fatal("expected pull of denied layer to fail")
+	}
+	// the layers extracted as they were converted are removed
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected layer directory to be removed, got %v", err)
+	}
+}
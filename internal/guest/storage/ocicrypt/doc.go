@@ -0,0 +1,5 @@
+// Package ocicrypt decrypts container image layers encrypted with ocicrypt,
+// so that the layers of an image remain opaque to the host. The symmetric key
+// of a layer is wrapped with a key held by a key broker, which only releases it
+// to an attested UVM.
+package ocicrypt
@@ -0,0 +1,118 @@
+package ocicrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Microsoft/hcsshim/ext4/dmverity"
+	"github.com/Microsoft/hcsshim/ext4/tar2ext4"
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
+)
+
+// ConvertLayer writes the layer read from r to an ext4 image at path, followed
+// by its dm-verity hash tree, and returns the dm-verity information of the
+// image. Its root digest is the digest of the layer in security policies.
+//
+// Tar layers are converted in the same way as the layers of a policy, so that
+// their digests match. The caller must not use the image if an error is
+// returned, which is also the case when the layer fails to be authenticated.
+//
+// The image is only to be mounted through dm-verity with the returned
+// information, which is computed as the layer is read rather than from the
+// image, so that changes to the image after it was written are detected.
+func ConvertLayer(r io.Reader, format string, path string) (_ *guestresource.DeviceVerityInfo, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create layer image: %w", err)
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+
+	switch format {
+	case guestresource.EncryptedLayerFormatTar:
+		options := []tar2ext4.Option{
+			tar2ext4.ConvertWhiteout,
+			tar2ext4.MaximumDiskSize(dmverity.RecommendedVHDSizeGB),
+		}
+		if err := tar2ext4.ConvertTarToExt4(r, f, options...); err != nil {
+			return nil, fmt.Errorf("failed to convert layer to ext4: %w", err)
+		}
+		// the converter may not read the end of the tar stream, which must
+		// be read for the layer to be authenticated
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, err
+		}
+	case guestresource.EncryptedLayerFormatExt4:
+		if _, err := io.Copy(f, r); err != nil {
+			return nil, fmt.Errorf("failed to decrypt layer: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encrypted layer format %q", format)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	size, _, err := tar2ext4.Ext4FileSystemSize(f)
+	if err != nil {
+		return nil, fmt.Errorf("layer is not an ext4 image: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if size%verityBlockSize != 0 {
+		return nil, fmt.Errorf("layer size %d is not a multiple of %d", size, verityBlockSize)
+	}
+	tree, err := dmverity.MerkleTree(bufio.NewReaderSize(io.LimitReader(f, size), dmverity.MerkleTreeBufioSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute layer digest: %w", err)
+	}
+	return appendHashDevice(f, size, tree)
+}
+
+// verityBlockSize is the size of the data and hash blocks of the dm-verity
+// hash trees of layers.
+const verityBlockSize = 4096
+
+// appendHashDevice replaces anything following the first `size` bytes of the
+// image `f` with the dm-verity super block and hash tree `tree`, as for the
+// layers of a policy, and returns the dm-verity information of the image.
+func appendHashDevice(f *os.File, size int64, tree []byte) (*guestresource.DeviceVerityInfo, error) {
+	if err := f.Truncate(size); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sb := dmverity.NewDMVeritySuperblock(uint64(size))
+	w := bufio.NewWriter(f)
+	if err := binary.Write(w, binary.LittleEndian, sb); err != nil {
+		return nil, fmt.Errorf("failed to write dm-verity super block: %w", err)
+	}
+	if _, err := w.Write(make([]byte, verityBlockSize-binary.Size(sb))); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(tree); err != nil {
+		return nil, fmt.Errorf("failed to write dm-verity hash tree: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return &guestresource.DeviceVerityInfo{
+		Ext4SizeInBytes: size,
+		Version:         int(sb.Version),
+		Algorithm:       string(bytes.TrimRight(sb.Algorithm[:], "\x00")),
+		SuperBlock:      true,
+		RootDigest:      fmt.Sprintf("%x", dmverity.RootHash(tree)),
+		Salt:            fmt.Sprintf("%x", sb.Salt[:sb.SaltSize]),
+		BlockSize:       verityBlockSize,
+	}, nil
+}
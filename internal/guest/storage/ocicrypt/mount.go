@@ -0,0 +1,162 @@
+//go:build linux
+// +build linux
+
+package ocicrypt
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opencensus.io/trace"
+	"golang.org/x/sys/unix"
+
+	"github.com/Microsoft/hcsshim/internal/guest/storage"
+	dm "github.com/Microsoft/hcsshim/internal/guest/storage/devicemapper"
+	"github.com/Microsoft/hcsshim/internal/log"
+	"github.com/Microsoft/hcsshim/internal/oc"
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
+)
+
+const loopControlPath = "/dev/loop-control"
+
+// Test dependencies
+var (
+	osMkdirAll      = os.MkdirAll
+	osRemove        = os.Remove
+	unixMount       = unix.Mount
+	attachLoop      = attachLoopDevice
+	storageUnmount  = storage.UnmountPath
+	maxLoopAttempts = 10
+	// createVerityTarget is stubbed for unit testing `Mount`.
+	createVerityTarget = dm.CreateVerityTarget
+	// removeDevice is stubbed for unit testing `Unmount`.
+	removeDevice = dm.RemoveDevice
+)
+
+// verityDeviceName returns the name of the dm-verity target of the layer
+// mounted at `target`.
+func verityDeviceName(target string) string {
+	return fmt.Sprintf("dm-verity-layer-%x", sha256.Sum256([]byte(target)))
+}
+
+// Mount mounts the layer image at `target`, read-only, through a dm-verity
+// target with `verityInfo`, as returned by ConvertLayer for the image, on top of
+// a loop device. Reads of the layer fail if the image has changed since. The
+// target and loop device are released once the layer is unmounted.
+func Mount(ctx context.Context, image, target string, verityInfo *guestresource.DeviceVerityInfo) (err error) {
+	_, span := oc.StartSpan(ctx, "ocicrypt::Mount")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+
+	span.AddAttributes(
+		trace.StringAttribute("image", image),
+		trace.StringAttribute("target", target))
+
+	if err := osMkdirAll(target, 0700); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(target)
+		}
+	}()
+
+	loop, err := attachLoop(image)
+	if err != nil {
+		return err
+	}
+	// the loop device is detached once closed, unless the dm-verity target
+	// uses it
+	defer loop.Close()
+	name := verityDeviceName(target)
+	source, err := createVerityTarget(ctx, loop.Name(), name, verityInfo)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if err := removeDevice(name); err != nil {
+				log.G(ctx).WithError(err).WithField("verityTarget", name).Debug("failed to cleanup verity target")
+			}
+		}
+	}()
+	if err := unixMount(source, target, "ext4", unix.MS_RDONLY, "noload"); err != nil {
+		return errors.Wrapf(err, "failed to mount %s onto %s", source, target)
+	}
+	return nil
+}
+
+// Unmount unmounts the layer at `target`, removes its dm-verity target and
+// then its image.
+func Unmount(ctx context.Context, image, target string) (err error) {
+	_, span := oc.StartSpan(ctx, "ocicrypt::Unmount")
+	defer span.End()
+	defer func() { oc.SetSpanStatus(span, err) }()
+
+	span.AddAttributes(
+		trace.StringAttribute("image", image),
+		trace.StringAttribute("target", target))
+
+	if err := storageUnmount(ctx, target, true); err != nil {
+		return err
+	}
+	if err := removeDevice(verityDeviceName(target)); err != nil {
+		return errors.Wrapf(err, "failed to remove dm-verity target of layer at %s", target)
+	}
+	if err := osRemove(image); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to remove layer image %s", image)
+	}
+	return nil
+}
+
+// attachLoopDevice attaches the image to a free loop device, read-only, and
+// returns the opened device. The device is detached automatically once it is
+// neither opened nor mounted.
+func attachLoopDevice(image string) (*os.File, error) {
+	f, err := os.Open(image)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	control, err := os.OpenFile(loopControlPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open loop control")
+	}
+	defer control.Close()
+
+	// another loop device user may take the free device before it is
+	// attached, in which case attaching fails with EBUSY
+	for i := 0; i < maxLoopAttempts; i++ {
+		n, err := unix.IoctlRetInt(int(control.Fd()), unix.LOOP_CTL_GET_FREE)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find a free loop device")
+		}
+		device := fmt.Sprintf("/dev/loop%d", n)
+		loop, err := os.OpenFile(device, os.O_RDONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		err = unix.IoctlSetInt(int(loop.Fd()), unix.LOOP_SET_FD, int(f.Fd()))
+		if errors.Is(err, unix.EBUSY) {
+			loop.Close()
+			continue
+		}
+		if err != nil {
+			loop.Close()
+			return nil, errors.Wrapf(err, "failed to attach %s to %s", image, device)
+		}
+
+		info := &unix.LoopInfo64{Flags: unix.LO_FLAGS_READ_ONLY | unix.LO_FLAGS_AUTOCLEAR}
+		if err := unix.IoctlLoopSetStatus64(int(loop.Fd()), info); err != nil {
+			_ = unix.IoctlSetInt(int(loop.Fd()), unix.LOOP_CLR_FD, 0)
+			loop.Close()
+			return nil, errors.Wrapf(err, "failed to configure %s", device)
+		}
+		return loop, nil
+	}
+	return nil, fmt.Errorf("failed to attach %s to a loop device after %d attempts", image, maxLoopAttempts)
+}
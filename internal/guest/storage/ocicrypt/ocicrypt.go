@@ -0,0 +1,176 @@
+package ocicrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// CipherAES256CTRHMACSHA256 is the layer cipher of ocicrypt: AES-256 in CTR
+	// mode, authenticated with an HMAC-SHA256 of the ciphertext.
+	CipherAES256CTRHMACSHA256 = "AES_256_CTR_HMAC_SHA256"
+	// WrapTypeA256GCM is the wrapping of the private options of a layer with
+	// AES-256-GCM, as done by the attestation-agent key provider.
+	WrapTypeA256GCM = "A256GCM"
+
+	// PublicOptionsAnnotation is the annotation of an encrypted layer holding
+	// its PublicOptions.
+	PublicOptionsAnnotation = "org.opencontainers.image.enc.pubopts"
+	// KeyProviderAnnotationPrefix prefixes the annotations of an encrypted
+	// layer holding its private options, wrapped by a key provider.
+	KeyProviderAnnotationPrefix = "org.opencontainers.image.enc.keys.provider."
+
+	nonceOption = "nonce"
+)
+
+// PublicOptions are the options of the layer cipher which are stored in the
+// clear, see PublicLayerBlockCipherOptions of ocicrypt.
+type PublicOptions struct {
+	CipherType    string            `json:"cipher"`
+	HMAC          []byte            `json:"hmac"`
+	CipherOptions map[string][]byte `json:"cipheroptions"`
+}
+
+// PrivateOptions are the options of the layer cipher which are wrapped, see
+// PrivateLayerBlockCipherOptions of ocicrypt.
+type PrivateOptions struct {
+	SymmetricKey  []byte            `json:"symkey"`
+	Digest        digest.Digest     `json:"digest"`
+	CipherOptions map[string][]byte `json:"cipheroptions"`
+}
+
+// WrappedKey is the value of the key provider annotation of a layer: its
+// private options encrypted with the key KeyID.
+type WrappedKey struct {
+	KeyID       string `json:"kid"`
+	WrappedData []byte `json:"wrapped_data"`
+	IV          []byte `json:"iv"`
+	WrapType    string `json:"wrap_type"`
+}
+
+// ParsePublicOptions parses the base64 encoded value of the
+// PublicOptionsAnnotation of a layer.
+func ParsePublicOptions(annotation string) (*PublicOptions, error) {
+	b, err := base64.StdEncoding.DecodeString(annotation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public options: %w", err)
+	}
+	opts := &PublicOptions{}
+	if err := json.Unmarshal(b, opts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal public options: %w", err)
+	}
+	if opts.CipherType != CipherAES256CTRHMACSHA256 {
+		return nil, fmt.Errorf("unsupported layer cipher %q", opts.CipherType)
+	}
+	return opts, nil
+}
+
+// ParseWrappedKey parses the base64 encoded value of the key provider
+// annotation of a layer.
+func ParseWrappedKey(annotation string) (*WrappedKey, error) {
+	b, err := base64.StdEncoding.DecodeString(annotation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode wrapped key: %w", err)
+	}
+	wk := &WrappedKey{}
+	if err := json.Unmarshal(b, wk); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal wrapped key: %w", err)
+	}
+	if wk.KeyID == "" {
+		return nil, errors.New("wrapped key has no key ID")
+	}
+	if wk.WrapType != WrapTypeA256GCM {
+		return nil, fmt.Errorf("unsupported key wrapping %q", wk.WrapType)
+	}
+	return wk, nil
+}
+
+// Unwrap decrypts the private options of the layer with the key released for
+// KeyID.
+func (wk *WrappedKey) Unwrap(key []byte) (*PrivateOptions, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q: %w", wk.KeyID, err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(wk.IV))
+	if err != nil {
+		return nil, err
+	}
+	b, err := gcm.Open(nil, wk.IV, wk.WrappedData, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap private options with key %q: %w", wk.KeyID, err)
+	}
+	opts := &PrivateOptions{}
+	if err := json.Unmarshal(b, opts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal private options: %w", err)
+	}
+	return opts, nil
+}
+
+// NewDecryptReader returns a reader of the plaintext of the layer read from r.
+// The HMAC of the layer, and the digest of its plaintext when known, are
+// checked once r is exhausted: a mismatch is returned instead of io.EOF, so
+// the plaintext must not be trusted until then.
+func NewDecryptReader(r io.Reader, pub *PublicOptions, priv *PrivateOptions) (io.Reader, error) {
+	if pub.CipherType != CipherAES256CTRHMACSHA256 {
+		return nil, fmt.Errorf("unsupported layer cipher %q", pub.CipherType)
+	}
+	if len(priv.SymmetricKey) != 32 {
+		return nil, fmt.Errorf("invalid layer key length %d", len(priv.SymmetricKey))
+	}
+	nonce := priv.CipherOptions[nonceOption]
+	if len(nonce) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid layer nonce length %d", len(nonce))
+	}
+	block, err := aes.NewCipher(priv.SymmetricKey)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, priv.SymmetricKey)
+	d := &decryptReader{
+		r:        &cipher.StreamReader{S: cipher.NewCTR(block, nonce), R: io.TeeReader(r, mac)},
+		mac:      mac,
+		expected: pub.HMAC,
+	}
+	if priv.Digest != "" {
+		if err := priv.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid layer digest: %w", err)
+		}
+		d.verifier = priv.Digest.Verifier()
+	}
+	return d, nil
+}
+
+type decryptReader struct {
+	r        io.Reader
+	mac      hash.Hash
+	expected []byte
+	verifier digest.Verifier
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if d.verifier != nil {
+		_, _ = d.verifier.Write(p[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		if !hmac.Equal(d.mac.Sum(nil), d.expected) {
+			return n, errors.New("layer HMAC does not match, the layer has been tampered with")
+		}
+		if d.verifier != nil && !d.verifier.Verified() {
+			return n, errors.New("layer digest does not match its plaintext")
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,258 @@
+package ocicrypt
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/Microsoft/hcsshim/ext4/tar2ext4"
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
+	"github.com/Microsoft/hcsshim/internal/verity"
+)
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// encryptLayer encrypts the layer as ocicrypt does, and wraps its private
+// options with kek as the attestation-agent key provider does. It returns the
+// encrypted layer and its public options and wrapped key annotations.
+func encryptLayer(t *testing.T, layer []byte, kek []byte) ([]byte, string, string) {
+	t.Helper()
+
+	key := randomBytes(t, 32)
+	nonce := randomBytes(t, aes.BlockSize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := make([]byte, len(layer))
+	cipher.NewCTR(block, nonce).XORKeyStream(encrypted, layer)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(encrypted)
+
+	pub, err := json.Marshal(&PublicOptions{
+		CipherType:    CipherAES256CTRHMACSHA256,
+		HMAC:          mac.Sum(nil),
+		CipherOptions: map[string][]byte{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := json.Marshal(&PrivateOptions{
+		SymmetricKey:  key,
+		Digest:        digest.FromBytes(layer),
+		CipherOptions: map[string][]byte{nonceOption: nonce},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err = aes.NewCipher(kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := randomBytes(t, gcm.NonceSize())
+	wrapped, err := json.Marshal(&WrappedKey{
+		KeyID:       "kbs:///default/key/1",
+		WrappedData: gcm.Seal(nil, iv, priv, nil),
+		IV:          iv,
+		WrapType:    WrapTypeA256GCM,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encrypted, base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(wrapped)
+}
+
+func decryptLayer(t *testing.T, encrypted []byte, pubOpts, wrappedKey string, kek []byte) (io.Reader, error) {
+	t.Helper()
+
+	pub, err := ParsePublicOptions(pubOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wk, err := ParseWrappedKey(wrappedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wk.KeyID != "kbs:///default/key/1" {
+		t.Fatalf("unexpected key ID %q", wk.KeyID)
+	}
+	priv, err := wk.Unwrap(kek)
+	if err != nil {
+		return nil, err
+	}
+	return NewDecryptReader(bytes.NewReader(encrypted), pub, priv)
+}
+
+func testTar(t *testing.T) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	content := []byte("hello from an encrypted layer\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "hello.txt", Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_Decrypt_Layer(t *testing.T) {
+	kek := randomBytes(t, 32)
+	layer := randomBytes(t, 100000)
+	encrypted, pub, wrapped := encryptLayer(t, layer, kek)
+
+	r, err := decryptLayer(t, encrypted, pub, wrapped, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decrypt layer: %s", err)
+	}
+	if !bytes.Equal(decrypted, layer) {
+		t.Fatal("decrypted layer doesn't match")
+	}
+}
+
+func Test_Decrypt_Layer_Tampered(t *testing.T) {
+	kek := randomBytes(t, 32)
+	encrypted, pub, wrapped := encryptLayer(t, randomBytes(t, 1000), kek)
+	encrypted[500] ^= 1
+
+	r, err := decryptLayer(t, encrypted, pub, wrapped, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); err == nil || !strings.Contains(err.Error(), "HMAC") {
+		t.Fatalf("expected tampered layer to be rejected, got: %v", err)
+	}
+}
+
+func Test_Decrypt_Layer_Truncated(t *testing.T) {
+	kek := randomBytes(t, 32)
+	encrypted, pub, wrapped := encryptLayer(t, randomBytes(t, 1000), kek)
+
+	r, err := decryptLayer(t, encrypted[:999], pub, wrapped, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("expected truncated layer to be rejected")
+	}
+}
+
+func Test_Decrypt_Layer_Wrong_Key(t *testing.T) {
+	encrypted, pub, wrapped := encryptLayer(t, randomBytes(t, 1000), randomBytes(t, 32))
+
+	if _, err := decryptLayer(t, encrypted, pub, wrapped, randomBytes(t, 32)); err == nil {
+		t.Fatal("expected private options not to be unwrapped with another key")
+	}
+}
+
+func Test_Convert_Tar_Layer(t *testing.T) {
+	kek := randomBytes(t, 32)
+	layer := testTar(t)
+	encrypted, pub, wrapped := encryptLayer(t, layer, kek)
+
+	r, err := decryptLayer(t, encrypted, pub, wrapped, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(t.TempDir(), "layer.ext4")
+	info, err := ConvertLayer(r, guestresource.EncryptedLayerFormatTar, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the digest must be the one of the layer in security policies
+	expected, err := tar2ext4.ConvertAndComputeRootDigest(bytes.NewReader(layer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RootDigest != expected {
+		t.Fatalf("expected layer digest %s, got %s", expected, info.RootDigest)
+	}
+
+	// the hash tree follows the image as for the layers of a policy
+	appended, err := verity.ReadVeritySuperBlock(context.Background(), image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(appended, info) {
+		t.Fatalf("expected dm-verity information %+v, got %+v", info, appended)
+	}
+}
+
+func Test_Convert_Layer_Tampered(t *testing.T) {
+	kek := randomBytes(t, 32)
+	encrypted, pub, wrapped := encryptLayer(t, testTar(t), kek)
+	encrypted[len(encrypted)-1] ^= 1
+
+	r, err := decryptLayer(t, encrypted, pub, wrapped, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConvertLayer(r, guestresource.EncryptedLayerFormatTar, filepath.Join(t.TempDir(), "layer.ext4")); err == nil {
+		t.Fatal("expected tampered layer to be rejected")
+	}
+}
+
+func Test_Convert_Ext4_Layer(t *testing.T) {
+	converted := filepath.Join(t.TempDir(), "converted.ext4")
+	info, err := ConvertLayer(bytes.NewReader(testTar(t)), guestresource.EncryptedLayerFormatTar, converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := os.ReadFile(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kek := randomBytes(t, 32)
+	encrypted, pub, wrapped := encryptLayer(t, image, kek)
+	r, err := decryptLayer(t, encrypted, pub, wrapped, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the image already has a hash tree, which is replaced
+	ext4Info, err := ConvertLayer(r, guestresource.EncryptedLayerFormatExt4, filepath.Join(t.TempDir(), "layer.ext4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext4Info.RootDigest != info.RootDigest {
+		t.Fatalf("expected layer digest %s, got %s", info.RootDigest, ext4Info.RootDigest)
+	}
+}
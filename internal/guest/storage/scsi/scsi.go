@@ -51,6 +51,8 @@ var (
 	removeDevice = dm.RemoveDevice
 	// encryptDevice is stubbed for unit testing `mount`
 	encryptDevice = crypt.EncryptDevice
+	// encryptDeviceWithKey is stubbed for unit testing `mount`
+	encryptDeviceWithKey = crypt.EncryptDeviceWithKey
 	// cleanupCryptDevice is stubbed for unit testing `mount`
 	cleanupCryptDevice = crypt.CleanupCryptDevice
 	// getDeviceFsType is stubbed for unit testing `mount`
@@ -59,6 +61,8 @@ var (
 	storageUnmountPath = storage.UnmountPath
 	// tar2ext4.IsDeviceExt4 is stubbed for unit testing `getDeviceFsType`
 	_tar2ext4IsDeviceExt4 = tar2ext4.IsDeviceExt4
+	// xfs.IsDeviceXfs is stubbed for unit testing `getDeviceFsType`
+	_xfsIsDeviceXfs = xfs.IsDeviceXfs
 	// ext4Format is stubbed for unit testing the `EnsureFilesystem` flow
 	// in `mount`
 	ext4Format = ext4.Format
@@ -111,7 +115,10 @@ func ActualControllerNumber(_ context.Context, passedController uint8) (uint8, e
 // mounting or after unmounting a device. This does not include options
 // that are sent to the mount or unmount calls.
 type Config struct {
-	Encrypted        bool
+	Encrypted bool
+	// EncryptionKey is the key of an encrypted device which persists, e.g.
+	// one released by a key broker. When empty, a random key is generated.
+	EncryptionKey    []byte
 	VerityInfo       *guestresource.DeviceVerityInfo
 	EnsureFilesystem bool
 	Filesystem       string
@@ -200,17 +207,33 @@ func Mount(
 	var deviceFS string
 	if config.Encrypted {
 		cryptDeviceName := fmt.Sprintf(cryptDeviceFmt, controller, lun, partition)
-		encryptedSource, err := encryptDevice(spnCtx, source, cryptDeviceName)
+		encrypt := encryptDevice
+		if len(config.EncryptionKey) > 0 {
+			encrypt = func(ctx context.Context, source string, name string) (string, error) {
+				return encryptDeviceWithKey(ctx, source, name, config.EncryptionKey)
+			}
+		}
+		encryptedSource, err := encrypt(spnCtx, source, cryptDeviceName)
 		if err != nil {
 			// todo (maksiman): add better retry logic, similar to how SCSI device mounts are
 			// retried on unix.ENOENT and unix.ENXIO. The retry should probably be on an
 			// error message rather than actual error, because we shell-out to cryptsetup.
 			time.Sleep(500 * time.Millisecond)
-			if encryptedSource, err = encryptDevice(spnCtx, source, cryptDeviceName); err != nil {
+			if encryptedSource, err = encrypt(spnCtx, source, cryptDeviceName); err != nil {
 				return fmt.Errorf("failed to mount encrypted device %s: %w", source, err)
 			}
 		}
 		source = encryptedSource
+
+		// A device encrypted with a given key persists, so it may already have
+		// the requested filesystem, which must not be formatted again.
+		if len(config.EncryptionKey) > 0 {
+			deviceFS, err = _getDeviceFsType(source)
+			if err != nil && !errors.Is(err, ErrUnknownFilesystem) {
+				return fmt.Errorf("getting encrypted device's filesystem: %w", err)
+			}
+			log.G(ctx).WithField("filesystem", deviceFS).Debug("filesystem found on encrypted device")
+		}
 	} else {
 		// Get the filesystem that is already on the device (if any) and use that
 		// as the mountType unless `Filesystem` was given.
@@ -475,6 +498,9 @@ func getDeviceFsType(devicePath string) (string, error) {
 	if _tar2ext4IsDeviceExt4(devicePath) {
 		return "ext4", nil
 	}
+	if _xfsIsDeviceXfs(devicePath) {
+		return "xfs", nil
+	}
 
 	return "", ErrUnknownFilesystem
 }
@@ -31,6 +31,8 @@ func clearTestDependencies() {
 	storageUnmountPath = nil
 	_getDeviceFsType = nil
 	_tar2ext4IsDeviceExt4 = nil
+	_xfsIsDeviceXfs = nil
+	encryptDeviceWithKey = nil
 	ext4Format = nil
 	xfsFormat = nil
 }
@@ -978,6 +980,73 @@ func Test_Mount_EncryptDevice_Called(t *testing.T) {
 	}
 }
 
+func Test_Mount_EncryptDeviceWithKey_Preserves_Filesystem(t *testing.T) {
+	clearTestDependencies()
+
+	osMkdirAll = func(string, os.FileMode) error {
+		return nil
+	}
+	getDevicePath = func(context.Context, uint8, uint8, uint64) (string, error) {
+		return "", nil
+	}
+	var mountType string
+	unixMount = func(_ string, _ string, fstype string, _ uintptr, _ string) error {
+		mountType = fstype
+		return nil
+	}
+	expectedCryptTarget := fmt.Sprintf(cryptDeviceFmt, 0, 0, 0)
+	expectedDevicePath := "/dev/mapper/" + expectedCryptTarget
+	key := []byte("released key")
+
+	encryptDevice = func(context.Context, string, string) (string, error) {
+		t.Fatal("expected the device to be encrypted with the given key")
+		return "", nil
+	}
+	encryptDeviceWithKey = func(_ context.Context, _ string, devName string, k []byte) (string, error) {
+		if devName != expectedCryptTarget {
+			t.Fatalf("expected crypt device %q got %q", expectedCryptTarget, devName)
+		}
+		if string(k) != string(key) {
+			t.Fatalf("expected key %q got %q", key, k)
+		}
+		return expectedDevicePath, nil
+	}
+	_getDeviceFsType = func(source string) (string, error) {
+		if source != expectedDevicePath {
+			t.Fatalf("expected filesystem of %q got %q", expectedDevicePath, source)
+		}
+		return "xfs", nil
+	}
+	osStat = osStatNoop
+
+	xfsFormat = func(string) error {
+		t.Fatal("expected the existing filesystem not to be formatted")
+		return nil
+	}
+
+	config := &Config{
+		Encrypted:        true,
+		EncryptionKey:    key,
+		EnsureFilesystem: true,
+		Filesystem:       "xfs",
+	}
+	if err := Mount(
+		context.Background(),
+		0,
+		0,
+		0,
+		"/fake/path",
+		false,
+		nil,
+		config,
+	); err != nil {
+		t.Fatalf("expected nil error, got: %s", err)
+	}
+	if mountType != "xfs" {
+		t.Fatalf("expected xfs mount, got %q", mountType)
+	}
+}
+
 func Test_Mount_EncryptDevice_Mkfs_Error(t *testing.T) {
 	clearTestDependencies()
 
@@ -1302,6 +1371,9 @@ func Test_GetDeviceFsType_Error(t *testing.T) {
 	_tar2ext4IsDeviceExt4 = func(string) bool {
 		return false
 	}
+	_xfsIsDeviceXfs = func(string) bool {
+		return false
+	}
 
 	fsType, err := getDeviceFsType(devicePath)
 	if err == nil {
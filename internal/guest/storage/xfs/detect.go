@@ -0,0 +1,26 @@
+package xfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// superBlockMagic is the magic at the start of the primary superblock.
+var superBlockMagic = []byte("XFSB")
+
+// IsDeviceXfs returns whether the device at `devicePath` has an xfs
+// filesystem.
+func IsDeviceXfs(devicePath string) bool {
+	f, err := os.Open(devicePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(superBlockMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, superBlockMagic)
+}
@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package transport
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// UnixTransport is an implementation of Transport which uses unix sockets in
+// a directory, named after the port, in place of vsock. The host side listens
+// on the socket of a port, which the GCS then dials.
+//
+// It allows the GCS to be run outside of a UVM, such as by tests.
+type UnixTransport struct {
+	// Dir is the directory of the sockets.
+	Dir string
+}
+
+var _ Transport = &UnixTransport{}
+
+// Path returns the path of the socket for `port`.
+func (t *UnixTransport) Path(port uint32) string {
+	return filepath.Join(t.Dir, strconv.FormatUint(uint64(port), 10)+".sock")
+}
+
+// Listen listens on the socket for `port`, which is removed when the listener
+// is closed.
+func (t *UnixTransport) Listen(port uint32) (*net.UnixListener, error) {
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: t.Path(port), Net: "unix"})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unix listen port (%d) failed", port)
+	}
+	return l, nil
+}
+
+// Dial connects to the socket for `port`, which must already be listened on.
+func (t *UnixTransport) Dial(port uint32) (Connection, error) {
+	logrus.WithFields(logrus.Fields{
+		"port": port,
+	}).Info("opengcs::UnixTransport::Dial - unix dial port")
+
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: t.Path(port), Net: "unix"})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unix Dial port (%d) failed", port)
+	}
+	return conn, nil
+}
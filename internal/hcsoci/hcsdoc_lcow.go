@@ -99,6 +99,10 @@ type linuxHostedSystem struct {
 	// VHD is mounted inside the UVM. But in case of scratch sharing this is a
 	// directory under the UVM scratch directory.
 	ScratchDirPath string
+
+	// CheckpointImagePath is the path inside the UVM of the checkpoint image to
+	// restore the container from, if any.
+	CheckpointImagePath string `json:",omitempty"`
 }
 
 func createLinuxContainerDocument(ctx context.Context, coi *createOptionsInternal, guestRoot, scratchPath string) (*linuxHostedSystem, error) {
@@ -109,9 +113,10 @@ func createLinuxContainerDocument(ctx context.Context, coi *createOptionsInterna
 
 	log.G(ctx).WithField("guestRoot", guestRoot).Debug("hcsshim::createLinuxContainerDoc")
 	return &linuxHostedSystem{
-		SchemaVersion:    schemaversion.SchemaV21(),
-		OciBundlePath:    guestRoot,
-		OciSpecification: spec,
-		ScratchDirPath:   scratchPath,
+		SchemaVersion:       schemaversion.SchemaV21(),
+		OciBundlePath:       guestRoot,
+		OciSpecification:    spec,
+		ScratchDirPath:      scratchPath,
+		CheckpointImagePath: coi.Spec.Annotations[annotations.LCOWCheckpointImagePath],
 	}, nil
 }
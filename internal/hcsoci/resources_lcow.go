@@ -19,8 +19,10 @@ import (
 	"github.com/Microsoft/hcsshim/internal/guestpath"
 	"github.com/Microsoft/hcsshim/internal/layers"
 	"github.com/Microsoft/hcsshim/internal/log"
+	"github.com/Microsoft/hcsshim/internal/oci"
 	"github.com/Microsoft/hcsshim/internal/resources"
 	"github.com/Microsoft/hcsshim/internal/uvm/scsi"
+	"github.com/Microsoft/hcsshim/pkg/annotations"
 )
 
 func allocateLinuxResources(ctx context.Context, coi *createOptionsInternal, r *resources.Resources, isSandbox bool) error {
@@ -30,6 +32,14 @@ func allocateLinuxResources(ctx context.Context, coi *createOptionsInternal, r *
 	containerRootInUVM := r.ContainerRootInUVM()
 	if coi.LCOWLayers != nil {
 		log.G(ctx).Debug("hcsshim::allocateLinuxResources mounting storage")
+		coi.LCOWLayers.ScratchEncryptionKeyID = oci.ParseAnnotationsString(coi.Spec.Annotations, annotations.LCOWScratchEncryptionKeyID, "")
+		if image := oci.ParseAnnotationsString(coi.Spec.Annotations, annotations.LCOWGuestPullImage, ""); image != "" {
+			coi.LCOWLayers.GuestPull = &layers.GuestPull{
+				Image:       image,
+				Unpack:      oci.ParseAnnotationsString(coi.Spec.Annotations, annotations.LCOWGuestPullUnpack, ""),
+				NamespaceID: coi.actualNetworkNamespace,
+			}
+		}
 		rootPath, scratchPath, closer, err := layers.MountLCOWLayers(ctx, coi.actualID, coi.LCOWLayers, containerRootInUVM, coi.HostingSystem)
 		if err != nil {
 			return errors.Wrap(err, "failed to mount container storage")
@@ -18,6 +18,7 @@ import (
 	"github.com/Microsoft/hcsshim/internal/guestpath"
 	"github.com/Microsoft/hcsshim/internal/log"
 	"github.com/Microsoft/hcsshim/internal/ospath"
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
 	"github.com/Microsoft/hcsshim/internal/resources"
 	"github.com/Microsoft/hcsshim/internal/uvm"
 	"github.com/Microsoft/hcsshim/internal/uvm/scsi"
@@ -37,17 +38,47 @@ type LCOWLayers struct {
 	// Should be in order from top-most layer to bottom-most layer.
 	Layers         []*LCOWLayer
 	ScratchVHDPath string
+	// ScratchEncryptionKeyID is the ID of the key which the guest requests
+	// from its key broker to encrypt the scratch with, if any.
+	ScratchEncryptionKeyID string
+	// GuestPull, if set, has the guest pull the image of the container itself,
+	// in which case Layers are not mounted.
+	GuestPull *GuestPull
+}
+
+// GuestPull describes the image which the guest pulls from a registry for the
+// root filesystem of a container, rather than the host attaching its layers.
+type GuestPull struct {
+	// Image is the reference of the image.
+	Image string
+	// Unpack is how the guest unpacks the layers of the image, either
+	// guestresource.GuestPullUnpackExt4, the default, or
+	// guestresource.GuestPullUnpackDir.
+	Unpack string
+	// NamespaceID is the network namespace of the pod, through which the
+	// guest reaches the registry.
+	NamespaceID string
 }
 
 type lcowLayersCloser struct {
 	uvm                     *uvm.UtilityVM
 	guestCombinedLayersPath string
-	scratchMount            resources.ResourceCloser
-	layerClosers            []resources.ResourceCloser
+	// guestPulledScratchPath is the scratch path in the UVM of the container,
+	// if the guest pulled its image.
+	guestPulledScratchPath string
+	scratchMount           resources.ResourceCloser
+	layerClosers           []resources.ResourceCloser
 }
 
 func (lc *lcowLayersCloser) Release(ctx context.Context) (retErr error) {
-	if err := lc.uvm.RemoveCombinedLayersLCOW(ctx, lc.guestCombinedLayersPath); err != nil {
+	if lc.guestPulledScratchPath != "" {
+		if err := lc.uvm.RemovePulledImageLCOW(ctx, lc.guestPulledScratchPath, lc.guestCombinedLayersPath); err != nil {
+			log.G(ctx).WithError(err).Error("failed RemovePulledImageLCOW")
+			if retErr == nil { //nolint:govet // nilness: consistency with below
+				retErr = fmt.Errorf("first error: %w", err)
+			}
+		}
+	} else if err := lc.uvm.RemoveCombinedLayersLCOW(ctx, lc.guestCombinedLayersPath); err != nil {
 		log.G(ctx).WithError(err).Error("failed RemoveCombinedLayersLCOW")
 		if retErr == nil { //nolint:govet // nilness: consistency with below
 			retErr = fmt.Errorf("first error: %w", err)
@@ -110,7 +141,12 @@ func MountLCOWLayers(
 		}
 	}()
 
-	for _, layer := range layers.Layers {
+	hostLayers := layers.Layers
+	if layers.GuestPull != nil {
+		// the guest pulls the layers of the image itself
+		hostLayers = nil
+	}
+	for _, layer := range hostLayers {
 		log.G(ctx).WithField("layerPath", layer.VHDPath).Debug("mounting layer")
 		uvmPath, closer, err := addLCOWLayer(ctx, vm, layer)
 		if err != nil {
@@ -143,6 +179,9 @@ func MountLCOWLayers(
 	if vm.ScratchEncryptionEnabled() {
 		// Encrypted scratch devices are formatted with xfs
 		mConfig.Filesystem = "xfs"
+		mConfig.EncryptionKeyID = layers.ScratchEncryptionKeyID
+	} else if layers.ScratchEncryptionKeyID != "" {
+		return "", "", nil, errors.New("a scratch encryption key requires scratch encryption to be enabled")
 	}
 	scsiMount, err := vm.SCSIManager.AddVirtualDisk(
 		ctx,
@@ -170,17 +209,30 @@ func MountLCOWLayers(
 	}()
 
 	rootfs := ospath.Join(vm.OS(), guestRoot, guestpath.RootfsPath)
-	err = vm.CombineLayersLCOW(ctx, containerID, lcowUvmLayerPaths, containerScratchPathInUVM, rootfs)
-	if err != nil {
-		return "", "", nil, err
-	}
-	log.G(ctx).Debug("hcsshim::MountLCOWLayers Succeeded")
 	closer := &lcowLayersCloser{
 		uvm:                     vm,
 		guestCombinedLayersPath: rootfs,
 		scratchMount:            scsiMount,
 		layerClosers:            layerClosers,
 	}
+	if gp := layers.GuestPull; gp != nil {
+		log.G(ctx).WithField("image", gp.Image).Debug("pulling image in the guest")
+		err = vm.PullImageLCOW(ctx, guestresource.LCOWGuestPulledImage{
+			ContainerID:       containerID,
+			ContainerRootPath: rootfs,
+			ScratchPath:       containerScratchPathInUVM,
+			Image:             gp.Image,
+			NamespaceID:       gp.NamespaceID,
+			Unpack:            gp.Unpack,
+		})
+		closer.guestPulledScratchPath = containerScratchPathInUVM
+	} else {
+		err = vm.CombineLayersLCOW(ctx, containerID, lcowUvmLayerPaths, containerScratchPathInUVM, rootfs)
+	}
+	if err != nil {
+		return "", "", nil, err
+	}
+	log.G(ctx).Debug("hcsshim::MountLCOWLayers Succeeded")
 	return rootfs, containerScratchPathInUVM, closer, nil
 }
 
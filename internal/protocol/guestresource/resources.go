@@ -55,6 +55,21 @@ const (
 	ResourceTypeSecurityPolicy guestrequest.ResourceType = "SecurityPolicy"
 	// ResourceTypePolicyFragment is the modify resource type for injecting policy fragments.
 	ResourceTypePolicyFragment guestrequest.ResourceType = "SecurityPolicyFragment"
+	// ResourceTypePolicyFragmentReplace is the modify resource type for replacing
+	// the policy fragments loaded from a feed with a newer version.
+	ResourceTypePolicyFragmentReplace guestrequest.ResourceType = "SecurityPolicyFragmentReplace"
+	// ResourceTypePolicyFragmentRevoke is the modify resource type for revoking a
+	// policy fragment feed.
+	ResourceTypePolicyFragmentRevoke guestrequest.ResourceType = "SecurityPolicyFragmentRevoke"
+	// ResourceTypePolicyFragmentMinimumSVN is the modify resource type for raising
+	// the minimum SVN of a policy fragment feed.
+	ResourceTypePolicyFragmentMinimumSVN guestrequest.ResourceType = "SecurityPolicyFragmentMinimumSVN"
+	// ResourceTypeSecurityPolicyReplace is the modify resource type for replacing
+	// a signed security policy with a newer version.
+	ResourceTypeSecurityPolicyReplace guestrequest.ResourceType = "SecurityPolicyReplace"
+	// ResourceTypeGuestPulledImage is the modify resource type for the root
+	// filesystem of a container whose image the guest pulls from a registry.
+	ResourceTypeGuestPulledImage guestrequest.ResourceType = "GuestPulledImage"
 )
 
 // This class is used by a modify request to add or remove a combined layers
@@ -70,6 +85,39 @@ type LCOWCombinedLayers struct {
 	ScratchPath       string            `json:",omitempty"`
 }
 
+const (
+	// GuestPullUnpackExt4 unpacks each layer of a guest pulled image into an
+	// ext4 image on the scratch, which is mounted read-only.
+	GuestPullUnpackExt4 = "ext4"
+	// GuestPullUnpackDir extracts each layer of a guest pulled image into a
+	// directory on the scratch, which overlayfs uses directly.
+	GuestPullUnpackDir = "dir"
+)
+
+// LCOWGuestPulledImage is used by a modify request to add or remove the root
+// filesystem of a container from an image which the guest pulls from a
+// registry itself, rather than from layers which the host attaches, so that
+// the host never sees the contents of the image. The layers are unpacked onto
+// the scratch, and combined as for LCOWCombinedLayers.
+type LCOWGuestPulledImage struct {
+	ContainerID       string `json:",omitempty"`
+	ContainerRootPath string `json:",omitempty"`
+	ScratchPath       string `json:",omitempty"`
+	// Image is the reference of the image, such as
+	// "registry.example.com/repo:tag" or "registry.example.com/repo@sha256:...".
+	Image string `json:",omitempty"`
+	// NamespaceID is the network namespace of the pod, from which the registry
+	// is reached. If empty, the registry is reached from the network of the UVM.
+	NamespaceID string `json:",omitempty"`
+	// Unpack is GuestPullUnpackExt4, the default, or GuestPullUnpackDir.
+	Unpack string `json:",omitempty"`
+	// PlainHTTP reaches the registry over HTTP rather than HTTPS.
+	PlainHTTP bool `json:",omitempty"`
+	// Username and Password are the credentials of the registry, if any.
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+}
+
 type WCOWCombinedLayers struct {
 	ContainerRootPath string                         `json:"ContainerRootPath,omitempty"`
 	Layers            []hcsschema.Layer              `json:"Layers,omitempty"`
@@ -106,12 +154,44 @@ type LCOWMappedVirtualDisk struct {
 	Encrypted  bool     `json:"Encrypted,omitempty"`
 	Options    []string `json:"Options,omitempty"`
 	BlockDev   bool     `json:"BlockDev,omitempty"`
+	// EncryptionKeyID is the ID of the key which the guest requests from its
+	// key broker to encrypt the disk with, instead of an ephemeral key.
+	EncryptionKeyID string `json:"EncryptionKeyID,omitempty"`
+	// EncryptedLayer is set when the disk holds a container image layer
+	// encrypted with ocicrypt, rather than a file system.
+	EncryptedLayer *LCOWEncryptedLayer `json:"EncryptedLayer,omitempty"`
 	// Deprecated: verity info is read by the guest
 	VerityInfo       *DeviceVerityInfo `json:"VerityInfo,omitempty"`
 	EnsureFilesystem bool              `json:"EnsureFilesystem,omitempty"`
 	Filesystem       string            `json:"Filesystem,omitempty"`
 }
 
+const (
+	// EncryptedLayerFormatTar is the format of an encrypted layer which is a
+	// tar once decrypted, i.e. an OCI layer.
+	EncryptedLayerFormatTar = "tar"
+	// EncryptedLayerFormatExt4 is the format of an encrypted layer which is an
+	// ext4 image once decrypted.
+	EncryptedLayerFormatExt4 = "ext4"
+)
+
+// LCOWEncryptedLayer describes a container image layer encrypted with
+// ocicrypt, which the guest decrypts with a key released by its key broker
+// before mounting it.
+type LCOWEncryptedLayer struct {
+	// Format is the format of the layer once decrypted.
+	Format string `json:"Format,omitempty"`
+	// Size is the size of the encrypted layer at the start of the disk.
+	Size int64 `json:"Size,omitempty"`
+	// PublicOptions is the "org.opencontainers.image.enc.pubopts" annotation
+	// of the layer.
+	PublicOptions string `json:"PublicOptions,omitempty"`
+	// WrappedKey is the "org.opencontainers.image.enc.keys.provider.<name>"
+	// annotation of the layer, i.e. its private options wrapped with the key
+	// of the key broker.
+	WrappedKey string `json:"WrappedKey,omitempty"`
+}
+
 type BlockCIMDevice struct {
 	CimName string
 	Lun     int32
@@ -240,3 +320,24 @@ type ConfidentialOptions struct {
 type SecurityPolicyFragment struct {
 	Fragment string `json:"Fragment,omitempty"`
 }
+
+// SignedSecurityPolicy is a base64 encoded COSE_Sign1 signed security policy
+// which replaces the current signed policy.
+type SignedSecurityPolicy struct {
+	Policy string `json:"Policy,omitempty"`
+}
+
+// SecurityPolicyFragmentRevocation identifies the policy fragment feed to
+// revoke.
+type SecurityPolicyFragmentRevocation struct {
+	Issuer string `json:"Issuer,omitempty"`
+	Feed   string `json:"Feed,omitempty"`
+}
+
+// SecurityPolicyFragmentMinimumSVN is used to raise the minimum SVN of the
+// fragments accepted from a feed.
+type SecurityPolicyFragmentMinimumSVN struct {
+	Issuer     string `json:"Issuer,omitempty"`
+	Feed       string `json:"Feed,omitempty"`
+	MinimumSVN string `json:"MinimumSVN,omitempty"`
+}
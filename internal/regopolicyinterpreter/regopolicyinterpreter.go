@@ -12,6 +12,7 @@ import (
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
 	"github.com/pkg/errors"
@@ -36,10 +37,18 @@ type RegoPolicyInterpreter struct {
 	code string
 	// Rego data namespace
 	data map[string]interface{}
+	// Store which holds a copy of data for query evaluation. All changes to
+	// data are written to it in a transaction.
+	store storage.Store
 	// Modules
 	modules map[string]*RegoModule
 	// Compiled modules
 	compiledModules *ast.Compiler
+	// Prepared queries by rule. These are only valid for the current
+	// compiledModules, and so are cleared along with them.
+	preparedQueries map[string]*rego.PreparedEvalQuery
+	// Tracers which observe query evaluation, e.g. to measure coverage
+	queryTracers []topdown.QueryTracer
 	// Logging
 	logLevel       LogLevel
 	logFile        *os.File
@@ -130,6 +139,7 @@ func NewRegoPolicyInterpreter(code string, inputData map[string]interface{}) (*R
 	policy := &RegoPolicyInterpreter{
 		code:     code,
 		data:     data,
+		store:    inmem.NewFromObjectWithOpts(data, inmem.OptReturnASTValuesOnRead(true)),
 		modules:  make(map[string]*RegoModule),
 		logLevel: LogNone,
 	}
@@ -145,7 +155,7 @@ func (r *RegoPolicyInterpreter) AddModule(id string, module *RegoModule) {
 	r.dataAndModulesMutex.Lock()
 	defer r.dataAndModulesMutex.Unlock()
 	r.modules[id] = module
-	r.compiledModules = nil
+	r.invalidate()
 }
 
 // RemoveModule removes the specified module such that it will no longer be loaded.
@@ -155,7 +165,15 @@ func (r *RegoPolicyInterpreter) RemoveModule(id string) {
 	r.dataAndModulesMutex.Lock()
 	defer r.dataAndModulesMutex.Unlock()
 	delete(r.modules, id)
-	r.compiledModules = nil
+	r.invalidate()
+}
+
+// GetModule returns the module with the specified id, if it is currently active.
+func (r *RegoPolicyInterpreter) GetModule(id string) (*RegoModule, bool) {
+	r.dataAndModulesMutex.Lock()
+	defer r.dataAndModulesMutex.Unlock()
+	module, ok := r.modules[id]
+	return module, ok
 }
 
 // IsModuleActive returns whether the specified module is currently active, i.e. being loaded
@@ -195,6 +213,13 @@ func (r *RegoPolicyInterpreter) UpdateData(key string, value interface{}) error
 	}
 
 	if _, ok := r.data[key]; ok {
+		err := r.writeStore(func(ctx context.Context, txn storage.Transaction) error {
+			return r.store.Write(ctx, txn, storage.AddOp, storage.Path{key}, value)
+		})
+		if err != nil {
+			return fmt.Errorf("unable to write data value: %w", err)
+		}
+
 		r.data[key] = value
 		return nil
 	} else {
@@ -291,24 +316,28 @@ func (r *RegoPolicyInterpreter) updateMetadata(ops []*regoMetadataOperation) err
 		return errors.New("illegal interpreter state: invalid metadata object type")
 	}
 
+	// the operations are first applied to the store, such that none of them
+	// take effect if any of them fails.
+	err := r.writeStore(func(ctx context.Context, txn storage.Transaction) error {
+		for _, op := range ops {
+			if err := r.writeMetadataOperation(ctx, txn, op); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
 	for _, op := range ops {
 		metadata := metadataRoot.getOrCreate(op.Name)
 		switch op.Action {
-		case metadataAdd:
-			if _, ok := metadata[op.Key]; ok {
-				return fmt.Errorf("cannot add metadata value, key %s[%s] already exists", op.Name, op.Key)
-			} else {
-				metadata[op.Key] = op.Value
-			}
-
-		case metadataUpdate:
+		case metadataAdd, metadataUpdate:
 			metadata[op.Key] = op.Value
 
 		case metadataRemove:
 			delete(metadata, op.Key)
-
-		default:
-			return fmt.Errorf("unrecognized metadata action: %s", op.Action)
 		}
 	}
 
@@ -317,13 +346,69 @@ func (r *RegoPolicyInterpreter) updateMetadata(ops []*regoMetadataOperation) err
 	return nil
 }
 
+func (r *RegoPolicyInterpreter) writeMetadataOperation(ctx context.Context, txn storage.Transaction, op *regoMetadataOperation) error {
+	namePath := storage.Path{"metadata", op.Name}
+	keyPath := storage.Path{"metadata", op.Name, op.Key}
+
+	if _, err := r.store.Read(ctx, txn, namePath); storage.IsNotFound(err) {
+		if err := r.store.Write(ctx, txn, storage.AddOp, namePath, map[string]interface{}{}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	_, err := r.store.Read(ctx, txn, keyPath)
+	exists := err == nil
+	if err != nil && !storage.IsNotFound(err) {
+		return err
+	}
+
+	switch op.Action {
+	case metadataAdd:
+		if exists {
+			return fmt.Errorf("cannot add metadata value, key %s[%s] already exists", op.Name, op.Key)
+		}
+		return r.store.Write(ctx, txn, storage.AddOp, keyPath, op.Value)
+
+	case metadataUpdate:
+		return r.store.Write(ctx, txn, storage.AddOp, keyPath, op.Value)
+
+	case metadataRemove:
+		if !exists {
+			return nil
+		}
+		return r.store.Write(ctx, txn, storage.RemoveOp, keyPath, nil)
+
+	default:
+		return fmt.Errorf("unrecognized metadata action: %s", op.Action)
+	}
+}
+
+// writeStore runs write in a store transaction, which is only committed if
+// write succeeds.
+func (r *RegoPolicyInterpreter) writeStore(write func(context.Context, storage.Transaction) error) error {
+	ctx := context.Background()
+	txn, err := r.store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return err
+	}
+
+	if err := write(ctx, txn); err != nil {
+		r.store.Abort(ctx, txn)
+		return err
+	}
+
+	return r.store.Commit(ctx, txn)
+}
+
 // EnableLogging enables logging to the provided path at the specified level.
 func (r *RegoPolicyInterpreter) EnableLogging(path string, level LogLevel) error {
 	// this mutex ensures no-one reads compiledModules before we clear it
 	r.dataAndModulesMutex.Lock()
 	defer r.dataAndModulesMutex.Unlock()
 
-	r.compiledModules = nil
+	r.invalidate()
 	r.logLevel = level
 
 	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
@@ -347,7 +432,7 @@ func (r *RegoPolicyInterpreter) SetLogLevel(level LogLevel) {
 	r.dataAndModulesMutex.Lock()
 	defer r.dataAndModulesMutex.Unlock()
 
-	r.compiledModules = nil
+	r.invalidate()
 	r.logLevel = level
 }
 
@@ -357,7 +442,7 @@ func (r *RegoPolicyInterpreter) DisableLogging() error {
 	r.dataAndModulesMutex.Lock()
 	defer r.dataAndModulesMutex.Unlock()
 
-	r.compiledModules = nil
+	r.invalidate()
 	r.logLevel = LogNone
 	if r.logFile != nil {
 		r.logInfo("Logging disabled")
@@ -375,6 +460,14 @@ func (r *RegoPolicyInterpreter) DisableLogging() error {
 	return nil
 }
 
+// invalidate clears the compilation artifacts, i.e. the compiled modules and
+// the queries prepared with them.
+func (r *RegoPolicyInterpreter) invalidate() {
+	// dataAndModulesMutex must be held before calling this
+	r.compiledModules = nil
+	r.preparedQueries = nil
+}
+
 func (r *RegoPolicyInterpreter) compile() error {
 	// dataAndModulesMutex must be held before calling this
 
@@ -391,12 +484,40 @@ func (r *RegoPolicyInterpreter) compile() error {
 
 	if compiled, err := ast.CompileModulesWithOpt(modules, options); err == nil {
 		r.compiledModules = compiled
+		r.preparedQueries = nil
 		return nil
 	} else {
 		return fmt.Errorf("rego compilation failed: %w", err)
 	}
 }
 
+// SetCode replaces the policy code. Modules and data, including the metadata,
+// are kept. If the new code fails to compile, the previous code stays in
+// effect.
+func (r *RegoPolicyInterpreter) SetCode(code string) error {
+	r.dataAndModulesMutex.Lock()
+	defer r.dataAndModulesMutex.Unlock()
+
+	previous := r.code
+	r.code = code
+	if err := r.compile(); err != nil {
+		r.code = previous
+		return err
+	}
+
+	return nil
+}
+
+// AddQueryTracer adds a tracer which observes the evaluation of all subsequent
+// queries. This is used by tools, e.g. to measure the coverage of the framework
+// by a set of policy tests.
+func (r *RegoPolicyInterpreter) AddQueryTracer(tracer topdown.QueryTracer) {
+	r.dataAndModulesMutex.Lock()
+	defer r.dataAndModulesMutex.Unlock()
+
+	r.queryTracers = append(r.queryTracers, tracer)
+}
+
 // Compile compiles the policy and its modules. This will increase the speed of policy
 // execution.
 func (r *RegoPolicyInterpreter) Compile() error {
@@ -539,22 +660,56 @@ func (r RegoQueryResult) Union(other RegoQueryResult) RegoQueryResult {
 	return result
 }
 
-func (r *RegoPolicyInterpreter) query(rule string, input map[string]interface{}) (rego.ResultSet, error) {
+// prepare returns the prepared query for rule, which is cached until the
+// modules are compiled again.
+func (r *RegoPolicyInterpreter) prepare(ctx context.Context, rule string) (*rego.PreparedEvalQuery, error) {
 	// dataAndModulesMutex must be held before calling this
 
-	store := inmem.NewFromObject(r.data)
+	if prepared, ok := r.preparedQueries[rule]; ok {
+		return prepared, nil
+	}
 
-	var buf bytes.Buffer
 	query := rego.New(
 		rego.Query(rule),
-		rego.Input(input),
-		rego.Store(store),
+		rego.Store(r.store),
 		rego.EnablePrintStatements(r.logLevel != LogNone),
-		rego.PrintHook(topdown.NewPrintHook(&buf)),
-		rego.Compiler(r.compiledModules))
+		rego.Compiler(r.compiledModules),
+	)
+
+	prepared, err := query.PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.preparedQueries == nil {
+		r.preparedQueries = make(map[string]*rego.PreparedEvalQuery)
+	}
+	r.preparedQueries[rule] = &prepared
+	return &prepared, nil
+}
+
+func (r *RegoPolicyInterpreter) query(rule string, input map[string]interface{}, tracers ...topdown.QueryTracer) (rego.ResultSet, error) {
+	// dataAndModulesMutex must be held before calling this
 
 	ctx := context.Background()
-	resultSet, err := query.Eval(ctx)
+	prepared, err := r.prepare(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	options := []rego.EvalOption{
+		rego.EvalInput(input),
+		rego.EvalPrintHook(topdown.NewPrintHook(&buf)),
+	}
+	for _, tracer := range r.queryTracers {
+		options = append(options, rego.EvalQueryTracer(tracer))
+	}
+	for _, tracer := range tracers {
+		options = append(options, rego.EvalQueryTracer(tracer))
+	}
+
+	resultSet, err := prepared.Eval(ctx, options...)
 	output := buf.String()
 
 	r.logInfo("%s", output)
@@ -585,6 +740,29 @@ func (r *RegoPolicyInterpreter) RawQuery(rule string, input map[string]interface
 	return resultSet, nil
 }
 
+// TraceQuery queries the policy with the given rule and input data and returns
+// the raw results along with the trace of the evaluation. As with RawQuery, any
+// metadata operations in the results are not applied.
+func (r *RegoPolicyInterpreter) TraceQuery(rule string, input map[string]interface{}) (rego.ResultSet, []*topdown.Event, error) {
+	r.dataAndModulesMutex.Lock()
+	defer r.dataAndModulesMutex.Unlock()
+
+	if r.compiledModules == nil {
+		err := r.compile()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error when compiling modules: %w", err)
+		}
+	}
+
+	tracer := topdown.NewBufferTracer()
+	resultSet, err := r.query(rule, input, tracer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resultSet, *tracer, nil
+}
+
 // MetadataJSON returns the entire metadata object as a JSON string.
 // The returned JSON is a snapshot (deep-copied via marshal/unmarshal).
 func (r *RegoPolicyInterpreter) MetadataJSON() (string, error) {
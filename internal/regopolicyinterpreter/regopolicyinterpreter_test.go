@@ -11,6 +11,9 @@ import (
 	"testing"
 	"testing/quick"
 	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown"
 )
 
 const (
@@ -421,6 +424,208 @@ func Test_Module(t *testing.T) {
 
 }
 
+func Test_Metadata_Atomic(t *testing.T) {
+	rego, err := setupRego()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := generateIntPair(testRand)
+	name := metadataName(uniqueString(testRand))
+	if err := createLists(rego, p, name); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := rego.GetMetadata(string(name), "greater")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := []*regoMetadataOperation{
+		{Action: metadataUpdate, Name: string(name), Key: "greater", Value: []interface{}{-1}},
+		{Action: metadataAdd, Name: string(name), Key: "lesser", Value: []interface{}{-1}},
+	}
+	if err := rego.updateMetadata(ops); err == nil {
+		t.Fatal("expected adding an existing metadata key to fail")
+	}
+
+	after, err := rego.GetMetadata(string(name), "greater")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("metadata changed by failed operations: %v != %v", before, after)
+	}
+
+	// the store used for evaluation must also be unchanged
+	if err := appendLists(rego, p, name); err != nil {
+		t.Fatal(err)
+	}
+	gap := p.a - p.b
+	if gap < 0 {
+		gap = -gap
+	}
+	if err := computeGap(rego, name, 2*gap); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_PreparedQueries(t *testing.T) {
+	rego, err := setupRego()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := generateIntPair(testRand)
+	if _, err := getResult(rego, p, "is_greater_than"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rego.preparedQueries["data.test.is_greater_than"]; !ok {
+		t.Fatal("expected query to be prepared")
+	}
+
+	rego.AddModule("module.rego", &RegoModule{Namespace: "module", Code: moduleCode})
+	if rego.preparedQueries != nil {
+		t.Fatal("adding a module should clear the prepared queries")
+	}
+
+	if _, err := getResult(rego, p, "subtract"); err != nil {
+		t.Fatal(err)
+	}
+
+	rego.RemoveModule("module.rego")
+	if rego.preparedQueries != nil {
+		t.Fatal("removing a module should clear the prepared queries")
+	}
+}
+
+func Test_SetCode(t *testing.T) {
+	rego, err := setupRego()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := generateIntPair(testRand)
+	name := metadataName(uniqueString(testRand))
+	if err := createLists(rego, p, name); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rego.SetCode("package test\n\nis_greater_than := "); err == nil {
+		t.Fatal("expected invalid code to fail to compile")
+	}
+	if _, err := getResult(rego, p, "is_greater_than"); err != nil {
+		t.Fatalf("previous code not kept: %v", err)
+	}
+
+	if err := rego.SetCode(testCode + "\nreplaced := {\"result\": true}\n"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := rego.Query("data.test.replaced", map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced, err := result.Bool("result"); err != nil || !replaced {
+		t.Fatalf("unexpected result of the new code: %v", result)
+	}
+
+	// the metadata must be kept
+	if err := appendLists(rego, p, name); err != nil {
+		t.Fatal(err)
+	}
+	gap := p.a - p.b
+	if gap < 0 {
+		gap = -gap
+	}
+	if err := computeGap(rego, name, 2*gap); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_TraceQuery(t *testing.T) {
+	rego, err := setupRego()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]interface{}{"a": 1, "b": 2}
+	resultSet, trace, err := rego.TraceQuery("data.test.is_greater_than", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resultSet) != 1 {
+		t.Fatalf("unexpected results: %v", resultSet)
+	}
+
+	failed := false
+	for _, event := range trace {
+		if expr, ok := event.Node.(*ast.Expr); ok && event.Op == topdown.FailOp {
+			failed = failed || string(expr.Location.Text) == "input.a >= input.b"
+		}
+	}
+
+	if !failed {
+		t.Error("trace does not record the failed expression")
+	}
+}
+
+// benchmarkPodSizes are the numbers of containers in the simulated pods. Each
+// container adds metadata entries, as the framework does for its devices,
+// overlays and containers.
+var benchmarkPodSizes = []int{16, 128, 256}
+
+func setupBenchmarkPod(b *testing.B, size int) (*RegoPolicyInterpreter, []metadataName) {
+	b.Helper()
+
+	rego, err := setupRego()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	names := make([]metadataName, size)
+	for i := range names {
+		names[i] = metadataName(uniqueString(testRand))
+		if err := createLists(rego, generateIntPair(testRand), names[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return rego, names
+}
+
+func Benchmark_Query(b *testing.B) {
+	for _, size := range benchmarkPodSizes {
+		b.Run(fmt.Sprintf("containers=%d", size), func(b *testing.B) {
+			rego, _ := setupBenchmarkPod(b, size)
+			p := generateIntPair(testRand)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := getResult(rego, p, "is_greater_than"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_Query_Metadata(b *testing.B) {
+	for _, size := range benchmarkPodSizes {
+		b.Run(fmt.Sprintf("containers=%d", size), func(b *testing.B) {
+			rego, names := setupBenchmarkPod(b, size)
+			p := generateIntPair(testRand)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := appendLists(rego, p, names[i%len(names)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 // fixtures
 
 func setupRego() (*RegoPolicyInterpreter, error) {
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/cover"
+
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+const frameworkFile = "framework.rego"
+
+// ruleCoverage is the coverage of all definitions of a framework rule. A
+// definition is covered when any of its expressions was evaluated.
+type ruleCoverage struct {
+	Name        string `json:"name"`
+	Definitions int    `json:"definitions"`
+	Covered     int    `json:"covered"`
+	// UncoveredRows are the first rows of the definitions which were not
+	// covered.
+	UncoveredRows []int `json:"uncovered_rows,omitempty"`
+}
+
+type coverageReport struct {
+	File         string          `json:"file"`
+	TotalRules   int             `json:"total_rules"`
+	CoveredRules int             `json:"covered_rules"`
+	Coverage     float64         `json:"coverage"`
+	Rules        []*ruleCoverage `json:"rules"`
+}
+
+// frameworkCoverage computes the per rule coverage of framework.rego. Default
+// rules have no body to evaluate and are not included.
+func frameworkCoverage(c *cover.Cover) (*coverageReport, error) {
+	module, err := ast.ParseModule(frameworkFile, securitypolicy.FrameworkCode)
+	if err != nil {
+		return nil, err
+	}
+
+	fileReport := c.Report(map[string]*ast.Module{frameworkFile: module}).Files[frameworkFile]
+
+	report := &coverageReport{File: frameworkFile}
+	rules := map[string]*ruleCoverage{}
+	for _, rule := range module.Rules {
+		if rule.Default {
+			continue
+		}
+
+		name := rule.Head.Name.String()
+		rc, ok := rules[name]
+		if !ok {
+			rc = &ruleCoverage{Name: name}
+			rules[name] = rc
+			report.Rules = append(report.Rules, rc)
+		}
+
+		rc.Definitions++
+		start := rule.Location.Row
+		end := start + strings.Count(string(rule.Location.Text), "\n")
+		covered := false
+		for row := start; row <= end && fileReport != nil; row++ {
+			if fileReport.IsCovered(row) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			rc.Covered++
+		} else {
+			rc.UncoveredRows = append(rc.UncoveredRows, start)
+		}
+	}
+
+	report.TotalRules = len(report.Rules)
+	for _, rc := range report.Rules {
+		if rc.Covered > 0 {
+			report.CoveredRules++
+		}
+	}
+	if report.TotalRules > 0 {
+		report.Coverage = 100 * float64(report.CoveredRules) / float64(report.TotalRules)
+	}
+
+	return report, nil
+}
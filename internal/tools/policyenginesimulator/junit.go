@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// JUnit XML types, as understood by common CI systems.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+func newJUnitTestSuite(name string, results []*testResult) junitTestSuite {
+	suite := junitTestSuite{Name: name, Tests: len(results)}
+
+	var total float64
+	for _, r := range results {
+		tc := junitTestCase{
+			Name:      r.name,
+			Classname: name,
+			Time:      fmt.Sprintf("%.3f", r.duration.Seconds()),
+		}
+		total += r.duration.Seconds()
+
+		if len(r.failures) > 0 {
+			suite.Failures++
+			tc.Failure = &junitMessage{
+				Message:  fmt.Sprintf("%d expectation(s) not met", len(r.failures)),
+				Contents: strings.Join(r.failures, "\n"),
+			}
+		}
+		if r.err != nil {
+			suite.Errors++
+			tc.Error = &junitMessage{Message: r.err.Error()}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+
+	return suite
+}
+
+func writeJUnit(path string, suites []junitTestSuite) error {
+	report := junitTestSuites{Suites: suites}
+	for _, s := range suites {
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Errors += s.Errors
+	}
+
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append([]byte(xml.Header), append(content, '\n')...), 0644)
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path"
@@ -24,6 +26,9 @@ var (
 	dataPath     = flag.String("data", "", "path initial data state JSON file (optional)")
 	logPath      = flag.String("log", "", "path to output log file")
 	logLevelName = flag.String("logLevel", "Info", "None|Info|Results|Metadata")
+	testMode     = flag.Bool("test", false, "run the test suite JSON files given as arguments")
+	junitPath    = flag.String("junit", "", "path to output JUnit XML report (test mode)")
+	coveragePath = flag.String("coverage", "", "path to output framework.rego rule coverage JSON (test mode)")
 )
 
 func readCommands() []command {
@@ -41,6 +46,37 @@ func readCommands() []command {
 	return commands
 }
 
+// defaultData returns the initial data state which the GCS provides to
+// framework based policies.
+func defaultData() map[string]interface{} {
+	return map[string]interface{}{
+		"defaultMounts":                   []interface{}{},
+		"privilegedMounts":                []interface{}{},
+		"sandboxPrefix":                   guestpath.SandboxMountPrefix,
+		"hugePagesPrefix":                 guestpath.HugePagesMountPrefix,
+		"defaultPrivilegedCapabilities":   securitypolicy.DefaultPrivilegedCapabilities(),
+		"defaultUnprivilegedCapabilities": securitypolicy.DefaultUnprivilegedCapabilities(),
+	}
+}
+
+// newInterpreter creates an interpreter for policyCode with the framework
+// and API modules.
+func newInterpreter(policyCode string, data map[string]interface{}) (*rpi.RegoPolicyInterpreter, error) {
+	r, err := rpi.NewRegoPolicyInterpreter(policyCode, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.UpdateOSType("linux"); err != nil {
+		return nil, fmt.Errorf("error updating OS type: %w", err)
+	}
+
+	r.AddModule("framework.rego", &rpi.RegoModule{Namespace: "framework", Code: securitypolicy.FrameworkCode})
+	r.AddModule("api.rego", &rpi.RegoModule{Namespace: "api", Code: securitypolicy.APICode})
+
+	return r, nil
+}
+
 func createInterpreter() *rpi.RegoPolicyInterpreter {
 	content, err := os.ReadFile(*policyPath)
 	if err != nil {
@@ -79,28 +115,14 @@ func createInterpreter() *rpi.RegoPolicyInterpreter {
 			log.Fatalf("error loading initial data state: %v", err)
 		}
 	} else {
-		data = map[string]interface{}{
-			"defaultMounts":                   []interface{}{},
-			"privilegedMounts":                []interface{}{},
-			"sandboxPrefix":                   guestpath.SandboxMountPrefix,
-			"hugePagesPrefix":                 guestpath.HugePagesMountPrefix,
-			"defaultPrivilegedCapabilities":   securitypolicy.DefaultPrivilegedCapabilities(),
-			"defaultUnprivilegedCapabilities": securitypolicy.DefaultUnprivilegedCapabilities(),
-		}
+		data = defaultData()
 	}
 
-	r, err := rpi.NewRegoPolicyInterpreter(policyCode, data)
-
+	r, err := newInterpreter(policyCode, data)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = r.UpdateOSType("linux")
-
-	if err != nil {
-		log.Fatalf("error updating OS type: %v", err)
-	}
-
 	if len(*logPath) > 0 {
 		if _, err := os.Stat(*logPath); err == nil {
 			os.Remove(*logPath)
@@ -117,29 +139,25 @@ func createInterpreter() *rpi.RegoPolicyInterpreter {
 		}
 	}
 
-	r.AddModule("framework.rego", &rpi.RegoModule{Namespace: "framework", Code: securitypolicy.FrameworkCode})
-	r.AddModule("api.rego", &rpi.RegoModule{Namespace: "api", Code: securitypolicy.APICode})
-
 	return r
 }
 
-func parseNamespace(rego string) string {
+func parseNamespace(rego string) (string, error) {
 	lines := strings.Split(rego, "\n")
 	parts := strings.Split(lines[0], " ")
 	if parts[0] != "package" || len(parts) < 2 {
-		log.Fatal("package definition required on first line of Rego module")
+		return "", errors.New("package definition required on first line of Rego module")
 	}
 
 	namespace := parts[1]
-	return namespace
+	return namespace, nil
 }
 
-func loadLocalFragment(commandsDir string, input map[string]interface{}) *rpi.RegoModule {
+func loadLocalFragment(commandsDir string, input map[string]interface{}) (*rpi.RegoModule, error) {
 	var localPath string
 	var ok bool
 	if localPath, ok = input["local_path"].(string); !ok {
-		log.Println(input)
-		log.Fatal("'load_fragment' requires a 'local_path' member in 'input' which points to a local Rego file with the fragment logic")
+		return nil, fmt.Errorf("'load_fragment' requires a 'local_path' member in 'input' which points to a local Rego file with the fragment logic: %v", input)
 	}
 
 	content, err := os.ReadFile(localPath)
@@ -147,21 +165,98 @@ func loadLocalFragment(commandsDir string, input map[string]interface{}) *rpi.Re
 		localPath = path.Join(commandsDir, localPath)
 		content, err = os.ReadFile(localPath)
 		if err != nil {
-			log.Fatalf("unable to load fragment: %v", err)
+			return nil, fmt.Errorf("unable to load fragment: %w", err)
 		}
 	}
 
 	code := string(content)
+	namespace, err := parseNamespace(code)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, _ := input["feed"].(string)
+	issuer, _ := input["issuer"].(string)
 	return &rpi.RegoModule{
-		Namespace: parseNamespace(code),
-		Feed:      input["feed"].(string),
-		Issuer:    input["issuer"].(string),
+		Namespace: namespace,
+		Feed:      feed,
+		Issuer:    issuer,
 		Code:      code,
+	}, nil
+}
+
+type commandResult struct {
+	allowed bool
+	result  rpi.RegoQueryResult
+	// reason contains the errors reported by the policy for denied commands
+	reason interface{}
+}
+
+// executeCommand queries the policy for the command. Fragments are loaded
+// from commandsDir for `load_fragment` commands and kept if the policy
+// requests it.
+func executeCommand(rego *rpi.RegoPolicyInterpreter, commandsDir string, command command) (*commandResult, error) {
+	var fragment *rpi.RegoModule
+	if command.Name == "load_fragment" {
+		var err error
+		fragment, err = loadLocalFragment(commandsDir, command.Input)
+		if err != nil {
+			return nil, err
+		}
+		rego.AddModule(fragment.ID(), fragment)
 	}
+
+	result, err := rego.Query("data.policy."+command.Name, command.Input)
+	if err != nil {
+		inputJSON, _ := json.Marshal(command.Input)
+		return nil, fmt.Errorf("query of %s with input %s failed with error %w",
+			command.Name,
+			inputJSON,
+			err)
+	}
+
+	addModule, _ := result.Bool("add_module")
+
+	removeModule := true
+	if fragment != nil && addModule {
+		removeModule = false
+	}
+
+	allowed, err := result.Bool("allowed")
+	if err != nil {
+		return nil, fmt.Errorf("policy result missing required `allowed` key: %w", err)
+	}
+
+	cr := &commandResult{allowed: allowed, result: result}
+	if !allowed {
+		input := map[string]interface{}{}
+		for k, v := range command.Input {
+			input[k] = v
+		}
+		input["rule"] = command.Name
+		reason, err := rego.Query("data.policy.reason", input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get reason for failure: %w", err)
+		}
+
+		if !reason.IsEmpty() {
+			cr.reason, _ = reason.Value("errors")
+		}
+	}
+
+	if removeModule && fragment != nil {
+		rego.RemoveModule(fragment.ID())
+	}
+
+	return cr, nil
 }
 
 func main() {
 	flag.Parse()
+	if *testMode {
+		os.Exit(runTests(flag.Args()))
+	}
+
 	if flag.NArg() != 0 || len(*policyPath) == 0 || len(*commandsPath) == 0 {
 		flag.Usage()
 		os.Exit(1)
@@ -171,51 +266,18 @@ func main() {
 	rego := createInterpreter()
 
 	for i, command := range commands {
-		var fragment *rpi.RegoModule
-		if command.Name == "load_fragment" {
-			fragment = loadLocalFragment(path.Dir(*commandsPath), command.Input)
-			rego.AddModule(fragment.ID(), fragment)
-		}
-
-		result, err := rego.Query("data.policy."+command.Name, command.Input)
-		if err != nil {
-			inputJSON, _ := json.Marshal(command.Input)
-			log.Fatalf("query of %s with input %s failed with error %v",
-				command.Name,
-				inputJSON,
-				err)
-		}
-
-		addModule, _ := result.Bool("add_module")
-
-		removeModule := true
-		if fragment != nil && addModule {
-			removeModule = false
-		}
-
-		allowed, err := result.Bool("allowed")
+		result, err := executeCommand(rego, path.Dir(*commandsPath), command)
 		if err != nil {
-			log.Fatalf("policy result missing required `allowed` key: %v", err)
+			log.Fatal(err)
 		}
 
-		if allowed {
+		if result.allowed {
 			log.Printf("%02d> %s ok\n", i, command.Name)
 		} else {
 			log.Printf("%02d> %s not allowed", i, command.Name)
-			command.Input["rule"] = command.Name
-			result, err = rego.Query("data.policy.reason", command.Input)
-			if err != nil {
-				log.Fatalf("unable to get reason for failure: %v", err)
+			if result.reason != nil {
+				log.Printf("Reason: %v", result.reason)
 			}
-
-			if !result.IsEmpty() {
-				errors, _ := result.Value("errors")
-				log.Printf("Reason: %v", errors)
-			}
-		}
-
-		if removeModule && fragment != nil {
-			rego.RemoveModule(fragment.ID())
 		}
 	}
 }
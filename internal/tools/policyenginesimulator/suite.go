@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/cover"
+)
+
+const (
+	expectAllowed = "allowed"
+	expectDenied  = "denied"
+)
+
+// testSuite is a set of policy tests which share a policy and setup. Each test
+// starts from a fresh interpreter state, with the setup applied.
+type testSuite struct {
+	Name string `json:"name"`
+	// Policy is the path to the policy Rego file, relative to the suite file.
+	// The -policy argument is used if it is empty.
+	Policy string `json:"policy"`
+	// Data is the initial data state. The -data argument, or the defaults
+	// provided by the GCS, are used if it is empty.
+	Data map[string]interface{} `json:"data"`
+	// Fragments are loaded before each test. Each is the input of a
+	// `load_fragment` command, which the policy must allow.
+	Fragments []map[string]interface{} `json:"fragments"`
+	Tests     []testCase               `json:"tests"`
+}
+
+type testCase struct {
+	Name     string        `json:"name"`
+	Commands []testCommand `json:"commands"`
+}
+
+// testCommand is a command with the expected outcome. Expectations which are
+// not set are not checked.
+type testCommand struct {
+	command
+	// Expect is either "allowed" or "denied".
+	Expect string `json:"expect"`
+	// ExpectEnvList is the list of environment variables the policy keeps,
+	// in any order.
+	ExpectEnvList []string `json:"expect_env_list"`
+	// ExpectCapsList contains the capabilities the policy keeps per set,
+	// e.g. "bounding", in any order.
+	ExpectCapsList map[string][]string `json:"expect_caps_list"`
+	// ExpectErrors are substrings which must each be contained in the errors
+	// the policy reports for a denied command.
+	ExpectErrors []string `json:"expect_errors"`
+}
+
+type testResult struct {
+	suite    string
+	name     string
+	duration time.Duration
+	// failures are unmet expectations
+	failures []string
+	// err is set when the test could not be run to completion
+	err error
+}
+
+func (r *testResult) passed() bool {
+	return r.err == nil && len(r.failures) == 0
+}
+
+func readSuite(suitePath string) (*testSuite, error) {
+	content, err := os.ReadFile(suitePath)
+	if err != nil {
+		return nil, err
+	}
+
+	suite := &testSuite{}
+	if err := json.Unmarshal(content, suite); err != nil {
+		return nil, fmt.Errorf("error loading test suite %s: %w", suitePath, err)
+	}
+
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(suitePath), filepath.Ext(suitePath))
+	}
+
+	for _, tc := range suite.Tests {
+		for i, c := range tc.Commands {
+			if c.Expect != "" && c.Expect != expectAllowed && c.Expect != expectDenied {
+				return nil, fmt.Errorf("%s/%s: command %d: expect must be %q or %q, got %q",
+					suite.Name, tc.Name, i, expectAllowed, expectDenied, c.Expect)
+			}
+		}
+	}
+
+	return suite, nil
+}
+
+// runSuite runs all tests of the suite read from suitePath. Coverage of the
+// queries is recorded in coverage.
+func runSuite(suitePath string, coverage *cover.Cover) (string, []*testResult, error) {
+	suite, err := readSuite(suitePath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	suiteDir := filepath.Dir(suitePath)
+	policyFile := *policyPath
+	if suite.Policy != "" {
+		policyFile = suite.Policy
+		if !filepath.IsAbs(policyFile) {
+			policyFile = filepath.Join(suiteDir, policyFile)
+		}
+	}
+	if policyFile == "" {
+		return "", nil, fmt.Errorf("test suite %s: no policy specified", suite.Name)
+	}
+
+	content, err := os.ReadFile(policyFile)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data := suite.Data
+	if data == nil {
+		if len(*dataPath) > 0 {
+			contents, err := os.ReadFile(*dataPath)
+			if err != nil {
+				return "", nil, err
+			}
+			if err := json.Unmarshal(contents, &data); err != nil {
+				return "", nil, fmt.Errorf("error loading initial data state: %w", err)
+			}
+		} else {
+			data = defaultData()
+		}
+	}
+
+	results := make([]*testResult, 0, len(suite.Tests))
+	for _, tc := range suite.Tests {
+		start := time.Now()
+		result := &testResult{suite: suite.Name, name: tc.Name}
+		result.failures, result.err = runTest(string(content), data, suiteDir, suite.Fragments, tc, coverage)
+		result.duration = time.Since(start)
+		results = append(results, result)
+	}
+
+	return suite.Name, results, nil
+}
+
+func runTest(
+	policyCode string,
+	data map[string]interface{},
+	suiteDir string,
+	fragments []map[string]interface{},
+	tc testCase,
+	coverage *cover.Cover,
+) ([]string, error) {
+	rego, err := newInterpreter(policyCode, data)
+	if err != nil {
+		return nil, err
+	}
+	if coverage != nil {
+		rego.AddQueryTracer(coverage)
+	}
+
+	for _, input := range fragments {
+		result, err := executeCommand(rego, suiteDir, command{Name: "load_fragment", Input: input})
+		if err != nil {
+			return nil, fmt.Errorf("setup: %w", err)
+		}
+		if !result.allowed {
+			return nil, fmt.Errorf("setup: load_fragment of %v not allowed: %v", input["local_path"], result.reason)
+		}
+	}
+
+	var failures []string
+	for i, c := range tc.Commands {
+		result, err := executeCommand(rego, suiteDir, c.command)
+		if err != nil {
+			return failures, fmt.Errorf("%02d> %s: %w", i, c.Name, err)
+		}
+
+		for _, failure := range checkExpectations(c, result) {
+			failures = append(failures, fmt.Sprintf("%02d> %s: %s", i, c.Name, failure))
+		}
+	}
+
+	return failures, nil
+}
+
+func checkExpectations(c testCommand, result *commandResult) []string {
+	var failures []string
+
+	switch {
+	case c.Expect == expectAllowed && !result.allowed:
+		failures = append(failures, fmt.Sprintf("expected allowed, got denied: %v", result.reason))
+	case c.Expect == expectDenied && result.allowed:
+		failures = append(failures, "expected denied, got allowed")
+	}
+
+	if c.ExpectEnvList != nil {
+		value, _ := result.result.Value("env_list")
+		if diff := compareStringSets(c.ExpectEnvList, value); diff != "" {
+			failures = append(failures, "env_list mismatch: "+diff)
+		}
+	}
+
+	if c.ExpectCapsList != nil {
+		value, _ := result.result.Value("caps_list")
+		caps, _ := value.(map[string]interface{})
+		keys := make([]string, 0, len(c.ExpectCapsList))
+		for k := range c.ExpectCapsList {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if diff := compareStringSets(c.ExpectCapsList[k], caps[k]); diff != "" {
+				failures = append(failures, fmt.Sprintf("caps_list %s mismatch: %s", k, diff))
+			}
+		}
+	}
+
+	if len(c.ExpectErrors) > 0 {
+		reason, _ := json.Marshal(result.reason)
+		for _, e := range c.ExpectErrors {
+			if !strings.Contains(string(reason), e) {
+				failures = append(failures, fmt.Sprintf("expected error containing %q, got %s", e, reason))
+			}
+		}
+	}
+
+	return failures
+}
+
+// compareStringSets compares the expected strings with a list returned by the
+// policy, ignoring order, and describes the differences.
+func compareStringSets(expected []string, actual interface{}) string {
+	list, ok := actual.([]interface{})
+	if !ok && actual != nil {
+		return fmt.Sprintf("expected a list, got %v", actual)
+	}
+
+	remaining := map[string]int{}
+	for _, e := range expected {
+		remaining[e]++
+	}
+
+	var unexpected []string
+	for _, v := range list {
+		s := fmt.Sprint(v)
+		if remaining[s] > 0 {
+			remaining[s]--
+			continue
+		}
+		unexpected = append(unexpected, s)
+	}
+
+	var missing []string
+	for _, e := range expected {
+		if remaining[e] > 0 {
+			remaining[e]--
+			missing = append(missing, e)
+		}
+	}
+
+	var diff []string
+	if len(missing) > 0 {
+		diff = append(diff, fmt.Sprintf("missing %q", missing))
+	}
+	if len(unexpected) > 0 {
+		diff = append(diff, fmt.Sprintf("unexpected %q", unexpected))
+	}
+	return strings.Join(diff, ", ")
+}
+
+// runTests runs the test suites and returns the exit code, which is non-zero
+// if any test failed.
+func runTests(suitePaths []string) int {
+	if len(suitePaths) == 0 {
+		fmt.Fprintln(os.Stderr, "-test requires at least one test suite file")
+		return 1
+	}
+
+	coverage := cover.New()
+	exitCode := 0
+
+	var suites []junitTestSuite
+	for _, suitePath := range suitePaths {
+		name, results, err := runSuite(suitePath, coverage)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", suitePath, err)
+			return 1
+		}
+
+		for _, r := range results {
+			status := "PASS"
+			if !r.passed() {
+				status = "FAIL"
+				exitCode = 1
+			}
+			fmt.Printf("--- %s: %s/%s (%.2fs)\n", status, r.suite, r.name, r.duration.Seconds())
+			for _, f := range r.failures {
+				fmt.Printf("    %s\n", f)
+			}
+			if r.err != nil {
+				fmt.Printf("    error: %v\n", r.err)
+			}
+		}
+		suites = append(suites, newJUnitTestSuite(name, results))
+	}
+
+	report, err := frameworkCoverage(coverage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to compute coverage: %v\n", err)
+		return 1
+	}
+	fmt.Printf("framework.rego rule coverage: %d/%d rules (%.1f%%)\n", report.CoveredRules, report.TotalRules, report.Coverage)
+
+	if exitCode == 0 {
+		fmt.Println("PASS")
+	} else {
+		fmt.Println("FAIL")
+	}
+
+	if err := writeReports(suites, report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return exitCode
+}
+
+func writeReports(suites []junitTestSuite, report *coverageReport) error {
+	if len(*junitPath) > 0 {
+		for i := range suites {
+			suites[i].Properties = append(suites[i].Properties, junitProperty{
+				Name:  "framework_rule_coverage",
+				Value: fmt.Sprintf("%.1f", report.Coverage),
+			})
+		}
+		if err := writeJUnit(*junitPath, suites); err != nil {
+			return fmt.Errorf("failed to write JUnit report: %w", err)
+		}
+	}
+
+	if len(*coveragePath) > 0 {
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*coveragePath, content, 0644); err != nil {
+			return fmt.Errorf("failed to write coverage report: %w", err)
+		}
+	}
+
+	return nil
+}
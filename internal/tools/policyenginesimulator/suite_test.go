@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/cover"
+
+	rpi "github.com/Microsoft/hcsshim/internal/regopolicyinterpreter"
+)
+
+func Test_RunSuite_Sample(t *testing.T) {
+	coverage := cover.New()
+	name, results, err := runSuite(filepath.Join("samples", "simple_framework", "suite.json"), coverage)
+	if err != nil {
+		t.Fatalf("failed to run suite: %s", err)
+	}
+	if name != "simple_framework" {
+		t.Fatalf("unexpected suite name: %q", name)
+	}
+
+	for _, r := range results {
+		if !r.passed() {
+			t.Errorf("%s failed: %v %v", r.name, r.failures, r.err)
+		}
+	}
+
+	report, err := frameworkCoverage(coverage)
+	if err != nil {
+		t.Fatalf("failed to compute coverage: %s", err)
+	}
+	if report.CoveredRules == 0 || report.CoveredRules >= report.TotalRules {
+		t.Fatalf("unexpected coverage: %d/%d", report.CoveredRules, report.TotalRules)
+	}
+
+	junitFile := filepath.Join(t.TempDir(), "junit.xml")
+	if err := writeJUnit(junitFile, []junitTestSuite{newJUnitTestSuite(name, results)}); err != nil {
+		t.Fatalf("failed to write JUnit report: %s", err)
+	}
+	content, err := os.ReadFile(junitFile)
+	if err != nil {
+		t.Fatalf("failed to read JUnit report: %s", err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(content, &suites); err != nil {
+		t.Fatalf("failed to parse JUnit report: %s", err)
+	}
+	if suites.Tests != len(results) || suites.Failures != 0 {
+		t.Fatalf("unexpected JUnit totals: %+v", suites)
+	}
+}
+
+func Test_CheckExpectations(t *testing.T) {
+	result := &commandResult{
+		allowed: false,
+		result: rpi.RegoQueryResult{
+			"env_list":  []interface{}{"A=1", "B=2"},
+			"caps_list": map[string]interface{}{"bounding": []interface{}{"CAP_CHOWN"}},
+		},
+		reason: []interface{}{"invalid command"},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		command  testCommand
+		failures []string
+	}{
+		{
+			name:    "Met",
+			command: testCommand{Expect: expectDenied, ExpectErrors: []string{"invalid command"}},
+		},
+		{
+			name:     "Allowed",
+			command:  testCommand{Expect: expectAllowed},
+			failures: []string{"expected allowed"},
+		},
+		{
+			name:     "EnvList",
+			command:  testCommand{ExpectEnvList: []string{"B=2", "C=3"}},
+			failures: []string{`missing ["C=3"], unexpected ["A=1"]`},
+		},
+		{
+			name:     "CapsList",
+			command:  testCommand{ExpectCapsList: map[string][]string{"bounding": {"CAP_CHOWN"}, "effective": {"CAP_CHOWN"}}},
+			failures: []string{"caps_list effective mismatch"},
+		},
+		{
+			name:     "Errors",
+			command:  testCommand{ExpectErrors: []string{"invalid mount"}},
+			failures: []string{`expected error containing "invalid mount"`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			failures := checkExpectations(tc.command, result)
+			if len(failures) != len(tc.failures) {
+				t.Fatalf("expected failures %v, got %v", tc.failures, failures)
+			}
+			for i, f := range failures {
+				if !strings.Contains(f, tc.failures[i]) {
+					t.Fatalf("expected failure containing %q, got %q", tc.failures[i], f)
+				}
+			}
+		})
+	}
+}
+
+func Test_ReadSuite_InvalidExpect(t *testing.T) {
+	suiteFile := filepath.Join(t.TempDir(), "suite.json")
+	content := `{"tests": [{"name": "t", "commands": [{"name": "mount_device", "input": {}, "expect": "ok"}]}]}`
+	if err := os.WriteFile(suiteFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write suite: %s", err)
+	}
+
+	if _, err := readSuite(suiteFile); err == nil {
+		t.Fatal("expected invalid expect value to fail")
+	}
+}
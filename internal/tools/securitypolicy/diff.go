@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy/policydiff"
+)
+
+const diffCommand = "diff"
+
+// runDiff implements `securitypolicy diff [options] old new` and returns the
+// exit code: 0 if the policies are equivalent or widening is allowed, 1 on
+// errors and 2 on widening changes when -fail-on-widening is set.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet(diffCommand, flag.ExitOnError)
+	outputJSON := fs.Bool("json", false, "print the report as JSON")
+	failOnWidening := fs.Bool("fail-on-widening", false, "exit with code 2 if the new policy allows anything the old policy did not")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [options] <old policy> <new policy>\n", os.Args[0], diffCommand)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 1
+	}
+
+	report, err := func() (*policydiff.Report, error) {
+		oldPolicy, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			return nil, err
+		}
+		newPolicy, err := os.ReadFile(fs.Arg(1))
+		if err != nil {
+			return nil, err
+		}
+		return policydiff.DiffPolicies(oldPolicy, newPolicy)
+	}()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		fmt.Print(report.String())
+	}
+
+	if *failOnWidening && report.Widening() {
+		return 2
+	}
+	return 0
+}
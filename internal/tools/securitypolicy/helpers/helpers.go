@@ -161,93 +161,144 @@ func ParseUserFromImage(img v1.Image) (sp.IDNameConfig, sp.IDNameConfig, error)
 // PolicyContainersFromConfigs returns a slice of sp.Container generated
 // from a slice of sp.ContainerConfig's
 func PolicyContainersFromConfigs(containerConfigs []sp.ContainerConfig) ([]*sp.Container, error) {
+	return PolicyContainersFromConfigsInLayout(containerConfigs, "")
+}
+
+// PolicyContainersFromConfigsInLayout is like PolicyContainersFromConfigs, but
+// when layoutPath is not empty, images are resolved from the OCI image layout
+// at layoutPath instead of being pulled from a remote registry.
+func PolicyContainersFromConfigsInLayout(containerConfigs []sp.ContainerConfig, layoutPath string) ([]*sp.Container, error) {
 	var policyContainers []*sp.Container
 	for _, containerConfig := range containerConfigs {
-		var imageOptions []remote.Option
-
-		if containerConfig.Auth.Username != "" && containerConfig.Auth.Password != "" {
-			auth := authn.Basic{
-				Username: containerConfig.Auth.Username,
-				Password: containerConfig.Auth.Password}
-			c, _ := auth.Authorization()
-			authOption := remote.WithAuth(authn.FromConfig(*c))
-			imageOptions = append(imageOptions, authOption)
-		}
-
-		img, err := RemoteImageFromImageName(containerConfig.ImageName, imageOptions...)
+		img, err := ImageFromConfig(containerConfig, layoutPath)
 		if err != nil {
-			return nil, fmt.Errorf("unable to fetch image: %w", err)
+			return nil, err
 		}
 
-		layerHashes, err := ComputeLayerHashes(img)
+		container, err := PolicyContainerFromImage(containerConfig, img)
 		if err != nil {
 			return nil, err
 		}
+		policyContainers = append(policyContainers, container)
+	}
 
-		commandArgs := containerConfig.Command
-		if len(commandArgs) == 0 {
-			commandArgs, err = ParseCommandFromImage(img)
-			if err != nil {
-				return nil, err
-			}
+	return policyContainers, nil
+}
+
+// ImageFromConfig returns the v1.Image referenced by containerConfig. Image
+// names with a local transport (see IsLocalImageName) are read from the file
+// system. Otherwise, when layoutPath is not empty, the image is looked up in
+// the OCI image layout, or fetched from a remote registry using the config's
+// auth.
+func ImageFromConfig(containerConfig sp.ContainerConfig, layoutPath string) (v1.Image, error) {
+	if IsLocalImageName(containerConfig.ImageName) {
+		img, err := LocalImageFromImageName(containerConfig.ImageName)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read local image: %w", err)
 		}
-		// add rules for all known environment variables from the configuration
-		// these are in addition to "other rules" from the policy definition file
-		envVars, err := ParseEnvFromImage(img)
+		return img, nil
+	}
+
+	if layoutPath != "" {
+		img, err := LayoutImageFromImageName(layoutPath, containerConfig.ImageName)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("unable to find image in layout: %w", err)
 		}
+		return img, nil
+	}
 
-		// we want all environment variables which we've extracted from the
-		// image to be required
-		envRules := sp.NewEnvVarRules(envVars, true)
+	var imageOptions []remote.Option
 
-		// cri adds TERM=xterm for all workload containers. we add to all containers
-		// to prevent any possible error
-		envRules = append(envRules, sp.EnvRuleConfig{
-			Rule:     "TERM=xterm",
-			Strategy: sp.EnvVarRuleString,
-			Required: false,
-		})
+	if containerConfig.Auth.Username != "" && containerConfig.Auth.Password != "" {
+		auth := authn.Basic{
+			Username: containerConfig.Auth.Username,
+			Password: containerConfig.Auth.Password}
+		c, _ := auth.Authorization()
+		authOption := remote.WithAuth(authn.FromConfig(*c))
+		imageOptions = append(imageOptions, authOption)
+	}
 
-		envRules = append(envRules, containerConfig.EnvRules...)
+	img, err := RemoteImageFromImageName(containerConfig.ImageName, imageOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch image: %w", err)
+	}
+	return img, nil
+}
 
-		workingDir, err := ParseWorkingDirFromImage(img)
+// PolicyContainerFromImage generates sp.Container from containerConfig, using
+// img to compute layer hashes and to fill in the defaults, which weren't
+// explicitly set in the config.
+func PolicyContainerFromImage(containerConfig sp.ContainerConfig, img v1.Image) (*sp.Container, error) {
+	layerHashes, err := ComputeLayerHashes(img)
+	if err != nil {
+		return nil, err
+	}
+
+	commandArgs := containerConfig.Command
+	if len(commandArgs) == 0 {
+		commandArgs, err = ParseCommandFromImage(img)
 		if err != nil {
 			return nil, err
 		}
+	}
+	// add rules for all known environment variables from the configuration
+	// these are in addition to "other rules" from the policy definition file
+	envVars, err := ParseEnvFromImage(img)
+	if err != nil {
+		return nil, err
+	}
 
-		if containerConfig.WorkingDir != "" {
-			workingDir = containerConfig.WorkingDir
-		}
+	// we want all environment variables which we've extracted from the
+	// image to be required
+	envRules := sp.NewEnvVarRules(envVars, true)
 
-		user, group, err := ParseUserFromImage(img)
-		if err != nil {
-			return nil, err
-		}
+	// cri adds TERM=xterm for all workload containers. we add to all containers
+	// to prevent any possible error
+	envRules = append(envRules, sp.EnvRuleConfig{
+		Rule:     "TERM=xterm",
+		Strategy: sp.EnvVarRuleString,
+		Required: false,
+	})
 
-		container, err := sp.CreateContainerPolicy(
-			commandArgs,
-			layerHashes,
-			envRules,
-			workingDir,
-			containerConfig.Mounts,
-			containerConfig.AllowElevated,
-			containerConfig.ExecProcesses,
-			containerConfig.Signals,
-			containerConfig.AllowStdioAccess,
-			!containerConfig.AllowPrivilegeEscalation,
-			setDefaultUser(containerConfig.User, user, group),
-			setDefaultCapabilities(containerConfig.Capabilities),
-			setDefaultSeccomp(containerConfig.SeccompProfilePath),
-		)
-		if err != nil {
-			return nil, err
-		}
-		policyContainers = append(policyContainers, container)
+	envRules = append(envRules, containerConfig.EnvRules...)
+
+	workingDir, err := ParseWorkingDirFromImage(img)
+	if err != nil {
+		return nil, err
 	}
 
-	return policyContainers, nil
+	if containerConfig.WorkingDir != "" {
+		workingDir = containerConfig.WorkingDir
+	}
+
+	user, group, err := ParseUserFromImage(img)
+	if err != nil {
+		return nil, err
+	}
+
+	container, err := sp.CreateContainerPolicy(
+		commandArgs,
+		layerHashes,
+		envRules,
+		workingDir,
+		containerConfig.Mounts,
+		containerConfig.AllowElevated,
+		containerConfig.ExecProcesses,
+		containerConfig.Signals,
+		containerConfig.AllowStdioAccess,
+		!containerConfig.AllowPrivilegeEscalation,
+		setDefaultUser(containerConfig.User, user, group),
+		setDefaultCapabilities(containerConfig.Capabilities),
+		setDefaultSeccomp(containerConfig.SeccompProfilePath),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := container.SetIsolationConstraints(&containerConfig); err != nil {
+		return nil, err
+	}
+	return container, nil
 }
 
 func setDefaultUser(config *sp.UserConfig, user, group sp.IDNameConfig) sp.UserConfig {
@@ -0,0 +1,259 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Transports for images, which are read from the local file system instead of
+// a registry. The format follows the skopeo/podman transports:
+//
+//	oci-layout:<path>[@<digest>|:<ref name>]
+//	docker-archive:<path>[:<image reference>]
+//	content-store:<path>@<digest>
+const (
+	// OCILayoutTransport references an image in an OCI image layout directory.
+	// Without a digest or a ref name, the layout must contain a single image.
+	OCILayoutTransport = "oci-layout:"
+	// DockerArchiveTransport references an image in a `docker save` tarball.
+	// Without an image reference, the archive must contain a single image.
+	DockerArchiveTransport = "docker-archive:"
+	// ContentStoreTransport references an image by digest in a local content
+	// store, e.g. containerd's io.containerd.content.v1.content directory,
+	// which has the same blobs/<algorithm>/<encoded> structure as an OCI
+	// layout, but no index.json.
+	ContentStoreTransport = "content-store:"
+)
+
+// IsLocalImageName returns true when imageName uses one of the local image
+// transports.
+func IsLocalImageName(imageName string) bool {
+	for _, t := range []string{OCILayoutTransport, DockerArchiveTransport, ContentStoreTransport} {
+		if strings.HasPrefix(imageName, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalImageFromImageName returns the v1.Image referenced by imageName, which
+// must use one of the local image transports.
+func LocalImageFromImageName(imageName string) (v1.Image, error) {
+	switch {
+	case strings.HasPrefix(imageName, OCILayoutTransport):
+		return ociLayoutImage(strings.TrimPrefix(imageName, OCILayoutTransport))
+	case strings.HasPrefix(imageName, DockerArchiveTransport):
+		return dockerArchiveImage(strings.TrimPrefix(imageName, DockerArchiveTransport))
+	case strings.HasPrefix(imageName, ContentStoreTransport):
+		return contentStoreImage(strings.TrimPrefix(imageName, ContentStoreTransport))
+	default:
+		return nil, fmt.Errorf("unknown image transport: %q", imageName)
+	}
+}
+
+// splitDigest splits "<path>@<digest>" into the path and the digest.
+func splitDigest(reference string) (string, *v1.Hash, error) {
+	i := strings.LastIndex(reference, "@")
+	if i < 0 {
+		return reference, nil, nil
+	}
+
+	h, err := v1.NewHash(reference[i+1:])
+	if err != nil {
+		return "", nil, err
+	}
+	return reference[:i], &h, nil
+}
+
+// splitRef splits "<path>:<ref>" into the path and the reference. Similarly
+// to skopeo, paths containing ":" are not supported.
+func splitRef(reference string) (string, string) {
+	path, ref, _ := strings.Cut(reference, ":")
+	return path, ref
+}
+
+func ociLayoutImage(reference string) (v1.Image, error) {
+	path, digest, err := splitDigest(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if digest == nil {
+		var ref string
+		path, ref = splitRef(path)
+		if ref != "" {
+			return LayoutImageFromImageName(path, ref)
+		}
+	}
+
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	if digest == nil {
+		if len(indexManifest.Manifests) != 1 {
+			return nil, fmt.Errorf("OCI layout %q contains %d manifests, a digest or ref name is required", path, len(indexManifest.Manifests))
+		}
+		return imageFromDescriptor(index, indexManifest.Manifests[0])
+	}
+
+	for _, desc := range indexManifest.Manifests {
+		if desc.Digest == *digest {
+			return imageFromDescriptor(index, desc)
+		}
+	}
+
+	// the digest may reference a platform specific image of a multi-platform
+	// image, which isn't listed in the top level index.
+	return blobStoreImage(p, *digest)
+}
+
+func dockerArchiveImage(reference string) (v1.Image, error) {
+	path, ref := splitRef(reference)
+	if ref == "" {
+		return tarball.ImageFromPath(path, nil)
+	}
+
+	tag, err := name.NewTag(ref)
+	if err != nil {
+		return nil, err
+	}
+	return tarball.ImageFromPath(path, &tag)
+}
+
+func contentStoreImage(reference string) (v1.Image, error) {
+	path, digest, err := splitDigest(reference)
+	if err != nil {
+		return nil, err
+	}
+	if digest == nil {
+		return nil, fmt.Errorf("content store image reference %q requires a digest", reference)
+	}
+
+	// layout.Path only requires index.json for index lookups, blobs can be
+	// read directly.
+	return blobStoreImage(layout.Path(path), *digest)
+}
+
+// blobStoreImage reads the image manifest or index with the given digest from
+// the blobs in p. Indexes are resolved to the image for defaultPlatform.
+func blobStoreImage(p layout.Path, digest v1.Hash) (v1.Image, error) {
+	raw, err := p.Bytes(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		MediaType types.MediaType `json:"mediaType"`
+		Config    *v1.Descriptor  `json:"config"`
+	}
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", digest, err)
+	}
+
+	if manifest.MediaType.IsIndex() || (manifest.MediaType == "" && manifest.Config == nil) {
+		index, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range index.Manifests {
+			if m.Platform != nil && m.Platform.OS == defaultPlatform.OS && m.Platform.Architecture == defaultPlatform.Architecture {
+				return blobStoreImage(p, m.Digest)
+			}
+		}
+		return nil, fmt.Errorf("no %s/%s image in index %s", defaultPlatform.OS, defaultPlatform.Architecture, digest)
+	}
+
+	mediaType := manifest.MediaType
+	if mediaType == "" {
+		mediaType = types.OCIManifestSchema1
+	}
+	return partial.CompressedToImage(&blobImage{
+		path:        p,
+		mediaType:   mediaType,
+		rawManifest: raw,
+	})
+}
+
+// blobImage implements partial.CompressedImageCore for an image stored as
+// blobs in a directory.
+type blobImage struct {
+	path        layout.Path
+	mediaType   types.MediaType
+	rawManifest []byte
+}
+
+var _ partial.CompressedImageCore = (*blobImage)(nil)
+
+func (i *blobImage) MediaType() (types.MediaType, error) {
+	return i.mediaType, nil
+}
+
+func (i *blobImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *blobImage) RawConfigFile() ([]byte, error) {
+	manifest, err := partial.Manifest(i)
+	if err != nil {
+		return nil, err
+	}
+	return i.path.Bytes(manifest.Config.Digest)
+}
+
+func (i *blobImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	manifest, err := partial.Manifest(i)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range append([]v1.Descriptor{manifest.Config}, manifest.Layers...) {
+		if desc.Digest == h {
+			return &blob{path: i.path, desc: desc}, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find layer in image: %s", h)
+}
+
+// blob implements partial.CompressedLayer for a blob in a directory.
+type blob struct {
+	path layout.Path
+	desc v1.Descriptor
+}
+
+func (b *blob) Digest() (v1.Hash, error) {
+	return b.desc.Digest, nil
+}
+
+func (b *blob) Compressed() (io.ReadCloser, error) {
+	return b.path.Blob(b.desc.Digest)
+}
+
+func (b *blob) Size() (int64, error) {
+	return b.desc.Size, nil
+}
+
+func (b *blob) MediaType() (types.MediaType, error) {
+	return b.desc.MediaType, nil
+}
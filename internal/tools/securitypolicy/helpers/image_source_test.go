@@ -0,0 +1,138 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	sp "github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+func newTestImage(t *testing.T) v1.Image {
+	t.Helper()
+
+	base, err := random.Image(64, 2)
+	if err != nil {
+		t.Fatalf("failed to create image: %s", err)
+	}
+	img, err := mutate.Config(base, v1.Config{
+		User: "1000:2000",
+		Env:  []string{"PATH=/bin"},
+	})
+	if err != nil {
+		t.Fatalf("failed to set image config: %s", err)
+	}
+	return img
+}
+
+func Test_LocalImageFromImageName(t *testing.T) {
+	img := newTestImage(t)
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("failed to get digest: %s", err)
+	}
+
+	layoutDir := t.TempDir()
+	p, err := layout.Write(layoutDir, empty.Index)
+	if err != nil {
+		t.Fatalf("failed to create layout: %s", err)
+	}
+	if err := p.AppendImage(img, layout.WithAnnotations(map[string]string{annotationRefName: "v1"})); err != nil {
+		t.Fatalf("failed to append image: %s", err)
+	}
+
+	// a content store has the same blob structure, but no index
+	storeDir := t.TempDir()
+	if err := os.CopyFS(storeDir, os.DirFS(layoutDir)); err != nil {
+		t.Fatalf("failed to copy blobs: %s", err)
+	}
+	if err := os.Remove(filepath.Join(storeDir, "index.json")); err != nil {
+		t.Fatalf("failed to remove index: %s", err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "image.tar")
+	tag, err := name.NewTag("example.com/app:v1")
+	if err != nil {
+		t.Fatalf("failed to parse tag: %s", err)
+	}
+	if err := tarball.WriteToFile(archive, tag, img); err != nil {
+		t.Fatalf("failed to write archive: %s", err)
+	}
+
+	expectedHashes, err := ComputeLayerHashes(img)
+	if err != nil {
+		t.Fatalf("failed to compute layer hashes: %s", err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		imageName string
+	}{
+		{name: "OCILayoutDigest", imageName: OCILayoutTransport + layoutDir + "@" + digest.String()},
+		{name: "OCILayoutRefName", imageName: OCILayoutTransport + layoutDir + ":v1"},
+		{name: "OCILayoutSingleImage", imageName: OCILayoutTransport + layoutDir},
+		{name: "DockerArchive", imageName: DockerArchiveTransport + archive},
+		{name: "DockerArchiveTag", imageName: DockerArchiveTransport + archive + ":example.com/app:v1"},
+		{name: "ContentStore", imageName: ContentStoreTransport + storeDir + "@" + digest.String()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if !IsLocalImageName(tc.imageName) {
+				t.Fatalf("expected %q to be a local image name", tc.imageName)
+			}
+
+			localImg, err := ImageFromConfig(sp.ContainerConfig{ImageName: tc.imageName}, "")
+			if err != nil {
+				t.Fatalf("failed to read image: %s", err)
+			}
+
+			hashes, err := ComputeLayerHashes(localImg)
+			if err != nil {
+				t.Fatalf("failed to compute layer hashes: %s", err)
+			}
+			if diff := cmp.Diff(expectedHashes, hashes); diff != "" {
+				t.Fatalf("layer hashes mismatch (-want +got):\n%s", diff)
+			}
+
+			env, err := ParseEnvFromImage(localImg)
+			if err != nil {
+				t.Fatalf("failed to parse env: %s", err)
+			}
+			if diff := cmp.Diff([]string{"PATH=/bin"}, env); diff != "" {
+				t.Fatalf("env mismatch (-want +got):\n%s", diff)
+			}
+
+			user, group, err := ParseUserFromImage(localImg)
+			if err != nil {
+				t.Fatalf("failed to parse user: %s", err)
+			}
+			if user.Rule != "1000" || group.Rule != "2000" {
+				t.Fatalf("unexpected user %+v and group %+v", user, group)
+			}
+		})
+	}
+}
+
+func Test_LocalImageFromImageName_Errors(t *testing.T) {
+	for _, imageName := range []string{
+		ContentStoreTransport + t.TempDir(),
+		OCILayoutTransport + t.TempDir() + "@sha256:invalid",
+		DockerArchiveTransport + filepath.Join(t.TempDir(), "missing.tar"),
+	} {
+		if _, err := LocalImageFromImageName(imageName); err == nil {
+			t.Fatalf("expected %q to fail", imageName)
+		}
+	}
+
+	if IsLocalImageName("docker.io/library/alpine:latest") {
+		t.Fatal("expected registry reference to not be local")
+	}
+}
@@ -0,0 +1,535 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	sp "github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+const (
+	// serviceAccountMountPath is where kubelet mounts the service account
+	// token, unless automountServiceAccountToken is disabled.
+	serviceAccountMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// defaultTerminationMessagePath is the default path of the termination
+	// message file, which kubelet always mounts into the container.
+	defaultTerminationMessagePath = "/dev/termination-log"
+	// kubernetesVolumeSource is the mount source used for kubelet managed
+	// volumes, which are shared with the UVM over Plan9.
+	kubernetesVolumeSource = "plan9://"
+)
+
+const (
+	seccompProfileTypeLocalhost      = "Localhost"
+	seccompProfileTypeRuntimeDefault = "RuntimeDefault"
+	seccompProfileTypeUnconfined     = "Unconfined"
+)
+
+var (
+	ErrRuntimeDefaultSeccomp = errors.New("RuntimeDefault seccomp profile cannot be measured, use a Localhost profile instead")
+	ErrEnvFromWithoutPrefix  = errors.New("envFrom without a prefix cannot be expressed as an environment variable rule")
+)
+
+// KubernetesContainer is a container config derived from a Kubernetes workload
+// manifest. Fields, which can only be resolved together with the container
+// image, are kept aside until the image is available.
+type KubernetesContainer struct {
+	sp.ContainerConfig
+	// Args replaces the image CMD, when ContainerConfig.Command is empty.
+	Args []string
+	// RunAsUser, RunAsGroup and SupplementalGroups are the effective values
+	// from the pod and container security contexts.
+	RunAsUser          *int64
+	RunAsGroup         *int64
+	SupplementalGroups []int64
+}
+
+// Minimal subset of the Kubernetes API types needed to generate policy. The
+// full k8s.io/api types are intentionally not used to keep the tool's
+// dependencies small.
+
+type kubernetesObject struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		podSpec  `yaml:",inline"`
+		Template struct {
+			Spec podSpec `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+type podSpec struct {
+	Containers                   []kubernetesContainerSpec `yaml:"containers"`
+	InitContainers               []kubernetesContainerSpec `yaml:"initContainers"`
+	Volumes                      []volume                  `yaml:"volumes"`
+	SecurityContext              *podSecurityContext       `yaml:"securityContext"`
+	AutomountServiceAccountToken *bool                     `yaml:"automountServiceAccountToken"`
+	EnableServiceLinks           *bool                     `yaml:"enableServiceLinks"`
+}
+
+type podSecurityContext struct {
+	RunAsUser          *int64          `yaml:"runAsUser"`
+	RunAsGroup         *int64          `yaml:"runAsGroup"`
+	SupplementalGroups []int64         `yaml:"supplementalGroups"`
+	FSGroup            *int64          `yaml:"fsGroup"`
+	SeccompProfile     *seccompProfile `yaml:"seccompProfile"`
+}
+
+type securityContext struct {
+	Privileged               *bool           `yaml:"privileged"`
+	AllowPrivilegeEscalation *bool           `yaml:"allowPrivilegeEscalation"`
+	RunAsUser                *int64          `yaml:"runAsUser"`
+	RunAsGroup               *int64          `yaml:"runAsGroup"`
+	Capabilities             *capabilities   `yaml:"capabilities"`
+	SeccompProfile           *seccompProfile `yaml:"seccompProfile"`
+}
+
+type capabilities struct {
+	Add  []string `yaml:"add"`
+	Drop []string `yaml:"drop"`
+}
+
+type seccompProfile struct {
+	Type             string `yaml:"type"`
+	LocalhostProfile string `yaml:"localhostProfile"`
+}
+
+type kubernetesContainerSpec struct {
+	Name                   string           `yaml:"name"`
+	Image                  string           `yaml:"image"`
+	Command                []string         `yaml:"command"`
+	Args                   []string         `yaml:"args"`
+	WorkingDir             string           `yaml:"workingDir"`
+	Env                    []envVar         `yaml:"env"`
+	EnvFrom                []envFromSource  `yaml:"envFrom"`
+	VolumeMounts           []volumeMount    `yaml:"volumeMounts"`
+	SecurityContext        *securityContext `yaml:"securityContext"`
+	TerminationMessagePath string           `yaml:"terminationMessagePath"`
+}
+
+type envVar struct {
+	Name      string     `yaml:"name"`
+	Value     string     `yaml:"value"`
+	ValueFrom *yaml.Node `yaml:"valueFrom"`
+}
+
+type envFromSource struct {
+	Prefix string `yaml:"prefix"`
+}
+
+type volumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	ReadOnly  bool   `yaml:"readOnly"`
+}
+
+type volume struct {
+	Name        string     `yaml:"name"`
+	ConfigMap   *yaml.Node `yaml:"configMap"`
+	Secret      *yaml.Node `yaml:"secret"`
+	Projected   *yaml.Node `yaml:"projected"`
+	DownwardAPI *yaml.Node `yaml:"downwardAPI"`
+}
+
+// alwaysReadonly returns true for volume types, which kubelet always mounts
+// read-only regardless of the volume mount settings.
+func (v volume) alwaysReadonly() bool {
+	return v.ConfigMap != nil || v.Secret != nil || v.Projected != nil || v.DownwardAPI != nil
+}
+
+// ParseKubernetesManifest parses a (multi-document) YAML manifest and returns
+// the containers of every Pod, Deployment and Job in it, including init
+// containers. Other objects are ignored. Localhost seccomp profiles are
+// resolved relative to seccompRoot.
+func ParseKubernetesManifest(manifest []byte, seccompRoot string) ([]KubernetesContainer, error) {
+	var containers []KubernetesContainer
+
+	decoder := yaml.NewDecoder(bytes.NewReader(manifest))
+	for {
+		var obj kubernetesObject
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+
+		var spec *podSpec
+		switch obj.Kind {
+		case "Pod":
+			spec = &obj.Spec.podSpec
+		case "Deployment", "Job":
+			spec = &obj.Spec.Template.Spec
+		default:
+			continue
+		}
+
+		podContainers, err := containersFromPodSpec(spec, seccompRoot)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", obj.Kind, err)
+		}
+		containers = append(containers, podContainers...)
+	}
+
+	return containers, nil
+}
+
+func containersFromPodSpec(spec *podSpec, seccompRoot string) ([]KubernetesContainer, error) {
+	volumes := map[string]volume{}
+	for _, v := range spec.Volumes {
+		volumes[v.Name] = v
+	}
+
+	podSC := spec.SecurityContext
+	if podSC == nil {
+		podSC = &podSecurityContext{}
+	}
+
+	var containers []KubernetesContainer
+	all := append(append([]kubernetesContainerSpec{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range all {
+		container, err := containerFromSpec(c, spec, podSC, volumes, seccompRoot)
+		if err != nil {
+			return nil, fmt.Errorf("container %q: %w", c.Name, err)
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+func containerFromSpec(
+	c kubernetesContainerSpec,
+	spec *podSpec,
+	podSC *podSecurityContext,
+	volumes map[string]volume,
+	seccompRoot string,
+) (KubernetesContainer, error) {
+	if c.Image == "" {
+		return KubernetesContainer{}, errors.New("image is not set")
+	}
+
+	sc := c.SecurityContext
+	if sc == nil {
+		sc = &securityContext{}
+	}
+
+	config := sp.ContainerConfig{
+		ImageName:  c.Image,
+		WorkingDir: c.WorkingDir,
+		// kubectl logs relies on the container's standard output
+		AllowStdioAccess: true,
+		// kubernetes allows privilege escalation unless explicitly disabled
+		AllowPrivilegeEscalation: true,
+	}
+
+	var args []string
+	if len(c.Command) > 0 {
+		config.Command = append(append([]string{}, c.Command...), c.Args...)
+	} else {
+		args = c.Args
+	}
+
+	envRules, err := envRulesFromSpec(c, spec)
+	if err != nil {
+		return KubernetesContainer{}, err
+	}
+	config.EnvRules = envRules
+
+	mounts, err := mountsFromSpec(c, spec, volumes)
+	if err != nil {
+		return KubernetesContainer{}, err
+	}
+	config.Mounts = mounts
+
+	if sc.Privileged != nil && *sc.Privileged {
+		config.AllowElevated = true
+	}
+	if sc.AllowPrivilegeEscalation != nil {
+		config.AllowPrivilegeEscalation = *sc.AllowPrivilegeEscalation
+	}
+	if sc.Capabilities != nil && !config.AllowElevated {
+		config.Capabilities = capabilitiesFromSpec(sc.Capabilities)
+	}
+
+	seccomp := podSC.SeccompProfile
+	if sc.SeccompProfile != nil {
+		seccomp = sc.SeccompProfile
+	}
+	if seccomp != nil {
+		switch seccomp.Type {
+		case seccompProfileTypeLocalhost:
+			config.SeccompProfilePath = filepath.Join(seccompRoot, seccomp.LocalhostProfile)
+		case seccompProfileTypeRuntimeDefault:
+			return KubernetesContainer{}, ErrRuntimeDefaultSeccomp
+		case seccompProfileTypeUnconfined, "":
+		default:
+			return KubernetesContainer{}, fmt.Errorf("unknown seccomp profile type %q", seccomp.Type)
+		}
+	}
+
+	container := KubernetesContainer{
+		ContainerConfig: config,
+		Args:            args,
+		RunAsUser:       podSC.RunAsUser,
+		RunAsGroup:      podSC.RunAsGroup,
+	}
+	if sc.RunAsUser != nil {
+		container.RunAsUser = sc.RunAsUser
+	}
+	if sc.RunAsGroup != nil {
+		container.RunAsGroup = sc.RunAsGroup
+	}
+	container.SupplementalGroups = append(container.SupplementalGroups, podSC.SupplementalGroups...)
+	if podSC.FSGroup != nil {
+		container.SupplementalGroups = append(container.SupplementalGroups, *podSC.FSGroup)
+	}
+
+	return container, nil
+}
+
+// envVarReference matches kubernetes dependent environment variable
+// references, e.g. $(OTHER_VAR), which are expanded by kubelet.
+var envVarReference = regexp.MustCompile(`\$\([A-Za-z_][A-Za-z0-9_]*\)`)
+
+func envRulesFromSpec(c kubernetesContainerSpec, spec *podSpec) ([]sp.EnvRuleConfig, error) {
+	var rules []sp.EnvRuleConfig
+	for _, env := range c.Env {
+		switch {
+		case env.ValueFrom != nil:
+			// the value comes from a secret, config map or the downward API,
+			// which are only known at runtime.
+			rules = append(rules, sp.EnvRuleConfig{
+				Strategy: sp.EnvVarRuleRegex,
+				Rule:     regexp.QuoteMeta(env.Name) + "=.*",
+			})
+		case envVarReference.MatchString(env.Value):
+			rules = append(rules, sp.EnvRuleConfig{
+				Strategy: sp.EnvVarRuleRegex,
+				Rule:     regexp.QuoteMeta(env.Name) + "=" + expandableValuePattern(env.Value),
+				Required: true,
+			})
+		default:
+			rules = append(rules, sp.EnvRuleConfig{
+				Strategy: sp.EnvVarRuleString,
+				Rule:     env.Name + "=" + env.Value,
+				Required: true,
+			})
+		}
+	}
+
+	for _, envFrom := range c.EnvFrom {
+		if envFrom.Prefix == "" {
+			return nil, ErrEnvFromWithoutPrefix
+		}
+		rules = append(rules, sp.EnvRuleConfig{
+			Strategy: sp.EnvVarRuleRegex,
+			Rule:     regexp.QuoteMeta(envFrom.Prefix) + "[A-Za-z0-9_.-]*=.*",
+		})
+	}
+
+	// the runtime sets the hostname and kubelet always injects the variables
+	// for the kubernetes service, and, unless disabled, for all other services
+	// in the namespace.
+	servicePrefix := "KUBERNETES"
+	if spec.EnableServiceLinks == nil || *spec.EnableServiceLinks {
+		servicePrefix = "[A-Z0-9_]+"
+	}
+	for _, rule := range []string{
+		"HOSTNAME=.+",
+		servicePrefix + "_SERVICE_HOST=.+",
+		servicePrefix + "_SERVICE_PORT(_[A-Z0-9_]+)?=[0-9]+",
+		servicePrefix + "_PORT=(tcp|udp|sctp)://.+",
+		servicePrefix + "_PORT_[0-9]+_(TCP|UDP|SCTP)(_PROTO|_PORT|_ADDR)?=.+",
+	} {
+		rules = append(rules, sp.EnvRuleConfig{
+			Strategy: sp.EnvVarRuleRegex,
+			Rule:     rule,
+		})
+	}
+	return rules, nil
+}
+
+// expandableValuePattern converts a value with $(VAR) references into a re2
+// pattern, where each reference may expand to anything.
+func expandableValuePattern(value string) string {
+	var pattern strings.Builder
+	last := 0
+	for _, loc := range envVarReference.FindAllStringIndex(value, -1) {
+		pattern.WriteString(regexp.QuoteMeta(value[last:loc[0]]))
+		pattern.WriteString(".*")
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(value[last:]))
+	return pattern.String()
+}
+
+func mountsFromSpec(c kubernetesContainerSpec, spec *podSpec, volumes map[string]volume) ([]sp.MountConfig, error) {
+	var mounts []sp.MountConfig
+	for _, vm := range c.VolumeMounts {
+		v, ok := volumes[vm.Name]
+		if !ok {
+			return nil, fmt.Errorf("volume %q not found", vm.Name)
+		}
+		mounts = append(mounts, sp.MountConfig{
+			HostPath:      kubernetesVolumeSource + vm.Name,
+			ContainerPath: vm.MountPath,
+			Readonly:      vm.ReadOnly || v.alwaysReadonly(),
+		})
+	}
+
+	if spec.AutomountServiceAccountToken == nil || *spec.AutomountServiceAccountToken {
+		mounts = append(mounts, sp.MountConfig{
+			HostPath:      kubernetesVolumeSource + "serviceaccount",
+			ContainerPath: serviceAccountMountPath,
+			Readonly:      true,
+		})
+	}
+
+	terminationMessagePath := c.TerminationMessagePath
+	if terminationMessagePath == "" {
+		terminationMessagePath = defaultTerminationMessagePath
+	}
+	mounts = append(mounts, sp.MountConfig{
+		HostPath:      kubernetesVolumeSource + "termination-log",
+		ContainerPath: terminationMessagePath,
+	})
+	return mounts, nil
+}
+
+// capabilitiesFromSpec applies the added and dropped capabilities on top of
+// the runtime's default unprivileged set.
+func capabilitiesFromSpec(caps *capabilities) *sp.CapabilitiesConfig {
+	enabled := map[string]bool{}
+	for _, c := range sp.DefaultUnprivilegedCapabilities() {
+		enabled[c] = true
+	}
+
+	for _, c := range caps.Drop {
+		if strings.EqualFold(c, "ALL") {
+			enabled = map[string]bool{}
+			continue
+		}
+		delete(enabled, normalizeCapability(c))
+	}
+	for _, c := range caps.Add {
+		if strings.EqualFold(c, "ALL") {
+			for _, pc := range sp.DefaultPrivilegedCapabilities() {
+				enabled[pc] = true
+			}
+			continue
+		}
+		enabled[normalizeCapability(c)] = true
+	}
+
+	// keep a fixed order to produce stable policies
+	var set []string
+	for _, c := range sp.DefaultPrivilegedCapabilities() {
+		if enabled[c] {
+			set = append(set, c)
+			delete(enabled, c)
+		}
+	}
+	for _, c := range caps.Add {
+		if n := normalizeCapability(c); enabled[n] {
+			set = append(set, n)
+			delete(enabled, n)
+		}
+	}
+	if set == nil {
+		set = sp.EmptyCapabiltiesSet()
+	}
+
+	return &sp.CapabilitiesConfig{
+		Bounding:    set,
+		Effective:   set,
+		Inheritable: sp.EmptyCapabiltiesSet(),
+		Permitted:   set,
+		Ambient:     sp.EmptyCapabiltiesSet(),
+	}
+}
+
+func normalizeCapability(c string) string {
+	c = strings.ToUpper(c)
+	if !strings.HasPrefix(c, "CAP_") {
+		c = "CAP_" + c
+	}
+	return c
+}
+
+// PolicyContainersFromKubernetes generates sp.Container for every container.
+// Images are resolved the same way as in PolicyContainersFromConfigsInLayout.
+func PolicyContainersFromKubernetes(containers []KubernetesContainer, layoutPath string) ([]*sp.Container, error) {
+	var policyContainers []*sp.Container
+	for _, c := range containers {
+		img, err := ImageFromConfig(c.ContainerConfig, layoutPath)
+		if err != nil {
+			return nil, err
+		}
+
+		config := c.ContainerConfig
+		if len(config.Command) == 0 && len(c.Args) > 0 {
+			// args without command replace the image CMD, but keep the
+			// ENTRYPOINT
+			imgConfig, err := img.ConfigFile()
+			if err != nil {
+				return nil, err
+			}
+			config.Command = append(append([]string{}, imgConfig.Config.Entrypoint...), c.Args...)
+		}
+
+		if c.RunAsUser != nil || c.RunAsGroup != nil || len(c.SupplementalGroups) > 0 {
+			imgUser, imgGroup, err := ParseUserFromImage(img)
+			if err != nil {
+				return nil, err
+			}
+			user := c.userConfig(imgUser, imgGroup)
+			config.User = &user
+		}
+
+		container, err := PolicyContainerFromImage(config, img)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.ImageName, err)
+		}
+		policyContainers = append(policyContainers, container)
+	}
+	return policyContainers, nil
+}
+
+// userConfig overrides the image user and group with the ones from the
+// security context.
+func (c KubernetesContainer) userConfig(user, group sp.IDNameConfig) sp.UserConfig {
+	if c.RunAsUser != nil {
+		user = idConfig(*c.RunAsUser)
+		// without runAsGroup, the primary group is looked up for the uid
+		group = sp.IDNameConfig{Strategy: sp.IDNameStrategyAny}
+	}
+	if c.RunAsGroup != nil {
+		group = idConfig(*c.RunAsGroup)
+	}
+
+	groups := []sp.IDNameConfig{group}
+	for _, g := range c.SupplementalGroups {
+		groups = append(groups, idConfig(g))
+	}
+
+	return sp.UserConfig{
+		UserIDName:   user,
+		GroupIDNames: groups,
+		Umask:        "0022",
+	}
+}
+
+func idConfig(id int64) sp.IDNameConfig {
+	return sp.IDNameConfig{
+		Strategy: sp.IDNameStrategyID,
+		Rule:     strconv.FormatInt(id, 10),
+	}
+}
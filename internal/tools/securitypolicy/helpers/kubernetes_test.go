@@ -0,0 +1,322 @@
+package helpers
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+
+	sp "github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+const testDeployment = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: ignored
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      automountServiceAccountToken: false
+      enableServiceLinks: false
+      securityContext:
+        runAsUser: 1000
+        fsGroup: 2000
+        seccompProfile:
+          type: Localhost
+          localhostProfile: profiles/web.json
+      volumes:
+      - name: data
+        emptyDir: {}
+      - name: config
+        configMap:
+          name: web-config
+      initContainers:
+      - name: init
+        image: busybox:1.36
+        command: ["sh", "-c"]
+        args: ["echo init"]
+      containers:
+      - name: web
+        image: nginx:1.25
+        args: ["-g", "daemon off;"]
+        env:
+        - name: MODE
+          value: production
+        - name: URL
+          value: http://$(HOST):8080
+        - name: TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: web
+              key: token
+        envFrom:
+        - prefix: CFG_
+          configMapRef:
+            name: web-config
+        volumeMounts:
+        - name: data
+          mountPath: /data
+        - name: config
+          mountPath: /etc/web
+        securityContext:
+          runAsGroup: 3000
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+            add: ["NET_BIND_SERVICE"]
+`
+
+func Test_ParseKubernetesManifest_Deployment(t *testing.T) {
+	containers, err := ParseKubernetesManifest([]byte(testDeployment), "/seccomp")
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %s", err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("expected 2 containers, got %d", len(containers))
+	}
+
+	init := containers[0]
+	if diff := cmp.Diff([]string{"sh", "-c", "echo init"}, init.Command); diff != "" {
+		t.Fatalf("init command mismatch (-want +got):\n%s", diff)
+	}
+	if init.Args != nil {
+		t.Fatalf("expected args to be merged into command, got %v", init.Args)
+	}
+
+	web := containers[1]
+	if web.ImageName != "nginx:1.25" {
+		t.Fatalf("unexpected image name: %q", web.ImageName)
+	}
+	if web.Command != nil {
+		t.Fatalf("expected command to be resolved from image, got %v", web.Command)
+	}
+	if diff := cmp.Diff([]string{"-g", "daemon off;"}, web.Args); diff != "" {
+		t.Fatalf("args mismatch (-want +got):\n%s", diff)
+	}
+	if web.AllowPrivilegeEscalation {
+		t.Fatal("expected privilege escalation to be disallowed")
+	}
+	if web.SeccompProfilePath != filepath.Join("/seccomp", "profiles/web.json") {
+		t.Fatalf("unexpected seccomp profile path: %q", web.SeccompProfilePath)
+	}
+	if *web.RunAsUser != 1000 || *web.RunAsGroup != 3000 {
+		t.Fatalf("unexpected user: %d:%d", *web.RunAsUser, *web.RunAsGroup)
+	}
+	if diff := cmp.Diff([]int64{2000}, web.SupplementalGroups); diff != "" {
+		t.Fatalf("supplemental groups mismatch (-want +got):\n%s", diff)
+	}
+
+	expectedCaps := []string{"CAP_NET_BIND_SERVICE"}
+	if diff := cmp.Diff(expectedCaps, web.Capabilities.Bounding); diff != "" {
+		t.Fatalf("bounding capabilities mismatch (-want +got):\n%s", diff)
+	}
+	if len(web.Capabilities.Ambient) != 0 || len(web.Capabilities.Inheritable) != 0 {
+		t.Fatalf("expected empty ambient and inheritable capabilities: %+v", web.Capabilities)
+	}
+
+	expectedRules := []sp.EnvRuleConfig{
+		{Strategy: sp.EnvVarRuleString, Rule: "MODE=production", Required: true},
+		{Strategy: sp.EnvVarRuleRegex, Rule: `URL=http://.*:8080`, Required: true},
+		{Strategy: sp.EnvVarRuleRegex, Rule: "TOKEN=.*"},
+		{Strategy: sp.EnvVarRuleRegex, Rule: "CFG_[A-Za-z0-9_.-]*=.*"},
+	}
+	if diff := cmp.Diff(expectedRules, web.EnvRules[:len(expectedRules)]); diff != "" {
+		t.Fatalf("env rules mismatch (-want +got):\n%s", diff)
+	}
+	for _, r := range web.EnvRules[len(expectedRules):] {
+		if r.Strategy != sp.EnvVarRuleRegex || r.Required {
+			t.Fatalf("unexpected runtime env rule: %+v", r)
+		}
+	}
+
+	expectedMounts := []sp.MountConfig{
+		{HostPath: "plan9://data", ContainerPath: "/data"},
+		{HostPath: "plan9://config", ContainerPath: "/etc/web", Readonly: true},
+		{HostPath: "plan9://termination-log", ContainerPath: "/dev/termination-log"},
+	}
+	if diff := cmp.Diff(expectedMounts, web.Mounts); diff != "" {
+		t.Fatalf("mounts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_ParseKubernetesManifest_Pod_Privileged(t *testing.T) {
+	manifest := `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: privileged
+spec:
+  containers:
+  - name: c
+    image: alpine
+    securityContext:
+      privileged: true
+      capabilities:
+        add: ["SYS_ADMIN"]
+`
+	containers, err := ParseKubernetesManifest([]byte(manifest), "")
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %s", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(containers))
+	}
+
+	c := containers[0]
+	if !c.AllowElevated {
+		t.Fatal("expected container to be elevated")
+	}
+	if c.Capabilities != nil {
+		t.Fatalf("expected privileged container to use default capabilities, got %+v", c.Capabilities)
+	}
+	if c.RunAsUser != nil || c.RunAsGroup != nil {
+		t.Fatal("expected user to be resolved from image")
+	}
+
+	var serviceAccountMounted bool
+	for _, m := range c.Mounts {
+		if m.ContainerPath == serviceAccountMountPath && m.Readonly {
+			serviceAccountMounted = true
+		}
+	}
+	if !serviceAccountMounted {
+		t.Fatalf("expected service account mount, got %+v", c.Mounts)
+	}
+}
+
+func Test_ParseKubernetesManifest_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		manifest string
+		err      error
+	}{
+		{
+			name: "RuntimeDefaultSeccomp",
+			manifest: `
+kind: Job
+spec:
+  template:
+    spec:
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+      containers:
+      - name: c
+        image: alpine
+`,
+			err: ErrRuntimeDefaultSeccomp,
+		},
+		{
+			name: "EnvFromWithoutPrefix",
+			manifest: `
+kind: Pod
+spec:
+  containers:
+  - name: c
+    image: alpine
+    envFrom:
+    - secretRef:
+        name: s
+`,
+			err: ErrEnvFromWithoutPrefix,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseKubernetesManifest([]byte(tc.manifest), "")
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func Test_KubernetesContainer_UserConfig(t *testing.T) {
+	uid := int64(1000)
+	c := KubernetesContainer{
+		RunAsUser:          &uid,
+		SupplementalGroups: []int64{5},
+	}
+	imgUser := sp.IDNameConfig{Strategy: sp.IDNameStrategyName, Rule: "nginx"}
+	imgGroup := sp.IDNameConfig{Strategy: sp.IDNameStrategyName, Rule: "nginx"}
+
+	expected := sp.UserConfig{
+		UserIDName: sp.IDNameConfig{Strategy: sp.IDNameStrategyID, Rule: "1000"},
+		GroupIDNames: []sp.IDNameConfig{
+			{Strategy: sp.IDNameStrategyAny},
+			{Strategy: sp.IDNameStrategyID, Rule: "5"},
+		},
+		Umask: "0022",
+	}
+	if diff := cmp.Diff(expected, c.userConfig(imgUser, imgGroup)); diff != "" {
+		t.Fatalf("user config mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func Test_PolicyContainersFromKubernetes_Layout(t *testing.T) {
+	base, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatalf("failed to create image: %s", err)
+	}
+	img, err := mutate.Config(base, v1.Config{
+		Entrypoint: []string{"/entrypoint"},
+		Cmd:        []string{"default"},
+		Env:        []string{"PATH=/bin"},
+	})
+	if err != nil {
+		t.Fatalf("failed to set image config: %s", err)
+	}
+
+	dir := t.TempDir()
+	p, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		t.Fatalf("failed to create layout: %s", err)
+	}
+	if err := p.AppendImage(img, layout.WithAnnotations(map[string]string{annotationRefName: "app:1"})); err != nil {
+		t.Fatalf("failed to append image: %s", err)
+	}
+
+	manifest := `
+kind: Pod
+spec:
+  containers:
+  - name: app
+    image: app:1
+    args: ["--flag"]
+`
+	containers, err := ParseKubernetesManifest([]byte(manifest), "")
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %s", err)
+	}
+
+	policyContainers, err := PolicyContainersFromKubernetes(containers, dir)
+	if err != nil {
+		t.Fatalf("failed to create policy containers: %s", err)
+	}
+	if len(policyContainers) != 1 {
+		t.Fatalf("expected 1 policy container, got %d", len(policyContainers))
+	}
+
+	c := policyContainers[0]
+	expectedCommand := map[string]string{"0": "/entrypoint", "1": "--flag"}
+	if diff := cmp.Diff(expectedCommand, c.Command.Elements); diff != "" {
+		t.Fatalf("command mismatch (-want +got):\n%s", diff)
+	}
+	if len(c.Layers.Elements) != 1 {
+		t.Fatalf("expected 1 layer, got %d", len(c.Layers.Elements))
+	}
+}
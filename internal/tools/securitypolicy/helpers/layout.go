@@ -0,0 +1,162 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+const (
+	// annotationRefName is the OCI image-spec annotation, which is used to
+	// name manifests in the layout's index.json, e.g. by skopeo and buildkit.
+	annotationRefName = "org.opencontainers.image.ref.name"
+	// annotationContainerdImageName is the annotation used by containerd
+	// (ctr image export, nerdctl save) for the full image reference.
+	annotationContainerdImageName = "io.containerd.image.name"
+)
+
+// defaultPlatform is the platform picked from multi-platform images, since
+// LCOW only runs linux/amd64 containers.
+var defaultPlatform = v1.Platform{
+	OS:           "linux",
+	Architecture: "amd64",
+}
+
+// LayoutImageFromImageName looks up imageName in the OCI image layout at
+// layoutPath and returns the matching v1.Image.
+//
+// A manifest matches when its `io.containerd.image.name` or
+// `org.opencontainers.image.ref.name` annotation is equal to imageName.
+// Failing that, a manifest whose ref name annotation is only the tag or digest
+// of imageName matches, provided that it is the only such manifest and that it
+// is not named as another image by containerd. Multi-platform indexes are
+// resolved to linux/amd64.
+func LayoutImageFromImageName(layoutPath, imageName string) (v1.Image, error) {
+	p, err := layout.FromPath(layoutPath)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	names, identifier := layoutRefCandidates(imageName)
+	var matches, identifierMatches []v1.Descriptor
+	for _, desc := range indexManifest.Manifests {
+		if descriptorMatches(desc, names) {
+			matches = appendDescriptor(matches, desc)
+		} else if identifier != "" && descriptorMatchesIdentifier(desc, identifier) {
+			identifierMatches = appendDescriptor(identifierMatches, desc)
+		}
+	}
+
+	if len(matches) == 0 {
+		matches = identifierMatches
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("image %q not found in OCI layout %q", imageName, layoutPath)
+	case 1:
+		return imageFromDescriptor(index, matches[0])
+	default:
+		return nil, fmt.Errorf("image %q is ambiguous in OCI layout %q: it matches %s and %s",
+			imageName, layoutPath, matches[0].Digest, matches[1].Digest)
+	}
+}
+
+// layoutRefCandidates returns the full names under which imageName may have
+// been stored in an OCI layout, along with its tag or digest.
+func layoutRefCandidates(imageName string) ([]string, string) {
+	names := []string{imageName}
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return names, ""
+	}
+
+	names = append(names, ref.Name())
+	// containerd normalizes docker hub references to docker.io, whereas
+	// go-containerregistry uses index.docker.io
+	if ref.Context().RegistryStr() == name.DefaultRegistry {
+		names = append(names, "docker.io/"+strings.TrimPrefix(ref.Name(), name.DefaultRegistry+"/"))
+	}
+	return names, ref.Identifier()
+}
+
+func descriptorMatches(desc v1.Descriptor, names []string) bool {
+	for _, annotation := range []string{annotationContainerdImageName, annotationRefName} {
+		value, ok := desc.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		for _, n := range names {
+			if value == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// descriptorMatchesIdentifier returns whether the ref name annotation of desc
+// is the tag or digest of the image. Manifests which containerd named as an
+// image have already failed to match on that name.
+func descriptorMatchesIdentifier(desc v1.Descriptor, identifier string) bool {
+	if _, ok := desc.Annotations[annotationContainerdImageName]; ok {
+		return false
+	}
+	return desc.Annotations[annotationRefName] == identifier
+}
+
+// appendDescriptor appends desc unless a manifest with the same digest was
+// already matched, as a layout may list an image under several names.
+func appendDescriptor(descs []v1.Descriptor, desc v1.Descriptor) []v1.Descriptor {
+	for _, d := range descs {
+		if d.Digest == desc.Digest {
+			return descs
+		}
+	}
+	return append(descs, desc)
+}
+
+// imageFromDescriptor returns the image referenced by desc, resolving image
+// indexes to the image for defaultPlatform.
+func imageFromDescriptor(index v1.ImageIndex, desc v1.Descriptor) (v1.Image, error) {
+	if desc.MediaType.IsImage() {
+		return index.Image(desc.Digest)
+	}
+
+	if !desc.MediaType.IsIndex() {
+		return nil, fmt.Errorf("unsupported media type %q for %s", desc.MediaType, desc.Digest)
+	}
+
+	child, err := index.ImageIndex(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	childManifest, err := child.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range childManifest.Manifests {
+		if m.Platform == nil || !m.MediaType.IsImage() {
+			continue
+		}
+		if m.Platform.OS == defaultPlatform.OS && m.Platform.Architecture == defaultPlatform.Architecture {
+			return child.Image(m.Digest)
+		}
+	}
+
+	return nil, fmt.Errorf("no %s/%s image in index %s", defaultPlatform.OS, defaultPlatform.Architecture, desc.Digest)
+}
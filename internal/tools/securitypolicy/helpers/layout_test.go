@@ -0,0 +1,135 @@
+package helpers
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func writeTestLayout(t *testing.T, annotations map[string]string) (string, v1.Image) {
+	t.Helper()
+
+	dir, images := writeTestLayoutImages(t, annotations)
+	return dir, images[0]
+}
+
+// writeTestLayoutImages writes a layout with a random image for each of the
+// given annotations.
+func writeTestLayoutImages(t *testing.T, annotations ...map[string]string) (string, []v1.Image) {
+	t.Helper()
+
+	dir := t.TempDir()
+	p, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		t.Fatalf("failed to create layout: %s", err)
+	}
+
+	var images []v1.Image
+	for _, a := range annotations {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatalf("failed to create image: %s", err)
+		}
+		if err := p.AppendImage(img, layout.WithAnnotations(a)); err != nil {
+			t.Fatalf("failed to append image: %s", err)
+		}
+		images = append(images, img)
+	}
+	return dir, images
+}
+
+func Test_LayoutImageFromImageName(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		annotations map[string]string
+		imageName   string
+	}{
+		{
+			name:        "ContainerdImageName",
+			annotations: map[string]string{annotationContainerdImageName: "docker.io/library/nginx:1.25"},
+			imageName:   "nginx:1.25",
+		},
+		{
+			name:        "RefNameTag",
+			annotations: map[string]string{annotationRefName: "1.25"},
+			imageName:   "nginx:1.25",
+		},
+		{
+			name:        "RefNameFull",
+			annotations: map[string]string{annotationRefName: "mcr.microsoft.com/oss/nginx:1.25"},
+			imageName:   "mcr.microsoft.com/oss/nginx:1.25",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, expected := writeTestLayout(t, tc.annotations)
+
+			img, err := LayoutImageFromImageName(dir, tc.imageName)
+			if err != nil {
+				t.Fatalf("failed to find image: %s", err)
+			}
+
+			expectedDigest, _ := expected.Digest()
+			digest, err := img.Digest()
+			if err != nil {
+				t.Fatalf("failed to get digest: %s", err)
+			}
+			if digest != expectedDigest {
+				t.Fatalf("expected digest %s, got %s", expectedDigest, digest)
+			}
+		})
+	}
+}
+
+func Test_LayoutImageFromImageName_NotFound(t *testing.T) {
+	dir, _ := writeTestLayout(t, map[string]string{annotationRefName: "1.25"})
+
+	if _, err := LayoutImageFromImageName(dir, "nginx:1.26"); err == nil {
+		t.Fatal("expected lookup to fail")
+	}
+}
+
+func Test_LayoutImageFromImageName_FullNameFirst(t *testing.T) {
+	dir, images := writeTestLayoutImages(t,
+		map[string]string{annotationRefName: "latest"},
+		map[string]string{annotationRefName: "docker.io/library/nginx:latest"},
+	)
+
+	img, err := LayoutImageFromImageName(dir, "nginx:latest")
+	if err != nil {
+		t.Fatalf("failed to find image: %s", err)
+	}
+
+	expectedDigest, _ := images[1].Digest()
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("failed to get digest: %s", err)
+	}
+	if digest != expectedDigest {
+		t.Fatalf("expected digest %s, got %s", expectedDigest, digest)
+	}
+}
+
+func Test_LayoutImageFromImageName_AmbiguousTag(t *testing.T) {
+	dir, _ := writeTestLayoutImages(t,
+		map[string]string{annotationRefName: "latest"},
+		map[string]string{annotationRefName: "latest"},
+	)
+
+	if _, err := LayoutImageFromImageName(dir, "nginx:latest"); err == nil {
+		t.Fatal("expected ambiguous lookup to fail")
+	}
+}
+
+func Test_LayoutImageFromImageName_TagOfOtherImage(t *testing.T) {
+	dir, _ := writeTestLayout(t, map[string]string{
+		annotationContainerdImageName: "docker.io/library/redis:latest",
+		annotationRefName:             "latest",
+	})
+
+	if _, err := LayoutImageFromImageName(dir, "nginx:latest"); err == nil {
+		t.Fatal("expected lookup to fail")
+	}
+}
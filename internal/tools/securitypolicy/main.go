@@ -18,35 +18,73 @@ var (
 	fragmentNamespace = flag.String("n", "", "fragment namespace")
 	fragmentSVN       = flag.String("v", "", "fragment svn")
 	outputRaw         = flag.Bool("r", false, "whether to print the raw output")
+	manifestFile      = flag.String("k", "", "kubernetes manifest path (Pod, Deployment or Job)")
+	layoutPath        = flag.String("l", "", "OCI image layout path to resolve images from instead of pulling them")
+	seccompRoot       = flag.String("p", "", "directory of Localhost seccomp profiles referenced by the manifest")
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case diffCommand:
+			os.Exit(runDiff(os.Args[2:]))
+		case signCommand:
+			os.Exit(runSign(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
-	if flag.NArg() != 0 || len(*configFile) == 0 {
+	if flag.NArg() != 0 || (len(*configFile) == 0 && len(*manifestFile) == 0) {
 		flag.Usage()
 		os.Exit(1)
 	}
 
 	err := func() (err error) {
-		configData, err := os.ReadFile(*configFile)
-		if err != nil {
-			return err
-		}
-
 		config := &securitypolicy.PolicyConfig{}
 
-		err = toml.Unmarshal(configData, config)
-		if err != nil {
-			return err
+		if len(*configFile) != 0 {
+			configData, err := os.ReadFile(*configFile)
+			if err != nil {
+				return err
+			}
+
+			err = toml.Unmarshal(configData, config)
+			if err != nil {
+				return err
+			}
 		}
 
 		defaultContainers := helpers.DefaultContainerConfigs()
 		config.Containers = append(config.Containers, defaultContainers...)
-		policyContainers, err := helpers.PolicyContainersFromConfigs(config.Containers)
+		policyContainers, err := helpers.PolicyContainersFromConfigsInLayout(config.Containers, *layoutPath)
 		if err != nil {
 			return err
 		}
 
+		if len(*manifestFile) != 0 {
+			manifest, err := os.ReadFile(*manifestFile)
+			if err != nil {
+				return err
+			}
+
+			kubernetesContainers, err := helpers.ParseKubernetesManifest(manifest, *seccompRoot)
+			if err != nil {
+				return err
+			}
+
+			manifestContainers, err := helpers.PolicyContainersFromKubernetes(kubernetesContainers, *layoutPath)
+			if err != nil {
+				return err
+			}
+			policyContainers = append(manifestContainers, policyContainers...)
+
+			// JSON policies cannot express users, capabilities and seccomp
+			// profiles set via security contexts, so default to rego.
+			if *outputType == "" {
+				*outputType = "rego"
+			}
+		}
+
 		var policyCode string
 		if *outputType == "fragment" {
 			policyCode, err = securitypolicy.MarshalFragment(
@@ -54,7 +92,8 @@ func main() {
 				*fragmentSVN,
 				policyContainers,
 				config.ExternalProcesses,
-				config.Fragments)
+				config.Fragments,
+				config.PolicyOptions()...)
 		} else {
 			policyCode, err = securitypolicy.MarshalPolicy(
 				*outputType,
@@ -68,6 +107,7 @@ func main() {
 				config.AllowEnvironmentVariableDropping,
 				config.AllowUnencryptedScratch,
 				config.AllowCapabilityDropping,
+				config.PolicyOptions()...,
 			)
 		}
 		if err != nil {
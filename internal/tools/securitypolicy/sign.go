@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Microsoft/cosesign1go/pkg/cosesign1"
+
+	rpi "github.com/Microsoft/hcsshim/internal/regopolicyinterpreter"
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+const signCommand = "sign"
+
+// regoContentType is the content type of signed Rego policies.
+const regoContentType = "application/rego"
+
+// runSign implements `securitypolicy sign [options] policy` and returns the
+// exit code. The policy is signed with a local key, which is meant for tests
+// and development; production policies are signed by a signing service.
+func runSign(args []string) int {
+	fs := flag.NewFlagSet(signCommand, flag.ExitOnError)
+	chainPath := fs.String("chain", "", "PEM certificate chain of the signing key, leaf first")
+	keyPath := fs.String("key", "", "PEM private key to sign with")
+	feed := fs.String("feed", "", "feed of the policy")
+	issuer := fs.String("issuer", "", "did:x509 issuer of the policy, derived from the chain if empty")
+	didPolicy := fs.String("did-policy", "CN", "policy of the derived issuer: CN, EKU or a custom did:x509 policy")
+	algorithm := fs.String("alg", "ES384", "signature algorithm")
+	svn := fs.String("svn", "", "svn to declare in the policy, if it declares none")
+	minimumSVN := fs.String("minimum-svn", "", "minimum svn of the policies accepted from the issuer")
+	envelopeOnly := fs.Bool("envelope", false, "print only the COSE_Sign1 document, to replace the policy of a running UVM")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [options] <policy>\n", os.Args[0], signCommand)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || len(*chainPath) == 0 || len(*keyPath) == 0 || len(*feed) == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	output, err := func() (string, error) {
+		code, err := readPolicyCode(fs.Arg(0))
+		if err != nil {
+			return "", err
+		}
+		if code, err = declareSVN(code, *svn); err != nil {
+			return "", err
+		}
+
+		chainPem, err := os.ReadFile(*chainPath)
+		if err != nil {
+			return "", err
+		}
+		keyPem, err := os.ReadFile(*keyPath)
+		if err != nil {
+			return "", err
+		}
+
+		if len(*issuer) == 0 {
+			*issuer, err = cosesign1.MakeDidX509("sha256", 1, string(chainPem), *didPolicy, false)
+			if err != nil {
+				return "", fmt.Errorf("failed to derive issuer from chain: %w", err)
+			}
+		}
+
+		algo, err := cosesign1.StringToAlgorithm(*algorithm)
+		if err != nil {
+			return "", err
+		}
+
+		envelope, err := cosesign1.CreateCoseSign1([]byte(code), *issuer, *feed, regoContentType, chainPem, keyPem, "rand", algo)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign policy: %w", err)
+		}
+
+		if *envelopeOnly {
+			return base64.StdEncoding.EncodeToString(envelope), nil
+		}
+
+		issuers := &securitypolicy.PolicyIssuers{
+			Issuers: []securitypolicy.PolicyIssuer{{
+				Issuer:     *issuer,
+				Feed:       *feed,
+				MinimumSVN: *minimumSVN,
+			}},
+		}
+		return securitypolicy.EncodeSignedSecurityPolicy(issuers, envelope)
+	}()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(output)
+	return 0
+}
+
+// readPolicyCode reads a Rego policy, which may be base64 encoded as printed
+// by the tool.
+func readPolicyCode(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(code, "package") {
+		decoded, err := base64.StdEncoding.DecodeString(code)
+		if err != nil {
+			return "", fmt.Errorf("policy is neither Rego nor base64 encoded Rego: %w", err)
+		}
+		code = string(decoded)
+	}
+	return code, nil
+}
+
+// declareSVN adds the svn declaration to a policy which has none. A signed
+// policy must declare its svn, which must increase each time it is replaced.
+func declareSVN(code string, svn string) (string, error) {
+	declared, err := policySVN(code)
+	if err != nil {
+		return "", err
+	}
+	if declared != nil {
+		if len(svn) > 0 {
+			return "", fmt.Errorf("policy already declares an svn")
+		}
+		declaredSVN, ok := declared.(string)
+		if !ok {
+			return "", fmt.Errorf("policy svn must be a string: %v", declared)
+		}
+		svn = declaredSVN
+	} else {
+		if len(svn) == 0 {
+			return "", fmt.Errorf("policy does not declare an svn, use -svn to set one")
+		}
+		code = fmt.Sprintf("%s\n\nsvn := %q\n", strings.TrimRight(code, "\n"), svn)
+	}
+
+	// the GCS requires the svn of a signed policy to be a non-negative
+	// integer
+	if _, err := strconv.ParseUint(svn, 10, 64); err != nil {
+		return "", fmt.Errorf("invalid policy svn %q: %w", svn, err)
+	}
+	return code, nil
+}
+
+// policySVN compiles the policy, as the GCS does, and returns the value of
+// data.policy.svn, or nil if the policy does not declare one.
+func policySVN(code string) (interface{}, error) {
+	r, err := rpi.NewRegoPolicyInterpreter(code, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	r.AddModule("framework.rego", &rpi.RegoModule{Namespace: "framework", Code: securitypolicy.FrameworkCode})
+	r.AddModule("api.rego", &rpi.RegoModule{Namespace: "api", Code: securitypolicy.APICode})
+	if err := r.Compile(); err != nil {
+		return nil, fmt.Errorf("rego compilation failed: %w", err)
+	}
+
+	result, err := r.RawQuery("data.policy.svn", nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query the policy svn: %w", err)
+	}
+	if len(result) == 0 || len(result[0].Expressions) == 0 {
+		return nil, nil
+	}
+	return result[0].Expressions[0].Value, nil
+}
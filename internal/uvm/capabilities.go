@@ -21,6 +21,59 @@ func (uvm *UtilityVM) DeleteContainerStateSupported() bool {
 	return uvm.guestCaps.IsDeleteContainerStateSupported()
 }
 
+// PauseResumeSupported returns `true` if the guest supports pausing and
+// resuming containers. Only LCOW guests support it.
+func (uvm *UtilityVM) PauseResumeSupported() bool {
+	if uvm.gc == nil {
+		return false
+	}
+	caps := gcs.GetLCOWCapabilities(uvm.guestCaps)
+	return caps != nil && caps.PauseResumeSupported
+}
+
+// CheckpointRestoreSupported returns `true` if the guest supports
+// checkpointing containers and restoring them from their checkpoint. Only
+// LCOW guests support it.
+func (uvm *UtilityVM) CheckpointRestoreSupported() bool {
+	if uvm.gc == nil {
+		return false
+	}
+	caps := gcs.GetLCOWCapabilities(uvm.guestCaps)
+	return caps != nil && caps.CheckpointRestoreSupported
+}
+
+// CopyFilesSupported returns `true` if the guest supports copying files into
+// and out of containers as tar archives. Only LCOW guests support it.
+func (uvm *UtilityVM) CopyFilesSupported() bool {
+	if uvm.gc == nil {
+		return false
+	}
+	caps := gcs.GetLCOWCapabilities(uvm.guestCaps)
+	return caps != nil && caps.CopyFilesSupported
+}
+
+// EventNotificationsSupported returns `true` if the guest supports pushing
+// the memory, pressure and metrics events of containers which the host
+// subscribed to. Only LCOW guests support it.
+func (uvm *UtilityVM) EventNotificationsSupported() bool {
+	if uvm.gc == nil {
+		return false
+	}
+	caps := gcs.GetLCOWCapabilities(uvm.guestCaps)
+	return caps != nil && caps.EventNotificationsSupported
+}
+
+// AttachProcessSupported returns `true` if the guest supports attaching new
+// stdio to the running processes of containers, replaying the output which it
+// kept while nothing was attached. Only LCOW guests support it.
+func (uvm *UtilityVM) AttachProcessSupported() bool {
+	if uvm.gc == nil {
+		return false
+	}
+	caps := gcs.GetLCOWCapabilities(uvm.guestCaps)
+	return caps != nil && caps.AttachProcessSupported
+}
+
 // Capabilities returns the protocol version and the guest defined capabilities.
 // This should only be used for testing.
 func (uvm *UtilityVM) Capabilities() (uint32, gcs.GuestDefinedCapabilities) {
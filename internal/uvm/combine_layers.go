@@ -126,3 +126,43 @@ func (uvm *UtilityVM) RemoveCombinedLayersLCOW(ctx context.Context, rootfsPath s
 	}
 	return uvm.modify(ctx, msr)
 }
+
+// PullImageLCOW has the guest pull the image `gpi.Image` from its registry and
+// combine its layers and `gpi.ScratchPath` into an overlay filesystem at
+// `gpi.ContainerRootPath`, so that the contents of the image are never
+// exposed to the host.
+//
+// NOTE: `gpi.ScratchPath` and `gpi.ContainerRootPath` are paths from within
+// the UVM.
+func (uvm *UtilityVM) PullImageLCOW(ctx context.Context, gpi guestresource.LCOWGuestPulledImage) error {
+	if uvm.operatingSystem != "linux" {
+		return errNotSupported
+	}
+
+	msr := &hcsschema.ModifySettingRequest{
+		GuestRequest: guestrequest.ModificationRequest{
+			ResourceType: guestresource.ResourceTypeGuestPulledImage,
+			RequestType:  guestrequest.RequestTypeAdd,
+			Settings:     gpi,
+		},
+	}
+	return uvm.modify(ctx, msr)
+}
+
+// RemovePulledImageLCOW removes the overlay filesystem at `rootfsPath` of an
+// image pulled by the guest, and its layers on `scratchPath`.
+//
+// NOTE: `scratchPath` and `rootfsPath` are paths from within the UVM.
+func (uvm *UtilityVM) RemovePulledImageLCOW(ctx context.Context, scratchPath, rootfsPath string) error {
+	msr := &hcsschema.ModifySettingRequest{
+		GuestRequest: guestrequest.ModificationRequest{
+			ResourceType: guestresource.ResourceTypeGuestPulledImage,
+			RequestType:  guestrequest.RequestTypeRemove,
+			Settings: guestresource.LCOWGuestPulledImage{
+				ContainerRootPath: rootfsPath,
+				ScratchPath:       scratchPath,
+			},
+		},
+	}
+	return uvm.modify(ctx, msr)
+}
@@ -129,6 +129,7 @@ type OptionsLCOW struct {
 	AssignedDevices         []VPCIDeviceID       // AssignedDevices are devices to add on pod boot
 	PolicyBasedRouting      bool                 // Whether we should use policy based routing when configuring net interfaces in guest
 	WritableOverlayDirs     bool                 // Whether init should create writable overlay mounts for /var and /etc
+	OCIRuntimes             []string             // OCI runtimes of the GCS, such as runc or crun. The first is the default of containers, which can select the others by annotation
 }
 
 // NewDefaultOptionsLCOW creates the default options for a bootable version of
@@ -858,6 +859,18 @@ func makeLCOWDoc(ctx context.Context, opts *OptionsLCOW, uvm *UtilityVM) (_ *hcs
 		opts.ExecCommandLine += " -scrub-logs"
 	}
 
+	for _, rt := range opts.OCIRuntimes {
+		if rt == "" || strings.ContainsAny(rt, " \t\n,") {
+			return nil, fmt.Errorf("invalid OCI runtime %q", rt)
+		}
+	}
+	if len(opts.OCIRuntimes) > 0 {
+		opts.ExecCommandLine += " -runtime " + opts.OCIRuntimes[0]
+	}
+	if len(opts.OCIRuntimes) > 1 {
+		opts.ExecCommandLine += " -runtimes " + strings.Join(opts.OCIRuntimes[1:], ",")
+	}
+
 	execCmdArgs += " " + opts.ExecCommandLine
 
 	if opts.ProcessDumpLocation != "" {
@@ -183,7 +183,7 @@ func mountRequest(controller, lun uint, path string, config *mountConfig, osType
 		if controller != 0 {
 			return guestrequest.ModificationRequest{}, errors.New("WCOW only supports SCSI controller 0")
 		}
-		if config.encrypted || len(config.options) != 0 ||
+		if config.encrypted || config.encryptionKeyID != "" || config.encryptedLayer != nil || len(config.options) != 0 ||
 			config.ensureFilesystem || config.filesystem != "" || config.partition != 0 {
 			return guestrequest.ModificationRequest{},
 				errors.New("WCOW does not support encrypted, verity, guest options, partitions, specifying mount filesystem, or ensuring filesystem on mounts")
@@ -201,6 +201,8 @@ func mountRequest(controller, lun uint, path string, config *mountConfig, osType
 			Partition:        config.partition,
 			ReadOnly:         config.readOnly,
 			Encrypted:        config.encrypted,
+			EncryptionKeyID:  config.encryptionKeyID,
+			EncryptedLayer:   config.encryptedLayer,
 			Options:          config.options,
 			EnsureFilesystem: config.ensureFilesystem,
 			Filesystem:       config.filesystem,
@@ -225,12 +227,13 @@ func unmountRequest(controller, lun uint, path string, config *mountConfig, osTy
 		}
 	case "linux":
 		req.Settings = guestresource.LCOWMappedVirtualDisk{
-			MountPath:  path,
-			ReadOnly:   config.readOnly,
-			Lun:        uint8(lun),
-			Partition:  config.partition,
-			Controller: uint8(controller),
-			BlockDev:   config.blockDev,
+			MountPath:      path,
+			ReadOnly:       config.readOnly,
+			Lun:            uint8(lun),
+			Partition:      config.partition,
+			Controller:     uint8(controller),
+			BlockDev:       config.blockDev,
+			EncryptedLayer: config.encryptedLayer,
 		}
 	default:
 		return guestrequest.ModificationRequest{}, fmt.Errorf("unsupported os type: %s", osType)
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
 	"github.com/Microsoft/hcsshim/internal/wclayer"
 )
 
@@ -71,6 +72,15 @@ type MountConfig struct {
 	// Encrypted indicates if we should encrypt the device with dm-crypt.
 	// This is only supported for LCOW.
 	Encrypted bool
+	// EncryptionKeyID is the ID of the key which the guest requests from its
+	// key broker to encrypt the device with, so that the device persists
+	// across UVMs. If empty, the device is encrypted with an ephemeral key.
+	// This is only supported for LCOW.
+	EncryptionKeyID string
+	// EncryptedLayer is set when the device holds a container image layer
+	// encrypted with ocicrypt, which the guest decrypts before mounting it.
+	// This is only supported for LCOW.
+	EncryptedLayer *guestresource.LCOWEncryptedLayer
 	// Options are options such as propagation options, flags, or data to
 	// pass to the mount call.
 	// This is only supported for LCOW.
@@ -161,6 +171,8 @@ func (m *Manager) AddVirtualDisk(
 			partition:        mc.Partition,
 			readOnly:         readOnly,
 			encrypted:        mc.Encrypted,
+			encryptionKeyID:  mc.EncryptionKeyID,
+			encryptedLayer:   mc.EncryptedLayer,
 			options:          mc.Options,
 			ensureFilesystem: mc.EnsureFilesystem,
 			filesystem:       mc.Filesystem,
@@ -210,6 +222,8 @@ func (m *Manager) AddPhysicalDisk(
 			partition:        mc.Partition,
 			readOnly:         readOnly,
 			encrypted:        mc.Encrypted,
+			encryptionKeyID:  mc.EncryptionKeyID,
+			encryptedLayer:   mc.EncryptedLayer,
 			options:          mc.Options,
 			ensureFilesystem: mc.EnsureFilesystem,
 			filesystem:       mc.Filesystem,
@@ -257,6 +271,8 @@ func (m *Manager) AddExtensibleVirtualDisk(
 			partition:        mc.Partition,
 			readOnly:         readOnly,
 			encrypted:        mc.Encrypted,
+			encryptionKeyID:  mc.EncryptionKeyID,
+			encryptedLayer:   mc.EncryptedLayer,
 			options:          mc.Options,
 			ensureFilesystem: mc.EnsureFilesystem,
 			filesystem:       mc.Filesystem,
@@ -8,6 +8,8 @@ import (
 	"reflect"
 	"sort"
 	"sync"
+
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
 )
 
 type mountManager struct {
@@ -41,6 +43,8 @@ type mountConfig struct {
 	partition        uint64
 	readOnly         bool
 	encrypted        bool
+	encryptionKeyID  string
+	encryptedLayer   *guestresource.LCOWEncryptedLayer
 	blockDev         bool
 	options          []string
 	ensureFilesystem bool
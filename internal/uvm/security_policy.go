@@ -115,6 +115,72 @@ func (uvm *UtilityVM) InjectPolicyFragment(ctx context.Context, fragment *ctrdta
 	return uvm.modify(ctx, mod)
 }
 
+// ReplacePolicyFragment sends a policy fragment to GCS which replaces the
+// fragments previously loaded from the same feed.
+func (uvm *UtilityVM) ReplacePolicyFragment(ctx context.Context, fragment *ctrdtaskapi.PolicyFragment) error {
+	mod := &hcsschema.ModifySettingRequest{
+		RequestType: guestrequest.RequestTypeUpdate,
+		GuestRequest: guestrequest.ModificationRequest{
+			ResourceType: guestresource.ResourceTypePolicyFragmentReplace,
+			RequestType:  guestrequest.RequestTypeUpdate,
+			Settings: guestresource.SecurityPolicyFragment{
+				Fragment: fragment.Fragment,
+			},
+		},
+	}
+	return uvm.modify(ctx, mod)
+}
+
+// RevokePolicyFragment revokes the policy fragment feed of issuer in GCS.
+func (uvm *UtilityVM) RevokePolicyFragment(ctx context.Context, issuer, feed string) error {
+	mod := &hcsschema.ModifySettingRequest{
+		RequestType: guestrequest.RequestTypeUpdate,
+		GuestRequest: guestrequest.ModificationRequest{
+			ResourceType: guestresource.ResourceTypePolicyFragmentRevoke,
+			RequestType:  guestrequest.RequestTypeRemove,
+			Settings: guestresource.SecurityPolicyFragmentRevocation{
+				Issuer: issuer,
+				Feed:   feed,
+			},
+		},
+	}
+	return uvm.modify(ctx, mod)
+}
+
+// SetPolicyFragmentMinimumSVN raises the minimum SVN of the policy fragments
+// GCS accepts from the feed of issuer.
+func (uvm *UtilityVM) SetPolicyFragmentMinimumSVN(ctx context.Context, issuer, feed, minimumSVN string) error {
+	mod := &hcsschema.ModifySettingRequest{
+		RequestType: guestrequest.RequestTypeUpdate,
+		GuestRequest: guestrequest.ModificationRequest{
+			ResourceType: guestresource.ResourceTypePolicyFragmentMinimumSVN,
+			RequestType:  guestrequest.RequestTypeUpdate,
+			Settings: guestresource.SecurityPolicyFragmentMinimumSVN{
+				Issuer:     issuer,
+				Feed:       feed,
+				MinimumSVN: minimumSVN,
+			},
+		},
+	}
+	return uvm.modify(ctx, mod)
+}
+
+// ReplaceSecurityPolicy sends a signed security policy to GCS which replaces
+// the current signed policy.
+func (uvm *UtilityVM) ReplaceSecurityPolicy(ctx context.Context, policy *ctrdtaskapi.SignedSecurityPolicy) error {
+	mod := &hcsschema.ModifySettingRequest{
+		RequestType: guestrequest.RequestTypeUpdate,
+		GuestRequest: guestrequest.ModificationRequest{
+			ResourceType: guestresource.ResourceTypeSecurityPolicyReplace,
+			RequestType:  guestrequest.RequestTypeUpdate,
+			Settings: guestresource.SignedSecurityPolicy{
+				Policy: policy.Policy,
+			},
+		},
+	}
+	return uvm.modify(ctx, mod)
+}
+
 // returns if this instance of the UtilityVM is created with confidential policy
 func (uvm *UtilityVM) HasConfidentialPolicy() bool {
 	switch opts := uvm.createOpts.(type) {
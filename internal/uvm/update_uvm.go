@@ -45,7 +45,16 @@ func (uvm *UtilityVM) Update(ctx context.Context, data interface{}, annots map[s
 			}
 		}
 	case *ctrdtaskapi.PolicyFragment:
+		if resources.Replace {
+			return uvm.ReplacePolicyFragment(ctx, resources)
+		}
 		return uvm.InjectPolicyFragment(ctx, resources)
+	case *ctrdtaskapi.PolicyFragmentRevocation:
+		return uvm.RevokePolicyFragment(ctx, resources.Issuer, resources.Feed)
+	case *ctrdtaskapi.PolicyFragmentMinimumSVN:
+		return uvm.SetPolicyFragmentMinimumSVN(ctx, resources.Issuer, resources.Feed, resources.MinimumSVN)
+	case *ctrdtaskapi.SignedSecurityPolicy:
+		return uvm.ReplaceSecurityPolicy(ctx, resources)
 	default:
 		return fmt.Errorf("invalid resource: %+v", resources)
 	}
@@ -17,6 +17,8 @@ type SecurityPolicyManager interface {
 	AddSecurityPolicy(ctx context.Context, settings guestresource.ConfidentialOptions) error
 	// InjectPolicyFragment injects a policy fragment into the guest.
 	InjectPolicyFragment(ctx context.Context, settings guestresource.SecurityPolicyFragment) error
+	// ReplaceSecurityPolicy replaces the signed security policy of the guest.
+	ReplaceSecurityPolicy(ctx context.Context, settings guestresource.SignedSecurityPolicy) error
 }
 
 var _ SecurityPolicyManager = (*Guest)(nil)
@@ -54,3 +56,20 @@ func (gm *Guest) InjectPolicyFragment(ctx context.Context, settings guestresourc
 	}
 	return nil
 }
+
+// ReplaceSecurityPolicy replaces the signed security policy of the guest.
+func (gm *Guest) ReplaceSecurityPolicy(ctx context.Context, settings guestresource.SignedSecurityPolicy) error {
+	request := &hcsschema.ModifySettingRequest{
+		GuestRequest: guestrequest.ModificationRequest{
+			ResourceType: guestresource.ResourceTypeSecurityPolicyReplace,
+			RequestType:  guestrequest.RequestTypeUpdate,
+			Settings:     settings,
+		},
+	}
+
+	err := gm.modify(ctx, request.GuestRequest)
+	if err != nil {
+		return fmt.Errorf("failed to replace security policy: %w", err)
+	}
+	return nil
+}
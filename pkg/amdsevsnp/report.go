@@ -109,11 +109,23 @@ func FetchParsedSNPReport(reportData []byte) (Report, error) {
 	if err != nil {
 		return Report{}, err
 	}
+	return ParseReport(rawBytes)
+}
 
-	var r report
-	buf := bytes.NewBuffer(rawBytes)
-	if err := binary.Read(buf, binary.LittleEndian, &r); err != nil {
+// ParseReport parses a raw attestation report.
+func ParseReport(raw []byte) (Report, error) {
+	r, err := parseReport(raw)
+	if err != nil {
 		return Report{}, err
 	}
 	return r.report(), nil
 }
+
+func parseReport(raw []byte) (*report, error) {
+	var r report
+	buf := bytes.NewBuffer(raw)
+	if err := binary.Read(buf, binary.LittleEndian, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -9,6 +9,8 @@ import (
 
 // validateHostData fetches SNP report (if applicable) and validates `hostData` against
 // HostData set at UVM launch.
+//
+// Deprecated: use attestation.ValidateHostData, which supports other hardware.
 func ValidateHostData(hostData []byte) error {
 
 	if err := CheckDriverError(); err != nil {
@@ -0,0 +1,279 @@
+package amdsevsnp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// reportSize is the size of ATTESTATION_REPORT.
+	reportSize = 0x4A0
+	// signedReportSize is the size of the part of ATTESTATION_REPORT which is
+	// signed, i.e. everything up to the signature.
+	signedReportSize = 0x2A0
+	// signatureComponentSize is the size of each of the little endian R and S
+	// components of the signature, see Table 117 of the specification.
+	signatureComponentSize = 72
+	// signatureAlgoECDSAP384SHA384 is the only signature algorithm defined
+	// for attestation reports.
+	signatureAlgoECDSAP384SHA384 = 1
+)
+
+// Guest policy bits, see Table 9 of the specification.
+const (
+	PolicySMT          uint64 = 1 << 16
+	PolicyMigrateMA    uint64 = 1 << 18
+	PolicyDebug        uint64 = 1 << 19
+	PolicySingleSocket uint64 = 1 << 20
+)
+
+// Extensions of the VCEK certificate which bind it to a chip and a TCB version,
+// see "Versioned Chip Endorsement Key (VCEK) Certificate and KDS Interface
+// Specification".
+var (
+	oidBootLoaderSPL = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 1}
+	oidTEESPL        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 2}
+	oidSNPSPL        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 3}
+	oidMicrocodeSPL  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 8}
+	oidHardwareID    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 4}
+)
+
+// TCBVersion is the security patch level of each component of the TCB.
+type TCBVersion struct {
+	BootLoader uint8
+	TEE        uint8
+	SNP        uint8
+	Microcode  uint8
+}
+
+// ParseTCBVersion parses the TCB_VERSION of an attestation report, e.g. its
+// ReportTCB.
+func ParseTCBVersion(tcb uint64) TCBVersion {
+	return TCBVersion{
+		BootLoader: uint8(tcb),
+		TEE:        uint8(tcb >> 8),
+		SNP:        uint8(tcb >> 48),
+		Microcode:  uint8(tcb >> 56),
+	}
+}
+
+// AtLeast returns whether every component of v is at least that of minimum.
+func (v TCBVersion) AtLeast(minimum TCBVersion) bool {
+	return v.BootLoader >= minimum.BootLoader &&
+		v.TEE >= minimum.TEE &&
+		v.SNP >= minimum.SNP &&
+		v.Microcode >= minimum.Microcode
+}
+
+// VerifyOptions are the checks made on the contents of a report, in addition
+// to the verification of its signature. Unset fields are not checked.
+type VerifyOptions struct {
+	// Measurement is the expected launch measurement.
+	Measurement []byte
+	// HostData is the expected HostData provided at launch.
+	HostData []byte
+	// ReportData is the expected data provided by the guest when requesting
+	// the report, e.g. the digest of a public key.
+	ReportData []byte
+	// VMPL is the expected VMPL of the guest which requested the report.
+	VMPL *uint32
+	// RequiredPolicy are the guest policy bits which must be set.
+	RequiredPolicy uint64
+	// ForbiddenPolicy are the guest policy bits which must not be set, e.g.
+	// PolicyDebug.
+	ForbiddenPolicy uint64
+	// MinimumTCB is the minimum TCB version at which the report was signed.
+	MinimumTCB TCBVersion
+	// TrustedRoots are the ARK certificates which the chain must end with,
+	// such as the ARK published by AMD for the product of the chip. It is
+	// required: no root is trusted by default, so that reports are never
+	// verified against a chain which the caller did not choose to trust.
+	TrustedRoots []*x509.Certificate
+	// CurrentTime is the time at which the certificates must be valid. The
+	// zero value means the current time.
+	CurrentTime time.Time
+}
+
+// VerifyReport verifies the signature of the raw attestation report against
+// the VCEK, the VCEK against the chain, which is the ASK followed by the ARK
+// and must end with one of opts.TrustedRoots, and then the contents of the
+// report against opts. It returns the parsed report once verified.
+//
+// The VCEK and its chain are typically fetched from the AMD Key Distribution
+// Service for the ChipID and ReportTCB of the report.
+func VerifyReport(raw []byte, vcek *x509.Certificate, chain []*x509.Certificate, opts *VerifyOptions) (Report, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	if len(raw) < reportSize {
+		return Report{}, fmt.Errorf("attestation report is %d bytes, expected %d", len(raw), reportSize)
+	}
+
+	r, err := parseReport(raw)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to parse attestation report: %w", err)
+	}
+
+	if err := verifyCertificateChain(vcek, chain, opts); err != nil {
+		return Report{}, err
+	}
+	if err := verifyVCEKBinding(vcek, r); err != nil {
+		return Report{}, err
+	}
+	if err := verifyReportSignature(raw, r, vcek); err != nil {
+		return Report{}, err
+	}
+	if err := verifyReportContents(r, opts); err != nil {
+		return Report{}, err
+	}
+	return r.report(), nil
+}
+
+// verifyCertificateChain verifies that each certificate, starting with the
+// VCEK, is signed by the next one in the chain, and that the chain ends with
+// a trusted root. Chains are rejected when no root is trusted.
+func verifyCertificateChain(vcek *x509.Certificate, chain []*x509.Certificate, opts *VerifyOptions) error {
+	if vcek == nil {
+		return fmt.Errorf("no VCEK certificate provided")
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("no certificate chain provided for the VCEK")
+	}
+	if len(opts.TrustedRoots) == 0 {
+		return fmt.Errorf("no trusted roots provided to verify the certificate chain")
+	}
+
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	certs := append([]*x509.Certificate{vcek}, chain...)
+	for i, cert := range certs {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate %q is not valid at %s", cert.Subject.CommonName, now.Format(time.RFC3339))
+		}
+
+		issuer := cert
+		if i+1 < len(certs) {
+			issuer = certs[i+1]
+		}
+		if err := cert.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("certificate %q is not signed by %q: %w", cert.Subject.CommonName, issuer.Subject.CommonName, err)
+		}
+	}
+
+	root := certs[len(certs)-1]
+	for _, trusted := range opts.TrustedRoots {
+		if root.Equal(trusted) {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate chain ends with untrusted root %q", root.Subject.CommonName)
+}
+
+// verifyVCEKBinding verifies that the VCEK was issued for the chip and TCB
+// version which signed the report.
+func verifyVCEKBinding(vcek *x509.Certificate, r *report) error {
+	tcb := ParseTCBVersion(r.ReportTCB)
+	spls := map[string]uint8{
+		oidBootLoaderSPL.String(): tcb.BootLoader,
+		oidTEESPL.String():        tcb.TEE,
+		oidSNPSPL.String():        tcb.SNP,
+		oidMicrocodeSPL.String():  tcb.Microcode,
+	}
+
+	for _, ext := range vcek.Extensions {
+		id := ext.Id.String()
+		if id == oidHardwareID.String() {
+			hwid := ext.Value
+			// the hardware ID may be encoded as an OCTET STRING
+			var octets []byte
+			if rest, err := asn1.Unmarshal(ext.Value, &octets); err == nil && len(rest) == 0 {
+				hwid = octets
+			}
+			if !bytes.Equal(hwid, r.ChipID[:]) {
+				return fmt.Errorf("VCEK was issued for chip %s, report was signed by chip %s",
+					hex.EncodeToString(hwid), hex.EncodeToString(r.ChipID[:]))
+			}
+			continue
+		}
+
+		expected, ok := spls[id]
+		if !ok {
+			continue
+		}
+		var spl int
+		if _, err := asn1.Unmarshal(ext.Value, &spl); err != nil {
+			return fmt.Errorf("failed to parse VCEK extension %s: %w", id, err)
+		}
+		if spl != int(expected) {
+			return fmt.Errorf("VCEK extension %s is %d, report TCB is %d", id, spl, expected)
+		}
+		delete(spls, id)
+	}
+
+	if len(spls) != 0 {
+		return fmt.Errorf("VCEK is missing the TCB version extensions")
+	}
+	return nil
+}
+
+// verifyReportSignature verifies the ECDSA P-384 signature of the report.
+func verifyReportSignature(raw []byte, r *report, vcek *x509.Certificate) error {
+	if r.SignatureAlgo != signatureAlgoECDSAP384SHA384 {
+		return fmt.Errorf("unsupported report signature algorithm %d", r.SignatureAlgo)
+	}
+
+	key, ok := vcek.PublicKey.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P384() {
+		return fmt.Errorf("VCEK public key is not an ECDSA P-384 key")
+	}
+
+	// R and S are little endian, and zero-extended to 72 bytes
+	rBytes := mirrorBytes(append([]byte{}, r.Signature[:signatureComponentSize]...))
+	sBytes := mirrorBytes(append([]byte{}, r.Signature[signatureComponentSize:2*signatureComponentSize]...))
+
+	digest := sha512.Sum384(raw[:signedReportSize])
+	if !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(rBytes), new(big.Int).SetBytes(sBytes)) {
+		return fmt.Errorf("attestation report signature is not valid for the VCEK")
+	}
+	return nil
+}
+
+// verifyReportContents checks the report against opts.
+func verifyReportContents(r *report, opts *VerifyOptions) error {
+	if opts.Measurement != nil && !bytes.Equal(opts.Measurement, r.Measurement[:]) {
+		return fmt.Errorf("measurement %s doesn't match expected %s",
+			hex.EncodeToString(r.Measurement[:]), hex.EncodeToString(opts.Measurement))
+	}
+	if opts.HostData != nil && !bytes.Equal(opts.HostData, r.HostData[:]) {
+		return fmt.Errorf("HostData %s doesn't match expected %s",
+			hex.EncodeToString(r.HostData[:]), hex.EncodeToString(opts.HostData))
+	}
+	if opts.ReportData != nil && !bytes.Equal(opts.ReportData, r.ReportData[:]) {
+		return fmt.Errorf("report data %s doesn't match expected %s",
+			hex.EncodeToString(r.ReportData[:]), hex.EncodeToString(opts.ReportData))
+	}
+	if opts.VMPL != nil && *opts.VMPL != r.VMPL {
+		return fmt.Errorf("report was requested at VMPL %d, expected %d", r.VMPL, *opts.VMPL)
+	}
+	if missing := opts.RequiredPolicy &^ r.Policy; missing != 0 {
+		return fmt.Errorf("guest policy %#x is missing required bits %#x", r.Policy, missing)
+	}
+	if forbidden := opts.ForbiddenPolicy & r.Policy; forbidden != 0 {
+		return fmt.Errorf("guest policy %#x has forbidden bits %#x", r.Policy, forbidden)
+	}
+	if tcb := ParseTCBVersion(r.ReportTCB); !tcb.AtLeast(opts.MinimumTCB) {
+		return fmt.Errorf("report TCB %+v is below minimum %+v", tcb, opts.MinimumTCB)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+//go:build linux
+// +build linux
+
+package amdsevsnp_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/hcsshim/internal/tools/snp-report/fake"
+	"github.com/Microsoft/hcsshim/pkg/amdsevsnp"
+)
+
+// testChain is a synthetic VCEK, ASK and ARK, and the VCEK key with which
+// reports are signed.
+type testChain struct {
+	vcekKey *ecdsa.PrivateKey
+	vcek    *x509.Certificate
+	ask     *x509.Certificate
+	ark     *x509.Certificate
+}
+
+func createCertificate(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) *x509.Certificate {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func caTemplate(serial int64, name string) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SignatureAlgorithm:    x509.SHA384WithRSAPSS,
+	}
+}
+
+func vcekExtension(t *testing.T, id asn1.ObjectIdentifier, value interface{}) pkix.Extension {
+	t.Helper()
+	b, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: id, Value: b}
+}
+
+// newTestChain creates a chain whose VCEK is bound to the chip ID and TCB
+// version of the report.
+func newTestChain(t *testing.T, report amdsevsnp.Report) *testChain {
+	t.Helper()
+
+	arkKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ark := createCertificate(t, caTemplate(1, "ARK-Test"), caTemplate(1, "ARK-Test"), &arkKey.PublicKey, arkKey)
+
+	askKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ask := createCertificate(t, caTemplate(2, "SEV-Test"), ark, &askKey.PublicKey, arkKey)
+
+	vcekKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chipID, err := hex.DecodeString(report.ChipID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcb := amdsevsnp.ParseTCBVersion(report.ReportTCB)
+	vcekTemplate := &x509.Certificate{
+		SerialNumber:       big.NewInt(3),
+		Subject:            pkix.Name{CommonName: "SEV-VCEK"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		SignatureAlgorithm: x509.SHA384WithRSAPSS,
+		ExtraExtensions: []pkix.Extension{
+			vcekExtension(t, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 1}, int(tcb.BootLoader)),
+			vcekExtension(t, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 2}, int(tcb.TEE)),
+			vcekExtension(t, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 3}, int(tcb.SNP)),
+			vcekExtension(t, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 3, 8}, int(tcb.Microcode)),
+			vcekExtension(t, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 3704, 1, 4}, chipID),
+		},
+	}
+	vcek := createCertificate(t, vcekTemplate, ask, &vcekKey.PublicKey, askKey)
+
+	return &testChain{vcekKey: vcekKey, vcek: vcek, ask: ask, ark: ark}
+}
+
+// signReport replaces the signature of the raw report with one made by the
+// VCEK key of the chain.
+func (c *testChain) signReport(t *testing.T, raw []byte) {
+	t.Helper()
+
+	digest := sha512.Sum384(raw[:0x2A0])
+	r, s, err := ecdsa.Sign(rand.Reader, c.vcekKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := raw[0x2A0:0x4A0]
+	for i := range signature {
+		signature[i] = 0
+	}
+	for i, b := range r.FillBytes(make([]byte, 72)) {
+		signature[71-i] = b
+	}
+	for i, b := range s.FillBytes(make([]byte, 72)) {
+		signature[72+71-i] = b
+	}
+}
+
+func Test_VerifyReport(t *testing.T) {
+	raw, err := fake.FetchRawSNPReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := amdsevsnp.ParseReport(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestChain(t, expected)
+	chain.signReport(t, raw)
+
+	measurement, err := hex.DecodeString(expected.Measurement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmpl := uint32(0)
+	opts := &amdsevsnp.VerifyOptions{
+		Measurement:     measurement,
+		HostData:        expected.HostData,
+		VMPL:            &vmpl,
+		ForbiddenPolicy: amdsevsnp.PolicyDebug,
+		MinimumTCB:      amdsevsnp.ParseTCBVersion(expected.ReportTCB),
+		TrustedRoots:    []*x509.Certificate{chain.ark},
+	}
+
+	report, err := amdsevsnp.VerifyReport(raw, chain.vcek, []*x509.Certificate{chain.ask, chain.ark}, opts)
+	if err != nil {
+		t.Fatalf("expected report to be verified: %s", err)
+	}
+	if report.Measurement != expected.Measurement || report.ChipID != expected.ChipID {
+		t.Fatalf("unexpected verified report: %+v", report)
+	}
+}
+
+func Test_VerifyReport_Invalid(t *testing.T) {
+	raw, err := fake.FetchRawSNPReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := amdsevsnp.ParseReport(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestChain(t, expected)
+	chain.signReport(t, raw)
+	other := newTestChain(t, expected)
+
+	tcb := amdsevsnp.ParseTCBVersion(expected.ReportTCB)
+	vmpl := uint32(1)
+
+	for _, tc := range []struct {
+		name   string
+		modify func(raw []byte)
+		resign bool
+		vcek   *x509.Certificate
+		chain  []*x509.Certificate
+		opts   *amdsevsnp.VerifyOptions
+		err    string
+	}{
+		{
+			name:   "TamperedMeasurement",
+			modify: func(raw []byte) { raw[0x90] ^= 1 },
+			err:    "signature is not valid",
+		},
+		{
+			name:   "OtherChip",
+			modify: func(raw []byte) { raw[0x1A0] ^= 1 },
+			resign: true,
+			err:    "VCEK was issued for chip",
+		},
+		{
+			name: "VCEKOfOtherChain",
+			vcek: other.vcek,
+			err:  "is not signed by",
+		},
+		{
+			name:  "UntrustedRoot",
+			chain: []*x509.Certificate{other.ask, other.ark},
+			vcek:  other.vcek,
+			opts:  &amdsevsnp.VerifyOptions{TrustedRoots: []*x509.Certificate{chain.ark}},
+			err:   "untrusted root",
+		},
+		{
+			name:  "NoChain",
+			chain: []*x509.Certificate{},
+			err:   "no certificate chain",
+		},
+		{
+			name: "Expired",
+			opts: &amdsevsnp.VerifyOptions{CurrentTime: time.Now().Add(2 * time.Hour)},
+			err:  "is not valid at",
+		},
+		{
+			name: "Measurement",
+			opts: &amdsevsnp.VerifyOptions{Measurement: make([]byte, 48)},
+			err:  "measurement",
+		},
+		{
+			name: "VMPL",
+			opts: &amdsevsnp.VerifyOptions{VMPL: &vmpl},
+			err:  "VMPL",
+		},
+		{
+			name: "RequiredPolicy",
+			opts: &amdsevsnp.VerifyOptions{RequiredPolicy: amdsevsnp.PolicySingleSocket},
+			err:  "missing required bits",
+		},
+		{
+			name: "ForbiddenPolicy",
+			opts: &amdsevsnp.VerifyOptions{ForbiddenPolicy: amdsevsnp.PolicySMT},
+			err:  "forbidden bits",
+		},
+		{
+			name: "MinimumTCB",
+			opts: &amdsevsnp.VerifyOptions{MinimumTCB: amdsevsnp.TCBVersion{Microcode: tcb.Microcode + 1}},
+			err:  "below minimum",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			modified := append([]byte{}, raw...)
+			if tc.modify != nil {
+				tc.modify(modified)
+			}
+			if tc.resign {
+				chain.signReport(t, modified)
+			}
+			vcek := chain.vcek
+			if tc.vcek != nil {
+				vcek = tc.vcek
+			}
+			certs := []*x509.Certificate{chain.ask, chain.ark}
+			if tc.chain != nil {
+				certs = tc.chain
+			}
+
+			// the synthetic ARK is trusted unless the test case says
+			// otherwise
+			opts := amdsevsnp.VerifyOptions{}
+			if tc.opts != nil {
+				opts = *tc.opts
+			}
+			if opts.TrustedRoots == nil {
+				opts.TrustedRoots = []*x509.Certificate{chain.ark}
+			}
+
+			_, err := amdsevsnp.VerifyReport(modified, vcek, certs, &opts)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got: %v", tc.err, err)
+			}
+		})
+	}
+
+	if _, err := amdsevsnp.VerifyReport(raw[:0x2A0], chain.vcek, []*x509.Certificate{chain.ask, chain.ark}, nil); err == nil {
+		t.Fatal("expected truncated report to be rejected")
+	}
+}
+
+// Test_VerifyReport_NoTrustedRoots checks that chains are rejected when no
+// roots are trusted, even if they are otherwise valid.
+func Test_VerifyReport_NoTrustedRoots(t *testing.T) {
+	raw, err := fake.FetchRawSNPReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := amdsevsnp.ParseReport(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestChain(t, expected)
+	chain.signReport(t, raw)
+
+	for _, opts := range []*amdsevsnp.VerifyOptions{
+		nil,
+		{},
+		{TrustedRoots: []*x509.Certificate{}},
+	} {
+		if _, err := amdsevsnp.VerifyReport(raw, chain.vcek, []*x509.Certificate{chain.ask, chain.ark}, opts); err == nil {
+			t.Fatalf("expected chain to be rejected without trusted roots, with options %+v", opts)
+		}
+	}
+}
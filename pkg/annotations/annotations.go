@@ -115,6 +115,23 @@ const (
 	// See [LCOWTeeLogDirMount] for more info.
 	LCOWTeeLogPath = "io.microsoft.container.lcow.tee-log-path"
 
+	// LCOWTeeLogFormat specifies the format of the file of [LCOWTeeLogPath]: "raw", the default,
+	// for the stdio of the container as is, or "cri" for the CRI log format, in which each line of
+	// output is prefixed by its timestamp, its stream and whether it is a partial line.
+	//
+	// CRI formatted logs require a security policy which allows runtime logging, and keep being
+	// written if the stdio connections to the host fail.
+	LCOWTeeLogFormat = "io.microsoft.container.lcow.tee-log-format"
+
+	// LCOWTeeLogMaxSize specifies the size in bytes at which a CRI formatted [LCOWTeeLogPath] is
+	// rotated. It is not rotated by default.
+	LCOWTeeLogMaxSize = "io.microsoft.container.lcow.tee-log-max-size"
+
+	// LCOWTeeLogMaxFiles specifies the number of files of a rotated [LCOWTeeLogPath] which are
+	// kept, including the current one, and defaults to 5. Rotated files are suffixed by ".1", ".2"
+	// and so on, from the newest.
+	LCOWTeeLogMaxFiles = "io.microsoft.container.lcow.tee-log-max-files"
+
 	// LCOWLogPathMount is the destination to mount the log directory containing files specified
 	// by the [LCOWTeeLogPath] annotation in order to make them available within the container.
 	// The log directory is backed by the sandbox (pause container) scratch VHD, and can
@@ -132,6 +149,36 @@ const (
 	//
 	// 	/var/logs/containers/dir/a.logs
 	LCOWTeeLogDirMount = "io.microsoft.container.lcow.tee-log-dir-mount"
+
+	// LCOWCheckpointImagePath specifies a directory in the Linux uVM holding a CRIU checkpoint
+	// image of the container, on a SCSI disk or a directory mapped into the uVM. The container
+	// is then restored from the image, rather than created, and is running once it is started.
+	//
+	// The bundle and spec of the container must match those of the checkpointed container.
+	LCOWCheckpointImagePath = "io.microsoft.container.lcow.checkpoint-image-path"
+
+	// LCOWScratchEncryptionKeyID specifies the ID of the key which the Linux uVM requests from
+	// its key broker to encrypt the scratch of the container, so that the scratch persists
+	// across uVMs. The scratch is encrypted with an ephemeral key otherwise.
+	//
+	// Requires the scratch to be encrypted (see [LCOWEncryptedScratchDisk]).
+	LCOWScratchEncryptionKeyID = "io.microsoft.container.lcow.scratch-encryption-key-id"
+
+	// LCOWGuestPullImage specifies the reference of the image of the container, such as
+	// "registry.example.com/repo:tag", which the Linux uVM pulls from its registry itself,
+	// through the network namespace of the pod, rather than mounting the layers of the
+	// container. The contents of the image are then never exposed to the host.
+	LCOWGuestPullImage = "io.microsoft.container.lcow.guest-pull-image"
+
+	// LCOWGuestPullUnpack specifies how the Linux uVM unpacks the layers of the image which it
+	// pulls (see [LCOWGuestPullImage]): "ext4", the default, mounts each layer as a read-only
+	// ext4 image, and "dir" extracts each layer into a directory.
+	LCOWGuestPullUnpack = "io.microsoft.container.lcow.guest-pull-unpack"
+
+	// LCOWOCIRuntime specifies the OCI runtime of the container in the Linux uVM, such as "crun",
+	// which must be one of the runtimes of the uVM (see [LCOWOCIRuntimes]).
+	// Containers use the default runtime of the uVM otherwise.
+	LCOWOCIRuntime = "io.microsoft.container.lcow.oci-runtime"
 )
 
 // LCOW multipod annotations enables multipod and warmpooling.
@@ -483,6 +530,11 @@ const (
 	// synchronization service inside the LCOW UVM.
 	DisableLCOWTimeSyncService = "io.microsoft.virtualmachine.lcow.timesync.disable"
 
+	// LCOWOCIRuntimes is a comma separated list of the OCI runtimes inside the LCOW UVM, such as
+	// "crun,runc", which must implement the command line of runc. The first is the default runtime
+	// of containers, which can select the others with [LCOWOCIRuntime]. Defaults to runc.
+	LCOWOCIRuntimes = "io.microsoft.virtualmachine.lcow.oci-runtimes"
+
 	// KernelBootOptions is used to specify kernel options used while booting a linux kernel.
 	KernelBootOptions = "io.microsoft.virtualmachine.lcow.kernelbootoptions"
 
@@ -0,0 +1,101 @@
+package attestation
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// EvidenceFormat is the format of the raw evidence returned by a Provider.
+type EvidenceFormat string
+
+const (
+	// EvidenceFormatSNP is an AMD SEV-SNP ATTESTATION_REPORT.
+	EvidenceFormatSNP EvidenceFormat = "amd-sev-snp"
+	// EvidenceFormatTDX is an Intel TDX TDREPORT, which the quoting enclave of
+	// the host turns into a quote.
+	EvidenceFormatTDX EvidenceFormat = "intel-tdx"
+	// EvidenceFormatFake is an unsigned report laid out as an AMD SEV-SNP
+	// ATTESTATION_REPORT, which is only fit for testing.
+	EvidenceFormatFake EvidenceFormat = "fake"
+)
+
+// Evidence is an attestation report, along with the fields of it which are
+// common to all providers.
+type Evidence struct {
+	Format EvidenceFormat
+	// Raw is the report, in Format.
+	Raw []byte
+	// HostData is the data which the host bound to the guest at launch, i.e.
+	// HOST_DATA of SEV-SNP or MRCONFIGID of TDX.
+	HostData []byte
+	// ReportData is the data which the guest provided with the request.
+	ReportData []byte
+}
+
+// Provider produces attestation reports.
+type Provider interface {
+	// IsAvailable returns whether the guest runs on the hardware of the
+	// provider.
+	IsAvailable() (bool, error)
+	// Report returns an attestation report which includes reportData.
+	Report(reportData []byte) (*Evidence, error)
+	// EvidenceFormat returns the format of the reports of the provider.
+	EvidenceFormat() EvidenceFormat
+}
+
+// Providers returns the providers of the hardware which is supported, in the
+// order in which Detect tries them.
+func Providers() []Provider {
+	return []Provider{NewSNPProvider(), NewTDXProvider()}
+}
+
+// Detect returns the provider of the hardware on which the guest runs, or nil
+// when the guest is not confidential.
+func Detect() (Provider, error) {
+	for _, p := range Providers() {
+		available, err := p.IsAvailable()
+		if err != nil {
+			return nil, err
+		}
+		if available {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// ValidateHostData fetches a report from p (if available) and validates
+// `hostData` against the HostData set at UVM launch. HostData which is larger
+// than `hostData`, e.g. MRCONFIGID, must be zero-extended.
+func ValidateHostData(p Provider, hostData []byte) error {
+	if p == nil {
+		return nil
+	}
+
+	available, err := p.IsAvailable()
+	if err != nil {
+		return err
+	}
+	if !available {
+		return nil
+	}
+
+	evidence, err := p.Report(nil)
+	if err != nil {
+		return err
+	}
+
+	expected := hostData
+	if len(expected) < len(evidence.HostData) {
+		expected = make([]byte, len(evidence.HostData))
+		copy(expected, hostData)
+	}
+	if !bytes.Equal(expected, evidence.HostData) {
+		return fmt.Errorf(
+			"security policy digest %q doesn't match HostData provided at launch %q",
+			hostData,
+			evidence.HostData,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package attestation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Microsoft/hcsshim/pkg/amdsevsnp"
+)
+
+func Test_FakeProvider(t *testing.T) {
+	hostData := bytes.Repeat([]byte{0xab}, 32)
+	p := NewFakeProvider(hostData)
+
+	first, err := p.Report([]byte("nonce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.Report([]byte("nonce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Raw, second.Raw) {
+		t.Fatal("expected reports of the fake provider to be deterministic")
+	}
+	if first.Format != EvidenceFormatFake || !bytes.Equal(first.HostData, hostData) ||
+		!bytes.HasPrefix(first.ReportData, []byte("nonce")) {
+		t.Fatalf("unexpected evidence: %+v", first)
+	}
+
+	report, err := amdsevsnp.ParseReport(first.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Policy&amdsevsnp.PolicyDebug != 0 {
+		t.Fatal("expected fake report to be of a non-debuggable guest")
+	}
+
+	if _, err := p.Report(make([]byte, 65)); err == nil {
+		t.Fatal("expected report data larger than 64 bytes to be rejected")
+	}
+}
+
+// staticProvider returns evidence with the given HostData.
+type staticProvider struct {
+	available bool
+	hostData  []byte
+}
+
+func (p *staticProvider) IsAvailable() (bool, error) {
+	return p.available, nil
+}
+
+func (p *staticProvider) Report([]byte) (*Evidence, error) {
+	return &Evidence{Format: EvidenceFormatTDX, HostData: p.hostData}, nil
+}
+
+func (*staticProvider) EvidenceFormat() EvidenceFormat {
+	return EvidenceFormatTDX
+}
+
+func Test_ValidateHostData(t *testing.T) {
+	hostData := bytes.Repeat([]byte{1}, 32)
+	other := bytes.Repeat([]byte{2}, 32)
+
+	for _, tc := range []struct {
+		name     string
+		provider Provider
+		valid    bool
+	}{
+		{name: "NotConfidential", provider: nil, valid: true},
+		{name: "Unavailable", provider: &staticProvider{hostData: other}, valid: true},
+		{name: "Match", provider: NewFakeProvider(hostData), valid: true},
+		{name: "Mismatch", provider: NewFakeProvider(other), valid: false},
+		{
+			name:     "ZeroExtended",
+			provider: &staticProvider{available: true, hostData: append(append([]byte{}, hostData...), make([]byte, 16)...)},
+			valid:    true,
+		},
+		{
+			name:     "NotZeroExtended",
+			provider: &staticProvider{available: true, hostData: append(append([]byte{}, hostData...), other[:16]...)},
+			valid:    false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateHostData(tc.provider, hostData)
+			if tc.valid && err != nil {
+				t.Fatalf("expected HostData to be valid: %s", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected HostData to be invalid")
+			}
+		})
+	}
+}
+
+func Test_ParseTDReport(t *testing.T) {
+	if size := binary.Size(TDReport{}); size != TDReportSize {
+		t.Fatalf("TDREPORT_STRUCT is %d bytes, expected %d", size, TDReportSize)
+	}
+
+	raw := make([]byte, TDReportSize)
+	// REPORTDATA and MRCONFIGID, see TDREPORT_STRUCT
+	copy(raw[128:], "nonce")
+	copy(raw[576:], "config")
+
+	report, err := ParseTDReport(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(report.ReportMac.ReportData[:], []byte("nonce")) ||
+		!bytes.HasPrefix(report.TDInfo.MRConfigID[:], []byte("config")) {
+		t.Fatalf("unexpected TDREPORT: %+v", report)
+	}
+
+	if _, err := ParseTDReport(raw[:512]); err == nil {
+		t.Fatal("expected truncated TDREPORT to be rejected")
+	}
+}
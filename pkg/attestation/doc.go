@@ -0,0 +1,4 @@
+// Package attestation abstracts the hardware which produces attestation
+// reports inside an enlightened guest, e.g. AMD SEV-SNP or Intel TDX, behind a
+// Provider.
+package attestation
@@ -0,0 +1,58 @@
+package attestation
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+)
+
+// Offsets of the fields of the SEV-SNP ATTESTATION_REPORT which are filled in
+// by the fake provider.
+const (
+	fakeReportSize        = 0x4A0
+	fakeReportDataOffset  = 0x50
+	fakeMeasurementOffset = 0x90
+	fakeHostDataOffset    = 0xC0
+)
+
+type fakeProvider struct {
+	hostData []byte
+}
+
+var _ Provider = &fakeProvider{}
+
+// NewFakeProvider returns a provider which is always available, and whose
+// reports are deterministic and unsigned, with the given HostData. It is only
+// fit for exercising confidential code paths in tests.
+func NewFakeProvider(hostData []byte) Provider {
+	return &fakeProvider{hostData: hostData}
+}
+
+func (*fakeProvider) IsAvailable() (bool, error) {
+	return true, nil
+}
+
+func (p *fakeProvider) Report(reportData []byte) (*Evidence, error) {
+	if len(reportData) > 64 {
+		return nil, fmt.Errorf("reportData too large: %s", reportData)
+	}
+	if len(p.hostData) > 32 {
+		return nil, fmt.Errorf("hostData too large: %s", p.hostData)
+	}
+
+	raw := make([]byte, fakeReportSize)
+	// version 2, guest SVN 1 and the policy of a non-debuggable guest
+	binary.LittleEndian.PutUint32(raw[0x00:], 2)
+	binary.LittleEndian.PutUint32(raw[0x04:], 1)
+	binary.LittleEndian.PutUint64(raw[0x08:], 0x30000)
+	copy(raw[fakeReportDataOffset:], reportData)
+	copy(raw[fakeHostDataOffset:], p.hostData)
+	measurement := sha512.Sum384(p.hostData)
+	copy(raw[fakeMeasurementOffset:], measurement[:])
+
+	return snpEvidence(EvidenceFormatFake, raw)
+}
+
+func (*fakeProvider) EvidenceFormat() EvidenceFormat {
+	return EvidenceFormatFake
+}
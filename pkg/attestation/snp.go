@@ -0,0 +1,54 @@
+package attestation
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/Microsoft/hcsshim/pkg/amdsevsnp"
+)
+
+type snpProvider struct{}
+
+var _ Provider = snpProvider{}
+
+// NewSNPProvider returns the provider of AMD SEV-SNP reports, which are
+// fetched from /dev/sev-guest on Linux and from the PSP driver on Windows.
+func NewSNPProvider() Provider {
+	return snpProvider{}
+}
+
+func (snpProvider) IsAvailable() (bool, error) {
+	if err := amdsevsnp.CheckDriverError(); err != nil {
+		return false, fmt.Errorf("an error occurred while using PSP driver: %w", err)
+	}
+	return amdsevsnp.IsSNP()
+}
+
+func (snpProvider) Report(reportData []byte) (*Evidence, error) {
+	raw, err := amdsevsnp.FetchRawSNPReport(reportData)
+	if err != nil {
+		return nil, err
+	}
+	return snpEvidence(EvidenceFormatSNP, raw)
+}
+
+func (snpProvider) EvidenceFormat() EvidenceFormat {
+	return EvidenceFormatSNP
+}
+
+func snpEvidence(format EvidenceFormat, raw []byte) (*Evidence, error) {
+	report, err := amdsevsnp.ParseReport(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SEV-SNP report: %w", err)
+	}
+	reportData, err := hex.DecodeString(report.ReportData)
+	if err != nil {
+		return nil, err
+	}
+	return &Evidence{
+		Format:     format,
+		Raw:        raw,
+		HostData:   report.HostData,
+		ReportData: reportData,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package attestation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// TDReportSize is the size of TDREPORT_STRUCT.
+const TDReportSize = 1024
+
+// TDReport is TDREPORT_STRUCT, see "Intel TDX Module Base Architecture
+// Specification", which the quoting enclave of the host signs into a quote.
+type TDReport struct {
+	ReportMac  ReportMac
+	TEETCBInfo [239]byte
+	Reserved   [17]byte
+	TDInfo     TDInfo
+}
+
+// ReportMac is REPORTMACSTRUCT, the part of TDREPORT_STRUCT which is MACed.
+type ReportMac struct {
+	ReportType     [8]byte
+	Reserved1      [8]byte
+	CPUSVN         [16]byte
+	TEETCBInfoHash [48]byte
+	TEEInfoHash    [48]byte
+	ReportData     [64]byte
+	Reserved2      [32]byte
+	Mac            [32]byte
+}
+
+// TDInfo is TDINFO_STRUCT, the measurements of the TD.
+type TDInfo struct {
+	Attributes    [8]byte
+	XFAM          [8]byte
+	MRTD          [48]byte
+	MRConfigID    [48]byte
+	MROwner       [48]byte
+	MROwnerConfig [48]byte
+	RTMR          [4][48]byte
+	ServTDHash    [48]byte
+	Reserved      [64]byte
+}
+
+// ParseTDReport parses a raw TDREPORT_STRUCT.
+func ParseTDReport(raw []byte) (*TDReport, error) {
+	if len(raw) < TDReportSize {
+		return nil, fmt.Errorf("TDREPORT is %d bytes, expected %d", len(raw), TDReportSize)
+	}
+
+	var r TDReport
+	if err := binary.Read(bytes.NewReader(raw), binary.LittleEndian, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+type tdxProvider struct{}
+
+var _ Provider = tdxProvider{}
+
+// NewTDXProvider returns the provider of Intel TDX reports, which are fetched
+// from /dev/tdx_guest.
+func NewTDXProvider() Provider {
+	return tdxProvider{}
+}
+
+func (tdxProvider) IsAvailable() (bool, error) {
+	return isTDX()
+}
+
+func (tdxProvider) Report(reportData []byte) (*Evidence, error) {
+	raw, err := fetchRawTDReport(reportData)
+	if err != nil {
+		return nil, err
+	}
+	report, err := ParseTDReport(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &Evidence{
+		Format:     EvidenceFormatTDX,
+		Raw:        raw,
+		HostData:   report.TDInfo.MRConfigID[:],
+		ReportData: report.ReportMac.ReportData[:],
+	}, nil
+}
+
+func (tdxProvider) EvidenceFormat() EvidenceFormat {
+	return EvidenceFormatTDX
+}
@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package attestation
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/Microsoft/hcsshim/internal/guest/linux"
+)
+
+// TDXDevicePath is the device through which the TD requests its reports.
+const TDXDevicePath = "/dev/tdx_guest"
+
+// tdxGetReport0IoctlCode is TDX_CMD_GET_REPORT0 of
+// include/uapi/linux/tdx-guest.h, i.e. _IOWR('T', 1, struct tdx_report_req).
+const tdxGetReport0IoctlCode = 0xC4405401
+
+// tdxReportRequest is struct tdx_report_req.
+type tdxReportRequest struct {
+	ReportData [64]byte
+	TDReport   [TDReportSize]byte
+}
+
+func isTDX() (bool, error) {
+	_, err := os.Stat(TDXDevicePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func fetchRawTDReport(reportData []byte) ([]byte, error) {
+	f, err := os.OpenFile(TDXDevicePath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var req tdxReportRequest
+	if len(reportData) > len(req.ReportData) {
+		return nil, fmt.Errorf("reportData too large: %s", reportData)
+	}
+	copy(req.ReportData[:], reportData)
+
+	if err := linux.Ioctl(f, tdxGetReport0IoctlCode, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("failed to fetch TDREPORT: %w", err)
+	}
+	return req.TDReport[:], nil
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package attestation
+
+import "errors"
+
+func isTDX() (bool, error) {
+	return false, nil
+}
+
+func fetchRawTDReport([]byte) ([]byte, error) {
+	return nil, errors.New("TDX reports are not supported on Windows")
+}
@@ -7,6 +7,9 @@ import (
 func init() {
 	typeurl.Register(&PolicyFragment{}, "github.com/Microsoft/hcsshim/pkg/ctrdtaskapi", "PolicyFragment")
 	typeurl.Register(&ContainerMount{}, "github.com/Microsoft/hcsshim/pkg/ctrdtaskapi", "ContainerMount")
+	typeurl.Register(&SignedSecurityPolicy{}, "github.com/Microsoft/hcsshim/pkg/ctrdtaskapi", "SignedSecurityPolicy")
+	typeurl.Register(&PolicyFragmentRevocation{}, "github.com/Microsoft/hcsshim/pkg/ctrdtaskapi", "PolicyFragmentRevocation")
+	typeurl.Register(&PolicyFragmentMinimumSVN{}, "github.com/Microsoft/hcsshim/pkg/ctrdtaskapi", "PolicyFragmentMinimumSVN")
 }
 
 type PolicyFragment struct {
@@ -15,6 +18,33 @@ type PolicyFragment struct {
 	// The value is a base64 encoded COSE_Sign1 document that contains the
 	// fragment and any additional information required for validation.
 	Fragment string `json:"fragment,omitempty"`
+	// Replace replaces the fragments previously loaded from the feed of the
+	// fragment, rather than adding to them.
+	Replace bool `json:"replace,omitempty"`
+}
+
+type PolicyFragmentRevocation struct {
+	// Issuer and Feed identify the policy fragment feed whose fragments are
+	// revoked, and which is no longer accepted by the UVM.
+	Issuer string `json:"issuer,omitempty"`
+	Feed   string `json:"feed,omitempty"`
+}
+
+type PolicyFragmentMinimumSVN struct {
+	// Issuer and Feed identify the policy fragment feed whose fragments must
+	// have at least MinimumSVN to be accepted by the UVM.
+	Issuer     string `json:"issuer,omitempty"`
+	Feed       string `json:"feed,omitempty"`
+	MinimumSVN string `json:"minimum_svn,omitempty"`
+}
+
+type SignedSecurityPolicy struct {
+	// Policy is used by containerd to replace the signed security policy of
+	// a UVM as part of shim task Update request. The value is a base64
+	// encoded COSE_Sign1 document that contains the policy, which must be
+	// signed by an issuer trusted by the UVM and have a higher SVN than the
+	// current policy.
+	Policy string `json:"policy,omitempty"`
 }
 
 type ContainerMount struct {
@@ -21,4 +21,14 @@ enforcement_points := {
     "load_fragment": {"introducedVersion": "0.9.0", "default_results": {"allowed": false, "add_module": false}},
     "scratch_mount": {"introducedVersion": "0.10.0", "default_results": {"allowed": true}},
     "scratch_unmount": {"introducedVersion": "0.10.0", "default_results": {"allowed": true}},
+    "replace_fragment": {"introducedVersion": "0.12.0", "default_results": {"allowed": false, "add_module": false}},
+    "revoke_fragment": {"introducedVersion": "0.12.0", "default_results": {"allowed": false, "remove_module": false}},
+    "set_fragment_minimum_svn": {"introducedVersion": "0.12.0", "default_results": {"allowed": false, "remove_module": false}},
+    "release_key": {"introducedVersion": "0.13.0", "default_results": {"allowed": false}},
+    "pause_container": {"introducedVersion": "0.14.0", "default_results": {"allowed": true}},
+    "resume_container": {"introducedVersion": "0.14.0", "default_results": {"allowed": true}},
+    "checkpoint_container": {"introducedVersion": "0.15.0", "default_results": {"allowed": false}},
+    "restore_container": {"introducedVersion": "0.15.0", "default_results": {"allowed": false}},
+    "copy_to_container": {"introducedVersion": "0.16.0", "default_results": {"allowed": false}},
+    "copy_from_container": {"introducedVersion": "0.16.0", "default_results": {"allowed": false}},
 }
@@ -0,0 +1,75 @@
+package securitypolicy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// CheckpointImageDigest returns the digest of the checkpoint image of a
+// container in dir, which a policy lists in `restore_image_digests` to allow
+// the image to be restored.
+//
+// The digest is "sha256:" followed by the SHA-256, in hex, of the path
+// relative to dir, with forward slashes, and the contents of each regular file
+// of the image in lexical order of their paths, each prefixed by its length as
+// a big endian 64-bit integer. Images with files other than directories and
+// regular files, such as symbolic links, have no digest.
+func CheckpointImageDigest(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("checkpoint image file %s is not a regular file", path)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		writeLengthPrefixed(h, []byte(filepath.ToSlash(rel)))
+		return hashFile(h, path)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to compute digest of checkpoint image %s: %w", dir, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeLengthPrefixed(h hash.Hash, b []byte) {
+	_ = binary.Write(h, binary.BigEndian, uint64(len(b)))
+	_, _ = h.Write(b)
+}
+
+// hashFile writes the length of the file and then its contents to h.
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	_ = binary.Write(h, binary.BigEndian, uint64(info.Size()))
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if n != info.Size() {
+		return fmt.Errorf("checkpoint image file %s changed while it was read", path)
+	}
+	return nil
+}
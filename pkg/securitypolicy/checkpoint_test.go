@@ -0,0 +1,62 @@
+//go:build linux && rego
+// +build linux,rego
+
+package securitypolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_CheckpointImageDigest(t *testing.T) {
+	write := func(dir, name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	image := t.TempDir()
+	write(image, "pages-1.img", "pages")
+	write(image, "inventory.img", "inventory")
+	write(image, "sub/core-1.img", "core")
+	digest, err := CheckpointImageDigest(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the digest only depends on the paths and contents of the files
+	same := t.TempDir()
+	write(same, "sub/core-1.img", "core")
+	write(same, "inventory.img", "inventory")
+	write(same, "pages-1.img", "pages")
+	if d, err := CheckpointImageDigest(same); err != nil || d != digest {
+		t.Fatalf("expected digest %s, got %s: %v", digest, d, err)
+	}
+
+	write(same, "pages-1.img", "pagez")
+	if d, err := CheckpointImageDigest(same); err != nil || d == digest {
+		t.Fatalf("expected digest of modified image to differ: %s: %v", d, err)
+	}
+
+	// moving contents between files changes the digest
+	moved := t.TempDir()
+	write(moved, "inventory.img", "inventorypages")
+	write(moved, "pages-1.img", "")
+	write(moved, "sub/core-1.img", "core")
+	if d, err := CheckpointImageDigest(moved); err != nil || d == digest {
+		t.Fatalf("expected digest of moved contents to differ: %s: %v", d, err)
+	}
+
+	if err := os.Symlink("/etc/shadow", filepath.Join(image, "link.img")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckpointImageDigest(image); err == nil {
+		t.Fatal("expected image with a symbolic link to be rejected")
+	}
+}
@@ -0,0 +1,272 @@
+//go:build rego
+// +build rego
+
+package securitypolicy
+
+import (
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown"
+)
+
+// explainCandidateVar is the name of the variable to which the framework binds
+// each candidate container from the policy while narrowing the matches.
+const explainCandidateVar = "container"
+
+// maxExplainDepth is the number of nested failed expressions reported below
+// the failed predicate of each candidate.
+const maxExplainDepth = 4
+
+// explainedCandidate is the first predicate which a candidate failed, along
+// with the failed expressions of its evaluation, outermost first.
+type explainedCandidate struct {
+	Candidate int             `json:"candidate"`
+	Command   interface{}     `json:"command,omitempty"`
+	Failed    string          `json:"failed"`
+	Detail    []explainedExpr `json:"detail,omitempty"`
+}
+
+type explainedExpr struct {
+	Expr     string                 `json:"expr"`
+	Bindings map[string]interface{} `json:"bindings,omitempty"`
+}
+
+// explainTrace summarizes, for each candidate container, the predicate which
+// it failed in the trace of a denied query. Candidates are numbered in the
+// order in which the framework considered them, which is the order of the
+// containers in the policy.
+func explainTrace(trace []*topdown.Event) []explainedCandidate {
+	parents := map[uint64]uint64{}
+	candidateQueries := map[uint64]bool{}
+	for _, event := range trace {
+		parents[event.QueryID] = event.ParentID
+		if event.Op == topdown.EvalOp && bindsCandidate(event) {
+			candidateQueries[event.QueryID] = true
+		}
+	}
+
+	order := []string{}
+	candidates := map[string]*explainedCandidate{}
+	for i, event := range trace {
+		if event.Op != topdown.FailOp || !candidateQueries[event.QueryID] {
+			continue
+		}
+
+		expr, ok := event.Node.(*ast.Expr)
+		if !ok {
+			continue
+		}
+
+		candidate := candidateValue(event)
+		if candidate == nil {
+			continue
+		}
+
+		key := candidate.String()
+		explained, ok := candidates[key]
+		if !ok {
+			explained = &explainedCandidate{Candidate: len(order)}
+			if object, ok := candidate.(ast.Object); ok {
+				if command := object.Get(ast.StringTerm("command")); command != nil {
+					explained.Command, _ = ast.JSON(command.Value)
+				}
+			}
+			order = append(order, key)
+			candidates[key] = explained
+		}
+
+		explained.Failed = exprText(expr)
+		explained.Detail = explainFailure(trace, parents, i)
+	}
+
+	summary := make([]explainedCandidate, 0, len(order))
+	for _, key := range order {
+		summary = append(summary, *candidates[key])
+	}
+	return summary
+}
+
+// bindsCandidate returns whether the event is the evaluation of the expression
+// which binds the candidate, e.g. `container := data.metadata.matches[id][_]`.
+func bindsCandidate(event *topdown.Event) bool {
+	expr, ok := event.Node.(*ast.Expr)
+	if !ok || !expr.IsEquality() {
+		return false
+	}
+
+	v, ok := expr.Operand(0).Value.(ast.Var)
+	return ok && event.LocalMetadata[v].Name == explainCandidateVar
+}
+
+// candidateValue returns the candidate bound when the event occurred.
+func candidateValue(event *topdown.Event) ast.Value {
+	for v, metadata := range event.LocalMetadata {
+		if metadata.Name == explainCandidateVar {
+			if value := event.Locals.Get(v); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// explainFailure returns the failed expressions which caused the failure at
+// trace[failed]. As the failure of an expression is traced after those of the
+// expressions it evaluated, the last failure in a query below the failed one
+// is the outermost cause of its failure.
+func explainFailure(trace []*topdown.Event, parents map[uint64]uint64, failed int) []explainedExpr {
+	start := failed
+	for start > 0 && !(trace[start].Op == topdown.EvalOp &&
+		trace[start].QueryID == trace[failed].QueryID &&
+		trace[start].Node == trace[failed].Node) {
+		start--
+	}
+
+	detail := []explainedExpr{}
+	query := trace[failed].QueryID
+	end := failed
+	previous := failed
+	for len(detail) < maxExplainDepth {
+		cause := -1
+		for i := end - 1; i > start; i-- {
+			if _, ok := trace[i].Node.(*ast.Expr); ok &&
+				trace[i].Op == topdown.FailOp &&
+				isDescendant(parents, trace[i].QueryID, query) {
+				cause = i
+				break
+			}
+		}
+
+		if cause < 0 {
+			break
+		}
+
+		// an every expression fails both in its domain and in its body
+		if trace[cause].Node != trace[previous].Node {
+			detail = append(detail, explainExpr(trace[cause]))
+		}
+		previous = cause
+		query = trace[cause].QueryID
+		end = cause
+	}
+
+	return detail
+}
+
+func isDescendant(parents map[uint64]uint64, query uint64, ancestor uint64) bool {
+	for query != ancestor {
+		parent, ok := parents[query]
+		if !ok || parent == query {
+			return false
+		}
+		query = parent
+	}
+	return true
+}
+
+// explainExpr returns the text of the failed expression, along with the values
+// of the variables which it refers to.
+func explainExpr(event *topdown.Event) explainedExpr {
+	expr := event.Node.(*ast.Expr)
+	explained := explainedExpr{Expr: exprText(expr)}
+
+	ast.WalkVars(expr, func(v ast.Var) bool {
+		metadata, ok := event.LocalMetadata[v]
+		if !ok || metadata.Name.IsGenerated() || metadata.Name.IsWildcard() {
+			return false
+		}
+
+		value := event.Locals.Get(v)
+		if value == nil {
+			return false
+		}
+
+		if explained.Bindings == nil {
+			explained.Bindings = map[string]interface{}{}
+		}
+		explained.Bindings[string(metadata.Name)], _ = ast.JSON(value)
+		return false
+	})
+
+	return explained
+}
+
+// exprText returns the first line of the source of the expression, e.g.
+// `every mount in input.mounts {` for an every expression.
+func exprText(expr *ast.Expr) string {
+	if expr.Location == nil {
+		return expr.String()
+	}
+
+	text, _, _ := strings.Cut(string(expr.Location.Text), "\n")
+	return strings.TrimSpace(text)
+}
+
+// redactExplanation redacts the environment variables of the input from the
+// bindings of the summary. Besides the variables themselves, expressions bind
+// values derived from them, e.g. the parts of `split(env, "=")`, so any string
+// which contains the value of a variable, or is part of one, is redacted too.
+func redactExplanation(summary []explainedCandidate, envList, redactedEnvList []string) {
+	r := envRedactor{redacted: map[string]string{}}
+	for i, env := range envList {
+		if i < len(redactedEnvList) {
+			r.redacted[env] = redactedEnvList[i]
+		}
+		if _, value, ok := strings.Cut(env, "="); ok && value != "" {
+			r.values = append(r.values, value)
+		}
+	}
+
+	for _, candidate := range summary {
+		for _, expr := range candidate.Detail {
+			for name, value := range expr.Bindings {
+				expr.Bindings[name] = r.redactValue(value)
+			}
+		}
+	}
+}
+
+// redactedValue replaces strings derived from the value of an environment
+// variable, matching the redacted form of the variables themselves.
+const redactedValue = "<<redacted>>"
+
+type envRedactor struct {
+	// redacted maps each variable to its redacted form.
+	redacted map[string]string
+	// values are the values of the variables.
+	values []string
+}
+
+func (r envRedactor) redactString(s string) string {
+	if redacted, ok := r.redacted[s]; ok {
+		return redacted
+	}
+	if s == "" {
+		return s
+	}
+	for _, value := range r.values {
+		if strings.Contains(s, value) || strings.Contains(value, s) {
+			return redactedValue
+		}
+	}
+	return s
+}
+
+func (r envRedactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.redactString(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactValue(v[i])
+		}
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			redacted[r.redactString(k)] = r.redactValue(item)
+		}
+		return redacted
+	}
+	return value
+}
@@ -0,0 +1,4 @@
+// Package externalenforcer contains the proto and compiled go files of the
+// PolicyEnforcer service, to which the external security policy enforcer
+// forwards the requests of the host.
+package externalenforcer
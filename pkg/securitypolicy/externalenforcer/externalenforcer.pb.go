@@ -0,0 +1,288 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.7
+// 	protoc        v5.26.0
+// source: github.com/Microsoft/hcsshim/pkg/securitypolicy/externalenforcer/externalenforcer.proto
+
+package externalenforcer
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type InitializeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// policy is the base64 encoded security policy, which is empty if the UVM
+	// has none.
+	Policy        string `protobuf:"bytes,1,opt,name=policy,proto3" json:"policy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InitializeRequest) Reset() {
+	*x = InitializeRequest{}
+	mi := &file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InitializeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InitializeRequest) ProtoMessage() {}
+
+func (x *InitializeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InitializeRequest.ProtoReflect.Descriptor instead.
+func (*InitializeRequest) Descriptor() ([]byte, []int) {
+	return file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *InitializeRequest) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+type InitializeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InitializeResponse) Reset() {
+	*x = InitializeResponse{}
+	mi := &file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InitializeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InitializeResponse) ProtoMessage() {}
+
+func (x *InitializeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InitializeResponse.ProtoReflect.Descriptor instead.
+func (*InitializeResponse) Descriptor() ([]byte, []int) {
+	return file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescGZIP(), []int{1}
+}
+
+type EnforceRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// enforcement_point is the name of the enforcement point of the policy
+	// API, e.g. "create_container".
+	EnforcementPoint string `protobuf:"bytes,1,opt,name=enforcement_point,json=enforcementPoint,proto3" json:"enforcement_point,omitempty"`
+	// input is the JSON encoded input of the enforcement point.
+	Input         []byte `protobuf:"bytes,2,opt,name=input,proto3" json:"input,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EnforceRequest) Reset() {
+	*x = EnforceRequest{}
+	mi := &file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EnforceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnforceRequest) ProtoMessage() {}
+
+func (x *EnforceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnforceRequest.ProtoReflect.Descriptor instead.
+func (*EnforceRequest) Descriptor() ([]byte, []int) {
+	return file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EnforceRequest) GetEnforcementPoint() string {
+	if x != nil {
+		return x.EnforcementPoint
+	}
+	return ""
+}
+
+func (x *EnforceRequest) GetInput() []byte {
+	if x != nil {
+		return x.Input
+	}
+	return nil
+}
+
+type EnforceResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Allowed bool                   `protobuf:"varint,1,opt,name=allowed,proto3" json:"allowed,omitempty"`
+	// reason is returned to the host when the request is denied.
+	Reason        string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EnforceResponse) Reset() {
+	*x = EnforceResponse{}
+	mi := &file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EnforceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnforceResponse) ProtoMessage() {}
+
+func (x *EnforceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnforceResponse.ProtoReflect.Descriptor instead.
+func (*EnforceResponse) Descriptor() ([]byte, []int) {
+	return file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *EnforceResponse) GetAllowed() bool {
+	if x != nil {
+		return x.Allowed
+	}
+	return false
+}
+
+func (x *EnforceResponse) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+var File_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto protoreflect.FileDescriptor
+
+const file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDesc = "" +
+	"\n" +
+	"Wgithub.com/Microsoft/hcsshim/pkg/securitypolicy/externalenforcer/externalenforcer.proto\x12\"securitypolicy.externalenforcer.v1\"+\n" +
+	"\x11InitializeRequest\x12\x16\n" +
+	"\x06policy\x18\x01 \x01(\tR\x06policy\"\x14\n" +
+	"\x12InitializeResponse\"S\n" +
+	"\x0eEnforceRequest\x12+\n" +
+	"\x11enforcement_point\x18\x01 \x01(\tR\x10enforcementPoint\x12\x14\n" +
+	"\x05input\x18\x02 \x01(\fR\x05input\"C\n" +
+	"\x0fEnforceResponse\x12\x18\n" +
+	"\aallowed\x18\x01 \x01(\bR\aallowed\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason2\x81\x02\n" +
+	"\x0ePolicyEnforcer\x12{\n" +
+	"\n" +
+	"Initialize\x125.securitypolicy.externalenforcer.v1.InitializeRequest\x1a6.securitypolicy.externalenforcer.v1.InitializeResponse\x12r\n" +
+	"\aEnforce\x122.securitypolicy.externalenforcer.v1.EnforceRequest\x1a3.securitypolicy.externalenforcer.v1.EnforceResponseBSZQgithub.com/Microsoft/hcsshim/pkg/securitypolicy/externalenforcer;externalenforcerb\x06proto3"
+
+var (
+	file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescOnce sync.Once
+	file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescData []byte
+)
+
+func file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescGZIP() []byte {
+	file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescOnce.Do(func() {
+		file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDesc), len(file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDesc)))
+	})
+	return file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDescData
+}
+
+var file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_goTypes = []any{
+	(*InitializeRequest)(nil),  // 0: securitypolicy.externalenforcer.v1.InitializeRequest
+	(*InitializeResponse)(nil), // 1: securitypolicy.externalenforcer.v1.InitializeResponse
+	(*EnforceRequest)(nil),     // 2: securitypolicy.externalenforcer.v1.EnforceRequest
+	(*EnforceResponse)(nil),    // 3: securitypolicy.externalenforcer.v1.EnforceResponse
+}
+var file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_depIdxs = []int32{
+	0, // 0: securitypolicy.externalenforcer.v1.PolicyEnforcer.Initialize:input_type -> securitypolicy.externalenforcer.v1.InitializeRequest
+	2, // 1: securitypolicy.externalenforcer.v1.PolicyEnforcer.Enforce:input_type -> securitypolicy.externalenforcer.v1.EnforceRequest
+	1, // 2: securitypolicy.externalenforcer.v1.PolicyEnforcer.Initialize:output_type -> securitypolicy.externalenforcer.v1.InitializeResponse
+	3, // 3: securitypolicy.externalenforcer.v1.PolicyEnforcer.Enforce:output_type -> securitypolicy.externalenforcer.v1.EnforceResponse
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() {
+	file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_init()
+}
+func file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_init() {
+	if File_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDesc), len(file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_goTypes,
+		DependencyIndexes: file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_depIdxs,
+		MessageInfos:      file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_msgTypes,
+	}.Build()
+	File_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto = out.File
+	file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_goTypes = nil
+	file_github_com_Microsoft_hcsshim_pkg_securitypolicy_externalenforcer_externalenforcer_proto_depIdxs = nil
+}
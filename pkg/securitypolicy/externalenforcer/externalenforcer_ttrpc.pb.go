@@ -0,0 +1,60 @@
+// Code generated by protoc-gen-go-ttrpc. DO NOT EDIT.
+// source: github.com/Microsoft/hcsshim/pkg/securitypolicy/externalenforcer/externalenforcer.proto
+package externalenforcer
+
+import (
+	context "context"
+	ttrpc "github.com/containerd/ttrpc"
+)
+
+type PolicyEnforcerService interface {
+	Initialize(context.Context, *InitializeRequest) (*InitializeResponse, error)
+	Enforce(context.Context, *EnforceRequest) (*EnforceResponse, error)
+}
+
+func RegisterPolicyEnforcerService(srv *ttrpc.Server, svc PolicyEnforcerService) {
+	srv.RegisterService("securitypolicy.externalenforcer.v1.PolicyEnforcer", &ttrpc.ServiceDesc{
+		Methods: map[string]ttrpc.Method{
+			"Initialize": func(ctx context.Context, unmarshal func(interface{}) error) (interface{}, error) {
+				var req InitializeRequest
+				if err := unmarshal(&req); err != nil {
+					return nil, err
+				}
+				return svc.Initialize(ctx, &req)
+			},
+			"Enforce": func(ctx context.Context, unmarshal func(interface{}) error) (interface{}, error) {
+				var req EnforceRequest
+				if err := unmarshal(&req); err != nil {
+					return nil, err
+				}
+				return svc.Enforce(ctx, &req)
+			},
+		},
+	})
+}
+
+type policyenforcerClient struct {
+	client *ttrpc.Client
+}
+
+func NewPolicyEnforcerClient(client *ttrpc.Client) PolicyEnforcerService {
+	return &policyenforcerClient{
+		client: client,
+	}
+}
+
+func (c *policyenforcerClient) Initialize(ctx context.Context, req *InitializeRequest) (*InitializeResponse, error) {
+	var resp InitializeResponse
+	if err := c.client.Call(ctx, "securitypolicy.externalenforcer.v1.PolicyEnforcer", "Initialize", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *policyenforcerClient) Enforce(ctx context.Context, req *EnforceRequest) (*EnforceResponse, error) {
+	var resp EnforceResponse
+	if err := c.client.Call(ctx, "securitypolicy.externalenforcer.v1.PolicyEnforcer", "Enforce", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -343,6 +343,103 @@ seccomp_ok(seccomp_profile_sha256) {
     is_windows
 }
 
+# a null list of sysctls does not constrain the sysctls of the container
+sysctls_ok(sysctls) {
+    sysctls == null
+}
+
+sysctls_ok(sysctls) {
+    sysctls != null
+    every name, value in object.get(input, "sysctls", {}) {
+        some sysctl in sysctls
+        sysctl.name == name
+        sysctl.value == value
+    }
+}
+
+# the rlimits of the policy are upper bounds. Resources which are not
+# listed are not constrained.
+rlimits_ok(rlimits) {
+    every rlimit in object.get(input, "rlimits", []) {
+        every limit in [l | some l in rlimits; l.type == rlimit.type] {
+            rlimit.hard <= limit.hard
+            rlimit.soft <= limit.soft
+        }
+    }
+}
+
+# the pattern must match the whole hostname, and an empty pattern matches any
+# hostname
+hostname_ok(hostname) {
+    hostname == ""
+}
+
+hostname_ok(hostname) {
+    hostname != ""
+    pattern := concat("", ["^(?:", hostname, ")$"])
+    regex.match(pattern, object.get(input, "hostname", ""))
+}
+
+# a null list of host namespaces does not constrain which namespaces the
+# container shares with the UVM
+hostNamespaces_ok(host_namespaces) {
+    host_namespaces == null
+}
+
+hostNamespaces_ok(host_namespaces) {
+    host_namespaces != null
+    every namespace in object.get(input, "hostNamespaces", []) {
+        namespace in host_namespaces
+    }
+}
+
+# an empty profile or label does not constrain the container
+securityLabel_ok("", name) {
+    true
+}
+
+securityLabel_ok(label, name) {
+    label != ""
+    label == object.get(input, name, "")
+}
+
+# every path listed in the policy must be masked, respectively read-only,
+# in the container. Additional paths only restrict the container further.
+paths_ok(paths, name) {
+    input_paths := object.get(input, name, [])
+    every path in paths {
+        path in input_paths
+    }
+}
+
+oomScoreAdj_ok(minimum_oom_score_adj) {
+    minimum_oom_score_adj == null
+}
+
+oomScoreAdj_ok(minimum_oom_score_adj) {
+    minimum_oom_score_adj != null
+    object.get(input, "oomScoreAdj", null) != null
+    input.oomScoreAdj >= minimum_oom_score_adj
+}
+
+isolation_ok(container) {
+    is_linux
+    sysctls_ok(container.sysctls)
+    rlimits_ok(container.rlimits)
+    hostname_ok(container.hostname)
+    hostNamespaces_ok(container.host_namespaces)
+    securityLabel_ok(container.apparmor_profile, "apparmorProfile")
+    securityLabel_ok(container.selinux_label, "selinuxLabel")
+    paths_ok(container.masked_paths, "maskedPaths")
+    paths_ok(container.readonly_paths, "readonlyPaths")
+    oomScoreAdj_ok(container.minimum_oom_score_adj)
+}
+
+isolation_ok(container) {
+    # no-op for windows
+    is_windows
+}
+
 default container_started := false
 
 container_started {
@@ -554,6 +651,7 @@ create_container := {"metadata": [updateMatches, addStarted],
         command_ok(container.command)
         mountList_ok(container.mounts, container.allow_elevated)
         seccomp_ok(container.seccomp_profile_sha256)
+        isolation_ok(container)
     ]
 
     count(possible_after_initial_containers) > 0
@@ -866,6 +964,59 @@ shutdown_container := {"started": remove, "metadata": [remove], "allowed": true}
     }
 }
 
+default pause_container := {"allowed": false}
+
+pause_container := {"allowed": true} {
+    container_started
+}
+
+default resume_container := {"allowed": false}
+
+resume_container := {"allowed": true} {
+    container_started
+}
+
+default checkpoint_container := {"allowed": false}
+
+# the image holds the memory of the container, so it must be written to an
+# encrypted device
+checkpoint_container := {"allowed": true} {
+    allow_checkpoint_restore
+    container_started
+    checkpoint_image_path_ok
+    input.imageEncrypted
+}
+
+default restore_container := {"allowed": false}
+
+# the image is read from a device which the host can modify, so only images
+# whose digest the policy lists are restored
+restore_container := {"allowed": true} {
+    allow_checkpoint_restore
+    checkpoint_image_path_ok
+    input.imageDigest in restore_image_digests
+}
+
+# the image path pattern must match the whole path of the image
+checkpoint_image_path_ok {
+    pattern := concat("", ["^(?:", checkpoint_image_path, ")$"])
+    regex.match(pattern, input.imagePath)
+}
+
+default copy_to_container := {"allowed": false}
+
+copy_to_container := {"allowed": true} {
+    allow_container_copy
+    container_started
+}
+
+default copy_from_container := {"allowed": false}
+
+copy_from_container := {"allowed": true} {
+    allow_container_copy
+    container_started
+}
+
 default signal_container_process := {"allowed": false}
 
 signal_container_process := {"metadata": [updateMatches], "allowed": true} {
@@ -1107,11 +1258,20 @@ feed_exists(iss, feed) {
     data.metadata.issuers[iss].feeds[feed]
 }
 
+# the entry recorded for a loaded fragment, which also tracks its SVN and
+# namespace so that it can be replaced or evicted later on
+loaded_fragment(includes) := fragment {
+    fragment := object.union(extract_fragment_includes(includes), {
+        "svn": data[input.namespace].svn,
+        "namespace": input.namespace,
+    })
+}
+
 update_issuer(includes) := issuer {
     feed_exists(input.issuer, input.feed)
     old_issuer := data.metadata.issuers[input.issuer]
     old_fragments := old_issuer.feeds[input.feed]
-    new_issuer := {"feeds": {input.feed: array.concat([extract_fragment_includes(includes)], old_fragments)}}
+    new_issuer := {"feeds": {input.feed: array.concat([loaded_fragment(includes)], old_fragments)}}
 
     issuer := object.union(old_issuer, new_issuer)
 }
@@ -1119,14 +1279,35 @@ update_issuer(includes) := issuer {
 update_issuer(includes) := issuer {
     not feed_exists(input.issuer, input.feed)
     old_issuer := data.metadata.issuers[input.issuer]
-    new_issuer := {"feeds": {input.feed: [extract_fragment_includes(includes)]}}
+    new_issuer := {"feeds": {input.feed: [loaded_fragment(includes)]}}
 
     issuer := object.union(old_issuer, new_issuer)
 }
 
 update_issuer(includes) := issuer {
     not issuer_exists(input.issuer)
-    issuer := {"feeds": {input.feed: [extract_fragment_includes(includes)]}}
+    issuer := {"feeds": {input.feed: [loaded_fragment(includes)]}}
+}
+
+# replaces all fragments loaded from the feed
+replace_issuer_feed(includes) := issuer {
+    old_issuer := data.metadata.issuers[input.issuer]
+    issuer := object.union(old_issuer, {"feeds": {input.feed: [loaded_fragment(includes)]}})
+}
+
+# object.union merges recursively, so the feeds are rebuilt without the
+# removed feed instead
+remove_issuer_feed(fragments) := issuer {
+    old_issuer := data.metadata.issuers[input.issuer]
+    count(fragments) == 0
+    feeds := object.remove(old_issuer.feeds, [input.feed])
+    issuer := object.union(object.remove(old_issuer, ["feeds"]), {"feeds": feeds})
+}
+
+remove_issuer_feed(fragments) := issuer {
+    old_issuer := data.metadata.issuers[input.issuer]
+    count(fragments) > 0
+    issuer := object.union(old_issuer, {"feeds": {input.feed: fragments}})
 }
 
 default candidate_fragments := []
@@ -1170,10 +1351,36 @@ svn_ok(svn, minimum_svn) {
     to_number(svn) >= to_number(minimum_svn)
 }
 
+svn_newer(svn, other_svn) {
+    semver.is_valid(svn)
+    semver.is_valid(other_svn)
+    semver.compare(svn, other_svn) > 0
+}
+
+svn_newer(svn, other_svn) {
+    to_number(svn) > to_number(other_svn)
+}
+
+feed_revoked(issuer, feed) {
+    data.metadata.fragment_feeds[issuer][feed].revoked
+}
+
+# a minimum SVN raised with set_fragment_minimum_svn applies on top of the
+# minimum_svn of the policy
+raised_svn_ok(issuer, feed, svn) {
+    not data.metadata.fragment_feeds[issuer][feed].minimum_svn
+}
+
+raised_svn_ok(issuer, feed, svn) {
+    svn_ok(svn, data.metadata.fragment_feeds[issuer][feed].minimum_svn)
+}
+
 fragment_ok(fragment) {
     input.issuer == fragment.issuer
     input.feed == fragment.feed
     svn_ok(data[input.namespace].svn, fragment.minimum_svn)
+    not feed_revoked(input.issuer, input.feed)
+    raised_svn_ok(input.issuer, input.feed, data[input.namespace].svn)
 }
 
 load_fragment := {"metadata": [updateIssuer], "add_module": add_module, "allowed": true} {
@@ -1191,6 +1398,123 @@ load_fragment := {"metadata": [updateIssuer], "add_module": add_module, "allowed
     add_module := "namespace" in fragment.includes
 }
 
+default replace_fragment := {"allowed": false}
+
+fragment_svn_newer {
+    every loaded in data.metadata.issuers[input.issuer].feeds[input.feed] {
+        svn_newer(data[input.namespace].svn, loaded.svn)
+    }
+}
+
+replace_fragment := {"metadata": [updateIssuer], "add_module": add_module, "allowed": true} {
+    feed_exists(input.issuer, input.feed)
+    some fragment in candidate_fragments
+    fragment_ok(fragment)
+    fragment_svn_newer
+
+    issuer := replace_issuer_feed(fragment.includes)
+    updateIssuer := {
+        "name": "issuers",
+        "action": "update",
+        "key": input.issuer,
+        "value": issuer,
+    }
+
+    add_module := "namespace" in fragment.includes
+}
+
+fragment_feed_known {
+    some fragment in candidate_fragments
+    fragment.issuer == input.issuer
+    fragment.feed == input.feed
+}
+
+update_feed_state(state) := feeds {
+    old_feeds := object.get(data.metadata, ["fragment_feeds", input.issuer], {})
+    old_state := object.get(old_feeds, input.feed, {})
+    feeds := object.union(old_feeds, {input.feed: object.union(old_state, state)})
+}
+
+default revoke_fragment := {"allowed": false}
+
+revoke_fragment := {"metadata": metadata, "remove_module": true, "allowed": true} {
+    fragment_feed_known
+
+    updateFeed := {
+        "name": "fragment_feeds",
+        "action": "update",
+        "key": input.issuer,
+        "value": update_feed_state({"revoked": true}),
+    }
+    removeFeed := [op |
+        feed_exists(input.issuer, input.feed)
+        op := {
+            "name": "issuers",
+            "action": "update",
+            "key": input.issuer,
+            "value": remove_issuer_feed([]),
+        }
+    ]
+
+    metadata := array.concat([updateFeed], removeFeed)
+}
+
+# the minimum SVN of a feed can only be raised
+minimum_svn_raised(fragment) {
+    svn_ok(input.minimum_svn, fragment.minimum_svn)
+    raised_svn_ok(input.issuer, input.feed, input.minimum_svn)
+}
+
+default minimum_svn_evicts_module := false
+
+# the module of a feed belongs to the fragment loaded last, which is the first
+# in the list
+minimum_svn_evicts_module {
+    loaded := data.metadata.issuers[input.issuer].feeds[input.feed]
+    not svn_ok(loaded[0].svn, input.minimum_svn)
+}
+
+default set_fragment_minimum_svn := {"allowed": false}
+
+set_fragment_minimum_svn := {"metadata": metadata, "remove_module": remove_module, "allowed": true} {
+    some fragment in candidate_fragments
+    fragment.issuer == input.issuer
+    fragment.feed == input.feed
+    minimum_svn_raised(fragment)
+
+    updateFeed := {
+        "name": "fragment_feeds",
+        "action": "update",
+        "key": input.issuer,
+        "value": update_feed_state({"minimum_svn": input.minimum_svn}),
+    }
+    evictFragments := [op |
+        loaded := data.metadata.issuers[input.issuer].feeds[input.feed]
+        kept := [f | some f in loaded; svn_ok(f.svn, input.minimum_svn)]
+        count(kept) < count(loaded)
+        op := {
+            "name": "issuers",
+            "action": "update",
+            "key": input.issuer,
+            "value": remove_issuer_feed(kept),
+        }
+    ]
+
+    metadata := array.concat([updateFeed], evictFragments)
+    remove_module := minimum_svn_evicts_module
+}
+
+loaded_fragments := [loaded |
+    some issuer, feed
+    fragment := data.metadata.issuers[issuer].feeds[feed][_]
+    loaded := {
+        "issuer": issuer,
+        "feed": feed,
+        "svn": object.get(fragment, "svn", null),
+        "namespace": object.get(fragment, "namespace", null),
+    }
+]
+
 default scratch_mount := {"allowed": false}
 
 scratch_mounted(target) {
@@ -1231,6 +1555,21 @@ scratch_unmount := {"metadata": [remove_scratch_mount], "allowed": true} {
     }
 }
 
+default release_key := {"allowed": false}
+
+release_key := {"allowed": true} {
+    some release in release_keys
+    release_key_ok(release)
+}
+
+# the target pattern of a key must match the whole target for which it is
+# released
+release_key_ok(release) {
+    release.key_id == input.keyID
+    pattern := concat("", ["^(?:", release.target, ")$"])
+    regex.match(pattern, input.target)
+}
+
 reason := {
     "errors": errors,
     "error_objects": error_objects
@@ -1261,7 +1600,7 @@ errors["container already started"] {
 }
 
 errors["container not started"] {
-    input.rule in ["exec_in_container", "shutdown_container", "signal_container_process"]
+    input.rule in ["exec_in_container", "shutdown_container", "signal_container_process", "pause_container", "resume_container", "checkpoint_container", "copy_to_container", "copy_from_container"]
     not container_started
 }
 
@@ -1525,7 +1864,7 @@ fragment_issuer_matches {
 }
 
 errors["invalid fragment issuer"] {
-    input.rule == "load_fragment"
+    input.rule in ["load_fragment", "replace_fragment"]
     not fragment_issuer_matches
 }
 
@@ -1542,7 +1881,7 @@ fragment_feed_matches {
 }
 
 errors["invalid fragment feed"] {
-    input.rule == "load_fragment"
+    input.rule in ["load_fragment", "replace_fragment"]
     fragment_issuer_matches
     not fragment_feed_matches
 }
@@ -1575,18 +1914,52 @@ svn_mismatch {
 }
 
 errors["fragment svn is below the specified minimum"] {
-    input.rule == "load_fragment"
+    input.rule in ["load_fragment", "replace_fragment"]
     fragment_feed_matches
     not svn_mismatch
     not fragment_version_is_valid
 }
 
 errors["fragment svn and the specified minimum are different types"] {
-    input.rule == "load_fragment"
+    input.rule in ["load_fragment", "replace_fragment"]
     fragment_feed_matches
     svn_mismatch
 }
 
+errors["fragment feed has been revoked"] {
+    input.rule in ["load_fragment", "replace_fragment"]
+    feed_revoked(input.issuer, input.feed)
+}
+
+errors["fragment svn is below the raised minimum"] {
+    input.rule in ["load_fragment", "replace_fragment"]
+    not raised_svn_ok(input.issuer, input.feed, data[input.namespace].svn)
+}
+
+errors["no fragment loaded from feed"] {
+    input.rule == "replace_fragment"
+    not feed_exists(input.issuer, input.feed)
+}
+
+errors["fragment svn is not newer than the loaded fragment"] {
+    input.rule == "replace_fragment"
+    feed_exists(input.issuer, input.feed)
+    not fragment_svn_newer
+}
+
+errors["unknown fragment feed"] {
+    input.rule in ["revoke_fragment", "set_fragment_minimum_svn"]
+    not fragment_feed_known
+}
+
+errors["fragment minimum svn can only be raised"] {
+    input.rule == "set_fragment_minimum_svn"
+    some fragment in candidate_fragments
+    fragment.issuer == input.issuer
+    fragment.feed == input.feed
+    not minimum_svn_raised(fragment)
+}
+
 errors["scratch already mounted at path"] {
     input.rule == "scratch_mount"
     scratch_mounted(input.target)
@@ -1603,6 +1976,39 @@ errors["no scratch at path to unmount"] {
     not scratch_mounted(input.unmountTarget)
 }
 
+errors["key release not allowed"] {
+    input.rule == "release_key"
+    not release_key.allowed
+}
+
+errors["checkpoint and restore not allowed"] {
+    input.rule in ["checkpoint_container", "restore_container"]
+    not allow_checkpoint_restore
+}
+
+errors["invalid checkpoint image path"] {
+    input.rule in ["checkpoint_container", "restore_container"]
+    allow_checkpoint_restore
+    not checkpoint_image_path_ok
+}
+
+errors["checkpoint image is not encrypted"] {
+    input.rule == "checkpoint_container"
+    allow_checkpoint_restore
+    not input.imageEncrypted
+}
+
+errors["checkpoint image digest not allowed"] {
+    input.rule == "restore_container"
+    allow_checkpoint_restore
+    not input.imageDigest in restore_image_digests
+}
+
+errors["container copy not allowed"] {
+    input.rule in ["copy_to_container", "copy_from_container"]
+    not allow_container_copy
+}
+
 errors[framework_version_error] {
     policy_framework_version == null
     framework_version_error := concat(" ", ["framework_version is missing. Current version:", version])
@@ -1642,6 +2048,7 @@ errors["containers only distinguishable by allow_stdio_access"] {
         command_ok(container.command)
         mountList_ok(container.mounts, container.allow_elevated)
         seccomp_ok(container.seccomp_profile_sha256)
+        isolation_ok(container)
     ]
 
     count(possible_after_initial_containers) > 0
@@ -1799,6 +2206,7 @@ errors["capabilities don't match"] {
         command_ok(container.command)
         mountList_ok(container.mounts, container.allow_elevated)
         seccomp_ok(container.seccomp_profile_sha256)
+        isolation_ok(container)
     ]
 
     count(possible_after_initial_containers) > 0
@@ -1916,6 +2324,132 @@ errors["invalid seccomp"] {
     not seccomp_matches
 }
 
+default sysctls_match := false
+
+sysctls_match {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    sysctls_ok(container.sysctls)
+}
+
+errors["invalid sysctls"] {
+    is_linux
+    input.rule == "create_container"
+    not sysctls_match
+}
+
+default rlimits_match := false
+
+rlimits_match {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    rlimits_ok(container.rlimits)
+}
+
+errors["invalid rlimits"] {
+    is_linux
+    input.rule == "create_container"
+    not rlimits_match
+}
+
+default hostname_matches := false
+
+hostname_matches {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    hostname_ok(container.hostname)
+}
+
+errors["invalid hostname"] {
+    is_linux
+    input.rule == "create_container"
+    not hostname_matches
+}
+
+default host_namespaces_match := false
+
+host_namespaces_match {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    hostNamespaces_ok(container.host_namespaces)
+}
+
+errors["namespaces shared with the UVM are not allowed"] {
+    is_linux
+    input.rule == "create_container"
+    not host_namespaces_match
+}
+
+default apparmor_profile_matches := false
+
+apparmor_profile_matches {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    securityLabel_ok(container.apparmor_profile, "apparmorProfile")
+}
+
+errors["invalid AppArmor profile"] {
+    is_linux
+    input.rule == "create_container"
+    not apparmor_profile_matches
+}
+
+default selinux_label_matches := false
+
+selinux_label_matches {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    securityLabel_ok(container.selinux_label, "selinuxLabel")
+}
+
+errors["invalid SELinux label"] {
+    is_linux
+    input.rule == "create_container"
+    not selinux_label_matches
+}
+
+default masked_paths_match := false
+
+masked_paths_match {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    paths_ok(container.masked_paths, "maskedPaths")
+}
+
+errors["required masked paths are missing"] {
+    is_linux
+    input.rule == "create_container"
+    not masked_paths_match
+}
+
+default readonly_paths_match := false
+
+readonly_paths_match {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    paths_ok(container.readonly_paths, "readonlyPaths")
+}
+
+errors["required read-only paths are missing"] {
+    is_linux
+    input.rule == "create_container"
+    not readonly_paths_match
+}
+
+default oom_score_adj_matches := false
+
+oom_score_adj_matches {
+    input.rule == "create_container"
+    some container in data.metadata.matches[input.containerID]
+    oomScoreAdj_ok(container.minimum_oom_score_adj)
+}
+
+errors["invalid OOM score adjustment"] {
+    is_linux
+    input.rule == "create_container"
+    not oom_score_adj_matches
+}
+
 default error_objects := null
 
 error_objects := containers {
@@ -1970,6 +2504,15 @@ check_container(raw_container, framework_version) := container {
         "user": check_user(raw_container, framework_version),
         "capabilities": check_capabilities(raw_container, framework_version),
         "seccomp_profile_sha256": check_seccomp_profile_sha256(raw_container, framework_version),
+        "sysctls": check_isolation(raw_container, framework_version, "sysctls", null),
+        "rlimits": check_isolation(raw_container, framework_version, "rlimits", []),
+        "hostname": check_isolation(raw_container, framework_version, "hostname", ""),
+        "host_namespaces": check_isolation(raw_container, framework_version, "host_namespaces", null),
+        "apparmor_profile": check_isolation(raw_container, framework_version, "apparmor_profile", ""),
+        "selinux_label": check_isolation(raw_container, framework_version, "selinux_label", ""),
+        "masked_paths": check_isolation(raw_container, framework_version, "masked_paths", []),
+        "readonly_paths": check_isolation(raw_container, framework_version, "readonly_paths", []),
+        "minimum_oom_score_adj": check_isolation(raw_container, framework_version, "minimum_oom_score_adj", null),
     }
 }
 
@@ -2029,6 +2572,18 @@ check_seccomp_profile_sha256(raw_container, framework_version) := seccomp_profil
     seccomp_profile_sha256 := ""
 }
 
+# the isolation constraints, e.g. sysctls, were all introduced in 0.5.0.
+# Older containers default to values which do not constrain the container.
+check_isolation(raw_container, framework_version, field, default_value) := value {
+    semver.compare(framework_version, "0.5.0") >= 0
+    value := raw_container[field]
+}
+
+check_isolation(raw_container, framework_version, field, default_value) := value {
+    semver.compare(framework_version, "0.5.0") < 0
+    value := default_value
+}
+
 check_signals(raw_container, framework_version) := signals {
     semver.compare(framework_version, "0.4.1") >= 0
     signals := raw_container.signals
@@ -2089,6 +2644,41 @@ allow_capability_dropping := flag {
     flag := data.policy.allow_capability_dropping
 }
 
+default release_keys := []
+
+release_keys := keys {
+    semver.compare(policy_framework_version, "0.6.0") >= 0
+    keys := data.policy.release_keys
+}
+
+default allow_checkpoint_restore := false
+
+allow_checkpoint_restore := flag {
+    semver.compare(policy_framework_version, "0.8.0") >= 0
+    flag := data.policy.allow_checkpoint_restore
+}
+
+default checkpoint_image_path := null
+
+checkpoint_image_path := pattern {
+    semver.compare(policy_framework_version, "0.8.0") >= 0
+    pattern := data.policy.checkpoint_image_path
+}
+
+default restore_image_digests := []
+
+restore_image_digests := digests {
+    semver.compare(policy_framework_version, "0.8.0") >= 0
+    digests := data.policy.restore_image_digests
+}
+
+default allow_container_copy := false
+
+allow_container_copy := flag {
+    semver.compare(policy_framework_version, "0.9.0") >= 0
+    flag := data.policy.allow_container_copy
+}
+
 default policy_framework_version := null
 default policy_api_version := null
 
@@ -20,3 +20,13 @@ runtime_logging := {"allowed": true}
 load_fragment := {"allowed": true}
 scratch_mount := {"allowed": true}
 scratch_unmount := {"allowed": true}
+replace_fragment := {"allowed": true}
+revoke_fragment := {"allowed": true}
+set_fragment_minimum_svn := {"allowed": true}
+release_key := {"allowed": true}
+pause_container := {"allowed": true}
+resume_container := {"allowed": true}
+checkpoint_container := {"allowed": true}
+restore_container := {"allowed": true}
+copy_to_container := {"allowed": true}
+copy_from_container := {"allowed": true}
@@ -23,4 +23,14 @@ runtime_logging := data.framework.runtime_logging
 load_fragment := data.framework.load_fragment
 scratch_mount := data.framework.scratch_mount
 scratch_unmount := data.framework.scratch_unmount
+replace_fragment := data.framework.replace_fragment
+revoke_fragment := data.framework.revoke_fragment
+set_fragment_minimum_svn := data.framework.set_fragment_minimum_svn
+release_key := data.framework.release_key
+pause_container := data.framework.pause_container
+resume_container := data.framework.resume_container
+checkpoint_container := data.framework.checkpoint_container
+restore_container := data.framework.restore_container
+copy_to_container := data.framework.copy_to_container
+copy_from_container := data.framework.copy_from_container
 reason := data.framework.reason
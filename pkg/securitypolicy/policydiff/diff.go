@@ -0,0 +1,522 @@
+package policydiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+// ChangeKind describes how an element of a policy changed.
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "added"
+	Removed  ChangeKind = "removed"
+	Modified ChangeKind = "modified"
+)
+
+// Change is a single semantic difference between two policies.
+type Change struct {
+	// Path identifies the changed element, e.g. `containers[0].mounts`. Indexes
+	// refer to the new policy, unless the element was removed.
+	Path string `json:"path"`
+	// Subject is a human readable name for the object the change belongs to,
+	// e.g. the command of a container.
+	Subject string      `json:"subject,omitempty"`
+	Kind    ChangeKind  `json:"kind"`
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new,omitempty"`
+	// Widening is true when the change allows something that the old policy
+	// did not allow.
+	Widening bool `json:"widening"`
+}
+
+// Report is the result of comparing two policies.
+type Report struct {
+	Changes []Change `json:"changes"`
+}
+
+// Widening returns true if any of the changes widens the policy.
+func (r *Report) Widening() bool {
+	for _, c := range r.Changes {
+		if c.Widening {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the report for humans, one change per line.
+func (r *Report) String() string {
+	if len(r.Changes) == 0 {
+		return "no changes\n"
+	}
+
+	b := &strings.Builder{}
+	widening := 0
+	for _, c := range r.Changes {
+		marker := map[ChangeKind]string{Added: "+", Removed: "-", Modified: "~"}[c.Kind]
+		fmt.Fprintf(b, "%s %s", marker, c.Path)
+		if c.Subject != "" {
+			fmt.Fprintf(b, " (%s)", c.Subject)
+		}
+		switch c.Kind {
+		case Added:
+			fmt.Fprintf(b, ": %s", canonical(c.New))
+		case Removed:
+			fmt.Fprintf(b, ": %s", canonical(c.Old))
+		case Modified:
+			fmt.Fprintf(b, ": %s -> %s", canonical(c.Old), canonical(c.New))
+		}
+		if c.Widening {
+			widening++
+			b.WriteString(" [widening]")
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(b, "%d changes, %d widening\n", len(r.Changes), widening)
+	return b.String()
+}
+
+// DiffPolicies parses and compares two policies. See Parse for the supported
+// formats.
+func DiffPolicies(oldPolicy, newPolicy []byte) (*Report, error) {
+	o, err := Parse(oldPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse old policy: %w", err)
+	}
+	n, err := Parse(newPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new policy: %w", err)
+	}
+	return Diff(o, n), nil
+}
+
+// Diff compares two policies. Elements are matched by content rather than by
+// position, so reordering is not reported.
+func Diff(oldPolicy, newPolicy *Policy) *Report {
+	d := &differ{}
+
+	d.value("api_version", "", oldPolicy.APIVersion, newPolicy.APIVersion)
+	d.value("framework_version", "", oldPolicy.FrameworkVersion, newPolicy.FrameworkVersion)
+	d.flags(oldPolicy.Flags, newPolicy.Flags)
+	d.enforcementPoints(oldPolicy.EnforcementPoints, newPolicy.EnforcementPoints)
+
+	d.objects("containers",
+		normalizeContainers(oldPolicy.Containers),
+		normalizeContainers(newPolicy.Containers),
+		containerSubject,
+		// image updates keep the command, which pairs the old and the new
+		// version of the container instead of reporting a replacement.
+		[]func(Object) string{identity("layers"), identity("image_name"), identity("command")})
+	d.objects("external_processes",
+		oldPolicy.ExternalProcesses,
+		newPolicy.ExternalProcesses,
+		commandSubject,
+		[]func(Object) string{identity("command")})
+	d.objects("fragments",
+		oldPolicy.Fragments,
+		newPolicy.Fragments,
+		fragmentSubject,
+		[]func(Object) string{identity("issuer", "feed")})
+
+	return &Report{Changes: d.changes}
+}
+
+type differ struct {
+	changes []Change
+}
+
+func (d *differ) add(c Change) {
+	d.changes = append(d.changes, c)
+}
+
+func (d *differ) value(path, subject string, o, n interface{}) {
+	if canonical(o) == canonical(n) {
+		return
+	}
+	d.add(Change{Path: path, Subject: subject, Kind: Modified, Old: o, New: n})
+}
+
+func (d *differ) flags(o, n map[string]bool) {
+	for _, name := range sortedKeys(o, n) {
+		if o[name] == n[name] {
+			continue
+		}
+		d.add(Change{
+			Path:     name,
+			Kind:     Modified,
+			Old:      o[name],
+			New:      n[name],
+			Widening: n[name],
+		})
+	}
+}
+
+// enforcementPoints reports enforcement points which switch between being
+// handled by the policy and by their default results. A default result which
+// allows the action widens the policy.
+func (d *differ) enforcementPoints(o, n map[string]EnforcementPoint) {
+	for _, name := range sortedKeys(o, n) {
+		op, oOK := o[name]
+		np, nOK := n[name]
+		if !oOK || !nOK || op.Available == np.Available {
+			continue
+		}
+		d.add(Change{
+			Path:     "enforcement_points." + name,
+			Kind:     Modified,
+			Old:      op.handler(),
+			New:      np.handler(),
+			Widening: !np.Available && np.DefaultResults["allowed"] == true,
+		})
+	}
+}
+
+func (p EnforcementPoint) handler() interface{} {
+	if p.Available {
+		return "policy"
+	}
+	return map[string]interface{}{"default_results": p.DefaultResults}
+}
+
+// objects matches the old and new objects using each of the keys in turn and
+// reports the differences of matched objects. Unmatched new objects are
+// additions, which always widen the policy.
+func (d *differ) objects(path string, o, n []Object, subject func(Object) string, keys []func(Object) string) {
+	matches := make([]int, len(n))
+	for i := range matches {
+		matches[i] = -1
+	}
+	matched := make([]bool, len(o))
+
+	for _, key := range keys {
+		for i, nObj := range n {
+			if matches[i] >= 0 {
+				continue
+			}
+			k := key(nObj)
+			if k == "" {
+				continue
+			}
+			for j, oObj := range o {
+				if !matched[j] && key(oObj) == k {
+					matches[i] = j
+					matched[j] = true
+					break
+				}
+			}
+		}
+	}
+
+	for i, nObj := range n {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		if matches[i] < 0 {
+			d.add(Change{Path: p, Subject: subject(nObj), Kind: Added, New: nObj, Widening: true})
+			continue
+		}
+		d.object(p, subject(nObj), o[matches[i]], nObj)
+	}
+
+	for j, oObj := range o {
+		if !matched[j] {
+			d.add(Change{Path: fmt.Sprintf("%s[%d]", path, j), Subject: subject(oObj), Kind: Removed, Old: oObj})
+		}
+	}
+}
+
+// orderedFields are compared as a whole, as the order of their elements is
+// significant. Replacing them changes what the container runs, which always
+// widens the policy.
+var orderedFields = map[string]bool{
+	"command": true,
+	"layers":  true,
+}
+
+// nullableFields are lists for which null, unlike an empty list, does not
+// constrain the container.
+var nullableFields = map[string]bool{
+	"sysctls":         true,
+	"host_namespaces": true,
+}
+
+func (d *differ) object(path, subject string, o, n map[string]interface{}) {
+	for _, key := range sortedKeys(o, n) {
+		ov, nv := o[key], n[key]
+		if canonical(ov) == canonical(nv) {
+			continue
+		}
+
+		p := path + "." + key
+		oList, oIsList := asList(ov)
+		nList, nIsList := asList(nv)
+		oObj, oIsObj := ov.(map[string]interface{})
+		nObj, nIsObj := nv.(map[string]interface{})
+
+		switch {
+		case orderedFields[key]:
+			d.add(Change{Path: p, Subject: subject, Kind: Modified, Old: ov, New: nv, Widening: true})
+		case nullableFields[key] && (ov == nil) != (nv == nil):
+			d.add(Change{
+				Path:     p,
+				Subject:  subject,
+				Kind:     Modified,
+				Old:      ov,
+				New:      nv,
+				Widening: valueWidens(key, ov, nv),
+			})
+		case oIsList && nIsList:
+			d.set(p, subject, key, oList, nList)
+		case oIsObj && nIsObj:
+			d.object(p, subject, oObj, nObj)
+		default:
+			d.add(Change{
+				Path:     p,
+				Subject:  subject,
+				Kind:     Modified,
+				Old:      ov,
+				New:      nv,
+				Widening: valueWidens(key, ov, nv),
+			})
+		}
+	}
+}
+
+// set reports the elements added to and removed from an unordered list. The
+// elements are grouped into one change per kind and widening.
+func (d *differ) set(path, subject, key string, o, n []interface{}) {
+	counts := map[string]int{}
+	for _, v := range o {
+		counts[canonical(v)]++
+	}
+
+	var added []interface{}
+	for _, v := range n {
+		c := canonical(v)
+		if counts[c] > 0 {
+			counts[c]--
+			continue
+		}
+		added = append(added, v)
+	}
+
+	var removed []interface{}
+	for _, v := range o {
+		c := canonical(v)
+		if counts[c] > 0 {
+			counts[c]--
+			removed = append(removed, v)
+		}
+	}
+
+	for _, kind := range []ChangeKind{Added, Removed} {
+		elements := added
+		if kind == Removed {
+			elements = removed
+		}
+
+		groups := map[bool][]interface{}{}
+		for _, v := range elements {
+			widening := elementWidens(key, v, kind == Added)
+			groups[widening] = append(groups[widening], v)
+		}
+		for _, widening := range []bool{true, false} {
+			if len(groups[widening]) == 0 {
+				continue
+			}
+			c := Change{Path: path, Subject: subject, Kind: kind, Widening: widening}
+			if kind == Added {
+				c.New = groups[widening]
+			} else {
+				c.Old = groups[widening]
+			}
+			d.add(c)
+		}
+	}
+}
+
+// elementWidens returns whether adding or removing v from the list key widens
+// the policy. Lists generally enumerate what is allowed, with the exception of
+// required environment variable rules, rlimit bounds and the paths which must
+// be masked or read-only.
+func elementWidens(key string, v interface{}, added bool) bool {
+	switch key {
+	case "env_rules":
+		rule, _ := v.(map[string]interface{})
+		required := rule["required"] == true
+		return added != required
+	case "rlimits", "masked_paths", "readonly_paths":
+		return !added
+	}
+	return added
+}
+
+// valueWidens returns whether changing a scalar value from o to n widens the
+// policy. Changes widen the policy unless they are known to narrow it, so that
+// values which are not listed here, such as the user of a container or its
+// working directory, fail closed.
+func valueWidens(key string, o, n interface{}) bool {
+	switch {
+	case strings.HasPrefix(key, "allow_"):
+		return n == true
+	case key == "no_new_privileges":
+		return n != true
+	case key == "seccomp_profile_sha256" || key == "seccomp_profile_path":
+		// only requiring a profile where none was narrows the policy
+		return o != ""
+	case key == "hostname" || key == "apparmor_profile" || key == "selinux_label":
+		// an empty value does not constrain the container
+		return o != ""
+	case key == "sysctls" || key == "host_namespaces":
+		// a null list does not constrain the container
+		return n == nil
+	case key == "minimum_oom_score_adj":
+		return n == nil || (o != nil && !numberLess(o, n))
+	case key == "minimum_svn":
+		return !svnLess(fmt.Sprint(o), fmt.Sprint(n))
+	}
+	return true
+}
+
+func numberLess(a, b interface{}) bool {
+	af, aErr := strconv.ParseFloat(fmt.Sprint(a), 64)
+	bf, bErr := strconv.ParseFloat(fmt.Sprint(b), 64)
+	return aErr == nil && bErr == nil && af < bf
+}
+
+// svnLess compares SVNs the way the framework does, either as integers or as
+// semantic versions.
+func svnLess(a, b string) bool {
+	ai, aErr := strconv.Atoi(a)
+	bi, bErr := strconv.Atoi(b)
+	if aErr == nil && bErr == nil {
+		return ai < bi
+	}
+
+	va, vb := "v"+strings.TrimPrefix(a, "v"), "v"+strings.TrimPrefix(b, "v")
+	if semver.IsValid(va) && semver.IsValid(vb) {
+		return semver.Compare(va, vb) < 0
+	}
+	// SVNs of different types cannot be ordered.
+	return false
+}
+
+// normalizeContainers resolves unset capabilities to the defaults, which the
+// framework applies when enforcing the policy.
+func normalizeContainers(containers []Object) []Object {
+	normalized := make([]Object, 0, len(containers))
+	for _, c := range containers {
+		if caps, ok := c["capabilities"]; ok && caps != nil {
+			normalized = append(normalized, c)
+			continue
+		}
+
+		defaults := securitypolicy.DefaultUnprivilegedCapabilities()
+		if c["allow_elevated"] == true {
+			defaults = securitypolicy.DefaultPrivilegedCapabilities()
+		}
+		set := make([]interface{}, 0, len(defaults))
+		for _, capability := range defaults {
+			set = append(set, capability)
+		}
+
+		nc := Object{}
+		for k, v := range c {
+			nc[k] = v
+		}
+		nc["capabilities"] = map[string]interface{}{
+			"bounding":    set,
+			"effective":   set,
+			"inheritable": []interface{}{},
+			"permitted":   set,
+			"ambient":     []interface{}{},
+		}
+		normalized = append(normalized, nc)
+	}
+	return normalized
+}
+
+// identity returns a function that identifies objects by the given fields.
+// Objects without any of the fields cannot be matched.
+func identity(fields ...string) func(Object) string {
+	return func(o Object) string {
+		values := make([]interface{}, 0, len(fields))
+		for _, f := range fields {
+			v, ok := o[f]
+			if !ok || v == nil || v == "" {
+				return ""
+			}
+			values = append(values, v)
+		}
+		return canonical(values)
+	}
+}
+
+func containerSubject(o Object) string {
+	if s := commandSubject(o); s != "" {
+		return s
+	}
+	if name, ok := o["image_name"].(string); ok {
+		return name
+	}
+	return ""
+}
+
+func commandSubject(o Object) string {
+	list, _ := asList(o["command"])
+	parts := make([]string, 0, len(list))
+	for _, v := range list {
+		parts = append(parts, fmt.Sprint(v))
+	}
+	if len(parts) == 0 {
+		if s, ok := o["command"].(string); ok {
+			return s
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func fragmentSubject(o Object) string {
+	return fmt.Sprintf("%v %v", o["issuer"], o["feed"])
+}
+
+func asList(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case []interface{}:
+		return l, true
+	case nil:
+		// a missing list is equivalent to an empty one
+		return nil, true
+	}
+	return nil, false
+}
+
+func canonical(v interface{}) string {
+	// encoding/json sorts map keys, which makes the encoding canonical.
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
+
+func sortedKeys[V any](maps ...map[string]V) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
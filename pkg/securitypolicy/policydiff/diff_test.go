@@ -0,0 +1,410 @@
+package policydiff
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+type testContainer struct {
+	command       []string
+	layers        []string
+	envRules      []securitypolicy.EnvRuleConfig
+	mounts        []securitypolicy.MountConfig
+	allowElevated bool
+	workingDir    string
+	user          *securitypolicy.UserConfig
+}
+
+func marshalTestPolicy(t *testing.T, containers []testContainer, allowPropertiesAccess bool) []byte {
+	t.Helper()
+
+	policyContainers := make([]*securitypolicy.Container, 0, len(containers))
+	for _, c := range containers {
+		workingDir := c.workingDir
+		if workingDir == "" {
+			workingDir = "/"
+		}
+		user := securitypolicy.UserConfig{
+			UserIDName:   securitypolicy.IDNameConfig{Strategy: securitypolicy.IDNameStrategyID, Rule: "0"},
+			GroupIDNames: []securitypolicy.IDNameConfig{{Strategy: securitypolicy.IDNameStrategyID, Rule: "0"}},
+			Umask:        "0022",
+		}
+		if c.user != nil {
+			user = *c.user
+		}
+		pc, err := securitypolicy.CreateContainerPolicy(
+			c.command,
+			c.layers,
+			c.envRules,
+			workingDir,
+			c.mounts,
+			c.allowElevated,
+			nil,
+			nil,
+			false,
+			true,
+			user,
+			nil,
+			"",
+		)
+		if err != nil {
+			t.Fatalf("failed to create container: %s", err)
+		}
+		policyContainers = append(policyContainers, pc)
+	}
+
+	policy, err := securitypolicy.MarshalPolicy("rego", false, policyContainers, nil, nil,
+		allowPropertiesAccess, false, false, false, false, false)
+	if err != nil {
+		t.Fatalf("failed to marshal policy: %s", err)
+	}
+	return []byte(policy)
+}
+
+var (
+	testPause = testContainer{
+		command: []string{"/pause"},
+		layers:  []string{"pause-layer"},
+	}
+	testApp = testContainer{
+		command: []string{"/app", "--serve"},
+		layers:  []string{"app-layer-0", "app-layer-1"},
+		envRules: []securitypolicy.EnvRuleConfig{
+			{Strategy: securitypolicy.EnvVarRuleString, Rule: "MODE=production", Required: true},
+			{Strategy: securitypolicy.EnvVarRuleRegex, Rule: "PATH=.*"},
+		},
+		mounts: []securitypolicy.MountConfig{
+			{HostPath: "sandbox:///data", ContainerPath: "/data", Readonly: true},
+		},
+	}
+)
+
+func Test_Diff_Reordered(t *testing.T) {
+	reordered := testApp
+	reordered.envRules = []securitypolicy.EnvRuleConfig{testApp.envRules[1], testApp.envRules[0]}
+
+	oldPolicy := marshalTestPolicy(t, []testContainer{testPause, testApp}, false)
+	newPolicy := marshalTestPolicy(t, []testContainer{reordered, testPause}, false)
+
+	report, err := DiffPolicies(oldPolicy, newPolicy)
+	if err != nil {
+		t.Fatalf("failed to diff policies: %s", err)
+	}
+	if len(report.Changes) != 0 {
+		t.Fatalf("expected no changes, got:\n%s", report)
+	}
+}
+
+func Test_Diff_Widening(t *testing.T) {
+	updated := testApp
+	updated.layers = []string{"app-layer-0", "app-layer-2"}
+	updated.allowElevated = true
+	updated.envRules = []securitypolicy.EnvRuleConfig{testApp.envRules[1]}
+	updated.mounts = append(updated.mounts, securitypolicy.MountConfig{
+		HostPath: "sandbox:///logs", ContainerPath: "/logs",
+	})
+	debug := testContainer{command: []string{"/bin/sh"}, layers: []string{"debug-layer"}}
+
+	oldPolicy := marshalTestPolicy(t, []testContainer{testPause, testApp}, false)
+	newPolicy := marshalTestPolicy(t, []testContainer{testPause, updated, debug}, true)
+
+	report, err := DiffPolicies(oldPolicy, newPolicy)
+	if err != nil {
+		t.Fatalf("failed to diff policies: %s", err)
+	}
+	if !report.Widening() {
+		t.Fatalf("expected widening changes, got:\n%s", report)
+	}
+
+	expected := map[string]bool{
+		"allow_properties_access":             true,
+		"containers[1].allow_elevated":        true,
+		"containers[1].capabilities.bounding": true,
+		"containers[1].env_rules":             true,
+		"containers[1].layers":                true,
+		"containers[1].mounts":                true,
+		"containers[2]":                       true,
+	}
+	for _, c := range report.Changes {
+		widening, ok := expected[c.Path]
+		if !ok {
+			continue
+		}
+		if c.Widening != widening {
+			t.Errorf("expected %s widening to be %t: %+v", c.Path, widening, c)
+		}
+		delete(expected, c.Path)
+	}
+	for path := range expected {
+		t.Errorf("expected change for %s, got:\n%s", path, report)
+	}
+}
+
+// Test_Diff_Unlisted_Values checks that changes of values which are not known
+// to narrow the policy, such as the user and working directory, are widening.
+func Test_Diff_Unlisted_Values(t *testing.T) {
+	updated := testApp
+	updated.workingDir = "/tmp"
+	updated.user = &securitypolicy.UserConfig{
+		UserIDName:   securitypolicy.IDNameConfig{Strategy: securitypolicy.IDNameStrategyRegex, Rule: ".*"},
+		GroupIDNames: []securitypolicy.IDNameConfig{{Strategy: securitypolicy.IDNameStrategyID, Rule: "0"}},
+		Umask:        "0000",
+	}
+
+	oldPolicy := marshalTestPolicy(t, []testContainer{testPause, testApp}, false)
+	newPolicy := marshalTestPolicy(t, []testContainer{testPause, updated}, false)
+
+	report, err := DiffPolicies(oldPolicy, newPolicy)
+	if err != nil {
+		t.Fatalf("failed to diff policies: %s", err)
+	}
+
+	expected := map[string]bool{
+		"containers[1].working_dir":               true,
+		"containers[1].user.user_idname.pattern":  true,
+		"containers[1].user.user_idname.strategy": true,
+		"containers[1].user.umask":                true,
+	}
+	for _, c := range report.Changes {
+		if !c.Widening {
+			t.Errorf("expected %s to be widening: %+v", c.Path, c)
+		}
+		delete(expected, c.Path)
+	}
+	for path := range expected {
+		t.Errorf("expected change for %s, got:\n%s", path, report)
+	}
+}
+
+func Test_Diff_Narrowing(t *testing.T) {
+	oldPolicy := marshalTestPolicy(t, []testContainer{testPause, testApp}, true)
+	newPolicy := marshalTestPolicy(t, []testContainer{testPause}, false)
+
+	report, err := DiffPolicies(oldPolicy, newPolicy)
+	if err != nil {
+		t.Fatalf("failed to diff policies: %s", err)
+	}
+	if report.Widening() {
+		t.Fatalf("expected no widening changes, got:\n%s", report)
+	}
+	if len(report.Changes) != 2 {
+		t.Fatalf("expected 2 changes, got:\n%s", report)
+	}
+}
+
+// Test_Diff_APIVersion checks that lowering the API version of a policy is
+// reported as widening, as enforcement points fall back to allowing defaults.
+func Test_Diff_APIVersion(t *testing.T) {
+	current := marshalTestPolicy(t, []testContainer{testPause}, false)
+	oldPolicy, err := Parse(current)
+	if err != nil {
+		t.Fatalf("failed to parse policy: %s", err)
+	}
+
+	downgraded := fmt.Sprintf(`package policy
+
+api_version := "0.9.0"
+framework_version := %q
+
+containers := %s
+
+allow_properties_access := false
+`, oldPolicy.FrameworkVersion, canonical(oldPolicy.Containers))
+
+	report, err := DiffPolicies(current, []byte(base64.StdEncoding.EncodeToString([]byte(downgraded))))
+	if err != nil {
+		t.Fatalf("failed to diff policies: %s", err)
+	}
+
+	expected := map[string]bool{
+		"api_version": false,
+		"enforcement_points.checkpoint_container":     false,
+		"enforcement_points.copy_from_container":      false,
+		"enforcement_points.copy_to_container":        false,
+		"enforcement_points.mount_cims":               false,
+		"enforcement_points.pause_container":          true,
+		"enforcement_points.release_key":              false,
+		"enforcement_points.replace_fragment":         false,
+		"enforcement_points.restore_container":        false,
+		"enforcement_points.resume_container":         true,
+		"enforcement_points.revoke_fragment":          false,
+		"enforcement_points.scratch_mount":            true,
+		"enforcement_points.scratch_unmount":          true,
+		"enforcement_points.set_fragment_minimum_svn": false,
+	}
+	for _, c := range report.Changes {
+		widening, ok := expected[c.Path]
+		if !ok {
+			t.Errorf("unexpected change: %+v", c)
+			continue
+		}
+		if c.Widening != widening {
+			t.Errorf("expected %s widening to be %t: %+v", c.Path, widening, c)
+		}
+	}
+	if len(report.Changes) != len(expected) {
+		t.Fatalf("expected %d changes, got:\n%s", len(expected), report)
+	}
+}
+
+// Test_Diff_FrameworkDefaults checks that containers of older framework
+// versions are compared after the framework applied its defaults.
+func Test_Diff_FrameworkDefaults(t *testing.T) {
+	old := `package policy
+
+api_version := "0.1.0"
+framework_version := "0.1.0"
+
+containers := [
+    {
+        "command": ["/pause"],
+        "env_rules": [],
+        "layers": ["pause-layer"],
+        "mounts": [],
+        "exec_processes": [],
+        "signals": [],
+        "allow_elevated": false,
+        "working_dir": "/",
+        "allow_stdio_access": false,
+    },
+]
+`
+	oldPolicy, err := Parse([]byte(old))
+	if err != nil {
+		t.Fatalf("failed to parse policy: %s", err)
+	}
+	if len(oldPolicy.Containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(oldPolicy.Containers))
+	}
+
+	c := oldPolicy.Containers[0]
+	if _, ok := c["user"]; !ok {
+		t.Fatalf("expected framework to add default user: %v", c)
+	}
+	if signals := canonical(c["signals"]); signals != "[9,15]" {
+		t.Fatalf("expected default signals, got %s", signals)
+	}
+}
+
+func Test_Diff_TOML(t *testing.T) {
+	oldConfig := `
+[[container]]
+image_name = "nginx:1.25"
+command = ["nginx"]
+
+[[container.mount]]
+host_path = "sandbox:///data"
+container_path = "/data"
+readonly = true
+
+[[fragment]]
+issuer = "did:web:contoso.com"
+feed = "contoso.azurecr.io/infra"
+minimum_svn = "2"
+include = ["containers"]
+`
+	newConfig := `
+[[fragment]]
+issuer = "did:web:contoso.com"
+feed = "contoso.azurecr.io/infra"
+minimum_svn = "1"
+include = ["containers"]
+
+[[container]]
+image_name = "nginx:1.26"
+command = ["nginx"]
+
+[container.auth]
+username = "user"
+password = "secret"
+
+[[container.mount]]
+host_path = "sandbox:///data"
+container_path = "/data"
+readonly = false
+`
+	report, err := DiffPolicies([]byte(oldConfig), []byte(newConfig))
+	if err != nil {
+		t.Fatalf("failed to diff policies: %s", err)
+	}
+
+	// the mount made writable is reported as removed and added
+	expected := map[string]bool{
+		"containers[0].image_name modified": true,
+		"containers[0].mounts added":        true,
+		"containers[0].mounts removed":      false,
+		"fragments[0].minimum_svn modified": true,
+	}
+	for _, c := range report.Changes {
+		key := fmt.Sprintf("%s %s", c.Path, c.Kind)
+		widening, ok := expected[key]
+		if !ok {
+			t.Errorf("unexpected change: %+v", c)
+			continue
+		}
+		if c.Widening != widening {
+			t.Errorf("expected %s widening to be %t: %+v", key, widening, c)
+		}
+	}
+	if len(report.Changes) != 4 {
+		t.Fatalf("expected 4 changes, got:\n%s", report)
+	}
+}
+
+func Test_Diff_Isolation(t *testing.T) {
+	oldConfig := `
+[[container]]
+image_name = "nginx:1.25"
+command = ["nginx"]
+host_namespaces = []
+masked_paths = ["/proc/kcore", "/proc/keys"]
+minimum_oom_score_adj = -500
+
+[[container.rlimit]]
+type = "RLIMIT_NOFILE"
+hard = 1024
+soft = 1024
+`
+	newConfig := `
+[[container]]
+image_name = "nginx:1.25"
+command = ["nginx"]
+allow_all_host_namespaces = true
+masked_paths = ["/proc/kcore", "/proc/timer_list"]
+minimum_oom_score_adj = -997
+`
+	report, err := DiffPolicies([]byte(oldConfig), []byte(newConfig))
+	if err != nil {
+		t.Fatalf("failed to diff policies: %s", err)
+	}
+
+	expected := map[string]bool{
+		"containers[0].host_namespaces":       true,
+		"containers[0].masked_paths":          true,
+		"containers[0].minimum_oom_score_adj": true,
+		"containers[0].rlimits":               true,
+	}
+	for _, c := range report.Changes {
+		if c.Path == "containers[0].masked_paths" && c.Kind == Added {
+			if c.Widening {
+				t.Errorf("expected additional masked paths not to widen: %+v", c)
+			}
+			continue
+		}
+		widening, ok := expected[c.Path]
+		if !ok {
+			t.Errorf("unexpected change: %+v", c)
+			continue
+		}
+		if c.Widening != widening {
+			t.Errorf("expected %s widening to be %t: %+v", c.Path, widening, c)
+		}
+		delete(expected, c.Path)
+	}
+	for path := range expected {
+		t.Errorf("expected change for %s, got:\n%s", path, report)
+	}
+}
@@ -0,0 +1,290 @@
+// Package policydiff compares security policies semantically. Policies are
+// parsed into their data objects, so that reordering elements, which the
+// policy tool does freely when generating Rego, is not reported as a change.
+package policydiff
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/pelletier/go-toml"
+
+	rpi "github.com/Microsoft/hcsshim/internal/regopolicyinterpreter"
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy"
+)
+
+const (
+	FormatRego = "rego"
+	FormatTOML = "toml"
+)
+
+// Object is a policy data object, e.g. a container, as it would be seen by
+// the framework.
+type Object map[string]interface{}
+
+// EnforcementPoint describes how the framework handles an enforcement point
+// for the API version of a policy.
+type EnforcementPoint struct {
+	// Available is true when the policy API version is recent enough for the
+	// framework to query the policy for this enforcement point. Otherwise,
+	// DefaultResults are used.
+	Available      bool   `json:"available"`
+	DefaultResults Object `json:"default_results"`
+}
+
+// Policy is the normalized form of a security policy.
+type Policy struct {
+	Format            string
+	APIVersion        string
+	FrameworkVersion  string
+	Containers        []Object
+	ExternalProcesses []Object
+	Fragments         []Object
+	// Flags contains the policy wide allow_* flags.
+	Flags map[string]bool
+	// EnforcementPoints is only populated for Rego policies.
+	EnforcementPoints map[string]EnforcementPoint
+}
+
+// Parse parses a Rego policy or a TOML policy configuration, either of which
+// may be base64 encoded.
+func Parse(data []byte) (*Policy, error) {
+	data = bytes.TrimSpace(data)
+	if decoded, err := base64.StdEncoding.DecodeString(string(data)); err == nil {
+		data = decoded
+	}
+
+	if module, err := ast.ParseModule("policy.rego", string(data)); err == nil && module != nil {
+		if module.Package.Path.String() != "data.policy" {
+			return nil, fmt.Errorf("unexpected policy package: %s", module.Package.Path)
+		}
+		return parseRego(string(data), module)
+	}
+
+	config := &securitypolicy.PolicyConfig{}
+	if err := toml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("policy is neither Rego nor TOML: %w", err)
+	}
+	return FromConfig(config)
+}
+
+// FromConfig converts a policy configuration to a Policy. As configurations
+// reference images instead of layers and are not versioned, containers are
+// identified by image name and versions are left empty.
+func FromConfig(config *securitypolicy.PolicyConfig) (*Policy, error) {
+	policy := &Policy{
+		Format: FormatTOML,
+		Flags: map[string]bool{
+			"allow_all":                           config.AllowAll,
+			"allow_properties_access":             config.AllowPropertiesAccess,
+			"allow_dump_stacks":                   config.AllowDumpStacks,
+			"allow_runtime_logging":               config.AllowRuntimeLogging,
+			"allow_environment_variable_dropping": config.AllowEnvironmentVariableDropping,
+			"allow_unencrypted_scratch":           config.AllowUnencryptedScratch,
+			"allow_capability_dropping":           config.AllowCapabilityDropping,
+		},
+	}
+
+	for _, c := range config.Containers {
+		// registry credentials are not part of the policy
+		c.Auth = securitypolicy.AuthConfig{}
+		obj, err := toObject(c)
+		if err != nil {
+			return nil, err
+		}
+		delete(obj, "auth")
+		// as in Rego, sysctls and host namespaces are only unconstrained
+		// when null
+		for key, allowAll := range map[string]string{
+			"sysctls":         "allow_all_sysctls",
+			"host_namespaces": "allow_all_host_namespaces",
+		} {
+			if obj[allowAll] == true {
+				obj[key] = nil
+			} else if obj[key] == nil {
+				obj[key] = []interface{}{}
+			}
+			delete(obj, allowAll)
+		}
+		policy.Containers = append(policy.Containers, obj)
+	}
+
+	for _, p := range config.ExternalProcesses {
+		obj, err := toObject(p)
+		if err != nil {
+			return nil, err
+		}
+		policy.ExternalProcesses = append(policy.ExternalProcesses, obj)
+	}
+
+	for _, f := range config.Fragments {
+		obj, err := toObject(f)
+		if err != nil {
+			return nil, err
+		}
+		policy.Fragments = append(policy.Fragments, obj)
+	}
+
+	return policy, nil
+}
+
+func toObject(v interface{}) (Object, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj Object
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func parseRego(code string, module *ast.Module) (*Policy, error) {
+	r, err := rpi.NewRegoPolicyInterpreter(code, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	r.AddModule("framework.rego", &rpi.RegoModule{Namespace: "framework", Code: securitypolicy.FrameworkCode})
+	r.AddModule("api.rego", &rpi.RegoModule{Namespace: "api", Code: securitypolicy.APICode})
+	if err := r.Compile(); err != nil {
+		return nil, fmt.Errorf("rego compilation failed: %w", err)
+	}
+
+	policy := &Policy{
+		Format:            FormatRego,
+		Flags:             map[string]bool{},
+		EnforcementPoints: map[string]EnforcementPoint{},
+	}
+
+	if policy.APIVersion, err = queryString(r, "data.framework.policy_api_version"); err != nil {
+		return nil, err
+	}
+	if policy.FrameworkVersion, err = queryString(r, "data.framework.policy_framework_version"); err != nil {
+		return nil, err
+	}
+
+	// The framework applies defaults to objects of older policies, which
+	// makes them comparable to the current format. Newer policies cannot be
+	// handled by the framework and are used as is, as are unversioned ones.
+	newer, err := queryValue(r, "semver.compare(data.framework.policy_framework_version, data.framework.version) > 0")
+	if err != nil {
+		return nil, err
+	}
+	prefix := "data.framework.candidate_"
+	if newer == true || policy.FrameworkVersion == "" {
+		prefix = "data.policy."
+	}
+
+	if policy.Containers, err = queryObjects(r, prefix+"containers"); err != nil {
+		return nil, err
+	}
+	if policy.ExternalProcesses, err = queryObjects(r, prefix+"external_processes"); err != nil {
+		return nil, err
+	}
+	if policy.Fragments, err = queryObjects(r, prefix+"fragments"); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range module.Rules {
+		name := rule.Head.Name.String()
+		if !strings.HasPrefix(name, "allow_") {
+			continue
+		}
+		value, err := queryValue(r, "data.policy."+name)
+		if err != nil {
+			return nil, err
+		}
+		flag, _ := value.(bool)
+		policy.Flags[name] = flag
+	}
+
+	points, err := queryValue(r, "data.api.enforcement_points")
+	if err != nil {
+		return nil, err
+	}
+	pointsObj, _ := points.(map[string]interface{})
+	names := make([]string, 0, len(pointsObj))
+	for name := range pointsObj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result, err := r.RawQuery("data.framework.enforcement_point_info", map[string]interface{}{"name": name})
+		if err != nil {
+			return nil, err
+		}
+		var info EnforcementPoint
+		if err := decodeResult(result, &info); err != nil {
+			return nil, fmt.Errorf("invalid enforcement point info for %s: %w", name, err)
+		}
+		policy.EnforcementPoints[name] = info
+	}
+
+	return policy, nil
+}
+
+func queryValue(r *rpi.RegoPolicyInterpreter, rule string) (interface{}, error) {
+	result, err := r.RawQuery(rule, nil)
+	if err != nil {
+		return nil, fmt.Errorf("query %q failed: %w", rule, err)
+	}
+	if len(result) == 0 || len(result[0].Expressions) == 0 {
+		return nil, nil
+	}
+	return result[0].Expressions[0].Value, nil
+}
+
+func queryString(r *rpi.RegoPolicyInterpreter, rule string) (string, error) {
+	value, err := queryValue(r, rule)
+	if err != nil {
+		return "", err
+	}
+	if value == nil {
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string: %v", rule, value)
+	}
+	return s, nil
+}
+
+func queryObjects(r *rpi.RegoPolicyInterpreter, rule string) ([]Object, error) {
+	result, err := r.RawQuery(rule, nil)
+	if err != nil {
+		return nil, fmt.Errorf("query %q failed: %w", rule, err)
+	}
+
+	var objects []Object
+	if err := decodeResult(result, &objects); err != nil {
+		return nil, fmt.Errorf("%s is not a list of objects: %w", rule, err)
+	}
+	return objects, nil
+}
+
+// decodeResult decodes the value of the first expression in result into v,
+// leaving v untouched for empty results.
+func decodeResult(result rego.ResultSet, v interface{}) error {
+	if len(result) == 0 || len(result[0].Expressions) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(result[0].Expressions[0].Value)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
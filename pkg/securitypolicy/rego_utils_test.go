@@ -1262,6 +1262,13 @@ func (f *regoFragment) selectContainer() *securityPolicyContainer {
 	return selectContainerFromContainerList(f.constraints.containers, testRand)
 }
 
+// codeWithSVN returns the code of the fragment with its SVN set to svn.
+func (f *regoFragment) codeWithSVN(svn string) string {
+	f.constraints.svn = svn
+	code := f.constraints.toFragment().marshalRego()
+	return setFrameworkVersion(code, frameworkVersion)
+}
+
 func mustIncrementSVN(svn string) string {
 	svn_semver, err := semver.Parse(svn)
 
@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"slices"
 	"strconv"
 	"strings"
@@ -185,6 +186,67 @@ func Test_MarshalRego_Fragment(t *testing.T) {
 	}
 }
 
+func Test_MarshalPolicy_Options(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		opts  []PolicyOption
+		lines []string
+	}{
+		{
+			name:  "ExplainDenials",
+			opts:  []PolicyOption{WithExplainDenials()},
+			lines: []string{"explain_denials := true"},
+		},
+		{
+			name: "ReleaseKeys",
+			opts: []PolicyOption{WithReleaseKeys([]ReleaseKeyConfig{
+				{KeyID: "scratch", Target: "/run/mounts/scsi/m[0-9]+"},
+			})},
+			lines: []string{
+				"release_keys := [",
+				indentUsing + "{\"key_id\": \"scratch\", \"target\": `/run/mounts/scsi/m[0-9]+`},",
+				"]",
+			},
+		},
+		{
+			name: "CheckpointRestore",
+			opts: []PolicyOption{WithCheckpointRestore("/run/checkpoints/[a-z0-9]+", []string{testCheckpointImageDigest})},
+			lines: []string{
+				"allow_checkpoint_restore := true",
+				"checkpoint_image_path := `/run/checkpoints/[a-z0-9]+`",
+				fmt.Sprintf("restore_image_digests := [%q]", testCheckpointImageDigest),
+			},
+		},
+		{
+			name:  "ContainerCopy",
+			opts:  []PolicyOption{WithContainerCopy()},
+			lines: []string{"allow_container_copy := true"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := MarshalPolicy("rego", false, nil, nil, nil, false, false, false, false, false, false, tc.opts...)
+			if err != nil {
+				t.Fatalf("unable to marshal policy: %v", err)
+			}
+			for _, line := range tc.lines {
+				if !strings.Contains(policy, "\n"+line+"\n") {
+					t.Errorf("policy does not contain %q:\n%s", line, policy)
+				}
+			}
+			if _, err := newRegoPolicy(policy, nil, nil, testOSType); err != nil {
+				t.Errorf("unable to load policy: %v", err)
+			}
+
+			if _, err := MarshalPolicy("json", false, nil, nil, nil, false, false, false, false, false, false, tc.opts...); err == nil {
+				t.Error("expected the options to be rejected by the JSON marshaller")
+			}
+			if _, err := MarshalFragment("fragment", "1", nil, nil, nil, tc.opts...); err == nil {
+				t.Error("expected the options to be rejected in a fragment")
+			}
+		})
+	}
+}
+
 // Verify that RegoSecurityPolicyEnforcer.EnforceDeviceMountPolicy will
 // return an error when there's no matching root hash in the policy
 func Test_Rego_EnforceDeviceMountPolicy_No_Matches(t *testing.T) {
@@ -2916,6 +2978,213 @@ func Test_Rego_ShutdownContainerPolicy_Not_Running_Container(t *testing.T) {
 	}
 }
 
+func Test_Rego_PauseResumeContainerPolicy_Running_Container(t *testing.T) {
+	p := generateConstraints(testRand, maxContainersInGeneratedConstraints)
+
+	tc, err := setupRegoRunningContainerTest(p, false)
+	if err != nil {
+		t.Fatalf("Unable to set up test: %v", err)
+	}
+
+	container := selectContainerFromRunningContainers(tc.runningContainers, testRand)
+
+	if err := tc.policy.EnforcePauseContainerPolicy(p.ctx, container.containerID); err != nil {
+		t.Fatalf("Expected pause of running container to be allowed, it wasn't: %v", err)
+	}
+	if err := tc.policy.EnforceResumeContainerPolicy(p.ctx, container.containerID); err != nil {
+		t.Fatalf("Expected resume of running container to be allowed, it wasn't: %v", err)
+	}
+}
+
+func Test_Rego_PauseResumeContainerPolicy_Not_Running_Container(t *testing.T) {
+	p := generateConstraints(testRand, maxContainersInGeneratedConstraints)
+
+	tc, err := setupRegoRunningContainerTest(p, false)
+	if err != nil {
+		t.Fatalf("Unable to set up test: %v", err)
+	}
+
+	notRunningContainerID := testDataGenerator.uniqueContainerID()
+
+	err = tc.policy.EnforcePauseContainerPolicy(p.ctx, notRunningContainerID)
+	if err == nil {
+		t.Fatal("Expected pause of not running container to be denied, it wasn't")
+	}
+	assertDecisionJSONContains(t, err, "container not started")
+
+	err = tc.policy.EnforceResumeContainerPolicy(p.ctx, notRunningContainerID)
+	if err == nil {
+		t.Fatal("Expected resume of not running container to be denied, it wasn't")
+	}
+	assertDecisionJSONContains(t, err, "container not started")
+}
+
+const testCheckpointImageDigest = "sha256:9f2c5c7e2b1a0d6e4f3b8a7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e"
+
+func setupRegoCheckpointRestoreTest(t *testing.T, framework string, allow bool) (*regoEnforcer, string) {
+	t.Helper()
+
+	gc := generateConstraints(testRand, 1)
+	securityPolicy := gc.toPolicy()
+	if allow {
+		securityPolicy.Options = newPolicyOptions([]PolicyOption{
+			WithCheckpointRestore("/run/checkpoints/[a-z0-9]+", []string{testCheckpointImageDigest}),
+		})
+	}
+	code := setFrameworkVersion(securityPolicy.marshalRego(), framework)
+
+	defaultMounts := generateMounts(testRand)
+	privilegedMounts := generateMounts(testRand)
+	policy, err := newRegoPolicy(code, toOCIMounts(defaultMounts), toOCIMounts(privilegedMounts), testOSType)
+	if err != nil {
+		t.Fatalf("unable to create Rego policy: %v", err)
+	}
+
+	r, err := runContainer(policy, gc.containers[0], defaultMounts, privilegedMounts, false)
+	if err != nil {
+		t.Fatalf("unable to set up running container: %v", err)
+	}
+	return policy, r.containerID
+}
+
+func Test_Rego_CheckpointRestoreContainerPolicy_Allowed(t *testing.T) {
+	policy, containerID := setupRegoCheckpointRestoreTest(t, frameworkVersion, true)
+	ctx := context.Background()
+
+	if err := policy.EnforceCheckpointContainerPolicy(ctx, containerID, "/run/checkpoints/c1", true); err != nil {
+		t.Fatalf("expected checkpoint of running container to be allowed: %v", err)
+	}
+	if err := policy.EnforceRestoreContainerPolicy(ctx, testDataGenerator.uniqueContainerID(), "/run/checkpoints/c1", testCheckpointImageDigest); err != nil {
+		t.Fatalf("expected restore of container to be allowed: %v", err)
+	}
+}
+
+func Test_Rego_CheckpointRestoreContainerPolicy_Not_Allowed(t *testing.T) {
+	policy, containerID := setupRegoCheckpointRestoreTest(t, frameworkVersion, false)
+	ctx := context.Background()
+
+	err := policy.EnforceCheckpointContainerPolicy(ctx, containerID, "/run/checkpoints/c1", true)
+	if err == nil {
+		t.Fatal("expected checkpoint to be denied")
+	}
+	assertDecisionJSONContains(t, err, "checkpoint and restore not allowed")
+
+	err = policy.EnforceRestoreContainerPolicy(ctx, testDataGenerator.uniqueContainerID(), "/run/checkpoints/c1", testCheckpointImageDigest)
+	if err == nil {
+		t.Fatal("expected restore to be denied")
+	}
+	assertDecisionJSONContains(t, err, "checkpoint and restore not allowed")
+}
+
+func Test_Rego_CheckpointContainerPolicy_Not_Running_Container(t *testing.T) {
+	policy, _ := setupRegoCheckpointRestoreTest(t, frameworkVersion, true)
+
+	err := policy.EnforceCheckpointContainerPolicy(context.Background(), testDataGenerator.uniqueContainerID(), "/run/checkpoints/c1", true)
+	if err == nil {
+		t.Fatal("expected checkpoint of not running container to be denied")
+	}
+	assertDecisionJSONContains(t, err, "container not started")
+}
+
+func Test_Rego_CheckpointContainerPolicy_Unencrypted_Image(t *testing.T) {
+	policy, containerID := setupRegoCheckpointRestoreTest(t, frameworkVersion, true)
+
+	err := policy.EnforceCheckpointContainerPolicy(context.Background(), containerID, "/run/checkpoints/c1", false)
+	if err == nil {
+		t.Fatal("expected checkpoint to an unencrypted image to be denied")
+	}
+	assertDecisionJSONContains(t, err, "checkpoint image is not encrypted")
+}
+
+func Test_Rego_CheckpointRestoreContainerPolicy_Invalid_Image_Path(t *testing.T) {
+	policy, containerID := setupRegoCheckpointRestoreTest(t, frameworkVersion, true)
+	ctx := context.Background()
+
+	// the pattern must match the whole path
+	for _, imagePath := range []string{"/run/checkpoints/c1/sub", "/tmp/run/checkpoints/c1", "/run/checkpoints"} {
+		err := policy.EnforceCheckpointContainerPolicy(ctx, containerID, imagePath, true)
+		if err == nil {
+			t.Fatalf("expected checkpoint to %s to be denied", imagePath)
+		}
+		assertDecisionJSONContains(t, err, "invalid checkpoint image path")
+
+		err = policy.EnforceRestoreContainerPolicy(ctx, testDataGenerator.uniqueContainerID(), imagePath, testCheckpointImageDigest)
+		if err == nil {
+			t.Fatalf("expected restore from %s to be denied", imagePath)
+		}
+		assertDecisionJSONContains(t, err, "invalid checkpoint image path")
+	}
+}
+
+func Test_Rego_RestoreContainerPolicy_Digest_Not_Allowed(t *testing.T) {
+	policy, _ := setupRegoCheckpointRestoreTest(t, frameworkVersion, true)
+
+	err := policy.EnforceRestoreContainerPolicy(context.Background(), testDataGenerator.uniqueContainerID(), "/run/checkpoints/c1", "sha256:"+strings.Repeat("0", 64))
+	if err == nil {
+		t.Fatal("expected restore of an unlisted image to be denied")
+	}
+	assertDecisionJSONContains(t, err, "checkpoint image digest not allowed")
+}
+
+func Test_Rego_CheckpointRestoreContainerPolicy_OldFramework(t *testing.T) {
+	// the flag is ignored by policies written for an older framework
+	policy, containerID := setupRegoCheckpointRestoreTest(t, "0.7.0", true)
+
+	if err := policy.EnforceCheckpointContainerPolicy(context.Background(), containerID, "/run/checkpoints/c1", true); err == nil {
+		t.Fatal("expected checkpoint to be denied")
+	}
+}
+
+func setupRegoContainerCopyTest(t *testing.T, opts ...PolicyOption) (*regoEnforcer, string) {
+	t.Helper()
+
+	gc := generateConstraints(testRand, 1)
+	securityPolicy := gc.toPolicy()
+	securityPolicy.Options = newPolicyOptions(opts)
+
+	defaultMounts := generateMounts(testRand)
+	privilegedMounts := generateMounts(testRand)
+	policy, err := newRegoPolicy(securityPolicy.marshalRego(), toOCIMounts(defaultMounts), toOCIMounts(privilegedMounts), testOSType)
+	if err != nil {
+		t.Fatalf("unable to create Rego policy: %v", err)
+	}
+
+	r, err := runContainer(policy, gc.containers[0], defaultMounts, privilegedMounts, false)
+	if err != nil {
+		t.Fatalf("unable to set up running container: %v", err)
+	}
+	return policy, r.containerID
+}
+
+func Test_Rego_ContainerCopyPolicy_Allowed(t *testing.T) {
+	policy, containerID := setupRegoContainerCopyTest(t, WithContainerCopy())
+	ctx := context.Background()
+
+	if err := policy.EnforceCopyToContainerPolicy(ctx, containerID, "/tmp/in"); err != nil {
+		t.Fatalf("expected copy to container to be allowed: %v", err)
+	}
+	if err := policy.EnforceCopyFromContainerPolicy(ctx, containerID, "/tmp/out"); err != nil {
+		t.Fatalf("expected copy from container to be allowed: %v", err)
+	}
+}
+
+func Test_Rego_ContainerCopyPolicy_Not_Allowed(t *testing.T) {
+	policy, containerID := setupRegoContainerCopyTest(t)
+	ctx := context.Background()
+
+	err := policy.EnforceCopyToContainerPolicy(ctx, containerID, "/tmp/in")
+	if err == nil {
+		t.Fatal("expected copy to container to be denied")
+	}
+	assertDecisionJSONContains(t, err, "container copy not allowed")
+
+	err = policy.EnforceCopyFromContainerPolicy(ctx, containerID, "/tmp/out")
+	if err == nil {
+		t.Fatal("expected copy from container to be denied")
+	}
+	assertDecisionJSONContains(t, err, "container copy not allowed")
+}
+
 func Test_Rego_SignalContainerProcessPolicy_InitProcess_Allowed(t *testing.T) {
 	f := func(p *generatedConstraints) bool {
 		hasAllowedSignals := generateConstraintsContainer(testRand, 1, maxLayersInGeneratedContainer)
@@ -4199,104 +4468,365 @@ mount_device := data.fragment.mount_device
 	}
 }
 
-func Test_Rego_Scratch_Mount_Policy(t *testing.T) {
-	for _, tc := range []struct {
-		unencryptedAllowed bool
-		encrypted          bool
-		failureExpected    bool
-	}{
-		{
-			unencryptedAllowed: false,
-			encrypted:          false,
-			failureExpected:    true,
-		},
-		{
-			unencryptedAllowed: false,
-			encrypted:          true,
-			failureExpected:    false,
-		},
-		{
-			unencryptedAllowed: true,
-			encrypted:          false,
-			failureExpected:    false,
-		},
-		{
-			unencryptedAllowed: true,
-			encrypted:          true,
-			failureExpected:    false,
-		},
-	} {
-		t.Run(fmt.Sprintf("UnencryptedAllowed_%t_And_Encrypted_%t", tc.unencryptedAllowed, tc.encrypted), func(t *testing.T) {
-			gc := generateConstraints(testRand, maxContainersInGeneratedConstraints)
-			smConfig, err := setupRegoScratchMountTest(gc, tc.unencryptedAllowed)
-			if err != nil {
-				t.Fatalf("unable to setup test: %s", err)
-			}
+func Test_Rego_ReplaceFragment(t *testing.T) {
+	f := func(p *generatedConstraints) bool {
+		tc, err := setupRegoFragmentTestConfigWithIncludes(p, []string{"containers"})
+		if err != nil {
+			t.Error(err)
+			return false
+		}
 
-			scratchPath := generateMountTarget(testRand)
-			err = smConfig.policy.EnforceScratchMountPolicy(gc.ctx, scratchPath, tc.encrypted)
-			if tc.failureExpected {
-				if err == nil {
-					t.Fatal("policy enforcement should've been denied")
-				}
-			} else {
-				if err != nil {
-					t.Fatalf("policy enforcement unexpectedly was denied: %s", err)
-				}
-			}
-		})
-	}
-}
+		fragment := tc.fragments[0]
+		err = tc.policy.LoadFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.code)
+		if err != nil {
+			t.Errorf("unable to load fragment: %v", err)
+			return false
+		}
 
-// We only test cases where scratch mount should succeed, so that we can test
-// the scratch unmount policy. The negative cases for scratch mount are covered
-// in Test_Rego_Scratch_Mount_Policy test.
-func Test_Rego_Scratch_Unmount_Policy(t *testing.T) {
-	for _, tc := range []struct {
-		unencryptedAllowed bool
-		encrypted          bool
-		failureExpected    bool
-	}{
-		{
-			unencryptedAllowed: true,
-			encrypted:          false,
-			failureExpected:    false,
-		},
-		{
-			unencryptedAllowed: true,
-			encrypted:          true,
-			failureExpected:    false,
-		},
-		{
-			unencryptedAllowed: false,
-			encrypted:          true,
-			failureExpected:    false,
-		},
-	} {
-		t.Run(fmt.Sprintf("UnencryptedAllowed_%t_And_Encrypted_%t", tc.unencryptedAllowed, tc.encrypted), func(t *testing.T) {
-			gc := generateConstraints(testRand, maxContainersInGeneratedConstraints)
-			smConfig, err := setupRegoScratchMountTest(gc, tc.unencryptedAllowed)
-			if err != nil {
-				t.Fatalf("unable to setup test: %s", err)
-			}
+		svn := mustIncrementSVN(fragment.constraints.svn)
+		err = tc.policy.ReplaceFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.codeWithSVN(svn))
+		if err != nil {
+			t.Errorf("unable to replace fragment: %v", err)
+			return false
+		}
 
-			scratchPath := generateMountTarget(testRand)
-			err = smConfig.policy.EnforceScratchMountPolicy(gc.ctx, scratchPath, tc.encrypted)
-			if err != nil {
-				t.Fatalf("scratch_mount policy enforcement unexpectedly was denied: %s", err)
-			}
+		loaded, err := tc.policy.LoadedFragments(p.ctx)
+		if err != nil {
+			t.Errorf("unable to query loaded fragments: %v", err)
+			return false
+		}
 
-			err = smConfig.policy.EnforceScratchUnmountPolicy(gc.ctx, scratchPath)
-			if err != nil {
-				t.Fatalf("scratch_unmount policy enforcement unexpectedly was denied: %s", err)
-			}
-		})
-	}
-}
+		if len(loaded) != 1 || loaded[0].SVN != svn || loaded[0].Issuer != fragment.info.issuer || loaded[0].Feed != fragment.info.feed {
+			t.Errorf("unexpected loaded fragments after replace: %+v", loaded)
+			return false
+		}
 
-func Test_Rego_StdioAccess_Allowed(t *testing.T) {
-	gc := generateConstraints(testRand, 1)
-	gc.containers[0].AllowStdioAccess = true
+		_, err = mountImageForContainer(tc.policy, tc.containers[0].container)
+		if err != nil {
+			t.Errorf("unable to mount image for replaced fragment container: %v", err)
+			return false
+		}
+
+		return true
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 15, Rand: testRand}); err != nil {
+		t.Errorf("Test_Rego_ReplaceFragment: %v", err)
+	}
+}
+
+func Test_Rego_ReplaceFragment_SVNNotNewer(t *testing.T) {
+	f := func(p *generatedConstraints) bool {
+		tc, err := setupSimpleRegoFragmentTestConfig(p)
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+
+		fragment := tc.fragments[0]
+		err = tc.policy.LoadFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.code)
+		if err != nil {
+			t.Errorf("unable to load fragment: %v", err)
+			return false
+		}
+
+		err = tc.policy.ReplaceFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.code)
+		if err == nil {
+			t.Error("expected to be unable to replace fragment with the same svn")
+			return false
+		}
+
+		return assertDecisionJSONContains(t, err, "fragment svn is not newer than the loaded fragment")
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 15, Rand: testRand}); err != nil {
+		t.Errorf("Test_Rego_ReplaceFragment_SVNNotNewer: %v", err)
+	}
+}
+
+func Test_Rego_ReplaceFragment_NotLoaded(t *testing.T) {
+	f := func(p *generatedConstraints) bool {
+		tc, err := setupSimpleRegoFragmentTestConfig(p)
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+
+		fragment := tc.fragments[0]
+		err = tc.policy.ReplaceFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.code)
+		if err == nil {
+			t.Error("expected to be unable to replace a fragment which was not loaded")
+			return false
+		}
+
+		if tc.policy.rego.IsModuleActive(rpi.ModuleID(fragment.info.issuer, fragment.info.feed)) {
+			t.Error("module not removed upon failure")
+			return false
+		}
+
+		return assertDecisionJSONContains(t, err, "no fragment loaded from feed")
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 15, Rand: testRand}); err != nil {
+		t.Errorf("Test_Rego_ReplaceFragment_NotLoaded: %v", err)
+	}
+}
+
+func Test_Rego_RevokeFragment(t *testing.T) {
+	f := func(p *generatedConstraints) bool {
+		tc, err := setupSimpleRegoFragmentTestConfig(p)
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+
+		fragment := tc.fragments[0]
+		err = tc.policy.LoadFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.code)
+		if err != nil {
+			t.Errorf("unable to load fragment: %v", err)
+			return false
+		}
+
+		err = tc.policy.RevokeFragment(p.ctx, fragment.info.issuer, fragment.info.feed)
+		if err != nil {
+			t.Errorf("unable to revoke fragment: %v", err)
+			return false
+		}
+
+		loaded, err := tc.policy.LoadedFragments(p.ctx)
+		if err != nil {
+			t.Errorf("unable to query loaded fragments: %v", err)
+			return false
+		}
+
+		if len(loaded) != 0 {
+			t.Errorf("expected no loaded fragments after revocation: %+v", loaded)
+			return false
+		}
+
+		_, err = mountImageForContainer(tc.policy, tc.containers[0].container)
+		if err == nil {
+			t.Error("able to mount image for revoked fragment container")
+			return false
+		}
+
+		err = tc.policy.LoadFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.code)
+		if err == nil {
+			t.Error("able to load fragment from revoked feed")
+			return false
+		}
+
+		return assertDecisionJSONContains(t, err, "fragment feed has been revoked")
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 15, Rand: testRand}); err != nil {
+		t.Errorf("Test_Rego_RevokeFragment: %v", err)
+	}
+}
+
+func Test_Rego_RevokeFragment_UnknownFeed(t *testing.T) {
+	f := func(p *generatedConstraints) bool {
+		tc, err := setupSimpleRegoFragmentTestConfig(p)
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+
+		feed := testDataGenerator.uniqueFragmentFeed()
+		err = tc.policy.RevokeFragment(p.ctx, tc.fragments[0].info.issuer, feed)
+		if err == nil {
+			t.Error("able to revoke unknown fragment feed")
+			return false
+		}
+
+		return assertDecisionJSONContains(t, err, "unknown fragment feed")
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 15, Rand: testRand}); err != nil {
+		t.Errorf("Test_Rego_RevokeFragment_UnknownFeed: %v", err)
+	}
+}
+
+func Test_Rego_SetFragmentMinimumSVN(t *testing.T) {
+	f := func(p *generatedConstraints) bool {
+		tc, err := setupSimpleRegoFragmentTestConfig(p)
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+
+		fragment := tc.fragments[0]
+		err = tc.policy.LoadFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.code)
+		if err != nil {
+			t.Errorf("unable to load fragment: %v", err)
+			return false
+		}
+
+		minimumSVN := mustIncrementSVN(fragment.constraints.svn)
+		err = tc.policy.SetFragmentMinimumSVN(p.ctx, fragment.info.issuer, fragment.info.feed, minimumSVN)
+		if err != nil {
+			t.Errorf("unable to set fragment minimum svn: %v", err)
+			return false
+		}
+
+		loaded, err := tc.policy.LoadedFragments(p.ctx)
+		if err != nil {
+			t.Errorf("unable to query loaded fragments: %v", err)
+			return false
+		}
+
+		if len(loaded) != 0 {
+			t.Errorf("expected fragment below the minimum svn to be unloaded: %+v", loaded)
+			return false
+		}
+
+		err = tc.policy.LoadFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.code)
+		if !assertDecisionJSONContains(t, err, "fragment svn is below the raised minimum") {
+			return false
+		}
+
+		err = tc.policy.LoadFragment(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.codeWithSVN(minimumSVN))
+		if err != nil {
+			t.Errorf("unable to load fragment at the raised minimum svn: %v", err)
+			return false
+		}
+
+		return true
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 15, Rand: testRand}); err != nil {
+		t.Errorf("Test_Rego_SetFragmentMinimumSVN: %v", err)
+	}
+}
+
+func Test_Rego_SetFragmentMinimumSVN_Lowered(t *testing.T) {
+	f := func(p *generatedConstraints) bool {
+		tc, err := setupSimpleRegoFragmentTestConfig(p)
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+
+		fragment := tc.fragments[0]
+		minimumSVN := mustIncrementSVN(fragment.info.minimumSVN)
+		err = tc.policy.SetFragmentMinimumSVN(p.ctx, fragment.info.issuer, fragment.info.feed, minimumSVN)
+		if err != nil {
+			t.Errorf("unable to set fragment minimum svn: %v", err)
+			return false
+		}
+
+		err = tc.policy.SetFragmentMinimumSVN(p.ctx, fragment.info.issuer, fragment.info.feed, fragment.info.minimumSVN)
+		if err == nil {
+			t.Error("able to lower the fragment minimum svn")
+			return false
+		}
+
+		return assertDecisionJSONContains(t, err, "fragment minimum svn can only be raised")
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 15, Rand: testRand}); err != nil {
+		t.Errorf("Test_Rego_SetFragmentMinimumSVN_Lowered: %v", err)
+	}
+}
+
+func Test_Rego_Scratch_Mount_Policy(t *testing.T) {
+	for _, tc := range []struct {
+		unencryptedAllowed bool
+		encrypted          bool
+		failureExpected    bool
+	}{
+		{
+			unencryptedAllowed: false,
+			encrypted:          false,
+			failureExpected:    true,
+		},
+		{
+			unencryptedAllowed: false,
+			encrypted:          true,
+			failureExpected:    false,
+		},
+		{
+			unencryptedAllowed: true,
+			encrypted:          false,
+			failureExpected:    false,
+		},
+		{
+			unencryptedAllowed: true,
+			encrypted:          true,
+			failureExpected:    false,
+		},
+	} {
+		t.Run(fmt.Sprintf("UnencryptedAllowed_%t_And_Encrypted_%t", tc.unencryptedAllowed, tc.encrypted), func(t *testing.T) {
+			gc := generateConstraints(testRand, maxContainersInGeneratedConstraints)
+			smConfig, err := setupRegoScratchMountTest(gc, tc.unencryptedAllowed)
+			if err != nil {
+				t.Fatalf("unable to setup test: %s", err)
+			}
+
+			scratchPath := generateMountTarget(testRand)
+			err = smConfig.policy.EnforceScratchMountPolicy(gc.ctx, scratchPath, tc.encrypted)
+			if tc.failureExpected {
+				if err == nil {
+					t.Fatal("policy enforcement should've been denied")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("policy enforcement unexpectedly was denied: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// We only test cases where scratch mount should succeed, so that we can test
+// the scratch unmount policy. The negative cases for scratch mount are covered
+// in Test_Rego_Scratch_Mount_Policy test.
+func Test_Rego_Scratch_Unmount_Policy(t *testing.T) {
+	for _, tc := range []struct {
+		unencryptedAllowed bool
+		encrypted          bool
+		failureExpected    bool
+	}{
+		{
+			unencryptedAllowed: true,
+			encrypted:          false,
+			failureExpected:    false,
+		},
+		{
+			unencryptedAllowed: true,
+			encrypted:          true,
+			failureExpected:    false,
+		},
+		{
+			unencryptedAllowed: false,
+			encrypted:          true,
+			failureExpected:    false,
+		},
+	} {
+		t.Run(fmt.Sprintf("UnencryptedAllowed_%t_And_Encrypted_%t", tc.unencryptedAllowed, tc.encrypted), func(t *testing.T) {
+			gc := generateConstraints(testRand, maxContainersInGeneratedConstraints)
+			smConfig, err := setupRegoScratchMountTest(gc, tc.unencryptedAllowed)
+			if err != nil {
+				t.Fatalf("unable to setup test: %s", err)
+			}
+
+			scratchPath := generateMountTarget(testRand)
+			err = smConfig.policy.EnforceScratchMountPolicy(gc.ctx, scratchPath, tc.encrypted)
+			if err != nil {
+				t.Fatalf("scratch_mount policy enforcement unexpectedly was denied: %s", err)
+			}
+
+			err = smConfig.policy.EnforceScratchUnmountPolicy(gc.ctx, scratchPath)
+			if err != nil {
+				t.Fatalf("scratch_unmount policy enforcement unexpectedly was denied: %s", err)
+			}
+		})
+	}
+}
+
+func Test_Rego_StdioAccess_Allowed(t *testing.T) {
+	gc := generateConstraints(testRand, 1)
+	gc.containers[0].AllowStdioAccess = true
 	gc.externalProcesses = generateExternalProcesses(testRand)
 	gc.externalProcesses[0].allowStdioAccess = true
 	tc, err := setupRegoCreateContainerTest(gc, gc.containers[0], false)
@@ -5606,6 +6136,269 @@ func Test_Rego_EnforceCreateContainerSeccompPolicy_NoMatch(t *testing.T) {
 	}
 }
 
+func Test_Rego_CreateContainer_Isolation_Default(t *testing.T) {
+	gc := generateConstraints(testRand, maxContainersInGeneratedConstraints)
+	tc, err := setupFrameworkVersionSimpleTest(gc, "0.4.1", frameworkVersion)
+	if err != nil {
+		t.Fatalf("error setting up test: %v", err)
+	}
+
+	result, err := tc.policy.rego.RawQuery("data.framework.candidate_containers", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("unable to query containers: %v", err)
+	}
+
+	containers, ok := result[0].Expressions[0].Value.([]interface{})
+	if !ok {
+		t.Fatal("unable to extract containers from result")
+	}
+
+	expected := map[string]interface{}{
+		"sysctls":               nil,
+		"rlimits":               []interface{}{},
+		"hostname":              "",
+		"host_namespaces":       nil,
+		"apparmor_profile":      "",
+		"selinux_label":         "",
+		"masked_paths":          []interface{}{},
+		"readonly_paths":        []interface{}{},
+		"minimum_oom_score_adj": nil,
+	}
+	for _, container := range containers {
+		object := container.(map[string]interface{})
+		for key, value := range expected {
+			if actual, ok := object[key]; !ok || !reflect.DeepEqual(actual, value) {
+				t.Errorf("expected default %s to be %v, got %v", key, value, actual)
+			}
+		}
+	}
+}
+
+func Test_Rego_EnforceCreateContainerIsolationPolicy(t *testing.T) {
+	minimumOOMScoreAdj := -500
+	lowOOMScoreAdj := -999
+	oomScoreAdj := 100
+
+	for _, tc := range []struct {
+		name  string
+		opts  CreateContainerOptions
+		error string
+	}{
+		{
+			name: "Allowed",
+			opts: CreateContainerOptions{
+				Sysctls:         map[string]string{"net.ipv4.ip_forward": "1"},
+				Rlimits:         []oci.POSIXRlimit{{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 512}, {Type: "RLIMIT_NPROC", Hard: 100, Soft: 100}},
+				Hostname:        "pod-0",
+				HostNamespaces:  []string{"network"},
+				AppArmorProfile: "restricted",
+				MaskedPaths:     []string{"/proc/kcore", "/proc/keys"},
+				ReadonlyPaths:   []string{"/proc/sys"},
+				OOMScoreAdj:     &oomScoreAdj,
+			},
+		},
+		{
+			name:  "Sysctl",
+			opts:  CreateContainerOptions{Sysctls: map[string]string{"kernel.shm_rmid_forced": "1"}},
+			error: "invalid sysctls",
+		},
+		{
+			name:  "SysctlValue",
+			opts:  CreateContainerOptions{Sysctls: map[string]string{"net.ipv4.ip_forward": "0"}},
+			error: "invalid sysctls",
+		},
+		{
+			name:  "Rlimit",
+			opts:  CreateContainerOptions{Rlimits: []oci.POSIXRlimit{{Type: "RLIMIT_NOFILE", Hard: 4096, Soft: 512}}},
+			error: "invalid rlimits",
+		},
+		{
+			name:  "Hostname",
+			opts:  CreateContainerOptions{Hostname: "other"},
+			error: "invalid hostname",
+		},
+		{
+			name:  "HostNamespaces",
+			opts:  CreateContainerOptions{HostNamespaces: []string{"network", "pid"}},
+			error: "namespaces shared with the UVM are not allowed",
+		},
+		{
+			name:  "AppArmorProfile",
+			opts:  CreateContainerOptions{AppArmorProfile: "unconfined"},
+			error: "invalid AppArmor profile",
+		},
+		{
+			name:  "MaskedPaths",
+			opts:  CreateContainerOptions{MaskedPaths: []string{"/proc/kcore"}},
+			error: "required masked paths are missing",
+		},
+		{
+			name:  "ReadonlyPaths",
+			opts:  CreateContainerOptions{ReadonlyPaths: []string{"/proc/bus"}},
+			error: "required read-only paths are missing",
+		},
+		{
+			name:  "OOMScoreAdj",
+			opts:  CreateContainerOptions{OOMScoreAdj: &lowOOMScoreAdj},
+			error: "invalid OOM score adjustment",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := generateConstraints(testRand, 1)
+			container := p.containers[0]
+			container.Sysctls = []SysctlConfig{{Name: "net.ipv4.ip_forward", Value: "1"}}
+			container.Rlimits = []RlimitConfig{{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 1024}}
+			container.Hostname = "^pod-[0-9]+$"
+			container.HostNamespaces = []string{"network"}
+			container.AppArmorProfile = "restricted"
+			container.MaskedPaths = []string{"/proc/kcore", "/proc/keys"}
+			container.ReadonlyPaths = []string{"/proc/sys"}
+			container.MinimumOOMScoreAdj = &minimumOOMScoreAdj
+
+			ct, err := setupSimpleRegoCreateContainerTest(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the options only set the field under test, all others are
+			// taken from the allowed options.
+			allowed := CreateContainerOptions{
+				Sysctls:         map[string]string{"net.ipv4.ip_forward": "1"},
+				Hostname:        "pod-1",
+				HostNamespaces:  []string{"network"},
+				AppArmorProfile: "restricted",
+				MaskedPaths:     []string{"/proc/kcore", "/proc/keys", "/proc/timer_list"},
+				ReadonlyPaths:   []string{"/proc/sys"},
+				OOMScoreAdj:     &oomScoreAdj,
+			}
+			opts := tc.opts
+			if opts.Sysctls == nil {
+				opts.Sysctls = allowed.Sysctls
+			}
+			if opts.Hostname == "" {
+				opts.Hostname = allowed.Hostname
+			}
+			if opts.HostNamespaces == nil {
+				opts.HostNamespaces = allowed.HostNamespaces
+			}
+			if opts.AppArmorProfile == "" {
+				opts.AppArmorProfile = allowed.AppArmorProfile
+			}
+			if opts.MaskedPaths == nil {
+				opts.MaskedPaths = allowed.MaskedPaths
+			}
+			if opts.ReadonlyPaths == nil {
+				opts.ReadonlyPaths = allowed.ReadonlyPaths
+			}
+			if opts.OOMScoreAdj == nil {
+				opts.OOMScoreAdj = allowed.OOMScoreAdj
+			}
+
+			privileged := false
+			opts.SandboxID = ct.sandboxID
+			opts.Privileged = &privileged
+			opts.NoNewPrivileges = &ct.noNewPrivileges
+			opts.Groups = ct.groups
+			opts.Umask = ct.umask
+			opts.Capabilities = ct.capabilities
+			opts.SeccompProfileSHA256 = ct.seccomp
+
+			_, _, _, err = ct.policy.EnforceCreateContainerPolicyV2(p.ctx, ct.containerID, ct.argList, ct.envList, ct.workingDir, ct.mounts, ct.user, &opts)
+			if tc.error == "" {
+				if err != nil {
+					t.Fatalf("expected container creation to be allowed: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected container creation to be denied")
+			}
+			if !assertDecisionJSONContains(t, err, tc.error) {
+				t.Fatalf("expected %q in error message", tc.error)
+			}
+		})
+	}
+}
+
+func Test_Rego_EnforceCreateContainerIsolationPolicy_Defaults(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		allowAll bool
+		hostname string
+		opts     CreateContainerOptions
+		error    string
+	}{
+		{
+			name:  "Sysctl",
+			opts:  CreateContainerOptions{Sysctls: map[string]string{"net.ipv4.ip_forward": "1"}},
+			error: "invalid sysctls",
+		},
+		{
+			name:  "HostNamespaces",
+			opts:  CreateContainerOptions{HostNamespaces: []string{"network"}},
+			error: "namespaces shared with the UVM are not allowed",
+		},
+		{
+			name:     "AllowAll",
+			allowAll: true,
+			opts: CreateContainerOptions{
+				Sysctls:        map[string]string{"net.ipv4.ip_forward": "1"},
+				HostNamespaces: []string{"network", "pid"},
+			},
+		},
+		{
+			name:     "Hostname",
+			hostname: "pod-[0-9]+",
+			opts:     CreateContainerOptions{Hostname: "pod-1"},
+		},
+		{
+			name:     "HostnameUnanchored",
+			hostname: "pod-[0-9]+",
+			opts:     CreateContainerOptions{Hostname: "evil-pod-1.example"},
+			error:    "invalid hostname",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := generateConstraints(testRand, 1)
+			container := p.containers[0]
+			container.AllowAllSysctls = tc.allowAll
+			container.AllowAllHostNamespaces = tc.allowAll
+			container.Hostname = tc.hostname
+
+			ct, err := setupSimpleRegoCreateContainerTest(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			privileged := false
+			opts := tc.opts
+			opts.SandboxID = ct.sandboxID
+			opts.Privileged = &privileged
+			opts.NoNewPrivileges = &ct.noNewPrivileges
+			opts.Groups = ct.groups
+			opts.Umask = ct.umask
+			opts.Capabilities = ct.capabilities
+			opts.SeccompProfileSHA256 = ct.seccomp
+
+			_, _, _, err = ct.policy.EnforceCreateContainerPolicyV2(p.ctx, ct.containerID, ct.argList, ct.envList, ct.workingDir, ct.mounts, ct.user, &opts)
+			if tc.error == "" {
+				if err != nil {
+					t.Fatalf("expected container creation to be allowed: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected container creation to be denied")
+			}
+			if !assertDecisionJSONContains(t, err, tc.error) {
+				t.Fatalf("expected %q in error message", tc.error)
+			}
+		})
+	}
+}
+
 func Test_Rego_FrameworkSVN(t *testing.T) {
 	gc := generateConstraints(testRand, 1)
 	securityPolicy := gc.toPolicy()
@@ -5834,6 +6627,217 @@ func Test_Rego_ErrorTruncation_CustomPolicy(t *testing.T) {
 	assertDecisionJSONContains(t, err, `"input","reason"`)
 }
 
+// setupExplainingRegoCreateContainerTest sets up a create container test with
+// a policy which opts in to explaining its denials.
+func setupExplainingRegoCreateContainerTest(t *testing.T) *regoContainerTestConfig {
+	t.Helper()
+
+	gc := generateConstraints(testRand, 1)
+	tc, err := setupSimpleRegoCreateContainerTest(gc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := gc.toPolicy()
+	policy.Options = newPolicyOptions([]PolicyOption{WithExplainDenials()})
+	if err := tc.policy.rego.SetCode(policy.marshalRego()); err != nil {
+		t.Fatalf("unable to set explaining policy: %v", err)
+	}
+
+	return tc
+}
+
+func Test_Rego_ExplainDenial_Command(t *testing.T) {
+	tc := setupExplainingRegoCreateContainerTest(t)
+
+	argList := append(tc.argList, randString(testRand, 10))
+	_, _, _, err := tc.policy.EnforceCreateContainerPolicy(tc.ctx, tc.sandboxID, tc.containerID, argList, tc.envList, tc.workingDir, tc.mounts, false, tc.noNewPrivileges, tc.user, tc.groups, tc.umask, tc.capabilities, tc.seccomp)
+	if err == nil {
+		t.Fatal("expected create container to be denied")
+	}
+
+	assertDecisionJSONContains(t, err, `"explain":[{"candidate":0`, `"failed":"command_ok(container.command)"`)
+}
+
+func Test_Rego_ExplainDenial_EnvironmentIsRedacted(t *testing.T) {
+	tc := setupExplainingRegoCreateContainerTest(t)
+
+	secret := randString(testRand, 20)
+	envList := append(tc.envList, "SECRET="+secret)
+	_, _, _, err := tc.policy.EnforceCreateContainerPolicy(tc.ctx, tc.sandboxID, tc.containerID, tc.argList, envList, tc.workingDir, tc.mounts, false, tc.noNewPrivileges, tc.user, tc.groups, tc.umask, tc.capabilities, tc.seccomp)
+	if err == nil {
+		t.Fatal("expected create container to be denied")
+	}
+
+	assertDecisionJSONContains(t, err, `"failed":"envList_ok(container.env_rules, env_list)"`, `SECRET=\u003c\u003credacted\u003e\u003e`)
+	assertDecisionJSONDoesNotContain(t, err, secret)
+}
+
+func Test_Rego_ExplainDenial_DerivedEnvironmentIsRedacted(t *testing.T) {
+	secret := randString(testRand, 20)
+	envList := []string{"PATH=/usr/bin", "SECRET=" + secret}
+	redactedEnvList := []string{"PATH=<<redacted>>", "SECRET=<<redacted>>"}
+	summary := []explainedCandidate{{
+		Failed: "envList_ok(container.env_rules, env_list)",
+		Detail: []explainedExpr{{
+			Expr: `parts := split(env, "=")`,
+			Bindings: map[string]interface{}{
+				"env":    "SECRET=" + secret,
+				"parts":  []interface{}{"SECRET", secret},
+				"prefix": secret[:10],
+				"quoted": `"` + secret + `"`,
+				"byEnv":  map[string]interface{}{secret: true},
+				"rule":   "NOT_SET",
+			},
+		}},
+	}}
+
+	redactExplanation(summary, envList, redactedEnvList)
+
+	explained, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("unable to marshal explanation: %v", err)
+	}
+	if strings.Contains(string(explained), secret[:10]) {
+		t.Fatalf("explanation contains the secret: %s", explained)
+	}
+
+	bindings := summary[0].Detail[0].Bindings
+	if bindings["env"] != "SECRET=<<redacted>>" {
+		t.Errorf("expected the variable to be redacted, got %v", bindings["env"])
+	}
+	if parts := bindings["parts"].([]interface{}); parts[0] != "SECRET" || parts[1] != redactedValue {
+		t.Errorf("expected only the value to be redacted, got %v", parts)
+	}
+	if bindings["rule"] != "NOT_SET" {
+		t.Errorf("expected unrelated bindings to be kept, got %v", bindings["rule"])
+	}
+}
+
+func Test_Rego_ExplainDenial_NotEnabled(t *testing.T) {
+	gc := generateConstraints(testRand, 1)
+	tc, err := setupSimpleRegoCreateContainerTest(gc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argList := append(tc.argList, randString(testRand, 10))
+	_, _, _, err = tc.policy.EnforceCreateContainerPolicy(tc.ctx, tc.sandboxID, tc.containerID, argList, tc.envList, tc.workingDir, tc.mounts, false, tc.noNewPrivileges, tc.user, tc.groups, tc.umask, tc.capabilities, tc.seccomp)
+	if err == nil {
+		t.Fatal("expected create container to be denied")
+	}
+
+	assertDecisionJSONDoesNotContain(t, err, `"explain"`)
+}
+
+func Test_Rego_ExplainDenial_Truncation(t *testing.T) {
+	tc := setupExplainingRegoCreateContainerTest(t)
+
+	argList := append(tc.argList, randString(testRand, 10))
+	_, _, _, err := tc.policy.EnforceCreateContainerPolicy(tc.ctx, tc.sandboxID, tc.containerID, argList, tc.envList, tc.workingDir, tc.mounts, false, tc.noNewPrivileges, tc.user, tc.groups, tc.umask, tc.capabilities, tc.seccomp)
+	if err == nil {
+		t.Fatal("expected create container to be denied")
+	}
+
+	// the explanation is the first to be truncated
+	tc.policy.maxErrorMessageLength = len(err.Error()) - 1
+	_, _, _, err = tc.policy.EnforceCreateContainerPolicy(tc.ctx, tc.sandboxID, tc.containerID, argList, tc.envList, tc.workingDir, tc.mounts, false, tc.noNewPrivileges, tc.user, tc.groups, tc.umask, tc.capabilities, tc.seccomp)
+	if err == nil {
+		t.Fatal("expected create container to be denied")
+	}
+
+	if len(err.Error()) > tc.policy.maxErrorMessageLength {
+		t.Fatalf("error message is longer than %d", tc.policy.maxErrorMessageLength)
+	}
+
+	assertDecisionJSONContains(t, err, `"truncated":["explain.detail"`)
+}
+
+func setupReleaseKeyTest(t *testing.T, framework string, keys string) *regoEnforcer {
+	t.Helper()
+
+	code := fmt.Sprintf(`package policy
+
+api_version := "%s"
+framework_version := "%s"
+
+release_keys := %s
+
+release_key := data.framework.release_key
+reason := {"errors": data.framework.errors}
+`, apiVersion, framework, keys)
+
+	policy, err := newRegoPolicy(code, []oci.Mount{}, []oci.Mount{}, testOSType)
+	if err != nil {
+		t.Fatalf("unable to create Rego policy: %v", err)
+	}
+	return policy
+}
+
+const testReleaseKeys = `[
+	{"key_id": "scratch", "target": "/run/mounts/scsi/m[0-9]+"},
+	{"key_id": "layers", "target": "/run/layers/p[0-9]+"}
+]`
+
+func Test_Rego_ReleaseKey_Allowed(t *testing.T) {
+	policy := setupReleaseKeyTest(t, frameworkVersion, testReleaseKeys)
+
+	if err := policy.EnforceReleaseKeyPolicy(context.Background(), "scratch", "/run/mounts/scsi/m1"); err != nil {
+		t.Fatalf("expected key release to be allowed: %v", err)
+	}
+}
+
+func Test_Rego_ReleaseKey_Denied(t *testing.T) {
+	policy := setupReleaseKeyTest(t, frameworkVersion, testReleaseKeys)
+
+	for _, tc := range []struct {
+		name   string
+		keyID  string
+		target string
+	}{
+		{name: "KeyID", keyID: "other", target: "/run/mounts/scsi/m1"},
+		{name: "Target", keyID: "scratch", target: "/run/layers/p1"},
+		{name: "TargetPrefix", keyID: "scratch", target: "/run/mounts/scsi/m1/../../../layers/p1"},
+		{name: "NoTarget", keyID: "scratch", target: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.EnforceReleaseKeyPolicy(context.Background(), tc.keyID, tc.target)
+			if err == nil {
+				t.Fatal("expected key release to be denied")
+			}
+			assertDecisionJSONContains(t, err, "key release not allowed")
+		})
+	}
+}
+
+func Test_Rego_ReleaseKey_MarshalPolicy(t *testing.T) {
+	keys := []ReleaseKeyConfig{{KeyID: "scratch", Target: `/run/mounts/scsi/m[0-9]+`}}
+	code, err := MarshalPolicy("rego", false, nil, nil, nil, false, false, false, false, false, false, WithReleaseKeys(keys))
+	if err != nil {
+		t.Fatalf("unable to marshal policy: %v", err)
+	}
+	policy, err := newRegoPolicy(code, []oci.Mount{}, []oci.Mount{}, testOSType)
+	if err != nil {
+		t.Fatalf("unable to create Rego policy: %v", err)
+	}
+
+	if err := policy.EnforceReleaseKeyPolicy(context.Background(), "scratch", "/run/mounts/scsi/m1"); err != nil {
+		t.Fatalf("expected key release to be allowed: %v", err)
+	}
+	if err := policy.EnforceReleaseKeyPolicy(context.Background(), "scratch", "/run/layers/p1"); err == nil {
+		t.Fatal("expected key release to be denied")
+	}
+}
+
+func Test_Rego_ReleaseKey_OldFramework(t *testing.T) {
+	// keys are ignored by policies written for an older framework
+	policy := setupReleaseKeyTest(t, "0.5.0", testReleaseKeys)
+
+	if err := policy.EnforceReleaseKeyPolicy(context.Background(), "scratch", "/run/mounts/scsi/m1"); err == nil {
+		t.Fatal("expected key release to be denied")
+	}
+}
+
 func Test_Rego_Missing_Enforcement_Point(t *testing.T) {
 	code := `package policy
 
@@ -6338,3 +7342,75 @@ func substituteUVMPath(sandboxID string, m mountInternal) mountInternal {
 	}
 	return m
 }
+
+// benchmarkPolicySizes are the numbers of containers in the generated policies
+// which framework.rego enforces in the benchmarks.
+var benchmarkPolicySizes = []int{10, 100, 250}
+
+// generateBenchmarkConstraints generates a policy of `size` containers.
+func generateBenchmarkConstraints(size int) *generatedConstraints {
+	gc := generateConstraints(testRand, 1)
+	gc.containers = make([]*securityPolicyContainer, 0, size)
+	for i := 0; i < size; i++ {
+		gc.containers = append(gc.containers, generateConstraintsContainer(testRand, 1, maxLayersInGeneratedContainer))
+	}
+	return gc
+}
+
+func Benchmark_Rego_CreateContainerPolicy(b *testing.B) {
+	for _, size := range benchmarkPolicySizes {
+		b.Run(fmt.Sprintf("containers=%d", size), func(b *testing.B) {
+			gc := generateBenchmarkConstraints(size)
+			c := selectContainerFromContainerList(gc.containers, testRand)
+			tc, err := setupRegoCreateContainerTest(gc, c, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// each container is created once, from an overlay of its own
+				b.StopTimer()
+				containerID := tc.containerID
+				if i > 0 {
+					if containerID, err = mountImageForContainer(tc.policy, c); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StartTimer()
+
+				_, _, _, err := tc.policy.EnforceCreateContainerPolicy(tc.ctx, tc.sandboxID, containerID, tc.argList, tc.envList, tc.workingDir, tc.mounts, false, tc.noNewPrivileges, tc.user, tc.groups, tc.umask, tc.capabilities, tc.seccomp)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Benchmark_Rego_ExecInContainerPolicy(b *testing.B) {
+	for _, size := range benchmarkPolicySizes {
+		b.Run(fmt.Sprintf("containers=%d", size), func(b *testing.B) {
+			gc := generateBenchmarkConstraints(size)
+			tc, err := setupRegoRunningContainerTest(gc, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			container := selectContainerFromRunningContainers(tc.runningContainers, testRand)
+			capabilities := container.container.Capabilities.toExternal()
+			process := selectExecProcess(container.container.ExecProcesses, testRand)
+			envList := buildEnvironmentVariablesFromEnvRules(container.container.EnvRules, testRand)
+			user := buildIDNameFromConfig(container.container.User.UserIDName, testRand)
+			groups := buildGroupIDNamesFromUser(container.container.User, testRand)
+			umask := container.container.User.Umask
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _, _, err := tc.policy.EnforceExecInContainerPolicy(gc.ctx, container.containerID, process.Command, envList, container.container.WorkingDir, container.container.NoNewPrivileges, user, groups, umask, &capabilities)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -51,6 +51,7 @@ const (
 	PolicyFilename             = "security-policy-base64"
 	HostAMDCertFilename        = "host-amd-cert-base64"
 	ReferenceInfoFilename      = "reference-info-base64"
+	SignedPolicyFilename       = "signed-security-policy-base64"
 )
 
 // PolicyConfig contains toml or JSON config for security policy.
@@ -67,6 +68,25 @@ type PolicyConfig struct {
 	// all containers within a pod to be run without scratch encryption.
 	AllowUnencryptedScratch bool `json:"allow_unencrypted_scratch" toml:"allow_unencrypted_scratch"`
 	AllowCapabilityDropping bool `json:"allow_capability_dropping" toml:"allow_capability_dropping"`
+	// ExplainDenials makes the policy opt in to explaining its denials, by
+	// adding the failed predicate of each candidate to the policy decision.
+	ExplainDenials bool `json:"explain_denials" toml:"explain_denials"`
+	// ReleaseKeys are the keys which the guest may request from the key
+	// broker, e.g. to open persistent encrypted scratch disks.
+	ReleaseKeys []ReleaseKeyConfig `json:"release_keys" toml:"release_key"`
+	// AllowCheckpointRestore allows containers to be checkpointed to, and
+	// restored from, images which the host can read and write.
+	AllowCheckpointRestore bool `json:"allow_checkpoint_restore" toml:"allow_checkpoint_restore"`
+	// CheckpointImagePath is a regular expression which must match the whole
+	// path in the UVM of the images which containers are checkpointed to and
+	// restored from.
+	CheckpointImagePath string `json:"checkpoint_image_path" toml:"checkpoint_image_path"`
+	// RestoreImageDigests are the digests of the checkpoint images which
+	// containers may be restored from, see CheckpointImageDigest.
+	RestoreImageDigests []string `json:"restore_image_digests" toml:"restore_image_digests"`
+	// AllowContainerCopy allows files to be copied into and out of running
+	// containers by the host.
+	AllowContainerCopy bool `json:"allow_container_copy" toml:"allow_container_copy"`
 }
 
 func NewPolicyConfig(opts ...PolicyConfigOpt) (*PolicyConfig, error) {
@@ -79,6 +99,25 @@ func NewPolicyConfig(opts ...PolicyConfigOpt) (*PolicyConfig, error) {
 	return p, nil
 }
 
+// PolicyOptions returns the options to pass to MarshalPolicy for the settings
+// of the config which are written only when set.
+func (c *PolicyConfig) PolicyOptions() []PolicyOption {
+	var opts []PolicyOption
+	if c.ExplainDenials {
+		opts = append(opts, WithExplainDenials())
+	}
+	if len(c.ReleaseKeys) > 0 {
+		opts = append(opts, WithReleaseKeys(c.ReleaseKeys))
+	}
+	if c.AllowCheckpointRestore {
+		opts = append(opts, WithCheckpointRestore(c.CheckpointImagePath, c.RestoreImageDigests))
+	}
+	if c.AllowContainerCopy {
+		opts = append(opts, WithContainerCopy())
+	}
+	return opts
+}
+
 // ExternalProcessConfig contains toml or JSON config for running external processes in the UVM.
 type ExternalProcessConfig struct {
 	Command          []string `json:"command" toml:"command"`
@@ -94,6 +133,14 @@ type FragmentConfig struct {
 	Includes   []string `json:"includes" toml:"include"`
 }
 
+// ReleaseKeyConfig is a key which the guest may request from the key broker,
+// along with a regular expression which must match the whole mount target
+// for which it is requested.
+type ReleaseKeyConfig struct {
+	KeyID  string `json:"key_id" toml:"key_id"`
+	Target string `json:"target" toml:"target"`
+}
+
 // AuthConfig contains toml or JSON config for registry authentication.
 type AuthConfig struct {
 	Username string `json:"username" toml:"username"`
@@ -172,6 +219,29 @@ type ContainerConfig struct {
 	User                     *UserConfig         `json:"user" toml:"user"`
 	Capabilities             *CapabilitiesConfig `json:"capabilities" toml:"capabilities"`
 	SeccompProfilePath       string              `json:"seccomp_profile_path" toml:"seccomp_profile_path"`
+	// Sysctls that the container may set. Other sysctls are denied, unless
+	// AllowAllSysctls is set.
+	Sysctls         []SysctlConfig `json:"sysctls" toml:"sysctl"`
+	AllowAllSysctls bool           `json:"allow_all_sysctls" toml:"allow_all_sysctls"`
+	// Rlimits are upper bounds for the rlimits of the container.
+	Rlimits []RlimitConfig `json:"rlimits" toml:"rlimit"`
+	// Hostname is a regular expression the hostname of the container must
+	// match. An empty pattern matches any hostname.
+	Hostname string `json:"hostname" toml:"hostname"`
+	// HostNamespaces lists the namespaces, e.g. "network", which the container
+	// may share with the UVM. Other namespaces must not be shared, unless
+	// AllowAllHostNamespaces is set.
+	HostNamespaces         []string `json:"host_namespaces" toml:"host_namespaces"`
+	AllowAllHostNamespaces bool     `json:"allow_all_host_namespaces" toml:"allow_all_host_namespaces"`
+	AppArmorProfile        string   `json:"apparmor_profile" toml:"apparmor_profile"`
+	SELinuxLabel           string   `json:"selinux_label" toml:"selinux_label"`
+	// MaskedPaths and ReadonlyPaths must be masked, respectively read-only,
+	// in the container.
+	MaskedPaths   []string `json:"masked_paths" toml:"masked_paths"`
+	ReadonlyPaths []string `json:"readonly_paths" toml:"readonly_paths"`
+	// MinimumOOMScoreAdj is the lowest OOM score adjustment the container may
+	// request. If nil, the OOM score adjustment is not constrained.
+	MinimumOOMScoreAdj *int `json:"minimum_oom_score_adj" toml:"minimum_oom_score_adj"`
 }
 
 // MountConfig contains toml or JSON config for mount security policy
@@ -189,6 +259,21 @@ type ExecProcessConfig struct {
 	Signals []syscall.Signal `json:"signals" toml:"signals"`
 }
 
+// SysctlConfig contains toml or JSON config for a sysctl which the container
+// is allowed to set.
+type SysctlConfig struct {
+	Name  string `json:"name" toml:"name"`
+	Value string `json:"value" toml:"value"`
+}
+
+// RlimitConfig contains toml or JSON config for the upper bounds of an rlimit,
+// e.g. RLIMIT_NOFILE.
+type RlimitConfig struct {
+	Type string `json:"type" toml:"type"`
+	Hard uint64 `json:"hard" toml:"hard"`
+	Soft uint64 `json:"soft" toml:"soft"`
+}
+
 type WindowsExecProcessConfig struct {
 	Command string                         `json:"command" toml:"command"`
 	Signals []guestrequest.SignalValueWCOW `json:"signals" toml:"signals"`
@@ -233,12 +318,19 @@ func NewOpenDoorPolicy() *SecurityPolicy {
 }
 
 // NewSecurityPolicyDigest decodes base64 encoded policy string, computes
-// and returns sha256 digest
+// and returns sha256 digest. For a signed policy, the digest is that of the
+// issuers trusted to sign it.
 func NewSecurityPolicyDigest(base64policy string) ([]byte, error) {
 	jsonPolicy, err := base64.StdEncoding.DecodeString(base64policy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode base64 security policy: %w", err)
 	}
+	if signed, ok := parseSignedSecurityPolicy(jsonPolicy); ok {
+		jsonPolicy, err = base64.StdEncoding.DecodeString(signed.Issuers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 policy issuers: %w", err)
+		}
+	}
 	digest := sha256.New()
 	digest.Write(jsonPolicy)
 	digestBytes := digest.Sum(nil)
@@ -285,19 +377,30 @@ type WindowsContainers struct {
 }
 
 type Container struct {
-	Command              CommandArgs         `json:"command"`
-	EnvRules             EnvRules            `json:"env_rules"`
-	Layers               Layers              `json:"layers"`
-	WorkingDir           string              `json:"working_dir"`
-	Mounts               Mounts              `json:"mounts"`
-	AllowElevated        bool                `json:"allow_elevated"`
-	ExecProcesses        []ExecProcessConfig `json:"-"`
-	Signals              []syscall.Signal    `json:"-"`
-	AllowStdioAccess     bool                `json:"-"`
-	NoNewPrivileges      bool                `json:"-"`
-	User                 UserConfig          `json:"-"`
-	Capabilities         *CapabilitiesConfig `json:"-"`
-	SeccompProfileSHA256 string              `json:"-"`
+	Command                CommandArgs         `json:"command"`
+	EnvRules               EnvRules            `json:"env_rules"`
+	Layers                 Layers              `json:"layers"`
+	WorkingDir             string              `json:"working_dir"`
+	Mounts                 Mounts              `json:"mounts"`
+	AllowElevated          bool                `json:"allow_elevated"`
+	ExecProcesses          []ExecProcessConfig `json:"-"`
+	Signals                []syscall.Signal    `json:"-"`
+	AllowStdioAccess       bool                `json:"-"`
+	NoNewPrivileges        bool                `json:"-"`
+	User                   UserConfig          `json:"-"`
+	Capabilities           *CapabilitiesConfig `json:"-"`
+	SeccompProfileSHA256   string              `json:"-"`
+	Sysctls                []SysctlConfig      `json:"-"`
+	AllowAllSysctls        bool                `json:"-"`
+	Rlimits                []RlimitConfig      `json:"-"`
+	Hostname               string              `json:"-"`
+	HostNamespaces         []string            `json:"-"`
+	AllowAllHostNamespaces bool                `json:"-"`
+	AppArmorProfile        string              `json:"-"`
+	SELinuxLabel           string              `json:"-"`
+	MaskedPaths            []string            `json:"-"`
+	ReadonlyPaths          []string            `json:"-"`
+	MinimumOOMScoreAdj     *int                `json:"-"`
 }
 
 type WindowsContainer struct {
@@ -379,6 +482,32 @@ func CreateContainerPolicy(
 	}, nil
 }
 
+// SetIsolationConstraints sets the constraints on the isolation of the
+// container, e.g. sysctls and namespaces, from the container config.
+func (c *Container) SetIsolationConstraints(config *ContainerConfig) error {
+	if _, err := regexp.Compile(config.Hostname); err != nil {
+		return fmt.Errorf("invalid hostname pattern: %w", err)
+	}
+	for _, ns := range config.HostNamespaces {
+		if !isValidNamespaceType(ns) {
+			return fmt.Errorf("invalid host namespace: %q", ns)
+		}
+	}
+
+	c.Sysctls = config.Sysctls
+	c.AllowAllSysctls = config.AllowAllSysctls
+	c.Rlimits = config.Rlimits
+	c.Hostname = config.Hostname
+	c.HostNamespaces = config.HostNamespaces
+	c.AllowAllHostNamespaces = config.AllowAllHostNamespaces
+	c.AppArmorProfile = config.AppArmorProfile
+	c.SELinuxLabel = config.SELinuxLabel
+	c.MaskedPaths = config.MaskedPaths
+	c.ReadonlyPaths = config.ReadonlyPaths
+	c.MinimumOOMScoreAdj = config.MinimumOOMScoreAdj
+	return nil
+}
+
 // NewSecurityPolicy creates a new SecurityPolicy from the provided values.
 func NewSecurityPolicy(allowAll bool, containers []*Container) *SecurityPolicy {
 	containersMap := map[string]Container{}
@@ -579,3 +708,25 @@ func DefaultPrivilegedCapabilities() []string {
 		"CAP_CHECKPOINT_RESTORE",
 	}
 }
+
+// IsolatedNamespaceTypes are the namespaces which are checked against the
+// host namespaces of a container policy. A container which does not have its
+// own namespace of one of these types shares it with the UVM.
+func IsolatedNamespaceTypes() []specs.LinuxNamespaceType {
+	return []specs.LinuxNamespaceType{
+		specs.PIDNamespace,
+		specs.NetworkNamespace,
+		specs.IPCNamespace,
+		specs.UTSNamespace,
+		specs.MountNamespace,
+	}
+}
+
+func isValidNamespaceType(ns string) bool {
+	for _, t := range IsolatedNamespaceTypes() {
+		if string(t) == ns {
+			return true
+		}
+	}
+	return false
+}
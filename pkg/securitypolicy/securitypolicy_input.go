@@ -0,0 +1,92 @@
+package securitypolicy
+
+import (
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// The helpers below convert the arguments of the enforcer into the input of
+// the enforcement points, which is shared by the enforcers that decide upon
+// the same input as the policy.
+
+type inputData map[string]interface{}
+
+func (idName IDName) toInput() interface{} {
+	return map[string]interface{}{
+		"id":   idName.ID,
+		"name": idName.Name,
+	}
+}
+
+func groupsToInputs(groups []IDName) []interface{} {
+	inputs := []interface{}{}
+	for _, group := range groups {
+		inputs = append(inputs, group.toInput())
+	}
+	return inputs
+}
+
+func handleNilOrEmptyCaps(caps []string) interface{} {
+	if len(caps) > 0 {
+		result := make([]interface{}, len(caps))
+		for i, cap := range caps {
+			result[i] = cap
+		}
+
+		return result
+	}
+
+	// caps is either nil or empty.
+	// In either case, we want to return an empty array.
+	return make([]interface{}, 0)
+}
+
+func mapifyCapabilities(caps *oci.LinuxCapabilities) map[string]interface{} {
+	out := make(map[string]interface{})
+
+	out["bounding"] = handleNilOrEmptyCaps(caps.Bounding)
+	out["effective"] = handleNilOrEmptyCaps(caps.Effective)
+	out["inheritable"] = handleNilOrEmptyCaps(caps.Inheritable)
+	out["permitted"] = handleNilOrEmptyCaps(caps.Permitted)
+	out["ambient"] = handleNilOrEmptyCaps(caps.Ambient)
+	return out
+}
+
+func sysctlsToInput(sysctls map[string]string) inputData {
+	input := inputData{}
+	for name, value := range sysctls {
+		input[name] = value
+	}
+	return input
+}
+
+func rlimitsToInput(rlimits []oci.POSIXRlimit) []interface{} {
+	input := []interface{}{}
+	for _, rlimit := range rlimits {
+		input = append(input, inputData{
+			"type": rlimit.Type,
+			"hard": rlimit.Hard,
+			"soft": rlimit.Soft,
+		})
+	}
+	return input
+}
+
+func stringsToInput(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func appendMountData(mountData []interface{}, mounts []oci.Mount) []interface{} {
+	for _, mount := range mounts {
+		mountData = append(mountData, inputData{
+			"destination": mount.Destination,
+			"source":      mount.Source,
+			"options":     mount.Options,
+			"type":        mount.Type,
+		})
+	}
+
+	return mountData
+}
@@ -19,6 +19,7 @@ type securityPolicyInternal struct {
 	AllowEnvironmentVariableDropping bool
 	AllowUnencryptedScratch          bool
 	AllowCapabilityDropping          bool
+	Options                          PolicyOptions
 }
 
 // Internal version of Windows SecurityPolicy
@@ -171,6 +172,28 @@ type securityPolicyContainer struct {
 	Capabilities *capabilitiesInternal `json:"capabilities"`
 	// Seccomp configuration for the container
 	SeccompProfileSHA256 string `json:"seccomp_profile_sha256"`
+	// Sysctls the container is allowed to set, which are not constrained if
+	// AllowAllSysctls is set
+	Sysctls         []SysctlConfig `json:"sysctls"`
+	AllowAllSysctls bool           `json:"-"`
+	// Upper bounds for the rlimits of the container
+	Rlimits []RlimitConfig `json:"rlimits"`
+	// Pattern for the hostname of the container
+	Hostname string `json:"hostname"`
+	// Namespaces the container may share with the UVM, which are not
+	// constrained if AllowAllHostNamespaces is set
+	HostNamespaces         []string `json:"host_namespaces"`
+	AllowAllHostNamespaces bool     `json:"-"`
+	// AppArmor profile and SELinux label of the container, which are not
+	// constrained if empty
+	AppArmorProfile string `json:"apparmor_profile"`
+	SELinuxLabel    string `json:"selinux_label"`
+	// Paths which must be masked, respectively read-only, in the container
+	MaskedPaths   []string `json:"masked_paths"`
+	ReadonlyPaths []string `json:"readonly_paths"`
+	// The lowest OOM score adjustment the container may request, or nil if
+	// not constrained
+	MinimumOOMScoreAdj *int `json:"minimum_oom_score_adj"`
 }
 
 // Internal version of Container
@@ -279,16 +302,27 @@ func (c *Container) toInternal() (*securityPolicyContainer, error) {
 		Layers:   layers,
 		// No need to have toInternal(), because WorkingDir is a string both
 		// internally and in the policy.
-		WorkingDir:           c.WorkingDir,
-		Mounts:               mounts,
-		AllowElevated:        c.AllowElevated,
-		ExecProcesses:        execProcesses,
-		Signals:              c.Signals,
-		AllowStdioAccess:     c.AllowStdioAccess,
-		NoNewPrivileges:      c.NoNewPrivileges,
-		User:                 c.User,
-		Capabilities:         capabilities,
-		SeccompProfileSHA256: c.SeccompProfileSHA256,
+		WorkingDir:             c.WorkingDir,
+		Mounts:                 mounts,
+		AllowElevated:          c.AllowElevated,
+		ExecProcesses:          execProcesses,
+		Signals:                c.Signals,
+		AllowStdioAccess:       c.AllowStdioAccess,
+		NoNewPrivileges:        c.NoNewPrivileges,
+		User:                   c.User,
+		Capabilities:           capabilities,
+		SeccompProfileSHA256:   c.SeccompProfileSHA256,
+		Sysctls:                c.Sysctls,
+		AllowAllSysctls:        c.AllowAllSysctls,
+		Rlimits:                c.Rlimits,
+		Hostname:               c.Hostname,
+		HostNamespaces:         c.HostNamespaces,
+		AllowAllHostNamespaces: c.AllowAllHostNamespaces,
+		AppArmorProfile:        c.AppArmorProfile,
+		SELinuxLabel:           c.SELinuxLabel,
+		MaskedPaths:            c.MaskedPaths,
+		ReadonlyPaths:          c.ReadonlyPaths,
+		MinimumOOMScoreAdj:     c.MinimumOOMScoreAdj,
 	}, nil
 
 }
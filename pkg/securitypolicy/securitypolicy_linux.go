@@ -209,3 +209,50 @@ func GetAllUserInfo(process *oci.Process, rootPath string) (
 
 	return userIDName, groupIDNames, umask, nil
 }
+
+// procNamespaceNames maps namespace types to their names in /proc/<pid>/ns.
+var procNamespaceNames = map[oci.LinuxNamespaceType]string{
+	oci.PIDNamespace:     "pid",
+	oci.NetworkNamespace: "net",
+	oci.IPCNamespace:     "ipc",
+	oci.UTSNamespace:     "uts",
+	oci.MountNamespace:   "mnt",
+}
+
+// HostNamespaces returns the namespaces which the container described by spec
+// would share with the UVM, either because the spec has no entry for them, or
+// because the entry joins the namespace of the current process.
+func HostNamespaces(spec *oci.Spec) ([]string, error) {
+	namespaces := map[oci.LinuxNamespaceType]oci.LinuxNamespace{}
+	if spec.Linux != nil {
+		for _, ns := range spec.Linux.Namespaces {
+			namespaces[ns.Type] = ns
+		}
+	}
+
+	hostNamespaces := []string{}
+	for _, t := range IsolatedNamespaceTypes() {
+		ns, ok := namespaces[t]
+		if !ok {
+			hostNamespaces = append(hostNamespaces, string(t))
+			continue
+		}
+		if ns.Path == "" {
+			continue
+		}
+
+		target, err := os.Stat(ns.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s namespace %s: %w", t, ns.Path, err)
+		}
+		own, err := os.Stat(filepath.Join("/proc/self/ns", procNamespaceNames[t]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat own %s namespace: %w", t, err)
+		}
+		if os.SameFile(target, own) {
+			hostNamespaces = append(hostNamespaces, string(t))
+		}
+	}
+
+	return hostNamespaces, nil
+}
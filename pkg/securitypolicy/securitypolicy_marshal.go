@@ -53,6 +53,90 @@ func (c *WindowsContainer) ToInternalContainer() (interface{}, error) {
 	return c.toInternal()
 }
 
+// PolicyOptions holds the policy-wide settings which are only written to a
+// policy when set. They can only be represented in a Linux Rego policy.
+type PolicyOptions struct {
+	ExplainDenials bool
+	ReleaseKeys    []ReleaseKeyConfig
+	// CheckpointRestore allows containers to be checkpointed to, and
+	// restored from, the images at CheckpointImagePath. Only the images in
+	// RestoreImageDigests may be restored from.
+	CheckpointRestore   bool
+	CheckpointImagePath string
+	RestoreImageDigests []string
+	ContainerCopy       bool
+}
+
+// PolicyOption sets one of the PolicyOptions passed to MarshalPolicy.
+type PolicyOption func(*PolicyOptions)
+
+// WithExplainDenials makes the policy explain which rule denied a request.
+func WithExplainDenials() PolicyOption {
+	return func(o *PolicyOptions) {
+		o.ExplainDenials = true
+	}
+}
+
+// WithReleaseKeys adds keys which the guest may request from the key broker.
+func WithReleaseKeys(keys []ReleaseKeyConfig) PolicyOption {
+	return func(o *PolicyOptions) {
+		o.ReleaseKeys = append(o.ReleaseKeys, keys...)
+	}
+}
+
+// WithCheckpointRestore allows containers to be checkpointed to images whose
+// paths match `imagePath`, and to be restored from those with `digests`.
+func WithCheckpointRestore(imagePath string, digests []string) PolicyOption {
+	return func(o *PolicyOptions) {
+		o.CheckpointRestore = true
+		o.CheckpointImagePath = imagePath
+		o.RestoreImageDigests = append(o.RestoreImageDigests, digests...)
+	}
+}
+
+// WithContainerCopy allows the host to copy files into and out of running
+// containers.
+func WithContainerCopy() PolicyOption {
+	return func(o *PolicyOptions) {
+		o.ContainerCopy = true
+	}
+}
+
+func newPolicyOptions(opts []PolicyOption) PolicyOptions {
+	var options PolicyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// names returns the policy names of the options which are set.
+func (o PolicyOptions) names() []string {
+	var names []string
+	if o.ExplainDenials {
+		names = append(names, "explain_denials")
+	}
+	if len(o.ReleaseKeys) > 0 {
+		names = append(names, "release_keys")
+	}
+	if o.CheckpointRestore {
+		names = append(names, "allow_checkpoint_restore")
+	}
+	if o.ContainerCopy {
+		names = append(names, "allow_container_copy")
+	}
+	return names
+}
+
+// unsupported returns an error naming the options which are set, if any,
+// as they cannot be represented in `target`.
+func (o PolicyOptions) unsupported(target string) error {
+	if names := o.names(); len(names) > 0 {
+		return fmt.Errorf("%s cannot be represented in %s", strings.Join(names, ", "), target)
+	}
+	return nil
+}
+
 // OSAwareMarshalFunc is like marshalFunc but works with mixed container types
 type OSAwareMarshalFunc func(
 	allowAll bool,
@@ -67,6 +151,7 @@ type OSAwareMarshalFunc func(
 	allowEnvironmentVariableDropping bool,
 	allowUnencryptedScratch bool,
 	allowCapabilityDropping bool,
+	options PolicyOptions,
 ) (string, error)
 
 // osAwareMarshalRego handles both Linux and Windows containers
@@ -83,6 +168,7 @@ func osAwareMarshalRego(
 	allowEnvironmentVariableDropping bool,
 	allowUnencryptedScratch bool,
 	allowCapabilityDropping bool,
+	options PolicyOptions,
 ) (string, error) {
 	if allowAll {
 		if len(linuxContainers) > 0 || len(windowsContainers) > 0 {
@@ -98,12 +184,15 @@ func osAwareMarshalRego(
 		}
 		return marshalRego(allowAll, linuxContainers, externalProcesses, fragments,
 			allowPropertiesAccess, allowDumpStacks, allowRuntimeLogging,
-			allowEnvironmentVariableDropping, allowUnencryptedScratch, allowCapabilityDropping)
+			allowEnvironmentVariableDropping, allowUnencryptedScratch, allowCapabilityDropping, options)
 
 	case "windows":
 		if len(linuxContainers) > 0 {
 			return "", fmt.Errorf("cannot marshal Linux containers on Windows OS")
 		}
+		if err := options.unsupported("a Windows policy"); err != nil {
+			return "", err
+		}
 		return marshalWindowsRego(allowAll, windowsContainers, externalProcesses, fragments,
 			allowPropertiesAccess, allowDumpStacks, allowRuntimeLogging,
 			allowEnvironmentVariableDropping, allowUnencryptedScratch, allowCapabilityDropping)
@@ -167,7 +256,12 @@ func marshalJSON(
 	_ bool,
 	_ bool,
 	_ bool,
+	options PolicyOptions,
 ) (string, error) {
+	if err := options.unsupported("a JSON policy"); err != nil {
+		return "", err
+	}
+
 	var policy *SecurityPolicy
 	if allowAll {
 		if len(containers) > 0 {
@@ -198,6 +292,7 @@ func marshalRego(
 	allowEnvironmentVariableDropping bool,
 	allowUnencryptedScratch bool,
 	allowCapabilityDropping bool,
+	options PolicyOptions,
 ) (string, error) {
 	if allowAll {
 		if len(containers) > 0 {
@@ -221,6 +316,7 @@ func marshalRego(
 	if err != nil {
 		return "", err
 	}
+	policy.Options = options
 
 	return policy.marshalRego(), nil
 }
@@ -230,7 +326,12 @@ func MarshalFragment(
 	svn string,
 	containers []*Container,
 	externalProcesses []ExternalProcessConfig,
-	fragments []FragmentConfig) (string, error) {
+	fragments []FragmentConfig,
+	opts ...PolicyOption) (string, error) {
+	if err := newPolicyOptions(opts).unsupported("a fragment"); err != nil {
+		return "", err
+	}
+
 	fragment, err := newSecurityPolicyFragment(namespace, svn, containers, externalProcesses, fragments)
 	if err != nil {
 		return "", err
@@ -251,6 +352,7 @@ func MarshalPolicy(
 	allowEnvironmentVariableDropping bool,
 	allowUnencryptedScratch bool,
 	allowCapbilitiesDropping bool,
+	opts ...PolicyOption,
 ) (string, error) {
 	if marshaller == "" {
 		marshaller = defaultMarshaller
@@ -272,6 +374,7 @@ func MarshalPolicy(
 			allowEnvironmentVariableDropping,
 			allowUnencryptedScratch,
 			allowCapbilitiesDropping,
+			newPolicyOptions(opts),
 		)
 	}
 }
@@ -510,6 +613,56 @@ func writeUser(builder *strings.Builder, user UserConfig, indent string) {
 	writeLine(builder, `%s},`, indent)
 }
 
+func (s SysctlConfig) marshalRego() string {
+	return fmt.Sprintf(`{"name": "%s", "value": "%s"}`, s.Name, s.Value)
+}
+
+// writeSysctls writes the sysctls which the container may set. Only those
+// listed are allowed, unless the container opts out with `allowAll`.
+func writeSysctls(builder *strings.Builder, sysctls []SysctlConfig, allowAll bool, indent string) {
+	if allowAll {
+		writeLine(builder, `%s"sysctls": null,`, indent)
+		return
+	}
+
+	values := make([]string, len(sysctls))
+	for i, sysctl := range sysctls {
+		values[i] = sysctl.marshalRego()
+	}
+	writeLine(builder, `%s"sysctls": [%s],`, indent, strings.Join(values, ","))
+}
+
+func (r RlimitConfig) marshalRego() string {
+	return fmt.Sprintf(`{"type": "%s", "hard": %d, "soft": %d}`, r.Type, r.Hard, r.Soft)
+}
+
+func writeRlimits(builder *strings.Builder, rlimits []RlimitConfig, indent string) {
+	values := make([]string, len(rlimits))
+	for i, rlimit := range rlimits {
+		values[i] = rlimit.marshalRego()
+	}
+	writeLine(builder, `%s"rlimits": [%s],`, indent, strings.Join(values, ","))
+}
+
+// writeHostNamespaces writes the namespaces which the container may share
+// with the UVM. Only those listed are allowed, unless the container opts out
+// with `allowAll`.
+func writeHostNamespaces(builder *strings.Builder, namespaces []string, allowAll bool, indent string) {
+	if allowAll {
+		writeLine(builder, `%s"host_namespaces": null,`, indent)
+		return
+	}
+	writeLine(builder, `%s"host_namespaces": %s,`, indent, stringArray(namespaces).marshalRego())
+}
+
+func writeMinimumOOMScoreAdj(builder *strings.Builder, minimum *int, indent string) {
+	if minimum == nil {
+		writeLine(builder, `%s"minimum_oom_score_adj": null,`, indent)
+		return
+	}
+	writeLine(builder, `%s"minimum_oom_score_adj": %d,`, indent, *minimum)
+}
+
 func writeContainer(builder *strings.Builder, container *securityPolicyContainer, indent string) {
 	writeLine(builder, "%s{", indent)
 	writeCommand(builder, container.Command, indent+indentUsing)
@@ -521,6 +674,15 @@ func writeContainer(builder *strings.Builder, container *securityPolicyContainer
 	writeUser(builder, container.User, indent+indentUsing)
 	writeCapabilities(builder, container.Capabilities, indent+indentUsing)
 	writeLine(builder, `%s"seccomp_profile_sha256": "%s",`, indent+indentUsing, container.SeccompProfileSHA256)
+	writeSysctls(builder, container.Sysctls, container.AllowAllSysctls, indent+indentUsing)
+	writeRlimits(builder, container.Rlimits, indent+indentUsing)
+	writeLine(builder, "%s\"hostname\": `%s`,", indent+indentUsing, container.Hostname)
+	writeHostNamespaces(builder, container.HostNamespaces, container.AllowAllHostNamespaces, indent+indentUsing)
+	writeLine(builder, `%s"apparmor_profile": "%s",`, indent+indentUsing, container.AppArmorProfile)
+	writeLine(builder, `%s"selinux_label": "%s",`, indent+indentUsing, container.SELinuxLabel)
+	writeLine(builder, `%s"masked_paths": %s,`, indent+indentUsing, stringArray(container.MaskedPaths).marshalRego())
+	writeLine(builder, `%s"readonly_paths": %s,`, indent+indentUsing, stringArray(container.ReadonlyPaths).marshalRego())
+	writeMinimumOOMScoreAdj(builder, container.MinimumOOMScoreAdj, indent+indentUsing)
 	writeLine(builder, `%s"allow_elevated": %t,`, indent+indentUsing, container.AllowElevated)
 	writeLine(builder, `%s"working_dir": "%s",`, indent+indentUsing, container.WorkingDir)
 	writeLine(builder, `%s"allow_stdio_access": %t,`, indent+indentUsing, container.AllowStdioAccess)
@@ -591,12 +753,40 @@ func (p securityPolicyInternal) marshalRego() string {
 	writeLine(builder, "allow_environment_variable_dropping := %t", p.AllowEnvironmentVariableDropping)
 	writeLine(builder, "allow_unencrypted_scratch := %t", p.AllowUnencryptedScratch)
 	writeLine(builder, "allow_capability_dropping := %t", p.AllowCapabilityDropping)
+	writePolicyOptions(builder, p.Options)
 	result := strings.Replace(policyRegoTemplate, "@@OBJECTS@@", builder.String(), 1)
 	result = strings.Replace(result, "@@API_VERSION@@", apiVersion, 1)
 	result = strings.Replace(result, "@@FRAMEWORK_VERSION@@", frameworkVersion, 1)
 	return result
 }
 
+// writePolicyOptions writes the options which are set. Those left unset are
+// omitted so the framework's defaults apply.
+func writePolicyOptions(builder *strings.Builder, options PolicyOptions) {
+	if options.ExplainDenials {
+		writeLine(builder, "explain_denials := true")
+	}
+	if len(options.ReleaseKeys) > 0 {
+		writeLine(builder, "release_keys := [")
+		for _, key := range options.ReleaseKeys {
+			writeLine(builder, "%s%s,", indentUsing, key.marshalRego())
+		}
+		writeLine(builder, "]")
+	}
+	if options.CheckpointRestore {
+		writeLine(builder, "allow_checkpoint_restore := true")
+		writeLine(builder, "checkpoint_image_path := `%s`", options.CheckpointImagePath)
+		writeLine(builder, "restore_image_digests := %s", stringArray(options.RestoreImageDigests).marshalRego())
+	}
+	if options.ContainerCopy {
+		writeLine(builder, "allow_container_copy := true")
+	}
+}
+
+func (k ReleaseKeyConfig) marshalRego() string {
+	return fmt.Sprintf("{\"key_id\": \"%s\", \"target\": `%s`}", k.KeyID, k.Target)
+}
+
 func (p securityPolicyFragment) marshalRego() string {
 	builder := new(strings.Builder)
 	addFragments(builder, p.Fragments)
@@ -15,8 +15,8 @@ import (
 	didx509resolver "github.com/Microsoft/didx509go/pkg/did-x509-resolver"
 	"github.com/Microsoft/hcsshim/internal/log"
 	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
-	"github.com/Microsoft/hcsshim/pkg/amdsevsnp"
 	"github.com/Microsoft/hcsshim/pkg/annotations"
+	"github.com/Microsoft/hcsshim/pkg/attestation"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -29,6 +29,14 @@ type SecurityOptions struct {
 	UvmReferenceInfo  string
 	policyMutex       sync.Mutex
 	logWriter         io.Writer
+	// state of a signed security policy: the trusted issuers, the SVN of the
+	// current policy and the encoded SignedSecurityPolicy which includes it
+	policyIssuers *PolicyIssuers
+	policySVN     uint64
+	signedPolicy  string
+	// attestationProvider fetches the reports which bind the HostData, and is
+	// detected when the security policy is set, unless set beforehand
+	attestationProvider attestation.Provider
 }
 
 func NewSecurityOptions(enforcer SecurityPolicyEnforcer, enforcerSet bool, uvmReferenceInfo string, logWriter io.Writer) *SecurityOptions {
@@ -40,12 +48,36 @@ func NewSecurityOptions(enforcer SecurityPolicyEnforcer, enforcerSet bool, uvmRe
 	}
 }
 
+// SetAttestationProvider sets the provider of the attestation reports against
+// which the HostData of the security policy is validated, in place of the one
+// of the hardware on which the guest runs.
+func (s *SecurityOptions) SetAttestationProvider(p attestation.Provider) {
+	s.policyMutex.Lock()
+	defer s.policyMutex.Unlock()
+
+	s.attestationProvider = p
+}
+
+// AttestationProvider returns the provider of the attestation reports of the
+// guest, or nil when the guest is not confidential or the security policy has
+// not been set yet.
+func (s *SecurityOptions) AttestationProvider() attestation.Provider {
+	s.policyMutex.Lock()
+	defer s.policyMutex.Unlock()
+
+	return s.attestationProvider
+}
+
 // SetConfidentialOptions takes guestresource.ConfidentialOptions
 // to set up our internal data structures we use to store and enforce
 // security policy. The options can contain security policy enforcer type,
 // encoded security policy and signed UVM reference information The security
 // policy and uvm reference information can be further presented to workload
 // containers for validation and attestation purposes.
+//
+// The security policy may be a SignedSecurityPolicy, in which case the
+// HostData binds the trusted issuers, and the COSE_Sign1 document must be
+// signed by one of them.
 func (s *SecurityOptions) SetConfidentialOptions(ctx context.Context, enforcerType string, encodedSecurityPolicy string, encodedUVMReference string) error {
 	s.policyMutex.Lock()
 	defer s.policyMutex.Unlock()
@@ -59,10 +91,39 @@ func (s *SecurityOptions) SetConfidentialOptions(ctx context.Context, enforcerTy
 		return err
 	}
 
-	if err := amdsevsnp.ValidateHostData(hostData[:]); err != nil {
+	if s.attestationProvider == nil {
+		if s.attestationProvider, err = attestation.Detect(); err != nil {
+			return err
+		}
+	}
+	if err := attestation.ValidateHostData(s.attestationProvider, hostData[:]); err != nil {
 		return err
 	}
 
+	// NewSecurityPolicyDigest has already checked the encoding
+	rawPolicy, _ := base64.StdEncoding.DecodeString(encodedSecurityPolicy)
+
+	var (
+		policyIssuers *PolicyIssuers
+		policySVN     uint64
+		signedPolicy  string
+	)
+	if signed, ok := parseSignedSecurityPolicy(rawPolicy); ok {
+		policyIssuers, err = decodePolicyIssuers(signed.Issuers)
+		if err != nil {
+			return err
+		}
+		var code string
+		code, policySVN, err = verifySignedPolicy(ctx, policyIssuers, signed.Policy)
+		if err != nil {
+			return fmt.Errorf("error verifying signed security policy: %w", err)
+		}
+		signedPolicy = encodedSecurityPolicy
+		encodedSecurityPolicy = base64.StdEncoding.EncodeToString([]byte(code))
+	} else if isPolicyIssuers(rawPolicy) {
+		return errors.New("the policy issuers must be provided along with a signed security policy")
+	}
+
 	// This limit ensures messages are below the character truncation limit that
 	// can be imposed by an orchestrator
 	maxErrorMessageLength := 3 * 1024
@@ -86,19 +147,97 @@ func (s *SecurityOptions) SetConfidentialOptions(ctx context.Context, enforcerTy
 	// The other point is on startup where we take a flag to set the default
 	// policy enforcer to use before a policy arrives. After that flag is set,
 	// we use the enforcer in question to set up logging as well.
-	if err = p.EnforceRuntimeLoggingPolicy(ctx); err == nil {
+	s.setRuntimeLogging(ctx, p)
+
+	s.PolicyEnforcer = p
+	s.PolicyEnforcerSet = true
+	s.UvmReferenceInfo = encodedUVMReference
+	s.policyIssuers = policyIssuers
+	s.policySVN = policySVN
+	s.signedPolicy = signedPolicy
+
+	return nil
+}
+
+// setRuntimeLogging enables or disables logging as allowed by the policy.
+func (s *SecurityOptions) setRuntimeLogging(ctx context.Context, p SecurityPolicyEnforcer) {
+	if err := p.EnforceRuntimeLoggingPolicy(ctx); err == nil {
 		logrus.SetOutput(s.logWriter)
 	} else {
 		logrus.SetOutput(io.Discard)
 	}
+}
 
-	s.PolicyEnforcer = p
-	s.PolicyEnforcerSet = true
-	s.UvmReferenceInfo = encodedUVMReference
+// ReplaceSignedPolicy replaces a signed security policy with a newer one. The
+// new policy must be signed by one of the issuers trusted by the HostData and
+// have a higher SVN than the current policy, which prevents rolling back to a
+// policy which has been replaced.
+func (s *SecurityOptions) ReplaceSignedPolicy(ctx context.Context, policy *guestresource.SignedSecurityPolicy) error {
+	s.policyMutex.Lock()
+	defer s.policyMutex.Unlock()
+
+	if s.policyIssuers == nil {
+		return errors.New("only a signed security policy can be replaced")
+	}
+
+	code, svn, err := verifySignedPolicy(ctx, s.policyIssuers, policy.Policy)
+	if err != nil {
+		return fmt.Errorf("error verifying signed security policy: %w", err)
+	}
+	if svn <= s.policySVN {
+		return fmt.Errorf("policy svn %d is not higher than the current svn %d", svn, s.policySVN)
+	}
 
+	coseSign1, _ := base64.StdEncoding.DecodeString(policy.Policy)
+	signedPolicy, err := EncodeSignedSecurityPolicy(s.policyIssuers, coseSign1)
+	if err != nil {
+		return err
+	}
+
+	if err := s.PolicyEnforcer.ReplacePolicy(ctx, base64.StdEncoding.EncodeToString([]byte(code))); err != nil {
+		return fmt.Errorf("error replacing security policy: %w", err)
+	}
+	s.setRuntimeLogging(ctx, s.PolicyEnforcer)
+
+	s.policySVN = svn
+	s.signedPolicy = signedPolicy
 	return nil
 }
 
+// verifySignedPolicy checks that the base64 encoded COSE_Sign1 document is
+// signed by one of the trusted issuers with at least their minimum SVN, and
+// returns its Rego payload and SVN.
+func verifySignedPolicy(ctx context.Context, issuers *PolicyIssuers, encodedPolicy string) (string, uint64, error) {
+	raw, err := base64.StdEncoding.DecodeString(encodedPolicy)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to decode signed policy: %w", err)
+	}
+
+	issuer, feed, code, err := verifyCOSESign1(ctx, raw)
+	if err != nil {
+		return "", 0, err
+	}
+
+	trusted, ok := issuers.find(issuer, feed)
+	if !ok {
+		return "", 0, fmt.Errorf("policy issuer %q and feed %q are not trusted", issuer, feed)
+	}
+
+	svn, err := PolicySVN(code)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(trusted.MinimumSVN) > 0 {
+		// decodePolicyIssuers has already checked the minimum SVN
+		minimumSVN, _ := parseSVN(trusted.MinimumSVN)
+		if svn < minimumSVN {
+			return "", 0, fmt.Errorf("policy svn %d is below the minimum svn %d of the issuer", svn, minimumSVN)
+		}
+	}
+
+	return code, svn, nil
+}
+
 // Fragment extends current security policy with additional constraints
 // from the incoming fragment. Note that it is base64 encoded over the bridge/
 //
@@ -112,9 +251,81 @@ func (s *SecurityOptions) SetConfidentialOptions(ctx context.Context, enforcerTy
 func (s *SecurityOptions) InjectFragment(ctx context.Context, fragment *guestresource.SecurityPolicyFragment) (err error) {
 	log.G(ctx).WithField("fragment", fmt.Sprintf("%+v", fragment)).Debug("VerifyAndExtractFragment")
 
+	issuer, feed, payloadString, err := verifyFragment(ctx, fragment)
+	if err != nil {
+		return fmt.Errorf("InjectFragment %w", err)
+	}
+
+	// now offer the payload fragment to the policy
+	err = s.PolicyEnforcer.LoadFragment(ctx, issuer, feed, payloadString)
+	if err != nil {
+		return fmt.Errorf("error loading security policy fragment: %w", err)
+	}
+	return nil
+}
+
+// ReplaceFragment replaces the fragments loaded from a feed with a newer
+// version. The fragment is checked in the same way as by InjectFragment, and
+// the policy must allow the replacement.
+func (s *SecurityOptions) ReplaceFragment(ctx context.Context, fragment *guestresource.SecurityPolicyFragment) error {
+	log.G(ctx).WithField("fragment", fmt.Sprintf("%+v", fragment)).Debug("ReplaceFragment")
+
+	issuer, feed, payloadString, err := verifyFragment(ctx, fragment)
+	if err != nil {
+		return fmt.Errorf("ReplaceFragment %w", err)
+	}
+
+	if err := s.PolicyEnforcer.ReplaceFragment(ctx, issuer, feed, payloadString); err != nil {
+		return fmt.Errorf("error replacing security policy fragment: %w", err)
+	}
+	return nil
+}
+
+// RevokeFragment unloads the fragments of a feed and prevents further
+// fragments from being loaded from it, if the policy allows it.
+func (s *SecurityOptions) RevokeFragment(ctx context.Context, revocation *guestresource.SecurityPolicyFragmentRevocation) error {
+	log.G(ctx).WithFields(logrus.Fields{
+		"issuer": revocation.Issuer,
+		"feed":   revocation.Feed,
+	}).Debug("RevokeFragment")
+
+	if len(revocation.Issuer) == 0 || len(revocation.Feed) == 0 {
+		return errors.New("both issuer and feed must be provided to revoke a fragment")
+	}
+
+	if err := s.PolicyEnforcer.RevokeFragment(ctx, revocation.Issuer, revocation.Feed); err != nil {
+		return fmt.Errorf("error revoking security policy fragment: %w", err)
+	}
+	return nil
+}
+
+// SetFragmentMinimumSVN raises the minimum SVN of the fragments accepted from
+// a feed, if the policy allows it. Loaded fragments with a lower SVN are
+// unloaded.
+func (s *SecurityOptions) SetFragmentMinimumSVN(ctx context.Context, minimumSVN *guestresource.SecurityPolicyFragmentMinimumSVN) error {
+	log.G(ctx).WithFields(logrus.Fields{
+		"issuer":     minimumSVN.Issuer,
+		"feed":       minimumSVN.Feed,
+		"minimumSVN": minimumSVN.MinimumSVN,
+	}).Debug("SetFragmentMinimumSVN")
+
+	if len(minimumSVN.Issuer) == 0 || len(minimumSVN.Feed) == 0 || len(minimumSVN.MinimumSVN) == 0 {
+		return errors.New("issuer, feed and minimum SVN must all be provided")
+	}
+
+	err := s.PolicyEnforcer.SetFragmentMinimumSVN(ctx, minimumSVN.Issuer, minimumSVN.Feed, minimumSVN.MinimumSVN)
+	if err != nil {
+		return fmt.Errorf("error setting security policy fragment minimum SVN: %w", err)
+	}
+	return nil
+}
+
+// verifyFragment decodes a fragment and checks its signature and issuer,
+// returning the issuer, feed and Rego payload.
+func verifyFragment(ctx context.Context, fragment *guestresource.SecurityPolicyFragment) (issuer, feed, payload string, err error) {
 	raw, err := base64.StdEncoding.DecodeString(fragment.Fragment)
 	if err != nil {
-		return fmt.Errorf("failed to decode fragment: %w", err)
+		return "", "", "", fmt.Errorf("failed to decode fragment: %w", err)
 	}
 	blob := []byte(fragment.Fragment)
 	// keep a copy of the fragment, so we can manually figure out what went wrong
@@ -126,14 +337,21 @@ func (s *SecurityOptions) InjectFragment(ctx context.Context, fragment *guestres
 	fragmentPath := fmt.Sprintf("fragment-%x-%d.blob", sha.Sum(nil), timestamp.UnixMilli())
 	_ = os.WriteFile(filepath.Join(os.TempDir(), fragmentPath), blob, 0644)
 
+	return verifyCOSESign1(ctx, raw)
+}
+
+// verifyCOSESign1 checks the signature of a COSE_Sign1 document and that its
+// issuer DID matches its certificate chain, returning the issuer, feed and
+// payload.
+func verifyCOSESign1(ctx context.Context, raw []byte) (issuer, feed, payload string, err error) {
 	unpacked, err := cosesign1.UnpackAndValidateCOSE1CertChain(raw)
 	if err != nil {
-		return fmt.Errorf("InjectFragment failed COSE validation: %w", err)
+		return "", "", "", fmt.Errorf("failed COSE validation: %w", err)
 	}
 
-	payloadString := string(unpacked.Payload[:])
-	issuer := unpacked.Issuer
-	feed := unpacked.Feed
+	payload = string(unpacked.Payload[:])
+	issuer = unpacked.Issuer
+	feed = unpacked.Feed
 	chainPem := unpacked.ChainPem
 
 	log.G(ctx).WithFields(logrus.Fields{
@@ -144,27 +362,22 @@ func (s *SecurityOptions) InjectFragment(ctx context.Context, fragment *guestres
 	}).Debugf("unpacked COSE1 cert chain")
 
 	log.G(ctx).WithFields(logrus.Fields{
-		"payload": payloadString,
+		"payload": payload,
 	}).Tracef("unpacked COSE1 payload")
 
 	if len(issuer) == 0 || len(feed) == 0 { // must both be present
-		return fmt.Errorf("either issuer and feed must both be provided in the COSE_Sign1 protected header")
+		return "", "", "", fmt.Errorf("either issuer and feed must both be provided in the COSE_Sign1 protected header")
 	}
 
 	// Resolve returns a did doc that we don't need
 	// we only care if there was an error or not
 	_, err = didx509resolver.Resolve(unpacked.ChainPem, issuer, true)
 	if err != nil {
-		log.G(ctx).Printf("Badly formed fragment - did resolver failed to match fragment did:x509 from chain with purported issuer %s, feed %s - err %s", issuer, feed, err.Error())
-		return fmt.Errorf("failed to resolve DID: %w", err)
+		log.G(ctx).Printf("Badly formed COSE_Sign1 document - did resolver failed to match did:x509 from chain with purported issuer %s, feed %s - err %s", issuer, feed, err.Error())
+		return "", "", "", fmt.Errorf("failed to resolve DID: %w", err)
 	}
 
-	// now offer the payload fragment to the policy
-	err = s.PolicyEnforcer.LoadFragment(ctx, issuer, feed, payloadString)
-	if err != nil {
-		return fmt.Errorf("error loading security policy fragment: %w", err)
-	}
-	return nil
+	return issuer, feed, payload, nil
 }
 
 func writeFileInDir(dir string, filename string, data []byte, perm os.FileMode) error {
@@ -207,6 +420,11 @@ func (s *SecurityOptions) WriteSecurityContextDir(spec *specs.Spec) error {
 				return fmt.Errorf("failed to write security policy: %w", err)
 			}
 		}
+		if len(s.signedPolicy) > 0 {
+			if err := writeFileInDir(securityContextDir, SignedPolicyFilename, []byte(s.signedPolicy), 0777); err != nil {
+				return fmt.Errorf("failed to write signed security policy: %w", err)
+			}
+		}
 		if len(s.UvmReferenceInfo) > 0 {
 			if err := writeFileInDir(securityContextDir, ReferenceInfoFilename, []byte(s.UvmReferenceInfo), 0777); err != nil {
 				return fmt.Errorf("failed to write UVM reference info: %w", err)
@@ -3,6 +3,7 @@ package securitypolicy
 import (
 	"context"
 	"fmt"
+	"strings"
 	"syscall"
 
 	"github.com/Microsoft/hcsshim/internal/protocol/guestrequest"
@@ -29,6 +30,15 @@ type CreateContainerOptions struct {
 	Umask                string
 	Capabilities         *oci.LinuxCapabilities
 	SeccompProfileSHA256 string
+	Sysctls              map[string]string // optional: nil means none
+	Rlimits              []oci.POSIXRlimit // optional: nil means none
+	Hostname             string            // optional: "" means unspecified
+	HostNamespaces       []string          // optional: namespaces shared with the UVM
+	AppArmorProfile      string            // optional: "" means unspecified
+	SELinuxLabel         string            // optional: "" means unspecified
+	MaskedPaths          []string          // optional: nil means none
+	ReadonlyPaths        []string          // optional: nil means none
+	OOMScoreAdj          *int              // optional: nil means "not set"
 }
 type SignalContainerOptions struct {
 	IsInitProcess bool
@@ -40,6 +50,15 @@ type SignalContainerOptions struct {
 	WindowsCommand   []string
 }
 
+// LoadedFragment describes a policy fragment which has been loaded by the
+// enforcer.
+type LoadedFragment struct {
+	Issuer    string `json:"issuer"`
+	Feed      string `json:"feed"`
+	SVN       string `json:"svn"`
+	Namespace string `json:"namespace"`
+}
+
 const (
 	openDoorEnforcerName = "open_door"
 )
@@ -113,6 +132,12 @@ type SecurityPolicyEnforcer interface {
 	) (EnvList, *oci.LinuxCapabilities, bool, error)
 	EnforceExecExternalProcessPolicy(ctx context.Context, argList []string, envList []string, workingDir string) (EnvList, bool, error)
 	EnforceShutdownContainerPolicy(ctx context.Context, containerID string) error
+	EnforcePauseContainerPolicy(ctx context.Context, containerID string) error
+	EnforceResumeContainerPolicy(ctx context.Context, containerID string) error
+	EnforceCheckpointContainerPolicy(ctx context.Context, containerID string, imagePath string, imageEncrypted bool) error
+	EnforceRestoreContainerPolicy(ctx context.Context, containerID string, imagePath string, imageDigest string) error
+	EnforceCopyToContainerPolicy(ctx context.Context, containerID string, path string) error
+	EnforceCopyFromContainerPolicy(ctx context.Context, containerID string, path string) error
 	EnforceSignalContainerProcessPolicy(ctx context.Context, containerID string, signal syscall.Signal, isInitProcess bool, startupArgList []string) error
 	EnforceSignalContainerProcessPolicyV2(ctx context.Context, containerID string, opts *SignalContainerOptions) error
 	EnforcePlan9MountPolicy(ctx context.Context, target string) (err error)
@@ -121,8 +146,14 @@ type SecurityPolicyEnforcer interface {
 	EnforceDumpStacksPolicy(ctx context.Context) error
 	EnforceRuntimeLoggingPolicy(ctx context.Context) (err error)
 	LoadFragment(ctx context.Context, issuer string, feed string, rego string) error
+	ReplaceFragment(ctx context.Context, issuer string, feed string, rego string) error
+	RevokeFragment(ctx context.Context, issuer string, feed string) error
+	SetFragmentMinimumSVN(ctx context.Context, issuer string, feed string, minimumSVN string) error
+	LoadedFragments(ctx context.Context) ([]LoadedFragment, error)
+	ReplacePolicy(ctx context.Context, base64EncodedPolicy string) error
 	EnforceScratchMountPolicy(ctx context.Context, scratchPath string, encrypted bool) (err error)
 	EnforceScratchUnmountPolicy(ctx context.Context, scratchPath string) (err error)
+	EnforceReleaseKeyPolicy(ctx context.Context, keyID string, target string) (err error)
 	GetUserInfo(spec *oci.Process, rootPath string) (IDName, []IDName, string, error)
 	EnforceVerifiedCIMsPolicy(ctx context.Context, containerID string, layerHashes []string) (err error)
 }
@@ -141,10 +172,32 @@ func (s stringSet) contains(item string) bool {
 	return contains
 }
 
+// RegisterEnforcer registers an enforcer, e.g. a site-local allowlist, which
+// can then be composed with the enforcer of the policy by the host, e.g.
+// "rego+allowlist". It must be called before the security policy is set.
+func RegisterEnforcer(
+	name string,
+	create func(base64EncodedPolicy string, criMounts, criPrivilegedMounts []oci.Mount, maxErrorMessageLength int) (SecurityPolicyEnforcer, error),
+) error {
+	if name == "" || strings.Contains(name, compositeEnforcerSeparator) {
+		return fmt.Errorf("invalid enforcer name: %q", name)
+	}
+	if _, ok := registeredEnforcers[name]; ok {
+		return fmt.Errorf("enforcer %q is already registered", name)
+	}
+
+	registeredEnforcers[name] = create
+	return nil
+}
+
 // CreateSecurityPolicyEnforcer returns an appropriate enforcer for input
 // parameters.  Returns an error if the requested `enforcer` implementation
 // isn't registered.
 //
+// Several enforcers can be composed by joining their names with "+", e.g.
+// "rego+external", in which case all of them must allow each request. The
+// first is the enforcer of the policy.
+//
 // This function can be called both on confidential and non-confidential
 // containers, but in the non-confidential case the policy would be empty.
 // Normally enforcer is not specified, in which case we use either the default
@@ -172,6 +225,10 @@ func CreateSecurityPolicyEnforcer(
 		}
 	}
 
+	if names := strings.Split(enforcer, compositeEnforcerSeparator); len(names) > 1 {
+		return createCompositeEnforcer(names, base64EncodedPolicy, criMounts, criPrivilegedMounts, maxErrorMessageLength)
+	}
+
 	if createEnforcer, ok := registeredEnforcers[enforcer]; !ok {
 		return nil, fmt.Errorf("unknown enforcer: %q", enforcer)
 	} else {
@@ -253,6 +310,30 @@ func (*OpenDoorSecurityPolicyEnforcer) EnforceShutdownContainerPolicy(context.Co
 	return nil
 }
 
+func (*OpenDoorSecurityPolicyEnforcer) EnforcePauseContainerPolicy(context.Context, string) error {
+	return nil
+}
+
+func (*OpenDoorSecurityPolicyEnforcer) EnforceResumeContainerPolicy(context.Context, string) error {
+	return nil
+}
+
+func (*OpenDoorSecurityPolicyEnforcer) EnforceCheckpointContainerPolicy(context.Context, string, string, bool) error {
+	return nil
+}
+
+func (*OpenDoorSecurityPolicyEnforcer) EnforceRestoreContainerPolicy(context.Context, string, string, string) error {
+	return nil
+}
+
+func (*OpenDoorSecurityPolicyEnforcer) EnforceCopyToContainerPolicy(context.Context, string, string) error {
+	return nil
+}
+
+func (*OpenDoorSecurityPolicyEnforcer) EnforceCopyFromContainerPolicy(context.Context, string, string) error {
+	return nil
+}
+
 func (*OpenDoorSecurityPolicyEnforcer) EnforceSignalContainerProcessPolicy(context.Context, string, syscall.Signal, bool, []string) error {
 	return nil
 }
@@ -281,6 +362,27 @@ func (OpenDoorSecurityPolicyEnforcer) LoadFragment(context.Context, string, stri
 	return nil
 }
 
+func (OpenDoorSecurityPolicyEnforcer) ReplaceFragment(context.Context, string, string, string) error {
+	return nil
+}
+
+func (OpenDoorSecurityPolicyEnforcer) RevokeFragment(context.Context, string, string) error {
+	return nil
+}
+
+func (OpenDoorSecurityPolicyEnforcer) SetFragmentMinimumSVN(context.Context, string, string, string) error {
+	return nil
+}
+
+func (OpenDoorSecurityPolicyEnforcer) LoadedFragments(context.Context) ([]LoadedFragment, error) {
+	return nil, nil
+}
+
+func (oe *OpenDoorSecurityPolicyEnforcer) ReplacePolicy(_ context.Context, base64EncodedPolicy string) error {
+	oe.encodedSecurityPolicy = base64EncodedPolicy
+	return nil
+}
+
 func (OpenDoorSecurityPolicyEnforcer) ExtendDefaultMounts([]oci.Mount) error {
 	return nil
 }
@@ -301,6 +403,10 @@ func (OpenDoorSecurityPolicyEnforcer) EnforceScratchUnmountPolicy(context.Contex
 	return nil
 }
 
+func (OpenDoorSecurityPolicyEnforcer) EnforceReleaseKeyPolicy(context.Context, string, string) error {
+	return nil
+}
+
 func (OpenDoorSecurityPolicyEnforcer) GetUserInfo(spec *oci.Process, rootPath string) (IDName, []IDName, string, error) {
 	return IDName{}, nil, "", nil
 }
@@ -370,6 +476,30 @@ func (*ClosedDoorSecurityPolicyEnforcer) EnforceShutdownContainerPolicy(context.
 	return errors.New("shutting down containers is denied by policy")
 }
 
+func (*ClosedDoorSecurityPolicyEnforcer) EnforcePauseContainerPolicy(context.Context, string) error {
+	return errors.New("pausing containers is denied by policy")
+}
+
+func (*ClosedDoorSecurityPolicyEnforcer) EnforceResumeContainerPolicy(context.Context, string) error {
+	return errors.New("resuming containers is denied by policy")
+}
+
+func (*ClosedDoorSecurityPolicyEnforcer) EnforceCheckpointContainerPolicy(context.Context, string, string, bool) error {
+	return errors.New("checkpointing containers is denied by policy")
+}
+
+func (*ClosedDoorSecurityPolicyEnforcer) EnforceRestoreContainerPolicy(context.Context, string, string, string) error {
+	return errors.New("restoring containers is denied by policy")
+}
+
+func (*ClosedDoorSecurityPolicyEnforcer) EnforceCopyToContainerPolicy(context.Context, string, string) error {
+	return errors.New("copying files into containers is denied by policy")
+}
+
+func (*ClosedDoorSecurityPolicyEnforcer) EnforceCopyFromContainerPolicy(context.Context, string, string) error {
+	return errors.New("copying files out of containers is denied by policy")
+}
+
 func (*ClosedDoorSecurityPolicyEnforcer) EnforceSignalContainerProcessPolicy(context.Context, string, syscall.Signal, bool, []string) error {
 	return errors.New("signalling container processes is denied by policy")
 }
@@ -398,6 +528,26 @@ func (ClosedDoorSecurityPolicyEnforcer) LoadFragment(context.Context, string, st
 	return errors.New("loading fragments is denied by policy")
 }
 
+func (ClosedDoorSecurityPolicyEnforcer) ReplaceFragment(context.Context, string, string, string) error {
+	return errors.New("replacing fragments is denied by policy")
+}
+
+func (ClosedDoorSecurityPolicyEnforcer) RevokeFragment(context.Context, string, string) error {
+	return errors.New("revoking fragments is denied by policy")
+}
+
+func (ClosedDoorSecurityPolicyEnforcer) SetFragmentMinimumSVN(context.Context, string, string, string) error {
+	return errors.New("setting the fragment minimum svn is denied by policy")
+}
+
+func (ClosedDoorSecurityPolicyEnforcer) LoadedFragments(context.Context) ([]LoadedFragment, error) {
+	return nil, nil
+}
+
+func (ClosedDoorSecurityPolicyEnforcer) ReplacePolicy(context.Context, string) error {
+	return errors.New("replacing the policy is denied by policy")
+}
+
 func (ClosedDoorSecurityPolicyEnforcer) ExtendDefaultMounts(_ []oci.Mount) error {
 	return nil
 }
@@ -418,6 +568,10 @@ func (ClosedDoorSecurityPolicyEnforcer) EnforceScratchUnmountPolicy(context.Cont
 	return errors.New("unmounting scratch is denied by the policy")
 }
 
+func (ClosedDoorSecurityPolicyEnforcer) EnforceReleaseKeyPolicy(context.Context, string, string) error {
+	return errors.New("releasing keys is denied by the policy")
+}
+
 func (ClosedDoorSecurityPolicyEnforcer) GetUserInfo(spec *oci.Process, rootPath string) (IDName, []IDName, string, error) {
 	return IDName{}, nil, "", nil
 }
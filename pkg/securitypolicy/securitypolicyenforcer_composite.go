@@ -0,0 +1,356 @@
+package securitypolicy
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// compositeEnforcerSeparator separates the names of the enforcers which make
+// up a composite enforcer, e.g. "rego+external".
+const compositeEnforcerSeparator = "+"
+
+// compositeEnforcer requires all of its enforcers to allow a request.
+//
+// The first enforcer is the enforcer of the policy, which provides the encoded
+// policy, the loaded fragments and the user info. It keeps state, such as the
+// containers which were started, so it decides last: its state is only updated
+// for requests which the other enforcers allow. The environment variables and
+// capabilities which each enforcer keeps are passed on to the next, and stdio
+// access must be allowed by all of them.
+type compositeEnforcer struct {
+	enforcers []SecurityPolicyEnforcer
+}
+
+var _ SecurityPolicyEnforcer = (*compositeEnforcer)(nil)
+
+func createCompositeEnforcer(names []string, base64EncodedPolicy string, criMounts, criPrivilegedMounts []oci.Mount, maxErrorMessageLength int) (SecurityPolicyEnforcer, error) {
+	c := &compositeEnforcer{}
+	for _, name := range names {
+		createEnforcer, ok := registeredEnforcers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown enforcer: %q", name)
+		}
+
+		enforcer, err := createEnforcer(base64EncodedPolicy, criMounts, criPrivilegedMounts, maxErrorMessageLength)
+		if err != nil {
+			return nil, fmt.Errorf("error creating enforcer %q: %w", name, err)
+		}
+		c.enforcers = append(c.enforcers, enforcer)
+	}
+	return c, nil
+}
+
+// enforce calls f for each enforcer, the enforcer of the policy last, and
+// returns the first error.
+func (c *compositeEnforcer) enforce(f func(SecurityPolicyEnforcer) error) error {
+	for i := len(c.enforcers) - 1; i >= 0; i-- {
+		if err := f(c.enforcers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compositeEnforcer) EnforceDeviceMountPolicy(ctx context.Context, target string, deviceHash string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceDeviceMountPolicy(ctx, target, deviceHash)
+	})
+}
+
+func (c *compositeEnforcer) EnforceDeviceUnmountPolicy(ctx context.Context, unmountTarget string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceDeviceUnmountPolicy(ctx, unmountTarget)
+	})
+}
+
+func (c *compositeEnforcer) EnforceOverlayMountPolicy(ctx context.Context, containerID string, layerPaths []string, target string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceOverlayMountPolicy(ctx, containerID, layerPaths, target)
+	})
+}
+
+func (c *compositeEnforcer) EnforceOverlayUnmountPolicy(ctx context.Context, target string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceOverlayUnmountPolicy(ctx, target)
+	})
+}
+
+func (c *compositeEnforcer) EnforceCreateContainerPolicy(
+	ctx context.Context,
+	sandboxID string,
+	containerID string,
+	argList []string,
+	envList []string,
+	workingDir string,
+	mounts []oci.Mount,
+	privileged bool,
+	noNewPrivileges bool,
+	user IDName,
+	groups []IDName,
+	umask string,
+	capabilities *oci.LinuxCapabilities,
+	seccompProfileSHA256 string,
+) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	opts := &CreateContainerOptions{
+		SandboxID:            sandboxID,
+		Privileged:           &privileged,
+		NoNewPrivileges:      &noNewPrivileges,
+		Groups:               groups,
+		Umask:                umask,
+		Capabilities:         capabilities,
+		SeccompProfileSHA256: seccompProfileSHA256,
+	}
+	return c.EnforceCreateContainerPolicyV2(ctx, containerID, argList, envList, workingDir, mounts, user, opts)
+}
+
+func (c *compositeEnforcer) EnforceCreateContainerPolicyV2(
+	ctx context.Context,
+	containerID string,
+	argList []string,
+	envList []string,
+	workingDir string,
+	mounts []oci.Mount,
+	user IDName,
+	opts *CreateContainerOptions,
+) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	narrowed := *opts
+	stdioAccessAllowed := true
+	err := c.enforce(func(e SecurityPolicyEnforcer) error {
+		envToKeep, capsToKeep, allowStdio, err := e.EnforceCreateContainerPolicyV2(ctx, containerID, argList, envList, workingDir, mounts, user, &narrowed)
+		if err != nil {
+			return err
+		}
+		envList = envToKeep
+		narrowed.Capabilities = capsToKeep
+		stdioAccessAllowed = stdioAccessAllowed && allowStdio
+		return nil
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return envList, narrowed.Capabilities, stdioAccessAllowed, nil
+}
+
+func (c *compositeEnforcer) EnforceExecInContainerPolicy(
+	ctx context.Context,
+	containerID string,
+	argList []string,
+	envList []string,
+	workingDir string,
+	noNewPrivileges bool,
+	user IDName,
+	groups []IDName,
+	umask string,
+	capabilities *oci.LinuxCapabilities,
+) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	opts := &ExecOptions{
+		Groups:          groups,
+		Umask:           umask,
+		Capabilities:    capabilities,
+		NoNewPrivileges: &noNewPrivileges,
+	}
+	return c.EnforceExecInContainerPolicyV2(ctx, containerID, argList, envList, workingDir, user, opts)
+}
+
+func (c *compositeEnforcer) EnforceExecInContainerPolicyV2(
+	ctx context.Context,
+	containerID string,
+	argList []string,
+	envList []string,
+	workingDir string,
+	user IDName,
+	opts *ExecOptions,
+) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	narrowed := *opts
+	stdioAccessAllowed := true
+	err := c.enforce(func(e SecurityPolicyEnforcer) error {
+		envToKeep, capsToKeep, allowStdio, err := e.EnforceExecInContainerPolicyV2(ctx, containerID, argList, envList, workingDir, user, &narrowed)
+		if err != nil {
+			return err
+		}
+		envList = envToKeep
+		narrowed.Capabilities = capsToKeep
+		stdioAccessAllowed = stdioAccessAllowed && allowStdio
+		return nil
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return envList, narrowed.Capabilities, stdioAccessAllowed, nil
+}
+
+func (c *compositeEnforcer) EnforceExecExternalProcessPolicy(ctx context.Context, argList []string, envList []string, workingDir string) (EnvList, bool, error) {
+	stdioAccessAllowed := true
+	err := c.enforce(func(e SecurityPolicyEnforcer) error {
+		envToKeep, allowStdio, err := e.EnforceExecExternalProcessPolicy(ctx, argList, envList, workingDir)
+		if err != nil {
+			return err
+		}
+		envList = envToKeep
+		stdioAccessAllowed = stdioAccessAllowed && allowStdio
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return envList, stdioAccessAllowed, nil
+}
+
+func (c *compositeEnforcer) EnforceShutdownContainerPolicy(ctx context.Context, containerID string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceShutdownContainerPolicy(ctx, containerID)
+	})
+}
+
+func (c *compositeEnforcer) EnforcePauseContainerPolicy(ctx context.Context, containerID string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforcePauseContainerPolicy(ctx, containerID)
+	})
+}
+
+func (c *compositeEnforcer) EnforceResumeContainerPolicy(ctx context.Context, containerID string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceResumeContainerPolicy(ctx, containerID)
+	})
+}
+
+func (c *compositeEnforcer) EnforceCheckpointContainerPolicy(ctx context.Context, containerID string, imagePath string, imageEncrypted bool) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceCheckpointContainerPolicy(ctx, containerID, imagePath, imageEncrypted)
+	})
+}
+
+func (c *compositeEnforcer) EnforceRestoreContainerPolicy(ctx context.Context, containerID string, imagePath string, imageDigest string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceRestoreContainerPolicy(ctx, containerID, imagePath, imageDigest)
+	})
+}
+
+func (c *compositeEnforcer) EnforceCopyToContainerPolicy(ctx context.Context, containerID string, path string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceCopyToContainerPolicy(ctx, containerID, path)
+	})
+}
+
+func (c *compositeEnforcer) EnforceCopyFromContainerPolicy(ctx context.Context, containerID string, path string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceCopyFromContainerPolicy(ctx, containerID, path)
+	})
+}
+
+func (c *compositeEnforcer) EnforceSignalContainerProcessPolicy(ctx context.Context, containerID string, signal syscall.Signal, isInitProcess bool, startupArgList []string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceSignalContainerProcessPolicy(ctx, containerID, signal, isInitProcess, startupArgList)
+	})
+}
+
+func (c *compositeEnforcer) EnforceSignalContainerProcessPolicyV2(ctx context.Context, containerID string, opts *SignalContainerOptions) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceSignalContainerProcessPolicyV2(ctx, containerID, opts)
+	})
+}
+
+func (c *compositeEnforcer) EnforcePlan9MountPolicy(ctx context.Context, target string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforcePlan9MountPolicy(ctx, target)
+	})
+}
+
+func (c *compositeEnforcer) EnforcePlan9UnmountPolicy(ctx context.Context, target string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforcePlan9UnmountPolicy(ctx, target)
+	})
+}
+
+func (c *compositeEnforcer) EnforceGetPropertiesPolicy(ctx context.Context) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceGetPropertiesPolicy(ctx)
+	})
+}
+
+func (c *compositeEnforcer) EnforceDumpStacksPolicy(ctx context.Context) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceDumpStacksPolicy(ctx)
+	})
+}
+
+func (c *compositeEnforcer) EnforceRuntimeLoggingPolicy(ctx context.Context) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceRuntimeLoggingPolicy(ctx)
+	})
+}
+
+func (c *compositeEnforcer) LoadFragment(ctx context.Context, issuer string, feed string, rego string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.LoadFragment(ctx, issuer, feed, rego)
+	})
+}
+
+func (c *compositeEnforcer) ReplaceFragment(ctx context.Context, issuer string, feed string, rego string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.ReplaceFragment(ctx, issuer, feed, rego)
+	})
+}
+
+func (c *compositeEnforcer) RevokeFragment(ctx context.Context, issuer string, feed string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.RevokeFragment(ctx, issuer, feed)
+	})
+}
+
+func (c *compositeEnforcer) SetFragmentMinimumSVN(ctx context.Context, issuer string, feed string, minimumSVN string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.SetFragmentMinimumSVN(ctx, issuer, feed, minimumSVN)
+	})
+}
+
+func (c *compositeEnforcer) LoadedFragments(ctx context.Context) ([]LoadedFragment, error) {
+	return c.enforcers[0].LoadedFragments(ctx)
+}
+
+func (c *compositeEnforcer) ReplacePolicy(ctx context.Context, base64EncodedPolicy string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.ReplacePolicy(ctx, base64EncodedPolicy)
+	})
+}
+
+func (c *compositeEnforcer) ExtendDefaultMounts(mounts []oci.Mount) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.ExtendDefaultMounts(mounts)
+	})
+}
+
+func (c *compositeEnforcer) EncodedSecurityPolicy() string {
+	return c.enforcers[0].EncodedSecurityPolicy()
+}
+
+func (c *compositeEnforcer) EnforceScratchMountPolicy(ctx context.Context, scratchPath string, encrypted bool) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceScratchMountPolicy(ctx, scratchPath, encrypted)
+	})
+}
+
+func (c *compositeEnforcer) EnforceScratchUnmountPolicy(ctx context.Context, scratchPath string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceScratchUnmountPolicy(ctx, scratchPath)
+	})
+}
+
+func (c *compositeEnforcer) EnforceReleaseKeyPolicy(ctx context.Context, keyID string, target string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceReleaseKeyPolicy(ctx, keyID, target)
+	})
+}
+
+func (c *compositeEnforcer) GetUserInfo(process *oci.Process, rootPath string) (IDName, []IDName, string, error) {
+	return c.enforcers[0].GetUserInfo(process, rootPath)
+}
+
+func (c *compositeEnforcer) EnforceVerifiedCIMsPolicy(ctx context.Context, containerID string, layerHashes []string) error {
+	return c.enforce(func(e SecurityPolicyEnforcer) error {
+		return e.EnforceVerifiedCIMsPolicy(ctx, containerID, layerHashes)
+	})
+}
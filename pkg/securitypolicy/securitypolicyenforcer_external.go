@@ -0,0 +1,421 @@
+package securitypolicy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/containerd/ttrpc"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy/externalenforcer"
+)
+
+const externalEnforcerName = "external"
+
+// ExternalEnforcerAddress is the unix socket on which the PolicyEnforcer
+// service of the external enforcer listens.
+var ExternalEnforcerAddress = "/run/gcs/policy-enforcer.sock"
+
+func init() {
+	registeredEnforcers[externalEnforcerName] = createExternalEnforcer
+}
+
+// externalEnforcer forwards each request of the host to a PolicyEnforcer
+// service in the UVM, along with the input of the corresponding enforcement
+// point of the policy API. The service only allows or denies requests: the
+// environment variables and capabilities of a process are kept as requested,
+// and stdio access is allowed. It is meant to be composed with the enforcer
+// of the policy, e.g. "rego+external", which narrows them.
+//
+// The service is passed the security policy and is trusted to enforce it,
+// as the host may select the external enforcer alone.
+type externalEnforcer struct {
+	client                externalenforcer.PolicyEnforcerService
+	encodedSecurityPolicy string
+}
+
+var _ SecurityPolicyEnforcer = (*externalEnforcer)(nil)
+
+func createExternalEnforcer(base64EncodedPolicy string, _, _ []oci.Mount, _ int) (SecurityPolicyEnforcer, error) {
+	conn, err := net.Dial("unix", ExternalEnforcerAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to external enforcer at %s: %w", ExternalEnforcerAddress, err)
+	}
+
+	enforcer := &externalEnforcer{
+		client: externalenforcer.NewPolicyEnforcerClient(ttrpc.NewClient(conn)),
+	}
+	if err := enforcer.ReplacePolicy(context.Background(), base64EncodedPolicy); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return enforcer, nil
+}
+
+func (e *externalEnforcer) enforce(ctx context.Context, enforcementPoint string, input inputData) error {
+	rawInput, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal input of %s: %w", enforcementPoint, err)
+	}
+
+	resp, err := e.client.Enforce(ctx, &externalenforcer.EnforceRequest{
+		EnforcementPoint: enforcementPoint,
+		Input:            rawInput,
+	})
+	if err != nil {
+		return fmt.Errorf("external enforcer failed to enforce %s: %w", enforcementPoint, err)
+	}
+
+	if !resp.Allowed {
+		return fmt.Errorf("%s is denied by external enforcer: %s", enforcementPoint, resp.Reason)
+	}
+	return nil
+}
+
+func (e *externalEnforcer) EnforceDeviceMountPolicy(ctx context.Context, target string, deviceHash string) error {
+	return e.enforce(ctx, "mount_device", inputData{
+		"target":     target,
+		"deviceHash": deviceHash,
+	})
+}
+
+func (e *externalEnforcer) EnforceDeviceUnmountPolicy(ctx context.Context, unmountTarget string) error {
+	return e.enforce(ctx, "unmount_device", inputData{
+		"unmountTarget": unmountTarget,
+	})
+}
+
+func (e *externalEnforcer) EnforceOverlayMountPolicy(ctx context.Context, containerID string, layerPaths []string, target string) error {
+	return e.enforce(ctx, "mount_overlay", inputData{
+		"containerID": containerID,
+		"layerPaths":  layerPaths,
+		"target":      target,
+	})
+}
+
+func (e *externalEnforcer) EnforceOverlayUnmountPolicy(ctx context.Context, target string) error {
+	return e.enforce(ctx, "unmount_overlay", inputData{
+		"unmountTarget": target,
+	})
+}
+
+func (e *externalEnforcer) EnforceCreateContainerPolicy(
+	ctx context.Context,
+	sandboxID string,
+	containerID string,
+	argList []string,
+	envList []string,
+	workingDir string,
+	mounts []oci.Mount,
+	privileged bool,
+	noNewPrivileges bool,
+	user IDName,
+	groups []IDName,
+	umask string,
+	capabilities *oci.LinuxCapabilities,
+	seccompProfileSHA256 string,
+) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	opts := &CreateContainerOptions{
+		SandboxID:            sandboxID,
+		Privileged:           &privileged,
+		NoNewPrivileges:      &noNewPrivileges,
+		Groups:               groups,
+		Umask:                umask,
+		Capabilities:         capabilities,
+		SeccompProfileSHA256: seccompProfileSHA256,
+	}
+	return e.EnforceCreateContainerPolicyV2(ctx, containerID, argList, envList, workingDir, mounts, user, opts)
+}
+
+func (e *externalEnforcer) EnforceCreateContainerPolicyV2(
+	ctx context.Context,
+	containerID string,
+	argList []string,
+	envList []string,
+	workingDir string,
+	mounts []oci.Mount,
+	user IDName,
+	opts *CreateContainerOptions,
+) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	input := inputData{
+		"containerID":          containerID,
+		"argList":              argList,
+		"envList":              stringsToInput(envList),
+		"workingDir":           workingDir,
+		"sandboxDir":           SandboxMountsDir(opts.SandboxID),
+		"hugePagesDir":         HugePagesMountsDir(opts.SandboxID),
+		"mounts":               appendMountData([]interface{}{}, mounts),
+		"privileged":           opts.Privileged,
+		"noNewPrivileges":      opts.NoNewPrivileges,
+		"user":                 user.toInput(),
+		"groups":               groupsToInputs(opts.Groups),
+		"umask":                opts.Umask,
+		"seccompProfileSHA256": opts.SeccompProfileSHA256,
+		"sysctls":              sysctlsToInput(opts.Sysctls),
+		"rlimits":              rlimitsToInput(opts.Rlimits),
+		"hostname":             opts.Hostname,
+		"hostNamespaces":       stringsToInput(opts.HostNamespaces),
+		"apparmorProfile":      opts.AppArmorProfile,
+		"selinuxLabel":         opts.SELinuxLabel,
+		"maskedPaths":          stringsToInput(opts.MaskedPaths),
+		"readonlyPaths":        stringsToInput(opts.ReadonlyPaths),
+		"oomScoreAdj":          opts.OOMScoreAdj,
+	}
+	if opts.Capabilities != nil {
+		input["capabilities"] = mapifyCapabilities(opts.Capabilities)
+	}
+
+	if err := e.enforce(ctx, "create_container", input); err != nil {
+		return nil, nil, false, err
+	}
+	return envList, opts.Capabilities, true, nil
+}
+
+func (e *externalEnforcer) EnforceExecInContainerPolicy(
+	ctx context.Context,
+	containerID string,
+	argList []string,
+	envList []string,
+	workingDir string,
+	noNewPrivileges bool,
+	user IDName,
+	groups []IDName,
+	umask string,
+	capabilities *oci.LinuxCapabilities,
+) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	opts := &ExecOptions{
+		Groups:          groups,
+		Umask:           umask,
+		Capabilities:    capabilities,
+		NoNewPrivileges: &noNewPrivileges,
+	}
+	return e.EnforceExecInContainerPolicyV2(ctx, containerID, argList, envList, workingDir, user, opts)
+}
+
+func (e *externalEnforcer) EnforceExecInContainerPolicyV2(
+	ctx context.Context,
+	containerID string,
+	argList []string,
+	envList []string,
+	workingDir string,
+	user IDName,
+	opts *ExecOptions,
+) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	input := inputData{
+		"containerID":     containerID,
+		"argList":         argList,
+		"envList":         stringsToInput(envList),
+		"workingDir":      workingDir,
+		"noNewPrivileges": opts.NoNewPrivileges,
+		"user":            user.toInput(),
+		"groups":          groupsToInputs(opts.Groups),
+		"umask":           opts.Umask,
+	}
+	if opts.Capabilities != nil {
+		input["capabilities"] = mapifyCapabilities(opts.Capabilities)
+	}
+
+	if err := e.enforce(ctx, "exec_in_container", input); err != nil {
+		return nil, nil, false, err
+	}
+	return envList, opts.Capabilities, true, nil
+}
+
+func (e *externalEnforcer) EnforceExecExternalProcessPolicy(ctx context.Context, argList []string, envList []string, workingDir string) (EnvList, bool, error) {
+	input := inputData{
+		"argList":    argList,
+		"envList":    stringsToInput(envList),
+		"workingDir": workingDir,
+	}
+
+	if err := e.enforce(ctx, "exec_external", input); err != nil {
+		return nil, false, err
+	}
+	return envList, true, nil
+}
+
+func (e *externalEnforcer) EnforceShutdownContainerPolicy(ctx context.Context, containerID string) error {
+	return e.enforce(ctx, "shutdown_container", inputData{
+		"containerID": containerID,
+	})
+}
+
+func (e *externalEnforcer) EnforcePauseContainerPolicy(ctx context.Context, containerID string) error {
+	return e.enforce(ctx, "pause_container", inputData{
+		"containerID": containerID,
+	})
+}
+
+func (e *externalEnforcer) EnforceResumeContainerPolicy(ctx context.Context, containerID string) error {
+	return e.enforce(ctx, "resume_container", inputData{
+		"containerID": containerID,
+	})
+}
+
+func (e *externalEnforcer) EnforceCheckpointContainerPolicy(ctx context.Context, containerID string, imagePath string, imageEncrypted bool) error {
+	return e.enforce(ctx, "checkpoint_container", inputData{
+		"containerID":    containerID,
+		"imagePath":      imagePath,
+		"imageEncrypted": imageEncrypted,
+	})
+}
+
+func (e *externalEnforcer) EnforceRestoreContainerPolicy(ctx context.Context, containerID string, imagePath string, imageDigest string) error {
+	return e.enforce(ctx, "restore_container", inputData{
+		"containerID": containerID,
+		"imagePath":   imagePath,
+		"imageDigest": imageDigest,
+	})
+}
+
+func (e *externalEnforcer) EnforceCopyToContainerPolicy(ctx context.Context, containerID string, path string) error {
+	return e.enforce(ctx, "copy_to_container", inputData{
+		"containerID": containerID,
+		"path":        path,
+	})
+}
+
+func (e *externalEnforcer) EnforceCopyFromContainerPolicy(ctx context.Context, containerID string, path string) error {
+	return e.enforce(ctx, "copy_from_container", inputData{
+		"containerID": containerID,
+		"path":        path,
+	})
+}
+
+func (e *externalEnforcer) EnforceSignalContainerProcessPolicy(ctx context.Context, containerID string, signal syscall.Signal, isInitProcess bool, startupArgList []string) error {
+	opts := &SignalContainerOptions{
+		LinuxSignal:      signal,
+		IsInitProcess:    isInitProcess,
+		LinuxStartupArgs: startupArgList,
+	}
+	return e.EnforceSignalContainerProcessPolicyV2(ctx, containerID, opts)
+}
+
+func (e *externalEnforcer) EnforceSignalContainerProcessPolicyV2(ctx context.Context, containerID string, opts *SignalContainerOptions) error {
+	input := inputData{
+		"containerID":   containerID,
+		"signal":        opts.LinuxSignal,
+		"isInitProcess": opts.IsInitProcess,
+		"argList":       opts.LinuxStartupArgs,
+	}
+	if opts.WindowsCommand != nil {
+		input["signal"] = opts.WindowsSignal
+		input["argList"] = opts.WindowsCommand
+	}
+
+	return e.enforce(ctx, "signal_container_process", input)
+}
+
+func (e *externalEnforcer) EnforcePlan9MountPolicy(ctx context.Context, target string) error {
+	return e.enforce(ctx, "plan9_mount", inputData{
+		"target": target,
+	})
+}
+
+func (e *externalEnforcer) EnforcePlan9UnmountPolicy(ctx context.Context, target string) error {
+	return e.enforce(ctx, "plan9_unmount", inputData{
+		"unmountTarget": target,
+	})
+}
+
+func (e *externalEnforcer) EnforceGetPropertiesPolicy(ctx context.Context) error {
+	return e.enforce(ctx, "get_properties", inputData{})
+}
+
+func (e *externalEnforcer) EnforceDumpStacksPolicy(ctx context.Context) error {
+	return e.enforce(ctx, "dump_stacks", inputData{})
+}
+
+func (e *externalEnforcer) EnforceRuntimeLoggingPolicy(ctx context.Context) error {
+	return e.enforce(ctx, "runtime_logging", inputData{})
+}
+
+func (e *externalEnforcer) LoadFragment(ctx context.Context, issuer string, feed string, rego string) error {
+	return e.enforce(ctx, "load_fragment", inputData{
+		"issuer":   issuer,
+		"feed":     feed,
+		"fragment": rego,
+	})
+}
+
+func (e *externalEnforcer) ReplaceFragment(ctx context.Context, issuer string, feed string, rego string) error {
+	return e.enforce(ctx, "replace_fragment", inputData{
+		"issuer":   issuer,
+		"feed":     feed,
+		"fragment": rego,
+	})
+}
+
+func (e *externalEnforcer) RevokeFragment(ctx context.Context, issuer string, feed string) error {
+	return e.enforce(ctx, "revoke_fragment", inputData{
+		"issuer": issuer,
+		"feed":   feed,
+	})
+}
+
+func (e *externalEnforcer) SetFragmentMinimumSVN(ctx context.Context, issuer string, feed string, minimumSVN string) error {
+	return e.enforce(ctx, "set_fragment_minimum_svn", inputData{
+		"issuer":      issuer,
+		"feed":        feed,
+		"minimum_svn": minimumSVN,
+	})
+}
+
+// LoadedFragments returns no fragments, as the fragments are loaded by the
+// enforcer of the policy.
+func (*externalEnforcer) LoadedFragments(context.Context) ([]LoadedFragment, error) {
+	return nil, nil
+}
+
+// ReplacePolicy passes the new policy to the service.
+func (e *externalEnforcer) ReplacePolicy(ctx context.Context, base64EncodedPolicy string) error {
+	_, err := e.client.Initialize(ctx, &externalenforcer.InitializeRequest{Policy: base64EncodedPolicy})
+	if err != nil {
+		return fmt.Errorf("failed to initialize external enforcer: %w", err)
+	}
+
+	e.encodedSecurityPolicy = base64EncodedPolicy
+	return nil
+}
+
+func (*externalEnforcer) ExtendDefaultMounts([]oci.Mount) error {
+	return nil
+}
+
+func (e *externalEnforcer) EncodedSecurityPolicy() string {
+	return e.encodedSecurityPolicy
+}
+
+func (e *externalEnforcer) EnforceScratchMountPolicy(ctx context.Context, scratchPath string, encrypted bool) error {
+	return e.enforce(ctx, "scratch_mount", inputData{
+		"target":    scratchPath,
+		"encrypted": encrypted,
+	})
+}
+
+func (e *externalEnforcer) EnforceScratchUnmountPolicy(ctx context.Context, scratchPath string) error {
+	return e.enforce(ctx, "scratch_unmount", inputData{
+		"unmountTarget": scratchPath,
+	})
+}
+
+func (e *externalEnforcer) EnforceReleaseKeyPolicy(ctx context.Context, keyID string, target string) error {
+	return e.enforce(ctx, "release_key", inputData{
+		"keyID":  keyID,
+		"target": target,
+	})
+}
+
+func (*externalEnforcer) GetUserInfo(process *oci.Process, rootPath string) (IDName, []IDName, string, error) {
+	return GetAllUserInfo(process, rootPath)
+}
+
+func (e *externalEnforcer) EnforceVerifiedCIMsPolicy(ctx context.Context, containerID string, layerHashes []string) error {
+	return e.enforce(ctx, "mount_cims", inputData{
+		"containerID": containerID,
+		"layerHashes": layerHashes,
+	})
+}
@@ -0,0 +1,199 @@
+package securitypolicy
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/ttrpc"
+	oci "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/Microsoft/hcsshim/pkg/securitypolicy/externalenforcer"
+)
+
+// fakePolicyEnforcerService denies the enforcement points in denied, and
+// records the requests it receives.
+type fakePolicyEnforcerService struct {
+	mu       sync.Mutex
+	policy   string
+	denied   map[string]bool
+	requests map[string]inputData
+}
+
+var _ externalenforcer.PolicyEnforcerService = (*fakePolicyEnforcerService)(nil)
+
+func (s *fakePolicyEnforcerService) Initialize(_ context.Context, req *externalenforcer.InitializeRequest) (*externalenforcer.InitializeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policy = req.Policy
+	return &externalenforcer.InitializeResponse{}, nil
+}
+
+func (s *fakePolicyEnforcerService) Enforce(_ context.Context, req *externalenforcer.EnforceRequest) (*externalenforcer.EnforceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	input := inputData{}
+	if err := json.Unmarshal(req.Input, &input); err != nil {
+		return nil, err
+	}
+	s.requests[req.EnforcementPoint] = input
+
+	if s.denied[req.EnforcementPoint] {
+		return &externalenforcer.EnforceResponse{Reason: "denied by fake"}, nil
+	}
+	return &externalenforcer.EnforceResponse{Allowed: true}, nil
+}
+
+// startFakeExternalEnforcer serves a fake PolicyEnforcer service, on which the
+// external enforcer is pointed for the duration of the test.
+func startFakeExternalEnforcer(t *testing.T) *fakePolicyEnforcerService {
+	t.Helper()
+
+	address := filepath.Join(t.TempDir(), "enforcer.sock")
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := ttrpc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &fakePolicyEnforcerService{
+		denied:   map[string]bool{},
+		requests: map[string]inputData{},
+	}
+	externalenforcer.RegisterPolicyEnforcerService(server, service)
+	go server.Serve(context.Background(), l) //nolint:errcheck
+
+	previous := ExternalEnforcerAddress
+	ExternalEnforcerAddress = address
+	t.Cleanup(func() {
+		ExternalEnforcerAddress = previous
+		server.Close()
+	})
+	return service
+}
+
+func Test_ExternalEnforcer(t *testing.T) {
+	ctx := context.Background()
+	service := startFakeExternalEnforcer(t)
+
+	enforcer, err := CreateSecurityPolicyEnforcer(externalEnforcerName, "cG9saWN5", nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.policy != "cG9saWN5" || enforcer.EncodedSecurityPolicy() != "cG9saWN5" {
+		t.Fatal("policy was not passed to the external enforcer")
+	}
+
+	envList := []string{"A=1", "B=2"}
+	capabilities := &oci.LinuxCapabilities{Bounding: []string{"CAP_CHOWN"}}
+	env, caps, allowStdio, err := enforcer.EnforceCreateContainerPolicyV2(ctx, "c1", []string{"/bin/sh"}, envList, "/", nil, IDName{ID: "0", Name: "root"}, &CreateContainerOptions{Capabilities: capabilities})
+	if err != nil {
+		t.Fatalf("expected create container to be allowed: %s", err)
+	}
+	if strings.Join(env, ",") != strings.Join(envList, ",") || caps != capabilities || !allowStdio {
+		t.Fatal("external enforcer must not change an allowed process")
+	}
+
+	input := service.requests["create_container"]
+	if input["containerID"] != "c1" || input["user"].(map[string]interface{})["name"] != "root" {
+		t.Fatalf("unexpected input of create_container: %v", input)
+	}
+
+	service.denied["dump_stacks"] = true
+	err = enforcer.EnforceDumpStacksPolicy(ctx)
+	if err == nil || !strings.Contains(err.Error(), "denied by fake") {
+		t.Fatalf("expected dump stacks to be denied with the reason of the service, got: %v", err)
+	}
+}
+
+func Test_ExternalEnforcer_NoService(t *testing.T) {
+	previous := ExternalEnforcerAddress
+	ExternalEnforcerAddress = filepath.Join(t.TempDir(), "missing.sock")
+	t.Cleanup(func() { ExternalEnforcerAddress = previous })
+
+	if _, err := CreateSecurityPolicyEnforcer(externalEnforcerName, "", nil, nil, 0); err == nil {
+		t.Fatal("expected the external enforcer to require its service")
+	}
+}
+
+// dropEnvEnforcer is an open door enforcer which drops the environment
+// variables with the given prefix and denies stdio access.
+type dropEnvEnforcer struct {
+	OpenDoorSecurityPolicyEnforcer
+	prefix string
+}
+
+func (e *dropEnvEnforcer) EnforceCreateContainerPolicyV2(_ context.Context, _ string, _ []string, envList []string, _ string, _ []oci.Mount, _ IDName, opts *CreateContainerOptions) (EnvList, *oci.LinuxCapabilities, bool, error) {
+	kept := EnvList{}
+	for _, env := range envList {
+		if !strings.HasPrefix(env, e.prefix) {
+			kept = append(kept, env)
+		}
+	}
+	return kept, opts.Capabilities, false, nil
+}
+
+func Test_CompositeEnforcer(t *testing.T) {
+	ctx := context.Background()
+	service := startFakeExternalEnforcer(t)
+
+	err := RegisterEnforcer("drop_secrets", func(string, []oci.Mount, []oci.Mount, int) (SecurityPolicyEnforcer, error) {
+		return &dropEnvEnforcer{prefix: "SECRET"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(registeredEnforcers, "drop_secrets") })
+
+	enforcer, err := CreateSecurityPolicyEnforcer("open_door+drop_secrets+external", "", nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, _, allowStdio, err := enforcer.EnforceCreateContainerPolicyV2(ctx, "c1", []string{"/bin/sh"}, []string{"A=1", "SECRET=2"}, "/", nil, IDName{}, &CreateContainerOptions{})
+	if err != nil {
+		t.Fatalf("expected create container to be allowed: %s", err)
+	}
+	if strings.Join(env, ",") != "A=1" {
+		t.Fatalf("expected the environment to be narrowed, got %v", env)
+	}
+	if allowStdio {
+		t.Fatal("expected stdio access to be denied by one of the enforcers")
+	}
+
+	service.denied["create_container"] = true
+	if _, _, _, err := enforcer.EnforceCreateContainerPolicyV2(ctx, "c2", []string{"/bin/sh"}, nil, "/", nil, IDName{}, &CreateContainerOptions{}); err == nil {
+		t.Fatal("expected create container to be denied by the external enforcer")
+	}
+}
+
+func Test_CompositeEnforcer_Invalid(t *testing.T) {
+	if _, err := CreateSecurityPolicyEnforcer("open_door+unknown", "", nil, nil, 0); err == nil {
+		t.Error("expected unknown enforcer to be rejected")
+	}
+
+	// the open door enforcer accepts no policy, even when composed
+	startFakeExternalEnforcer(t)
+	if _, err := CreateSecurityPolicyEnforcer("open_door+external", "cG9saWN5", nil, nil, 0); err == nil {
+		t.Error("expected open door enforcer to reject a policy")
+	}
+
+	create := func(string, []oci.Mount, []oci.Mount, int) (SecurityPolicyEnforcer, error) {
+		return &OpenDoorSecurityPolicyEnforcer{}, nil
+	}
+	if err := RegisterEnforcer(openDoorEnforcerName, create); err == nil {
+		t.Error("expected registered enforcer not to be replaced")
+	}
+	if err := RegisterEnforcer("a+b", create); err == nil {
+		t.Error("expected enforcer name with separator to be rejected")
+	}
+}
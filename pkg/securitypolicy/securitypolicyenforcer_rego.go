@@ -88,8 +88,6 @@ func (a stringSet) intersect(b stringSet) stringSet {
 	return s
 }
 
-type inputData map[string]interface{}
-
 func isValidJsonObject(input string) bool {
 	type emptyStruct = struct{}
 
@@ -270,6 +268,22 @@ func (policy *regoEnforcer) enforce(ctx context.Context, enforcementPoint string
 
 type decisionTruncator func(map[string]interface{})
 
+func truncateExplainDetail(decision map[string]interface{}) {
+	if explained, ok := decision["explain"].([]explainedCandidate); ok {
+		decision["truncated"] = append(decision["truncated"].([]string), "explain.detail")
+		for i := range explained {
+			explained[i].Detail = nil
+		}
+	}
+}
+
+func truncateExplain(decision map[string]interface{}) {
+	if _, ok := decision["explain"]; ok {
+		decision["truncated"] = append(decision["truncated"].([]string), "explain")
+		delete(decision, "explain")
+	}
+}
+
 func truncateErrorObjects(decision map[string]interface{}) {
 	if rawReason, ok := decision["reason"]; ok {
 		// check if it is a framework reason object
@@ -318,7 +332,7 @@ func (policy *regoEnforcer) policyDecisionToError(ctx context.Context, decision
 	}
 
 	decision["truncated"] = []string{}
-	truncators := []decisionTruncator{truncateErrorObjects, truncateInput, truncateReason}
+	truncators := []decisionTruncator{truncateExplainDetail, truncateExplain, truncateErrorObjects, truncateInput, truncateReason}
 	for _, truncate := range truncators {
 		truncate(decision)
 
@@ -354,12 +368,17 @@ func (policy *regoEnforcer) denyWithError(ctx context.Context, policyError error
 func (policy *regoEnforcer) denyWithReason(ctx context.Context, enforcementPoint string, input inputData) error {
 	cleaned_input := policy.redactSensitiveData(input)
 	cleaned_input = replaceCapabilitiesWithPlaceholders(cleaned_input)
-	input["rule"] = enforcementPoint
 	policyDecision := map[string]interface{}{
 		"input":    cleaned_input,
 		"decision": "deny",
 	}
 
+	if policy.explainDenials() {
+		policyDecision["explain"] = policy.explainDenial(ctx, enforcementPoint, input)
+	}
+
+	input["rule"] = enforcementPoint
+
 	result, err := policy.rego.Query("data.policy.reason", input)
 	if err == nil {
 		if result.IsEmpty() {
@@ -375,6 +394,36 @@ func (policy *regoEnforcer) denyWithReason(ctx context.Context, enforcementPoint
 	return policy.policyDecisionToError(ctx, policyDecision)
 }
 
+// explainDenials returns whether the policy opts in to explaining its denials,
+// by declaring `explain_denials := true`.
+func (policy *regoEnforcer) explainDenials() bool {
+	resultSet, err := policy.rego.RawQuery("data.policy.explain_denials", inputData{})
+	if err != nil || len(resultSet) == 0 || len(resultSet[0].Expressions) == 0 {
+		return false
+	}
+
+	explain, ok := resultSet[0].Expressions[0].Value.(bool)
+	return ok && explain
+}
+
+// explainDenial evaluates the denied enforcement point again with tracing
+// enabled, and summarizes the predicate which each candidate failed.
+func (policy *regoEnforcer) explainDenial(ctx context.Context, enforcementPoint string, input inputData) []explainedCandidate {
+	_, trace, err := policy.rego.TraceQuery("data.policy."+enforcementPoint, input)
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("unable to trace policy decision")
+		return nil
+	}
+
+	explained := explainTrace(trace)
+	if envList, ok := input["envList"].([]string); ok {
+		redactedEnvList, _ := policy.redactSensitiveData(input)["envList"].([]string)
+		redactExplanation(explained, envList, redactedEnvList)
+	}
+
+	return explained
+}
+
 func areCapsEqual(actual map[string]interface{}, expected map[string][]string) bool {
 	for key, caps := range expected {
 		values, ok := actual[key].([]interface{})
@@ -604,47 +653,6 @@ func filterCapabilities(suppliedList []string, fromRegoCapsList interface{}) ([]
 	return keepSet.toArray(), nil
 }
 
-func (idName IDName) toInput() interface{} {
-	return map[string]interface{}{
-		"id":   idName.ID,
-		"name": idName.Name,
-	}
-}
-
-func groupsToInputs(groups []IDName) []interface{} {
-	inputs := []interface{}{}
-	for _, group := range groups {
-		inputs = append(inputs, group.toInput())
-	}
-	return inputs
-}
-
-func handleNilOrEmptyCaps(caps []string) interface{} {
-	if len(caps) > 0 {
-		result := make([]interface{}, len(caps))
-		for i, cap := range caps {
-			result[i] = cap
-		}
-
-		return result
-	}
-
-	// caps is either nil or empty.
-	// In either case, we want to return an empty array.
-	return make([]interface{}, 0)
-}
-
-func mapifyCapabilities(caps *oci.LinuxCapabilities) map[string]interface{} {
-	out := make(map[string]interface{})
-
-	out["bounding"] = handleNilOrEmptyCaps(caps.Bounding)
-	out["effective"] = handleNilOrEmptyCaps(caps.Effective)
-	out["inheritable"] = handleNilOrEmptyCaps(caps.Inheritable)
-	out["permitted"] = handleNilOrEmptyCaps(caps.Permitted)
-	out["ambient"] = handleNilOrEmptyCaps(caps.Ambient)
-	return out
-}
-
 func (policy *regoEnforcer) EnforceCreateContainerPolicy(
 	ctx context.Context,
 	sandboxID string,
@@ -716,6 +724,15 @@ func (policy *regoEnforcer) EnforceCreateContainerPolicyV2(
 			"umask":                opts.Umask,
 			"capabilities":         mapifyCapabilities(opts.Capabilities),
 			"seccompProfileSHA256": opts.SeccompProfileSHA256,
+			"sysctls":              sysctlsToInput(opts.Sysctls),
+			"rlimits":              rlimitsToInput(opts.Rlimits),
+			"hostname":             opts.Hostname,
+			"hostNamespaces":       stringsToInput(opts.HostNamespaces),
+			"apparmorProfile":      opts.AppArmorProfile,
+			"selinuxLabel":         opts.SELinuxLabel,
+			"maskedPaths":          stringsToInput(opts.MaskedPaths),
+			"readonlyPaths":        stringsToInput(opts.ReadonlyPaths),
+			"oomScoreAdj":          opts.OOMScoreAdj,
 		}
 	case "windows":
 		// Dump full interpreter metadata for debugging diagnostics.
@@ -775,19 +792,6 @@ func (policy *regoEnforcer) EnforceDeviceUnmountPolicy(ctx context.Context, unmo
 	return err
 }
 
-func appendMountData(mountData []interface{}, mounts []oci.Mount) []interface{} {
-	for _, mount := range mounts {
-		mountData = append(mountData, inputData{
-			"destination": mount.Destination,
-			"source":      mount.Source,
-			"options":     mount.Options,
-			"type":        mount.Type,
-		})
-	}
-
-	return mountData
-}
-
 func (policy *regoEnforcer) ExtendDefaultMounts(mounts []oci.Mount) error {
 	policy.defaultMounts = append(policy.defaultMounts, mounts...)
 	defaultMounts := appendMountData([]interface{}{}, policy.defaultMounts)
@@ -919,6 +923,66 @@ func (policy *regoEnforcer) EnforceShutdownContainerPolicy(ctx context.Context,
 	return err
 }
 
+func (policy *regoEnforcer) EnforcePauseContainerPolicy(ctx context.Context, containerID string) error {
+	input := inputData{
+		"containerID": containerID,
+	}
+
+	_, err := policy.enforce(ctx, "pause_container", input)
+	return err
+}
+
+func (policy *regoEnforcer) EnforceResumeContainerPolicy(ctx context.Context, containerID string) error {
+	input := inputData{
+		"containerID": containerID,
+	}
+
+	_, err := policy.enforce(ctx, "resume_container", input)
+	return err
+}
+
+func (policy *regoEnforcer) EnforceCheckpointContainerPolicy(ctx context.Context, containerID string, imagePath string, imageEncrypted bool) error {
+	input := inputData{
+		"containerID":    containerID,
+		"imagePath":      imagePath,
+		"imageEncrypted": imageEncrypted,
+	}
+
+	_, err := policy.enforce(ctx, "checkpoint_container", input)
+	return err
+}
+
+func (policy *regoEnforcer) EnforceRestoreContainerPolicy(ctx context.Context, containerID string, imagePath string, imageDigest string) error {
+	input := inputData{
+		"containerID": containerID,
+		"imagePath":   imagePath,
+		"imageDigest": imageDigest,
+	}
+
+	_, err := policy.enforce(ctx, "restore_container", input)
+	return err
+}
+
+func (policy *regoEnforcer) EnforceCopyToContainerPolicy(ctx context.Context, containerID string, path string) error {
+	input := inputData{
+		"containerID": containerID,
+		"path":        path,
+	}
+
+	_, err := policy.enforce(ctx, "copy_to_container", input)
+	return err
+}
+
+func (policy *regoEnforcer) EnforceCopyFromContainerPolicy(ctx context.Context, containerID string, path string) error {
+	input := inputData{
+		"containerID": containerID,
+		"path":        path,
+	}
+
+	_, err := policy.enforce(ctx, "copy_from_container", input)
+	return err
+}
+
 func (policy *regoEnforcer) EnforceSignalContainerProcessPolicy(ctx context.Context, containerID string, signal syscall.Signal, isInitProcess bool, startupArgList []string) error {
 	opts := &SignalContainerOptions{
 		LinuxSignal:      signal,
@@ -1036,6 +1100,142 @@ func (policy *regoEnforcer) LoadFragment(ctx context.Context, issuer string, fee
 	return err
 }
 
+// ReplaceFragment replaces all fragments loaded from the feed with a fragment
+// of a newer SVN. The previously loaded module is kept if the replacement is
+// denied.
+func (policy *regoEnforcer) ReplaceFragment(ctx context.Context, issuer string, feed string, rego string) error {
+	namespace, err := parseNamespace(rego)
+	if err != nil {
+		return fmt.Errorf("unable to replace fragment: %w", err)
+	}
+
+	fragment := &rpi.RegoModule{
+		Issuer:    issuer,
+		Feed:      feed,
+		Code:      rego,
+		Namespace: namespace,
+	}
+
+	previous, hasPrevious := policy.rego.GetModule(fragment.ID())
+	policy.rego.AddModule(fragment.ID(), fragment)
+
+	input := inputData{
+		"issuer":    issuer,
+		"feed":      feed,
+		"namespace": namespace,
+	}
+
+	results, err := policy.enforce(ctx, "replace_fragment", input)
+	if err != nil {
+		if hasPrevious {
+			policy.rego.AddModule(fragment.ID(), previous)
+		} else {
+			policy.rego.RemoveModule(fragment.ID())
+		}
+		return err
+	}
+
+	addModule, _ := results.Bool("add_module")
+	if !addModule {
+		policy.rego.RemoveModule(fragment.ID())
+	}
+
+	return nil
+}
+
+// RevokeFragment unloads the fragments of the feed and prevents any further
+// fragments from being loaded from it.
+func (policy *regoEnforcer) RevokeFragment(ctx context.Context, issuer string, feed string) error {
+	input := inputData{
+		"issuer": issuer,
+		"feed":   feed,
+	}
+
+	results, err := policy.enforce(ctx, "revoke_fragment", input)
+	if err != nil {
+		return err
+	}
+
+	if removeModule, _ := results.Bool("remove_module"); removeModule {
+		policy.rego.RemoveModule(rpi.ModuleID(issuer, feed))
+	}
+	return nil
+}
+
+// SetFragmentMinimumSVN raises the minimum SVN of fragments loaded from the
+// feed. Loaded fragments below the new minimum are unloaded.
+func (policy *regoEnforcer) SetFragmentMinimumSVN(ctx context.Context, issuer string, feed string, minimumSVN string) error {
+	input := inputData{
+		"issuer":      issuer,
+		"feed":        feed,
+		"minimum_svn": minimumSVN,
+	}
+
+	results, err := policy.enforce(ctx, "set_fragment_minimum_svn", input)
+	if err != nil {
+		return err
+	}
+
+	if removeModule, _ := results.Bool("remove_module"); removeModule {
+		policy.rego.RemoveModule(rpi.ModuleID(issuer, feed))
+	}
+	return nil
+}
+
+func (policy *regoEnforcer) LoadedFragments(ctx context.Context) ([]LoadedFragment, error) {
+	resultSet, err := policy.rego.RawQuery("data.framework.loaded_fragments", nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query loaded fragments: %w", err)
+	}
+
+	if len(resultSet) == 0 || len(resultSet[0].Expressions) == 0 {
+		return nil, nil
+	}
+
+	values, ok := resultSet[0].Expressions[0].Value.([]interface{})
+	if !ok {
+		return nil, errors.New("loaded fragments are not a list")
+	}
+
+	fragments := make([]LoadedFragment, 0, len(values))
+	for _, value := range values {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("loaded fragment is not an object")
+		}
+
+		fragment := LoadedFragment{}
+		fragment.Issuer, _ = object["issuer"].(string)
+		fragment.Feed, _ = object["feed"].(string)
+		fragment.Namespace, _ = object["namespace"].(string)
+		if svn := object["svn"]; svn != nil {
+			fragment.SVN = fmt.Sprint(svn)
+		}
+		fragments = append(fragments, fragment)
+	}
+
+	return fragments, nil
+}
+
+// ReplacePolicy replaces the policy with a new version. The framework state,
+// e.g. mounted devices and running containers, and the loaded fragments are
+// kept, so the new policy takes effect for the enforcement points which
+// follow.
+func (policy *regoEnforcer) ReplacePolicy(ctx context.Context, base64EncodedPolicy string) error {
+	rawPolicy, err := base64.StdEncoding.DecodeString(base64EncodedPolicy)
+	if err != nil {
+		return fmt.Errorf("unable to decode policy from Base64 format: %w", err)
+	}
+
+	if err := policy.rego.SetCode(string(rawPolicy)); err != nil {
+		return fmt.Errorf("error replacing Rego policy: %w", err)
+	}
+	policy.base64policy = base64EncodedPolicy
+
+	log.G(ctx).Debug("security policy replaced")
+	return nil
+}
+
 func (policy *regoEnforcer) EnforceScratchMountPolicy(ctx context.Context, scratchPath string, encrypted bool) error {
 	input := map[string]interface{}{
 		"target":    scratchPath,
@@ -1059,6 +1259,15 @@ func (policy *regoEnforcer) EnforceScratchUnmountPolicy(ctx context.Context, scr
 	return nil
 }
 
+func (policy *regoEnforcer) EnforceReleaseKeyPolicy(ctx context.Context, keyID string, target string) error {
+	input := inputData{
+		"keyID":  keyID,
+		"target": target,
+	}
+	_, err := policy.enforce(ctx, "release_key", input)
+	return err
+}
+
 func (policy *regoEnforcer) EnforceVerifiedCIMsPolicy(ctx context.Context, containerID string, layerHashes []string) error {
 	log.G(ctx).Tracef("Enforcing verified cims in securitypolicy pkg %+v", layerHashes)
 	input := inputData{
@@ -0,0 +1,122 @@
+package securitypolicy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// PolicyIssuers lists the issuers trusted to sign the security policy of a
+// UVM. For a signed policy, the HostData of the UVM is the digest of this
+// document rather than of the policy, so that the policy can be replaced by
+// one signed later by the same issuers without relaunching the UVM.
+type PolicyIssuers struct {
+	Issuers []PolicyIssuer `json:"issuers"`
+}
+
+// PolicyIssuer is an issuer and feed trusted to sign security policies, along
+// with the minimum SVN of the policies accepted from them.
+type PolicyIssuer struct {
+	Issuer     string `json:"issuer"`
+	Feed       string `json:"feed"`
+	MinimumSVN string `json:"minimum_svn,omitempty"`
+}
+
+// SignedSecurityPolicy is a security policy which is signed as a COSE_Sign1
+// document, along with the issuers trusted to sign it. It is passed base64
+// encoded in place of the security policy.
+type SignedSecurityPolicy struct {
+	// Issuers is the base64 encoded JSON PolicyIssuers document.
+	Issuers string `json:"issuers"`
+	// Policy is the base64 encoded COSE_Sign1 document, whose payload is the
+	// Rego policy.
+	Policy string `json:"policy"`
+}
+
+// EncodeSignedSecurityPolicy returns the base64 encoded signed security policy
+// for the COSE_Sign1 document and the issuers trusted to sign it.
+func EncodeSignedSecurityPolicy(issuers *PolicyIssuers, coseSign1 []byte) (string, error) {
+	issuersJSON, err := json.Marshal(issuers)
+	if err != nil {
+		return "", err
+	}
+
+	signed, err := json.Marshal(SignedSecurityPolicy{
+		Issuers: base64.StdEncoding.EncodeToString(issuersJSON),
+		Policy:  base64.StdEncoding.EncodeToString(coseSign1),
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signed), nil
+}
+
+// parseSignedSecurityPolicy returns the signed security policy if rawPolicy
+// is one, and false otherwise.
+func parseSignedSecurityPolicy(rawPolicy []byte) (*SignedSecurityPolicy, bool) {
+	signed := &SignedSecurityPolicy{}
+	if err := json.Unmarshal(rawPolicy, signed); err != nil {
+		return nil, false
+	}
+	if len(signed.Issuers) == 0 || len(signed.Policy) == 0 {
+		return nil, false
+	}
+	return signed, true
+}
+
+// decodePolicyIssuers decodes and validates the base64 encoded JSON document
+// of the trusted issuers.
+func decodePolicyIssuers(encodedIssuers string) (*PolicyIssuers, error) {
+	rawIssuers, err := base64.StdEncoding.DecodeString(encodedIssuers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 policy issuers: %w", err)
+	}
+
+	issuers := &PolicyIssuers{}
+	if err := json.Unmarshal(rawIssuers, issuers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy issuers: %w", err)
+	}
+	if len(issuers.Issuers) == 0 {
+		return nil, fmt.Errorf("no policy issuers are trusted")
+	}
+	for _, i := range issuers.Issuers {
+		if len(i.Issuer) == 0 || len(i.Feed) == 0 {
+			return nil, fmt.Errorf("both issuer and feed must be provided for a policy issuer")
+		}
+		if len(i.MinimumSVN) > 0 {
+			if _, err := parseSVN(i.MinimumSVN); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return issuers, nil
+}
+
+// isPolicyIssuers returns whether rawPolicy is a document of trusted issuers,
+// which must not be accepted as a policy, as its digest is the HostData of
+// a signed policy.
+func isPolicyIssuers(rawPolicy []byte) bool {
+	issuers := &PolicyIssuers{}
+	return json.Unmarshal(rawPolicy, issuers) == nil && len(issuers.Issuers) > 0
+}
+
+// find returns the trusted issuer with the given issuer and feed.
+func (p *PolicyIssuers) find(issuer, feed string) (*PolicyIssuer, bool) {
+	for i := range p.Issuers {
+		if p.Issuers[i].Issuer == issuer && p.Issuers[i].Feed == feed {
+			return &p.Issuers[i], true
+		}
+	}
+	return nil, false
+}
+
+// parseSVN parses the SVN of a signed policy, which unlike the SVN of a
+// fragment must be a non-negative integer.
+func parseSVN(svn string) (uint64, error) {
+	n, err := strconv.ParseUint(svn, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid policy svn %q: %w", svn, err)
+	}
+	return n, nil
+}
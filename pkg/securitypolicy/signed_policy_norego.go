@@ -0,0 +1,12 @@
+//go:build !rego
+// +build !rego
+
+package securitypolicy
+
+import "errors"
+
+// PolicySVN returns the SVN declared by a signed policy. Signed policies are
+// enforced by the Rego enforcer, without which their SVN cannot be queried.
+func PolicySVN(code string) (uint64, error) {
+	return 0, errors.New("signed policies require the rego enforcer")
+}
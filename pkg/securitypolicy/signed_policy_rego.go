@@ -0,0 +1,38 @@
+//go:build rego
+// +build rego
+
+package securitypolicy
+
+import (
+	"fmt"
+
+	rpi "github.com/Microsoft/hcsshim/internal/regopolicyinterpreter"
+)
+
+// PolicySVN returns the SVN declared by a signed policy, e.g. `svn := "2"`.
+// As by the enforcer, the policy is compiled along with the framework and the
+// API, and the SVN is the value of data.policy.svn.
+func PolicySVN(code string) (uint64, error) {
+	r, err := rpi.NewRegoPolicyInterpreter(code, map[string]interface{}{})
+	if err != nil {
+		return 0, fmt.Errorf("unable to create interpreter for signed policy: %w", err)
+	}
+	r.AddModule("framework.rego", &rpi.RegoModule{Namespace: "framework", Code: FrameworkCode})
+	r.AddModule("api.rego", &rpi.RegoModule{Namespace: "api", Code: APICode})
+	if err := r.Compile(); err != nil {
+		return 0, fmt.Errorf("rego compilation failed: %w", err)
+	}
+
+	result, err := r.RawQuery("data.policy.svn", nil)
+	if err != nil {
+		return 0, fmt.Errorf("unable to query the svn of the signed policy: %w", err)
+	}
+	if len(result) == 0 || len(result[0].Expressions) == 0 {
+		return 0, fmt.Errorf("signed policy does not declare an svn")
+	}
+	svn, ok := result[0].Expressions[0].Value.(string)
+	if !ok {
+		return 0, fmt.Errorf("svn of the signed policy is not a string: %v", result[0].Expressions[0].Value)
+	}
+	return parseSVN(svn)
+}
@@ -0,0 +1,337 @@
+//go:build linux && rego
+// +build linux,rego
+
+package securitypolicy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/cosesign1go/pkg/cosesign1"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Microsoft/hcsshim/internal/protocol/guestresource"
+	"github.com/Microsoft/hcsshim/pkg/attestation"
+)
+
+type testPolicySigner struct {
+	chainPem []byte
+	keyPem   []byte
+	issuer   string
+}
+
+// newTestPolicySigner generates a root and a leaf certificate, and the
+// did:x509 issuer for them.
+func newTestPolicySigner(t *testing.T) *testPolicySigner {
+	t.Helper()
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(time.Hour)
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P384(), cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Policy Root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(cryptorand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P384(), cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Policy Signer"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(cryptorand.Reader, leafTemplate, root, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := &testPolicySigner{
+		chainPem: append(
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})...),
+		keyPem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	signer.issuer, err = cosesign1.MakeDidX509("sha256", 1, string(signer.chainPem), "CN", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func (s *testPolicySigner) sign(t *testing.T, feed string, code string) []byte {
+	t.Helper()
+
+	algo, err := cosesign1.StringToAlgorithm("ES384")
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := cosesign1.CreateCoseSign1([]byte(code), s.issuer, feed, "application/rego", s.chainPem, s.keyPem, "rand", algo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func signedTestPolicyCode(t *testing.T, svn string, allowDumpStacks bool) string {
+	t.Helper()
+
+	code, err := MarshalPolicy("rego", false, []*Container{}, nil, nil, false, allowDumpStacks, false, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%s\nsvn := %q\n", code, svn)
+}
+
+func newTestSecurityOptions(t *testing.T) *SecurityOptions {
+	t.Helper()
+
+	// the policies deny runtime logging
+	t.Cleanup(func() { logrus.SetOutput(os.Stderr) })
+	return NewSecurityOptions(&ClosedDoorSecurityPolicyEnforcer{}, false, "", io.Discard)
+}
+
+const testPolicyFeed = "contoso.azurecr.io/policy"
+
+func Test_SignedPolicy(t *testing.T) {
+	ctx := context.Background()
+	signer := newTestPolicySigner(t)
+	issuers := &PolicyIssuers{
+		Issuers: []PolicyIssuer{{Issuer: signer.issuer, Feed: testPolicyFeed, MinimumSVN: "1"}},
+	}
+
+	signed, err := EncodeSignedSecurityPolicy(issuers, signer.sign(t, testPolicyFeed, signedTestPolicyCode(t, "1", false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the HostData binds the issuers rather than the policy
+	digest, err := NewSecurityPolicyDigest(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuersJSON, err := json.Marshal(issuers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := sha256.Sum256(issuersJSON); string(digest) != string(expected[:]) {
+		t.Fatal("digest of a signed policy is not the digest of its issuers")
+	}
+
+	s := newTestSecurityOptions(t)
+	if err := s.SetConfidentialOptions(ctx, "rego", signed, ""); err != nil {
+		t.Fatalf("failed to set signed policy: %s", err)
+	}
+	if err := s.PolicyEnforcer.EnforceDumpStacksPolicy(ctx); err == nil {
+		t.Fatal("expected dump stacks to be denied by the initial policy")
+	}
+
+	replacement := signedTestPolicyCode(t, "2", true)
+	for _, tc := range []struct {
+		name     string
+		envelope []byte
+	}{
+		{
+			name:     "SameSVN",
+			envelope: signer.sign(t, testPolicyFeed, signedTestPolicyCode(t, "1", true)),
+		},
+		{
+			name:     "UntrustedFeed",
+			envelope: signer.sign(t, "contoso.azurecr.io/other", replacement),
+		},
+		{
+			name:     "UntrustedIssuer",
+			envelope: newTestPolicySigner(t).sign(t, testPolicyFeed, replacement),
+		},
+		{
+			name:     "NoSVN",
+			envelope: signer.sign(t, testPolicyFeed, "package policy\n"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := s.ReplaceSignedPolicy(ctx, &guestresource.SignedSecurityPolicy{
+				Policy: base64.StdEncoding.EncodeToString(tc.envelope),
+			})
+			if err == nil {
+				t.Fatal("expected replacement to be rejected")
+			}
+		})
+	}
+
+	err = s.ReplaceSignedPolicy(ctx, &guestresource.SignedSecurityPolicy{
+		Policy: base64.StdEncoding.EncodeToString(signer.sign(t, testPolicyFeed, replacement)),
+	})
+	if err != nil {
+		t.Fatalf("failed to replace signed policy: %s", err)
+	}
+	if err := s.PolicyEnforcer.EnforceDumpStacksPolicy(ctx); err != nil {
+		t.Fatalf("expected dump stacks to be allowed by the replacement policy: %s", err)
+	}
+	if s.PolicyEnforcer.EncodedSecurityPolicy() != base64.StdEncoding.EncodeToString([]byte(replacement)) {
+		t.Fatal("encoded security policy was not replaced")
+	}
+}
+
+func Test_SignedPolicy_MinimumSVN(t *testing.T) {
+	signer := newTestPolicySigner(t)
+	issuers := &PolicyIssuers{
+		Issuers: []PolicyIssuer{{Issuer: signer.issuer, Feed: testPolicyFeed, MinimumSVN: "3"}},
+	}
+
+	signed, err := EncodeSignedSecurityPolicy(issuers, signer.sign(t, testPolicyFeed, signedTestPolicyCode(t, "2", false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSecurityOptions(t)
+	if err := s.SetConfidentialOptions(context.Background(), "rego", signed, ""); err == nil {
+		t.Fatal("expected policy below the minimum svn to be rejected")
+	}
+}
+
+// Test_PolicySVN checks that the svn is taken from the compiled policy, rather
+// than from the text of its declaration.
+func Test_PolicySVN(t *testing.T) {
+	code := signedTestPolicyCode(t, "2", false)
+	for _, tc := range []struct {
+		name string
+		code string
+		svn  uint64
+	}{
+		{
+			name: "Declared",
+			code: code,
+			svn:  2,
+		},
+		{
+			name: "Computed",
+			code: strings.Replace(code, `svn := "2"`, `svn := concat("", ["1", "2"])`, 1),
+			svn:  12,
+		},
+		{
+			name: "Commented",
+			code: strings.Replace(code, `svn := "2"`, "# svn := \"2\"\nsvn := \"3\"", 1),
+			svn:  3,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svn, err := PolicySVN(tc.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if svn != tc.svn {
+				t.Fatalf("expected svn %d, got %d", tc.svn, svn)
+			}
+		})
+	}
+
+	for _, invalid := range []string{
+		strings.Replace(code, `svn := "2"`, "", 1),
+		strings.Replace(code, `svn := "2"`, `svn := "-1"`, 1),
+		strings.Replace(code, `svn := "2"`, `svn := 2`, 1),
+	} {
+		if _, err := PolicySVN(invalid); err == nil {
+			t.Errorf("expected svn of policy to be invalid:\n%s", invalid)
+		}
+	}
+}
+
+// Test_SignedPolicy_IssuersAsPolicy checks that the issuers document is not
+// accepted as a policy, as it has the same digest as a signed policy.
+func Test_SignedPolicy_IssuersAsPolicy(t *testing.T) {
+	issuersJSON, err := json.Marshal(&PolicyIssuers{
+		Issuers: []PolicyIssuer{{Issuer: "did:x509:0:sha256:test::subject:CN:test", Feed: testPolicyFeed}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSecurityOptions(t)
+	err = s.SetConfidentialOptions(context.Background(), "rego", base64.StdEncoding.EncodeToString(issuersJSON), "")
+	if err == nil {
+		t.Fatal("expected issuers document to be rejected as a policy")
+	}
+}
+
+func Test_ReplaceSignedPolicy_Unsigned(t *testing.T) {
+	code, err := MarshalPolicy("rego", false, []*Container{}, nil, nil, false, false, false, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSecurityOptions(t)
+	if err := s.SetConfidentialOptions(context.Background(), "rego", base64.StdEncoding.EncodeToString([]byte(code)), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := newTestPolicySigner(t).sign(t, testPolicyFeed, signedTestPolicyCode(t, "1", true))
+	err = s.ReplaceSignedPolicy(context.Background(), &guestresource.SignedSecurityPolicy{
+		Policy: base64.StdEncoding.EncodeToString(envelope),
+	})
+	if err == nil {
+		t.Fatal("expected an unsigned policy not to be replaceable")
+	}
+}
+
+func Test_SetConfidentialOptions_HostData(t *testing.T) {
+	code, err := MarshalPolicy("rego", false, []*Container{}, nil, nil, false, false, false, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(code))
+	digest, err := NewSecurityPolicyDigest(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSecurityOptions(t)
+	s.SetAttestationProvider(attestation.NewFakeProvider(make([]byte, 32)))
+	if err := s.SetConfidentialOptions(context.Background(), "rego", encoded, ""); err == nil {
+		t.Fatal("expected policy not bound by the HostData to be rejected")
+	}
+
+	s = newTestSecurityOptions(t)
+	s.SetAttestationProvider(attestation.NewFakeProvider(digest))
+	if err := s.SetConfidentialOptions(context.Background(), "rego", encoded, ""); err != nil {
+		t.Fatalf("expected policy bound by the HostData to be set: %s", err)
+	}
+}